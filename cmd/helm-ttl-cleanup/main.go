@@ -0,0 +1,511 @@
+// Command helm-ttl-cleanup is a minimal replacement for the kubectl image in
+// TTL CronJobs. It guards against the CronJob firing before the TTL
+// expires, publishes the manifest of a two-phase uninstall, waits for an
+// abort of the expiry or, in the Job of a job-sleep TTL, for the expiry
+// itself, verifies the
+// release is gone and deletes its leftover PVCs, the
+// release namespace and the CronJob or Job itself through the Kubernetes API using
+// the pod's service account, so it can ship as a single static binary in a
+// distroless image. When the TTL was set with --on-failure-webhook, a
+// failing command reports its output to the webhook.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/batchcompat"
+	"github.com/josegonzalez/helm-ttl/pkg/notify"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// fieldManager is the field manager the manifest ConfigMap is applied
+	// with, the same as helm-ttl's.
+	fieldManager = "helm-ttl"
+	// abortExitCode is the exit code of an aborted wait-abort, which the
+	// uninstall Job fails on without retrying.
+	abortExitCode = 3
+)
+
+// errAborted is returned by wait-abort when the CronJob is annotated
+// helm-ttl/abort=true.
+var errAborted = errors.New("uninstall aborted")
+
+const usage = `usage:
+  helm-ttl-cleanup check-expiry NOT_BEFORE
+  helm-ttl-cleanup sleep-until TIME
+  helm-ttl-cleanup publish-manifest --namespace NAMESPACE --manifest FILE [--delay DURATION] CRONJOB
+  helm-ttl-cleanup wait-abort --namespace NAMESPACE --delay DURATION CRONJOB
+  helm-ttl-cleanup verify-uninstalled --namespace NAMESPACE [--storage secrets|configmaps] [--keep-history] RELEASE
+  helm-ttl-cleanup delete-namespace [--delay DURATION] NAME
+  helm-ttl-cleanup delete-pvcs --namespace NAMESPACE SELECTOR
+  helm-ttl-cleanup delete-cronjob --namespace NAMESPACE NAME
+  helm-ttl-cleanup delete-job --namespace NAMESPACE NAME`
+
+// pollInterval is how often delete-namespace --delay checks whether the
+// namespace is already gone; replaced in tests.
+var pollInterval = 10 * time.Second
+
+// now returns the current time; replaced in tests.
+var now = time.Now
+
+// clientFactory creates the Kubernetes client; replaced in tests.
+type clientFactory func() (kubernetes.Interface, error)
+
+func main() {
+	ctx := context.Background()
+
+	var logs bytes.Buffer
+	if err := run(ctx, os.Args[1:], inClusterClient, io.MultiWriter(os.Stdout, &logs)); err != nil {
+		code := 1
+		if errors.Is(err, errAborted) {
+			code = abortExitCode
+		}
+
+		_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
+		_, _ = fmt.Fprintln(&logs, "Error:", err)
+		if err := reportFailure(ctx, logs.String(), code); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(code)
+	}
+}
+
+// reportFailure posts the output of a failed command to the webhook in
+// the environment of the uninstall Job, if any, with the code it exits
+// with.
+func reportFailure(ctx context.Context, logs string, exitCode int) error {
+	webhook := os.Getenv(notify.FailureWebhookEnv)
+	if webhook == "" {
+		return nil
+	}
+
+	// The proxy and CA bundle only apply to the report, so they do not
+	// come from HTTPS_PROXY, which would also route the in-cluster client
+	client, err := notify.DefaultHTTPClientFactory(notify.HTTPClientOptions{
+		CAData: []byte(os.Getenv(notify.FailureCABundleEnv)),
+		Proxy:  os.Getenv(notify.FailureProxyEnv),
+	})
+	if err != nil {
+		return err
+	}
+
+	pod, _ := os.Hostname()
+	return notify.PostFailureReport(ctx, client, webhook, notify.FailureReport{
+		Release:   os.Getenv("RELEASE_NAME"),
+		Namespace: os.Getenv("RELEASE_NAMESPACE"),
+		Container: os.Getenv(notify.FailureContainerEnv),
+		Pod:       pod,
+		ExitCode:  exitCode,
+		Logs:      logs,
+	})
+}
+
+func inClusterClient() (kubernetes.Interface, error) {
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load in-cluster config: %w", err)
+	}
+
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Jobs of job-sleep TTLs run on clusters without CronJobs, where
+	// only the commands not touching CronJobs are used
+	wrapped, err := batchcompat.Wrap(client)
+	if _, unsupported := err.(*batchcompat.UnsupportedError); unsupported {
+		return client, nil
+	}
+
+	return wrapped, err
+}
+
+func run(ctx context.Context, args []string, newClient clientFactory, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", usage)
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	namespace := fs.String("namespace", "", "namespace of the CronJob or release")
+	keepHistory := fs.Bool("keep-history", false, "allow storage records marked uninstalled to remain")
+	delay := fs.Duration("delay", 0, "wait this long before deleting the namespace or uninstalling")
+	manifest := fs.String("manifest", "", "file holding the manifest the uninstall will delete")
+	storage := fs.String("storage", "secrets", "resource helm stores releases in: secrets or configmaps")
+	if err := fs.Parse(args[1:]); err != nil {
+		return fmt.Errorf("%w\n%s", err, usage)
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%s requires exactly one NAME\n%s", args[0], usage)
+	}
+	name := fs.Arg(0)
+
+	switch args[0] {
+	case "check-expiry":
+		return checkExpiry(out, name)
+
+	case "sleep-until":
+		return sleepUntil(ctx, out, name)
+
+	case "publish-manifest":
+		if *namespace == "" || *manifest == "" {
+			return fmt.Errorf("publish-manifest requires --namespace and --manifest\n%s", usage)
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		return publishManifest(ctx, client, out, *namespace, name, *manifest, *delay)
+
+	case "wait-abort":
+		if *namespace == "" || *delay <= 0 {
+			return fmt.Errorf("wait-abort requires --namespace and a positive --delay\n%s", usage)
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		return waitAbort(ctx, client, out, *namespace, name, *delay)
+
+	case "verify-uninstalled":
+		if *namespace == "" {
+			return fmt.Errorf("verify-uninstalled requires --namespace\n%s", usage)
+		}
+
+		if *storage != "secrets" && *storage != "configmaps" {
+			return fmt.Errorf("unsupported --storage %q: use secrets or configmaps\n%s", *storage, usage)
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		return verifyUninstalled(ctx, client, out, *namespace, name, *storage, *keepHistory)
+
+	case "delete-namespace":
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		if *delay > 0 {
+			gone, err := waitDelay(ctx, client, out, name, *delay)
+			if err != nil || gone {
+				return err
+			}
+		}
+
+		return report(out, "namespace", name, client.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{}))
+
+	case "delete-pvcs":
+		if *namespace == "" {
+			return fmt.Errorf("delete-pvcs requires --namespace\n%s", usage)
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		return deletePVCs(ctx, client, out, *namespace, name)
+
+	case "delete-cronjob":
+		if *namespace == "" {
+			return fmt.Errorf("delete-cronjob requires --namespace\n%s", usage)
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		return report(out, "cronjob", name, client.BatchV1().CronJobs(*namespace).Delete(ctx, name, metav1.DeleteOptions{}))
+
+	case "delete-job":
+		if *namespace == "" {
+			return fmt.Errorf("delete-job requires --namespace\n%s", usage)
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		// The API orphans the pods of a Job deleted without a propagation
+		// policy; this one is still running in one of them
+		background := metav1.DeletePropagationBackground
+		return report(out, "job", name, client.BatchV1().Jobs(*namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &background}))
+
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+// checkExpiry fails when it runs before notBefore, an RFC3339 time. The
+// cron schedule of a TTL has no year, so a CronJob can fire a year early.
+func checkExpiry(out io.Writer, notBefore string) error {
+	t, err := time.Parse(time.RFC3339, notBefore)
+	if err != nil {
+		return fmt.Errorf("invalid NOT_BEFORE %q: use an RFC3339 time\n%s", notBefore, usage)
+	}
+
+	if now().Before(t) {
+		return fmt.Errorf("refusing to uninstall before %s: the CronJob fired early, e.g. in the wrong year", t.UTC().Format(time.RFC3339))
+	}
+
+	_, _ = fmt.Fprintf(out, "expiry %s reached\n", t.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// sleepUntil waits until t, an RFC3339 time, in the Job of a job-sleep
+// TTL.
+func sleepUntil(ctx context.Context, out io.Writer, t string) error {
+	until, err := time.Parse(time.RFC3339, t)
+	if err != nil {
+		return fmt.Errorf("invalid TIME %q: use an RFC3339 time\n%s", t, usage)
+	}
+
+	wait := until.Sub(now())
+	if wait <= 0 {
+		return nil
+	}
+
+	_, _ = fmt.Fprintf(out, "waiting until %s before uninstalling\n", until.UTC().Format(time.RFC3339))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+	}
+
+	return nil
+}
+
+// publishManifest publishes the manifest a two-phase uninstall will delete
+// to the CRONJOB-manifest ConfigMap and an UninstallPending Event on the
+// CronJob, then waits delay. A missing manifest means the release was
+// already gone, so there is nothing to publish.
+func publishManifest(ctx context.Context, client kubernetes.Interface, out io.Writer, namespace, cronJob, path string, delay time.Duration) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		_, _ = fmt.Fprintln(out, "no manifest to publish")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	cj, err := client.BatchV1().CronJobs(namespace).Get(ctx, cronJob, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get cronjob %q: %w", cronJob, err)
+	}
+
+	labels := map[string]string{"app.kubernetes.io/managed-by": "helm-ttl"}
+	for _, key := range []string{"helm-ttl/release", "helm-ttl/release-namespace"} {
+		labels[key] = cj.Labels[key]
+	}
+	release, releaseNamespace := cj.Annotations["helm-ttl/release"], cj.Annotations["helm-ttl/release-namespace"]
+
+	name := cronJob + "-manifest"
+	cm := corev1ac.ConfigMap(name, namespace).
+		WithLabels(labels).
+		WithData(map[string]string{"manifest.yaml": string(data)})
+	if _, err := client.CoreV1().ConfigMaps(namespace).Apply(ctx, cm, metav1.ApplyOptions{FieldManager: fieldManager, Force: true}); err != nil {
+		return fmt.Errorf("failed to publish manifest to configmap %q: %w", name, err)
+	}
+	_, _ = fmt.Fprintf(out, "manifest published to configmap %s/%s\n", namespace, name)
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: cronJob + ".",
+			Namespace:    namespace,
+			Labels:       labels,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "batch/v1",
+			Kind:       "CronJob",
+			Name:       cronJob,
+			Namespace:  namespace,
+			UID:        cj.UID,
+		},
+		Type:   corev1.EventTypeNormal,
+		Reason: "UninstallPending",
+		Message: fmt.Sprintf("release %s in namespace %s will be uninstalled in %s; the manifest to delete is in ConfigMap %s/%s",
+			release, releaseNamespace, delay, namespace, name),
+		Source:              corev1.EventSource{Component: "helm-ttl"},
+		ReportingController: "helm-ttl",
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+	}
+	if _, err := client.CoreV1().Events(namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to record UninstallPending event: %w", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "waiting %s before uninstalling release %s\n", delay, release)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+	}
+
+	return nil
+}
+
+// waitAbort reads the annotations of a TTL CronJob every pollInterval for
+// delay, and fails with errAborted as soon as helm-ttl/abort is "true".
+func waitAbort(ctx context.Context, client kubernetes.Interface, out io.Writer, namespace, cronJob string, delay time.Duration) error {
+	_, _ = fmt.Fprintf(out, "uninstalling in %s unless cronjob %s is annotated helm-ttl/abort=true\n", delay, cronJob)
+
+	deadline := now().Add(delay)
+	for {
+		cj, err := client.BatchV1().CronJobs(namespace).Get(ctx, cronJob, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get cronjob %q: %w", cronJob, err)
+		}
+
+		if cj.Annotations["helm-ttl/abort"] == "true" {
+			return fmt.Errorf("%w: cronjob %s is annotated helm-ttl/abort=true", errAborted, cronJob)
+		}
+
+		remaining := deadline.Sub(now())
+		if remaining <= 0 {
+			_, _ = fmt.Fprintln(out, "not aborted; uninstalling")
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(remaining, pollInterval)):
+		}
+	}
+}
+
+// verifyUninstalled fails when helm left storage records for the release
+// behind in Secrets or ConfigMaps. It matches the selector of
+// ttl.ReleaseStorageSelector.
+func verifyUninstalled(ctx context.Context, client kubernetes.Interface, out io.Writer, namespace, release, storage string, keepHistory bool) error {
+	selector := "owner=helm,name=" + release
+	if keepHistory {
+		selector += ",status!=uninstalled"
+	}
+	opts := metav1.ListOptions{LabelSelector: selector}
+
+	var names []string
+	if storage == "configmaps" {
+		cms, err := client.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list storage records of release %q: %w", release, err)
+		}
+
+		for _, cm := range cms.Items {
+			names = append(names, cm.Name)
+		}
+	} else {
+		secrets, err := client.CoreV1().Secrets(namespace).List(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list storage records of release %q: %w", release, err)
+		}
+
+		for _, s := range secrets.Items {
+			names = append(names, s.Name)
+		}
+	}
+
+	if len(names) > 0 {
+
+		return fmt.Errorf("release %q still has storage records after uninstall: %s", release, strings.Join(names, ", "))
+	}
+
+	_, _ = fmt.Fprintf(out, "release %q uninstalled\n", release)
+	return nil
+}
+
+// deletePVCs deletes the PersistentVolumeClaims matching selector, which
+// helm uninstall leaves behind. Claims still in use are only deleted once
+// their pods are gone.
+func deletePVCs(ctx context.Context, client kubernetes.Interface, out io.Writer, namespace, selector string) error {
+	pvcs, err := client.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list persistentvolumeclaims matching %q: %w", selector, err)
+	}
+
+	if len(pvcs.Items) == 0 {
+		_, _ = fmt.Fprintf(out, "no persistentvolumeclaims match %q\n", selector)
+		return nil
+	}
+
+	for _, pvc := range pvcs.Items {
+		if err := report(out, "persistentvolumeclaim", pvc.Name, client.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, pvc.Name, metav1.DeleteOptions{})); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitDelay waits delay before a namespace is deleted, checking every
+// pollInterval. It reports true when the namespace disappears first.
+func waitDelay(ctx context.Context, client kubernetes.Interface, out io.Writer, namespace string, delay time.Duration) (bool, error) {
+	_, _ = fmt.Fprintf(out, "waiting %s before deleting namespace %s\n", delay, namespace)
+
+	deadline := time.Now().Add(delay)
+	for {
+		_, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, _ = fmt.Fprintf(out, "namespace %q already deleted\n", namespace)
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to get namespace %q: %w", namespace, err)
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(min(remaining, pollInterval)):
+		}
+	}
+}
+
+// report prints the outcome of a delete. A resource that is already gone
+// counts as deleted, so a retried pod does not fail.
+func report(out io.Writer, kind, name string, err error) error {
+	switch {
+	case err == nil:
+		_, _ = fmt.Fprintf(out, "%s %q deleted\n", kind, name)
+	case apierrors.IsNotFound(err):
+		_, _ = fmt.Fprintf(out, "%s %q already deleted\n", kind, name)
+	default:
+		return fmt.Errorf("failed to delete %s %q: %w", kind, name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func clientOf(client kubernetes.Interface) clientFactory {
+	return func() (kubernetes.Interface, error) {
+		return client, nil
+	}
+}
+
+// helmSecret returns a helm storage record for a release in staging.
+func helmSecret(name, release, status string) *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      name,
+		Namespace: "staging",
+		Labels:    map[string]string{"owner": "helm", "name": release, "status": status},
+	}}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("check-expiry", func(t *testing.T) {
+		now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+		t.Cleanup(func() { now = time.Now })
+
+		var out bytes.Buffer
+		err := run(ctx, []string{"check-expiry", "2026-03-01T12:00:00Z"}, nil, &out)
+		require.NoError(t, err)
+		assert.Equal(t, "expiry 2026-03-01T12:00:00Z reached\n", out.String())
+
+		err = run(ctx, []string{"check-expiry", "2027-03-01T07:00:00-05:00"}, nil, &bytes.Buffer{})
+		assert.EqualError(t, err, "refusing to uninstall before 2027-03-01T12:00:00Z: the CronJob fired early, e.g. in the wrong year")
+	})
+
+	t.Run("sleep-until", func(t *testing.T) {
+		now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+		t.Cleanup(func() { now = time.Now })
+
+		var out bytes.Buffer
+		err := run(ctx, []string{"sleep-until", "2026-03-01T11:00:00Z"}, nil, &out)
+		require.NoError(t, err)
+		assert.Empty(t, out.String())
+
+		out.Reset()
+		err = run(ctx, []string{"sleep-until", "2026-03-01T12:00:00.01Z"}, nil, &out)
+		require.NoError(t, err)
+		assert.Equal(t, "waiting until 2026-03-01T12:00:00Z before uninstalling\n", out.String())
+	})
+
+	t.Run("sleep-until cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := run(ctx, []string{"sleep-until", time.Now().Add(time.Hour).Format(time.RFC3339)}, nil, &bytes.Buffer{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("delete-namespace", func(t *testing.T) {
+		client := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "staging"}})
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"delete-namespace", "staging"}, clientOf(client), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "namespace \"staging\" deleted\n", out.String())
+
+		_, err = client.CoreV1().Namespaces().Get(ctx, "staging", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("delete-namespace already deleted", func(t *testing.T) {
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"delete-namespace", "staging"}, clientOf(fake.NewClientset()), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "namespace \"staging\" already deleted\n", out.String())
+	})
+
+	t.Run("delete-namespace with delay", func(t *testing.T) {
+		pollInterval = time.Millisecond
+		t.Cleanup(func() { pollInterval = 10 * time.Second })
+
+		client := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "staging"}})
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"delete-namespace", "--delay", "5ms", "staging"}, clientOf(client), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "waiting 5ms before deleting namespace staging\nnamespace \"staging\" deleted\n", out.String())
+
+		_, err = client.CoreV1().Namespaces().Get(ctx, "staging", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("delete-namespace with delay already deleted", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("delete", "namespaces", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("unexpected delete")
+		})
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"delete-namespace", "--delay", "1h", "staging"}, clientOf(client), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "waiting 1h0m0s before deleting namespace staging\nnamespace \"staging\" already deleted\n", out.String())
+	})
+
+	t.Run("delete-namespace with delay get error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "namespaces", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		err := run(ctx, []string{"delete-namespace", "--delay", "1h", "staging"}, clientOf(client), &bytes.Buffer{})
+		assert.EqualError(t, err, `failed to get namespace "staging": forbidden`)
+	})
+
+	t.Run("delete-namespace with delay cancelled", func(t *testing.T) {
+		client := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "staging"}})
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := run(cancelled, []string{"delete-namespace", "--delay", "1h", "staging"}, clientOf(client), &bytes.Buffer{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("delete-cronjob", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Namespace: "ops"}})
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"delete-cronjob", "--namespace", "ops", "myapp-80081014-ttl"}, clientOf(client), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "cronjob \"myapp-80081014-ttl\" deleted\n", out.String())
+
+		_, err = client.BatchV1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("delete-job", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Namespace: "ops"}})
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"delete-job", "--namespace", "ops", "myapp-80081014-ttl"}, clientOf(client), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "job \"myapp-80081014-ttl\" deleted\n", out.String())
+
+		deleteAction := client.Actions()[0].(k8stesting.DeleteActionImpl)
+		assert.Equal(t, metav1.DeletePropagationBackground, *deleteAction.DeleteOptions.PropagationPolicy)
+		_, err = client.BatchV1().Jobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("delete-job requires namespace", func(t *testing.T) {
+		err := run(ctx, []string{"delete-job", "myapp-80081014-ttl"}, clientOf(fake.NewClientset()), &bytes.Buffer{})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "requires --namespace")
+	})
+
+	t.Run("delete-pvcs", func(t *testing.T) {
+		pvc := func(name, instance string) *corev1.PersistentVolumeClaim {
+			return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "staging",
+				Labels:    map[string]string{"app.kubernetes.io/instance": instance},
+			}}
+		}
+		client := fake.NewClientset(pvc("data-myapp-0", "myapp"), pvc("data-myapp-1", "myapp"), pvc("data-other-0", "other"))
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"delete-pvcs", "--namespace", "staging", "app.kubernetes.io/instance=myapp"}, clientOf(client), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "persistentvolumeclaim \"data-myapp-0\" deleted\npersistentvolumeclaim \"data-myapp-1\" deleted\n", out.String())
+
+		pvcs, err := client.CoreV1().PersistentVolumeClaims("staging").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, pvcs.Items, 1)
+		assert.Equal(t, "data-other-0", pvcs.Items[0].Name)
+	})
+
+	t.Run("delete-pvcs without matches", func(t *testing.T) {
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"delete-pvcs", "--namespace", "staging", "app.kubernetes.io/instance=myapp"}, clientOf(fake.NewClientset()), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "no persistentvolumeclaims match \"app.kubernetes.io/instance=myapp\"\n", out.String())
+	})
+
+	t.Run("delete-pvcs errors", func(t *testing.T) {
+		err := run(ctx, []string{"delete-pvcs", "app.kubernetes.io/instance=myapp"}, clientOf(fake.NewClientset()), &bytes.Buffer{})
+		assert.ErrorContains(t, err, "delete-pvcs requires --namespace")
+
+		err = run(ctx, []string{"delete-pvcs", "--namespace", "staging", "app=myapp"}, func() (kubernetes.Interface, error) {
+			return nil, errors.New("no cluster")
+		}, &bytes.Buffer{})
+		assert.EqualError(t, err, "no cluster")
+
+		client := fake.NewClientset()
+		client.PrependReactor("list", "persistentvolumeclaims", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+		err = run(ctx, []string{"delete-pvcs", "--namespace", "staging", "app=myapp"}, clientOf(client), &bytes.Buffer{})
+		assert.EqualError(t, err, `failed to list persistentvolumeclaims matching "app=myapp": forbidden`)
+
+		client = fake.NewClientset(&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "staging", Labels: map[string]string{"app": "myapp"}}})
+		client.PrependReactor("delete", "persistentvolumeclaims", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+		err = run(ctx, []string{"delete-pvcs", "--namespace", "staging", "app=myapp"}, clientOf(client), &bytes.Buffer{})
+		assert.EqualError(t, err, `failed to delete persistentvolumeclaim "data": forbidden`)
+	})
+
+	t.Run("verify-uninstalled", func(t *testing.T) {
+		client := fake.NewClientset(helmSecret("sh.helm.release.v1.other.v1", "other", "deployed"))
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"verify-uninstalled", "--namespace", "staging", "myapp"}, clientOf(client), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "release \"myapp\" uninstalled\n", out.String())
+	})
+
+	t.Run("verify-uninstalled with records left", func(t *testing.T) {
+		client := fake.NewClientset(
+			helmSecret("sh.helm.release.v1.myapp.v1", "myapp", "superseded"),
+			helmSecret("sh.helm.release.v1.myapp.v2", "myapp", "deployed"),
+		)
+
+		err := run(ctx, []string{"verify-uninstalled", "--namespace", "staging", "myapp"}, clientOf(client), &bytes.Buffer{})
+		assert.EqualError(t, err, `release "myapp" still has storage records after uninstall: sh.helm.release.v1.myapp.v1, sh.helm.release.v1.myapp.v2`)
+	})
+
+	t.Run("verify-uninstalled with keep-history", func(t *testing.T) {
+		client := fake.NewClientset(helmSecret("sh.helm.release.v1.myapp.v1", "myapp", "uninstalled"))
+
+		err := run(ctx, []string{"verify-uninstalled", "--namespace", "staging", "--keep-history", "myapp"}, clientOf(client), &bytes.Buffer{})
+		require.NoError(t, err)
+
+		err = run(ctx, []string{"verify-uninstalled", "--namespace", "staging", "myapp"}, clientOf(client), &bytes.Buffer{})
+		assert.Error(t, err)
+	})
+
+	t.Run("verify-uninstalled with configmaps storage", func(t *testing.T) {
+		client := fake.NewClientset(
+			helmSecret("sh.helm.release.v1.myapp.v1", "myapp", "deployed"),
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:      "sh.helm.release.v1.other.v1",
+				Namespace: "staging",
+				Labels:    map[string]string{"owner": "helm", "name": "other", "status": "deployed"},
+			}},
+		)
+
+		err := run(ctx, []string{"verify-uninstalled", "--namespace", "staging", "--storage", "configmaps", "myapp"}, clientOf(client), &bytes.Buffer{})
+		require.NoError(t, err)
+
+		err = run(ctx, []string{"verify-uninstalled", "--namespace", "staging", "--storage", "configmaps", "other"}, clientOf(client), &bytes.Buffer{})
+		assert.EqualError(t, err, `release "other" still has storage records after uninstall: sh.helm.release.v1.other.v1`)
+	})
+
+	t.Run("verify-uninstalled configmaps list error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("list", "configmaps", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		err := run(ctx, []string{"verify-uninstalled", "--namespace", "staging", "--storage", "configmaps", "myapp"}, clientOf(client), &bytes.Buffer{})
+		assert.EqualError(t, err, `failed to list storage records of release "myapp": forbidden`)
+	})
+
+	t.Run("verify-uninstalled unsupported storage", func(t *testing.T) {
+		err := run(ctx, []string{"verify-uninstalled", "--namespace", "staging", "--storage", "sql", "myapp"}, clientOf(fake.NewClientset()), &bytes.Buffer{})
+		assert.ErrorContains(t, err, `unsupported --storage "sql"`)
+	})
+
+	t.Run("verify-uninstalled requires namespace", func(t *testing.T) {
+		err := run(ctx, []string{"verify-uninstalled", "myapp"}, clientOf(fake.NewClientset()), &bytes.Buffer{})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "requires --namespace")
+	})
+
+	t.Run("verify-uninstalled list error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("list", "secrets", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		err := run(ctx, []string{"verify-uninstalled", "--namespace", "staging", "myapp"}, clientOf(client), &bytes.Buffer{})
+		assert.EqualError(t, err, `failed to list storage records of release "myapp": forbidden`)
+	})
+
+	t.Run("publish-manifest", func(t *testing.T) {
+		manifest := filepath.Join(t.TempDir(), "manifest.yaml")
+		require.NoError(t, os.WriteFile(manifest, []byte("kind: Service\n"), 0o600))
+		client := fake.NewClientset(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{
+			Name:        "myapp-80081014-ttl",
+			Namespace:   "ops",
+			Labels:      map[string]string{"helm-ttl/release": "myapp", "helm-ttl/release-namespace": "staging"},
+			Annotations: map[string]string{"helm-ttl/release": "myapp", "helm-ttl/release-namespace": "staging"},
+		}})
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"publish-manifest", "--namespace", "ops", "--manifest", manifest, "--delay", "1ms", "myapp-80081014-ttl"}, clientOf(client), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "manifest published to configmap ops/myapp-80081014-ttl-manifest\nwaiting 1ms before uninstalling release myapp\n", out.String())
+
+		cm, err := client.CoreV1().ConfigMaps("ops").Get(ctx, "myapp-80081014-ttl-manifest", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"manifest.yaml": "kind: Service\n"}, cm.Data)
+		assert.Equal(t, map[string]string{
+			"app.kubernetes.io/managed-by": "helm-ttl",
+			"helm-ttl/release":             "myapp",
+			"helm-ttl/release-namespace":   "staging",
+		}, cm.Labels)
+
+		events, err := client.CoreV1().Events("ops").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, events.Items, 1)
+		assert.Equal(t, "UninstallPending", events.Items[0].Reason)
+		assert.Equal(t, "myapp-80081014-ttl", events.Items[0].InvolvedObject.Name)
+		assert.Equal(t, "release myapp in namespace staging will be uninstalled in 1ms; the manifest to delete is in ConfigMap ops/myapp-80081014-ttl-manifest", events.Items[0].Message)
+	})
+
+	t.Run("publish-manifest without manifest", func(t *testing.T) {
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"publish-manifest", "--namespace", "ops", "--manifest", filepath.Join(t.TempDir(), "manifest.yaml"), "--delay", "1h", "myapp-80081014-ttl"}, clientOf(fake.NewClientset()), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "no manifest to publish\n", out.String())
+	})
+
+	t.Run("publish-manifest cronjob error", func(t *testing.T) {
+		manifest := filepath.Join(t.TempDir(), "manifest.yaml")
+		require.NoError(t, os.WriteFile(manifest, []byte("kind: Service\n"), 0o600))
+
+		err := run(ctx, []string{"publish-manifest", "--namespace", "ops", "--manifest", manifest, "myapp-80081014-ttl"}, clientOf(fake.NewClientset()), &bytes.Buffer{})
+		assert.ErrorContains(t, err, `failed to get cronjob "myapp-80081014-ttl"`)
+	})
+
+	t.Run("publish-manifest cancelled", func(t *testing.T) {
+		manifest := filepath.Join(t.TempDir(), "manifest.yaml")
+		require.NoError(t, os.WriteFile(manifest, []byte("kind: Service\n"), 0o600))
+		client := fake.NewClientset(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Namespace: "ops"}})
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := run(cancelled, []string{"publish-manifest", "--namespace", "ops", "--manifest", manifest, "--delay", "1h", "myapp-80081014-ttl"}, clientOf(client), &bytes.Buffer{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("publish-manifest requires namespace and manifest", func(t *testing.T) {
+		err := run(ctx, []string{"publish-manifest", "--namespace", "ops", "myapp-80081014-ttl"}, clientOf(fake.NewClientset()), &bytes.Buffer{})
+		assert.ErrorContains(t, err, "requires --namespace and --manifest")
+	})
+
+	t.Run("wait-abort", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Namespace: "ops"}})
+		var out bytes.Buffer
+
+		err := run(ctx, []string{"wait-abort", "--namespace", "ops", "--delay", "1ms", "myapp-80081014-ttl"}, clientOf(client), &out)
+		require.NoError(t, err)
+		assert.Equal(t, "uninstalling in 1ms unless cronjob myapp-80081014-ttl is annotated helm-ttl/abort=true\nnot aborted; uninstalling\n", out.String())
+	})
+
+	t.Run("wait-abort aborted", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{
+			Name:        "myapp-80081014-ttl",
+			Namespace:   "ops",
+			Annotations: map[string]string{"helm-ttl/abort": "true"},
+		}})
+
+		err := run(ctx, []string{"wait-abort", "--namespace", "ops", "--delay", "1h", "myapp-80081014-ttl"}, clientOf(client), &bytes.Buffer{})
+		assert.ErrorIs(t, err, errAborted)
+		assert.EqualError(t, err, "uninstall aborted: cronjob myapp-80081014-ttl is annotated helm-ttl/abort=true")
+	})
+
+	t.Run("wait-abort cronjob error", func(t *testing.T) {
+		err := run(ctx, []string{"wait-abort", "--namespace", "ops", "--delay", "1h", "myapp-80081014-ttl"}, clientOf(fake.NewClientset()), &bytes.Buffer{})
+		assert.ErrorContains(t, err, `failed to get cronjob "myapp-80081014-ttl"`)
+		assert.NotErrorIs(t, err, errAborted)
+	})
+
+	t.Run("wait-abort requires namespace and delay", func(t *testing.T) {
+		err := run(ctx, []string{"wait-abort", "--namespace", "ops", "myapp-80081014-ttl"}, clientOf(fake.NewClientset()), &bytes.Buffer{})
+		assert.ErrorContains(t, err, "requires --namespace and a positive --delay")
+	})
+
+	t.Run("delete-cronjob requires namespace", func(t *testing.T) {
+		err := run(ctx, []string{"delete-cronjob", "myapp-80081014-ttl"}, clientOf(fake.NewClientset()), &bytes.Buffer{})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "requires --namespace")
+	})
+
+	t.Run("delete error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("delete", "namespaces", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		err := run(ctx, []string{"delete-namespace", "staging"}, clientOf(client), &bytes.Buffer{})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `failed to delete namespace "staging": forbidden`)
+	})
+
+	t.Run("client error", func(t *testing.T) {
+		failing := func() (kubernetes.Interface, error) {
+			return nil, errors.New("no config")
+		}
+
+		for _, args := range [][]string{
+			{"verify-uninstalled", "--namespace", "staging", "x"},
+			{"delete-namespace", "staging"},
+			{"delete-cronjob", "--namespace", "ops", "x"},
+			{"delete-job", "--namespace", "ops", "x"},
+			{"publish-manifest", "--namespace", "ops", "--manifest", "m", "x"},
+		} {
+			err := run(ctx, args, failing, &bytes.Buffer{})
+			assert.EqualError(t, err, "no config")
+		}
+	})
+
+	t.Run("usage errors", func(t *testing.T) {
+		tests := map[string][]string{
+			"missing command": nil,
+			"unknown command": {"delete-pod", "x"},
+			"missing name":    {"delete-namespace"},
+			"extra args":      {"delete-namespace", "a", "b"},
+			"unknown flag":    {"delete-namespace", "--force", "a"},
+			"invalid delay":   {"delete-namespace", "--delay", "soon", "a"},
+			"invalid expiry":  {"check-expiry", "tomorrow"},
+			"invalid sleep":   {"sleep-until", "tomorrow"},
+		}
+
+		for name, args := range tests {
+			t.Run(name, func(t *testing.T) {
+				err := run(ctx, args, clientOf(fake.NewClientset()), &bytes.Buffer{})
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "usage:")
+			})
+		}
+	})
+}
+
+func TestInClusterClient(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "")
+
+	_, err := inClusterClient()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load in-cluster config")
+}
+
+func TestReportFailure(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("without webhook", func(t *testing.T) {
+		t.Setenv(notify.FailureWebhookEnv, "")
+		assert.NoError(t, reportFailure(ctx, "Error: boom\n", 1))
+	})
+
+	t.Run("posts the logs", func(t *testing.T) {
+		var got notify.FailureReport
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		t.Setenv(notify.FailureWebhookEnv, server.URL)
+		t.Setenv(notify.FailureContainerEnv, "delete-namespace")
+		t.Setenv("RELEASE_NAME", "myapp")
+		t.Setenv("RELEASE_NAMESPACE", "staging")
+
+		require.NoError(t, reportFailure(ctx, "Error: failed to delete namespace \"staging\": forbidden\n", 1))
+
+		pod, _ := os.Hostname()
+		assert.Equal(t, notify.FailureReport{
+			Release:   "myapp",
+			Namespace: "staging",
+			Container: "delete-namespace",
+			Pod:       pod,
+			ExitCode:  1,
+			Logs:      "Error: failed to delete namespace \"staging\": forbidden\n",
+		}, got)
+	})
+
+	t.Run("through the report proxy", func(t *testing.T) {
+		var host string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host = r.URL.Host
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer proxy.Close()
+
+		t.Setenv(notify.FailureWebhookEnv, "http://hooks.example.com/ttl")
+		t.Setenv(notify.FailureProxyEnv, proxy.URL)
+
+		require.NoError(t, reportFailure(ctx, "Error: boom\n", 1))
+		assert.Equal(t, "hooks.example.com", host)
+	})
+
+	t.Run("trusts the CA bundle", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		t.Setenv(notify.FailureWebhookEnv, server.URL)
+		t.Setenv(notify.FailureProxyEnv, "")
+		t.Setenv(notify.FailureCABundleEnv, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+
+		assert.NoError(t, reportFailure(ctx, "Error: boom\n", 1))
+	})
+
+	t.Run("invalid CA file", func(t *testing.T) {
+		t.Setenv(notify.FailureWebhookEnv, "https://hooks.example.com/ttl")
+		t.Setenv("HELM_TTL_CA_FILE", "/nonexistent/ca.pem")
+
+		assert.ErrorContains(t, reportFailure(ctx, "", 1), "failed to read CA file")
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newAdoptCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		cronjobNamespace string
+		cronJobName      string
+		dryRun           bool
+		outputFormat     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "adopt RELEASE",
+		Short: "Take over an existing CronJob as the TTL of a release",
+		Long: `Take over a CronJob created by hand, or by an older helm-ttl with other
+labels or naming, as the TTL of a release, so get, unset and run work on it.
+
+The CronJob is labeled and annotated as helm ttl set labels its CronJobs,
+and renamed to the current naming by creating it under the new name and
+deleting the original. A CronJob running as a ServiceAccount of its own
+name keeps it, as helm-ttl named its RBAC after it too. Without --cronjob,
+a CronJob named RELEASE-HASH-ttl, RELEASE-NAMESPACE-ttl or RELEASE-ttl is
+adopted.
+
+Its schedule must fire once, at the expiry, as 'M H D Mon *'. Its Job,
+ServiceAccount and RBAC are kept as they are; run helm ttl set afterwards
+to rebuild them.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+				return err
+			}
+
+			releaseNs := gf.getNamespace()
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = releaseNs
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			result, err := ttl.AdoptTTL(cmd.Context(), client, ttl.AdoptTTLOptions{
+				ReleaseName:      args[0],
+				ReleaseNamespace: releaseNs,
+				CronjobNamespace: cjNs,
+				CronJobName:      cronJobName,
+				DryRun:           dryRun,
+			})
+			if err != nil {
+				return err
+			}
+
+			output, err := ttl.FormatAdoptResult(result, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			gf.printOutput(cmd, outputFormat, output, result.CronJobName)
+			printWarnings(cmd, result.Warnings)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJob lives (default: release namespace)")
+	cmd.Flags().StringVar(&cronJobName, "cronjob", "", "name of the CronJob to adopt (default: RELEASE-HASH-ttl, RELEASE-NAMESPACE-ttl or RELEASE-ttl)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the changes without making them")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+
+	return cmd
+}
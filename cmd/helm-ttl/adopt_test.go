@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAdoptCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	handMade := func() *batchv1.CronJob {
+		return &batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "cleanup-myapp", Namespace: "default"},
+			Spec:       batchv1.CronJobSpec{Schedule: ttl.TimeToCronSchedule(time.Now().Add(48 * time.Hour))},
+		}
+	}
+
+	execute := func(client *fake.Clientset, args ...string) (string, error) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs(append([]string{"adopt"}, args...))
+
+		err := cmd.Execute()
+		return buf.String(), err
+	}
+
+	t.Run("adopts the named CronJob", func(t *testing.T) {
+		client := fake.NewClientset(handMade())
+
+		out, err := execute(client, "myapp", "--cronjob", "cleanup-myapp")
+		require.NoError(t, err)
+		assert.Contains(t, out, `Adopted CronJob cleanup-myapp as the TTL of release "myapp" in namespace "default"`)
+		assert.Contains(t, out, "rename cleanup-myapp to myapp-4a0c226a-ttl")
+
+		out, err = execute(client, "myapp")
+		require.NoError(t, err)
+		assert.Contains(t, out, "CronJob myapp-4a0c226a-ttl is already the TTL")
+
+		_, err = client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("dry run as json", func(t *testing.T) {
+		client := fake.NewClientset(handMade())
+
+		out, err := execute(client, "myapp", "--cronjob", "cleanup-myapp", "--dry-run", "-o", "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"dry_run": true`)
+		assert.Contains(t, out, `"cronjob_name": "myapp-4a0c226a-ttl"`)
+
+		_, err = client.BatchV1().CronJobs("default").Get(context.Background(), "cleanup-myapp", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("nothing to adopt", func(t *testing.T) {
+		_, err := execute(fake.NewClientset(), "myapp")
+		assert.ErrorContains(t, err, "no CronJob myapp-4a0c226a-ttl or myapp-default-ttl or myapp-ttl")
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newCheckCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		cronjobNamespace string
+		minRemaining     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check RELEASE",
+		Short: "Exit non-zero unless a release has a TTL with enough time left",
+		Long: `Check that a Helm release has a TTL that fires more than --min-remaining
+from now, for gating deploys in CI. Nothing is printed when the check
+passes; otherwise the reason is printed and the command exits non-zero.
+
+--min-remaining takes the same durations as extend: 4h, 1d, 1w, "2 days".`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var minimum time.Duration
+			if minRemaining != "" {
+				d, err := ttl.ParseDuration(minRemaining)
+				if err != nil {
+					return fmt.Errorf("invalid --min-remaining %q: use a duration such as 4h, 1d or 1w", minRemaining)
+				}
+
+				minimum = d
+			}
+
+			releaseName := args[0]
+			releaseNs := gf.getNamespace()
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = releaseNs
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			info, err := ttl.GetTTL(cmd.Context(), client, releaseName, releaseNs, cjNs)
+			if err != nil {
+				var notFound *ttl.TTLNotFoundError
+				if errors.As(err, &notFound) {
+					return reword(err, "no TTL set for release %q in namespace %q", releaseName, releaseNs)
+				}
+
+				return err
+			}
+
+			if info.Missed {
+				return fmt.Errorf("TTL for release %q in namespace %q was missed at %s", releaseName, releaseNs, info.ScheduledDate)
+			}
+
+			// ScheduledDate is always written by ttl.FormatScheduledDate.
+			scheduled, _ := time.Parse(time.RFC3339, info.ScheduledDate)
+
+			if remaining := time.Until(scheduled); remaining <= minimum {
+				return fmt.Errorf("TTL for release %q in namespace %q fires in %s, within --min-remaining %s",
+					releaseName, releaseNs, ttl.FormatRemaining(remaining), minRemaining)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJob lives (default: release namespace)")
+	cmd.Flags().StringVar(&minRemaining, "min-remaining", "", "fail unless the TTL fires more than this far in the future (e.g. 4h, 1d)")
+
+	return cmd
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCheckCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	execute := func(client *fake.Clientset, args ...string) (string, error) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs(append([]string{"check"}, args...))
+
+		err := cmd.Execute()
+		return buf.String(), err
+	}
+
+	t.Run("enough time left", func(t *testing.T) {
+		out, err := execute(fake.NewClientset(extendTestCronJob(t, "cart")), "cart", "--min-remaining", "4h")
+		require.NoError(t, err)
+		assert.Empty(t, out)
+	})
+
+	t.Run("TTL exists", func(t *testing.T) {
+		out, err := execute(fake.NewClientset(extendTestCronJob(t, "cart")), "cart")
+		require.NoError(t, err)
+		assert.Empty(t, out)
+	})
+
+	t.Run("too little time left", func(t *testing.T) {
+		out, err := execute(fake.NewClientset(extendTestCronJob(t, "cart")), "cart", "--min-remaining", "3d")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `TTL for release "cart" in namespace "default" fires in 1d23h`)
+		assert.Contains(t, err.Error(), "within --min-remaining 3d")
+		assert.NotContains(t, out, "Usage:")
+	})
+
+	t.Run("missed", func(t *testing.T) {
+		cj := extendTestCronJob(t, "cart")
+		cj.Spec.Schedule = ttl.TimeToCronSchedule(time.Now().Add(-time.Hour))
+		cj.CreationTimestamp = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+
+		_, err := execute(fake.NewClientset(cj), "cart")
+		assert.ErrorContains(t, err, `TTL for release "cart" in namespace "default" was missed at`)
+	})
+
+	t.Run("no TTL", func(t *testing.T) {
+		_, err := execute(fake.NewClientset(), "cart")
+		assert.EqualError(t, err, `no TTL set for release "cart" in namespace "default"`)
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := execute(client, "cart")
+		assert.ErrorContains(t, err, "failed to get CronJob")
+	})
+
+	t.Run("invalid min-remaining", func(t *testing.T) {
+		_, err := execute(fake.NewClientset(), "cart", "--min-remaining", "soon")
+		assert.ErrorContains(t, err, `invalid --min-remaining "soon"`)
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"check", "cart"})
+
+		err := cmd.Execute()
+		assert.ErrorContains(t, err, "failed to create kubernetes client")
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"helm.sh/helm/v3/pkg/helmpath"
+	"sigs.k8s.io/yaml"
+)
+
+// pluginConfig is the optional helm-ttl configuration file.
+type pluginConfig struct {
+	Metrics struct {
+		// StatsdAddr is the host:port of a statsd daemon that bulk
+		// commands report to.
+		StatsdAddr string `json:"statsdAddr"`
+	} `json:"metrics"`
+	Report struct {
+		// CPURate and MemoryRate are the monthly cost of a CPU core and
+		// of a GiB of memory that report prices requests at.
+		CPURate    float64 `json:"cpuRate"`
+		MemoryRate float64 `json:"memoryRate"`
+	} `json:"report"`
+}
+
+// pluginConfigPath returns HELM_TTL_CONFIG, or config.yaml in the
+// helm-ttl directory of the Helm config home (HELM_CONFIG_HOME).
+func pluginConfigPath() string {
+	if path := os.Getenv("HELM_TTL_CONFIG"); path != "" {
+		return path
+	}
+
+	return helmpath.ConfigPath("helm-ttl", "config.yaml")
+}
+
+// loadPluginConfig reads the plugin config. A missing file is an empty
+// config.
+func loadPluginConfig() (*pluginConfig, error) {
+	cfg := &pluginConfig{}
+	path := pluginConfigPath()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return cfg, nil
+		}
+
+		return nil, fmt.Errorf("failed to read plugin config: %w", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse plugin config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
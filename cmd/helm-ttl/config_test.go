@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPluginConfig(t *testing.T) {
+	t.Run("missing file", func(t *testing.T) {
+		t.Setenv("HELM_TTL_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+
+		cfg, err := loadPluginConfig()
+		require.NoError(t, err)
+		assert.Empty(t, cfg.Metrics.StatsdAddr)
+	})
+
+	t.Run("helm config home", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HELM_TTL_CONFIG", "")
+		t.Setenv("HELM_CONFIG_HOME", home)
+		require.NoError(t, os.MkdirAll(filepath.Join(home, "helm-ttl"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(home, "helm-ttl", "config.yaml"), []byte("metrics:\n  statsdAddr: 127.0.0.1:8125\n"), 0o600))
+
+		assert.Equal(t, filepath.Join(home, "helm-ttl", "config.yaml"), pluginConfigPath())
+		cfg, err := loadPluginConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:8125", cfg.Metrics.StatsdAddr)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		t.Setenv("HELM_TTL_CONFIG", path)
+		require.NoError(t, os.WriteFile(path, []byte("metrics:\n  statsd: 127.0.0.1:8125\n"), 0o600))
+
+		_, err := loadPluginConfig()
+		assert.ErrorContains(t, err, "failed to parse plugin config "+path)
+	})
+
+	t.Run("unreadable file", func(t *testing.T) {
+		t.Setenv("HELM_TTL_CONFIG", t.TempDir())
+
+		_, err := loadPluginConfig()
+		assert.ErrorContains(t, err, "failed to read plugin config")
+	})
+}
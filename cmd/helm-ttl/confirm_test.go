@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTerminal makes confirm treat any input as a terminal for the
+// duration of the test.
+func fakeTerminal(t *testing.T) {
+	t.Helper()
+
+	orig := isTerminal
+	isTerminal = func(io.Reader) bool { return true }
+	t.Cleanup(func() { isTerminal = orig })
+}
+
+func TestIsTerminal(t *testing.T) {
+	assert.False(t, isTerminal(&bytes.Buffer{}))
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer func() { _ = r.Close(); _ = w.Close() }()
+	assert.False(t, isTerminal(r))
+
+	_ = r.Close()
+	assert.False(t, isTerminal(r))
+}
+
+func TestConfirm(t *testing.T) {
+	t.Run("not a terminal", func(t *testing.T) {
+		cmd := &cobra.Command{}
+		var errBuf bytes.Buffer
+		cmd.SetIn(strings.NewReader(""))
+		cmd.SetErr(&errBuf)
+
+		assert.True(t, confirm(cmd, "Proceed?"))
+		assert.Empty(t, errBuf.String())
+	})
+
+	answers := map[string]bool{
+		"y\n":     true,
+		"YES\n":   true,
+		" yes ":   true,
+		"n\n":     false,
+		"\n":      false,
+		"":        false,
+		"maybe\n": false,
+	}
+	for answer, want := range answers {
+		t.Run("answer "+strings.TrimSpace(answer), func(t *testing.T) {
+			fakeTerminal(t)
+
+			cmd := &cobra.Command{}
+			var errBuf bytes.Buffer
+			cmd.SetIn(strings.NewReader(answer))
+			cmd.SetErr(&errBuf)
+
+			assert.Equal(t, want, confirm(cmd, "Proceed?"))
+			assert.Equal(t, "Proceed? [y/N]: ", errBuf.String())
+		})
+	}
+}
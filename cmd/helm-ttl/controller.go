@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/controller"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/pkg/action"
+)
+
+func newControllerCmd(cfgFactory configFactory, kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var opts controller.Options
+
+	cmd := &cobra.Command{
+		Use:   "controller",
+		Short: "Run the cluster-wide TTL controller in audit mode",
+		Long: `Run a controller that watches the whole cluster through shared informers
+and reports what it would do:
+
+  - create TTLs for releases without one in namespaces whose helm-ttl-config
+    ConfigMap sets defaultDuration
+  - execute expiries whose scheduled date passed without the CronJob firing
+  - prune ServiceAccount and RBAC resources whose CronJob is gone
+
+Releases and namespaces marked helm-ttl/protected=true are left alone.
+Each newly planned action is logged to stderr, and the number of planned
+actions of each type is served on /metrics.
+
+For TTLs of the cronjob and job-sleep backends only audit mode is
+implemented, so --dry-run is required; the controller never changes
+anything. With --backend controller the controller uninstalls the releases
+whose TTLs have expired itself, retrying failed expiries on every resync,
+and only reports the other actions; --dry-run reports the expiries too.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			opts.Log = cmd.ErrOrStderr()
+			opts.NewConfig = func(namespace, driver string) (*action.Configuration, error) {
+				kube := gf.kubeOptions()
+				kube.Driver = driver
+				return cfgFactory(namespace, kube)
+			}
+			c, err := controller.New(client, opts)
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			return c.Run(ctx)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "report what the controller would do without changing anything (required unless --backend controller)")
+	cmd.Flags().DurationVar(&opts.ResyncPeriod, "resync-period", time.Minute, "how often to recompute the plan when nothing changes")
+	cmd.Flags().StringVar(&opts.MetricsAddr, "metrics-addr", ":8080", "address to serve /metrics and /healthz on (empty to disable)")
+
+	return cmd
+}
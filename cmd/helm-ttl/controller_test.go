@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+)
+
+func TestControllerCmd(t *testing.T) {
+	t.Run("requires dry run", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"controller"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "run the controller with --dry-run")
+	})
+
+	t.Run("controller backend expires without dry run", func(t *testing.T) {
+		client, err := ttl.WithBackend(fake.NewClientset(), ttl.BackendController)
+		require.NoError(t, err)
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"controller", "--backend", "controller", "--metrics-addr", "invalid-address"})
+
+		err = cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "metrics server failed")
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"controller", "--dry-run"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create kubernetes client")
+	})
+
+	t.Run("metrics server error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"controller", "--dry-run", "--metrics-addr", "invalid-address"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "metrics server failed")
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/josegonzalez/helm-ttl/pkg/api/v1alpha1"
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newConvertCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		to               string
+		all              bool
+		cronjobNamespace string
+		outputDir        string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "convert (RELEASE | --all) --to BACKEND [flags]",
+		Short: "Convert TTLs to the objects of another backend",
+		Long: `Print the TTL of a release, or with --all every release TTL in the
+CronJob namespace, as the objects the backend given by --to keeps TTLs as,
+without changing anything in the cluster. The TTLs are read with --backend.
+
+Convert CronJob TTLs to ReleaseTTL custom resources to commit them to Git:
+
+  helm ttl convert --all --to releasettl
+
+and ReleaseTTLs back to CronJobs with --backend releasettl --to cronjob.
+A CronJob converted from a ReleaseTTL runs as the default ServiceAccount;
+set the TTL again with --create-service-account to give it its own.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if all == (len(args) == 1) {
+				return errors.New("specify a release or --all")
+			}
+
+			releaseNs := gf.getNamespace()
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = releaseNs
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			opts := ttl.ConvertTTLOptions{ReleaseNamespace: releaseNs, CronjobNamespace: cjNs, To: to}
+			if len(args) == 1 {
+				opts.ReleaseName = args[0]
+			}
+
+			objs, err := ttl.ConvertTTLs(cmd.Context(), client, opts)
+			if err != nil {
+				var notFound *ttl.TTLNotFoundError
+				if errors.As(err, &notFound) {
+					return reword(err, "no TTL set for release %q in namespace %q", opts.ReleaseName, releaseNs)
+				}
+
+				return err
+			}
+
+			return exportManifests(cmd, outputDir, objs)
+		},
+	}
+
+	cmd.Flags().StringVar(&to, "to", "", "backend to convert to: cronjob, job-sleep, controller or releasettl (required)")
+	cmd.Flags().BoolVar(&all, "all", false, "convert every release TTL in the CronJob namespace")
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the TTLs live (default: release namespace)")
+	cmd.Flags().StringVar(&outputDir, "output-dir", "-", "write each object as YAML to this directory (- for stdout)")
+	_ = cmd.MarkFlagRequired("to")
+
+	return cmd
+}
+
+func newCRDCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "crd",
+		Short: "Print the ReleaseTTL CustomResourceDefinition",
+		Long: `Print the CustomResourceDefinition of ReleaseTTL, the custom resource
+TTLs are kept as with --backend releasettl, to install it with:
+
+  helm ttl crd | kubectl apply -f -`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_, _ = fmt.Fprint(cmd.OutOrStdout(), v1alpha1.CRD)
+			return nil
+		},
+	}
+}
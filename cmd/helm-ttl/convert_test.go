@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/api/v1alpha1"
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConvertCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	cj, err := ttl.BuildCronJob(ttl.CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Schedule:         "30 14 15 3 *",
+		ServiceAccount:   "default",
+		ExpiresAt:        time.Date(2030, time.March, 15, 14, 30, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+
+	execute := func(args ...string) (string, error) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset(cj)))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs(args)
+
+		err := cmd.Execute()
+		return buf.String(), err
+	}
+
+	t.Run("release to releasettl", func(t *testing.T) {
+		out, err := execute("convert", "myapp", "--to", "releasettl")
+		require.NoError(t, err)
+		assert.Contains(t, out, "apiVersion: helm-ttl.io/v1alpha1")
+		assert.Contains(t, out, "kind: ReleaseTTL")
+		assert.Contains(t, out, "release: myapp")
+		assert.Contains(t, out, "expiresAt: \"2030-03-15T14:30:00Z\"")
+	})
+
+	t.Run("all", func(t *testing.T) {
+		out, err := execute("convert", "--all", "--to", "releasettl")
+		require.NoError(t, err)
+		assert.Contains(t, out, "name: myapp-4a0c226a-ttl")
+	})
+
+	t.Run("release or all", func(t *testing.T) {
+		_, err := execute("convert", "--to", "releasettl")
+		assert.EqualError(t, err, "specify a release or --all")
+
+		_, err = execute("convert", "myapp", "--all", "--to", "releasettl")
+		assert.EqualError(t, err, "specify a release or --all")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := execute("convert", "other", "--to", "releasettl")
+		assert.EqualError(t, err, `no TTL set for release "other" in namespace "default"`)
+	})
+
+	t.Run("to required", func(t *testing.T) {
+		_, err := execute("convert", "myapp")
+		assert.ErrorContains(t, err, `required flag(s) "to" not set`)
+	})
+}
+
+func TestCRDCmd(t *testing.T) {
+	cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"crd"})
+
+	require.NoError(t, cmd.Execute())
+	assert.Equal(t, v1alpha1.CRD, buf.String())
+	assert.Contains(t, buf.String(), "name: releasettls.helm-ttl.io")
+}
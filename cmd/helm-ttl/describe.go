@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newDescribeCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		outputFormat     string
+		cronjobNamespace string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "describe RELEASE",
+		Short: "Show a TTL with its live CronJob status and Job failures",
+		Long: `Show the TTL for a Helm release along with the live status of its
+CronJob: whether it is suspended, when it last ran, how many Jobs are
+active, and the failures and warning events of its Jobs. Use it to debug
+a TTL that did not fire.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			releaseName := args[0]
+			releaseNs := gf.getNamespace()
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = releaseNs
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			ctx := cmd.Context()
+			info, err := ttl.DescribeTTL(ctx, client, releaseName, releaseNs, cjNs)
+			if err != nil {
+				var notFound *ttl.TTLNotFoundError
+				if errors.As(err, &notFound) {
+					return reword(err, "no TTL set for release %q in namespace %q", releaseName, releaseNs)
+				}
+
+				return err
+			}
+
+			output, err := ttl.FormatOutput(*info, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprint(cmd.OutOrStdout(), output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJob lives (default: release namespace)")
+
+	return cmd
+}
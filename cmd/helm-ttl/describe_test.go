@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func describeTestObjects() []runtime.Object {
+	labels := map[string]string{
+		ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+		ttl.LabelRelease:          "myapp",
+		ttl.LabelReleaseNamespace: "default",
+	}
+
+	return []runtime.Object{
+		&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
+			Spec:       batchv1.CronJobSpec{Schedule: "30 14 15 3 *"},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl-1", Namespace: "default", Labels: labels},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{
+				Type:    batchv1.JobFailed,
+				Status:  corev1.ConditionTrue,
+				Reason:  "BackoffLimitExceeded",
+				Message: "Job has reached the specified backoff limit",
+			}}},
+		},
+	}
+}
+
+func TestDescribeCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	t.Run("text output", func(t *testing.T) {
+		client := fake.NewClientset(describeTestObjects()...)
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"describe", "myapp"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "30 14 15 3 *")
+		assert.Contains(t, buf.String(), "Suspended:        no")
+		assert.Contains(t, buf.String(), "myapp-4a0c226a-ttl-1  BackoffLimitExceeded: Job has reached the specified backoff limit")
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		client := fake.NewClientset(describeTestObjects()...)
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"describe", "myapp", "-o", "json"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), `"reason": "BackoffLimitExceeded"`)
+	})
+
+	t.Run("TTL not found", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"describe", "myapp", "--cronjob-namespace", "ops"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `no TTL set for release "myapp"`)
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		client := fake.NewClientset(describeTestObjects()...)
+		client.PrependReactor("list", "jobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"describe", "myapp"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to list Jobs")
+	})
+
+	t.Run("invalid output format", func(t *testing.T) {
+		client := fake.NewClientset(describeTestObjects()...)
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"describe", "myapp", "-o", "xml"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"describe", "myapp"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create kubernetes client")
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Exit codes of helm ttl, so scripts can branch on the outcome without
+// parsing stderr.
+const (
+	exitOK              = 0
+	exitError           = 1
+	exitTTLNotFound     = 2
+	exitReleaseNotFound = 3
+	exitRBAC            = 4
+	exitConflict        = 5
+	exitProtected       = 6
+)
+
+// exitCode returns the exit code for the error a command failed with,
+// from the typed errors of pkg/ttl and the Kubernetes API errors it wraps.
+func exitCode(err error) int {
+	var (
+		ttlNotFound       *ttl.TTLNotFoundError
+		namespaceNotFound *ttl.NamespaceTTLNotFoundError
+		releaseNotFound   *ttl.ReleaseNotFoundError
+		preflight         *ttl.PreflightError
+		conflict          *ttl.ConflictError
+		protected         *ttl.ProtectedError
+	)
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &ttlNotFound), errors.As(err, &namespaceNotFound):
+		return exitTTLNotFound
+	case errors.As(err, &releaseNotFound):
+		return exitReleaseNotFound
+	case errors.As(err, &preflight), apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return exitRBAC
+	case errors.As(err, &conflict):
+		return exitConflict
+	case errors.As(err, &protected):
+		return exitProtected
+	default:
+		return exitError
+	}
+}
+
+// rewordedError is a CLI message for an error of pkg/ttl that keeps the
+// original in its chain, so exitCode still finds it.
+type rewordedError struct {
+	msg string
+	err error
+}
+
+func (e *rewordedError) Error() string { return e.msg }
+
+func (e *rewordedError) Unwrap() error { return e.err }
+
+// reword replaces the message of err, keeping err for exitCode.
+func reword(err error, format string, args ...any) error {
+	return &rewordedError{msg: fmt.Sprintf(format, args...), err: err}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestExitCode(t *testing.T) {
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Group: "batch", Resource: "cronjobs"}, "myapp-ttl", errors.New("denied"))
+
+	for name, tc := range map[string]struct {
+		err  error
+		want int
+	}{
+		"nil":               {nil, 0},
+		"other":             {errors.New("boom"), 1},
+		"ttl not found":     {&ttl.TTLNotFoundError{Name: "myapp"}, 2},
+		"namespace ttl":     {&ttl.NamespaceTTLNotFoundError{Namespace: "preview"}, 2},
+		"reworded":          {reword(&ttl.TTLNotFoundError{Name: "myapp"}, "no TTL set"), 2},
+		"release not found": {&ttl.ReleaseNotFoundError{Name: "myapp"}, 3},
+		"forbidden":         {fmt.Errorf("failed to list CronJobs: %w", forbidden), 4},
+		"unauthorized":      {apierrors.NewUnauthorized("expired token"), 4},
+		"preflight":         {&ttl.PreflightError{}, 4},
+		"conflict":          {&ttl.ConflictError{}, 5},
+		"protected":         {&ttl.ProtectedError{}, 6},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, exitCode(tc.err))
+		})
+	}
+}
+
+func TestExitCodeOfCommands(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	execute := func(args ...string) error {
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(fake.NewClientset()))
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs(args)
+
+		return cmd.Execute()
+	}
+
+	err := execute("get", "myapp")
+	assert.EqualError(t, err, `no TTL set for release "myapp" in namespace "default"`)
+	assert.Equal(t, exitTTLNotFound, exitCode(err))
+
+	err = execute("set", "other", "1h", "--create-service-account")
+	assert.EqualError(t, err, `release "other" not found in namespace "default"`)
+	assert.Equal(t, exitReleaseNotFound, exitCode(err))
+}
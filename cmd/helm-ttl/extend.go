@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/notify"
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newExtendCmd(cfgFactory configFactory, kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		cronjobNamespace   string
+		selector           string
+		all                bool
+		outputFormat       string
+		expectedGeneration int64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "extend (RELEASE | --all [-l SELECTOR]) DURATION",
+		Short: "Push the expiry of one or more TTLs out",
+		Long: `Push the expiry of a TTL out by DURATION, counted from its current
+expiry (or from now if that has passed). DURATION is a Go duration, days
+or weeks shorthand, or a human-readable duration: 2h, 3d, 1w, "2 weeks".
+
+With --all, every TTL of a release in the namespace is extended; narrow
+it down with -l, a label selector matched against the release labels
+(helm install --labels). A summary table is printed, and the command
+fails if any TTL could not be extended.
+
+Like set, extend takes --expected-generation to fail instead of
+overwriting a change made since the TTL was last read.
+
+When a statsd daemon is configured, --all also sends it the time taken
+per release and success and error counts; see helm ttl --help.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all {
+				if cmd.Flags().Changed("expected-generation") {
+					return fmt.Errorf("--expected-generation cannot be used with --all")
+				}
+
+				if len(args) != 1 {
+					return fmt.Errorf("--all takes only DURATION, got %d arguments", len(args))
+				}
+
+				return nil
+			}
+
+			if selector != "" {
+				return fmt.Errorf("--selector requires --all")
+			}
+
+			if len(args) != 2 {
+				return fmt.Errorf("requires RELEASE and DURATION, or --all and DURATION")
+			}
+
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			by, err := ttl.ParseDuration(args[len(args)-1])
+			if err != nil {
+				return fmt.Errorf("invalid duration %q: use a duration such as 2h, 3d or 1w", args[len(args)-1])
+			}
+
+			releaseNs := gf.getNamespace()
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = releaseNs
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			ctx := cmd.Context()
+			if !all {
+				releaseName := args[0]
+				var expectedGen *int64
+				if cmd.Flags().Changed("expected-generation") {
+					expectedGen = &expectedGeneration
+				}
+
+				result, err := ttl.ExtendTTL(ctx, client, ttl.ExtendTTLOptions{
+					ReleaseName:        releaseName,
+					ReleaseNamespace:   releaseNs,
+					CronjobNamespace:   cjNs,
+					By:                 by,
+					ExpectedGeneration: expectedGen,
+				})
+				if err != nil {
+					var notFound *ttl.TTLNotFoundError
+					if errors.As(err, &notFound) {
+						return reword(err, "no TTL set for release %q in namespace %q", releaseName, releaseNs)
+					}
+
+					return err
+				}
+
+				gf.printOutput(cmd, "text", fmt.Sprintf("TTL for release %q in namespace %q extended to %s (was %s)\n",
+					releaseName, releaseNs, result.NewExpiry, result.OldExpiry), result.NewExpiry)
+				printWarnings(cmd, result.Warnings)
+				return nil
+			}
+
+			cfg, err := cfgFactory(releaseNs, gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create configuration: %w", err)
+			}
+
+			stats, err := newStatsd()
+			if err != nil {
+				return err
+			}
+			defer func() { _ = stats.Close() }()
+
+			results, err := ttl.ExtendTTLs(ctx, cfg, client, ttl.ExtendTTLsOptions{
+				ReleaseNamespace: releaseNs,
+				CronjobNamespace: cjNs,
+				Selector:         selector,
+				By:               by,
+			})
+			if err != nil {
+				return err
+			}
+
+			reportExtendMetrics(stats, results)
+
+			output, err := ttl.FormatExtendResults(results, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			gf.printOutput(cmd, outputFormat, output)
+
+			failed := 0
+			warned := map[string]bool{}
+			for _, r := range results {
+				for _, w := range r.Warnings {
+					if !warned[w] {
+						warned[w] = true
+						printWarnings(cmd, []string{w})
+					}
+				}
+
+				if r.Error != "" {
+					failed++
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("failed to extend %d of %d TTLs", failed, len(results))
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJobs live (default: release namespace)")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "with --all, only extend releases whose labels match this selector (e.g. team=checkout)")
+	cmd.Flags().BoolVar(&all, "all", false, "extend every TTL in the namespace")
+	cmd.Flags().Int64Var(&expectedGeneration, "expected-generation", 0, "fail unless the TTL is at this generation, as reported by get")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format for --all: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+
+	return cmd
+}
+
+// reportExtendMetrics sends the outcome and latency of each extended TTL
+// to statsd, tagged with the release and its namespace.
+func reportExtendMetrics(stats *notify.Statsd, results []ttl.ExtendResult) {
+	for _, r := range results {
+		tags := map[string]string{"release": r.ReleaseName, "namespace": r.ReleaseNamespace}
+		stats.Timing("extend.duration", time.Duration(r.DurationSeconds*float64(time.Second)), tags)
+
+		if r.Error != "" {
+			stats.Count("extend.errors", 1, tags)
+		} else {
+			stats.Count("extend.extended", 1, tags)
+		}
+	}
+}
+
+// printWarnings writes each warning to stderr, leaving stdout to the
+// result.
+func printWarnings(cmd *cobra.Command, warnings []string) {
+	for _, w := range warnings {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s\n", w)
+	}
+}
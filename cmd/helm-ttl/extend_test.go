@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// extendTestCronJob returns a TTL CronJob in default that fires in two days.
+func extendTestCronJob(t *testing.T, releaseName string) *batchv1.CronJob {
+	t.Helper()
+
+	cj, err := ttl.BuildCronJob(ttl.CronJobOptions{
+		ReleaseName:      releaseName,
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Schedule:         ttl.TimeToCronSchedule(time.Now().Add(48 * time.Hour)),
+		ServiceAccount:   "default",
+	})
+	require.NoError(t, err)
+	cj.CreationTimestamp = metav1.Now()
+
+	return cj
+}
+
+// labeledStore returns a configFactory whose store holds the release cart
+// in default, labeled team=checkout.
+func labeledStore(t *testing.T) configFactory {
+	t.Helper()
+
+	store := setupTestStore(t, "cart", "default")
+	rel, err := store.Last("cart")
+	require.NoError(t, err)
+	rel.Labels = map[string]string{"team": "checkout"}
+	require.NoError(t, store.Update(rel))
+
+	return testConfigFactory(store)
+}
+
+func TestExtendCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	t.Run("single release", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "cart"))
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"extend", "cart", "1w"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), `TTL for release "cart" in namespace "default" extended to`)
+	})
+
+	t.Run("single release without TTL", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"extend", "cart", "1w"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `no TTL set for release "cart"`)
+	})
+
+	t.Run("single release API error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"extend", "cart", "1w"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to get CronJob")
+	})
+
+	t.Run("all with selector", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "cart"), extendTestCronJob(t, "search"))
+
+		cmd := newRootCmd(labeledStore(t), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"extend", "--all", "-l", "team=checkout", "1w"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "cart")
+		assert.NotContains(t, buf.String(), "search")
+		assert.Contains(t, buf.String(), "Extended 1 of 1 TTLs")
+	})
+
+	t.Run("all with failures", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "cart"))
+		client.PrependReactor("update", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		cmd := newRootCmd(labeledStore(t), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"extend", "--all", "1w", "-o", "json"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to extend 1 of 1 TTLs")
+		assert.Contains(t, buf.String(), `"error"`)
+	})
+
+	t.Run("all reports to statsd", func(t *testing.T) {
+		server, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer func() { _ = server.Close() }()
+		t.Setenv("HELM_TTL_STATSD_ADDR", server.LocalAddr().String())
+
+		client := fake.NewClientset(extendTestCronJob(t, "cart"), extendTestCronJob(t, "search"))
+		client.PrependReactor("update", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.(k8stesting.UpdateAction).GetObject().(*batchv1.CronJob).Name == "search-81bd4a47-ttl" {
+				return true, nil, errors.New("forbidden")
+			}
+
+			return false, nil, nil
+		})
+
+		cmd := newRootCmd(labeledStore(t), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"extend", "--all", "1w"})
+
+		assert.Error(t, cmd.Execute())
+
+		var packets []string
+		packet := make([]byte, 1024)
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+		for range 4 {
+			n, _, err := server.ReadFrom(packet)
+			require.NoError(t, err)
+			packets = append(packets, string(packet[:n]))
+		}
+
+		assert.Regexp(t, `^helm_ttl\.extend\.duration:\d+\|ms\|#namespace:default,release:cart$`, packets[0])
+		assert.Equal(t, "helm_ttl.extend.extended:1|c|#namespace:default,release:cart", packets[1])
+		assert.Regexp(t, `^helm_ttl\.extend\.duration:\d+\|ms\|#namespace:default,release:search$`, packets[2])
+		assert.Equal(t, "helm_ttl.extend.errors:1|c|#namespace:default,release:search", packets[3])
+	})
+
+	t.Run("all with invalid statsd address", func(t *testing.T) {
+		t.Setenv("HELM_TTL_STATSD_ADDR", "no-port")
+
+		cmd := newRootCmd(labeledStore(t), testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"extend", "--all", "1w"})
+
+		err := cmd.Execute()
+		assert.ErrorContains(t, err, `HELM_TTL_STATSD_ADDR: invalid statsd address "no-port"`)
+	})
+
+	t.Run("all with invalid selector", func(t *testing.T) {
+		cmd := newRootCmd(labeledStore(t), testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"extend", "--all", "-l", "team in (", "1w"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid label selector")
+	})
+
+	t.Run("all with invalid output format", func(t *testing.T) {
+		cmd := newRootCmd(labeledStore(t), testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"extend", "--all", "1w", "-o", "xml"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+	})
+
+	t.Run("config error", func(t *testing.T) {
+		cmd := newRootCmd(errorConfigFactory(), testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"extend", "--all", "1w"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create configuration")
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"extend", "cart", "1w"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create kubernetes client")
+	})
+
+	t.Run("argument errors", func(t *testing.T) {
+		tests := map[string][]string{
+			"invalid duration":       {"extend", "cart", "tomorrow"},
+			"missing duration":       {"extend", "cart"},
+			"all with release":       {"extend", "--all", "cart", "1w"},
+			"selector without --all": {"extend", "-l", "team=checkout", "cart", "1w"},
+		}
+
+		for name, args := range tests {
+			t.Run(name, func(t *testing.T) {
+				cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+				var buf bytes.Buffer
+				cmd.SetOut(&buf)
+				cmd.SetErr(&buf)
+				cmd.SetArgs(args)
+
+				assert.Error(t, cmd.Execute())
+			})
+		}
+	})
+}
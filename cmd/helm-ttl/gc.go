@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newGCCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		dryRun        bool
+		yes           bool
+		allNamespaces bool
+		selector      string
+		outputFormat  string
+		concurrency   int
+		namespaces    []string
+		olderThan     time.Duration
+		stuckAfter    time.Duration
+		only          []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Delete every helm-ttl resource left behind",
+		Long: `Sweep the helm-ttl resources nothing else will clean up, by category:
+
+  stale-cronjobs   TTL CronJobs whose release or namespace is already gone
+  stuck-cronjobs   TTL CronJobs still around --stuck-after (default 48h) past
+                   their expiry, e.g. after the uninstall Job kept failing
+  run-jobs         finished Jobs of helm ttl run invocations that were
+                   interrupted before removing them
+  orphaned-rbac    ServiceAccounts and RBAC resources whose CronJob is gone,
+                   including those of the CronJobs swept
+
+A stuck CronJob is deleted without uninstalling its release; use helm ttl
+run or set to uninstall it instead. Resources of a TTL whose Job is still
+running are left alone. --only limits the sweep to some categories, e.g.
+--only run-jobs,orphaned-rbac.
+
+When run from a terminal, lists what would be deleted and asks for
+confirmation first; pass --yes to skip it. --dry-run reports what each
+category would delete.
+
+--namespace, --selector, --older-than and --concurrency work as for
+cleanup-rbac.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+				return err
+			}
+
+			if concurrency <= 0 {
+				return fmt.Errorf("invalid --concurrency %d: must be positive", concurrency)
+			}
+
+			if olderThan < 0 {
+				return fmt.Errorf("invalid --older-than %s: must not be negative", olderThan)
+			}
+
+			if stuckAfter <= 0 {
+				return fmt.Errorf("invalid --stuck-after %s: must be positive", stuckAfter)
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			if len(namespaces) == 0 {
+				namespaces = []string{gf.getNamespace()}
+			}
+
+			ctx := cmd.Context()
+			opts := ttl.GCOptions{
+				CleanupOrphanedOptions: ttl.CleanupOrphanedOptions{
+					Namespaces:    namespaces,
+					AllNamespaces: allNamespaces,
+					DryRun:        dryRun,
+					Selector:      selector,
+					Concurrency:   concurrency,
+					OlderThan:     olderThan,
+				},
+				Categories: only,
+				StuckAfter: stuckAfter,
+			}
+
+			if !dryRun && !yes && isTerminal(cmd.InOrStdin()) {
+				preview := opts
+				preview.DryRun = true
+				result, err := ttl.GarbageCollect(ctx, client, preview)
+				if err != nil {
+					return err
+				}
+
+				found := len(result.Resources())
+				if found == 0 {
+					out, err := ttl.FormatGCResult(result, outputFormat)
+					if err != nil {
+						return err
+					}
+
+					_, _ = fmt.Fprint(cmd.OutOrStdout(), out)
+					return nil
+				}
+
+				out, err := ttl.FormatGCResult(result, "text")
+				if err != nil {
+					return err
+				}
+
+				_, _ = fmt.Fprint(cmd.ErrOrStderr(), out)
+				if !confirm(cmd, fmt.Sprintf("Delete these %d resources?", found)) {
+					return fmt.Errorf("aborted: nothing was deleted")
+				}
+			}
+
+			stats, err := newStatsd()
+			if err != nil {
+				return err
+			}
+			defer func() { _ = stats.Close() }()
+
+			started := time.Now()
+			result, err := ttl.GarbageCollect(ctx, client, opts)
+			if !dryRun {
+				var deleted []ttl.OrphanedResource
+				if result != nil {
+					deleted = result.Resources()
+				}
+				reportCleanupMetrics(stats, time.Since(started), deleted, err)
+			}
+			if err != nil {
+				return err
+			}
+
+			out, err := ttl.FormatGCResult(result, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprint(cmd.OutOrStdout(), out)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what each category would delete without deleting")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "delete without asking for confirmation")
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "sweep all namespaces")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "only sweep resources matching this label selector (e.g. helm-ttl/release=myapp)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", ttl.DefaultCleanupConcurrency, "number of namespaces to sweep at once")
+	// Shadows the global --namespace, taking several namespaces
+	cmd.Flags().StringSliceVarP(&namespaces, "namespace", "n", nil, "namespaces to sweep, repeated or comma-separated (default: HELM_NAMESPACE or \"default\")")
+	cmd.Flags().DurationVar(&olderThan, "older-than", 0, "only sweep resources created at least this long ago, e.g. 24h")
+	cmd.Flags().DurationVar(&stuckAfter, "stuck-after", ttl.DefaultStuckAfter, "how long past its expiry a CronJob must be to count as stuck")
+	cmd.Flags().StringSliceVar(&only, "only", nil, "categories to sweep, repeated or comma-separated: stale-cronjobs, stuck-cronjobs, run-jobs, orphaned-rbac (default: all)")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+
+	return cmd
+}
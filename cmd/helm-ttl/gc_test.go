@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGCCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	ttlLabels := map[string]string{
+		ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+		ttl.LabelRelease:          "myapp",
+		ttl.LabelReleaseNamespace: "default",
+		ttl.LabelCronjobNamespace: "default",
+	}
+	sa := func() *corev1.ServiceAccount {
+		return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: ttlLabels}}
+	}
+	runJob := func() *batchv1.Job {
+		labels := map[string]string{ttl.LabelTriggeredBy: "run"}
+		for k, v := range ttlLabels {
+			labels[k] = v
+		}
+
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl-run", Namespace: "default", Labels: labels},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+			}},
+		}
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		client := fake.NewClientset(sa(), runJob())
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"gc", "--dry-run"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Equal(t, `stale-cronjobs: nothing found
+stuck-cronjobs: nothing found
+run-jobs:
+  Would delete Job myapp-4a0c226a-ttl-run in namespace default
+orphaned-rbac:
+  Would delete ServiceAccount myapp-4a0c226a-ttl in namespace default
+`, buf.String())
+
+		_, err := client.BatchV1().Jobs("default").Get(context.Background(), "myapp-4a0c226a-ttl-run", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("only some categories", func(t *testing.T) {
+		client := fake.NewClientset(sa(), runJob())
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"gc", "--only", "run-jobs", "-o", "json"})
+
+		require.NoError(t, cmd.Execute())
+
+		var result ttl.GCResult
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &result))
+		assert.Equal(t, ttl.GCResult{Categories: []ttl.GCCategoryResult{{
+			Category:  ttl.GCRunJobs,
+			Resources: []ttl.OrphanedResource{{Kind: "Job", Name: "myapp-4a0c226a-ttl-run", Namespace: "default"}},
+		}}}, result)
+
+		_, err := client.BatchV1().Jobs("default").Get(context.Background(), "myapp-4a0c226a-ttl-run", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+		_, err = client.CoreV1().ServiceAccounts("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid flags", func(t *testing.T) {
+		for _, tt := range []struct {
+			args []string
+			err  string
+		}{
+			{[]string{"--only", "pods"}, `unknown category "pods": use stale-cronjobs, stuck-cronjobs, run-jobs, orphaned-rbac`},
+			{[]string{"--stuck-after", "0s"}, "invalid --stuck-after 0s: must be positive"},
+			{[]string{"-o", "xml"}, "unsupported output format"},
+		} {
+			cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+			var buf bytes.Buffer
+			cmd.SetOut(&buf)
+			cmd.SetErr(&buf)
+			cmd.SetArgs(append([]string{"gc"}, tt.args...))
+
+			err := cmd.Execute()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		}
+	})
+}
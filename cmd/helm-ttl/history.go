@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newHistoryCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		outputFormat     string
+		cronjobNamespace string
+		noHeaders        bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "history RELEASE",
+		Short: "Show the audit trail of TTL changes for a release",
+		Long: `Show every set, extend, unset and run of the TTL for a Helm release:
+when it happened, who did it, and the expiry before and after. The history
+is kept in a ConfigMap next to the CronJob and survives the TTL being unset
+or firing.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			releaseName := args[0]
+			releaseNs := gf.getNamespace()
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = releaseNs
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			entries, err := ttl.GetHistory(cmd.Context(), client, releaseName, releaseNs, cjNs)
+			if err != nil {
+				return err
+			}
+
+			if outputFormat == "text" {
+				_, _ = fmt.Fprint(cmd.OutOrStdout(), ttl.FormatHistoryTable(entries, noHeaders))
+				return nil
+			}
+
+			output, err := ttl.FormatHistory(entries, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprint(cmd.OutOrStdout(), output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJob lives (default: release namespace)")
+	cmd.Flags().BoolVar(&noHeaders, "no-headers", false, "leave out the header row of the table")
+
+	return cmd
+}
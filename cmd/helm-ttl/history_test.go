@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func historyTestConfigMap() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl-history", Namespace: "default"},
+		Data: map[string]string{
+			"history": `[{"time":"2025-03-10T09:00:00Z","operation":"set","user":"alice","new_expiry":"2025-03-11T09:00:00Z"}]`,
+		},
+	}
+}
+
+func TestHistoryCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	t.Run("text output", func(t *testing.T) {
+		client := fake.NewClientset(historyTestConfigMap())
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"history", "myapp"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "TIME")
+		assert.Contains(t, buf.String(), "alice")
+		assert.Contains(t, buf.String(), "2025-03-11T09:00:00Z")
+	})
+
+	t.Run("yaml output", func(t *testing.T) {
+		client := fake.NewClientset(historyTestConfigMap())
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"history", "myapp", "-o", "yaml"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "operation: set")
+	})
+
+	t.Run("no history", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"history", "myapp", "--cronjob-namespace", "ops"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Equal(t, "No TTL history recorded.\n", buf.String())
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "configmaps", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"history", "myapp"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to get history ConfigMap")
+	})
+
+	t.Run("invalid output format", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"history", "myapp", "-o", "xml"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"history", "myapp"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create kubernetes client")
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newImagesCmd() *cobra.Command {
+	var (
+		outputFormat string
+		imageOpts    ttl.ImageOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "Print the container images used by TTL CronJobs",
+		Long: `Print the images that "helm ttl set" would use with the
+same image flags, so they can be mirrored to a private registry before
+scheduling TTLs in an air-gapped cluster.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			output, err := ttl.FormatImages(ttl.GetEffectiveImages(imageOpts), outputFormat)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprint(cmd.OutOrStdout(), output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+	cmd.Flags().StringVar(&imageOpts.HelmImage, "helm-image", "", "Helm container image (default: "+ttl.DefaultHelmImage+")")
+	cmd.Flags().StringVar(&imageOpts.KubectlImage, "kubectl-image", "", "kubectl container image (default: "+ttl.DefaultKubectlImage+")")
+	cmd.Flags().StringVar(&imageOpts.CleanupImage, "cleanup-image", "", "helm-ttl-cleanup image to use instead of kubectl")
+	cmd.Flags().StringVar(&imageOpts.RegistryPrefix, "registry-prefix", "", "pull the default images from this registry mirror (default: HELM_TTL_REGISTRY_PREFIX)")
+
+	return cmd
+}
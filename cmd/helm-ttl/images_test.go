@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImagesCmd(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		t.Setenv("HELM_TTL_REGISTRY_PREFIX", "")
+
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetArgs([]string{"images"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Equal(t, "helm:    "+ttl.DefaultHelmImage+"\nkubectl: "+ttl.DefaultKubectlImage+"\n", buf.String())
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetArgs([]string{"images", "--registry-prefix", "registry.example.com/mirror", "--kubectl-image", "custom/kubectl:v1", "-o", "json"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), `"helm": "registry.example.com/mirror/`+ttl.DefaultHelmImage+`"`)
+		assert.Contains(t, buf.String(), `"kubectl": "custom/kubectl:v1"`)
+	})
+
+	t.Run("invalid output format", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"images", "-o", "xml"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported output format")
+	})
+}
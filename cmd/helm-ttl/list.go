@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newListCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		outputFormat     string
+		cronjobNamespace string
+		allNamespaces    bool
+		columnSpec       string
+		sortBy           string
+		noHeaders        bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the TTLs in a namespace",
+		Long: `List the TTLs set on Helm releases and when each fires. The WARNING
+column flags TTLs whose ServiceAccount, or the role bindings helm ttl set
+created for it, are missing: their uninstall would fail with Forbidden when
+the TTL fires.
+
+--columns picks the columns of the table and their order, from release,
+namespace, cronjob-namespace, expires, remaining, delete-ns, schedule,
+generation and warning. --sort-by orders the TTLs by release (the default),
+namespace, expires or remaining; the last two list the TTLs that fire
+first at the top. --no-headers leaves out the header row, and --quiet
+prints only the release names, one per line, for shell pipelines.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+				return err
+			}
+
+			columns := ttl.DefaultTTLColumns
+			if cmd.Flags().Changed("columns") {
+				if outputFormat != "text" {
+					return fmt.Errorf("cannot use --columns with --output")
+				}
+
+				var err error
+				columns, err = ttl.ParseTTLColumns(columnSpec)
+				if err != nil {
+					return err
+				}
+			}
+
+			releaseNs := gf.getNamespace()
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = releaseNs
+			}
+
+			if allNamespaces {
+				releaseNs, cjNs = "", ""
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			ttls, err := ttl.ListTTLs(cmd.Context(), client, cjNs, releaseNs)
+			if err != nil {
+				return err
+			}
+
+			if err := ttl.SortTTLs(ttls, sortBy); err != nil {
+				return err
+			}
+
+			if outputFormat == "text" {
+				names := make([]string, len(ttls))
+				for i, info := range ttls {
+					names[i] = info.ReleaseName
+				}
+
+				gf.printOutput(cmd, outputFormat, ttl.FormatTTLTable(ttls, columns, noHeaders), names...)
+				return nil
+			}
+
+			output, err := ttl.FormatTTLList(ttls, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprint(cmd.OutOrStdout(), output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJobs live (default: release namespace)")
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "list TTLs in all namespaces")
+	cmd.Flags().StringVar(&columnSpec, "columns", strings.Join(ttl.DefaultTTLColumns, ","), "comma-separated columns of the table: "+strings.Join(ttl.TTLColumns, ", "))
+	cmd.Flags().BoolVar(&noHeaders, "no-headers", false, "leave out the header row of the table")
+	cmd.Flags().StringVar(&sortBy, "sort-by", "release", "order of the TTLs: "+strings.Join(ttl.TTLSortKeys, ", "))
+
+	return cmd
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestListCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	defaultSA := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}}
+
+	t.Run("text output", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "cart"), defaultSA)
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"list"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "WARNING")
+		assert.Contains(t, buf.String(), "cart")
+		assert.NotContains(t, buf.String(), "not found")
+	})
+
+	t.Run("warns about missing service account", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "cart"))
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"list", "-A", "-o", "json"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "ServiceAccount default not found in namespace default")
+	})
+
+	t.Run("columns and sort-by", func(t *testing.T) {
+		later := extendTestCronJob(t, "api")
+		later.Spec.Schedule = ttl.TimeToCronSchedule(time.Now().Add(96 * time.Hour))
+		client := fake.NewClientset(extendTestCronJob(t, "cart"), later, defaultSA)
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"list", "--columns", "release,delete-ns", "--sort-by", "remaining"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Equal(t, "RELEASE  DELETE NAMESPACE\ncart     no\napi      no\n", buf.String())
+	})
+
+	t.Run("quiet and no-headers", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "cart"), extendTestCronJob(t, "api"), defaultSA)
+
+		for args, want := range map[string]string{
+			"list -q":                             "api\ncart\n",
+			"list --no-headers --columns release": "api\ncart\n",
+			"list --no-headers --columns release,namespace": "api   default\ncart  default\n",
+		} {
+			cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+			var buf bytes.Buffer
+			cmd.SetOut(&buf)
+			cmd.SetErr(&buf)
+			cmd.SetArgs(strings.Fields(args))
+
+			require.NoError(t, cmd.Execute())
+			assert.Equal(t, want, buf.String(), args)
+		}
+	})
+
+	t.Run("unknown column", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"list", "--columns", "release,age"})
+
+		assert.ErrorContains(t, cmd.Execute(), `unknown column "age"`)
+	})
+
+	t.Run("columns with structured output", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"list", "--columns", "release", "-o", "json"})
+
+		assert.EqualError(t, cmd.Execute(), "cannot use --columns with --output")
+	})
+
+	t.Run("invalid sort key", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"list", "--sort-by", "age"})
+
+		assert.ErrorContains(t, cmd.Execute(), `invalid sort key "age"`)
+	})
+
+	t.Run("no TTLs", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"list", "--cronjob-namespace", "ops"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Equal(t, "No TTLs found.\n", buf.String())
+	})
+
+	t.Run("invalid output format", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"list", "-o", "xml"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported output format")
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("list", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"list"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to list CronJobs")
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"list"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "kubernetes client")
+	})
+}
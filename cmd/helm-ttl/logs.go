@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newLogsCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		cronjobNamespace string
+		container        string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "logs RELEASE",
+		Short: "Show the logs of the last uninstall Job of a TTL",
+		Long: `Show the logs of the last Job run for the TTL of a Helm release, by its
+CronJob or by helm ttl run: each container of its newest pod in the order
+they ran, such as expiry-guard, helm-uninstall and verify-uninstall. A
+container still running is followed until it terminates.
+
+The last failed Job is kept unless the TTL was set with
+--failed-history-limit 0; a successful run deletes the CronJob, and its
+Jobs with it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			releaseName := args[0]
+			releaseNs := gf.getNamespace()
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = releaseNs
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			return ttl.TTLLogs(cmd.Context(), client, cmd.OutOrStdout(), ttl.NewKubeLogFetcher(client), ttl.TTLLogsOptions{
+				ReleaseName:      releaseName,
+				ReleaseNamespace: releaseNs,
+				CronjobNamespace: cjNs,
+				Container:        container,
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJob lives (default: release namespace)")
+	cmd.Flags().StringVarP(&container, "container", "c", "", "show only this container, e.g. helm-uninstall")
+
+	return cmd
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLogsCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "staging")
+
+	labels := map[string]string{
+		ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+		ttl.LabelRelease:          "myapp",
+		ttl.LabelReleaseNamespace: "staging",
+	}
+	client := func() *fake.Clientset {
+		return fake.NewClientset(
+			&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl-1", Namespace: "ops", Labels: labels}},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl-1-abcde", Namespace: "ops", Labels: map[string]string{"job-name": "myapp-80081014-ttl-1"}},
+				Status: corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{{
+					Name:  "helm-uninstall",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}},
+				}}},
+			},
+		)
+	}
+
+	t.Run("logs", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"logs", "myapp", "--cronjob-namespace", "ops", "-c", "helm-uninstall"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Equal(t, "Job: myapp-80081014-ttl-1\n"+
+			"Pod: myapp-80081014-ttl-1-abcde\n"+
+			"==> Container: helm-uninstall <==\n"+
+			"fake logs", buf.String())
+	})
+
+	t.Run("no Job", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client()))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"logs", "myapp"})
+
+		assert.ErrorContains(t, cmd.Execute(), `no uninstall Job found for release "myapp"`)
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"logs", "myapp"})
+
+		assert.EqualError(t, cmd.Execute(), "failed to create kubernetes client: kube error")
+	})
+}
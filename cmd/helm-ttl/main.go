@@ -4,12 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/josegonzalez/helm-ttl/pkg/ttl"
 	"github.com/spf13/cobra"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -30,33 +36,95 @@ type globalFlags struct {
 	namespace  string
 	kubeCtx    string
 	kubeconfig string
+	asUser     string
+	asGroups   []string
+	apiServer  string
+	caFile     string
+	insecure   bool
+	burstLimit int
+	qps        float32
+	timeout    time.Duration
 	helmDriver string
+	backend    string
+	debug      bool
+	quiet      bool
+
+	// cancel releases the context --timeout bounds the command with.
+	cancel context.CancelFunc
 }
 
 func (gf *globalFlags) kubeOptions() ttl.KubeOptions {
 	return ttl.KubeOptions{
 		KubeContext: gf.kubeCtx,
 		Kubeconfig:  gf.kubeconfig,
+		AsUser:      gf.asUser,
+		AsGroups:    gf.asGroups,
 		Driver:      gf.helmDriver,
+		Backend:     gf.backend,
+
+		APIServer:             gf.apiServer,
+		CAFile:                gf.caFile,
+		InsecureSkipTLSVerify: gf.insecure,
+		BurstLimit:            gf.burstLimit,
+		QPS:                   gf.qps,
+		Timeout:               gf.timeout,
 	}
 }
 
+// applyTimeout bounds the context of the command being run by --timeout,
+// so its API calls fail once the timeout passes rather than hang.
+func (gf *globalFlags) applyTimeout(cmd *cobra.Command) {
+	if gf.timeout <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), gf.timeout)
+	gf.cancel = cancel
+	cmd.SetContext(ctx)
+}
+
+// configureLogging sends the debug logging of pkg/ttl to w when --debug is
+// set, and discards it otherwise.
+func (gf *globalFlags) configureLogging(w io.Writer) {
+	if !gf.debug {
+		ttl.SetLogger(nil)
+		return
+	}
+
+	ttl.SetLogger(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})))
+}
+
+// printOutput writes the output of a command, or with --quiet and text
+// output only its essential values, one per line. Structured output is
+// never shortened.
+func (gf *globalFlags) printOutput(cmd *cobra.Command, format, output string, essential ...string) {
+	if gf.quiet && format == "text" {
+		for _, v := range essential {
+			_, _ = fmt.Fprintln(cmd.OutOrStdout(), v)
+		}
+
+		return
+	}
+
+	_, _ = fmt.Fprint(cmd.OutOrStdout(), output)
+}
+
 func (gf *globalFlags) getNamespace() string {
 	if gf.namespace != "" {
 		return gf.namespace
 	}
 
-	ns := os.Getenv("HELM_NAMESPACE")
-	if ns == "" {
-		return "default"
-	}
-
-	return ns
+	return ttl.DefaultsFromEnv().Namespace
 }
 
 func main() {
-	if err := newRootCmd(defaultConfigFactory, defaultKubeClientFactory).Execute(); err != nil {
-		os.Exit(1)
+	// Cancelling the root context also releases the --timeout one, which
+	// PersistentPostRun leaves alone when the command fails
+	ctx, cancel := context.WithCancel(context.Background())
+	err := newRootCmd(defaultConfigFactory, defaultKubeClientFactory).ExecuteContext(ctx)
+	cancel()
+	if err != nil {
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -64,22 +132,80 @@ func newRootCmd(cfgFactory configFactory, kubeFactory kubeClientFactory) *cobra.
 	gf := &globalFlags{}
 
 	cmd := &cobra.Command{
-		Use:     "helm-ttl",
-		Short:   "Manage TTL (time-to-live) for Helm releases",
+		Use:   "helm-ttl",
+		Short: "Manage TTL (time-to-live) for Helm releases",
+		Long: `Manage TTL (time-to-live) for Helm releases.
+
+Optional settings are read from helm-ttl/config.yaml in the Helm config
+home, or the file named by HELM_TTL_CONFIG:
+
+  metrics:
+    statsdAddr: 127.0.0.1:8125
+
+With a statsd address, from the file or HELM_TTL_STATSD_ADDR, extend --all,
+unset --all, run, run-namespace and cleanup-rbac report their latency and
+outcome to that statsd daemon.
+
+Exit codes: 0 success, 1 other errors, 2 TTL not found, 3 release not
+found, 4 forbidden by RBAC, 5 conflicting update (--expected-generation),
+6 release or namespace protected.`,
 		Version: version,
+		PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+			gf.configureLogging(cmd.ErrOrStderr())
+			gf.applyTimeout(cmd)
+		},
+		PersistentPostRun: func(_ *cobra.Command, _ []string) {
+			if gf.cancel != nil {
+				gf.cancel()
+			}
+		},
 	}
 
 	cmd.PersistentFlags().StringVarP(&gf.namespace, "namespace", "n", "", "override the release namespace (default: HELM_NAMESPACE or \"default\")")
 	cmd.PersistentFlags().StringVar(&gf.kubeCtx, "kube-context", "", "override the Kubernetes context (default: HELM_KUBECONTEXT)")
 	cmd.PersistentFlags().StringVar(&gf.kubeconfig, "kubeconfig", "", "path to kubeconfig file (default: KUBECONFIG)")
+	cmd.PersistentFlags().StringVar(&gf.asUser, "as", "", "username to impersonate for the operation (default: HELM_KUBEASUSER)")
+	cmd.PersistentFlags().StringArrayVar(&gf.asGroups, "as-group", nil, "group to impersonate for the operation, can be repeated (default: HELM_KUBEASGROUPS)")
+	cmd.PersistentFlags().StringVar(&gf.apiServer, "kube-apiserver", "", "address and port of the Kubernetes API server, overriding the kubeconfig (default: HELM_KUBEAPISERVER)")
+	cmd.PersistentFlags().StringVar(&gf.caFile, "kube-ca-file", "", "certificate authority file to verify the Kubernetes API server with, e.g. that of a TLS-intercepting proxy (default: HELM_KUBECAFILE)")
+	cmd.PersistentFlags().BoolVar(&gf.insecure, "kube-insecure-skip-tls-verify", false, "do not verify the certificate of the Kubernetes API server; insecure (default: HELM_KUBEINSECURE_SKIP_TLS_VERIFY)")
+	cmd.PersistentFlags().IntVar(&gf.burstLimit, "burst-limit", 0, "client-side burst of Kubernetes API requests (default: HELM_BURST_LIMIT or 100)")
+	cmd.PersistentFlags().Float32Var(&gf.qps, "qps", 0, "client-side queries per second of Kubernetes API requests (default: HELM_QPS or the client-go default)")
+	// run and run-namespace shadow it with a --timeout of their own
+	cmd.PersistentFlags().DurationVar(&gf.timeout, "timeout", 0, "give up on the command after this long, e.g. 30s, when the Kubernetes API server does not answer (default: no limit)")
 	cmd.PersistentFlags().StringVar(&gf.helmDriver, "driver", "", "Helm storage driver (default: HELM_DRIVER or \"secrets\")")
+	cmd.PersistentFlags().StringVar(&gf.backend, "backend", "", "keep TTLs as cronjob CronJobs, job-sleep Jobs, controller ConfigMaps or releasettl ReleaseTTLs (default: HELM_TTL_BACKEND or \"cronjob\")")
+	cmd.PersistentFlags().BoolVarP(&gf.quiet, "quiet", "q", false, "print only essential values, such as the expiry of set, get and extend, and no confirmations")
+	cmd.PersistentFlags().BoolVarP(&gf.debug, "debug", "v", os.Getenv("HELM_DEBUG") == "true", "log Kubernetes API calls, built manifests and parsed durations to stderr (default: HELM_DEBUG)")
 
 	cmd.AddCommand(
 		newSetCmd(cfgFactory, kubeFactory, gf),
-		newGetCmd(kubeFactory, gf),
-		newUnsetCmd(kubeFactory, gf),
-		newRunCmd(kubeFactory, gf),
+		newGetCmd(cfgFactory, kubeFactory, gf),
+		newListCmd(kubeFactory, gf),
+		newUnsetCmd(cfgFactory, kubeFactory, gf),
+		newRunCmd(cfgFactory, kubeFactory, gf),
 		newCleanupRBACCmd(kubeFactory, gf),
+		newGCCmd(kubeFactory, gf),
+		newReportCmd(kubeFactory, gf),
+		newImagesCmd(),
+		newVersionCmd(gf),
+		newConvertCmd(kubeFactory, gf),
+		newCRDCmd(),
+		newExportCmd(kubeFactory, gf),
+		newImportCmd(kubeFactory, gf),
+		newAdoptCmd(kubeFactory, gf),
+		newMigrateCmd(kubeFactory, gf),
+		newDescribeCmd(kubeFactory, gf),
+		newHistoryCmd(kubeFactory, gf),
+		newLogsCmd(kubeFactory, gf),
+		newExtendCmd(cfgFactory, kubeFactory, gf),
+		newWebhookCmd(kubeFactory, gf),
+		newControllerCmd(cfgFactory, kubeFactory, gf),
+		newCheckCmd(kubeFactory, gf),
+		newSetNamespaceCmd(kubeFactory, gf),
+		newGetNamespaceCmd(kubeFactory, gf),
+		newUnsetNamespaceCmd(kubeFactory, gf),
+		newRunNamespaceCmd(kubeFactory, gf),
 	)
 
 	return cmd
@@ -93,10 +219,54 @@ func newSetCmd(cfgFactory configFactory, kubeFactory kubeClientFactory, gf *glob
 		kubectlImage         string
 		cronjobNamespace     string
 		deleteNamespace      bool
+		nsDeleteDelay        time.Duration
+		fromReleaseAnno      bool
+		valuesKey            string
+		expectedGeneration   int64
+		ifNotExists          bool
+		extendOnly           bool
+		shrinkOnly           bool
+		uninstall            ttl.UninstallOptions
+		podSpecFile          string
+		dateOrder            string
+		allowShort           bool
+		scaleDownAfter       string
+		deleteAfter          string
+		imagePullSecrets     []string
+		registryPrefix       string
+		cleanupImage         string
+		security             ttl.SecurityOptions
+		runAsUser            int64
+		runAsGroup           int64
+		nodeSelector         map[string]string
+		priorityClassName    string
+		requests             map[string]string
+		limits               map[string]string
+		force                bool
+		outputFormat         string
+		exportDir            string
+		argoCD               ttl.ArgoCDOptions
+		postDelete           ttl.PostDeleteOptions
+		extraNamespaces      []string
+		saAnnotations        []string
+		cronjobLabels        []string
+		cronjobAnnotations   []string
+		sidecarInjection     bool
+		skipPreflight        bool
+		backoffLimit         int32
+		activeDeadline       int64
+		startingDeadline     int64
+		failedHistoryLimit   int32
+		onFailureWebhook     string
+		webhookProxy         string
+		webhookCAFile        string
+		twoPhase             bool
+		twoPhaseGrace        time.Duration
+		abortWindow          time.Duration
 	)
 
 	cmd := &cobra.Command{
-		Use:   "set RELEASE DURATION",
+		Use:   "set RELEASE [DURATION]",
 		Short: "Set TTL for a Helm release",
 		Long: `Set a time-to-live for a Helm release. When the TTL expires, the release
 will be automatically uninstalled via a Kubernetes CronJob.
@@ -105,11 +275,183 @@ Duration supports:
   - Go durations: 30m, 2h, 24h, 168h
   - Days shorthand: 7d, 30d
   - Human-readable: 6 hours, 3 days, 2 weeks, 30 mins
-  - Natural language: tomorrow, "next monday", "in 2 hours"`,
-		Args: cobra.ExactArgs(2),
+  - Calendar dates: 2025-04-03, "April 3 5pm", "3rd of April 17:00", "04/03 5pm"
+  - Business-calendar phrases: eod, eow, "friday 6pm", "monday morning"
+  - Natural language: tomorrow, "next monday", "in 2 hours"
+
+Numeric dates such as 04/03 are refused when the month and day could be
+swapped, unless --date-order (or HELM_TTL_DATE_ORDER) is mdy or dmy.
+
+With --from-release-annotation, DURATION is omitted and read from the
+helm-ttl.io/duration key declared as a release label (helm install
+--labels), in the release's Chart.yaml annotations, or on any object in
+its rendered manifest.
+
+With --values-annotation KEY, DURATION is omitted and read from the
+release's values at the dotted KEY (ttl for .Values.ttl), falling back to
+the chart's default values. Combined with --from-release-annotation, the
+annotation is used when the values do not set KEY.
+
+Without DURATION, the defaultDuration of the release namespace's
+helm-ttl-config ConfigMap is used. A maxDuration in that ConfigMap caps
+every TTL set in the namespace. Reading it needs get on configmaps in the
+release namespace; without that permission no policy is applied and a
+warning is printed.
+
+An existing TTL is replaced, restarting its countdown. With --if-not-exists
+set leaves it unchanged and succeeds, printing when it expires, so CI
+pipelines can re-run set safely. --extend-only fails rather than make the
+expiry earlier, e.g. when a stale job with a short default duration would
+undo a manual extension, and --shrink-only fails rather than make it later.
+
+Releases and namespaces marked helm-ttl/protected=true (as a release label,
+chart annotation, or namespace label or annotation) are refused unless
+--force is passed.
+
+With --export-manifests DIR, the CronJob and, with --create-service-account,
+its ServiceAccount, Roles and Bindings are written to DIR as YAML instead of
+being applied, for a GitOps tool such as Argo CD or Flux to apply. Use
+--export-manifests - to print them to stdout as one YAML stream.
+
+With --argocd-tracking APP, the CronJob and RBAC are tracked as resources of
+the Argo CD Application APP, using the tracking method and instance label
+key from the argocd-cm ConfigMap (Argo CD's defaults when it cannot be
+read), and are annotated with Prune=false and IgnoreExtraneous so syncing
+the Application neither prunes them nor reports it OutOfSync.
+
+--delete-pvcs deletes the release's PersistentVolumeClaims after the
+uninstall, which helm leaves behind, selected by
+app.kubernetes.io/instance=RELEASE unless --pvc-selector is given. Each
+--post-delete command then runs in order with sh in the kubectl image, with
+RELEASE_NAME and RELEASE_NAMESPACE set. With --create-service-account, the
+RBAC allows the PVC deletion and the "kubectl delete TYPE" calls of the
+commands in the release namespace.
+
+A failed uninstall Job is retried --backoff-limit times (default 3). Each
+attempt checks with helm list that the release still exists first, so a
+retry succeeds after an earlier attempt uninstalled it; this runs through
+sh, so a custom --helm-image needs a shell unless --backoff-limit is 0.
+--active-deadline-seconds bounds the Job,
+retries included, and --starting-deadline-seconds is how late it may still
+start when the CronJob controller missed the schedule. The last failed Job
+is kept (--failed-history-limit, default 1) for get --show-last-run.
+
+--two-phase gives one last audit point before the irreversible uninstall:
+the Job first runs helm uninstall --dry-run, publishes the manifest it
+would delete to the ConfigMap CRONJOB-manifest in the CronJob namespace
+and an UninstallPending Event on the CronJob, then waits --two-phase-grace
+(default 10m) before uninstalling. Run unset during the wait to keep the
+release. The ConfigMap is kept as a record of what was deleted.
+
+--scale-down-after DURATION stages the TTL for cheap preview environments:
+a second CronJob, CRONJOB-scale-down, first scales the Deployments and
+StatefulSets of the release manifest to zero replicas, and the TTL
+uninstalls the release at DURATION, which --delete-after can give in
+place of the argument:
+
+  helm ttl set RELEASE --scale-down-after 24h --delete-after 72h
+
+The scale-down CronJob is owned by the TTL CronJob and removed with it.
+A HorizontalPodAutoscaler, or a GitOps tool syncing the replicas, may
+scale the release back up. Needs the cronjob backend.
+
+--abort-window DURATION makes the Job wait before uninstalling, giving
+on-call a last chance to cancel the expiry without racing the deletion:
+
+  kubectl annotate cronjob CRONJOB helm-ttl/abort=true
+
+during the window fails the Job without uninstalling or retrying. The next
+set or extend of the TTL removes the annotation.
+
+--on-failure-webhook URL makes each failing step of the uninstall Job POST
+a JSON report with the release, the step and the tail of its logs to URL,
+so a TTL that never cleaned up does not go unnoticed until someone runs get
+--show-last-run. Every failed attempt of a retried Job is reported. The
+pod does not inherit the proxy or CA of your shell: pass
+--on-failure-webhook-proxy URL and --on-failure-webhook-ca-file FILE when
+the webhook is only reachable through a proxy or uses a private CA.
+
+With an existing --service-account, set checks with SubjectAccessReviews
+that it may do everything the uninstall does, such as deleting the release
+Secrets and the CronJob, and fails listing what is missing. Pass
+--skip-preflight to set the TTL anyway, e.g. when the permissions are
+granted later. The check is skipped when you may not create
+SubjectAccessReviews.
+
+--service-account-annotation key=value annotates the ServiceAccount created
+with --create-service-account, e.g. eks.amazonaws.com/role-arn for IRSA or
+iam.gke.io/gcp-service-account for GKE Workload Identity.
+
+--cronjob-label key=value and --cronjob-annotation key=value are added to
+the CronJob, its Job template and pod template, e.g. a cost-center label,
+karpenter.sh/do-not-disrupt=true.
+
+The uninstall pod is annotated sidecar.istio.io/inject=false and
+linkerd.io/inject=disabled, since a service mesh proxy that keeps running
+keeps the Job from ever completing. Pass --allow-sidecar-injection to leave
+them out, e.g. when the mesh handles Jobs itself.
+
+For charts that create resources outside the release namespace, each
+--extra-namespace NS gets a Role and RoleBinding, created with
+--create-service-account, letting the uninstall delete the kinds the
+release manifest puts in NS. They are labeled for the TTL and removed with
+it by unset and cleanup-rbac.`,
+		Args: cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			releaseName := args[0]
-			duration := args[1]
+
+			var duration string
+			if len(args) == 2 {
+				duration = args[1]
+			}
+
+			if deleteAfter != "" {
+				if duration != "" {
+					return fmt.Errorf("cannot specify DURATION together with --delete-after")
+				}
+
+				duration = deleteAfter
+			}
+
+			if duration != "" && fromReleaseAnno {
+				return fmt.Errorf("cannot specify DURATION together with --from-release-annotation")
+			}
+
+			if duration != "" && valuesKey != "" {
+				return fmt.Errorf("cannot specify DURATION together with --values-annotation")
+			}
+
+			if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+				return err
+			}
+
+			if cmd.Flags().Changed("two-phase-grace") && !twoPhase {
+				return fmt.Errorf("--two-phase-grace requires --two-phase")
+			}
+
+			if twoPhase && twoPhaseGrace <= 0 {
+				return fmt.Errorf("invalid --two-phase-grace %s: must be positive", twoPhaseGrace)
+			}
+
+			if !twoPhase {
+				twoPhaseGrace = 0
+			}
+
+			if exportDir != "" && outputFormat != "text" {
+				return fmt.Errorf("cannot use --output with --export-manifests")
+			}
+
+			if ifNotExists && cmd.Flags().Changed("expected-generation") {
+				return fmt.Errorf("cannot use --if-not-exists with --expected-generation")
+			}
+
+			if extendOnly && shrinkOnly {
+				return fmt.Errorf("cannot use --extend-only with --shrink-only")
+			}
+
+			if ifNotExists && exportDir != "" {
+				return fmt.Errorf("cannot use --if-not-exists with --export-manifests")
+			}
 
 			releaseNs := gf.getNamespace()
 			cjNs := cronjobNamespace
@@ -127,58 +469,327 @@ Duration supports:
 				return fmt.Errorf("failed to create kubernetes client: %w", err)
 			}
 
-			ctx := context.Background()
-			if err := ttl.SetTTL(ctx, cfg, client, ttl.SetTTLOptions{
-				ReleaseName:          releaseName,
-				ReleaseNamespace:     releaseNs,
-				CronjobNamespace:     cjNs,
-				Duration:             duration,
-				ServiceAccount:       serviceAccount,
-				CreateServiceAccount: createServiceAccount,
-				HelmImage:            helmImage,
-				KubectlImage:         kubectlImage,
-				DeleteNamespace:      deleteNamespace,
-			}); err != nil {
-				var notFound *ttl.ReleaseNotFoundError
-				if errors.As(err, &notFound) {
-					return fmt.Errorf("release %q not found in namespace %q", releaseName, releaseNs)
+			pod, err := podOptionsFromFlags(podSpecFile, nodeSelector, priorityClassName, requests, limits)
+			if err != nil {
+				return err
+			}
+
+			saAnnotationMap, err := ttl.ParseServiceAccountAnnotations(saAnnotations)
+			if err != nil {
+				return err
+			}
+
+			cronjobLabelMap, err := ttl.ParseCronJobLabels(cronjobLabels)
+			if err != nil {
+				return err
+			}
+
+			cronjobAnnotationMap, err := ttl.ParseCronJobAnnotations(cronjobAnnotations)
+			if err != nil {
+				return err
+			}
+
+			if cmd.Flags().Changed("run-as-user") {
+				security.RunAsUser = &runAsUser
+			}
+			if cmd.Flags().Changed("run-as-group") {
+				security.RunAsGroup = &runAsGroup
+			}
+
+			var job ttl.JobOptions
+			if cmd.Flags().Changed("backoff-limit") {
+				job.BackoffLimit = &backoffLimit
+			}
+			if cmd.Flags().Changed("active-deadline-seconds") {
+				job.ActiveDeadlineSeconds = &activeDeadline
+			}
+			if cmd.Flags().Changed("starting-deadline-seconds") {
+				job.StartingDeadlineSeconds = &startingDeadline
+			}
+			if cmd.Flags().Changed("failed-history-limit") {
+				job.FailedHistoryLimit = &failedHistoryLimit
+			}
+
+			var expectedGen *int64
+			if cmd.Flags().Changed("expected-generation") {
+				expectedGen = &expectedGeneration
+			}
+
+			var webhookCA []byte
+			if webhookCAFile != "" {
+				webhookCA, err = os.ReadFile(webhookCAFile)
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", webhookCAFile, err)
+				}
+			}
+
+			ctx := cmd.Context()
+			opts := ttl.SetTTLOptions{
+				ReleaseName:           releaseName,
+				ReleaseNamespace:      releaseNs,
+				CronjobNamespace:      cjNs,
+				Duration:              duration,
+				ServiceAccount:        serviceAccount,
+				CreateServiceAccount:  createServiceAccount,
+				HelmImage:             helmImage,
+				KubectlImage:          kubectlImage,
+				DeleteNamespace:       deleteNamespace,
+				NamespaceDeleteDelay:  nsDeleteDelay,
+				FromReleaseAnnotation: fromReleaseAnno,
+				ValuesKey:             valuesKey,
+				ExpectedGeneration:    expectedGen,
+				IfNotExists:           ifNotExists,
+				ExtendOnly:            extendOnly,
+				ShrinkOnly:            shrinkOnly,
+				Uninstall:             uninstall,
+				Pod:                   pod,
+				DateOrder:             dateOrder,
+				AllowShort:            allowShort,
+				ScaleDownAfter:        scaleDownAfter,
+				ImagePullSecrets:      imagePullSecrets,
+				RegistryPrefix:        registryPrefix,
+				CleanupImage:          cleanupImage,
+				Security:              security,
+				Force:                 force,
+				Driver:                gf.helmDriver,
+				ArgoCD:                argoCD,
+				PostDelete:            postDelete,
+				ExtraNamespaces:       extraNamespaces,
+
+				ServiceAccountAnnotations: saAnnotationMap,
+				CronJobLabels:             cronjobLabelMap,
+				CronJobAnnotations:        cronjobAnnotationMap,
+				SidecarInjection:          sidecarInjection,
+				SkipPreflight:             skipPreflight,
+				Job:                       job,
+				OnFailureWebhook:          onFailureWebhook,
+				OnFailureWebhookProxy:     webhookProxy,
+				OnFailureWebhookCA:        webhookCA,
+				TwoPhaseGrace:             twoPhaseGrace,
+				AbortWindow:               abortWindow,
+			}
+
+			if exportDir != "" {
+				objs, err := ttl.ExportTTL(ctx, cfg, client, opts)
+				if err != nil {
+					return setError(err, releaseName, releaseNs)
 				}
 
+				return exportManifests(cmd, exportDir, objs)
+			}
+
+			result, err := ttl.SetTTL(ctx, cfg, client, opts)
+			if err != nil {
 				var saNotFound *ttl.ServiceAccountNotFoundError
 				if errors.As(err, &saNotFound) {
 					return fmt.Errorf("service account %q not found in namespace %q; use --create-service-account to create it", serviceAccount, cjNs)
 				}
 
+				var preflight *ttl.PreflightError
+				if errors.As(err, &preflight) {
+					return fmt.Errorf("%w\nuse --create-service-account to create a service account with these permissions, or --skip-preflight to set the TTL anyway", err)
+				}
+
+				return setError(err, releaseName, releaseNs)
+			}
+
+			output, err := ttl.FormatSetResult(result, outputFormat)
+			if err != nil {
 				return err
 			}
 
-			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "TTL set for release %q in namespace %q\n", releaseName, releaseNs)
+			if gf.quiet {
+				printWarnings(cmd, result.Warnings)
+			}
+			gf.printOutput(cmd, outputFormat, output, result.ExpiresAt)
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVar(&serviceAccount, "service-account", "default", "service account for CronJob")
 	cmd.Flags().BoolVar(&createServiceAccount, "create-service-account", false, "create the service account and RBAC resources")
+	cmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "do not check that an existing --service-account may uninstall the release")
+	cmd.Flags().StringArrayVar(&saAnnotations, "service-account-annotation", nil, "annotation key=value for the created service account, e.g. eks.amazonaws.com/role-arn=ARN (repeatable)")
+	cmd.Flags().StringArrayVar(&cronjobLabels, "cronjob-label", nil, "label key=value for the CronJob, its Job and pod (repeatable)")
+	cmd.Flags().StringArrayVar(&cronjobAnnotations, "cronjob-annotation", nil, "annotation key=value for the CronJob, its Job and pod, e.g. karpenter.sh/do-not-disrupt=true (repeatable)")
+	cmd.Flags().BoolVar(&sidecarInjection, "allow-sidecar-injection", false, "do not annotate the uninstall pod against Istio and Linkerd sidecar injection")
 	cmd.Flags().StringVar(&helmImage, "helm-image", "", "Helm container image (default: "+ttl.DefaultHelmImage+")")
 	cmd.Flags().StringVar(&kubectlImage, "kubectl-image", "", "kubectl container image (default: "+ttl.DefaultKubectlImage+")")
 	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace for the CronJob (default: release namespace)")
 	cmd.Flags().BoolVar(&deleteNamespace, "delete-namespace", false, "also delete the release namespace after uninstalling")
+	cmd.Flags().DurationVar(&nsDeleteDelay, "namespace-delete-delay", 0, "with --delete-namespace, wait this long after the uninstall before deleting the namespace")
+	cmd.Flags().BoolVar(&fromReleaseAnno, "from-release-annotation", false, "read the duration from the release's "+ttl.AnnotationDuration+" annotation")
+	cmd.Flags().StringVar(&valuesKey, "values-annotation", "", "read the duration from this dotted key of the release's values, e.g. ttl for .Values.ttl")
+	cmd.Flags().Int64Var(&expectedGeneration, "expected-generation", 0, "fail unless the existing TTL is at this generation (0: no TTL exists yet)")
+	cmd.Flags().BoolVar(&ifNotExists, "if-not-exists", false, "leave an existing TTL unchanged instead of replacing it, and succeed")
+	cmd.Flags().BoolVar(&extendOnly, "extend-only", false, "fail rather than make the expiry of an existing TTL earlier")
+	cmd.Flags().BoolVar(&shrinkOnly, "shrink-only", false, "fail rather than make the expiry of an existing TTL later")
+	cmd.Flags().BoolVar(&uninstall.Wait, "uninstall-wait", false, "pass --wait to helm uninstall")
+	cmd.Flags().DurationVar(&uninstall.Timeout, "uninstall-timeout", 0, "pass --timeout to helm uninstall (default: helm's default)")
+	cmd.Flags().BoolVar(&uninstall.KeepHistory, "keep-history", false, "pass --keep-history to helm uninstall")
+	cmd.Flags().StringVar(&uninstall.Cascade, "cascade", "", "pass --cascade to helm uninstall: background, orphan, foreground")
+	cmd.Flags().BoolVar(&uninstall.NoHooks, "no-hooks", false, "pass --no-hooks to helm uninstall")
+	cmd.Flags().Int32Var(&backoffLimit, "backoff-limit", ttl.DefaultBackoffLimit, "how many times to retry a failed uninstall Job")
+	cmd.Flags().Int64Var(&activeDeadline, "active-deadline-seconds", 0, "how long the uninstall Job may run, retries included (default: 3600 plus --uninstall-timeout, --namespace-delete-delay, --two-phase-grace and --abort-window)")
+	cmd.Flags().Int64Var(&startingDeadline, "starting-deadline-seconds", ttl.DefaultStartingDeadlineSeconds, "how late the uninstall Job may still start if the schedule was missed")
+	cmd.Flags().Int32Var(&failedHistoryLimit, "failed-history-limit", ttl.DefaultFailedJobsHistoryLimit, "how many failed uninstall Jobs the CronJob keeps for debugging")
+	cmd.Flags().BoolVar(&twoPhase, "two-phase", false, "publish the manifest helm uninstall --dry-run reports to a ConfigMap and Event, then wait --two-phase-grace before uninstalling")
+	cmd.Flags().DurationVar(&twoPhaseGrace, "two-phase-grace", ttl.DefaultTwoPhaseGrace, "with --two-phase, how long to wait between publishing the manifest and uninstalling")
+	cmd.Flags().StringVar(&scaleDownAfter, "scale-down-after", "", "scale the release's Deployments and StatefulSets to zero replicas after this DURATION, before the uninstall")
+	cmd.Flags().StringVar(&deleteAfter, "delete-after", "", "uninstall the release after this DURATION, in place of the DURATION argument")
+	cmd.Flags().DurationVar(&abortWindow, "abort-window", 0, "wait this long before uninstalling, stopping if the CronJob is annotated "+ttl.AnnotationAbort+"=true")
+	cmd.Flags().StringVar(&onFailureWebhook, "on-failure-webhook", "", "POST a JSON report with the logs of a failing uninstall step to this URL")
+	cmd.Flags().StringVar(&webhookProxy, "on-failure-webhook-proxy", "", "send the --on-failure-webhook reports through this proxy URL")
+	cmd.Flags().StringVar(&webhookCAFile, "on-failure-webhook-ca-file", "", "PEM file with CA certificates the --on-failure-webhook reports trust besides the system roots")
+	cmd.Flags().StringVar(&dateOrder, "date-order", "", "how to read numeric dates like 03/04: strict (refuse ambiguous dates), mdy or dmy (default from HELM_TTL_DATE_ORDER, else strict)")
+	cmd.Flags().BoolVar(&allowShort, "allow-short", false, "allow a TTL shorter than the minimum (default 5m, or HELM_TTL_MIN_DURATION)")
+	cmd.Flags().StringVar(&cleanupImage, "cleanup-image", "", "helm-ttl-cleanup image to use instead of kubectl for namespace deletion and self-cleanup")
+	cmd.Flags().StringVar(&registryPrefix, "registry-prefix", "", "pull the default images from this registry mirror (default: HELM_TTL_REGISTRY_PREFIX)")
+	cmd.Flags().StringArrayVar(&imagePullSecrets, "image-pull-secret", nil, "image pull secret for the uninstall images (repeatable; default from HELM_TTL_IMAGE_PULL_SECRETS)")
+	cmd.Flags().BoolVar(&security.Disabled, "no-security-context", false, "omit the restricted security context from the uninstall pod (for images that must run as root)")
+	cmd.Flags().Int64Var(&runAsUser, "run-as-user", ttl.DefaultRunAsUser, "UID the uninstall containers run as")
+	cmd.Flags().Int64Var(&runAsGroup, "run-as-group", ttl.DefaultRunAsUser, "GID the uninstall containers run as")
+	cmd.Flags().StringVar(&podSpecFile, "pod-spec-file", "", "YAML file with resources, nodeSelector, tolerations, affinity and priorityClassName for the uninstall pod")
+	cmd.Flags().StringToStringVar(&nodeSelector, "node-selector", nil, "node selector for the uninstall pod (e.g. kubernetes.io/os=linux)")
+	cmd.Flags().StringVar(&priorityClassName, "priority-class-name", "", "priority class for the uninstall pod")
+	cmd.Flags().StringToStringVar(&requests, "requests", nil, "resource requests for the uninstall containers (e.g. cpu=100m,memory=64Mi)")
+	cmd.Flags().StringToStringVar(&limits, "limits", nil, "resource limits for the uninstall containers (e.g. cpu=200m,memory=128Mi)")
+	cmd.Flags().BoolVar(&force, "force", false, "set the TTL even if the release or namespace is marked "+ttl.LabelProtected)
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+	cmd.Flags().StringVar(&exportDir, "export-manifests", "", "write the CronJob and RBAC as YAML to this directory (- for stdout) instead of applying them")
+	cmd.Flags().StringVar(&argoCD.Application, "argocd-tracking", "", "track the CronJob and RBAC as resources of this Argo CD Application so its syncs keep them")
+	cmd.Flags().BoolVar(&postDelete.DeletePVCs, "delete-pvcs", false, "delete the release's PersistentVolumeClaims after the uninstall")
+	cmd.Flags().StringVar(&postDelete.PVCSelector, "pvc-selector", "", "label selector of the PVCs --delete-pvcs deletes (default: app.kubernetes.io/instance=RELEASE)")
+	cmd.Flags().StringArrayVar(&postDelete.Commands, "post-delete", nil, "shell command run after the uninstall to remove leftovers, e.g. \"kubectl delete secret -n $RELEASE_NAMESPACE -l app=x\" (repeatable)")
+	cmd.Flags().StringArrayVar(&extraNamespaces, "extra-namespace", nil, "namespace the release also creates resources in, granted to the uninstall with --create-service-account (repeatable)")
+	cmd.Flags().StringVar(&argoCD.Namespace, "argocd-namespace", ttl.DefaultArgoCDNamespace, "namespace of Argo CD's argocd-cm ConfigMap, for --argocd-tracking")
 
 	return cmd
 }
 
-func newGetCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+// setError rewords the errors of SetTTL and ExportTTL for the CLI.
+func setError(err error, releaseName, releaseNamespace string) error {
+	var notFound *ttl.ReleaseNotFoundError
+	if errors.As(err, &notFound) {
+		return reword(err, "release %q not found in namespace %q", releaseName, releaseNamespace)
+	}
+
+	return err
+}
+
+// exportManifests writes the resources of an exported TTL to dir, or to
+// stdout when dir is "-".
+func exportManifests(cmd *cobra.Command, dir string, objs []runtime.Object) error {
+	if dir == "-" {
+		out, err := ttl.FormatManifests(objs)
+		if err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprint(cmd.OutOrStdout(), out)
+		return nil
+	}
+
+	paths, err := ttl.WriteManifests(dir, objs)
+	for _, path := range paths {
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Wrote %s\n", path)
+	}
+
+	return err
+}
+
+// podOptionsFromFlags loads the --pod-spec-file overlay and applies the
+// individual pod flags on top of it.
+func podOptionsFromFlags(podSpecFile string, nodeSelector map[string]string, priorityClassName string, requests, limits map[string]string) (ttl.PodOptions, error) {
+	var pod ttl.PodOptions
+	if podSpecFile != "" {
+		var err error
+		pod, err = ttl.LoadPodOptions(podSpecFile)
+		if err != nil {
+			return pod, err
+		}
+	}
+
+	if len(nodeSelector) > 0 {
+		if pod.NodeSelector == nil {
+			pod.NodeSelector = make(map[string]string, len(nodeSelector))
+		}
+		for k, v := range nodeSelector {
+			pod.NodeSelector[k] = v
+		}
+	}
+
+	if priorityClassName != "" {
+		pod.PriorityClassName = priorityClassName
+	}
+
+	requestList, err := ttl.ParseResourceList(requests)
+	if err != nil {
+		return pod, fmt.Errorf("invalid --requests: %w", err)
+	}
+	for name, q := range requestList {
+		if pod.Resources.Requests == nil {
+			pod.Resources.Requests = make(corev1.ResourceList)
+		}
+		pod.Resources.Requests[name] = q
+	}
+
+	limitList, err := ttl.ParseResourceList(limits)
+	if err != nil {
+		return pod, fmt.Errorf("invalid --limits: %w", err)
+	}
+	for name, q := range limitList {
+		if pod.Resources.Limits == nil {
+			pod.Resources.Limits = make(corev1.ResourceList)
+		}
+		pod.Resources.Limits[name] = q
+	}
+
+	return pod, nil
+}
+
+func newGetCmd(cfgFactory configFactory, kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
 	var (
 		outputFormat     string
 		cronjobNamespace string
+		showStatus       bool
+		showLastRun      bool
+		columnSpec       string
+		noHeaders        bool
+		orphansOK        bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "get RELEASE",
 		Short: "Get current TTL for a Helm release",
-		Args:  cobra.ExactArgs(1),
+		Long: `Get the TTL for a Helm release. --all adds the live CronJob status.
+
+--show-last-run adds the most recent failed uninstall Job, kept by the
+CronJob's --failed-history-limit: when it failed and why, and the last
+lines of the logs of the containers that failed.
+
+--columns prints the TTL as a one-row table of the columns helm ttl list
+--columns accepts, e.g. --columns expires,remaining for scripts.
+
+The release is looked up too, and a TTL whose release was uninstalled
+without removing it is reported with a warning; --orphans-ok skips the
+lookup.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			releaseName := args[0]
+
+			var columns []string
+			if columnSpec != "" {
+				if outputFormat != "text" {
+					return fmt.Errorf("cannot use --columns with --output")
+				}
+
+				var err error
+				columns, err = ttl.ParseTTLColumns(columnSpec)
+				if err != nil {
+					return err
+				}
+			}
 			releaseNs := gf.getNamespace()
 			cjNs := cronjobNamespace
 			if cjNs == "" {
@@ -190,87 +801,294 @@ func newGetCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
 				return fmt.Errorf("failed to create kubernetes client: %w", err)
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
 			info, err := ttl.GetTTL(ctx, client, releaseName, releaseNs, cjNs)
 			if err != nil {
 				var notFound *ttl.TTLNotFoundError
 				if errors.As(err, &notFound) {
-					return fmt.Errorf("no TTL set for release %q in namespace %q", releaseName, releaseNs)
+					return reword(err, "no TTL set for release %q in namespace %q", releaseName, releaseNs)
 				}
 
 				return err
 			}
 
+			if !showStatus {
+				info.Status = nil
+			}
+
+			// Best effort: without access to the release storage the
+			// release is not checked
+			if !orphansOK {
+				if cfg, err := cfgFactory(releaseNs, gf.kubeOptions()); err == nil && ttl.CheckReleaseExists(cfg, info) == nil {
+					printWarnings(cmd, info.Warnings)
+				}
+			}
+
+			if showLastRun {
+				info.LastRun, err = ttl.LastFailedRun(ctx, client, ttl.NewKubeLogFetcher(client), releaseName, releaseNs, cjNs)
+				if err != nil {
+					return err
+				}
+			}
+
+			if columns != nil {
+				_, _ = fmt.Fprint(cmd.OutOrStdout(), ttl.FormatTTLTable([]ttl.TTLInfo{*info}, columns, noHeaders))
+				return nil
+			}
+
 			output, err := ttl.FormatOutput(*info, outputFormat)
 			if err != nil {
 				return err
 			}
 
-			_, _ = fmt.Fprint(cmd.OutOrStdout(), output)
+			gf.printOutput(cmd, outputFormat, output, info.ScheduledDate)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
 	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJob lives (default: release namespace)")
+	cmd.Flags().BoolVar(&showStatus, "all", false, "include the live CronJob status (suspended, last schedule, active jobs)")
+	cmd.Flags().BoolVar(&showLastRun, "show-last-run", false, "include the last failed uninstall Job and the logs of its failed containers")
+	cmd.Flags().StringVar(&columnSpec, "columns", "", "print a table of these comma-separated columns instead: "+strings.Join(ttl.TTLColumns, ", "))
+	cmd.Flags().BoolVar(&noHeaders, "no-headers", false, "with --columns, leave out the header row of the table")
+	cmd.Flags().BoolVar(&orphansOK, "orphans-ok", false, "do not check that the release is still installed")
 
 	return cmd
 }
 
-func newUnsetCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
-	var cronjobNamespace string
+func newUnsetCmd(cfgFactory configFactory, kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		cronjobNamespace string
+		selector         string
+		all              bool
+		yes              bool
+		outputFormat     string
+		orphansOK        bool
+	)
 
 	cmd := &cobra.Command{
-		Use:   "unset RELEASE",
-		Short: "Remove TTL from a Helm release",
-		Args:  cobra.ExactArgs(1),
+		Use:   "unset (RELEASE | --all [-l SELECTOR])",
+		Short: "Remove TTL from one or more Helm releases",
+		Long: `Remove the TTL from a Helm release by deleting its CronJob and the
+ServiceAccount and RBAC created for it. The release itself is left alone.
+
+With --all, the TTL of every release in the namespace is removed, e.g.
+when promoting a preview environment to a long-lived one; narrow it down
+with -l, a label selector matched against the release labels (helm
+install --labels). A summary table is printed, and the command fails if
+any TTL could not be removed.
+
+The TTL of a release that is no longer installed, e.g. uninstalled by hand,
+points at nothing: unset refuses to remove it, so a typo in RELEASE is not
+mistaken for a removed TTL, unless --orphans-ok is given. --all removes
+such TTLs as well.
+
+When run from a terminal, asks for confirmation first; pass --yes to skip it.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all {
+				if len(args) != 0 {
+					return fmt.Errorf("--all takes no RELEASE, got %d arguments", len(args))
+				}
+
+				return nil
+			}
+
+			if selector != "" {
+				return fmt.Errorf("--selector requires --all")
+			}
+
+			if cmd.Flags().Changed("output") {
+				return fmt.Errorf("--output requires --all")
+			}
+
+			if len(args) != 1 {
+				return fmt.Errorf("requires RELEASE, or --all")
+			}
+
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			releaseName := args[0]
 			releaseNs := gf.getNamespace()
 			cjNs := cronjobNamespace
 			if cjNs == "" {
 				cjNs = releaseNs
 			}
 
+			if all {
+				return unsetAll(cmd, cfgFactory, kubeFactory, gf, ttl.UnsetTTLsOptions{
+					ReleaseNamespace: releaseNs,
+					CronjobNamespace: cjNs,
+					Selector:         selector,
+				}, yes, outputFormat)
+			}
+
+			releaseName := args[0]
 			client, err := kubeFactory(gf.kubeOptions())
 			if err != nil {
 				return fmt.Errorf("failed to create kubernetes client: %w", err)
 			}
 
-			ctx := context.Background()
+			ctx := cmd.Context()
+			if !orphansOK {
+				if err := checkOrphaned(ctx, cfgFactory, client, gf, releaseName, releaseNs, cjNs); err != nil {
+					return err
+				}
+			}
+
+			if !yes && !confirm(cmd, fmt.Sprintf("Remove the TTL of release %q in namespace %q?", releaseName, releaseNs)) {
+				return fmt.Errorf("aborted: the TTL of release %q was not removed", releaseName)
+			}
+
 			if err := ttl.UnsetTTL(ctx, client, releaseName, releaseNs, cjNs); err != nil {
 				var notFound *ttl.TTLNotFoundError
 				if errors.As(err, &notFound) {
-					return fmt.Errorf("no TTL set for release %q in namespace %q", releaseName, releaseNs)
+					return reword(err, "no TTL set for release %q in namespace %q", releaseName, releaseNs)
 				}
 
 				return err
 			}
 
-			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "TTL removed for release %q in namespace %q\n", releaseName, releaseNs)
+			gf.printOutput(cmd, "text", fmt.Sprintf("TTL removed for release %q in namespace %q\n", releaseName, releaseNs))
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJob lives (default: release namespace)")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "with --all, only unset releases whose labels match this selector (e.g. team=checkout)")
+	cmd.Flags().BoolVar(&all, "all", false, "remove every TTL in the namespace")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "remove the TTL without asking for confirmation")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format, requires --all: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+	cmd.Flags().BoolVar(&orphansOK, "orphans-ok", false, "remove the TTL even if the release is no longer installed")
 
 	return cmd
 }
 
-func newRunCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+// checkOrphaned refuses to unset the TTL of a release that is no longer
+// installed. A missing TTL is left for unset to report, and the check is
+// skipped when the release storage cannot be read.
+func checkOrphaned(ctx context.Context, cfgFactory configFactory, client kubernetes.Interface, gf *globalFlags, releaseName, releaseNs, cjNs string) error {
+	if _, err := ttl.GetTTL(ctx, client, releaseName, releaseNs, cjNs); err != nil {
+		return nil //nolint:nilerr // unset reports the missing TTL
+	}
+
+	cfg, err := cfgFactory(releaseNs, gf.kubeOptions())
+	if err != nil {
+		return nil //nolint:nilerr // the check is best effort
+	}
+
+	if exists, err := ttl.ReleaseExists(cfg, releaseName); err == nil && !exists {
+		return fmt.Errorf("release %q not found in namespace %q: its TTL points at nothing; pass --orphans-ok to remove it anyway", releaseName, releaseNs)
+	}
+
+	return nil
+}
+
+// unsetAll removes every TTL matched by opts and prints a summary,
+// failing if any of them could not be removed.
+func unsetAll(cmd *cobra.Command, cfgFactory configFactory, kubeFactory kubeClientFactory, gf *globalFlags, opts ttl.UnsetTTLsOptions, yes bool, outputFormat string) error {
+	if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+		return err
+	}
+
+	prompt := fmt.Sprintf("Remove every TTL in namespace %q?", opts.ReleaseNamespace)
+	if opts.Selector != "" {
+		prompt = fmt.Sprintf("Remove the TTL of every release matching %q in namespace %q?", opts.Selector, opts.ReleaseNamespace)
+	}
+	if !yes && !confirm(cmd, prompt) {
+		return fmt.Errorf("aborted: no TTL was removed")
+	}
+
+	client, err := kubeFactory(gf.kubeOptions())
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	cfg, err := cfgFactory(opts.ReleaseNamespace, gf.kubeOptions())
+	if err != nil {
+		return fmt.Errorf("failed to create configuration: %w", err)
+	}
+
+	stats, err := newStatsd()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stats.Close() }()
+
+	results, err := ttl.UnsetTTLs(cmd.Context(), cfg, client, opts)
+	if err != nil {
+		return err
+	}
+
+	reportUnsetMetrics(stats, results)
+
+	output, err := ttl.FormatUnsetResults(results, outputFormat)
+	if err != nil {
+		return err
+	}
+
+	gf.printOutput(cmd, outputFormat, output)
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to remove %d of %d TTLs", failed, len(results))
+	}
+
+	return nil
+}
+
+func newRunCmd(cfgFactory configFactory, kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
 	var (
 		cronjobNamespace string
 		timeout          time.Duration
+		pollInterval     time.Duration
+		sidecars         []string
+		dryRun           bool
+		yes              bool
+		force            bool
+		outputFormat     string
+		porcelain        bool
+		keepRBAC         bool
+		keepCronJob      bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "run RELEASE",
 		Short: "Immediately run TTL for a Helm release",
 		Long: `Immediately execute the TTL action for a Helm release. Creates a Kubernetes
-Job from the CronJob's template, streams container logs, and checks exit codes.
-After execution, the CronJob and RBAC resources are cleaned up.
-
-A TTL must already be set for the release (via helm ttl set).`,
+Job from the CronJob's template, follows each container's logs as it runs, and
+checks exit codes. After a successful run, the CronJob and RBAC resources are
+cleaned up. A failed run keeps them, so the TTL can fire again or be run again
+once the problem is fixed; --keep-cronjob=false and --keep-rbac=false remove
+them anyway.
+
+A TTL must already be set for the release (via helm ttl set). With --dry-run,
+print the helm uninstall command, whether the namespace would be deleted, the
+RBAC that would be cleaned up, and the Job manifest, without creating anything.
+
+When run from a terminal, asks for confirmation first; pass --yes to skip it.
+Releases and namespaces marked helm-ttl/protected=true are refused unless
+--force is passed.
+
+With -o json or -o yaml, the result is printed to stdout for scripting and
+container logs are streamed to stderr. --porcelain does the same with JSON
+unless -o says otherwise, so only the result ever reaches stdout.
+
+The Job is given --timeout to finish, including any namespace delete
+delay, so --timeout must be longer than that delay; a run that takes
+longer fails after cleaning up, so it cannot hang a CI job. Its pod is
+watched, or checked every --poll-interval when watching pods is not
+allowed.
+
+Containers a service mesh injects despite the pod's annotations run until
+the pod is deleted. Those named by --sidecar-container, istio-proxy and
+linkerd-proxy by default, are neither waited for nor fail the run.`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			releaseName := args[0]
@@ -280,22 +1098,74 @@ A TTL must already be set for the release (via helm ttl set).`,
 				cjNs = releaseNs
 			}
 
+			if porcelain {
+				cmd.SilenceUsage = true
+				if !cmd.Flags().Changed("output") {
+					outputFormat = "json"
+				} else if outputFormat == "text" {
+					return fmt.Errorf("--porcelain requires a structured --output, not text")
+				}
+			}
+
+			if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+				return err
+			}
+
+			if timeout <= 0 {
+				return fmt.Errorf("invalid --timeout %s: must be positive", timeout)
+			}
+			if pollInterval <= 0 {
+				return fmt.Errorf("invalid --poll-interval %s: must be positive", pollInterval)
+			}
+
+			if !dryRun && !yes && !confirm(cmd, fmt.Sprintf("Uninstall release %q in namespace %q now?", releaseName, releaseNs)) {
+				return fmt.Errorf("aborted: release %q was not uninstalled", releaseName)
+			}
+
 			client, err := kubeFactory(gf.kubeOptions())
 			if err != nil {
 				return fmt.Errorf("failed to create kubernetes client: %w", err)
 			}
 
-			ctx, cancel := context.WithTimeout(context.Background(), timeout)
-			defer cancel()
+			ctx := cmd.Context()
+			if !dryRun && !force {
+				if err := checkRunProtected(ctx, cfgFactory, client, gf, releaseName, releaseNs); err != nil {
+					return err
+				}
+			}
 
 			logFetcher := ttl.NewKubeLogFetcher(client)
-			w := cmd.OutOrStdout()
 
-			result, err := ttl.RunTTL(ctx, client, w, logFetcher, releaseName, releaseNs, cjNs)
+			stats, err := newStatsd()
+			if err != nil {
+				return err
+			}
+			defer func() { _ = stats.Close() }()
+
+			// Keep stdout parseable when printing a structured result.
+			logs := cmd.OutOrStdout()
+			if outputFormat != "text" {
+				logs = cmd.ErrOrStderr()
+			}
+
+			result, err := ttl.RunTTL(ctx, client, logs, logFetcher, ttl.RunTTLOptions{
+				ReleaseName:      releaseName,
+				ReleaseNamespace: releaseNs,
+				CronjobNamespace: cjNs,
+				DryRun:           dryRun,
+				Timeout:          timeout,
+				PollInterval:     pollInterval,
+
+				SidecarContainers: sidecars,
+
+				CleanupRBACOnFailure:    !keepRBAC,
+				CleanupCronJobOnFailure: !keepCronJob,
+			})
+			reportRunMetrics(stats, result, err)
 			if err != nil {
 				var notFound *ttl.TTLNotFoundError
 				if errors.As(err, &notFound) {
-					return fmt.Errorf("no TTL set for release %q in namespace %q", releaseName, releaseNs)
+					return reword(err, "no TTL set for release %q in namespace %q", releaseName, releaseNs)
 				}
 
 				// Print container exit codes if available
@@ -304,71 +1174,211 @@ A TTL must already be set for the release (via helm ttl set).`,
 						_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Container %q exited with code %d\n", cr.Name, cr.ExitCode)
 					}
 				}
+				printKept(cmd, result, releaseName, releaseNs)
+
+				// Scripts still get the partial result of a failed run
+				if result != nil && outputFormat != "text" {
+					if out, fmtErr := ttl.FormatRunResult(result, outputFormat); fmtErr == nil {
+						_, _ = fmt.Fprint(cmd.OutOrStdout(), out)
+					}
+				}
+
+				if errors.Is(err, context.DeadlineExceeded) {
+					return fmt.Errorf("%w (raise --timeout to wait longer)", err)
+				}
 
 				return err
 			}
 
-			_, _ = fmt.Fprintf(w, "TTL executed for release %q in namespace %q\n", releaseName, result.ReleaseNamespace)
-			if result.DeletedNamespace {
-				_, _ = fmt.Fprintf(w, "Namespace %q deleted\n", result.ReleaseNamespace)
+			out, err := ttl.FormatRunResult(result, outputFormat)
+			if err != nil {
+				return err
 			}
 
+			gf.printOutput(cmd, outputFormat, out)
 			return nil
 		},
 	}
 
 	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJob lives (default: release namespace)")
-	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "timeout for job execution")
+	cmd.Flags().DurationVar(&timeout, "timeout", ttl.DefaultRunTimeout, "timeout for job execution, including any two-phase grace and namespace delete delay, which it must exceed")
+	cmd.Flags().DurationVar(&pollInterval, "poll-interval", ttl.DefaultRunPollInterval, "how often to check on the Job's pod when it cannot be watched")
+	cmd.Flags().StringSliceVar(&sidecars, "sidecar-container", ttl.DefaultSidecarContainers, "injected container that never terminates, ignored by the run (repeatable)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would be run and cleaned up without creating anything")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "run without asking for confirmation")
+	cmd.Flags().BoolVar(&force, "force", false, "run even if the release or namespace is marked "+ttl.LabelProtected)
+	cmd.Flags().BoolVar(&keepRBAC, "keep-rbac", true, "keep the RBAC resources when the run fails, so the TTL can run again")
+	cmd.Flags().BoolVar(&keepCronJob, "keep-cronjob", true, "keep the CronJob when the run fails, so the TTL can fire again")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+	cmd.Flags().BoolVar(&porcelain, "porcelain", false, "print only the result to stdout, as JSON unless -o is given; logs and prompts go to stderr")
 
 	return cmd
 }
 
+// printKept tells the user which resources a failed run left in place.
+func printKept(cmd *cobra.Command, result *ttl.RunTTLResult, releaseName, releaseNs string) {
+	if result == nil {
+		return
+	}
+
+	var kept []string
+	if result.KeptCronJob {
+		kept = append(kept, "CronJob")
+	}
+	if result.KeptRBAC {
+		kept = append(kept, "RBAC resources")
+	}
+	if len(kept) == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Kept the TTL's %s; run it again once the problem is fixed, or remove them with helm ttl unset %s --namespace %s\n",
+		strings.Join(kept, " and "), releaseName, releaseNs)
+}
+
+// checkRunProtected refuses to run the TTL of a protected release or
+// namespace. A release that is no longer installed is only checked for
+// namespace protection.
+func checkRunProtected(ctx context.Context, cfgFactory configFactory, client kubernetes.Interface, gf *globalFlags, releaseName, releaseNs string) error {
+	cfg, err := cfgFactory(releaseNs, gf.kubeOptions())
+	if err != nil {
+		return fmt.Errorf("failed to create configuration: %w", err)
+	}
+
+	rel, err := cfg.Releases.Last(releaseName)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return fmt.Errorf("failed to get release %q: %w", releaseName, err)
+	}
+
+	return ttl.CheckProtected(ctx, client, rel, releaseNs)
+}
+
 func newCleanupRBACCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
 	var (
 		dryRun        bool
+		yes           bool
 		allNamespaces bool
+		selector      string
+		outputFormat  string
+		concurrency   int
+		namespaces    []string
+		olderThan     time.Duration
 	)
 
 	cmd := &cobra.Command{
 		Use:   "cleanup-rbac",
-		Short: "Delete orphaned SA/RBAC resources",
+		Short: "Delete orphaned SA/RBAC resources and stale CronJobs",
 		Long: `Find and delete ServiceAccount and RBAC resources created by helm ttl set
-whose CronJobs have already fired or been deleted.`,
+whose CronJobs have already fired or been deleted, and TTL CronJobs whose
+release is already gone, e.g. after a manual helm uninstall. Use --selector
+to limit the sweep to the resources of specific releases, e.g.
+--selector helm-ttl/release=myapp.
+
+When run from a terminal, lists what would be deleted and asks for
+confirmation first; pass --yes to skip it.
+
+Namespaces are swept --concurrency at a time. A namespace that fails does
+not stop the others; the errors of all of them are reported at the end.
+
+--namespace takes several namespaces, repeated or comma-separated, e.g.
+-n staging,preview. With --older-than, resources created more recently,
+such as those of a TTL still being set up, are left alone.`,
 		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+				return err
+			}
+
+			if concurrency <= 0 {
+				return fmt.Errorf("invalid --concurrency %d: must be positive", concurrency)
+			}
+
+			if olderThan < 0 {
+				return fmt.Errorf("invalid --older-than %s: must not be negative", olderThan)
+			}
+
 			client, err := kubeFactory(gf.kubeOptions())
 			if err != nil {
 				return fmt.Errorf("failed to create kubernetes client: %w", err)
 			}
 
-			releaseNs := gf.getNamespace()
-			namespaces := []string{releaseNs}
+			if len(namespaces) == 0 {
+				namespaces = []string{gf.getNamespace()}
+			}
+
+			ctx := cmd.Context()
+			opts := ttl.CleanupOrphanedOptions{
+				Namespaces:    namespaces,
+				AllNamespaces: allNamespaces,
+				DryRun:        dryRun,
+				Selector:      selector,
+				Concurrency:   concurrency,
+				OlderThan:     olderThan,
+			}
+
+			if !dryRun && !yes && isTerminal(cmd.InOrStdin()) {
+				preview := opts
+				preview.DryRun = true
+				orphaned, err := ttl.CleanupOrphaned(ctx, client, preview)
+				if err != nil {
+					return err
+				}
 
-			ctx := context.Background()
-			orphaned, err := ttl.CleanupOrphaned(ctx, client, namespaces, allNamespaces, dryRun)
+				if len(orphaned) == 0 {
+					out, err := ttl.FormatCleanupResults(orphaned, false, outputFormat)
+					if err != nil {
+						return err
+					}
+
+					_, _ = fmt.Fprint(cmd.OutOrStdout(), out)
+					return nil
+				}
+
+				out, err := ttl.FormatCleanupResults(orphaned, true, "text")
+				if err != nil {
+					return err
+				}
+
+				_, _ = fmt.Fprint(cmd.ErrOrStderr(), out)
+				if !confirm(cmd, fmt.Sprintf("Delete these %d resources?", len(orphaned))) {
+					return fmt.Errorf("aborted: nothing was deleted")
+				}
+			}
+
+			stats, err := newStatsd()
 			if err != nil {
 				return err
 			}
+			defer func() { _ = stats.Close() }()
 
-			if len(orphaned) == 0 {
-				_, _ = fmt.Fprintln(cmd.OutOrStdout(), "No orphaned resources found")
-				return nil
+			started := time.Now()
+			orphaned, err := ttl.CleanupOrphaned(ctx, client, opts)
+			if !dryRun {
+				reportCleanupMetrics(stats, time.Since(started), orphaned, err)
+			}
+			if err != nil {
+				return err
 			}
 
-			for _, o := range orphaned {
-				if dryRun {
-					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Would delete %s\n", o)
-				} else {
-					_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Deleted %s\n", o)
-				}
+			out, err := ttl.FormatCleanupResults(orphaned, dryRun, outputFormat)
+			if err != nil {
+				return err
 			}
 
+			_, _ = fmt.Fprint(cmd.OutOrStdout(), out)
 			return nil
 		},
 	}
 
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would be deleted without deleting")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "delete without asking for confirmation")
 	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "search all namespaces for orphaned resources")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "only clean up resources matching this label selector (e.g. helm-ttl/release=myapp)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", ttl.DefaultCleanupConcurrency, "number of namespaces to sweep at once")
+	// Shadows the global --namespace, taking several namespaces
+	cmd.Flags().StringSliceVarP(&namespaces, "namespace", "n", nil, "namespaces to sweep, repeated or comma-separated (default: HELM_NAMESPACE or \"default\")")
+	cmd.Flags().DurationVar(&olderThan, "older-than", 0, "only clean up resources created at least this long ago, e.g. 24h")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
 
 	return cmd
 }
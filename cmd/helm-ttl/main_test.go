@@ -3,19 +3,36 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/josegonzalez/helm-ttl/pkg/notify"
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
 	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
@@ -84,8 +101,8 @@ func TestNewRootCmd(t *testing.T) {
 	assert.Equal(t, "helm-ttl", cmd.Use)
 	assert.Equal(t, version, cmd.Version)
 
-	// Should have 5 subcommands
-	assert.Len(t, cmd.Commands(), 5)
+	// Should have 27 subcommands
+	assert.Len(t, cmd.Commands(), 27)
 
 	names := make([]string, 0, len(cmd.Commands()))
 	for _, c := range cmd.Commands() {
@@ -93,9 +110,31 @@ func TestNewRootCmd(t *testing.T) {
 	}
 	assert.Contains(t, names, "set")
 	assert.Contains(t, names, "get")
+	assert.Contains(t, names, "list")
 	assert.Contains(t, names, "unset")
 	assert.Contains(t, names, "run")
 	assert.Contains(t, names, "cleanup-rbac")
+	assert.Contains(t, names, "gc")
+	assert.Contains(t, names, "report")
+	assert.Contains(t, names, "adopt")
+	assert.Contains(t, names, "migrate")
+	assert.Contains(t, names, "images")
+	assert.Contains(t, names, "version")
+	assert.Contains(t, names, "describe")
+	assert.Contains(t, names, "history")
+	assert.Contains(t, names, "logs")
+	assert.Contains(t, names, "extend")
+	assert.Contains(t, names, "webhook")
+	assert.Contains(t, names, "controller")
+	assert.Contains(t, names, "check")
+	assert.Contains(t, names, "set-namespace")
+	assert.Contains(t, names, "get-namespace")
+	assert.Contains(t, names, "unset-namespace")
+	assert.Contains(t, names, "run-namespace")
+	assert.Contains(t, names, "convert")
+	assert.Contains(t, names, "crd")
+	assert.Contains(t, names, "export")
+	assert.Contains(t, names, "import")
 
 	// Should have --namespace/-n persistent flag
 	f := cmd.PersistentFlags().Lookup("namespace")
@@ -141,9 +180,289 @@ func TestSetCmd(t *testing.T) {
 
 		// Verify CronJob was created
 		ctx := context.Background()
-		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 		require.NoError(t, err)
-		assert.Equal(t, "myapp-default-ttl", cj.Name)
+		assert.Equal(t, "myapp-4a0c226a-ttl", cj.Name)
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "-o", "json"})
+		require.NoError(t, cmd.Execute())
+
+		var result ttl.SetResult
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &result))
+		cj, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-4a0c226a-ttl", result.CronJobName)
+		assert.Equal(t, cj.Annotations[ttl.AnnotationExpiresAt], result.ExpiresAt)
+		assert.Equal(t, cj.Spec.Schedule, result.CronSchedule)
+		assert.Len(t, result.RBAC, 3)
+	})
+
+	t.Run("invalid output format", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "-o", "xml"})
+
+		err := cmd.Execute()
+		assert.ErrorContains(t, err, "xml")
+
+		// Nothing is set when the output cannot be produced
+		cjs, err := client.BatchV1().CronJobs("default").List(context.Background(), metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, cjs.Items)
+	})
+
+	t.Run("export manifests to a directory", func(t *testing.T) {
+		client := fake.NewClientset()
+		dir := filepath.Join(t.TempDir(), "ttl")
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--export-manifests", dir})
+		require.NoError(t, cmd.Execute())
+
+		assert.Equal(t, "Wrote "+filepath.Join(dir, "serviceaccount-default-myapp-4a0c226a-ttl.yaml")+"\n"+
+			"Wrote "+filepath.Join(dir, "role-default-myapp-4a0c226a-ttl.yaml")+"\n"+
+			"Wrote "+filepath.Join(dir, "rolebinding-default-myapp-4a0c226a-ttl.yaml")+"\n"+
+			"Wrote "+filepath.Join(dir, "cronjob-default-myapp-4a0c226a-ttl.yaml")+"\n", buf.String())
+		data, err := os.ReadFile(filepath.Join(dir, "cronjob-default-myapp-4a0c226a-ttl.yaml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "kind: CronJob\n")
+
+		// Nothing is applied
+		cjs, err := client.BatchV1().CronJobs("default").List(context.Background(), metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, cjs.Items)
+		sas, err := client.CoreV1().ServiceAccounts("default").List(context.Background(), metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, sas.Items)
+	})
+
+	t.Run("export manifests to stdout", func(t *testing.T) {
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--service-account", "cleaner", "--export-manifests", "-"})
+		require.NoError(t, cmd.Execute())
+
+		assert.True(t, strings.HasPrefix(buf.String(), "---\napiVersion: batch/v1\nkind: CronJob\n"))
+		assert.Equal(t, 1, strings.Count(buf.String(), "---\n"))
+	})
+
+	t.Run("argocd tracking", func(t *testing.T) {
+		client := fake.NewClientset(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "argocd-cm", Namespace: "gitops"},
+			Data:       map[string]string{"application.resourceTrackingMethod": "label"},
+		})
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--argocd-tracking", "preview", "--argocd-namespace", "gitops"})
+		require.NoError(t, cmd.Execute())
+
+		cj, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "preview", cj.Labels["app.kubernetes.io/instance"])
+		assert.Equal(t, "Prune=false", cj.Annotations[ttl.AnnotationArgoCDSyncOptions])
+		assert.Equal(t, "IgnoreExtraneous", cj.Annotations[ttl.AnnotationArgoCDCompareOptions])
+
+		role, err := client.RbacV1().Roles("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "preview", role.Labels["app.kubernetes.io/instance"])
+	})
+
+	t.Run("export manifests with argocd tracking", func(t *testing.T) {
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--service-account", "cleaner", "--export-manifests", "-", "--argocd-tracking", "preview"})
+		require.NoError(t, cmd.Execute())
+
+		assert.Contains(t, buf.String(), "argocd.argoproj.io/tracking-id: preview:batch/CronJob:default/myapp-4a0c226a-ttl\n")
+		assert.Contains(t, buf.String(), "argocd.argoproj.io/sync-options: Prune=false\n")
+	})
+
+	t.Run("post-delete", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--delete-pvcs", "--pvc-selector", "app=db",
+			"--post-delete", "kubectl delete secret -n $RELEASE_NAMESPACE -l app=x", "--post-delete", "echo done"})
+		require.NoError(t, cmd.Execute())
+
+		cj, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		var names []string
+		for _, c := range cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers {
+			names = append(names, c.Name)
+		}
+		assert.Equal(t, []string{"expiry-guard", "helm-uninstall", "verify-uninstall", "delete-pvcs", "post-delete-1", "post-delete-2"}, names)
+
+		role, err := client.RbacV1().Roles("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		var resources []string
+		for _, rule := range role.Rules {
+			resources = append(resources, rule.Resources...)
+		}
+		assert.Equal(t, []string{"secrets", "cronjobs", "persistentvolumeclaims", "secrets"}, resources)
+	})
+
+	t.Run("post-delete errors", func(t *testing.T) {
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(fake.NewClientset()))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--pvc-selector", "app=db"})
+
+		assert.ErrorContains(t, cmd.Execute(), "--pvc-selector requires --delete-pvcs")
+	})
+
+	t.Run("extra namespace", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		rel, err := store.Last("myapp")
+		require.NoError(t, err)
+		rel.Manifest = "apiVersion: monitoring.coreos.com/v1\nkind: ServiceMonitor\nmetadata:\n  name: myapp\n  namespace: monitoring\n"
+		require.NoError(t, store.Update(rel))
+
+		client := fake.NewClientset()
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--extra-namespace", "monitoring"})
+		require.NoError(t, cmd.Execute())
+
+		role, err := client.RbacV1().Roles("monitoring").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"servicemonitors"}, role.Rules[0].Resources)
+
+		cmd = newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--extra-namespace", "monitoring"})
+		assert.ErrorContains(t, cmd.Execute(), "--extra-namespace requires --create-service-account")
+	})
+
+	t.Run("service account annotations", func(t *testing.T) {
+		client := fake.NewClientset()
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account",
+			"--service-account-annotation", "eks.amazonaws.com/role-arn=arn:aws:iam::111122223333:role/helm-ttl",
+			"--service-account-annotation", "team=platform"})
+		require.NoError(t, cmd.Execute())
+
+		sa, err := client.CoreV1().ServiceAccounts("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "arn:aws:iam::111122223333:role/helm-ttl", sa.Annotations["eks.amazonaws.com/role-arn"])
+		assert.Equal(t, "platform", sa.Annotations["team"])
+
+		cmd = newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--service-account-annotation", "team"})
+		assert.ErrorContains(t, cmd.Execute(), `invalid --service-account-annotation "team"`)
+	})
+
+	t.Run("cronjob labels and annotations", func(t *testing.T) {
+		client := fake.NewClientset()
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account",
+			"--cronjob-label", "cost-center=1234",
+			"--cronjob-annotation", "karpenter.sh/do-not-disrupt=true",
+			"--cronjob-annotation", "sidecar.istio.io/inject=true"})
+		require.NoError(t, cmd.Execute())
+
+		cj, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "1234", cj.Labels["cost-center"])
+		assert.Equal(t, "1234", cj.Spec.JobTemplate.Spec.Template.Labels["cost-center"])
+		assert.Equal(t, "true", cj.Annotations["karpenter.sh/do-not-disrupt"])
+		assert.Equal(t, "true", cj.Spec.JobTemplate.Spec.Template.Annotations["sidecar.istio.io/inject"])
+
+		cmd = newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--cronjob-label", "helm-ttl/release=x"})
+		assert.ErrorContains(t, cmd.Execute(), `invalid --cronjob-label key "helm-ttl/release"`)
+	})
+
+	t.Run("allow sidecar injection", func(t *testing.T) {
+		client := fake.NewClientset()
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--allow-sidecar-injection"})
+		require.NoError(t, cmd.Execute())
+
+		cj, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, cj.Spec.JobTemplate.Spec.Template.Annotations, ttl.AnnotationIstioInject)
+		assert.NotContains(t, cj.Spec.JobTemplate.Spec.Template.Annotations, ttl.AnnotationLinkerdInject)
+	})
+
+	t.Run("export manifests errors", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(file, nil, 0o644))
+
+		for name, tc := range map[string]struct {
+			args []string
+			err  string
+		}{
+			"with output":       {[]string{"set", "myapp", "24h", "--export-manifests", "-", "-o", "json"}, "cannot use --output with --export-manifests"},
+			"release not found": {[]string{"set", "other", "24h", "--export-manifests", "-"}, `release "other" not found in namespace "default"`},
+			"unwritable":        {[]string{"set", "myapp", "24h", "--export-manifests", filepath.Join(file, "ttl")}, "failed to create"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(fake.NewClientset()))
+				cmd.SetOut(&bytes.Buffer{})
+				cmd.SetErr(&bytes.Buffer{})
+				cmd.SetArgs(tc.args)
+
+				assert.ErrorContains(t, cmd.Execute(), tc.err)
+			})
+		}
+	})
+
+	t.Run("protected namespace", func(t *testing.T) {
+		protectedNs := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "default",
+			Labels: map[string]string{ttl.LabelProtected: "true"},
+		}}
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(fake.NewClientset(protectedNs)))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `namespace "default" is protected`)
+
+		cmd = newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(fake.NewClientset(protectedNs)))
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--force"})
+		require.NoError(t, cmd.Execute())
 	})
 
 	t.Run("set TTL with existing service account", func(t *testing.T) {
@@ -151,6 +470,11 @@ func TestSetCmd(t *testing.T) {
 		client := fake.NewClientset(&corev1.ServiceAccount{
 			ObjectMeta: metav1.ObjectMeta{Name: "my-sa", Namespace: "default"},
 		})
+		client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+			review.Status.Allowed = true
+			return true, review, nil
+		})
 
 		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
@@ -162,6 +486,33 @@ func TestSetCmd(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("set TTL with under-privileged service account", func(t *testing.T) {
+		client := fake.NewClientset(&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-sa", Namespace: "default"},
+		})
+		client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+			review.Status.Allowed = review.Spec.ResourceAttributes.Resource != "secrets"
+			return true, review, nil
+		})
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "2h", "--service-account", "my-sa"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "  - delete secrets in namespace default\n")
+		assert.Contains(t, err.Error(), "use --create-service-account")
+
+		cmd = newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "2h", "--service-account", "my-sa", "--skip-preflight"})
+		require.NoError(t, cmd.Execute())
+	})
+
 	t.Run("release not found", func(t *testing.T) {
 		mem := driver.NewMemory()
 		store := storage.Init(mem)
@@ -219,549 +570,2089 @@ func TestSetCmd(t *testing.T) {
 		assert.Contains(t, err.Error(), "kubernetes client")
 	})
 
-	t.Run("too few args", func(t *testing.T) {
-		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
-		cmd.SetArgs([]string{"set", "myapp"})
+	t.Run("no duration and no namespace default", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "--create-service-account"})
 		err := cmd.Execute()
 		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no duration given")
 	})
 
-	t.Run("delete-namespace flag", func(t *testing.T) {
-		_ = os.Setenv("HELM_NAMESPACE", "staging")
-		defer func() { _ = os.Setenv("HELM_NAMESPACE", "default") }()
-
-		store := setupTestStore(t, "myapp", "staging")
-		client := fake.NewClientset()
+	t.Run("namespace default duration", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: policy.ConfigMapName, Namespace: "default"},
+			Data:       map[string]string{policy.KeyDefaultDuration: "3d", policy.KeyMaxDuration: "7d"},
+		})
 
 		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"set", "myapp", "7d", "--create-service-account", "--cronjob-namespace", "ops", "--delete-namespace"})
+		cmd.SetArgs([]string{"set", "myapp", "--create-service-account"})
 
 		err := cmd.Execute()
 		require.NoError(t, err)
-
-		ctx := context.Background()
-		cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
-		require.NoError(t, err)
-		assert.Equal(t, "true", cj.Labels[ttl.LabelDeleteNamespace])
+		assert.Contains(t, buf.String(), "TTL set")
 	})
 
-	t.Run("custom images", func(t *testing.T) {
+	t.Run("duration above namespace maximum", func(t *testing.T) {
 		store := setupTestStore(t, "myapp", "default")
-		client := fake.NewClientset()
+		client := fake.NewClientset(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: policy.ConfigMapName, Namespace: "default"},
+			Data:       map[string]string{policy.KeyMaxDuration: "7d"},
+		})
 
 		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"set", "myapp", "1h", "--create-service-account", "--helm-image", "custom/helm:v3", "--kubectl-image", "custom/kubectl:v1"})
+		cmd.SetArgs([]string{"set", "myapp", "30d", "--create-service-account"})
 
 		err := cmd.Execute()
-		require.NoError(t, err)
-
-		ctx := context.Background()
-		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
-		require.NoError(t, err)
-		assert.Equal(t, "custom/helm:v3", cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[0].Image)
-		assert.Equal(t, "custom/kubectl:v1", cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "exceeds the maximum of 168h0m0s")
 	})
 
-	t.Run("namespace flag overrides env", func(t *testing.T) {
-		store := setupTestStore(t, "myapp", "staging")
+	t.Run("from-release-annotation", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		rel, err := store.Last("myapp")
+		require.NoError(t, err)
+		rel.Chart.Metadata.Annotations = map[string]string{ttl.AnnotationDuration: "72h"}
+		require.NoError(t, store.Update(rel))
 		client := fake.NewClientset()
 
 		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--namespace", "staging"})
-
-		err := cmd.Execute()
-		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "staging")
+		cmd.SetArgs([]string{"set", "myapp", "--from-release-annotation", "--create-service-account"})
 
-		ctx := context.Background()
-		cj, err := client.BatchV1().CronJobs("staging").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+		err = cmd.Execute()
 		require.NoError(t, err)
-		assert.Equal(t, "myapp-staging-ttl", cj.Name)
+		assert.Contains(t, buf.String(), "TTL set")
 	})
 
-	t.Run("short namespace flag", func(t *testing.T) {
-		store := setupTestStore(t, "myapp", "staging")
+	t.Run("from-release-annotation with release label", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		rel, err := store.Last("myapp")
+		require.NoError(t, err)
+		rel.Labels = map[string]string{ttl.AnnotationDuration: "24h"}
+		require.NoError(t, store.Update(rel))
 		client := fake.NewClientset()
 
 		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "-n", "staging"})
+		cmd.SetArgs([]string{"set", "myapp", "--from-release-annotation", "--create-service-account"})
 
-		err := cmd.Execute()
+		err = cmd.Execute()
 		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "staging")
+		assert.Contains(t, buf.String(), "TTL set")
 	})
-}
 
-func TestGetCmd(t *testing.T) {
-	origNs := os.Getenv("HELM_NAMESPACE")
-	defer func() { _ = os.Setenv("HELM_NAMESPACE", origNs) }()
-	_ = os.Setenv("HELM_NAMESPACE", "default")
-
-	t.Run("get TTL - text output", func(t *testing.T) {
-		client := fake.NewClientset(&batchv1.CronJob{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-default-ttl",
-				Namespace: "default",
-				Labels: map[string]string{
-					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
-					ttl.LabelRelease:          "myapp",
-					ttl.LabelReleaseNamespace: "default",
-					ttl.LabelCronjobNamespace: "default",
-					ttl.LabelDeleteNamespace:  "false",
-				},
-			},
-			Spec: batchv1.CronJobSpec{
-				Schedule: "30 14 15 3 *",
-			},
-		})
+	t.Run("from-release-annotation without annotation", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"get", "myapp"})
+		cmd.SetArgs([]string{"set", "myapp", "--from-release-annotation", "--create-service-account"})
 
 		err := cmd.Execute()
-		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "myapp")
-		assert.Contains(t, buf.String(), "30 14 15 3 *")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "does not declare")
 	})
 
-	t.Run("get TTL - json output", func(t *testing.T) {
-		client := fake.NewClientset(&batchv1.CronJob{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-default-ttl",
-				Namespace: "default",
-				Labels: map[string]string{
-					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
-					ttl.LabelRelease:          "myapp",
-					ttl.LabelReleaseNamespace: "default",
-					ttl.LabelCronjobNamespace: "default",
-					ttl.LabelDeleteNamespace:  "false",
-				},
-			},
-			Spec: batchv1.CronJobSpec{
-				Schedule: "30 14 15 3 *",
-			},
-		})
+	t.Run("values-annotation", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		rel, err := store.Last("myapp")
+		require.NoError(t, err)
+		rel.Config = map[string]interface{}{"ttl": "72h"}
+		require.NoError(t, store.Update(rel))
+		client := fake.NewClientset()
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"get", "myapp", "-o", "json"})
+		cmd.SetArgs([]string{"set", "myapp", "--values-annotation", "ttl", "--create-service-account"})
 
-		err := cmd.Execute()
+		err = cmd.Execute()
 		require.NoError(t, err)
-		assert.Contains(t, buf.String(), `"release_name": "myapp"`)
+		assert.Contains(t, buf.String(), "TTL set")
 	})
 
-	t.Run("get TTL - yaml output", func(t *testing.T) {
-		client := fake.NewClientset(&batchv1.CronJob{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-default-ttl",
-				Namespace: "default",
-				Labels: map[string]string{
-					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
-					ttl.LabelRelease:          "myapp",
-					ttl.LabelReleaseNamespace: "default",
-					ttl.LabelCronjobNamespace: "default",
-					ttl.LabelDeleteNamespace:  "false",
-				},
-			},
-			Spec: batchv1.CronJobSpec{
-				Schedule: "30 14 15 3 *",
-			},
-		})
+	t.Run("values-annotation without value", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"get", "myapp", "-o", "yaml"})
+		cmd.SetArgs([]string{"set", "myapp", "--values-annotation", "ttl", "--create-service-account"})
 
 		err := cmd.Execute()
-		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "release_name: myapp")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "does not set ttl in its values")
 	})
 
-	t.Run("TTL not found", func(t *testing.T) {
-		client := fake.NewClientset()
-
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+	t.Run("values-annotation with duration", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"get", "myapp"})
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--values-annotation", "ttl"})
 
 		err := cmd.Execute()
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "no TTL set")
+		assert.Contains(t, err.Error(), "cannot specify DURATION together with --values-annotation")
 	})
 
-	t.Run("kube client error", func(t *testing.T) {
-		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+	t.Run("from-release-annotation with duration", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"get", "myapp"})
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--from-release-annotation"})
 
 		err := cmd.Execute()
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "kubernetes client")
+		assert.Contains(t, err.Error(), "cannot specify DURATION")
 	})
 
-	t.Run("cross-namespace get", func(t *testing.T) {
-		_ = os.Setenv("HELM_NAMESPACE", "staging")
-		defer func() { _ = os.Setenv("HELM_NAMESPACE", "default") }()
+	t.Run("expected-generation conflict", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
 
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--create-service-account", "--expected-generation", "0"})
+		require.NoError(t, cmd.Execute())
+
+		cmd = newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "2h", "--create-service-account", "--expected-generation", "0"})
+
+		err := cmd.Execute()
+		var conflict *ttl.ConflictError
+		assert.True(t, errors.As(err, &conflict))
+	})
+
+	t.Run("if-not-exists keeps the existing TTL", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "2d", "--create-service-account", "--if-not-exists"})
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "TTL set for release")
+
+		buf.Reset()
+		cmd = newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--create-service-account", "--if-not-exists"})
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), `TTL already set for release "myapp" in namespace "default", expires at `)
+
+		info, err := ttl.GetTTL(context.Background(), client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), info.Generation)
+	})
+
+	t.Run("quiet prints only the expiry", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+		execute := func(args ...string) string {
+			cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+			var buf bytes.Buffer
+			cmd.SetOut(&buf)
+			cmd.SetErr(io.Discard)
+			cmd.SetArgs(args)
+			require.NoError(t, cmd.Execute())
+
+			return buf.String()
+		}
+
+		expiry := execute("set", "myapp", "2d", "--create-service-account", "-q")
+		_, err := time.Parse(time.RFC3339, strings.TrimSpace(expiry))
+		require.NoError(t, err, expiry)
+
+		assert.Equal(t, expiry, execute("get", "myapp", "--quiet"))
+		assert.Contains(t, execute("get", "myapp", "-q", "-o", "json"), `"scheduled_date"`)
+		assert.Empty(t, execute("unset", "myapp", "-q"))
+	})
+
+	t.Run("if-not-exists with expected-generation", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--if-not-exists", "--expected-generation", "0"})
+
+		assert.EqualError(t, cmd.Execute(), "cannot use --if-not-exists with --expected-generation")
+	})
+
+	t.Run("extend-only refuses an earlier expiry", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"set", "myapp", "14d", "--create-service-account"})
+		require.NoError(t, cmd.Execute())
+
+		cmd = newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"set", "myapp", "1d", "--create-service-account", "--extend-only"})
+		assert.ErrorContains(t, cmd.Execute(), "refusing to move the expiry of release \"myapp\" earlier")
+	})
+
+	t.Run("allow-short", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"set", "myapp", "10s", "--create-service-account"})
+		assert.ErrorContains(t, cmd.Execute(), "TTL of 10s is shorter than the minimum of 5m")
+
+		cmd = newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"set", "myapp", "10s", "--create-service-account", "--allow-short"})
+		require.NoError(t, cmd.Execute())
+	})
+
+	t.Run("scale-down-after with delete-after", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "--scale-down-after", "24h", "--delete-after", "72h", "--create-service-account"})
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "Scales down to zero replicas at ")
+
+		_, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-scale-down", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("delete-after with DURATION", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--delete-after", "2h"})
+
+		assert.EqualError(t, cmd.Execute(), "cannot specify DURATION together with --delete-after")
+	})
+
+	t.Run("extend-only with shrink-only", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--extend-only", "--shrink-only"})
+
+		assert.EqualError(t, cmd.Execute(), "cannot use --extend-only with --shrink-only")
+	})
+
+	t.Run("delete-namespace flag", func(t *testing.T) {
+		_ = os.Setenv("HELM_NAMESPACE", "staging")
+		defer func() { _ = os.Setenv("HELM_NAMESPACE", "default") }()
+
+		store := setupTestStore(t, "myapp", "staging")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "7d", "--create-service-account", "--cronjob-namespace", "ops", "--delete-namespace"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "true", cj.Labels[ttl.LabelDeleteNamespace])
+	})
+
+	t.Run("namespace-delete-delay flag", func(t *testing.T) {
+		t.Setenv("HELM_NAMESPACE", "staging")
+
+		store := setupTestStore(t, "myapp", "staging")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "7d", "--create-service-account", "--cronjob-namespace", "ops", "--delete-namespace", "--namespace-delete-delay", "10m"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("ops").Get(context.Background(), "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "10m0s", cj.Annotations[ttl.AnnotationNamespaceDeleteDelay])
+	})
+
+	t.Run("namespace-delete-delay without delete-namespace", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "7d", "--namespace-delete-delay", "10m"})
+
+		err := cmd.Execute()
+		assert.ErrorContains(t, err, "--namespace-delete-delay requires --delete-namespace")
+	})
+
+	t.Run("two-phase flag", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "7d", "--create-service-account", "--two-phase"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "10m0s", cj.Annotations[ttl.AnnotationTwoPhaseGrace])
+	})
+
+	t.Run("two-phase-grace flag", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "7d", "--create-service-account", "--two-phase", "--two-phase-grace", "1h"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "1h0m0s", cj.Annotations[ttl.AnnotationTwoPhaseGrace])
+	})
+
+	t.Run("abort-window flag", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "7d", "--create-service-account", "--abort-window", "30m"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "30m0s", cj.Annotations[ttl.AnnotationAbortWindow])
+		assert.NotNil(t, cj.Spec.JobTemplate.Spec.PodFailurePolicy)
+	})
+
+	t.Run("two-phase-grace errors", func(t *testing.T) {
+		for args, want := range map[string]string{
+			"--two-phase-grace 1h":             "--two-phase-grace requires --two-phase",
+			"--two-phase --two-phase-grace 0s": "invalid --two-phase-grace 0s: must be positive",
+		} {
+			store := setupTestStore(t, "myapp", "default")
+			cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(fake.NewClientset()))
+			var buf bytes.Buffer
+			cmd.SetOut(&buf)
+			cmd.SetErr(&buf)
+			cmd.SetArgs(append([]string{"set", "myapp", "7d"}, strings.Fields(args)...))
+
+			err := cmd.Execute()
+			assert.EqualError(t, err, want, args)
+		}
+	})
+
+	t.Run("driver flag selects RBAC and HELM_DRIVER", func(t *testing.T) {
+		t.Setenv("HELM_NAMESPACE", "staging")
+
+		store := setupTestStore(t, "myapp", "staging")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "7d", "--create-service-account", "--cronjob-namespace", "ops", "--driver", "sql"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		_, err = client.RbacV1().Roles("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		assert.Error(t, err)
+
+		cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Contains(t, cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[1].Env, corev1.EnvVar{Name: "HELM_DRIVER", Value: "sql"})
+	})
+
+	t.Run("custom images", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--create-service-account", "--helm-image", "custom/helm:v3", "--kubectl-image", "custom/kubectl:v1"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "custom/helm:v3", cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[1].Image)
+		assert.Equal(t, "custom/kubectl:v1", cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image)
+	})
+
+	t.Run("uninstall flags", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--create-service-account",
+			"--uninstall-wait", "--uninstall-timeout", "10m", "--keep-history", "--cascade", "foreground", "--no-hooks"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		command := cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[1].Command
+		require.Len(t, command, 3)
+		assert.Contains(t, command[2],
+			"exec helm uninstall myapp --namespace default --wait --timeout 10m0s --keep-history --cascade foreground --no-hooks")
+	})
+
+	t.Run("job retries and deadlines", func(t *testing.T) {
+		client := fake.NewClientset()
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account",
+			"--backoff-limit", "0", "--active-deadline-seconds", "1800", "--starting-deadline-seconds", "600", "--failed-history-limit", "0"})
+		require.NoError(t, cmd.Execute())
+
+		cj, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, int32(0), *cj.Spec.JobTemplate.Spec.BackoffLimit)
+		assert.Equal(t, int64(1800), *cj.Spec.JobTemplate.Spec.ActiveDeadlineSeconds)
+		assert.Equal(t, int64(600), *cj.Spec.StartingDeadlineSeconds)
+		assert.Equal(t, int32(0), *cj.Spec.FailedJobsHistoryLimit)
+
+		cmd = newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--starting-deadline-seconds", "1"})
+		assert.ErrorContains(t, cmd.Execute(), "invalid --starting-deadline-seconds 1")
+	})
+
+	t.Run("on failure webhook", func(t *testing.T) {
+		client := fake.NewClientset()
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--on-failure-webhook", "https://hooks.example.com/ttl"})
+		require.NoError(t, cmd.Execute())
+
+		cj, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		for _, c := range cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers {
+			assert.Contains(t, c.Env, corev1.EnvVar{Name: notify.FailureWebhookEnv, Value: "https://hooks.example.com/ttl"}, c.Name)
+		}
+
+		cmd = newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--on-failure-webhook", "hooks.example.com"})
+		assert.ErrorContains(t, cmd.Execute(), `invalid --on-failure-webhook "hooks.example.com"`)
+	})
+
+	t.Run("on failure webhook proxy and CA file", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		server.Close()
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(caFile, ca, 0o600))
+
+		client := fake.NewClientset()
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--on-failure-webhook", "https://hooks.example.com/ttl",
+			"--on-failure-webhook-proxy", "http://proxy.example.com:3128", "--on-failure-webhook-ca-file", caFile})
+		require.NoError(t, cmd.Execute())
+
+		cj, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		for _, c := range cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers {
+			assert.Contains(t, c.Env, corev1.EnvVar{Name: notify.FailureProxyEnv, Value: "http://proxy.example.com:3128"}, c.Name)
+			assert.Contains(t, c.Env, corev1.EnvVar{Name: notify.FailureCABundleEnv, Value: string(ca)}, c.Name)
+		}
+
+		cmd = newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--on-failure-webhook", "https://hooks.example.com/ttl",
+			"--on-failure-webhook-ca-file", filepath.Join(t.TempDir(), "missing.pem")})
+		assert.ErrorContains(t, cmd.Execute(), "failed to read")
+	})
+
+	t.Run("ambiguous date refused", func(t *testing.T) {
+		t.Setenv("HELM_TTL_DATE_ORDER", "")
+		store := setupTestStore(t, "myapp", "default")
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "01/02 5pm"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "ambiguous date")
+	})
+
+	t.Run("date-order flag", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+		target := time.Now().Add(48 * time.Hour)
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", fmt.Sprintf("%02d/%02d 11:30", target.Day(), target.Month()),
+			"--create-service-account", "--date-order", "dmy"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("30 11 %d %d *", target.Day(), target.Month()), cj.Spec.Schedule)
+	})
+
+	t.Run("image pull secrets", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--create-service-account",
+			"--image-pull-secret", "registry-a", "--image-pull-secret", "registry-b"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []corev1.LocalObjectReference{{Name: "registry-a"}, {Name: "registry-b"}},
+			cj.Spec.JobTemplate.Spec.Template.Spec.ImagePullSecrets)
+	})
+
+	t.Run("registry prefix", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--create-service-account", "--registry-prefix", "registry.example.com/mirror"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "registry.example.com/mirror/"+ttl.DefaultHelmImage, cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[1].Image)
+	})
+
+	t.Run("security context flags", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--create-service-account", "--run-as-user", "1000", "--run-as-group", "3000"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+
+		sc := cj.Spec.JobTemplate.Spec.Template.Spec.SecurityContext
+		require.NotNil(t, sc)
+		assert.Equal(t, int64(1000), *sc.RunAsUser)
+		assert.Equal(t, int64(3000), *sc.RunAsGroup)
+	})
+
+	t.Run("no-security-context flag", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--create-service-account", "--no-security-context"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Nil(t, cj.Spec.JobTemplate.Spec.Template.Spec.SecurityContext)
+	})
+
+	t.Run("cleanup image", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--create-service-account", "--cleanup-image", "helm-ttl-cleanup:v1"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "helm-ttl-cleanup:v1", cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Image)
+	})
+
+	t.Run("pod flags", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		podSpecFile := filepath.Join(t.TempDir(), "pod.yaml")
+		require.NoError(t, os.WriteFile(podSpecFile, []byte(`nodeSelector:
+  pool: system
+tolerations:
+  - key: dedicated
+    operator: Exists
+priorityClassName: low
+resources:
+  requests:
+    cpu: 50m
+`), 0o600))
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--create-service-account",
+			"--pod-spec-file", podSpecFile, "--node-selector", "kubernetes.io/os=linux",
+			"--priority-class-name", "high", "--requests", "memory=64Mi", "--limits", "cpu=200m"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+
+		spec := cj.Spec.JobTemplate.Spec.Template.Spec
+		assert.Equal(t, map[string]string{"pool": "system", "kubernetes.io/os": "linux"}, spec.NodeSelector)
+		assert.Len(t, spec.Tolerations, 1)
+		assert.Equal(t, "high", spec.PriorityClassName)
+		resources := spec.Containers[0].Resources
+		assert.Equal(t, resource.MustParse("50m"), resources.Requests[corev1.ResourceCPU])
+		assert.Equal(t, resource.MustParse("64Mi"), resources.Requests[corev1.ResourceMemory])
+		assert.Equal(t, resource.MustParse("200m"), resources.Limits[corev1.ResourceCPU])
+	})
+
+	t.Run("invalid pod spec file", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "1h", "--pod-spec-file", "/nonexistent/pod.yaml"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to read pod spec file")
+	})
+
+	t.Run("invalid resource flags", func(t *testing.T) {
+		for _, flag := range []string{"--requests", "--limits"} {
+			store := setupTestStore(t, "myapp", "default")
+
+			cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(fake.NewClientset()))
+			var buf bytes.Buffer
+			cmd.SetOut(&buf)
+			cmd.SetErr(&buf)
+			cmd.SetArgs([]string{"set", "myapp", "1h", flag, "cpu=lots"})
+
+			err := cmd.Execute()
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "invalid "+flag)
+		}
+	})
+
+	t.Run("namespace flag overrides env", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "staging")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "--namespace", "staging"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "staging")
+
+		ctx := context.Background()
+		cj, err := client.BatchV1().CronJobs("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-80081014-ttl", cj.Name)
+	})
+
+	t.Run("short namespace flag", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "staging")
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"set", "myapp", "24h", "--create-service-account", "-n", "staging"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "staging")
+	})
+}
+
+func TestGetCmd(t *testing.T) {
+	origNs := os.Getenv("HELM_NAMESPACE")
+	defer func() { _ = os.Setenv("HELM_NAMESPACE", origNs) }()
+	_ = os.Setenv("HELM_NAMESPACE", "default")
+
+	t.Run("get TTL - text output", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-4a0c226a-ttl",
+				Namespace: "default",
+				Labels: map[string]string{
+					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+					ttl.LabelRelease:          "myapp",
+					ttl.LabelReleaseNamespace: "default",
+					ttl.LabelCronjobNamespace: "default",
+					ttl.LabelDeleteNamespace:  "false",
+				},
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "30 14 15 3 *",
+			},
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"get", "myapp"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "myapp")
+		assert.Contains(t, buf.String(), "30 14 15 3 *")
+	})
+
+	t.Run("get TTL - release existence", func(t *testing.T) {
+		cronJob := &batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-4a0c226a-ttl",
+				Namespace: "default",
+				Labels: map[string]string{
+					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+					ttl.LabelRelease:          "myapp",
+					ttl.LabelReleaseNamespace: "default",
+					ttl.LabelCronjobNamespace: "default",
+				},
+			},
+			Spec: batchv1.CronJobSpec{Schedule: "30 14 15 3 *"},
+		}
+
+		run := func(t *testing.T, installed string, args ...string) (string, string) {
+			t.Helper()
+			cmd := newRootCmd(testConfigFactory(setupTestStore(t, installed, "default")), testKubeFactoryWithClient(fake.NewClientset(cronJob)))
+			var out, errOut bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetErr(&errOut)
+			cmd.SetArgs(append([]string{"get", "myapp"}, args...))
+			require.NoError(t, cmd.Execute())
+
+			return out.String(), errOut.String()
+		}
+
+		out, errOut := run(t, "myapp")
+		assert.Contains(t, out, "Release Exists:   yes")
+		assert.Empty(t, errOut)
+
+		out, errOut = run(t, "other")
+		assert.Contains(t, out, "Release Exists:   no")
+		assert.Contains(t, errOut, `release "myapp" not found in namespace "default": the TTL points at nothing`)
+
+		out, _ = run(t, "other", "-o", "json")
+		assert.Contains(t, out, `"release_exists": false`)
+
+		out, errOut = run(t, "other", "--orphans-ok")
+		assert.NotContains(t, out, "Release Exists")
+		assert.Empty(t, errOut)
+	})
+
+	t.Run("get TTL - columns", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-4a0c226a-ttl",
+				Namespace: "default",
+				Labels: map[string]string{
+					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+					ttl.LabelRelease:          "myapp",
+					ttl.LabelReleaseNamespace: "default",
+					ttl.LabelCronjobNamespace: "default",
+				},
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "30 14 15 3 *",
+			},
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"get", "myapp", "--columns", "release,schedule"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Equal(t, "RELEASE  CRON SCHEDULE\nmyapp    30 14 15 3 *\n", buf.String())
+	})
+
+	t.Run("get TTL - status only with --all", func(t *testing.T) {
+		for _, args := range [][]string{{"get", "myapp"}, {"get", "myapp", "--all"}} {
+			client := fake.NewClientset(&batchv1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "myapp-4a0c226a-ttl",
+					Namespace: "default",
+				},
+				Spec: batchv1.CronJobSpec{
+					Schedule: "30 14 15 3 *",
+				},
+			})
+
+			cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+			var buf bytes.Buffer
+			cmd.SetOut(&buf)
+			cmd.SetErr(&buf)
+			cmd.SetArgs(args)
+
+			err := cmd.Execute()
+			require.NoError(t, err)
+			if len(args) == 3 {
+				assert.Contains(t, buf.String(), "Last Schedule:    never")
+			} else {
+				assert.NotContains(t, buf.String(), "Last Schedule")
+			}
+		}
+	})
+
+	t.Run("get TTL - last failed run", func(t *testing.T) {
+		labels := map[string]string{
+			ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+			ttl.LabelRelease:          "myapp",
+			ttl.LabelReleaseNamespace: "default",
+			ttl.LabelCronjobNamespace: "default",
+		}
+		client := fake.NewClientset(
+			&batchv1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
+				Spec:       batchv1.CronJobSpec{Schedule: "30 14 15 3 *"},
+			},
+			&batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl-29000000", Namespace: "default", Labels: labels},
+				Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{{
+					Type:               batchv1.JobFailed,
+					Status:             corev1.ConditionTrue,
+					Reason:             "BackoffLimitExceeded",
+					Message:            "Job has reached the specified backoff limit",
+					LastTransitionTime: metav1.NewTime(time.Date(2026, 3, 15, 14, 35, 0, 0, time.UTC)),
+				}}},
+			},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl-29000000-abcde", Namespace: "default", Labels: map[string]string{"job-name": "myapp-4a0c226a-ttl-29000000"}},
+				Status: corev1.PodStatus{InitContainerStatuses: []corev1.ContainerStatus{{
+					Name:  "helm-uninstall",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}},
+				}}},
+			},
+		)
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"get", "myapp", "--show-last-run"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "Last Failed Run:  2026-03-15T14:35:00Z (Job myapp-4a0c226a-ttl-29000000)")
+		assert.Contains(t, buf.String(), "  Reason:         BackoffLimitExceeded: Job has reached the specified backoff limit\n")
+		assert.Contains(t, buf.String(), "==> Container: helm-uninstall (exit code 1) <==\nfake logs\n")
+
+		client.PrependReactor("list", "jobs", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("forbidden")
+		})
+		cmd = newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"get", "myapp", "--show-last-run"})
+		assert.EqualError(t, cmd.Execute(), "failed to list Jobs: forbidden")
+	})
+
+	t.Run("get TTL - json output", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-4a0c226a-ttl",
+				Namespace: "default",
+				Labels: map[string]string{
+					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+					ttl.LabelRelease:          "myapp",
+					ttl.LabelReleaseNamespace: "default",
+					ttl.LabelCronjobNamespace: "default",
+					ttl.LabelDeleteNamespace:  "false",
+				},
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "30 14 15 3 *",
+			},
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"get", "myapp", "-o", "json"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), `"release_name": "myapp"`)
+	})
+
+	t.Run("get TTL - template output", func(t *testing.T) {
+		for format, want := range map[string]string{
+			"go-template={{.cron_schedule}}": "30 14 15 3 *",
+			"jsonpath={.release_name}":       "myapp",
+		} {
+			client := fake.NewClientset(&batchv1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "myapp-4a0c226a-ttl",
+					Namespace: "default",
+					Labels: map[string]string{
+						ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+						ttl.LabelRelease:          "myapp",
+						ttl.LabelReleaseNamespace: "default",
+						ttl.LabelCronjobNamespace: "default",
+					},
+				},
+				Spec: batchv1.CronJobSpec{
+					Schedule: "30 14 15 3 *",
+				},
+			})
+
+			cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+			var buf bytes.Buffer
+			cmd.SetOut(&buf)
+			cmd.SetErr(&buf)
+			cmd.SetArgs([]string{"get", "myapp", "-o", format})
+
+			require.NoError(t, cmd.Execute())
+			assert.Equal(t, want, buf.String(), format)
+		}
+	})
+
+	t.Run("get TTL - yaml output", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-4a0c226a-ttl",
+				Namespace: "default",
+				Labels: map[string]string{
+					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+					ttl.LabelRelease:          "myapp",
+					ttl.LabelReleaseNamespace: "default",
+					ttl.LabelCronjobNamespace: "default",
+					ttl.LabelDeleteNamespace:  "false",
+				},
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "30 14 15 3 *",
+			},
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"get", "myapp", "-o", "yaml"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "release_name: myapp")
+	})
+
+	t.Run("TTL not found", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"get", "myapp"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no TTL set")
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"get", "myapp"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "kubernetes client")
+	})
+
+	t.Run("cross-namespace get", func(t *testing.T) {
+		_ = os.Setenv("HELM_NAMESPACE", "staging")
+		defer func() { _ = os.Setenv("HELM_NAMESPACE", "default") }()
+
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-80081014-ttl",
+				Namespace: "ops",
+				Labels: map[string]string{
+					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+					ttl.LabelRelease:          "myapp",
+					ttl.LabelReleaseNamespace: "staging",
+					ttl.LabelCronjobNamespace: "ops",
+					ttl.LabelDeleteNamespace:  "true",
+				},
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "0 12 1 1 *",
+			},
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"get", "myapp", "--cronjob-namespace", "ops"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "staging")
+		assert.Contains(t, buf.String(), "ops")
+	})
+
+	t.Run("namespace flag overrides env", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-80081014-ttl",
+				Namespace: "staging",
+				Labels: map[string]string{
+					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+					ttl.LabelRelease:          "myapp",
+					ttl.LabelReleaseNamespace: "staging",
+					ttl.LabelCronjobNamespace: "staging",
+					ttl.LabelDeleteNamespace:  "false",
+				},
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "30 14 15 3 *",
+			},
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"get", "myapp", "--namespace", "staging"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "staging")
+	})
+}
+
+func TestUnsetCmd(t *testing.T) {
+	origNs := os.Getenv("HELM_NAMESPACE")
+	defer func() { _ = os.Setenv("HELM_NAMESPACE", origNs) }()
+	_ = os.Setenv("HELM_NAMESPACE", "default")
+
+	t.Run("unset existing TTL", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-4a0c226a-ttl",
+				Namespace: "default",
+				Labels: map[string]string{
+					ttl.LabelManagedBy: ttl.LabelManagedByValue,
+					ttl.LabelRelease:   "myapp",
+				},
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "30 14 15 6 *",
+			},
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"unset", "myapp"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "TTL removed")
+	})
+
+	t.Run("unset TTL not found", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"unset", "myapp"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no TTL set")
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"unset", "myapp"})
+
+		err := cmd.Execute()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "kubernetes client")
+	})
+
+	t.Run("namespace flag overrides env", func(t *testing.T) {
 		client := fake.NewClientset(&batchv1.CronJob{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-staging-ttl",
-				Namespace: "ops",
+				Name:      "myapp-80081014-ttl",
+				Namespace: "staging",
+				Labels: map[string]string{
+					ttl.LabelManagedBy: ttl.LabelManagedByValue,
+					ttl.LabelRelease:   "myapp",
+				},
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "30 14 15 6 *",
+			},
+		})
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"unset", "myapp", "--namespace", "staging"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "TTL removed")
+		assert.Contains(t, buf.String(), "staging")
+	})
+
+	unsetCronJob := func() *batchv1.CronJob {
+		return &batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-4a0c226a-ttl",
+				Namespace: "default",
+				Labels: map[string]string{
+					ttl.LabelManagedBy: ttl.LabelManagedByValue,
+					ttl.LabelRelease:   "myapp",
+				},
+			},
+			Spec: batchv1.CronJobSpec{Schedule: "30 14 15 6 *"},
+		}
+	}
+
+	t.Run("refuses an orphaned TTL", func(t *testing.T) {
+		client := fake.NewClientset(unsetCronJob())
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "other", "default")), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"unset", "myapp"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `release "myapp" not found in namespace "default": its TTL points at nothing; pass --orphans-ok`)
+
+		_, err = client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("orphans-ok", func(t *testing.T) {
+		client := fake.NewClientset(unsetCronJob())
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "other", "default")), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"unset", "myapp", "--orphans-ok"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "TTL removed")
+	})
+
+	t.Run("installed release", func(t *testing.T) {
+		client := fake.NewClientset(unsetCronJob())
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"unset", "myapp"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "TTL removed")
+	})
+
+	t.Run("declined at the prompt", func(t *testing.T) {
+		fakeTerminal(t)
+		client := fake.NewClientset(unsetCronJob())
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetIn(strings.NewReader("n\n"))
+		cmd.SetArgs([]string{"unset", "myapp"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "aborted")
+		assert.Contains(t, buf.String(), `Remove the TTL of release "myapp" in namespace "default"? [y/N]`)
+
+		_, err = client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("yes skips the prompt", func(t *testing.T) {
+		fakeTerminal(t)
+		client := fake.NewClientset(unsetCronJob())
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetIn(strings.NewReader(""))
+		cmd.SetArgs([]string{"unset", "myapp", "--yes"})
+
+		require.NoError(t, cmd.Execute())
+		assert.NotContains(t, buf.String(), "[y/N]")
+		assert.Contains(t, buf.String(), "TTL removed")
+	})
+
+	t.Run("all with selector", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "cart"), extendTestCronJob(t, "search"))
+
+		cmd := newRootCmd(labeledStore(t), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"unset", "--all", "-l", "team=checkout"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "cart")
+		assert.NotContains(t, buf.String(), "search")
+		assert.Contains(t, buf.String(), "Removed 1 of 1 TTLs")
+
+		_, err := client.BatchV1().CronJobs("default").Get(context.Background(), "search-81bd4a47-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("all with failures", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "cart"), extendTestCronJob(t, "search"))
+		client.PrependReactor("delete", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.(k8stesting.DeleteAction).GetName() == "cart-589dfa7a-ttl" {
+				return true, nil, errors.New("forbidden")
+			}
+
+			return false, nil, nil
+		})
+
+		cmd := newRootCmd(labeledStore(t), testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"unset", "--all", "-o", "json"})
+
+		err := cmd.Execute()
+		assert.ErrorContains(t, err, "failed to remove 1 of 2 TTLs")
+		assert.Contains(t, buf.String(), `"error"`)
+	})
+
+	t.Run("all reports to statsd", func(t *testing.T) {
+		read := statsdServer(t)
+
+		cmd := newRootCmd(labeledStore(t), testKubeFactoryWithClient(fake.NewClientset(extendTestCronJob(t, "cart"))))
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"unset", "--all", "--yes"})
+
+		require.NoError(t, cmd.Execute())
+		packets := read(2)
+		assert.Regexp(t, `^helm_ttl\.unset\.duration:\d+\|ms\|#namespace:default,release:cart$`, packets[0])
+		assert.Equal(t, "helm_ttl.unset.removed:1|c|#namespace:default,release:cart", packets[1])
+	})
+
+	t.Run("argument validation", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"unset"},
+			{"unset", "--all", "myapp"},
+			{"unset", "myapp", "-l", "team=checkout"},
+		} {
+			cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+			cmd.SetOut(io.Discard)
+			cmd.SetErr(io.Discard)
+			cmd.SetArgs(args)
+
+			assert.Error(t, cmd.Execute(), args)
+		}
+	})
+
+	t.Run("output without all", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "myapp"))
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"unset", "myapp", "--yes", "-o", "json"})
+
+		assert.ErrorContains(t, cmd.Execute(), "--output requires --all")
+
+		_, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+}
+
+func TestCleanupRBACCmd(t *testing.T) {
+	origNs := os.Getenv("HELM_NAMESPACE")
+	defer func() { _ = os.Setenv("HELM_NAMESPACE", origNs) }()
+	_ = os.Setenv("HELM_NAMESPACE", "default")
+
+	t.Run("no orphans found", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "No orphaned resources found")
+	})
+
+	t.Run("finds CronJobs whose release is gone", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "cart"))
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac", "--dry-run"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Equal(t, "Would delete CronJob cart-589dfa7a-ttl in namespace default\n", buf.String())
+	})
+
+	t.Run("finds and deletes orphans", func(t *testing.T) {
+		labels := map[string]string{
+			ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+			ttl.LabelRelease:          "myapp",
+			ttl.LabelReleaseNamespace: "default",
+			ttl.LabelCronjobNamespace: "default",
+		}
+
+		client := fake.NewClientset(
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
+			},
+		)
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "Deleted")
+	})
+
+	t.Run("confirmation on a terminal", func(t *testing.T) {
+		orphan := func() *corev1.ServiceAccount {
+			return &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: map[string]string{
+					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+					ttl.LabelRelease:          "myapp",
+					ttl.LabelReleaseNamespace: "default",
+					ttl.LabelCronjobNamespace: "default",
+				}},
+			}
+		}
+
+		for answer, deleted := range map[string]bool{"n\n": false, "y\n": true} {
+			fakeTerminal(t)
+			client := fake.NewClientset(orphan())
+
+			cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+			var out, errBuf bytes.Buffer
+			cmd.SetOut(&out)
+			cmd.SetErr(&errBuf)
+			cmd.SetIn(strings.NewReader(answer))
+			cmd.SetArgs([]string{"cleanup-rbac"})
+
+			err := cmd.Execute()
+			assert.Contains(t, errBuf.String(), "Would delete ServiceAccount myapp-4a0c226a-ttl")
+			assert.Contains(t, errBuf.String(), "Delete these 1 resources? [y/N]")
+
+			_, getErr := client.CoreV1().ServiceAccounts("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+			if deleted {
+				require.NoError(t, err)
+				assert.Contains(t, out.String(), "Deleted")
+				assert.True(t, apierrors.IsNotFound(getErr))
+			} else {
+				assert.ErrorContains(t, err, "aborted")
+				assert.NoError(t, getErr)
+			}
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		labels := map[string]string{
+			ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+			ttl.LabelRelease:          "myapp",
+			ttl.LabelReleaseNamespace: "default",
+			ttl.LabelCronjobNamespace: "default",
+		}
+
+		client := fake.NewClientset(
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
+			},
+		)
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac", "--dry-run"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "Would delete")
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		client := fake.NewClientset(
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: map[string]string{
+					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+					ttl.LabelRelease:          "myapp",
+					ttl.LabelReleaseNamespace: "default",
+					ttl.LabelCronjobNamespace: "default",
+				}},
+			},
+		)
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac", "--dry-run", "-o", "json"})
+
+		require.NoError(t, cmd.Execute())
+
+		var orphaned []ttl.OrphanedResource
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &orphaned))
+		assert.Equal(t, []ttl.OrphanedResource{{Kind: "ServiceAccount", Name: "myapp-4a0c226a-ttl", Namespace: "default"}}, orphaned)
+	})
+
+	t.Run("invalid output format", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac", "-o", "xml"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported output format")
+	})
+
+	t.Run("selector", func(t *testing.T) {
+		saFor := func(release string) *corev1.ServiceAccount {
+			return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Name:      ttl.ResourceName(release, "default"),
+				Namespace: "default",
+				Labels: map[string]string{
+					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+					ttl.LabelRelease:          release,
+					ttl.LabelReleaseNamespace: "default",
+					ttl.LabelCronjobNamespace: "default",
+				},
+			}}
+		}
+
+		client := fake.NewClientset(saFor("myapp"), saFor("other"))
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac", "-l", "helm-ttl/release=myapp"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Equal(t, "Deleted ServiceAccount myapp-4a0c226a-ttl in namespace default\n", buf.String())
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac", "--selector", "=="})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid label selector")
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac", "-A", "--concurrency", "2"})
+		require.NoError(t, cmd.Execute())
+
+		cmd = newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac", "--concurrency", "0"})
+		assert.EqualError(t, cmd.Execute(), "invalid --concurrency 0: must be positive")
+	})
+
+	t.Run("several namespaces and older than", func(t *testing.T) {
+		saIn := func(namespace string, age time.Duration) *corev1.ServiceAccount {
+			return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Name:      ttl.ResourceName("myapp", namespace),
+				Namespace: namespace,
 				Labels: map[string]string{
 					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
 					ttl.LabelRelease:          "myapp",
-					ttl.LabelReleaseNamespace: "staging",
-					ttl.LabelCronjobNamespace: "ops",
-					ttl.LabelDeleteNamespace:  "true",
+					ttl.LabelReleaseNamespace: namespace,
 				},
-			},
-			Spec: batchv1.CronJobSpec{
-				Schedule: "0 12 1 1 *",
-			},
-		})
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			}}
+		}
+		client := fake.NewClientset(saIn("staging", 48*time.Hour), saIn("preview", time.Minute), saIn("qa", 48*time.Hour), saIn("default", 48*time.Hour))
 
 		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"get", "myapp", "--cronjob-namespace", "ops"})
+		cmd.SetArgs([]string{"cleanup-rbac", "--dry-run", "-n", "staging,preview", "--namespace", "qa", "--older-than", "24h"})
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "in namespace staging")
+		assert.Contains(t, buf.String(), "in namespace qa")
+		assert.NotContains(t, buf.String(), "preview")
+		assert.NotContains(t, buf.String(), "in namespace default")
+
+		cmd = newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac", "--older-than", "-1h"})
+		assert.EqualError(t, cmd.Execute(), "invalid --older-than -1h0m0s: must not be negative")
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"cleanup-rbac"})
 
 		err := cmd.Execute()
-		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "staging")
-		assert.Contains(t, buf.String(), "ops")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "kubernetes client")
+	})
+
+	t.Run("rejects extra args", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		cmd.SetArgs([]string{"cleanup-rbac", "extra"})
+		err := cmd.Execute()
+		assert.Error(t, err)
 	})
 
 	t.Run("namespace flag overrides env", func(t *testing.T) {
-		client := fake.NewClientset(&batchv1.CronJob{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-staging-ttl",
-				Namespace: "staging",
-				Labels: map[string]string{
-					ttl.LabelManagedBy:        ttl.LabelManagedByValue,
-					ttl.LabelRelease:          "myapp",
-					ttl.LabelReleaseNamespace: "staging",
-					ttl.LabelCronjobNamespace: "staging",
-					ttl.LabelDeleteNamespace:  "false",
-				},
-			},
-			Spec: batchv1.CronJobSpec{
-				Schedule: "30 14 15 3 *",
+		labels := map[string]string{
+			ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+			ttl.LabelRelease:          "myapp",
+			ttl.LabelReleaseNamespace: "staging",
+			ttl.LabelCronjobNamespace: "staging",
+		}
+
+		client := fake.NewClientset(
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Namespace: "staging", Labels: labels},
 			},
-		})
+		)
 
 		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"get", "myapp", "--namespace", "staging"})
+		cmd.SetArgs([]string{"cleanup-rbac", "--namespace", "staging"})
 
 		err := cmd.Execute()
 		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "staging")
+		assert.Contains(t, buf.String(), "Deleted")
 	})
 }
 
-func TestUnsetCmd(t *testing.T) {
+func TestRunCmd(t *testing.T) {
 	origNs := os.Getenv("HELM_NAMESPACE")
 	defer func() { _ = os.Setenv("HELM_NAMESPACE", origNs) }()
 	_ = os.Setenv("HELM_NAMESPACE", "default")
 
-	t.Run("unset existing TTL", func(t *testing.T) {
-		client := fake.NewClientset(&batchv1.CronJob{
+	// The release is already gone unless a test stores it
+	noReleases := testConfigFactory(storage.Init(driver.NewMemory()))
+
+	buildCronJob := func(t *testing.T, releaseName, releaseNamespace, cronjobNamespace string) *batchv1.CronJob {
+		t.Helper()
+		cj, err := ttl.BuildCronJob(ttl.CronJobOptions{
+			ReleaseName:      releaseName,
+			ReleaseNamespace: releaseNamespace,
+			CronjobNamespace: cronjobNamespace,
+			Schedule:         "30 14 15 3 *",
+			ServiceAccount:   "default",
+			HelmImage:        "alpine/helm:3.14",
+			KubectlImage:     "alpine/k8s:1.29",
+		})
+		require.NoError(t, err)
+		return cj
+	}
+
+	completedPod := func(namespace, jobName string) *corev1.Pod {
+		return &corev1.Pod{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-default-ttl",
-				Namespace: "default",
-				Labels: map[string]string{
-					ttl.LabelManagedBy: ttl.LabelManagedByValue,
-					ttl.LabelRelease:   "myapp",
+				Name:      jobName + "-pod",
+				Namespace: namespace,
+				Labels:    map[string]string{"job-name": jobName},
+			},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{
+					{Name: "helm-uninstall"},
+				},
+				Containers: []corev1.Container{
+					{Name: "self-cleanup"},
 				},
 			},
-			Spec: batchv1.CronJobSpec{
-				Schedule: "30 14 15 6 *",
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "helm-uninstall",
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{ExitCode: 0},
+						},
+					},
+				},
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "self-cleanup",
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{ExitCode: 0},
+						},
+					},
+				},
 			},
-		})
+		}
+	}
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+	t.Run("run TTL happy path", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		pod := completedPod("default", "myapp-4a0c226a-ttl-run")
+		client := fake.NewClientset(cj, pod)
+
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"unset", "myapp"})
+		cmd.SetArgs([]string{"run", "myapp"})
 
 		err := cmd.Execute()
 		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "TTL removed")
+		assert.Contains(t, buf.String(), "TTL executed")
+		assert.Contains(t, buf.String(), "myapp")
 	})
 
-	t.Run("unset TTL not found", func(t *testing.T) {
-		client := fake.NewClientset()
+	t.Run("protected release", func(t *testing.T) {
+		store := setupTestStore(t, "myapp", "default")
+		rel, err := store.Last("myapp")
+		require.NoError(t, err)
+		rel.Labels = map[string]string{ttl.LabelProtected: "true"}
+		require.NoError(t, store.Update(rel))
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cj := buildCronJob(t, "myapp", "default", "default")
+		client := fake.NewClientset(cj)
+
+		cmd := newRootCmd(testConfigFactory(store), testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"unset", "myapp"})
+		cmd.SetArgs([]string{"run", "myapp"})
+
+		err = cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `release "myapp" is protected`)
+
+		jobs, err := client.BatchV1().Jobs("default").List(context.Background(), metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, jobs.Items)
+	})
+
+	t.Run("protected namespace forced", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		pod := completedPod("default", "myapp-4a0c226a-ttl-run")
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "default",
+			Annotations: map[string]string{ttl.LabelProtected: "true"},
+		}}
+		client := fake.NewClientset(cj, pod, ns)
+
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"run", "myapp"})
 
 		err := cmd.Execute()
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "no TTL set")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `namespace "default" is protected`)
+
+		cmd.SetArgs([]string{"run", "myapp", "--force"})
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "TTL executed")
 	})
 
-	t.Run("kube client error", func(t *testing.T) {
-		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+	t.Run("config error", func(t *testing.T) {
+		cmd := newRootCmd(errorConfigFactory(), testKubeFactoryWithClient(fake.NewClientset()))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"unset", "myapp"})
+		cmd.SetArgs([]string{"run", "myapp"})
 
 		err := cmd.Execute()
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "kubernetes client")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create configuration")
 	})
 
-	t.Run("namespace flag overrides env", func(t *testing.T) {
-		client := fake.NewClientset(&batchv1.CronJob{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-staging-ttl",
-				Namespace: "staging",
-				Labels: map[string]string{
-					ttl.LabelManagedBy: ttl.LabelManagedByValue,
-					ttl.LabelRelease:   "myapp",
-				},
-			},
-			Spec: batchv1.CronJobSpec{
-				Schedule: "30 14 15 6 *",
-			},
-		})
+	t.Run("release lookup error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"run", "myapp", "--kubeconfig", filepath.Join(t.TempDir(), "missing")})
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `failed to get release "myapp"`)
+	})
+
+	t.Run("declined at the prompt", func(t *testing.T) {
+		fakeTerminal(t)
+		cj := buildCronJob(t, "myapp", "default", "default")
+		client := fake.NewClientset(cj)
+
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"unset", "myapp", "--namespace", "staging"})
+		cmd.SetIn(strings.NewReader("n\n"))
+		cmd.SetArgs([]string{"run", "myapp"})
 
 		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "aborted")
+		assert.Contains(t, buf.String(), `Uninstall release "myapp" in namespace "default" now? [y/N]`)
+
+		jobs, err := client.BatchV1().Jobs("default").List(context.Background(), metav1.ListOptions{})
 		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "TTL removed")
-		assert.Contains(t, buf.String(), "staging")
+		assert.Empty(t, jobs.Items)
 	})
-}
-
-func TestCleanupRBACCmd(t *testing.T) {
-	origNs := os.Getenv("HELM_NAMESPACE")
-	defer func() { _ = os.Setenv("HELM_NAMESPACE", origNs) }()
-	_ = os.Setenv("HELM_NAMESPACE", "default")
 
-	t.Run("no orphans found", func(t *testing.T) {
-		client := fake.NewClientset()
+	t.Run("confirmed at the prompt", func(t *testing.T) {
+		fakeTerminal(t)
+		cj := buildCronJob(t, "myapp", "default", "default")
+		pod := completedPod("default", "myapp-4a0c226a-ttl-run")
+		client := fake.NewClientset(cj, pod)
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"cleanup-rbac"})
+		cmd.SetIn(strings.NewReader("y\n"))
+		cmd.SetArgs([]string{"run", "myapp"})
 
 		err := cmd.Execute()
 		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "No orphaned resources found")
+		assert.Contains(t, buf.String(), "TTL executed")
 	})
 
-	t.Run("finds and deletes orphans", func(t *testing.T) {
-		labels := map[string]string{
-			ttl.LabelManagedBy:        ttl.LabelManagedByValue,
-			ttl.LabelRelease:          "myapp",
-			ttl.LabelReleaseNamespace: "default",
-			ttl.LabelCronjobNamespace: "default",
-		}
+	t.Run("yes skips the prompt", func(t *testing.T) {
+		fakeTerminal(t)
+		cj := buildCronJob(t, "myapp", "default", "default")
+		pod := completedPod("default", "myapp-4a0c226a-ttl-run")
+		client := fake.NewClientset(cj, pod)
 
-		client := fake.NewClientset(
-			&corev1.ServiceAccount{
-				ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
-			},
-		)
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetIn(strings.NewReader(""))
+		cmd.SetArgs([]string{"run", "myapp", "-y"})
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.NotContains(t, buf.String(), "[y/N]")
+		assert.Contains(t, buf.String(), "TTL executed")
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		client := fake.NewClientset(cj)
+
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"cleanup-rbac"})
+		cmd.SetArgs([]string{"run", "myapp", "--dry-run"})
+
+		err := cmd.Execute()
+		require.NoError(t, err)
+		assert.Contains(t, buf.String(), "Uninstall Command: helm uninstall myapp --namespace default")
+		assert.Contains(t, buf.String(), "Delete Namespace:  no")
+		assert.Contains(t, buf.String(), "kind: Job")
+		assert.NotContains(t, buf.String(), "TTL executed")
+
+		jobs, err := client.BatchV1().Jobs("default").List(context.Background(), metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, jobs.Items)
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		pod := completedPod("default", "myapp-4a0c226a-ttl-run")
+		client := fake.NewClientset(cj, pod)
+
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
+		var stdout, stderr bytes.Buffer
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&stderr)
+		cmd.SetArgs([]string{"run", "myapp", "-o", "json"})
+
+		require.NoError(t, cmd.Execute())
+
+		var result ttl.RunTTLResult
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+		assert.Equal(t, "myapp", result.ReleaseName)
+		assert.False(t, result.JobFailed)
+		assert.Contains(t, stderr.String(), "==> Container:")
+	})
+
+	t.Run("porcelain", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		pod := completedPod("default", "myapp-4a0c226a-ttl-run")
+		client := fake.NewClientset(cj, pod)
+
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
+		var stdout, stderr bytes.Buffer
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&stderr)
+		cmd.SetArgs([]string{"run", "myapp", "--porcelain"})
 
-		err := cmd.Execute()
-		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "Deleted")
-	})
+		require.NoError(t, cmd.Execute())
 
-	t.Run("dry run", func(t *testing.T) {
-		labels := map[string]string{
-			ttl.LabelManagedBy:        ttl.LabelManagedByValue,
-			ttl.LabelRelease:          "myapp",
-			ttl.LabelReleaseNamespace: "default",
-			ttl.LabelCronjobNamespace: "default",
-		}
+		var result ttl.RunTTLResult
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+		assert.Equal(t, "myapp", result.ReleaseName)
+		assert.Contains(t, stderr.String(), "==> Container:")
+	})
 
-		client := fake.NewClientset(
-			&corev1.ServiceAccount{
-				ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
-			},
-		)
+	t.Run("porcelain with yaml output", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		client := fake.NewClientset(cj)
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
-		var buf bytes.Buffer
-		cmd.SetOut(&buf)
-		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"cleanup-rbac", "--dry-run"})
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
+		var stdout bytes.Buffer
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"run", "myapp", "--dry-run", "--porcelain", "-o", "yaml"})
 
-		err := cmd.Execute()
-		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "Would delete")
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, stdout.String(), "dry_run: true")
 	})
 
-	t.Run("kube client error", func(t *testing.T) {
-		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
-		var buf bytes.Buffer
-		cmd.SetOut(&buf)
-		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"cleanup-rbac"})
+	t.Run("porcelain with text output", func(t *testing.T) {
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(fake.NewClientset()))
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"run", "myapp", "--porcelain", "-o", "text"})
 
 		err := cmd.Execute()
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "kubernetes client")
+		assert.EqualError(t, err, "--porcelain requires a structured --output, not text")
 	})
 
-	t.Run("rejects extra args", func(t *testing.T) {
-		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
-		cmd.SetArgs([]string{"cleanup-rbac", "extra"})
+	t.Run("porcelain after a timeout", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		client := fake.NewClientset(cj)
+
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
+		var stdout bytes.Buffer
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"run", "myapp", "--porcelain", "--yes", "--timeout", "100ms"})
+
 		err := cmd.Execute()
-		assert.Error(t, err)
-	})
+		assert.ErrorContains(t, err, "timed out waiting for pod")
+		assert.ErrorContains(t, err, "(raise --timeout to wait longer)")
 
-	t.Run("namespace flag overrides env", func(t *testing.T) {
-		labels := map[string]string{
-			ttl.LabelManagedBy:        ttl.LabelManagedByValue,
-			ttl.LabelRelease:          "myapp",
-			ttl.LabelReleaseNamespace: "staging",
-			ttl.LabelCronjobNamespace: "staging",
-		}
+		// Only the partial result reaches stdout, without usage
+		var result ttl.RunTTLResult
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+		assert.Equal(t, "myapp", result.ReleaseName)
+	})
 
-		client := fake.NewClientset(
-			&corev1.ServiceAccount{
-				ObjectMeta: metav1.ObjectMeta{Name: "myapp-staging-ttl", Namespace: "staging", Labels: labels},
-			},
-		)
+	t.Run("yaml output of a dry run", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		client := fake.NewClientset(cj)
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"cleanup-rbac", "--namespace", "staging"})
+		cmd.SetArgs([]string{"run", "myapp", "--dry-run", "-o", "yaml"})
 
-		err := cmd.Execute()
-		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "Deleted")
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "dry_run: true")
+		assert.Contains(t, buf.String(), "kind: Job")
 	})
-}
-
-func TestRunCmd(t *testing.T) {
-	origNs := os.Getenv("HELM_NAMESPACE")
-	defer func() { _ = os.Setenv("HELM_NAMESPACE", origNs) }()
-	_ = os.Setenv("HELM_NAMESPACE", "default")
-
-	buildCronJob := func(t *testing.T, releaseName, releaseNamespace, cronjobNamespace string) *batchv1.CronJob {
-		t.Helper()
-		cj, err := ttl.BuildCronJob(ttl.CronJobOptions{
-			ReleaseName:      releaseName,
-			ReleaseNamespace: releaseNamespace,
-			CronjobNamespace: cronjobNamespace,
-			Schedule:         "30 14 15 3 *",
-			ServiceAccount:   "default",
-			HelmImage:        "alpine/helm:3.14",
-			KubectlImage:     "alpine/k8s:1.29",
-		})
-		require.NoError(t, err)
-		return cj
-	}
-
-	completedPod := func(namespace, jobName string) *corev1.Pod {
-		return &corev1.Pod{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      jobName + "-pod",
-				Namespace: namespace,
-				Labels:    map[string]string{"job-name": jobName},
-			},
-			Spec: corev1.PodSpec{
-				InitContainers: []corev1.Container{
-					{Name: "helm-uninstall"},
-				},
-				Containers: []corev1.Container{
-					{Name: "self-cleanup"},
-				},
-			},
-			Status: corev1.PodStatus{
-				InitContainerStatuses: []corev1.ContainerStatus{
-					{
-						Name: "helm-uninstall",
-						State: corev1.ContainerState{
-							Terminated: &corev1.ContainerStateTerminated{ExitCode: 0},
-						},
-					},
-				},
-				ContainerStatuses: []corev1.ContainerStatus{
-					{
-						Name: "self-cleanup",
-						State: corev1.ContainerState{
-							Terminated: &corev1.ContainerStateTerminated{ExitCode: 0},
-						},
-					},
-				},
-			},
-		}
-	}
 
-	t.Run("run TTL happy path", func(t *testing.T) {
+	t.Run("invalid output format", func(t *testing.T) {
 		cj := buildCronJob(t, "myapp", "default", "default")
-		pod := completedPod("default", "myapp-default-ttl-run")
-		client := fake.NewClientset(cj, pod)
+		client := fake.NewClientset(cj)
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
-		cmd.SetArgs([]string{"run", "myapp"})
+		cmd.SetArgs([]string{"run", "myapp", "-o", "xml"})
 
 		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported output format")
+
+		jobs, err := client.BatchV1().Jobs("default").List(context.Background(), metav1.ListOptions{})
 		require.NoError(t, err)
-		assert.Contains(t, buf.String(), "TTL executed")
-		assert.Contains(t, buf.String(), "myapp")
+		assert.Empty(t, jobs.Items)
 	})
 
 	t.Run("TTL not found", func(t *testing.T) {
 		client := fake.NewClientset()
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
@@ -796,10 +2687,10 @@ func TestRunCmd(t *testing.T) {
 		defer func() { _ = os.Setenv("HELM_NAMESPACE", "default") }()
 
 		cj := buildCronJob(t, "myapp", "staging", "ops")
-		pod := completedPod("ops", "myapp-staging-ttl-run")
+		pod := completedPod("ops", "myapp-80081014-ttl-run")
 		client := fake.NewClientset(cj, pod)
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
@@ -812,10 +2703,10 @@ func TestRunCmd(t *testing.T) {
 
 	t.Run("namespace flag overrides env", func(t *testing.T) {
 		cj := buildCronJob(t, "myapp", "staging", "staging")
-		pod := completedPod("staging", "myapp-staging-ttl-run")
+		pod := completedPod("staging", "myapp-80081014-ttl-run")
 		client := fake.NewClientset(cj, pod)
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
@@ -829,10 +2720,10 @@ func TestRunCmd(t *testing.T) {
 
 	t.Run("timeout flag", func(t *testing.T) {
 		cj := buildCronJob(t, "myapp", "default", "default")
-		pod := completedPod("default", "myapp-default-ttl-run")
+		pod := completedPod("default", "myapp-4a0c226a-ttl-run")
 		client := fake.NewClientset(cj, pod)
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
 		var buf bytes.Buffer
 		cmd.SetOut(&buf)
 		cmd.SetErr(&buf)
@@ -843,13 +2734,122 @@ func TestRunCmd(t *testing.T) {
 		assert.Contains(t, buf.String(), "TTL executed")
 	})
 
+	failedPod := func(namespace, jobName string) *corev1.Pod {
+		pod := completedPod(namespace, jobName)
+		pod.Status.InitContainerStatuses[0].State.Terminated.ExitCode = 1
+		pod.Spec.Containers = nil
+		pod.Status.ContainerStatuses = nil
+		return pod
+	}
+
+	t.Run("failed run keeps the CronJob and RBAC", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		client := fake.NewClientset(cj, failedPod("default", "myapp-4a0c226a-ttl-run"))
+
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"run", "myapp"})
+
+		require.Error(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "Kept the TTL's CronJob and RBAC resources")
+		assert.Contains(t, buf.String(), "helm ttl unset myapp --namespace default")
+
+		_, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("keep flags disabled", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		client := fake.NewClientset(cj, failedPod("default", "myapp-4a0c226a-ttl-run"))
+
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"run", "myapp", "--keep-cronjob=false", "--keep-rbac=false"})
+
+		require.Error(t, cmd.Execute())
+		assert.NotContains(t, buf.String(), "Kept the TTL's")
+
+		_, err := client.BatchV1().CronJobs("default").Get(context.Background(), "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("timeout and poll interval defaults", func(t *testing.T) {
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(fake.NewClientset()))
+		run, _, err := cmd.Find([]string{"run"})
+		require.NoError(t, err)
+		assert.Equal(t, "10m0s", run.Flags().Lookup("timeout").DefValue)
+		assert.Equal(t, "1s", run.Flags().Lookup("poll-interval").DefValue)
+		assert.Equal(t, "[istio-proxy,linkerd-proxy]", run.Flags().Lookup("sidecar-container").DefValue)
+		assert.Equal(t, "true", run.Flags().Lookup("keep-rbac").DefValue)
+		assert.Equal(t, "true", run.Flags().Lookup("keep-cronjob").DefValue)
+	})
+
+	t.Run("sidecar container flag", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		pod := completedPod("default", "myapp-4a0c226a-ttl-run")
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "envoy"})
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+			Name:  "envoy",
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+		})
+		client := fake.NewClientset(cj, pod)
+
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"run", "myapp", "--yes", "--sidecar-container", "envoy", "--timeout", "5s"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "TTL executed")
+	})
+
+	t.Run("poll interval flag", func(t *testing.T) {
+		cj := buildCronJob(t, "myapp", "default", "default")
+		client := fake.NewClientset(cj)
+		client.PrependWatchReactor("pods", func(_ k8stesting.Action) (bool, watch.Interface, error) {
+			return true, nil, errors.New("forbidden")
+		})
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_, _ = client.CoreV1().Pods("default").Create(context.Background(), completedPod("default", "myapp-4a0c226a-ttl-run"), metav1.CreateOptions{})
+		}()
+
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"run", "myapp", "--yes", "--poll-interval", "10ms", "--timeout", "900ms"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "TTL executed")
+	})
+
+	t.Run("invalid timeout and poll interval", func(t *testing.T) {
+		for args, want := range map[string]string{
+			"--timeout=0":         "invalid --timeout 0s: must be positive",
+			"--poll-interval=-1s": "invalid --poll-interval -1s: must be positive",
+		} {
+			cmd := newRootCmd(noReleases, testKubeFactoryWithClient(fake.NewClientset()))
+			cmd.SetOut(&bytes.Buffer{})
+			cmd.SetErr(&bytes.Buffer{})
+			cmd.SetArgs([]string{"run", "myapp", "--yes", args})
+
+			assert.EqualError(t, cmd.Execute(), want)
+		}
+	})
+
 	t.Run("container failure prints exit codes", func(t *testing.T) {
 		cj := buildCronJob(t, "myapp", "default", "default")
 		failedPod := &corev1.Pod{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-default-ttl-run-pod",
+				Name:      "myapp-4a0c226a-ttl-run-pod",
 				Namespace: "default",
-				Labels:    map[string]string{"job-name": "myapp-default-ttl-run"},
+				Labels:    map[string]string{"job-name": "myapp-4a0c226a-ttl-run"},
 			},
 			Spec: corev1.PodSpec{
 				InitContainers: []corev1.Container{
@@ -880,7 +2880,7 @@ func TestRunCmd(t *testing.T) {
 		}
 		client := fake.NewClientset(cj, failedPod)
 
-		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		cmd := newRootCmd(noReleases, testKubeFactoryWithClient(client))
 		var stdout, stderr bytes.Buffer
 		cmd.SetOut(&stdout)
 		cmd.SetErr(&stderr)
@@ -889,6 +2889,24 @@ func TestRunCmd(t *testing.T) {
 		err := cmd.Execute()
 		assert.Error(t, err)
 		assert.Contains(t, stderr.String(), "exited with code")
+
+		// A structured result is still printed for scripts to inspect
+		client = fake.NewClientset(cj, failedPod)
+		cmd = newRootCmd(noReleases, testKubeFactoryWithClient(client))
+		stdout.Reset()
+		stderr.Reset()
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&stderr)
+		cmd.SetArgs([]string{"run", "myapp", "-o", "json"})
+
+		err = cmd.Execute()
+		assert.Error(t, err)
+
+		// cobra prints usage after the result on error
+		var result ttl.RunTTLResult
+		require.NoError(t, json.NewDecoder(&stdout).Decode(&result))
+		assert.True(t, result.JobFailed)
+		assert.Contains(t, stderr.String(), "==> Container: helm-uninstall <==")
 	})
 }
 
@@ -927,17 +2945,130 @@ func TestGetNamespace(t *testing.T) {
 	})
 }
 
+func TestDebugFlag(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	execute := func(args ...string) (string, string) {
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), testKubeFactoryWithClient(fake.NewClientset()))
+		var out, errOut bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(&errOut)
+		cmd.SetArgs(args)
+
+		require.NoError(t, cmd.Execute())
+		return out.String(), errOut.String()
+	}
+
+	t.Run("logs to stderr", func(t *testing.T) {
+		t.Setenv("HELM_DEBUG", "")
+		out, errOut := execute("set", "myapp", "24h", "--create-service-account", "-v")
+		assert.Contains(t, errOut, `msg="parsed duration" release=myapp input=24h`)
+		assert.Contains(t, errOut, `msg="built CronJob"`)
+		assert.NotContains(t, out, "parsed duration")
+
+		// The next command without the flag is quiet again
+		_, errOut = execute("images")
+		assert.Empty(t, errOut)
+	})
+
+	t.Run("HELM_DEBUG", func(t *testing.T) {
+		t.Setenv("HELM_DEBUG", "true")
+		_, errOut := execute("set", "myapp", "24h", "--create-service-account")
+		assert.Contains(t, errOut, `msg="parsed duration"`)
+
+		_, errOut = execute("set", "myapp", "24h", "--create-service-account", "--debug=false")
+		assert.Empty(t, errOut)
+	})
+}
+
 func TestGlobalFlagsKubeOptions(t *testing.T) {
 	gf := &globalFlags{
 		kubeCtx:    "my-context",
 		kubeconfig: "/path/to/kubeconfig",
+		asUser:     "jane",
+		asGroups:   []string{"developers"},
+		apiServer:  "https://10.0.0.1:6443",
+		caFile:     "/etc/ssl/proxy-ca.crt",
+		insecure:   true,
+		burstLimit: 300,
+		qps:        75,
+		timeout:    30 * time.Second,
 		helmDriver: "memory",
 	}
 
 	opts := gf.kubeOptions()
 	assert.Equal(t, "my-context", opts.KubeContext)
 	assert.Equal(t, "/path/to/kubeconfig", opts.Kubeconfig)
+	assert.Equal(t, "jane", opts.AsUser)
+	assert.Equal(t, []string{"developers"}, opts.AsGroups)
 	assert.Equal(t, "memory", opts.Driver)
+	assert.Equal(t, "https://10.0.0.1:6443", opts.APIServer)
+	assert.Equal(t, "/etc/ssl/proxy-ca.crt", opts.CAFile)
+	assert.True(t, opts.InsecureSkipTLSVerify)
+	assert.Equal(t, 300, opts.BurstLimit)
+	assert.Equal(t, float32(75), opts.QPS)
+	assert.Equal(t, 30*time.Second, opts.Timeout)
+}
+
+func TestTimeoutFlag(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+	t.Setenv("KUBECONFIG", "")
+	t.Setenv("HELM_KUBEAPISERVER", "")
+
+	t.Run("bounds the command context", func(t *testing.T) {
+		var deadline time.Time
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		cmd.AddCommand(&cobra.Command{Use: "probe", RunE: func(cmd *cobra.Command, _ []string) error {
+			deadline, _ = cmd.Context().Deadline()
+			return nil
+		}})
+		cmd.SetArgs([]string{"probe", "--timeout", "1m"})
+
+		require.NoError(t, cmd.Execute())
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+	})
+
+	t.Run("released with the root context when the command fails", func(t *testing.T) {
+		var probeCtx context.Context
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(fake.NewClientset()))
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.AddCommand(&cobra.Command{Use: "probe", RunE: func(cmd *cobra.Command, _ []string) error {
+			probeCtx = cmd.Context()
+			return errors.New("boom")
+		}})
+		cmd.SetArgs([]string{"probe", "--timeout", "1m"})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		require.Error(t, cmd.ExecuteContext(ctx))
+		require.NoError(t, probeCtx.Err())
+
+		cancel()
+		assert.ErrorIs(t, probeCtx.Err(), context.Canceled)
+	})
+
+	t.Run("gives up on an API server that does not answer", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		defer server.Close()
+		defer close(release)
+
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"list", "--kube-apiserver", server.URL, "--timeout", "200ms"})
+
+		started := time.Now()
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Less(t, time.Since(started), 10*time.Second)
+	})
 }
 
 func TestNewFlagsPassedToFactories(t *testing.T) {
@@ -989,6 +3120,62 @@ func TestNewFlagsPassedToFactories(t *testing.T) {
 		assert.Equal(t, "/my/kubeconfig", capturedOpts.Kubeconfig)
 	})
 
+	t.Run("as and as-group flags are passed through", func(t *testing.T) {
+		var capturedOpts ttl.KubeOptions
+		kubeFactory := func(opts ttl.KubeOptions) (kubernetes.Interface, error) {
+			capturedOpts = opts
+			return fake.NewClientset(), nil
+		}
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), kubeFactory)
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"list", "--as", "jane", "--as-group", "developers", "--as-group", "qa"})
+
+		_ = cmd.Execute()
+		assert.Equal(t, "jane", capturedOpts.AsUser)
+		assert.Equal(t, []string{"developers", "qa"}, capturedOpts.AsGroups)
+	})
+
+	t.Run("kube connection flags are passed through", func(t *testing.T) {
+		var capturedOpts ttl.KubeOptions
+		kubeFactory := func(opts ttl.KubeOptions) (kubernetes.Interface, error) {
+			capturedOpts = opts
+			return fake.NewClientset(), nil
+		}
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), kubeFactory)
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"list", "--kube-apiserver", "https://10.0.0.1:6443", "--kube-ca-file", "/etc/ssl/proxy-ca.crt", "--kube-insecure-skip-tls-verify", "--burst-limit", "300", "--qps", "75"})
+
+		_ = cmd.Execute()
+		assert.Equal(t, "https://10.0.0.1:6443", capturedOpts.APIServer)
+		assert.Equal(t, "/etc/ssl/proxy-ca.crt", capturedOpts.CAFile)
+		assert.True(t, capturedOpts.InsecureSkipTLSVerify)
+		assert.Equal(t, 300, capturedOpts.BurstLimit)
+		assert.Equal(t, float32(75), capturedOpts.QPS)
+	})
+
+	t.Run("backend flag is passed through", func(t *testing.T) {
+		var capturedOpts ttl.KubeOptions
+		kubeFactory := func(opts ttl.KubeOptions) (kubernetes.Interface, error) {
+			capturedOpts = opts
+			return fake.NewClientset(), nil
+		}
+
+		cmd := newRootCmd(testConfigFactory(setupTestStore(t, "myapp", "default")), kubeFactory)
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"get", "myapp", "--backend", "job-sleep"})
+
+		_ = cmd.Execute()
+		assert.Equal(t, "job-sleep", capturedOpts.Backend)
+	})
+
 	t.Run("driver flag is passed through", func(t *testing.T) {
 		var capturedOpts ttl.KubeOptions
 		cfgFactory := func(_ string, opts ttl.KubeOptions) (*action.Configuration, error) {
@@ -1014,4 +3201,49 @@ func TestNewFlagsPassedToFactories(t *testing.T) {
 		_ = cmd.Execute()
 		assert.Equal(t, "memory", capturedOpts.Driver)
 	})
+
+	t.Run("every cluster command honors kube-context and kubeconfig", func(t *testing.T) {
+		commands := [][]string{
+			{"set", "myapp", "1h"},
+			{"get", "myapp"},
+			{"list"},
+			{"unset", "myapp"},
+			{"run", "myapp", "--yes"},
+			{"cleanup-rbac"},
+			{"describe", "myapp"},
+			{"history", "myapp"},
+			{"extend", "myapp", "1w"},
+			{"extend", "--all", "1w"},
+			{"check", "myapp"},
+			{"webhook", "serve", "--tls-cert-file", "tls.crt", "--tls-key-file", "tls.key"},
+			{"controller", "--dry-run"},
+		}
+
+		for _, args := range commands {
+			t.Run(strings.Join(args, " "), func(t *testing.T) {
+				var captured []ttl.KubeOptions
+				errFactory := errors.New("stop after the factory")
+				cfgFactory := func(_ string, opts ttl.KubeOptions) (*action.Configuration, error) {
+					captured = append(captured, opts)
+					return nil, errFactory
+				}
+				kubeFactory := func(opts ttl.KubeOptions) (kubernetes.Interface, error) {
+					captured = append(captured, opts)
+					return nil, errFactory
+				}
+
+				cmd := newRootCmd(cfgFactory, kubeFactory)
+				cmd.SetOut(io.Discard)
+				cmd.SetErr(io.Discard)
+				cmd.SetArgs(append(args, "--kube-context", "prod-eu", "--kubeconfig", "/clusters/prod"))
+
+				assert.ErrorIs(t, cmd.Execute(), errFactory)
+				require.NotEmpty(t, captured)
+				for _, opts := range captured {
+					assert.Equal(t, "prod-eu", opts.KubeContext)
+					assert.Equal(t, "/clusters/prod", opts.Kubeconfig)
+				}
+			})
+		}
+	})
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/notify"
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+)
+
+// newStatsd returns the statsd client bulk commands report to:
+// HELM_TTL_STATSD_ADDR, or metrics.statsdAddr in the plugin config. It is
+// nil, discarding everything, when neither is set.
+func newStatsd() (*notify.Statsd, error) {
+	cfg, err := loadPluginConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return notify.StatsdFromConfig(cfg.Metrics.StatsdAddr)
+}
+
+// reportUnsetMetrics sends the outcome and latency of each TTL removed
+// by unset --all to statsd, tagged with the release and its namespace.
+func reportUnsetMetrics(stats *notify.Statsd, results []ttl.UnsetResult) {
+	for _, r := range results {
+		tags := map[string]string{"release": r.ReleaseName, "namespace": r.ReleaseNamespace}
+		stats.Timing("unset.duration", time.Duration(r.DurationSeconds*float64(time.Second)), tags)
+
+		if r.Error != "" {
+			stats.Count("unset.errors", 1, tags)
+		} else {
+			stats.Count("unset.removed", 1, tags)
+		}
+	}
+}
+
+// reportRunMetrics sends the outcome and latency of a run to statsd,
+// tagged with the release, if any, and its namespace. Runs that never
+// created a Job are not reported.
+func reportRunMetrics(stats *notify.Statsd, result *ttl.RunTTLResult, err error) {
+	if result == nil || result.DryRun || result.StartedAt == "" {
+		return
+	}
+
+	tags := map[string]string{"namespace": result.ReleaseNamespace}
+	if result.ReleaseName != "" {
+		tags["release"] = result.ReleaseName
+	}
+	stats.Timing("run.duration", time.Duration(result.DurationSeconds*float64(time.Second)), tags)
+
+	if err != nil {
+		stats.Count("run.errors", 1, tags)
+	} else {
+		stats.Count("run.succeeded", 1, tags)
+	}
+}
+
+// reportCleanupMetrics sends the time a cleanup-rbac sweep took, the
+// resources it deleted by kind and namespace, and whether it failed.
+func reportCleanupMetrics(stats *notify.Statsd, took time.Duration, deleted []ttl.OrphanedResource, err error) {
+	stats.Timing("cleanup.duration", took, nil)
+
+	for _, r := range deleted {
+		tags := map[string]string{"kind": r.Kind}
+		if r.Namespace != "" {
+			tags["namespace"] = r.Namespace
+		}
+		stats.Count("cleanup.deleted", 1, tags)
+	}
+
+	if err != nil {
+		stats.Count("cleanup.errors", 1, nil)
+	}
+}
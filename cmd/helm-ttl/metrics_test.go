@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+)
+
+// statsdServer listens for statsd packets and points the plugin config at
+// it, returning a function that reads the next n packets.
+func statsdServer(t *testing.T) func(n int) []string {
+	t.Helper()
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Close() })
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("metrics:\n  statsdAddr: "+server.LocalAddr().String()+"\n"), 0o600))
+	t.Setenv("HELM_TTL_CONFIG", path)
+	t.Setenv("HELM_TTL_STATSD_ADDR", "")
+
+	return func(n int) []string {
+		t.Helper()
+
+		var packets []string
+		packet := make([]byte, 1024)
+		require.NoError(t, server.SetReadDeadline(time.Now().Add(5*time.Second)))
+		for range n {
+			size, _, err := server.ReadFrom(packet)
+			require.NoError(t, err)
+			packets = append(packets, string(packet[:size]))
+		}
+
+		return packets
+	}
+}
+
+func TestNewStatsd(t *testing.T) {
+	t.Run("nothing configured", func(t *testing.T) {
+		t.Setenv("HELM_TTL_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+		t.Setenv("HELM_TTL_STATSD_ADDR", "")
+
+		stats, err := newStatsd()
+		require.NoError(t, err)
+		assert.Nil(t, stats)
+	})
+
+	t.Run("invalid address in config", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("metrics:\n  statsdAddr: no-port\n"), 0o600))
+		t.Setenv("HELM_TTL_CONFIG", path)
+		t.Setenv("HELM_TTL_STATSD_ADDR", "")
+
+		_, err := newStatsd()
+		assert.ErrorContains(t, err, `statsdAddr: invalid statsd address "no-port"`)
+	})
+}
+
+func TestReportMetrics(t *testing.T) {
+	t.Run("unset", func(t *testing.T) {
+		read := statsdServer(t)
+		stats, err := newStatsd()
+		require.NoError(t, err)
+		defer func() { _ = stats.Close() }()
+
+		reportUnsetMetrics(stats, []ttl.UnsetResult{
+			{ReleaseName: "cart", ReleaseNamespace: "dev", DurationSeconds: 0.25},
+			{ReleaseName: "search", ReleaseNamespace: "dev", Error: "forbidden"},
+		})
+
+		assert.Equal(t, []string{
+			"helm_ttl.unset.duration:250|ms|#namespace:dev,release:cart",
+			"helm_ttl.unset.removed:1|c|#namespace:dev,release:cart",
+			"helm_ttl.unset.duration:0|ms|#namespace:dev,release:search",
+			"helm_ttl.unset.errors:1|c|#namespace:dev,release:search",
+		}, read(4))
+	})
+
+	t.Run("run", func(t *testing.T) {
+		read := statsdServer(t)
+		stats, err := newStatsd()
+		require.NoError(t, err)
+		defer func() { _ = stats.Close() }()
+
+		reportRunMetrics(stats, nil, errors.New("not found"))
+		reportRunMetrics(stats, &ttl.RunTTLResult{ReleaseName: "cart", ReleaseNamespace: "dev", DryRun: true}, nil)
+		reportRunMetrics(stats, &ttl.RunTTLResult{ReleaseName: "cart", ReleaseNamespace: "dev", StartedAt: "now", DurationSeconds: 2}, nil)
+		reportRunMetrics(stats, &ttl.RunTTLResult{ReleaseNamespace: "dev", NamespaceTTL: true, StartedAt: "now", DurationSeconds: 1}, errors.New("job failed"))
+
+		assert.Equal(t, []string{
+			"helm_ttl.run.duration:2000|ms|#namespace:dev,release:cart",
+			"helm_ttl.run.succeeded:1|c|#namespace:dev,release:cart",
+			"helm_ttl.run.duration:1000|ms|#namespace:dev",
+			"helm_ttl.run.errors:1|c|#namespace:dev",
+		}, read(4))
+	})
+
+	t.Run("cleanup", func(t *testing.T) {
+		read := statsdServer(t)
+		stats, err := newStatsd()
+		require.NoError(t, err)
+		defer func() { _ = stats.Close() }()
+
+		reportCleanupMetrics(stats, 1500*time.Millisecond, []ttl.OrphanedResource{
+			{Kind: "ServiceAccount", Name: "cart-ttl", Namespace: "dev"},
+			{Kind: "ClusterRole", Name: "cart-ttl"},
+		}, errors.New("forbidden"))
+
+		assert.Equal(t, []string{
+			"helm_ttl.cleanup.duration:1500|ms",
+			"helm_ttl.cleanup.deleted:1|c|#kind:ServiceAccount,namespace:dev",
+			"helm_ttl.cleanup.deleted:1|c|#kind:ClusterRole",
+			"helm_ttl.cleanup.errors:1|c",
+		}, read(4))
+	})
+}
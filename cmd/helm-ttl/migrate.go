@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newExportCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		cronjobNamespace string
+		allNamespaces    bool
+		file             string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export [flags]",
+		Short: "Write the TTLs of a cluster to a file",
+		Long: `Write every release and namespace TTL, with its expiry, its options and
+the ServiceAccount and RBAC created for it, to a YAML file that helm ttl
+import recreates them from in another cluster, e.g. when rebuilding an
+ephemeral cluster:
+
+  helm ttl export -A -f ttls.yaml --kube-context old
+  helm ttl import ttls.yaml --kube-context new
+
+Nothing in the cluster changes.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = gf.getNamespace()
+			}
+			if allNamespaces {
+				cjNs = ""
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			dump, err := ttl.DumpTTLs(cmd.Context(), client, cjNs)
+			if err != nil {
+				return err
+			}
+
+			out, err := ttl.FormatDump(dump)
+			if err != nil {
+				return err
+			}
+
+			if file == "-" {
+				_, _ = fmt.Fprint(cmd.OutOrStdout(), out)
+				return nil
+			}
+
+			if err := os.WriteFile(file, []byte(out), 0o600); err != nil {
+				return fmt.Errorf("failed to write %s: %w", file, err)
+			}
+			gf.printOutput(cmd, "text", fmt.Sprintf("Exported %d TTLs to %s\n", len(dump.TTLs), file))
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJobs live (default: current namespace)")
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "export the TTLs of all namespaces")
+	cmd.Flags().StringVarP(&file, "file", "f", "-", "file to write the TTLs to (- for stdout)")
+
+	return cmd
+}
+
+func newImportCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Recreate the TTLs written by helm ttl export",
+		Long: `Recreate the TTLs of a file written by helm ttl export (- for stdin) in
+the current cluster, with the same expiry, options, ServiceAccount and
+RBAC. An existing TTL of the same release is replaced. Edit expiresAt in
+the file to move an expiry.
+
+TTLs that have expired are skipped. Releases are only looked up to warn
+when they are missing, so migrate them before their TTLs. A summary table
+is printed, and the command fails if any TTL could not be imported.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+				return err
+			}
+
+			var (
+				data []byte
+				err  error
+			)
+			if args[0] == "-" {
+				data, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", args[0], err)
+			}
+
+			dump, err := ttl.ParseDump(data)
+			if err != nil {
+				return err
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			results := ttl.ImportTTLs(cmd.Context(), client, dump)
+
+			output, err := ttl.FormatImportResults(results, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			gf.printOutput(cmd, outputFormat, output)
+
+			failed := 0
+			for _, r := range results {
+				if r.Error != "" {
+					failed++
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("failed to import %d of %d TTLs", failed, len(results))
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+
+	return cmd
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestExportImportCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	cj, err := ttl.BuildCronJob(ttl.CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Schedule:         ttl.TimeToCronSchedule(time.Now().Add(48 * time.Hour)),
+		ServiceAccount:   "default",
+		ExpiresAt:        time.Now().Add(48 * time.Hour).Truncate(time.Minute),
+	})
+	require.NoError(t, err)
+
+	execute := func(client kubernetes.Interface, stdin string, args ...string) (string, error) {
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetIn(strings.NewReader(stdin))
+		cmd.SetArgs(args)
+
+		err := cmd.Execute()
+		return buf.String(), err
+	}
+
+	dump, err := execute(fake.NewClientset(cj), "", "export")
+	require.NoError(t, err)
+	assert.Contains(t, dump, "kind: TTLDump")
+	assert.Contains(t, dump, "release: myapp")
+
+	t.Run("export to a file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "ttls.yaml")
+
+		out, err := execute(fake.NewClientset(cj), "", "export", "-A", "-f", file)
+		require.NoError(t, err)
+		assert.Equal(t, "Exported 1 TTLs to "+file+"\n", out)
+
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, dump, string(data))
+	})
+
+	t.Run("import from stdin", func(t *testing.T) {
+		target := fake.NewClientset(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}})
+
+		out, err := execute(target, dump, "import", "-")
+		require.NoError(t, err)
+		assert.Contains(t, out, "Imported 1 of 1 TTLs")
+
+		_, err = target.BatchV1().CronJobs("default").Get(context.Background(), cj.Name, metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("import failures fail the command", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "ttls.yaml")
+		require.NoError(t, os.WriteFile(file, []byte(strings.ReplaceAll(dump, "serviceAccountName: default", "serviceAccountName: uninstaller")), 0o600))
+
+		out, err := execute(fake.NewClientset(), "", "import", file)
+		assert.EqualError(t, err, "failed to import 1 of 1 TTLs")
+		assert.Contains(t, out, `failed: service account "uninstaller" not found in namespace "default"`)
+	})
+
+	t.Run("not a dump", func(t *testing.T) {
+		_, err := execute(fake.NewClientset(), "kind: List\n", "import", "-")
+		assert.ErrorContains(t, err, "not a TTL dump")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := execute(fake.NewClientset(), "", "import", filepath.Join(t.TempDir(), "missing.yaml"))
+		assert.ErrorContains(t, err, "failed to read")
+	})
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+// namespaceTTLNotFound rewords a missing namespace TTL for the CLI.
+func namespaceTTLNotFound(err error, namespace, cronjobNamespace string) error {
+	var notFound *ttl.NamespaceTTLNotFoundError
+	if errors.As(err, &notFound) {
+		return reword(err, "no TTL set for namespace %q (CronJob namespace %q)", namespace, cronjobNamespace)
+	}
+
+	return err
+}
+
+func newSetNamespaceCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		serviceAccount       string
+		createServiceAccount bool
+		helmImage            string
+		kubectlImage         string
+		cronjobNamespace     string
+		uninstall            ttl.UninstallOptions
+		dateOrder            string
+		allowShort           bool
+		imagePullSecrets     []string
+		registryPrefix       string
+		cleanupImage         string
+		force                bool
+		outputFormat         string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "set-namespace NAMESPACE [DURATION]",
+		Short: "Set TTL for a whole namespace",
+		Long: `Set a time-to-live for a namespace. When the TTL expires, every Helm
+release in the namespace is uninstalled and the namespace is deleted, so a
+preview environment living in its own namespace goes away as a whole.
+
+The CronJob cannot live in the namespace it deletes. It is created in
+--cronjob-namespace, which defaults to the --namespace flag or
+HELM_NAMESPACE and must name another namespace.
+
+DURATION takes the same formats as helm ttl set. Without it, the
+defaultDuration of the namespace's helm-ttl-config ConfigMap is used, and
+its maxDuration caps the TTL. Namespaces marked helm-ttl/protected=true are
+refused unless --force is passed.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace := args[0]
+			var duration string
+			if len(args) == 2 {
+				duration = args[1]
+			}
+
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = gf.getNamespace()
+			}
+
+			if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+				return err
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			ctx := cmd.Context()
+			info, err := ttl.SetNamespaceTTL(ctx, client, ttl.SetNamespaceTTLOptions{
+				Namespace:            namespace,
+				CronjobNamespace:     cjNs,
+				Duration:             duration,
+				ServiceAccount:       serviceAccount,
+				CreateServiceAccount: createServiceAccount,
+				HelmImage:            helmImage,
+				KubectlImage:         kubectlImage,
+				Uninstall:            uninstall,
+				DateOrder:            dateOrder,
+				AllowShort:           allowShort,
+				ImagePullSecrets:     imagePullSecrets,
+				RegistryPrefix:       registryPrefix,
+				CleanupImage:         cleanupImage,
+				Force:                force,
+				Driver:               gf.helmDriver,
+			})
+			if err != nil {
+				var saNotFound *ttl.ServiceAccountNotFoundError
+				if errors.As(err, &saNotFound) {
+					return fmt.Errorf("service account %q not found in namespace %q; use --create-service-account to create it", serviceAccount, cjNs)
+				}
+
+				return err
+			}
+
+			if outputFormat == "text" {
+				gf.printOutput(cmd, outputFormat, fmt.Sprintf("TTL set for namespace %q: deleted at %s\n", namespace, info.ScheduledDate), info.ScheduledDate)
+				return nil
+			}
+
+			output, err := ttl.FormatNamespaceTTL(*info, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			gf.printOutput(cmd, outputFormat, output, info.ScheduledDate)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&serviceAccount, "service-account", "default", "service account for CronJob")
+	cmd.Flags().BoolVar(&createServiceAccount, "create-service-account", false, "create the service account and RBAC resources")
+	cmd.Flags().StringVar(&helmImage, "helm-image", "", "Helm container image (default: "+ttl.DefaultHelmImage+")")
+	cmd.Flags().StringVar(&kubectlImage, "kubectl-image", "", "kubectl container image (default: "+ttl.DefaultKubectlImage+")")
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace for the CronJob (default: --namespace or HELM_NAMESPACE)")
+	cmd.Flags().BoolVar(&uninstall.Wait, "uninstall-wait", false, "pass --wait to helm uninstall")
+	cmd.Flags().DurationVar(&uninstall.Timeout, "uninstall-timeout", 0, "pass --timeout to helm uninstall (default: helm's default)")
+	cmd.Flags().StringVar(&uninstall.Cascade, "cascade", "", "pass --cascade to helm uninstall: background, orphan, foreground")
+	cmd.Flags().BoolVar(&uninstall.NoHooks, "no-hooks", false, "pass --no-hooks to helm uninstall")
+	cmd.Flags().StringVar(&dateOrder, "date-order", "", "how to read numeric dates like 03/04: strict (refuse ambiguous dates), mdy or dmy (default from HELM_TTL_DATE_ORDER, else strict)")
+	cmd.Flags().BoolVar(&allowShort, "allow-short", false, "allow a TTL shorter than the minimum (default 5m, or HELM_TTL_MIN_DURATION)")
+	cmd.Flags().StringVar(&cleanupImage, "cleanup-image", "", "helm-ttl-cleanup image to use instead of kubectl for namespace deletion and self-cleanup")
+	cmd.Flags().StringVar(&registryPrefix, "registry-prefix", "", "pull the default images from this registry mirror (default: HELM_TTL_REGISTRY_PREFIX)")
+	cmd.Flags().StringArrayVar(&imagePullSecrets, "image-pull-secret", nil, "image pull secret for the uninstall images (repeatable; default from HELM_TTL_IMAGE_PULL_SECRETS)")
+	cmd.Flags().BoolVar(&force, "force", false, "set the TTL even if the namespace is marked "+ttl.LabelProtected)
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+
+	return cmd
+}
+
+func newGetNamespaceCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		outputFormat     string
+		cronjobNamespace string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "get-namespace NAMESPACE",
+		Short: "Get TTL for a namespace",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace := args[0]
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = gf.getNamespace()
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			info, err := ttl.GetNamespaceTTL(cmd.Context(), client, namespace, cjNs)
+			if err != nil {
+				return namespaceTTLNotFound(err, namespace, cjNs)
+			}
+
+			output, err := ttl.FormatNamespaceTTL(*info, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			gf.printOutput(cmd, outputFormat, output, info.ScheduledDate)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJob lives (default: --namespace or HELM_NAMESPACE)")
+
+	return cmd
+}
+
+func newUnsetNamespaceCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var cronjobNamespace string
+
+	cmd := &cobra.Command{
+		Use:   "unset-namespace NAMESPACE",
+		Short: "Remove TTL from a namespace",
+		Long: `Remove the TTL of a namespace by deleting its CronJob and RBAC. The
+namespace and its releases are left alone.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace := args[0]
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = gf.getNamespace()
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			if err := ttl.UnsetNamespaceTTL(cmd.Context(), client, namespace, cjNs); err != nil {
+				return namespaceTTLNotFound(err, namespace, cjNs)
+			}
+
+			gf.printOutput(cmd, "text", fmt.Sprintf("TTL removed for namespace %q\n", namespace))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJob lives (default: --namespace or HELM_NAMESPACE)")
+
+	return cmd
+}
+
+func newRunNamespaceCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		cronjobNamespace string
+		timeout          time.Duration
+		pollInterval     time.Duration
+		sidecars         []string
+		dryRun           bool
+		yes              bool
+		force            bool
+		outputFormat     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "run-namespace NAMESPACE",
+		Short: "Immediately run TTL for a namespace",
+		Long: `Immediately execute the TTL of a namespace: uninstall every Helm release
+in it and delete the namespace, following each container's logs as helm ttl
+run does. With --dry-run, print what would be run without creating anything.
+
+When run from a terminal, asks for confirmation first; pass --yes to skip it.
+Namespaces marked helm-ttl/protected=true are refused unless --force is
+passed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace := args[0]
+			cjNs := cronjobNamespace
+			if cjNs == "" {
+				cjNs = gf.getNamespace()
+			}
+
+			if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+				return err
+			}
+
+			if timeout <= 0 {
+				return fmt.Errorf("invalid --timeout %s: must be positive", timeout)
+			}
+			if pollInterval <= 0 {
+				return fmt.Errorf("invalid --poll-interval %s: must be positive", pollInterval)
+			}
+
+			if !dryRun && !yes && !confirm(cmd, fmt.Sprintf("Uninstall every release in namespace %q and delete it now?", namespace)) {
+				return fmt.Errorf("aborted: namespace %q was not deleted", namespace)
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			ctx := cmd.Context()
+			if !dryRun && !force {
+				if err := ttl.CheckProtected(ctx, client, nil, namespace); err != nil {
+					return err
+				}
+			}
+
+			// Keep stdout parseable when printing a structured result.
+			logs := cmd.OutOrStdout()
+			if outputFormat != "text" {
+				logs = cmd.ErrOrStderr()
+			}
+
+			stats, err := newStatsd()
+			if err != nil {
+				return err
+			}
+			defer func() { _ = stats.Close() }()
+
+			result, err := ttl.RunNamespaceTTL(ctx, client, logs, ttl.NewKubeLogFetcher(client), ttl.RunNamespaceTTLOptions{
+				Namespace:        namespace,
+				CronjobNamespace: cjNs,
+				DryRun:           dryRun,
+				Timeout:          timeout,
+				PollInterval:     pollInterval,
+
+				SidecarContainers: sidecars,
+			})
+			reportRunMetrics(stats, result, err)
+			if err != nil {
+				if result != nil && outputFormat != "text" {
+					if out, fmtErr := ttl.FormatRunResult(result, outputFormat); fmtErr == nil {
+						_, _ = fmt.Fprint(cmd.OutOrStdout(), out)
+					}
+				}
+
+				if errors.Is(err, context.DeadlineExceeded) {
+					return fmt.Errorf("%w (raise --timeout to wait longer)", err)
+				}
+
+				return namespaceTTLNotFound(err, namespace, cjNs)
+			}
+
+			out, err := ttl.FormatRunResult(result, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			gf.printOutput(cmd, outputFormat, out)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJob lives (default: --namespace or HELM_NAMESPACE)")
+	cmd.Flags().DurationVar(&timeout, "timeout", ttl.DefaultRunTimeout, "timeout for job execution")
+	cmd.Flags().DurationVar(&pollInterval, "poll-interval", ttl.DefaultRunPollInterval, "how often to check on the Job's pod when it cannot be watched")
+	cmd.Flags().StringSliceVar(&sidecars, "sidecar-container", ttl.DefaultSidecarContainers, "injected container that never terminates, ignored by the run (repeatable)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would be run and cleaned up without creating anything")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "run without asking for confirmation")
+	cmd.Flags().BoolVar(&force, "force", false, "run even if the namespace is marked "+ttl.LabelProtected)
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+
+	return cmd
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func namespaceTTLCronJob(t *testing.T) *batchv1.CronJob {
+	t.Helper()
+	cj, err := ttl.BuildNamespaceCronJob(ttl.NamespaceCronJobOptions{
+		Namespace:        "preview",
+		CronjobNamespace: "ops",
+		Schedule:         "30 14 15 3 *",
+		ServiceAccount:   "default",
+	})
+	require.NoError(t, err)
+	return cj
+}
+
+// namespaceTTLPod is the completed pod of a namespace TTL run.
+func namespaceTTLPod() *corev1.Pod {
+	terminated := func(name string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Name:  name,
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+		}
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "preview-5975cf1b-ns-ttl-run-pod",
+			Namespace: "ops",
+			Labels:    map[string]string{"job-name": "preview-5975cf1b-ns-ttl-run"},
+		},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "helm-uninstall"}, {Name: "delete-namespace"}},
+			Containers:     []corev1.Container{{Name: "self-cleanup"}},
+		},
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{terminated("helm-uninstall"), terminated("delete-namespace")},
+			ContainerStatuses:     []corev1.ContainerStatus{terminated("self-cleanup")},
+		},
+	}
+}
+
+func previewNamespace(protected bool) *corev1.Namespace {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}}
+	if protected {
+		ns.Labels = map[string]string{ttl.LabelProtected: "true"}
+	}
+
+	return ns
+}
+
+func executeNamespaceCmd(t *testing.T, client *fake.Clientset, args ...string) (string, error) {
+	t.Helper()
+
+	cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	cmd.SetErr(&buf)
+	cmd.SetArgs(args)
+
+	err := cmd.Execute()
+	return buf.String(), err
+}
+
+func TestSetNamespaceCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "ops")
+
+	t.Run("success", func(t *testing.T) {
+		client := fake.NewClientset(previewNamespace(false))
+
+		out, err := executeNamespaceCmd(t, client, "set-namespace", "preview", "7d", "--create-service-account")
+		require.NoError(t, err)
+		assert.Contains(t, out, `TTL set for namespace "preview": deleted at `)
+
+		cj, err := client.BatchV1().CronJobs("ops").Get(context.Background(), "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.True(t, ttl.IsNamespaceTTL(cj))
+	})
+
+	t.Run("cronjob namespace flag", func(t *testing.T) {
+		client := fake.NewClientset(previewNamespace(false))
+
+		_, err := executeNamespaceCmd(t, client, "set-namespace", "preview", "7d", "--create-service-account", "--cronjob-namespace", "platform")
+		require.NoError(t, err)
+
+		_, err = client.BatchV1().CronJobs("platform").Get(context.Background(), "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		out, err := executeNamespaceCmd(t, fake.NewClientset(previewNamespace(false)), "set-namespace", "preview", "7d", "--create-service-account", "-o", "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"cronjob_name": "preview-5975cf1b-ns-ttl"`)
+		assert.Contains(t, out, `"generation": 1`)
+	})
+
+	t.Run("invalid output format", func(t *testing.T) {
+		_, err := executeNamespaceCmd(t, fake.NewClientset(previewNamespace(false)), "set-namespace", "preview", "7d", "-o", "xml")
+		assert.ErrorContains(t, err, "xml")
+	})
+
+	t.Run("service account not found", func(t *testing.T) {
+		_, err := executeNamespaceCmd(t, fake.NewClientset(previewNamespace(false)), "set-namespace", "preview", "7d")
+		assert.EqualError(t, err, `service account "default" not found in namespace "ops"; use --create-service-account to create it`)
+	})
+
+	t.Run("same namespace", func(t *testing.T) {
+		_, err := executeNamespaceCmd(t, fake.NewClientset(previewNamespace(false)), "set-namespace", "preview", "7d", "-n", "preview")
+		assert.ErrorContains(t, err, "cannot put the CronJob of a namespace TTL in the namespace it deletes")
+	})
+
+	t.Run("protected namespace", func(t *testing.T) {
+		client := fake.NewClientset(previewNamespace(true))
+
+		_, err := executeNamespaceCmd(t, client, "set-namespace", "preview", "7d", "--create-service-account")
+		assert.ErrorContains(t, err, "--force")
+
+		_, err = executeNamespaceCmd(t, client, "set-namespace", "preview", "7d", "--create-service-account", "--force")
+		assert.NoError(t, err)
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"set-namespace", "preview", "7d"})
+
+		assert.ErrorContains(t, cmd.Execute(), "failed to create kubernetes client")
+	})
+}
+
+func TestGetNamespaceCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "ops")
+
+	t.Run("text output", func(t *testing.T) {
+		out, err := executeNamespaceCmd(t, fake.NewClientset(namespaceTTLCronJob(t)), "get-namespace", "preview")
+		require.NoError(t, err)
+		assert.Contains(t, out, "Namespace:         preview\n")
+		assert.Contains(t, out, "CronJob:           preview-5975cf1b-ns-ttl\n")
+		assert.Contains(t, out, "Cron Schedule:     30 14 15 3 *\n")
+	})
+
+	t.Run("yaml output", func(t *testing.T) {
+		out, err := executeNamespaceCmd(t, fake.NewClientset(namespaceTTLCronJob(t)), "get-namespace", "preview", "-o", "yaml")
+		require.NoError(t, err)
+		assert.Contains(t, out, "cronjob_namespace: ops")
+	})
+
+	t.Run("invalid output format", func(t *testing.T) {
+		_, err := executeNamespaceCmd(t, fake.NewClientset(namespaceTTLCronJob(t)), "get-namespace", "preview", "-o", "xml")
+		assert.ErrorContains(t, err, "xml")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := executeNamespaceCmd(t, fake.NewClientset(), "get-namespace", "preview")
+		assert.EqualError(t, err, `no TTL set for namespace "preview" (CronJob namespace "ops")`)
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"get-namespace", "preview"})
+
+		assert.ErrorContains(t, cmd.Execute(), "failed to create kubernetes client")
+	})
+}
+
+func TestUnsetNamespaceCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "ops")
+
+	t.Run("success", func(t *testing.T) {
+		client := fake.NewClientset(namespaceTTLCronJob(t))
+
+		out, err := executeNamespaceCmd(t, client, "unset-namespace", "preview")
+		require.NoError(t, err)
+		assert.Equal(t, "TTL removed for namespace \"preview\"\n", out)
+
+		_, err = client.BatchV1().CronJobs("ops").Get(context.Background(), "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := executeNamespaceCmd(t, fake.NewClientset(), "unset-namespace", "preview", "--cronjob-namespace", "platform")
+		assert.EqualError(t, err, `no TTL set for namespace "preview" (CronJob namespace "platform")`)
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"unset-namespace", "preview"})
+
+		assert.ErrorContains(t, cmd.Execute(), "failed to create kubernetes client")
+	})
+}
+
+func TestRunNamespaceCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "ops")
+
+	t.Run("success", func(t *testing.T) {
+		client := fake.NewClientset(namespaceTTLCronJob(t), namespaceTTLPod(), previewNamespace(false))
+
+		out, err := executeNamespaceCmd(t, client, "run-namespace", "preview")
+		require.NoError(t, err)
+		assert.Contains(t, out, "TTL executed for namespace \"preview\"\nNamespace \"preview\" deleted\n")
+
+		_, err = client.CoreV1().Namespaces().Get(context.Background(), "preview", metav1.GetOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		client := fake.NewClientset(namespaceTTLCronJob(t), namespaceTTLPod(), previewNamespace(false))
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var stdout, stderr bytes.Buffer
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&stderr)
+		cmd.SetArgs([]string{"run-namespace", "preview", "-o", "json"})
+
+		require.NoError(t, cmd.Execute())
+		assert.True(t, strings.HasPrefix(stdout.String(), "{"))
+		assert.Contains(t, stdout.String(), `"namespace_ttl": true`)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		client := fake.NewClientset(namespaceTTLCronJob(t), previewNamespace(true))
+
+		out, err := executeNamespaceCmd(t, client, "run-namespace", "preview", "--dry-run")
+		require.NoError(t, err)
+		assert.Contains(t, out, "Namespace:         preview\n")
+		assert.Contains(t, out, "Job manifest:")
+	})
+
+	t.Run("protected namespace", func(t *testing.T) {
+		client := fake.NewClientset(namespaceTTLCronJob(t), namespaceTTLPod(), previewNamespace(true))
+
+		_, err := executeNamespaceCmd(t, client, "run-namespace", "preview")
+		assert.ErrorContains(t, err, "--force")
+
+		_, err = executeNamespaceCmd(t, client, "run-namespace", "preview", "--force")
+		assert.NoError(t, err)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := executeNamespaceCmd(t, fake.NewClientset(previewNamespace(false)), "run-namespace", "preview")
+		assert.EqualError(t, err, `no TTL set for namespace "preview" (CronJob namespace "ops")`)
+	})
+
+	t.Run("job failure with json output", func(t *testing.T) {
+		pod := namespaceTTLPod()
+		pod.Status.InitContainerStatuses[0].State.Terminated.ExitCode = 1
+		client := fake.NewClientset(namespaceTTLCronJob(t), pod, previewNamespace(false))
+
+		out, err := executeNamespaceCmd(t, client, "run-namespace", "preview", "-o", "json")
+		assert.ErrorContains(t, err, "job failed")
+		assert.Contains(t, out, `"job_failed": true`)
+	})
+
+	t.Run("declined at the prompt", func(t *testing.T) {
+		fakeTerminal(t)
+		client := fake.NewClientset(namespaceTTLCronJob(t), previewNamespace(false))
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetIn(strings.NewReader("n\n"))
+		cmd.SetArgs([]string{"run-namespace", "preview"})
+
+		err := cmd.Execute()
+		assert.EqualError(t, err, `aborted: namespace "preview" was not deleted`)
+		assert.Contains(t, buf.String(), `Uninstall every release in namespace "preview" and delete it now? [y/N]`)
+	})
+
+	t.Run("invalid flags", func(t *testing.T) {
+		for name, args := range map[string][]string{
+			"output":        {"-o", "xml"},
+			"timeout":       {"--timeout", "0s"},
+			"poll interval": {"--poll-interval", "0s"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := executeNamespaceCmd(t, fake.NewClientset(), append([]string{"run-namespace", "preview"}, args...)...)
+				assert.Error(t, err)
+			})
+		}
+	})
+
+	t.Run("kube client error", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, errorKubeFactory())
+		cmd.SetOut(&bytes.Buffer{})
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs([]string{"run-namespace", "preview", "-y"})
+
+		assert.ErrorContains(t, cmd.Execute(), "failed to create kubernetes client")
+	})
+
+	t.Run("protection lookup error", func(t *testing.T) {
+		client := fake.NewClientset(namespaceTTLCronJob(t))
+		client.PrependReactor("get", "namespaces", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := executeNamespaceCmd(t, client, "run-namespace", "preview")
+		assert.ErrorContains(t, err, "forbidden")
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newReportCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		outputFormat     string
+		cronjobNamespace string
+		allNamespaces    bool
+		opts             ttl.ReportOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Estimate the monthly cost of the releases with a TTL",
+		Long: `Estimate what the releases with a TTL cost, and so what their TTLs save.
+
+The CPU and memory requests of a release are those of the Deployments,
+StatefulSets and DaemonSets labeled app.kubernetes.io/instance=RELEASE in
+its namespace, times their replicas. They are priced at --cpu-rate a core
+and --memory-rate a GiB a month, which default to report.cpuRate and
+report.memoryRate in the plugin config, or to 24 and 3.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+				return err
+			}
+
+			cfg, err := loadPluginConfig()
+			if err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("cpu-rate") {
+				opts.CPURate = cfg.Report.CPURate
+			}
+			if !cmd.Flags().Changed("memory-rate") {
+				opts.MemoryRate = cfg.Report.MemoryRate
+			}
+
+			opts.ReleaseNamespace = gf.getNamespace()
+			opts.CronjobNamespace = cronjobNamespace
+			if opts.CronjobNamespace == "" {
+				opts.CronjobNamespace = opts.ReleaseNamespace
+			}
+
+			if allNamespaces {
+				opts.ReleaseNamespace, opts.CronjobNamespace = "", ""
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			report, err := ttl.ReportCosts(cmd.Context(), client, opts)
+			if err != nil {
+				return err
+			}
+
+			output, err := ttl.FormatCostReport(report, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprint(cmd.OutOrStdout(), output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+	cmd.Flags().StringVar(&cronjobNamespace, "cronjob-namespace", "", "namespace where the CronJobs live (default: release namespace)")
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "report on TTLs in all namespaces")
+	cmd.Flags().Float64Var(&opts.CPURate, "cpu-rate", ttl.DefaultCPUMonthlyRate, "monthly cost of a requested CPU core")
+	cmd.Flags().Float64Var(&opts.MemoryRate, "memory-rate", ttl.DefaultMemoryMonthlyRate, "monthly cost of a requested GiB of memory")
+
+	return cmd
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReportCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+	t.Setenv("HELM_TTL_CONFIG", filepath.Join(t.TempDir(), "config.yaml"))
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "cart", Namespace: "default", Labels: map[string]string{"app.kubernetes.io/instance": "cart"}},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "app",
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("1"),
+				corev1.ResourceMemory: resource.MustParse("2Gi"),
+			}},
+		}}}}},
+	}
+
+	run := func(t *testing.T, args ...string) string {
+		t.Helper()
+		client := fake.NewClientset(extendTestCronJob(t, "cart"), deployment)
+
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs(append([]string{"report"}, args...))
+
+		require.NoError(t, cmd.Execute())
+		return buf.String()
+	}
+
+	t.Run("text output", func(t *testing.T) {
+		out := run(t)
+		assert.Contains(t, out, "MONTHLY COST")
+		assert.Contains(t, out, "cart")
+		assert.Contains(t, out, "Total: 30.00 a month")
+	})
+
+	t.Run("rates from flags", func(t *testing.T) {
+		out := run(t, "-A", "--cpu-rate", "10", "--memory-rate", "1", "-o", "json")
+		assert.Contains(t, out, `"monthly_cost": 12`)
+		assert.Contains(t, out, `"cpu_rate": 10`)
+	})
+
+	t.Run("rates from the plugin config", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		t.Setenv("HELM_TTL_CONFIG", path)
+		require.NoError(t, os.WriteFile(path, []byte("report:\n  cpuRate: 20\n  memoryRate: 5\n"), 0o600))
+
+		assert.Contains(t, run(t, "-o", "json"), `"total_monthly_cost": 30`)
+		assert.Contains(t, run(t, "--memory-rate", "0.5", "-o", "json"), `"total_monthly_cost": 21`)
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var (
+		dryRun        bool
+		allNamespaces bool
+		outputFormat  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade the labels of helm-ttl resources written by older versions",
+		Long: `Upgrade the labels and annotations of the CronJobs, ServiceAccounts,
+RBAC resources and history ConfigMaps older helm-ttl versions wrote to the
+schema this one writes, recorded in their helm-ttl/schema-version label.
+Resources without the label were written before it existed, as schema
+version 1. Names are kept; only labels and annotations change.
+
+Run it in each namespace with TTLs, or once with --all-namespaces, which
+also upgrades the ClusterRoles and ClusterRoleBindings, after upgrading the
+plugin. --dry-run prints what would change.
+
+Resources written by a newer helm-ttl are reported and left alone.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := ttl.ValidateOutputFormat(outputFormat); err != nil {
+				return err
+			}
+
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			opts := ttl.MigrateSchemaOptions{Namespace: gf.getNamespace(), DryRun: dryRun}
+			if allNamespaces {
+				opts.Namespace = ""
+			}
+
+			result, err := ttl.MigrateSchema(cmd.Context(), client, opts)
+			if err != nil {
+				return err
+			}
+
+			output, err := ttl.FormatMigrateResult(result, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			_, _ = fmt.Fprint(cmd.OutOrStdout(), output)
+
+			for _, r := range result.Resources {
+				if r.Error != "" {
+					return fmt.Errorf("failed to migrate some resources")
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print what would change without changing it")
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "migrate resources in all namespaces, and the cluster-scoped RBAC")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+
+	return cmd
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMigrateCmd(t *testing.T) {
+	t.Setenv("HELM_NAMESPACE", "default")
+
+	ctx := context.Background()
+	newClient := func(t *testing.T) *fake.Clientset {
+		t.Helper()
+		cj := extendTestCronJob(t, "cart")
+		delete(cj.Labels, ttl.LabelSchemaVersion)
+		return fake.NewClientset(cj)
+	}
+
+	run := func(t *testing.T, client *fake.Clientset, args ...string) (string, error) {
+		t.Helper()
+		cmd := newRootCmd(defaultConfigFactory, testKubeFactoryWithClient(client))
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs(append([]string{"migrate"}, args...))
+
+		err := cmd.Execute()
+		return buf.String(), err
+	}
+
+	t.Run("migrates", func(t *testing.T) {
+		client := newClient(t)
+
+		out, err := run(t, client)
+		require.NoError(t, err)
+		assert.Contains(t, out, "migrated")
+		assert.Contains(t, out, "Migrated 1 of 1 resources to schema version 2")
+
+		list, err := client.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, list.Items, 1)
+		assert.Equal(t, "2", list.Items[0].Labels[ttl.LabelSchemaVersion])
+
+		out, err = run(t, client)
+		require.NoError(t, err)
+		assert.Equal(t, "All helm-ttl resources are at schema version 2.\n", out)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		client := newClient(t)
+
+		out, err := run(t, client, "--dry-run", "-o", "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"dry_run": true`)
+
+		list, err := client.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, list.Items[0].Labels, ttl.LabelSchemaVersion)
+	})
+
+	t.Run("fails on newer resources", func(t *testing.T) {
+		client := fake.NewClientset(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name:      "cart-ttl",
+			Namespace: "default",
+			Labels:    map[string]string{ttl.LabelManagedBy: ttl.LabelManagedByValue, ttl.LabelSchemaVersion: "3"},
+		}})
+
+		out, err := run(t, client)
+		require.Error(t, err)
+		assert.Contains(t, out, "failed: unknown schema version")
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/spf13/cobra"
+)
+
+func newVersionCmd(gf *globalFlags) *cobra.Command {
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print the version of helm-ttl and what it supports",
+		Long: `Print the plugin version, the Helm SDK and Go versions it was built with,
+its platform, the default images of the uninstall Job, and the schedule
+features set and extend support. Scripts can read it with -o json to
+require a minimum version before using newer flags; with --quiet only the
+plugin version is printed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			info := ttl.GetVersionInfo(version)
+			output, err := ttl.FormatVersion(info, outputFormat)
+			if err != nil {
+				return err
+			}
+
+			gf.printOutput(cmd, outputFormat, output, info.Version)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "text", "output format: text, yaml, json, go-template=TEMPLATE, jsonpath=EXPRESSION")
+
+	return cmd
+}
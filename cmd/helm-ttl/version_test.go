@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionCmd(t *testing.T) {
+	t.Run("text output", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetArgs([]string{"version"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Contains(t, buf.String(), "helm-ttl:          "+version+"\n")
+		assert.Contains(t, buf.String(), "helm image:        "+ttl.DefaultHelmImage+"\n")
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetArgs([]string{"version", "-o", "json"})
+
+		require.NoError(t, cmd.Execute())
+
+		var info ttl.VersionInfo
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &info))
+		assert.Equal(t, ttl.GetVersionInfo(version), info)
+	})
+
+	t.Run("quiet", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetArgs([]string{"version", "--quiet"})
+
+		require.NoError(t, cmd.Execute())
+		assert.Equal(t, version+"\n", buf.String())
+	})
+
+	t.Run("invalid output format", func(t *testing.T) {
+		cmd := newRootCmd(defaultConfigFactory, defaultKubeClientFactory)
+		var buf bytes.Buffer
+		cmd.SetOut(&buf)
+		cmd.SetErr(&buf)
+		cmd.SetArgs([]string{"version", "-o", "xml"})
+
+		err := cmd.Execute()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported output format")
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/josegonzalez/helm-ttl/pkg/webhook"
+	"github.com/spf13/cobra"
+)
+
+func newWebhookCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "webhook",
+		Short: "Run the TTL policy admission webhook",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.AddCommand(newWebhookServeCmd(kubeFactory, gf))
+
+	return cmd
+}
+
+func newWebhookServeCmd(kubeFactory kubeClientFactory, gf *globalFlags) *cobra.Command {
+	var opts webhook.ServeOptions
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the validating admission webhook over HTTPS",
+		Long: `Serve a validating admission webhook that enforces the namespace TTL
+policy (the helm-ttl-config ConfigMap) at admission time:
+
+  - Helm release Secrets created in a namespace with requireTTL: "true"
+    are rejected unless the release declares helm-ttl.io/duration.
+  - Declared TTLs and helm-ttl CronJob schedules longer than the
+    namespace maxDuration are rejected.
+
+Reviews are answered on /validate and liveness on /healthz. Register the
+server with a ValidatingWebhookConfiguration; see the README.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			client, err := kubeFactory(gf.kubeOptions())
+			if err != nil {
+				return fmt.Errorf("failed to create kubernetes client: %w", err)
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "Serving admission webhook on %s\n", opts.Addr)
+			return webhook.Serve(ctx, &webhook.Validator{Client: client}, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Addr, "addr", ":8443", "address to listen on")
+	cmd.Flags().StringVar(&opts.CertFile, "tls-cert-file", "", "TLS certificate file")
+	cmd.Flags().StringVar(&opts.KeyFile, "tls-key-file", "", "TLS private key file")
+	_ = cmd.MarkFlagRequired("tls-cert-file")
+	_ = cmd.MarkFlagRequired("tls-key-file")
+
+	return cmd
+}
@@ -0,0 +1,116 @@
+// Package v1alpha1 defines the ReleaseTTL custom resource, the
+// helm-ttl.io/v1alpha1 kind TTLs are kept as with the releasettl backend.
+// A ReleaseTTL names the release and when it expires; helm ttl controller
+// uninstalls the release then.
+package v1alpha1
+
+import (
+	_ "embed"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CRD is the CustomResourceDefinition of ReleaseTTL, as YAML.
+//
+//go:embed crd.yaml
+var CRD string
+
+// SchemeGroupVersion is the group and version of ReleaseTTL.
+var SchemeGroupVersion = schema.GroupVersion{Group: "helm-ttl.io", Version: "v1alpha1"}
+
+// Resource is the resource ReleaseTTLs are served as.
+var Resource = SchemeGroupVersion.WithResource("releasettls")
+
+// Kind is the kind of a ReleaseTTL.
+const Kind = "ReleaseTTL"
+
+// ReleaseTTL is the TTL of a Helm release.
+type ReleaseTTL struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ReleaseTTLSpec `json:"spec"`
+}
+
+// ReleaseTTLSpec describes the release to uninstall and when.
+type ReleaseTTLSpec struct {
+	// Release is the name of the Helm release.
+	Release string `json:"release"`
+	// ReleaseNamespace is the namespace of the release. It defaults to
+	// the namespace of the ReleaseTTL.
+	ReleaseNamespace string `json:"releaseNamespace,omitempty"`
+	// ExpiresAt is when the release is uninstalled.
+	ExpiresAt metav1.Time `json:"expiresAt"`
+	// DeleteNamespace deletes the release namespace after the uninstall.
+	// It needs the ReleaseTTL in another namespace.
+	DeleteNamespace bool `json:"deleteNamespace,omitempty"`
+	// Driver is the Helm storage driver of the release: secrets (the
+	// default), configmaps or sql.
+	Driver string `json:"driver,omitempty"`
+	// Uninstall holds the flags of the helm uninstall.
+	Uninstall Uninstall `json:"uninstall,omitempty"`
+}
+
+// Uninstall holds the flags of a helm uninstall.
+type Uninstall struct {
+	Wait        bool             `json:"wait,omitempty"`
+	Timeout     *metav1.Duration `json:"timeout,omitempty"`
+	KeepHistory bool             `json:"keepHistory,omitempty"`
+	NoHooks     bool             `json:"noHooks,omitempty"`
+	// Cascade is the deletion propagation: background (the default),
+	// foreground or orphan.
+	Cascade string `json:"cascade,omitempty"`
+}
+
+// ReleaseTTLList is a list of ReleaseTTLs.
+type ReleaseTTLList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ReleaseTTL `json:"items"`
+}
+
+// DeepCopyInto copies r into out.
+func (r *ReleaseTTL) DeepCopyInto(out *ReleaseTTL) {
+	*out = *r
+	r.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	r.Spec.ExpiresAt.DeepCopyInto(&out.Spec.ExpiresAt)
+	if r.Spec.Uninstall.Timeout != nil {
+		timeout := *r.Spec.Uninstall.Timeout
+		out.Spec.Uninstall.Timeout = &timeout
+	}
+}
+
+// DeepCopy returns a copy of r.
+func (r *ReleaseTTL) DeepCopy() *ReleaseTTL {
+	if r == nil {
+		return nil
+	}
+
+	out := new(ReleaseTTL)
+	r.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (r *ReleaseTTL) DeepCopyObject() runtime.Object {
+	return r.DeepCopy()
+}
+
+// DeepCopyObject implements runtime.Object.
+func (l *ReleaseTTLList) DeepCopyObject() runtime.Object {
+	if l == nil {
+		return nil
+	}
+
+	out := &ReleaseTTLList{TypeMeta: l.TypeMeta}
+	l.ListMeta.DeepCopyInto(&out.ListMeta)
+	out.Items = make([]ReleaseTTL, len(l.Items))
+	for i := range l.Items {
+		l.Items[i].DeepCopyInto(&out.Items[i])
+	}
+
+	return out
+}
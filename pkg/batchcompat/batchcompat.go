@@ -0,0 +1,270 @@
+// Package batchcompat lets helm-ttl manage its CronJobs on clusters that
+// only serve the batch/v1beta1 CronJob API, such as Kubernetes 1.20 and
+// older, by translating the batch/v1 calls of the rest of helm-ttl.
+package batchcompat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+	typedbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	typedbatchv1beta1 "k8s.io/client-go/kubernetes/typed/batch/v1beta1"
+)
+
+const (
+	// V1 is the CronJob API of Kubernetes 1.21 and later.
+	V1 = "batch/v1"
+	// V1beta1 is the CronJob API of Kubernetes 1.8 to 1.24.
+	V1beta1 = "batch/v1beta1"
+)
+
+// UnsupportedError is returned when a cluster serves no CronJob API
+// helm-ttl can use.
+type UnsupportedError struct {
+	// ServerVersion is the version the cluster reports, if known.
+	ServerVersion string
+}
+
+func (e *UnsupportedError) Error() string {
+	cluster := "the cluster"
+	if e.ServerVersion != "" {
+		cluster = fmt.Sprintf("the cluster (Kubernetes %s)", e.ServerVersion)
+	}
+
+	return fmt.Sprintf("%s serves CronJobs in neither %s nor %s; helm-ttl needs Kubernetes 1.8 or later", cluster, V1, V1beta1)
+}
+
+// CronJobVersion returns the API version the cluster serves CronJobs in,
+// preferring batch/v1. It fails with an UnsupportedError when the cluster
+// serves neither.
+func CronJobVersion(client discovery.DiscoveryInterface) (string, error) {
+	for _, groupVersion := range []string{V1, V1beta1} {
+		resources, err := client.ServerResourcesForGroupVersion(groupVersion)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to discover the %s API: %w", groupVersion, err)
+		}
+
+		for _, r := range resources.APIResources {
+			if r.Name == "cronjobs" {
+				return groupVersion, nil
+			}
+		}
+	}
+
+	unsupported := &UnsupportedError{}
+	if info, err := client.ServerVersion(); err == nil {
+		unsupported.ServerVersion = info.GitVersion
+	}
+
+	return "", unsupported
+}
+
+// Wrap returns client unchanged on clusters serving batch/v1 CronJobs, and
+// on clusters only serving batch/v1beta1 a client whose BatchV1 CronJobs
+// are read and written in batch/v1beta1. Discovery errors other than an
+// unsupported cluster leave client unchanged, so the calls it makes report
+// them.
+func Wrap(client kubernetes.Interface) (kubernetes.Interface, error) {
+	version, err := CronJobVersion(client.Discovery())
+	if _, unsupported := err.(*UnsupportedError); unsupported {
+		return nil, err
+	}
+	if err != nil || version == V1 {
+		return client, nil
+	}
+
+	return &v1beta1Client{Interface: client}, nil
+}
+
+// v1beta1Client serves the CronJobs of BatchV1 from batch/v1beta1.
+type v1beta1Client struct {
+	kubernetes.Interface
+}
+
+func (c *v1beta1Client) BatchV1() typedbatchv1.BatchV1Interface {
+	return &v1beta1Batch{BatchV1Interface: c.Interface.BatchV1(), beta: c.BatchV1beta1()}
+}
+
+// v1beta1Batch serves Jobs from batch/v1, which every supported cluster
+// has, and CronJobs from batch/v1beta1.
+type v1beta1Batch struct {
+	typedbatchv1.BatchV1Interface
+	beta typedbatchv1beta1.BatchV1beta1Interface
+}
+
+func (b *v1beta1Batch) CronJobs(namespace string) typedbatchv1.CronJobInterface {
+	return &v1beta1CronJobs{client: b.beta.CronJobs(namespace)}
+}
+
+// v1beta1CronJobs converts batch/v1 CronJobs to and from batch/v1beta1,
+// whose fields are the same.
+type v1beta1CronJobs struct {
+	client typedbatchv1beta1.CronJobInterface
+}
+
+var _ typedbatchv1.CronJobInterface = &v1beta1CronJobs{}
+
+func (c *v1beta1CronJobs) Create(ctx context.Context, cronJob *batchv1.CronJob, opts metav1.CreateOptions) (*batchv1.CronJob, error) {
+	beta, err := convert[batchv1beta1.CronJob](cronJob)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromBeta(c.client.Create(ctx, beta, opts))
+}
+
+func (c *v1beta1CronJobs) Update(ctx context.Context, cronJob *batchv1.CronJob, opts metav1.UpdateOptions) (*batchv1.CronJob, error) {
+	beta, err := convert[batchv1beta1.CronJob](cronJob)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromBeta(c.client.Update(ctx, beta, opts))
+}
+
+func (c *v1beta1CronJobs) UpdateStatus(ctx context.Context, cronJob *batchv1.CronJob, opts metav1.UpdateOptions) (*batchv1.CronJob, error) {
+	beta, err := convert[batchv1beta1.CronJob](cronJob)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromBeta(c.client.UpdateStatus(ctx, beta, opts))
+}
+
+func (c *v1beta1CronJobs) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.client.Delete(ctx, name, opts)
+}
+
+func (c *v1beta1CronJobs) DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	return c.client.DeleteCollection(ctx, opts, listOpts)
+}
+
+func (c *v1beta1CronJobs) Get(ctx context.Context, name string, opts metav1.GetOptions) (*batchv1.CronJob, error) {
+	return fromBeta(c.client.Get(ctx, name, opts))
+}
+
+func (c *v1beta1CronJobs) List(ctx context.Context, opts metav1.ListOptions) (*batchv1.CronJobList, error) {
+	list, err := c.client.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	converted, err := convert[batchv1.CronJobList](list)
+	if err != nil {
+		return nil, err
+	}
+	converted.TypeMeta = metav1.TypeMeta{}
+
+	return converted, nil
+}
+
+// Watch converts the CronJobs of each event, dropping those that fail to.
+func (c *v1beta1CronJobs) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	w, err := c.client.Watch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		beta, ok := e.Object.(*batchv1beta1.CronJob)
+		if !ok {
+			return e, true
+		}
+
+		cj, err := fromBeta(beta, nil)
+		if err != nil {
+			return e, false
+		}
+		e.Object = cj
+
+		return e, true
+	}), nil
+}
+
+func (c *v1beta1CronJobs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*batchv1.CronJob, error) {
+	if pt == types.ApplyPatchType {
+		var err error
+		if data, err = betaApplyPatch(data); err != nil {
+			return nil, err
+		}
+	}
+
+	return fromBeta(c.client.Patch(ctx, name, pt, data, opts, subresources...))
+}
+
+func (c *v1beta1CronJobs) Apply(ctx context.Context, cronJob *batchv1ac.CronJobApplyConfiguration, opts metav1.ApplyOptions) (*batchv1.CronJob, error) {
+	return c.apply(ctx, cronJob, opts)
+}
+
+func (c *v1beta1CronJobs) ApplyStatus(ctx context.Context, cronJob *batchv1ac.CronJobApplyConfiguration, opts metav1.ApplyOptions) (*batchv1.CronJob, error) {
+	return c.apply(ctx, cronJob, opts, "status")
+}
+
+// apply sends an apply configuration as a batch/v1beta1 apply patch.
+func (c *v1beta1CronJobs) apply(ctx context.Context, cronJob *batchv1ac.CronJobApplyConfiguration, opts metav1.ApplyOptions, subresources ...string) (*batchv1.CronJob, error) {
+	if cronJob == nil || cronJob.GetName() == nil {
+		return nil, fmt.Errorf("cronJob.Name must be provided to Apply")
+	}
+
+	data, err := json.Marshal(cronJob)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Patch(ctx, *cronJob.GetName(), types.ApplyPatchType, data, opts.ToPatchOptions(), subresources...)
+}
+
+// betaApplyPatch rewrites the apiVersion of a batch/v1 apply patch.
+func betaApplyPatch(data []byte) ([]byte, error) {
+	var patch map[string]any
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, fmt.Errorf("failed to read apply patch: %w", err)
+	}
+	patch["apiVersion"] = V1beta1
+
+	return json.Marshal(patch)
+}
+
+// fromBeta converts the result of a batch/v1beta1 call.
+func fromBeta(beta *batchv1beta1.CronJob, err error) (*batchv1.CronJob, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	cj, err := convert[batchv1.CronJob](beta)
+	if err != nil {
+		return nil, err
+	}
+	cj.TypeMeta = metav1.TypeMeta{}
+
+	return cj, nil
+}
+
+// convert copies in into a new Out through JSON, which works between the
+// versions of CronJob since their fields have the same names.
+func convert[Out any](in any) (*Out, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert CronJob: %w", err)
+	}
+
+	out := new(Out)
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, fmt.Errorf("failed to convert CronJob: %w", err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,226 @@
+package batchcompat
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/version"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// serving returns a client whose discovery serves CronJobs in the given
+// group versions.
+func serving(groupVersions ...string) *fake.Clientset {
+	client := fake.NewClientset()
+	disc := client.Discovery().(*fakediscovery.FakeDiscovery)
+	for _, gv := range groupVersions {
+		disc.Resources = append(disc.Resources, &metav1.APIResourceList{
+			GroupVersion: gv,
+			APIResources: []metav1.APIResource{{Name: "jobs"}, {Name: "cronjobs"}},
+		})
+	}
+	disc.FakedServerVersion = &version.Info{GitVersion: "v1.7.16"}
+
+	return client
+}
+
+func TestCronJobVersion(t *testing.T) {
+	t.Run("batch/v1 preferred", func(t *testing.T) {
+		got, err := CronJobVersion(serving(V1beta1, V1).Discovery())
+		require.NoError(t, err)
+		assert.Equal(t, V1, got)
+	})
+
+	t.Run("batch/v1beta1 only", func(t *testing.T) {
+		got, err := CronJobVersion(serving(V1beta1).Discovery())
+		require.NoError(t, err)
+		assert.Equal(t, V1beta1, got)
+	})
+
+	t.Run("group version without cronjobs", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+			{GroupVersion: V1, APIResources: []metav1.APIResource{{Name: "jobs"}}},
+		}
+
+		_, err := CronJobVersion(client.Discovery())
+		var unsupported *UnsupportedError
+		assert.ErrorAs(t, err, &unsupported)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := CronJobVersion(serving().Discovery())
+		assert.EqualError(t, err, "the cluster (Kubernetes v1.7.16) serves CronJobs in neither batch/v1 nor batch/v1beta1; helm-ttl needs Kubernetes 1.8 or later")
+	})
+
+	t.Run("discovery error", func(t *testing.T) {
+		client := serving(V1)
+		client.PrependReactor("get", "resource", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("connection refused")
+		})
+
+		_, err := CronJobVersion(client.Discovery())
+		assert.EqualError(t, err, "failed to discover the batch/v1 API: connection refused")
+	})
+}
+
+func TestUnsupportedError(t *testing.T) {
+	assert.EqualError(t, &UnsupportedError{}, "the cluster serves CronJobs in neither batch/v1 nor batch/v1beta1; helm-ttl needs Kubernetes 1.8 or later")
+}
+
+func TestWrap(t *testing.T) {
+	t.Run("batch/v1 unchanged", func(t *testing.T) {
+		client := serving(V1)
+
+		wrapped, err := Wrap(client)
+		require.NoError(t, err)
+		assert.Same(t, client, wrapped)
+	})
+
+	t.Run("discovery error unchanged", func(t *testing.T) {
+		client := serving(V1)
+		client.PrependReactor("get", "resource", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("connection refused")
+		})
+
+		wrapped, err := Wrap(client)
+		require.NoError(t, err)
+		assert.Same(t, client, wrapped)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		_, err := Wrap(serving())
+		var unsupported *UnsupportedError
+		assert.ErrorAs(t, err, &unsupported)
+	})
+
+	t.Run("batch/v1beta1", func(t *testing.T) {
+		wrapped, err := Wrap(serving(V1beta1))
+		require.NoError(t, err)
+		_, ok := wrapped.(*v1beta1Client)
+		assert.True(t, ok)
+	})
+}
+
+func TestV1beta1CronJobs(t *testing.T) {
+	ctx := context.Background()
+	newClient := func(t *testing.T) (*fake.Clientset, *v1beta1CronJobs) {
+		t.Helper()
+
+		client := serving(V1beta1)
+		wrapped, err := Wrap(client)
+		require.NoError(t, err)
+
+		return client, wrapped.BatchV1().CronJobs("ops").(*v1beta1CronJobs)
+	}
+	cronJob := func() *batchv1.CronJob {
+		return &batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Namespace: "ops", Labels: map[string]string{"app.kubernetes.io/managed-by": "helm-ttl"}},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "0 12 1 1 *",
+				JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{
+					BackoffLimit: new(int32),
+				}},
+			},
+		}
+	}
+
+	t.Run("create, get and list", func(t *testing.T) {
+		client, cronJobs := newClient(t)
+
+		created, err := cronJobs.Create(ctx, cronJob(), metav1.CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "0 12 1 1 *", created.Spec.Schedule)
+
+		beta, err := client.BatchV1beta1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "0 12 1 1 *", beta.Spec.Schedule)
+		assert.Equal(t, int32(0), *beta.Spec.JobTemplate.Spec.BackoffLimit)
+
+		got, err := cronJobs.Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, created, got)
+
+		list, err := cronJobs.List(ctx, metav1.ListOptions{LabelSelector: "app.kubernetes.io/managed-by=helm-ttl"})
+		require.NoError(t, err)
+		require.Len(t, list.Items, 1)
+		assert.Equal(t, "myapp-80081014-ttl", list.Items[0].Name)
+	})
+
+	t.Run("update, patch and delete", func(t *testing.T) {
+		client, cronJobs := newClient(t)
+		created, err := cronJobs.Create(ctx, cronJob(), metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		created.Spec.Schedule = "0 12 2 1 *"
+		updated, err := cronJobs.Update(ctx, created, metav1.UpdateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "0 12 2 1 *", updated.Spec.Schedule)
+
+		patched, err := cronJobs.Patch(ctx, "myapp-80081014-ttl", types.MergePatchType, []byte(`{"metadata":{"annotations":{"helm-ttl/abort":"true"}}}`), metav1.PatchOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "true", patched.Annotations["helm-ttl/abort"])
+
+		require.NoError(t, cronJobs.Delete(ctx, "myapp-80081014-ttl", metav1.DeleteOptions{}))
+		list, err := client.BatchV1beta1().CronJobs("ops").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, list.Items)
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		client, cronJobs := newClient(t)
+
+		applied, err := cronJobs.Apply(ctx, batchv1ac.CronJob("myapp-80081014-ttl", "ops").
+			WithSpec(batchv1ac.CronJobSpec().WithSchedule("0 12 1 1 *")), metav1.ApplyOptions{FieldManager: "helm-ttl"})
+		require.NoError(t, err)
+		assert.Equal(t, "0 12 1 1 *", applied.Spec.Schedule)
+
+		beta, err := client.BatchV1beta1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "0 12 1 1 *", beta.Spec.Schedule)
+	})
+
+	t.Run("apply requires a name", func(t *testing.T) {
+		_, cronJobs := newClient(t)
+
+		_, err := cronJobs.Apply(ctx, &batchv1ac.CronJobApplyConfiguration{}, metav1.ApplyOptions{FieldManager: "helm-ttl"})
+		assert.EqualError(t, err, "cronJob.Name must be provided to Apply")
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		client, cronJobs := newClient(t)
+		w, err := cronJobs.Watch(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		defer w.Stop()
+
+		_, err = client.BatchV1beta1().CronJobs("ops").Create(ctx, &batchv1beta1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Namespace: "ops"}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		e := <-w.ResultChan()
+		cj, ok := e.Object.(*batchv1.CronJob)
+		require.True(t, ok)
+		assert.Equal(t, "myapp-80081014-ttl", cj.Name)
+	})
+
+	t.Run("jobs stay in batch/v1", func(t *testing.T) {
+		client, _ := newClient(t)
+		wrapped, err := Wrap(client)
+		require.NoError(t, err)
+
+		_, err = wrapped.BatchV1().Jobs("ops").Create(ctx, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "myapp-run"}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+		_, err = client.BatchV1().Jobs("ops").Get(ctx, "myapp-run", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,493 @@
+// Package controller reconciles helm-ttl state across the cluster from
+// shared informers. It runs in audit mode: it reports what it would do,
+// without changing anything, so it can be trialled safely. With the
+// controller and releasettl backends it also expires their TTLs itself.
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"helm.sh/helm/v3/pkg/action"
+
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+)
+
+// shutdownTimeout bounds how long Run waits for the metrics server.
+const shutdownTimeout = 10 * time.Second
+
+// ActionType is a kind of change the controller would make.
+type ActionType string
+
+const (
+	// ActionCreateTTL sets the namespace default TTL on a release that
+	// has none.
+	ActionCreateTTL ActionType = "create-ttl"
+	// ActionExecuteExpiry runs a TTL whose scheduled date passed without
+	// the CronJob firing.
+	ActionExecuteExpiry ActionType = "execute-expiry"
+	// ActionPruneOrphan deletes a ServiceAccount or RBAC resource whose
+	// CronJob is gone.
+	ActionPruneOrphan ActionType = "prune-orphan"
+	// ActionExpire uninstalls a release whose TTL of a backend running
+	// no Jobs has expired.
+	ActionExpire ActionType = "expire"
+)
+
+// ActionTypes lists every ActionType, in reporting order.
+var ActionTypes = []ActionType{ActionCreateTTL, ActionExecuteExpiry, ActionPruneOrphan, ActionExpire}
+
+// Action is a change the controller would make.
+type Action struct {
+	Type ActionType `json:"type"`
+	// Release is empty for ActionPruneOrphan.
+	Release   string `json:"release,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Resource is the orphan to prune, e.g. "ServiceAccount myapp-default-ttl".
+	Resource string `json:"resource,omitempty"`
+	// Detail is the duration to set, or the missed or passed expiry.
+	Detail string `json:"detail,omitempty"`
+}
+
+func (a Action) String() string {
+	switch a.Type {
+	case ActionCreateTTL:
+		return fmt.Sprintf("create TTL of %s for release %q in namespace %q (namespace default)", a.Detail, a.Release, a.Namespace)
+	case ActionExecuteExpiry:
+		return fmt.Sprintf("execute expiry of release %q in namespace %q missed at %s", a.Release, a.Namespace, a.Detail)
+	case ActionExpire:
+		return fmt.Sprintf("uninstall release %q in namespace %q expired at %s", a.Release, a.Namespace, a.Detail)
+	default:
+		if a.Namespace == "" {
+			return fmt.Sprintf("prune orphaned %s (cluster-scoped)", a.Resource)
+		}
+
+		return fmt.Sprintf("prune orphaned %s in namespace %s", a.Resource, a.Namespace)
+	}
+}
+
+// Options configures the controller.
+type Options struct {
+	// DryRun reports planned actions without making them. It is required
+	// unless the client keeps TTLs with a backend running no Jobs, whose
+	// expiries are the only actions the controller makes.
+	DryRun bool
+	// NewConfig returns the Helm configuration expiries uninstall releases
+	// with. It is required to expire TTLs.
+	NewConfig func(namespace, driver string) (*action.Configuration, error)
+	// ResyncPeriod is how often the plan is recomputed when no resource
+	// changes.
+	ResyncPeriod time.Duration
+	// MetricsAddr serves /metrics and /healthz when non-empty.
+	MetricsAddr string
+	// Log receives a line for each newly planned action.
+	Log io.Writer
+}
+
+// Controller plans TTL actions from shared informer caches.
+type Controller struct {
+	opts      Options
+	client    kubernetes.Interface
+	expires   bool
+	logger    *log.Logger
+	factories []informers.SharedInformerFactory
+	trigger   chan struct{}
+
+	cronJobs        cache.Store
+	releases        cache.Store
+	policies        cache.Store
+	namespaces      cache.Store
+	orphanCandidate map[string]cache.Store
+
+	mu       sync.Mutex
+	plan     []Action
+	reported map[Action]bool
+	lastRun  time.Time
+}
+
+// New creates a controller watching the whole cluster.
+func New(client kubernetes.Interface, opts Options) (*Controller, error) {
+	// Backends running no uninstall Jobs leave expiries to the controller
+	expires := !ttl.BackendOf(client).RunsJobs()
+	if !opts.DryRun && !expires {
+		return nil, fmt.Errorf("only audit mode is implemented for TTLs of the %s backend; run the controller with --dry-run, or keep TTLs with --backend %s or %s",
+			ttl.BackendOf(client).Name(), ttl.BackendController, ttl.BackendReleaseTTL)
+	}
+	if !opts.DryRun && opts.NewConfig == nil {
+		return nil, errors.New("expiring TTLs needs a Helm configuration")
+	}
+
+	if opts.ResyncPeriod <= 0 {
+		opts.ResyncPeriod = time.Minute
+	}
+
+	if opts.Log == nil {
+		opts.Log = io.Discard
+	}
+
+	managed := informers.NewSharedInformerFactoryWithOptions(client, opts.ResyncPeriod,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = labels.Set{ttl.LabelManagedBy: ttl.LabelManagedByValue}.String()
+		}))
+	helmReleases := informers.NewSharedInformerFactoryWithOptions(client, opts.ResyncPeriod,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = labels.Set{"owner": "helm", "status": "deployed"}.String()
+		}))
+	policies := informers.NewSharedInformerFactoryWithOptions(client, opts.ResyncPeriod,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", policy.ConfigMapName).String()
+		}))
+	cluster := informers.NewSharedInformerFactory(client, opts.ResyncPeriod)
+
+	c := &Controller{
+		opts:      opts,
+		client:    client,
+		expires:   expires,
+		logger:    log.New(opts.Log, "", log.LstdFlags),
+		factories: []informers.SharedInformerFactory{managed, helmReleases, policies, cluster},
+		trigger:   make(chan struct{}, 1),
+		reported:  map[Action]bool{},
+	}
+
+	c.cronJobs = c.watch(managed.Batch().V1().CronJobs().Informer())
+	c.releases = c.watch(helmReleases.Core().V1().Secrets().Informer())
+	c.policies = c.watch(policies.Core().V1().ConfigMaps().Informer())
+	c.namespaces = c.watch(cluster.Core().V1().Namespaces().Informer())
+	c.orphanCandidate = map[string]cache.Store{
+		"ServiceAccount":     c.watch(managed.Core().V1().ServiceAccounts().Informer()),
+		"Role":               c.watch(managed.Rbac().V1().Roles().Informer()),
+		"RoleBinding":        c.watch(managed.Rbac().V1().RoleBindings().Informer()),
+		"ClusterRole":        c.watch(managed.Rbac().V1().ClusterRoles().Informer()),
+		"ClusterRoleBinding": c.watch(managed.Rbac().V1().ClusterRoleBindings().Informer()),
+	}
+
+	return c, nil
+}
+
+// watch replans on every change to the informer's resources.
+func (c *Controller) watch(informer cache.SharedIndexInformer) cache.Store {
+	replan := func() {
+		select {
+		case c.trigger <- struct{}{}:
+		default:
+		}
+	}
+
+	_, _ = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { replan() },
+		UpdateFunc: func(any, any) { replan() },
+		DeleteFunc: func(any) { replan() },
+	})
+
+	return informer.GetStore()
+}
+
+// Start starts the informers and waits for their caches to fill.
+func (c *Controller) Start(ctx context.Context) error {
+	for _, f := range c.factories {
+		f.Start(ctx.Done())
+	}
+
+	for _, f := range c.factories {
+		for informerType, ok := range f.WaitForCacheSync(ctx.Done()) {
+			if !ok {
+				return fmt.Errorf("failed to sync %v informer cache", informerType)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Run starts the informers and reports the plan whenever a watched
+// resource changes or ResyncPeriod passes, until ctx is cancelled.
+func (c *Controller) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	if c.opts.MetricsAddr != "" {
+		server := &http.Server{
+			Addr:              c.opts.MetricsAddr,
+			Handler:           c.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			errCh <- server.ListenAndServe()
+		}()
+
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+
+			_ = server.Shutdown(shutdownCtx)
+		}()
+	}
+
+	if err := c.Start(ctx); err != nil {
+		return err
+	}
+
+	if c.opts.DryRun {
+		c.logger.Printf("dry-run: audit mode, no changes will be made")
+	} else {
+		c.logger.Printf("expiring TTLs of the %s backend; other actions are only reported", ttl.BackendOf(c.client).Name())
+	}
+
+	ticker := time.NewTicker(c.opts.ResyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		c.Reconcile(ctx, time.Now())
+
+		select {
+		case err := <-errCh:
+			return fmt.Errorf("metrics server failed: %w", err)
+		case <-ctx.Done():
+			return nil
+		case <-c.trigger:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile recomputes the plan and logs the actions that were not in the
+// previous one. Outside dry-run it expires the TTLs planned for expiry,
+// retrying failed ones on every reconcile.
+func (c *Controller) Reconcile(ctx context.Context, now time.Time) {
+	plan := c.Plan(now)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prefix := "dry-run: "
+	if !c.opts.DryRun {
+		prefix = "audit: "
+	}
+
+	reported := make(map[Action]bool, len(plan))
+	for _, a := range plan {
+		if a.Type == ActionExpire && !c.opts.DryRun {
+			c.expire(ctx, a)
+			continue
+		}
+
+		if !c.reported[a] {
+			c.logger.Printf("%swould %s", prefix, a)
+		}
+
+		reported[a] = true
+	}
+
+	c.plan, c.reported, c.lastRun = plan, reported, now
+}
+
+// expire uninstalls the release of an ActionExpire and deletes its TTL.
+func (c *Controller) expire(ctx context.Context, a Action) {
+	cj := c.ttlOf(a.Release, a.Namespace)
+	if cj == nil {
+		return
+	}
+
+	if err := ttl.ExpireTTL(ctx, c.client, cj, c.opts.NewConfig); err != nil {
+		c.logger.Printf("failed to %s: %v", a, err)
+		return
+	}
+
+	c.logger.Printf("uninstalled release %q in namespace %q: TTL expired at %s", a.Release, a.Namespace, a.Detail)
+}
+
+// ttlOf returns the cached release TTL of a release, if any.
+func (c *Controller) ttlOf(release, namespace string) *batchv1.CronJob {
+	for _, obj := range c.cronJobs.List() {
+		cj, ok := obj.(*batchv1.CronJob)
+		if !ok || ttl.IsNamespaceTTL(cj) {
+			continue
+		}
+
+		if ttl.OriginalLabelValue(cj, ttl.LabelRelease) == release && ttl.OriginalLabelValue(cj, ttl.LabelReleaseNamespace) == namespace {
+			return cj
+		}
+	}
+
+	return nil
+}
+
+// Plan lists the actions the controller would take, from the informer
+// caches. Protected releases and namespaces are left alone. With a
+// backend running no Jobs, whose TTLs need no ServiceAccount or RBAC,
+// expired TTLs are planned for expiry and no orphans are looked for.
+func (c *Controller) Plan(now time.Time) []Action {
+	// Deployed releases, by namespace/name, and whether each is protected
+	releases := map[string]bool{}
+	for _, obj := range c.releases.List() {
+		if secret, ok := obj.(*corev1.Secret); ok {
+			releases[secret.Namespace+"/"+secret.Labels["name"]] = ttl.IsProtected(secret) || c.protectedNamespace(secret.Namespace)
+		}
+	}
+
+	var plan []Action
+	existing := map[string]bool{}
+	for _, obj := range c.cronJobs.List() {
+		cj, ok := obj.(*batchv1.CronJob)
+		if !ok {
+			continue
+		}
+
+		ns, name := ttl.OwningCronJob(cj)
+		existing[ns+"/"+name] = true
+		if ttl.IsNamespaceTTL(cj) {
+			continue
+		}
+
+		info, err := ttl.CronJobInfo(cj, now)
+		if err != nil {
+			continue
+		}
+
+		key := info.ReleaseNamespace + "/" + info.ReleaseName
+		protected := releases[key] || c.protectedNamespace(info.ReleaseNamespace)
+		delete(releases, key)
+
+		if protected {
+			continue
+		}
+
+		if c.expires {
+			expiresAt, err := time.Parse(time.RFC3339, cj.Annotations[ttl.AnnotationExpiresAt])
+			if err == nil && !now.Before(expiresAt) {
+				plan = append(plan, Action{Type: ActionExpire, Release: info.ReleaseName, Namespace: info.ReleaseNamespace, Detail: ttl.FormatScheduledDate(expiresAt)})
+			}
+		} else if info.Missed {
+			plan = append(plan, Action{Type: ActionExecuteExpiry, Release: info.ReleaseName, Namespace: info.ReleaseNamespace, Detail: info.ScheduledDate})
+		}
+	}
+
+	// The releases left have no TTL
+	policies := map[string]*policy.Policy{}
+	for key, protected := range releases {
+		if protected {
+			continue
+		}
+
+		namespace, name, _ := strings.Cut(key, "/")
+		pol, seen := policies[namespace]
+		if !seen {
+			var err error
+			pol, err = c.policy(namespace)
+			if err != nil {
+				c.logger.Printf("skipping namespace %q: %v", namespace, err)
+			}
+
+			policies[namespace] = pol
+		}
+
+		if pol == nil || pol.DefaultDuration == "" {
+			continue
+		}
+
+		plan = append(plan, Action{Type: ActionCreateTTL, Release: name, Namespace: namespace, Detail: pol.DefaultDuration})
+	}
+
+	orphanCandidate := c.orphanCandidate
+	if c.expires {
+		orphanCandidate = nil
+	}
+
+	for kind, store := range orphanCandidate {
+		for _, obj := range store.List() {
+			meta, ok := obj.(metav1.Object)
+			if !ok {
+				continue
+			}
+
+			ns, name := ttl.OwningCronJob(meta)
+			if existing[ns+"/"+name] {
+				continue
+			}
+
+			plan = append(plan, Action{Type: ActionPruneOrphan, Namespace: meta.GetNamespace(), Resource: kind + " " + meta.GetName()})
+		}
+	}
+
+	sort.Slice(plan, func(i, j int) bool {
+		return plan[i].String() < plan[j].String()
+	})
+
+	return plan
+}
+
+// policy returns the TTL policy of a namespace from the cache.
+func (c *Controller) policy(namespace string) (*policy.Policy, error) {
+	obj, exists, err := c.policies.GetByKey(namespace + "/" + policy.ConfigMapName)
+	if err != nil || !exists {
+		return &policy.Policy{Namespace: namespace}, err
+	}
+
+	return policy.FromConfigMap(obj.(*corev1.ConfigMap))
+}
+
+// protectedNamespace reports whether a namespace is marked protected.
+func (c *Controller) protectedNamespace(namespace string) bool {
+	obj, exists, err := c.namespaces.GetByKey(namespace)
+	if err != nil || !exists {
+		return false
+	}
+
+	return ttl.IsProtected(obj.(*corev1.Namespace))
+}
+
+// Handler serves the planned action counts on /metrics in the Prometheus
+// text format, and a /healthz probe.
+func (c *Controller) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		c.mu.Lock()
+		counts := map[ActionType]int{}
+		for _, a := range c.plan {
+			counts[a.Type]++
+		}
+		lastRun := c.lastRun
+		c.mu.Unlock()
+
+		dryRun := func(t ActionType) bool {
+			return c.opts.DryRun || t != ActionExpire
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = fmt.Fprintln(w, "# HELP helm_ttl_controller_planned_actions Actions the controller would take.")
+		_, _ = fmt.Fprintln(w, "# TYPE helm_ttl_controller_planned_actions gauge")
+		for _, t := range ActionTypes {
+			_, _ = fmt.Fprintf(w, "helm_ttl_controller_planned_actions{action=%q,dry_run=\"%t\"} %d\n", t, dryRun(t), counts[t])
+		}
+
+		_, _ = fmt.Fprintln(w, "# HELP helm_ttl_controller_last_reconcile_timestamp_seconds Time of the last reconcile.")
+		_, _ = fmt.Fprintln(w, "# TYPE helm_ttl_controller_last_reconcile_timestamp_seconds gauge")
+		if lastRun.IsZero() {
+			_, _ = fmt.Fprintln(w, "helm_ttl_controller_last_reconcile_timestamp_seconds 0")
+		} else {
+			_, _ = fmt.Fprintf(w, "helm_ttl_controller_last_reconcile_timestamp_seconds %d\n", lastRun.Unix())
+		}
+	})
+
+	return mux
+}
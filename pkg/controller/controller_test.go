@@ -0,0 +1,490 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"github.com/josegonzalez/helm-ttl/pkg/api/v1alpha1"
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+)
+
+// syncBuffer is a bytes.Buffer safe for the controller goroutine to write
+// while the test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func releaseSecret(name, namespace string, labels map[string]string) *corev1.Secret {
+	l := map[string]string{"owner": "helm", "status": "deployed", "name": name}
+	for k, v := range labels {
+		l[k] = v
+	}
+
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      "sh.helm.release.v1." + name + ".v1",
+		Namespace: namespace,
+		Labels:    l,
+	}}
+}
+
+func policyConfigMap(namespace, defaultDuration string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: policy.ConfigMapName, Namespace: namespace},
+		Data:       map[string]string{policy.KeyDefaultDuration: defaultDuration},
+	}
+}
+
+func namespace(name string, protected bool) *corev1.Namespace {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if protected {
+		ns.Labels = map[string]string{ttl.LabelProtected: "true"}
+	}
+
+	return ns
+}
+
+// missedCronJob builds a TTL CronJob for 15 March 2025, set on 1 March.
+func missedCronJob(t *testing.T, release, ns string) *batchv1.CronJob {
+	t.Helper()
+	cj, err := ttl.BuildCronJob(ttl.CronJobOptions{
+		ReleaseName:      release,
+		ReleaseNamespace: ns,
+		CronjobNamespace: ns,
+		Schedule:         "30 14 15 3 *",
+		ServiceAccount:   "default",
+	})
+	require.NoError(t, err)
+	cj.CreationTimestamp = metav1.NewTime(time.Date(2025, time.March, 1, 0, 0, 0, 0, time.Local))
+
+	return cj
+}
+
+func managedServiceAccount(release, ns string) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name:      release + "-" + ns + "-ttl",
+		Namespace: ns,
+		Labels: map[string]string{
+			ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+			ttl.LabelRelease:          release,
+			ttl.LabelReleaseNamespace: ns,
+			ttl.LabelCronjobNamespace: ns,
+		},
+	}}
+}
+
+func startedController(t *testing.T, objects ...runtime.Object) *Controller {
+	t.Helper()
+
+	c, err := New(fake.NewClientset(objects...), Options{DryRun: true})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	require.NoError(t, c.Start(ctx))
+
+	return c
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(fake.NewClientset(), Options{})
+	assert.ErrorContains(t, err, "only audit mode is implemented")
+
+	c, err := New(fake.NewClientset(), Options{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, c.opts.ResyncPeriod)
+}
+
+func TestPlan(t *testing.T) {
+	now := time.Date(2025, time.April, 1, 0, 0, 0, 0, time.Local)
+
+	t.Run("empty cluster", func(t *testing.T) {
+		c := startedController(t)
+		assert.Empty(t, c.Plan(now))
+	})
+
+	t.Run("create TTL from namespace default", func(t *testing.T) {
+		c := startedController(t,
+			namespace("dev", false),
+			policyConfigMap("dev", "7d"),
+			releaseSecret("web", "dev", nil),
+			releaseSecret("shared", "dev", map[string]string{ttl.LabelProtected: "true"}),
+			namespace("prod", true),
+			policyConfigMap("prod", "7d"),
+			releaseSecret("api", "prod", nil),
+			releaseSecret("cache", "staging", nil),
+		)
+
+		assert.Equal(t, []Action{
+			{Type: ActionCreateTTL, Release: "web", Namespace: "dev", Detail: "7d"},
+		}, c.Plan(now))
+	})
+
+	t.Run("release with a TTL", func(t *testing.T) {
+		cj := missedCronJob(t, "web", "dev")
+		cj.CreationTimestamp = metav1.NewTime(now)
+
+		c := startedController(t, policyConfigMap("dev", "7d"), releaseSecret("web", "dev", nil), cj)
+		assert.Empty(t, c.Plan(now))
+	})
+
+	t.Run("execute missed expiry", func(t *testing.T) {
+		c := startedController(t,
+			missedCronJob(t, "web", "dev"),
+			missedCronJob(t, "shared", "dev"),
+			releaseSecret("shared", "dev", map[string]string{ttl.LabelProtected: "true"}),
+			namespace("prod", true),
+			missedCronJob(t, "api", "prod"),
+		)
+
+		plan := c.Plan(now)
+		require.Len(t, plan, 1)
+		assert.Equal(t, ActionExecuteExpiry, plan[0].Type)
+		assert.Equal(t, "web", plan[0].Release)
+		assert.Contains(t, plan[0].String(), `execute expiry of release "web" in namespace "dev" missed at 2025-03-15T14:30:00`)
+	})
+
+	t.Run("prune orphans", func(t *testing.T) {
+		sa := managedServiceAccount("gone", "dev")
+		c := startedController(t,
+			managedServiceAccount("gone", "dev"),
+			managedServiceAccount("web", "dev"),
+			missedCronJob(t, "web", "dev"),
+			&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: sa.Name, Labels: sa.Labels}},
+		)
+
+		plan := c.Plan(now)
+		var prune []string
+		for _, a := range plan {
+			if a.Type == ActionPruneOrphan {
+				prune = append(prune, a.String())
+			}
+		}
+
+		assert.Equal(t, []string{
+			"prune orphaned ClusterRoleBinding gone-dev-ttl (cluster-scoped)",
+			"prune orphaned ServiceAccount gone-dev-ttl in namespace dev",
+		}, prune)
+	})
+
+	t.Run("CronJob named before names were hashed keeps its RBAC", func(t *testing.T) {
+		cj := missedCronJob(t, "web", "dev")
+		cj.Name = "web-dev-ttl"
+		cj.CreationTimestamp = metav1.NewTime(now)
+
+		c := startedController(t, managedServiceAccount("web", "dev"), cj, releaseSecret("web", "dev", nil))
+		assert.Empty(t, c.Plan(now))
+	})
+
+	t.Run("namespace TTL is neither executed nor pruned", func(t *testing.T) {
+		cj, err := ttl.BuildNamespaceCronJob(ttl.NamespaceCronJobOptions{
+			Namespace:        "preview",
+			CronjobNamespace: "ops",
+			Schedule:         "30 14 15 3 *",
+			ServiceAccount:   "default",
+		})
+		require.NoError(t, err)
+		cj.CreationTimestamp = metav1.NewTime(time.Date(2025, time.March, 1, 0, 0, 0, 0, time.Local))
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name:      cj.Name,
+			Namespace: "ops",
+			Labels: map[string]string{
+				ttl.LabelManagedBy:        ttl.LabelManagedByValue,
+				ttl.LabelNamespace:        "preview",
+				ttl.LabelCronjobNamespace: "ops",
+			},
+		}}
+
+		c := startedController(t, cj, sa)
+		assert.Empty(t, c.Plan(now))
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		var log bytes.Buffer
+		c, err := New(fake.NewClientset(
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: policy.ConfigMapName, Namespace: "dev"},
+				Data:       map[string]string{policy.KeyMaxDuration: "forever"},
+			},
+			releaseSecret("web", "dev", nil),
+			releaseSecret("api", "dev", nil),
+		), Options{DryRun: true, Log: &log})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		require.NoError(t, c.Start(ctx))
+
+		assert.Empty(t, c.Plan(now))
+		assert.Equal(t, 1, strings.Count(log.String(), `skipping namespace "dev"`))
+	})
+}
+
+func TestReconcile(t *testing.T) {
+	var log bytes.Buffer
+	c, err := New(fake.NewClientset(policyConfigMap("dev", "7d"), releaseSecret("web", "dev", nil)), Options{DryRun: true, Log: &log})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, c.Start(ctx))
+
+	c.Reconcile(context.Background(), time.Now())
+	c.Reconcile(context.Background(), time.Now())
+	assert.Equal(t, 1, strings.Count(log.String(), `dry-run: would create TTL of 7d for release "web" in namespace "dev"`))
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `helm_ttl_controller_planned_actions{action="create-ttl",dry_run="true"} 1`)
+	assert.Contains(t, rec.Body.String(), `helm_ttl_controller_planned_actions{action="prune-orphan",dry_run="true"} 0`)
+	assert.NotContains(t, rec.Body.String(), "helm_ttl_controller_last_reconcile_timestamp_seconds 0\n")
+
+	rec = httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandler_BeforeReconcile(t *testing.T) {
+	c, err := New(fake.NewClientset(), Options{DryRun: true})
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), "helm_ttl_controller_last_reconcile_timestamp_seconds 0\n")
+}
+
+func TestRun(t *testing.T) {
+	t.Run("reports changes until cancelled", func(t *testing.T) {
+		client := fake.NewClientset(policyConfigMap("dev", "7d"))
+		var log syncBuffer
+		c, err := New(client, Options{DryRun: true, Log: &log, ResyncPeriod: time.Hour, MetricsAddr: "127.0.0.1:0"})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- c.Run(ctx) }()
+
+		require.Eventually(t, func() bool {
+			return strings.Contains(log.String(), "audit mode")
+		}, 5*time.Second, 10*time.Millisecond)
+
+		_, err = client.CoreV1().Secrets("dev").Create(context.Background(), releaseSecret("web", "dev", nil), metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			return strings.Contains(log.String(), `would create TTL of 7d for release "web"`)
+		}, 5*time.Second, 10*time.Millisecond)
+
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("metrics server error", func(t *testing.T) {
+		c, err := New(fake.NewClientset(), Options{DryRun: true, Log: io.Discard, MetricsAddr: "invalid-address"})
+		require.NoError(t, err)
+
+		err = c.Run(context.Background())
+		assert.ErrorContains(t, err, "metrics server failed")
+	})
+
+	t.Run("cancelled before caches sync", func(t *testing.T) {
+		c, err := New(fake.NewClientset(), Options{DryRun: true})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err = c.Run(ctx)
+		assert.ErrorContains(t, err, "failed to sync")
+	})
+}
+
+// helmConfig returns a Helm configuration holding a deployed release.
+func helmConfig(t *testing.T, name, namespace string) *action.Configuration {
+	t.Helper()
+
+	store := storage.Init(driver.NewMemory())
+	require.NoError(t, store.Create(&release.Release{
+		Name:      name,
+		Namespace: namespace,
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "test-chart", Version: "1.0.0"}},
+	}))
+
+	return &action.Configuration{
+		Releases:   store,
+		KubeClient: &kubefake.PrintingKubeClient{Out: io.Discard},
+		Log:        func(string, ...interface{}) {},
+	}
+}
+
+// controllerTTL keeps a TTL of the controller backend expiring on 15
+// March 2025 through client.
+func controllerTTL(t *testing.T, client kubernetes.Interface, release, ns string) {
+	t.Helper()
+
+	cj, err := ttl.BuildCronJob(ttl.CronJobOptions{
+		ReleaseName:      release,
+		ReleaseNamespace: ns,
+		CronjobNamespace: ns,
+		Schedule:         "30 14 15 3 *",
+		ExpiresAt:        time.Date(2025, time.March, 15, 14, 30, 0, 0, time.Local),
+	})
+	require.NoError(t, err)
+
+	_, err = client.BatchV1().CronJobs(ns).Create(context.Background(), cj, metav1.CreateOptions{})
+	require.NoError(t, err)
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Date(2025, time.April, 1, 0, 0, 0, 0, time.Local)
+	setup := func(t *testing.T, objects ...runtime.Object) (*fake.Clientset, kubernetes.Interface) {
+		t.Helper()
+
+		client := fake.NewClientset(objects...)
+		wrapped, err := ttl.WithBackend(client, ttl.BackendController)
+		require.NoError(t, err)
+		controllerTTL(t, wrapped, "web", "dev")
+
+		return client, wrapped
+	}
+	start := func(t *testing.T, c *Controller) {
+		t.Helper()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		require.NoError(t, c.Start(ctx))
+	}
+
+	t.Run("needs a Helm configuration", func(t *testing.T) {
+		_, wrapped := setup(t)
+
+		_, err := New(wrapped, Options{})
+		assert.ErrorContains(t, err, "needs a Helm configuration")
+	})
+
+	t.Run("plans expired TTLs", func(t *testing.T) {
+		_, wrapped := setup(t,
+			releaseSecret("shared", "dev", map[string]string{ttl.LabelProtected: "true"}),
+			managedServiceAccount("gone", "dev"),
+		)
+		controllerTTL(t, wrapped, "shared", "dev")
+
+		c, err := New(wrapped, Options{DryRun: true})
+		require.NoError(t, err)
+		start(t, c)
+
+		assert.Equal(t, []Action{
+			{Type: ActionExpire, Release: "web", Namespace: "dev", Detail: ttl.FormatScheduledDate(time.Date(2025, time.March, 15, 14, 30, 0, 0, time.Local))},
+		}, c.Plan(now))
+		assert.Empty(t, c.Plan(time.Date(2025, time.March, 1, 0, 0, 0, 0, time.Local)))
+	})
+
+	t.Run("uninstalls expired releases", func(t *testing.T) {
+		client, wrapped := setup(t)
+		cfg := helmConfig(t, "web", "dev")
+
+		var log bytes.Buffer
+		c, err := New(wrapped, Options{Log: &log, NewConfig: func(string, string) (*action.Configuration, error) {
+			return cfg, nil
+		}})
+		require.NoError(t, err)
+		start(t, c)
+
+		c.Reconcile(context.Background(), now)
+		assert.Contains(t, log.String(), `uninstalled release "web" in namespace "dev"`)
+
+		_, err = cfg.Releases.Deployed("web")
+		assert.Error(t, err)
+		_, err = client.CoreV1().ConfigMaps("dev").Get(context.Background(), "web-39aa3d06-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+
+		rec := httptest.NewRecorder()
+		c.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Contains(t, rec.Body.String(), `helm_ttl_controller_planned_actions{action="expire",dry_run="false"} 1`)
+		assert.Contains(t, rec.Body.String(), `helm_ttl_controller_planned_actions{action="create-ttl",dry_run="true"} 0`)
+	})
+
+	t.Run("retries failed expiries", func(t *testing.T) {
+		client, wrapped := setup(t)
+
+		var log bytes.Buffer
+		c, err := New(wrapped, Options{Log: &log, NewConfig: func(string, string) (*action.Configuration, error) {
+			return nil, errors.New("cluster unreachable")
+		}})
+		require.NoError(t, err)
+		start(t, c)
+
+		c.Reconcile(context.Background(), now)
+		c.Reconcile(context.Background(), now)
+		assert.Equal(t, 2, strings.Count(log.String(), `failed to uninstall release "web" in namespace "dev" expired at`))
+
+		_, err = client.CoreV1().ConfigMaps("dev").Get(context.Background(), "web-39aa3d06-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("expires ReleaseTTLs", func(t *testing.T) {
+		dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+			v1alpha1.Resource: "ReleaseTTLList",
+		})
+		wrapped := ttl.WithReleaseTTLs(fake.NewClientset(), dyn)
+		controllerTTL(t, wrapped, "web", "dev")
+		cfg := helmConfig(t, "web", "dev")
+
+		var log bytes.Buffer
+		c, err := New(wrapped, Options{Log: &log, NewConfig: func(string, string) (*action.Configuration, error) {
+			return cfg, nil
+		}})
+		require.NoError(t, err)
+		start(t, c)
+
+		c.Reconcile(context.Background(), now)
+		assert.Contains(t, log.String(), `uninstalled release "web" in namespace "dev"`)
+
+		_, err = dyn.Resource(v1alpha1.Resource).Namespace("dev").Get(context.Background(), "web-39aa3d06-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// FailureWebhookEnv holds, in the containers of an uninstall Job, the
+	// URL a failing step reports to.
+	FailureWebhookEnv = "HELM_TTL_FAILURE_WEBHOOK"
+	// FailureContainerEnv holds the name of the container reporting.
+	FailureContainerEnv = "HELM_TTL_CONTAINER"
+	// FailureProxyEnv holds the URL of the proxy a failing step reports
+	// through. Unlike HTTPS_PROXY, it leaves the requests of the step to
+	// the API server alone.
+	FailureProxyEnv = "HELM_TTL_FAILURE_PROXY"
+	// FailureCABundleEnv holds PEM certificates a failing step trusts,
+	// besides the system roots, when reporting.
+	FailureCABundleEnv = "HELM_TTL_FAILURE_CA_BUNDLE"
+)
+
+// FailureReport is the JSON body posted to the --on-failure-webhook of a
+// TTL when a step of its uninstall Job fails.
+type FailureReport struct {
+	Release   string `json:"release"`
+	Namespace string `json:"namespace"`
+	Container string `json:"container"`
+	Pod       string `json:"pod"`
+	ExitCode  int    `json:"exitCode"`
+	Logs      string `json:"logs"`
+}
+
+// PostFailureReport posts report as JSON to url. Any status other than
+// 2xx is an error.
+func PostFailureReport(ctx context.Context, client *http.Client, url string, report FailureReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode failure report: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build failure report request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post failure report: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failure webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostFailureReport(t *testing.T) {
+	ctx := context.Background()
+	report := FailureReport{
+		Release:   "myapp",
+		Namespace: "staging",
+		Container: "helm-uninstall",
+		Pod:       "myapp-4a0c226a-ttl-29000000-abcde",
+		ExitCode:  1,
+		Logs:      "Error: uninstall: timed out\n",
+	}
+
+	t.Run("posts JSON", func(t *testing.T) {
+		var got FailureReport
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		require.NoError(t, PostFailureReport(ctx, server.Client(), server.URL, report))
+		assert.Equal(t, report, got)
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		err := PostFailureReport(ctx, server.Client(), server.URL, report)
+		assert.EqualError(t, err, "failure webhook returned 502 Bad Gateway")
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		err := PostFailureReport(ctx, server.Client(), server.URL, report)
+		assert.ErrorContains(t, err, "failed to post failure report")
+	})
+
+	t.Run("invalid URL", func(t *testing.T) {
+		err := PostFailureReport(ctx, http.DefaultClient, "http://[::1", report)
+		assert.ErrorContains(t, err, "failed to build failure report request")
+	})
+}
@@ -0,0 +1,116 @@
+// Package notify contains the plumbing shared by helm-ttl's outbound
+// notification integrations (webhooks, metrics push endpoints, CloudEvents).
+package notify
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultTimeout bounds every outbound notification request.
+const defaultTimeout = 10 * time.Second
+
+// HTTPClientOptions configures the HTTP client used for notifications.
+// Empty fields fall back to the HELM_TTL_* environment variables, then to
+// helm's HELM_KUBECAFILE and HELM_KUBEINSECURE_SKIP_TLS_VERIFY, so a CA
+// trusted for the cluster, e.g. that of a TLS-intercepting proxy, is
+// trusted for notifications too.
+type HTTPClientOptions struct {
+	CAFile string
+	// CAData holds PEM certificates trusted besides those of CAFile.
+	CAData                []byte
+	InsecureSkipTLSVerify bool
+	Timeout               time.Duration
+	// Proxy, when set, is the URL of the proxy every request goes
+	// through, in place of the environment.
+	Proxy string
+}
+
+// HTTPClientFactory builds the HTTP client used for outbound notifications.
+// Callers inject their own factory in tests.
+type HTTPClientFactory func(opts HTTPClientOptions) (*http.Client, error)
+
+// DefaultHTTPClientFactory is the factory used when none is injected.
+var DefaultHTTPClientFactory HTTPClientFactory = NewHTTPClient
+
+// NewHTTPClient returns an HTTP client that honors HTTPS_PROXY, HTTP_PROXY
+// and NO_PROXY unless given a proxy, trusts the system roots plus any
+// custom CA bundle, and applies a request timeout.
+func NewHTTPClient(opts HTTPClientOptions) (*http.Client, error) {
+	caFile := cmp.Or(opts.CAFile, os.Getenv("HELM_TTL_CA_FILE"), os.Getenv("HELM_KUBECAFILE"))
+
+	insecure := opts.InsecureSkipTLSVerify
+	if !insecure {
+		v := cmp.Or(os.Getenv("HELM_TTL_INSECURE_SKIP_TLS_VERIFY"), os.Getenv("HELM_KUBEINSECURE_SKIP_TLS_VERIFY"))
+		insecure, _ = strconv.ParseBool(v)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecure,
+	}
+
+	if caFile != "" || len(opts.CAData) > 0 {
+		pool, err := loadCertPool(caFile, opts.CAData)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		proxy, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", opts.Proxy, err)
+		}
+
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
+
+// loadCertPool returns the system cert pool extended with the PEM
+// certificates found in caFile, if any, and in caData.
+func loadCertPool(caFile string, caData []byte) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %w", caFile, err)
+		}
+
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no valid PEM certificates found in CA file %s", caFile)
+		}
+	}
+
+	if len(caData) > 0 && !pool.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("no valid PEM certificates found in CA data")
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,189 @@
+package notify
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeServerCA writes the test server's certificate to a PEM file.
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	return path
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Setenv("HELM_TTL_CA_FILE", "")
+		t.Setenv("HELM_TTL_INSECURE_SKIP_TLS_VERIFY", "")
+		t.Setenv("HELM_KUBECAFILE", "")
+		t.Setenv("HELM_KUBEINSECURE_SKIP_TLS_VERIFY", "")
+
+		client, err := NewHTTPClient(HTTPClientOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, defaultTimeout, client.Timeout)
+
+		transport, ok := client.Transport.(*http.Transport)
+		require.True(t, ok)
+		assert.NotNil(t, transport.Proxy)
+		assert.False(t, transport.TLSClientConfig.InsecureSkipVerify)
+	})
+
+	t.Run("untrusted server is rejected", func(t *testing.T) {
+		t.Setenv("HELM_TTL_CA_FILE", "")
+		t.Setenv("HELM_TTL_INSECURE_SKIP_TLS_VERIFY", "")
+		t.Setenv("HELM_KUBECAFILE", "")
+		t.Setenv("HELM_KUBEINSECURE_SKIP_TLS_VERIFY", "")
+
+		client, err := NewHTTPClient(HTTPClientOptions{})
+		require.NoError(t, err)
+
+		_, err = client.Get(server.URL)
+		assert.Error(t, err)
+	})
+
+	t.Run("custom CA file is trusted", func(t *testing.T) {
+		client, err := NewHTTPClient(HTTPClientOptions{
+			CAFile:  writeServerCA(t, server),
+			Timeout: time.Second,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, time.Second, client.Timeout)
+
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+
+	t.Run("CA file from environment", func(t *testing.T) {
+		t.Setenv("HELM_TTL_CA_FILE", writeServerCA(t, server))
+
+		client, err := NewHTTPClient(HTTPClientOptions{})
+		require.NoError(t, err)
+
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	})
+
+	t.Run("insecure skip verify from environment", func(t *testing.T) {
+		t.Setenv("HELM_TTL_CA_FILE", "")
+		t.Setenv("HELM_TTL_INSECURE_SKIP_TLS_VERIFY", "true")
+
+		client, err := NewHTTPClient(HTTPClientOptions{})
+		require.NoError(t, err)
+
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	})
+
+	t.Run("CA data is trusted", func(t *testing.T) {
+		t.Setenv("HELM_TTL_CA_FILE", "")
+		t.Setenv("HELM_TTL_INSECURE_SKIP_TLS_VERIFY", "")
+
+		client, err := NewHTTPClient(HTTPClientOptions{
+			CAData: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+		})
+		require.NoError(t, err)
+
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	})
+
+	t.Run("invalid CA data", func(t *testing.T) {
+		_, err := NewHTTPClient(HTTPClientOptions{CAData: []byte("not a certificate")})
+		assert.EqualError(t, err, "no valid PEM certificates found in CA data")
+	})
+
+	t.Run("proxy replaces the environment", func(t *testing.T) {
+		t.Setenv("HTTPS_PROXY", "http://env-proxy.example.com:3128")
+
+		client, err := NewHTTPClient(HTTPClientOptions{Proxy: "http://proxy.example.com:3128"})
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "https://hooks.example.com/ttl", nil)
+		require.NoError(t, err)
+		proxy, err := client.Transport.(*http.Transport).Proxy(req)
+		require.NoError(t, err)
+		assert.Equal(t, "http://proxy.example.com:3128", proxy.String())
+	})
+
+	t.Run("invalid proxy", func(t *testing.T) {
+		_, err := NewHTTPClient(HTTPClientOptions{Proxy: "http://[::1"})
+		assert.ErrorContains(t, err, "invalid proxy URL")
+	})
+
+	t.Run("helm's CA file", func(t *testing.T) {
+		t.Setenv("HELM_TTL_CA_FILE", "")
+		t.Setenv("HELM_KUBECAFILE", writeServerCA(t, server))
+
+		client, err := NewHTTPClient(HTTPClientOptions{})
+		require.NoError(t, err)
+
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	})
+
+	t.Run("helm's insecure skip verify", func(t *testing.T) {
+		t.Setenv("HELM_TTL_CA_FILE", "")
+		t.Setenv("HELM_TTL_INSECURE_SKIP_TLS_VERIFY", "")
+		t.Setenv("HELM_KUBEINSECURE_SKIP_TLS_VERIFY", "true")
+
+		client, err := NewHTTPClient(HTTPClientOptions{})
+		require.NoError(t, err)
+		assert.True(t, client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+	})
+
+	t.Run("helm-ttl settings take precedence", func(t *testing.T) {
+		t.Setenv("HELM_TTL_CA_FILE", writeServerCA(t, server))
+		t.Setenv("HELM_KUBECAFILE", "/nonexistent/ca.pem")
+		t.Setenv("HELM_TTL_INSECURE_SKIP_TLS_VERIFY", "false")
+		t.Setenv("HELM_KUBEINSECURE_SKIP_TLS_VERIFY", "true")
+
+		client, err := NewHTTPClient(HTTPClientOptions{})
+		require.NoError(t, err)
+		assert.False(t, client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+	})
+
+	t.Run("missing CA file", func(t *testing.T) {
+		_, err := NewHTTPClient(HTTPClientOptions{CAFile: "/nonexistent/ca.pem"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to read CA file")
+	})
+
+	t.Run("invalid CA file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ca.pem")
+		require.NoError(t, os.WriteFile(path, []byte("not a certificate"), 0o600))
+
+		_, err := NewHTTPClient(HTTPClientOptions{CAFile: path})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no valid PEM certificates")
+	})
+}
+
+func TestDefaultHTTPClientFactory(t *testing.T) {
+	client, err := DefaultHTTPClientFactory(HTTPClientOptions{})
+	require.NoError(t, err)
+	assert.NotNil(t, client)
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StatsdPrefix is prepended to every metric name sent to statsd.
+const StatsdPrefix = "helm_ttl."
+
+// Statsd sends metrics to a statsd daemon over UDP, with DogStatsD-style
+// tags. Sends are best effort: a daemon that is down never fails the
+// command. A nil *Statsd discards everything, so callers need not check
+// whether metrics are configured.
+type Statsd struct {
+	conn net.Conn
+}
+
+// NewStatsd returns a client for the statsd daemon at addr (host:port).
+func NewStatsd(addr string) (*Statsd, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid statsd address %q: %w", addr, err)
+	}
+
+	return &Statsd{conn: conn}, nil
+}
+
+// StatsdFromEnv returns a client for HELM_TTL_STATSD_ADDR, or nil when it
+// is unset.
+func StatsdFromEnv() (*Statsd, error) {
+	return StatsdFromConfig("")
+}
+
+// StatsdFromConfig returns a client for HELM_TTL_STATSD_ADDR, or for addr,
+// the address from the plugin config, when the variable is unset. It
+// returns nil when neither is set.
+func StatsdFromConfig(addr string) (*Statsd, error) {
+	source := "statsdAddr"
+	if env := os.Getenv("HELM_TTL_STATSD_ADDR"); env != "" {
+		addr, source = env, "HELM_TTL_STATSD_ADDR"
+	}
+
+	if addr == "" {
+		return nil, nil
+	}
+
+	s, err := NewStatsd(addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	return s, nil
+}
+
+// Timing records a duration in milliseconds.
+func (s *Statsd) Timing(name string, d time.Duration, tags map[string]string) {
+	s.send(fmt.Sprintf("%s:%d|ms", name, d.Milliseconds()), tags)
+}
+
+// Count adds n to a counter.
+func (s *Statsd) Count(name string, n int64, tags map[string]string) {
+	s.send(fmt.Sprintf("%s:%d|c", name, n), tags)
+}
+
+// Close closes the connection to the daemon.
+func (s *Statsd) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	return s.conn.Close()
+}
+
+func (s *Statsd) send(metric string, tags map[string]string) {
+	if s == nil {
+		return
+	}
+
+	line := StatsdPrefix + metric
+	if len(tags) > 0 {
+		pairs := make([]string, 0, len(tags))
+		for k, v := range tags {
+			pairs = append(pairs, k+":"+v)
+		}
+		sort.Strings(pairs)
+		line += "|#" + strings.Join(pairs, ",")
+	}
+
+	_, _ = s.conn.Write([]byte(line))
+}
@@ -0,0 +1,97 @@
+package notify
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenStatsd returns a UDP listener standing in for a statsd daemon.
+func listenStatsd(t *testing.T) net.PacketConn {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func readPacket(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	return string(buf[:n])
+}
+
+func TestStatsd(t *testing.T) {
+	server := listenStatsd(t)
+
+	client, err := NewStatsd(server.LocalAddr().String())
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	client.Timing("extend.duration", 1500*time.Millisecond, map[string]string{"release": "web", "namespace": "dev"})
+	assert.Equal(t, "helm_ttl.extend.duration:1500|ms|#namespace:dev,release:web", readPacket(t, server))
+
+	client.Count("extend.errors", 2, nil)
+	assert.Equal(t, "helm_ttl.extend.errors:2|c", readPacket(t, server))
+}
+
+func TestStatsd_Nil(t *testing.T) {
+	var client *Statsd
+	client.Timing("extend.duration", time.Second, nil)
+	client.Count("extend.errors", 1, nil)
+	assert.NoError(t, client.Close())
+}
+
+func TestNewStatsd_InvalidAddress(t *testing.T) {
+	_, err := NewStatsd("no-port")
+	assert.ErrorContains(t, err, `invalid statsd address "no-port"`)
+}
+
+func TestStatsdFromEnv(t *testing.T) {
+	t.Setenv("HELM_TTL_STATSD_ADDR", "")
+	client, err := StatsdFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, client)
+
+	server := listenStatsd(t)
+	t.Setenv("HELM_TTL_STATSD_ADDR", server.LocalAddr().String())
+	client, err = StatsdFromEnv()
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	client.Count("extend.extended", 1, nil)
+	assert.Equal(t, "helm_ttl.extend.extended:1|c", readPacket(t, server))
+}
+
+func TestStatsdFromConfig(t *testing.T) {
+	t.Setenv("HELM_TTL_STATSD_ADDR", "")
+	client, err := StatsdFromConfig("")
+	require.NoError(t, err)
+	assert.Nil(t, client)
+
+	_, err = StatsdFromConfig("no-port")
+	assert.ErrorContains(t, err, "statsdAddr: invalid statsd address")
+
+	server := listenStatsd(t)
+	client, err = StatsdFromConfig(server.LocalAddr().String())
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	client.Count("run.succeeded", 1, nil)
+	assert.Equal(t, "helm_ttl.run.succeeded:1|c", readPacket(t, server))
+
+	// The environment wins over the config
+	t.Setenv("HELM_TTL_STATSD_ADDR", "no-port")
+	_, err = StatsdFromConfig(server.LocalAddr().String())
+	assert.ErrorContains(t, err, "HELM_TTL_STATSD_ADDR: invalid statsd address")
+}
@@ -0,0 +1,129 @@
+// Package policy reads the per-namespace TTL guardrails platform admins
+// configure in a helm-ttl-config ConfigMap.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ConfigMapName is the name of the policy ConfigMap in each namespace.
+	ConfigMapName = "helm-ttl-config"
+	// KeyDefaultDuration holds the TTL applied when none is given. It
+	// accepts any duration `helm ttl set` accepts.
+	KeyDefaultDuration = "defaultDuration"
+	// KeyMaxDuration holds the longest TTL allowed, as a Go duration or
+	// days shorthand (e.g. 72h, 14d).
+	KeyMaxDuration = "maxDuration"
+	// KeyRequireTTL, when "true", makes the admission webhook reject
+	// releases that do not declare a TTL.
+	KeyRequireTTL = "requireTTL"
+)
+
+var daysPattern = regexp.MustCompile(`^(\d+)d$`)
+
+// Policy is the TTL policy of a namespace. The zero value imposes nothing.
+type Policy struct {
+	Namespace       string
+	DefaultDuration string
+	// MaxDuration is zero when the namespace sets no maximum.
+	MaxDuration time.Duration
+	RequireTTL  bool
+}
+
+// MaxDurationExceededError is returned when a TTL is longer than the
+// namespace policy allows.
+type MaxDurationExceededError struct {
+	Namespace string
+	Max       time.Duration
+	Requested time.Duration
+}
+
+func (e *MaxDurationExceededError) Error() string {
+	return fmt.Sprintf("TTL of %s exceeds the maximum of %s allowed in namespace %q by the %s ConfigMap",
+		e.Requested.Round(time.Minute), e.Max, e.Namespace, ConfigMapName)
+}
+
+// Load reads the policy of a namespace. A namespace without a policy
+// ConfigMap gets the zero Policy.
+func Load(ctx context.Context, client kubernetes.Interface, namespace string) (*Policy, error) {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return &Policy{Namespace: namespace}, nil
+		}
+
+		return nil, fmt.Errorf("failed to get %s ConfigMap in namespace %q: %w", ConfigMapName, namespace, err)
+	}
+
+	return FromConfigMap(cm)
+}
+
+// FromConfigMap parses the policy held in a helm-ttl-config ConfigMap.
+func FromConfigMap(cm *corev1.ConfigMap) (*Policy, error) {
+	namespace := cm.Namespace
+	p := &Policy{Namespace: namespace}
+
+	var err error
+	p.DefaultDuration = strings.TrimSpace(cm.Data[KeyDefaultDuration])
+
+	if v := strings.TrimSpace(cm.Data[KeyMaxDuration]); v != "" {
+		p.MaxDuration, err = parseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in %s ConfigMap in namespace %q: %w", KeyMaxDuration, ConfigMapName, namespace, err)
+		}
+	}
+
+	if v := strings.TrimSpace(cm.Data[KeyRequireTTL]); v != "" {
+		p.RequireTTL, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in %s ConfigMap in namespace %q: %q is not true or false", KeyRequireTTL, ConfigMapName, namespace, v)
+		}
+	}
+
+	return p, nil
+}
+
+// Check returns a MaxDurationExceededError when a TTL firing at target is
+// longer than the policy allows.
+func (p *Policy) Check(target, now time.Time) error {
+	if p.MaxDuration == 0 {
+		return nil
+	}
+
+	if requested := target.Sub(now); requested > p.MaxDuration {
+		return &MaxDurationExceededError{Namespace: p.Namespace, Max: p.MaxDuration, Requested: requested}
+	}
+
+	return nil
+}
+
+// parseDuration parses a positive Go duration or days shorthand.
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		m := daysPattern.FindStringSubmatch(s)
+		if m == nil {
+			return 0, fmt.Errorf("%q is not a duration such as 72h or 14d", s)
+		}
+
+		days, _ := strconv.Atoi(m[1])
+		d = time.Duration(days) * 24 * time.Hour
+	}
+
+	if d <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got %s", s)
+	}
+
+	return d, nil
+}
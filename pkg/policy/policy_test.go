@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func policyConfigMap(namespace string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: namespace},
+		Data:       data,
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no ConfigMap", func(t *testing.T) {
+		p, err := Load(ctx, fake.NewClientset(), "dev")
+		require.NoError(t, err)
+		assert.Equal(t, &Policy{Namespace: "dev"}, p)
+	})
+
+	t.Run("default and maximum", func(t *testing.T) {
+		client := fake.NewClientset(policyConfigMap("dev", map[string]string{
+			KeyDefaultDuration: " 3 days ",
+			KeyMaxDuration:     "14d",
+		}))
+
+		p, err := Load(ctx, client, "dev")
+		require.NoError(t, err)
+		assert.Equal(t, "3 days", p.DefaultDuration)
+		assert.Equal(t, 14*24*time.Hour, p.MaxDuration)
+	})
+
+	t.Run("require TTL", func(t *testing.T) {
+		client := fake.NewClientset(policyConfigMap("dev", map[string]string{KeyRequireTTL: "true"}))
+
+		p, err := Load(ctx, client, "dev")
+		require.NoError(t, err)
+		assert.True(t, p.RequireTTL)
+	})
+
+	t.Run("invalid require TTL", func(t *testing.T) {
+		client := fake.NewClientset(policyConfigMap("dev", map[string]string{KeyRequireTTL: "yes please"}))
+
+		_, err := Load(ctx, client, "dev")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid requireTTL")
+	})
+
+	t.Run("Go duration maximum", func(t *testing.T) {
+		client := fake.NewClientset(policyConfigMap("dev", map[string]string{KeyMaxDuration: "72h"}))
+
+		p, err := Load(ctx, client, "dev")
+		require.NoError(t, err)
+		assert.Empty(t, p.DefaultDuration)
+		assert.Equal(t, 72*time.Hour, p.MaxDuration)
+	})
+
+	t.Run("other namespaces are unaffected", func(t *testing.T) {
+		client := fake.NewClientset(policyConfigMap("dev", map[string]string{KeyMaxDuration: "72h"}))
+
+		p, err := Load(ctx, client, "prod")
+		require.NoError(t, err)
+		assert.Zero(t, p.MaxDuration)
+	})
+
+	t.Run("invalid maximum", func(t *testing.T) {
+		for _, v := range []string{"forever", "0d", "-1h"} {
+			client := fake.NewClientset(policyConfigMap("dev", map[string]string{KeyMaxDuration: v}))
+
+			_, err := Load(ctx, client, "dev")
+			assert.Error(t, err, v)
+			assert.Contains(t, err.Error(), "invalid maxDuration")
+		}
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "configmaps", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := Load(ctx, client, "dev")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `failed to get helm-ttl-config ConfigMap in namespace "dev"`)
+	})
+}
+
+func TestPolicy_Check(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	t.Run("no maximum", func(t *testing.T) {
+		p := &Policy{Namespace: "dev"}
+		assert.NoError(t, p.Check(now.Add(300*24*time.Hour), now))
+	})
+
+	t.Run("within maximum", func(t *testing.T) {
+		p := &Policy{Namespace: "dev", MaxDuration: 72 * time.Hour}
+		assert.NoError(t, p.Check(now.Add(72*time.Hour), now))
+	})
+
+	t.Run("exceeds maximum", func(t *testing.T) {
+		p := &Policy{Namespace: "dev", MaxDuration: 72 * time.Hour}
+
+		err := p.Check(now.Add(96*time.Hour), now)
+		var exceeded *MaxDurationExceededError
+		require.True(t, errors.As(err, &exceeded))
+		assert.Equal(t, 96*time.Hour, exceeded.Requested)
+		assert.Equal(t, `TTL of 96h0m0s exceeds the maximum of 72h0m0s allowed in namespace "dev" by the helm-ttl-config ConfigMap`, err.Error())
+	})
+}
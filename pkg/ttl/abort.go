@@ -0,0 +1,102 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	typedbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+)
+
+const (
+	// AnnotationAbort, set to "true" on a TTL CronJob during its abort
+	// window, makes the uninstall Job stop without uninstalling.
+	AnnotationAbort = "helm-ttl/abort"
+	// AnnotationAbortWindow records how long the uninstall Job waits for
+	// AnnotationAbort before uninstalling.
+	AnnotationAbortWindow = "helm-ttl/abort-window"
+
+	// abortWindowContainer is the name of the init container that waits
+	// for AnnotationAbort.
+	abortWindowContainer = "abort-window"
+	// abortExitCode is the exit code of an aborted abort-window container.
+	// The Job fails on it at once instead of being retried.
+	abortExitCode int32 = 3
+)
+
+// abortPollInterval is how often the abort window reads the CronJob's
+// annotations.
+var abortPollInterval = 10 * time.Second
+
+// clearAbortPatch removes AnnotationAbort from a CronJob.
+var clearAbortPatch = []byte(`{"metadata":{"annotations":{"` + AnnotationAbort + `":null}}}`)
+
+// validateAbortWindow rejects negative abort windows.
+func validateAbortWindow(window time.Duration) error {
+	if window < 0 {
+		return fmt.Errorf("invalid --abort-window %s: must not be negative", window)
+	}
+
+	return nil
+}
+
+// abortWindowCmd returns a command that reads the annotations of the TTL
+// CronJob every abortPollInterval for window, and exits with abortExitCode
+// as soon as AnnotationAbort is "true".
+func abortWindowCmd(cronJobName, cronjobNamespace, releaseName string, window time.Duration, cleanupImage bool) []string {
+	if cleanupImage {
+		return []string{cleanupBinary, "wait-abort", "--namespace", cronjobNamespace, "--delay", window.String(), cronJobName}
+	}
+
+	script := fmt.Sprintf(`end=$(($(date +%%s) + %[1]d))
+echo "uninstalling release %[2]s in %[3]s unless cronjob %[4]s is annotated %[5]s=true"
+while :; do
+  abort=$(kubectl get cronjob %[4]s --namespace %[6]s --output 'jsonpath={.metadata.annotations.%[5]s}') || exit 1
+  if [ "$abort" = "true" ]; then
+    echo "uninstall aborted: cronjob %[4]s is annotated %[5]s=true" >&2
+    exit %[7]d
+  fi
+  if [ "$(date +%%s)" -ge "$end" ]; then
+    break
+  fi
+  sleep %[8]d
+done
+echo "not aborted; uninstalling release %[2]s"`,
+		int64(window.Seconds()), releaseName, window, cronJobName, AnnotationAbort, cronjobNamespace, abortExitCode, int64(abortPollInterval.Seconds()))
+
+	return []string{"sh", "-c", script}
+}
+
+// abortPodFailurePolicy fails the Job without retrying it when the abort
+// window container exits with abortExitCode.
+func abortPodFailurePolicy() *batchv1.PodFailurePolicy {
+	container := abortWindowContainer
+	return &batchv1.PodFailurePolicy{
+		Rules: []batchv1.PodFailurePolicyRule{{
+			Action: batchv1.PodFailurePolicyActionFailJob,
+			OnExitCodes: &batchv1.PodFailurePolicyOnExitCodesRequirement{
+				ContainerName: &container,
+				Operator:      batchv1.PodFailurePolicyOnExitCodesOpIn,
+				Values:        []int32{abortExitCode},
+			},
+		}},
+	}
+}
+
+// clearAbort removes AnnotationAbort from a saved CronJob, so an abort
+// does not also cancel the expiry a later set or extend chooses.
+func clearAbort(ctx context.Context, cronJobs typedbatchv1.CronJobInterface, cj *batchv1.CronJob) (*batchv1.CronJob, error) {
+	if _, ok := cj.Annotations[AnnotationAbort]; !ok {
+		return cj, nil
+	}
+
+	cleared, err := cronJobs.Patch(ctx, cj.Name, types.MergePatchType, clearAbortPatch, metav1.PatchOptions{FieldManager: FieldManager})
+	if err != nil {
+		return nil, fmt.Errorf("failed to clear the %s annotation: %w", AnnotationAbort, err)
+	}
+
+	return cleared, nil
+}
@@ -0,0 +1,176 @@
+package ttl
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuildCronJob_AbortWindow(t *testing.T) {
+	opts := CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "staging",
+		CronjobNamespace: "ops",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		ExpiresAt:        time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		AbortWindow:      15 * time.Minute,
+	}
+
+	cj, err := BuildCronJob(opts)
+	require.NoError(t, err)
+	jobSpec := cj.Spec.JobTemplate.Spec
+
+	var names []string
+	for _, c := range jobSpec.Template.Spec.InitContainers {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"expiry-guard", "abort-window", "helm-uninstall", "verify-uninstall"}, names)
+	assert.Equal(t, "15m0s", cj.Annotations[AnnotationAbortWindow])
+	assert.Equal(t, DefaultActiveDeadlineSeconds+900, *jobSpec.ActiveDeadlineSeconds)
+	assert.Equal(t, abortPodFailurePolicy(), jobSpec.PodFailurePolicy)
+
+	abort := jobSpec.Template.Spec.InitContainers[1]
+	assert.Equal(t, DefaultKubectlImage, abort.Image)
+	script := abort.Command[2]
+	assert.Contains(t, script, "end=$(($(date +%s) + 900))")
+	assert.Contains(t, script, "kubectl get cronjob myapp-80081014-ttl --namespace ops --output 'jsonpath={.metadata.annotations.helm-ttl/abort}'")
+	assert.Contains(t, script, "exit 3")
+	assert.Contains(t, script, "sleep 10")
+	assert.NoError(t, exec.Command("sh", "-n", "-c", script).Run())
+
+	t.Run("with two-phase", func(t *testing.T) {
+		opts := opts
+		opts.TwoPhaseGrace = time.Minute
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+		var names []string
+		for _, c := range cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers {
+			names = append(names, c.Name)
+		}
+		assert.Equal(t, []string{"expiry-guard", "uninstall-dry-run", "publish-manifest", "abort-window", "helm-uninstall", "verify-uninstall"}, names)
+		assert.Equal(t, DefaultActiveDeadlineSeconds+960, *cj.Spec.JobTemplate.Spec.ActiveDeadlineSeconds)
+	})
+
+	t.Run("cleanup image", func(t *testing.T) {
+		opts := opts
+		opts.CleanupImage = "registry.example.com/helm-ttl-cleanup:v1"
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+		abort := cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[1]
+		assert.Equal(t, "registry.example.com/helm-ttl-cleanup:v1", abort.Image)
+		assert.Equal(t, []string{cleanupBinary, "wait-abort", "--namespace", "ops", "--delay", "15m0s", "myapp-80081014-ttl"}, abort.Command)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		opts := opts
+		opts.AbortWindow = 0
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+		assert.NotContains(t, cj.Annotations, AnnotationAbortWindow)
+		assert.Nil(t, cj.Spec.JobTemplate.Spec.PodFailurePolicy)
+		assert.Len(t, cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers, 3)
+	})
+
+	t.Run("negative window rejected", func(t *testing.T) {
+		opts := opts
+		opts.AbortWindow = -time.Minute
+
+		_, err := BuildCronJob(opts)
+		assert.EqualError(t, err, "invalid --abort-window -1m0s: must not be negative")
+	})
+
+	t.Run("active deadline must cover the window", func(t *testing.T) {
+		opts := opts
+		deadline := int64(600)
+		opts.Job = JobOptions{ActiveDeadlineSeconds: &deadline}
+
+		_, err := BuildCronJob(opts)
+		assert.ErrorContains(t, err, "(15m0s)")
+	})
+
+	t.Run("run skips the window", func(t *testing.T) {
+		job := BuildJobFromCronJob(cj, "myapp-run")
+		var names []string
+		for _, c := range job.Spec.Template.Spec.InitContainers {
+			names = append(names, c.Name)
+		}
+		assert.Equal(t, []string{"helm-uninstall", "verify-uninstall"}, names)
+		assert.Nil(t, job.Spec.PodFailurePolicy)
+		assert.NotNil(t, cj.Spec.JobTemplate.Spec.PodFailurePolicy)
+	})
+}
+
+func TestClearAbort(t *testing.T) {
+	ctx := context.Background()
+	abort := func(t *testing.T, client *fake.Clientset, namespace, name string) {
+		t.Helper()
+
+		cj, err := client.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		cj.Annotations[AnnotationAbort] = "true"
+		_, err = client.BatchV1().CronJobs(namespace).Update(ctx, cj, metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+	annotations := func(t *testing.T, client *fake.Clientset) map[string]string {
+		t.Helper()
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+
+		return cj.Annotations
+	}
+
+	t.Run("set", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		opts := SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			AbortWindow:          time.Minute,
+		}
+
+		_, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+		abort(t, client, "default", "myapp-4a0c226a-ttl")
+
+		opts.Duration = "3d"
+		_, err = SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+		assert.NotContains(t, annotations(t, client), AnnotationAbort)
+		assert.Equal(t, "1m0s", annotations(t, client)[AnnotationAbortWindow])
+	})
+
+	t.Run("extend", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "myapp", "default", time.Now().Add(48*time.Hour)))
+		abort(t, client, "default", "myapp-4a0c226a-ttl")
+
+		_, err := ExtendTTL(ctx, client, ExtendTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", By: time.Hour})
+		require.NoError(t, err)
+		assert.NotContains(t, annotations(t, client), AnnotationAbort)
+	})
+
+	t.Run("nothing to clear", func(t *testing.T) {
+		cj := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default"}}
+		client := fake.NewClientset()
+
+		cleared, err := clearAbort(ctx, client.BatchV1().CronJobs("default"), cj)
+		require.NoError(t, err)
+		assert.Same(t, cj, cleared)
+		assert.Empty(t, client.Actions())
+	})
+}
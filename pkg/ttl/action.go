@@ -1,8 +1,6 @@
 package ttl
 
 import (
-	"os"
-
 	"helm.sh/helm/v3/pkg/action"
 )
 
@@ -13,18 +11,12 @@ func NewConfiguration(namespace string, opts KubeOptions) (*action.Configuration
 	cfg := new(action.Configuration)
 
 	if namespace == "" {
-		namespace = os.Getenv("HELM_NAMESPACE")
-	}
-	if namespace == "" {
-		namespace = "default"
+		namespace = envNamespace()
 	}
 
 	driver := opts.Driver
 	if driver == "" {
-		driver = os.Getenv("HELM_DRIVER")
-	}
-	if driver == "" {
-		driver = "secrets"
+		driver = envDriver()
 	}
 
 	if err := cfg.Init(
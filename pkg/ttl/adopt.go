@@ -0,0 +1,236 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AdoptTTLOptions selects the CronJob AdoptTTL takes over as the TTL of a
+// release.
+type AdoptTTLOptions struct {
+	ReleaseName      string
+	ReleaseNamespace string
+	CronjobNamespace string
+	// CronJobName is the CronJob to adopt. Empty looks for one named the
+	// way helm-ttl names TTL CronJobs now or did before:
+	// RELEASE-HASH-ttl, RELEASE-NAMESPACE-ttl or RELEASE-ttl.
+	CronJobName string
+	// DryRun reports the changes without making them.
+	DryRun bool
+}
+
+// AdoptResult reports the CronJob AdoptTTL took over and how it changed.
+type AdoptResult struct {
+	ReleaseName      string `json:"release_name" yaml:"release_name"`
+	ReleaseNamespace string `json:"release_namespace" yaml:"release_namespace"`
+	CronjobNamespace string `json:"cronjob_namespace" yaml:"cronjob_namespace"`
+	// AdoptedCronJob is the name of the CronJob before adoption, and
+	// CronJobName its name after.
+	AdoptedCronJob string `json:"adopted_cronjob" yaml:"adopted_cronjob"`
+	CronJobName    string `json:"cronjob_name" yaml:"cronjob_name"`
+	Expiry         string `json:"expiry" yaml:"expiry"`
+	// Changes lists the labels, annotations and name changed, empty when
+	// the CronJob already followed the conventions.
+	Changes  []string `json:"changes" yaml:"changes"`
+	DryRun   bool     `json:"dry_run,omitempty" yaml:"dry_run,omitempty"`
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// adoptCandidates returns the names a TTL CronJob of a release may have
+// been given, current first.
+func adoptCandidates(releaseName, releaseNamespace string) []string {
+	return []string{
+		ResourceName(releaseName, releaseNamespace),
+		releaseName + "-" + releaseNamespace + "-ttl",
+		releaseName + "-ttl",
+	}
+}
+
+// AdoptTTL takes over an existing CronJob as the TTL of a release, e.g.
+// one created by hand or by an older helm-ttl without the labels get,
+// unset and run find TTLs by. The CronJob is labeled and annotated the way
+// SetTTL labels it, and renamed to ResourceName by creating it under that
+// name and deleting the original, unless it runs as a ServiceAccount of
+// its own name. Its schedule must fire once, at the expiry, as SetTTL
+// writes them; its Job, ServiceAccount and RBAC are kept as they are.
+func AdoptTTL(ctx context.Context, client kubernetes.Interface, opts AdoptTTLOptions) (*AdoptResult, error) {
+	cronJobs := client.BatchV1().CronJobs(opts.CronjobNamespace)
+
+	names := adoptCandidates(opts.ReleaseName, opts.ReleaseNamespace)
+	if opts.CronJobName != "" {
+		names = []string{opts.CronJobName}
+	}
+
+	var src *batchv1.CronJob
+	for _, name := range names {
+		cj, err := cronJobs.Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get CronJob %s: %w", name, err)
+		}
+
+		src = cj
+		break
+	}
+	if src == nil {
+		return nil, fmt.Errorf("no CronJob %s in namespace %q to adopt as the TTL of release %q", strings.Join(names, " or "), opts.CronjobNamespace, opts.ReleaseName)
+	}
+
+	if IsNamespaceTTL(src) {
+		return nil, fmt.Errorf("cannot adopt CronJob %s: it is the TTL of namespace %q", src.Name, TargetNamespace(src))
+	}
+	if stage := src.Labels[LabelStage]; stage != "" {
+		return nil, fmt.Errorf("cannot adopt CronJob %s: it is the %s stage of TTL %s", src.Name, stage, src.Labels[LabelStageOf])
+	}
+	if release := OriginalLabelValue(src, LabelRelease); release != "" && release != opts.ReleaseName {
+		return nil, fmt.Errorf("cannot adopt CronJob %s: it is labeled as the TTL of release %q", src.Name, release)
+	}
+
+	if existing, err := findCronJob(ctx, client, opts.ReleaseName, opts.ReleaseNamespace, opts.CronjobNamespace); err == nil && existing.Name != src.Name {
+		return nil, fmt.Errorf("release %q already has a TTL in CronJob %s; unset it before adopting %s", opts.ReleaseName, existing.Name, src.Name)
+	} else if err != nil && !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get CronJob: %w", err)
+	}
+
+	now := time.Now()
+	expiresAt, missed, err := resolveExpiry(src, now)
+	if err != nil {
+		return nil, fmt.Errorf("cannot adopt CronJob %s: %w", src.Name, err)
+	}
+	if missed {
+		return nil, fmt.Errorf("cannot adopt CronJob %s: its expiry %s has passed", src.Name, FormatScheduledDate(expiresAt))
+	}
+
+	cj, changes := adoptedCronJob(src, opts, expiresAt)
+	result := &AdoptResult{
+		ReleaseName:      opts.ReleaseName,
+		ReleaseNamespace: opts.ReleaseNamespace,
+		CronjobNamespace: opts.CronjobNamespace,
+		AdoptedCronJob:   src.Name,
+		CronJobName:      cj.Name,
+		Expiry:           FormatScheduledDate(expiresAt),
+		Changes:          changes,
+		DryRun:           opts.DryRun,
+	}
+	if opts.DryRun || len(changes) == 0 {
+		return result, nil
+	}
+
+	var saved *batchv1.CronJob
+	if cj.Name == src.Name {
+		saved, err = cronJobs.Update(ctx, cj, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update CronJob %s: %w", src.Name, err)
+		}
+	} else {
+		saved, err = cronJobs.Create(ctx, portableCronJob(cj), metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CronJob %s: %w", cj.Name, err)
+		}
+
+		if err := cronJobs.Delete(ctx, src.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to delete CronJob %s after creating %s from it: %w", src.Name, cj.Name, err)
+		}
+	}
+
+	if releaseGone(ctx, client, saved) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("release %q not found in namespace %q; the TTL fires without uninstalling anything unless it is installed", opts.ReleaseName, opts.ReleaseNamespace))
+	}
+
+	// Record history and annotate the release (best effort)
+	_ = RecordHistory(ctx, client, opts.ReleaseName, opts.ReleaseNamespace, opts.CronjobNamespace, HistoryEntry{
+		Operation: OperationAdopt,
+		NewExpiry: result.Expiry,
+	})
+	_ = annotateReleaseStorage(ctx, client, cronJobDriver(saved), opts.ReleaseName, opts.ReleaseNamespace, saved.Namespace+"/"+saved.Name, expiresAt)
+
+	return result, nil
+}
+
+// adoptedCronJob returns src with the name, labels and annotations of the
+// TTL CronJob of the release in opts, and the changes that makes.
+func adoptedCronJob(src *batchv1.CronJob, opts AdoptTTLOptions, expiresAt time.Time) (*batchv1.CronJob, []string) {
+	cj := src.DeepCopy()
+	changes := []string{}
+
+	labels := releaseLabels(opts.ReleaseName, opts.ReleaseNamespace)
+	labels[LabelCronjobNamespace] = LabelValue(opts.CronjobNamespace)
+	if _, ok := cj.Labels[LabelDeleteNamespace]; !ok {
+		labels[LabelDeleteNamespace] = "false"
+	}
+
+	annotations := releaseAnnotations(opts.ReleaseName, opts.ReleaseNamespace)
+	annotations[LabelCronjobNamespace] = opts.CronjobNamespace
+	annotations[AnnotationExpiresAt] = FormatScheduledDate(expiresAt.UTC())
+
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		if v, ok := cj.Labels[k]; !ok || v != labels[k] {
+			changes = append(changes, fmt.Sprintf("label %s=%s", k, labels[k]))
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(annotations)) {
+		if v, ok := cj.Annotations[k]; !ok || v != annotations[k] {
+			changes = append(changes, fmt.Sprintf("annotation %s=%s", k, annotations[k]))
+		}
+	}
+
+	if cj.Labels == nil {
+		cj.Labels = make(map[string]string, len(labels))
+	}
+	maps.Copy(cj.Labels, labels)
+	setAnnotations(&cj.ObjectMeta, annotations)
+
+	// Jobs and pods carry the labels too, as for the CronJobs SetTTL builds
+	template := &cj.Spec.JobTemplate
+	for _, meta := range []*metav1.ObjectMeta{&template.ObjectMeta, &template.Spec.Template.ObjectMeta} {
+		if meta.Labels == nil {
+			meta.Labels = make(map[string]string, len(labels))
+		}
+		maps.Copy(meta.Labels, labels)
+	}
+
+	// A CronJob running as a ServiceAccount of its own name had its RBAC
+	// created by helm-ttl under that name too, which renaming would orphan
+	if name := ResourceName(opts.ReleaseName, opts.ReleaseNamespace); cj.Name != name && template.Spec.Template.Spec.ServiceAccountName != cj.Name {
+		changes = append(changes, fmt.Sprintf("rename %s to %s", cj.Name, name))
+		cj.Name = name
+	}
+
+	return cj, changes
+}
+
+// FormatAdoptResult formats an AdoptResult in the specified format.
+func FormatAdoptResult(result *AdoptResult, format string) (string, error) {
+	if format != "text" {
+		return formatStructured(result, format)
+	}
+
+	if len(result.Changes) == 0 {
+		return fmt.Sprintf("CronJob %s is already the TTL of release %q in namespace %q, expires at %s\n",
+			result.CronJobName, result.ReleaseName, result.ReleaseNamespace, result.Expiry), nil
+	}
+
+	verb := "Adopted"
+	if result.DryRun {
+		verb = "Would adopt"
+	}
+
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "%s CronJob %s as the TTL of release %q in namespace %q, expires at %s\n",
+		verb, result.AdoptedCronJob, result.ReleaseName, result.ReleaseNamespace, result.Expiry)
+	for _, c := range result.Changes {
+		_, _ = fmt.Fprintf(&b, "  %s\n", c)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,180 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// handMadeCronJob returns a CronJob uninstalling myapp as someone would
+// write it without helm-ttl.
+func handMadeCronJob(name, schedule string) *batchv1.CronJob {
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"team": "checkout"}},
+		Spec: batchv1.CronJobSpec{
+			Schedule: schedule,
+			JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				ServiceAccountName: "uninstaller",
+				RestartPolicy:      corev1.RestartPolicyNever,
+				Containers:         []corev1.Container{{Name: "uninstall", Image: "alpine/helm", Args: []string{"uninstall", "myapp"}}},
+			}}}},
+		},
+	}
+}
+
+func TestAdoptTTL(t *testing.T) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+	schedule := TimeToCronSchedule(expiresAt)
+	opts := AdoptTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"}
+
+	t.Run("relabels and renames a hand-made CronJob", func(t *testing.T) {
+		client := fake.NewClientset(handMadeCronJob("myapp-ttl", schedule))
+
+		result, err := AdoptTTL(ctx, client, opts)
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-ttl", result.AdoptedCronJob)
+		assert.Equal(t, "myapp-4a0c226a-ttl", result.CronJobName)
+		assert.Equal(t, FormatScheduledDate(expiresAt), result.Expiry)
+		assert.Contains(t, result.Changes, "label app.kubernetes.io/managed-by=helm-ttl")
+		assert.Contains(t, result.Changes, "rename myapp-ttl to myapp-4a0c226a-ttl")
+
+		_, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-ttl", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "checkout", cj.Labels["team"])
+		assert.Equal(t, LabelManagedByValue, cj.Spec.JobTemplate.Spec.Template.Labels[LabelManagedBy])
+		assert.Equal(t, "uninstaller", cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, FormatScheduledDate(expiresAt), info.ScheduledDate)
+
+		ttls, err := ListTTLs(ctx, client, "default", "default")
+		require.NoError(t, err)
+		assert.Len(t, ttls, 1)
+
+		history, err := GetHistory(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, OperationAdopt, history[0].Operation)
+
+		require.NoError(t, UnsetTTL(ctx, client, "myapp", "default", "default"))
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		client := fake.NewClientset(handMadeCronJob("myapp-ttl", schedule))
+
+		dry := opts
+		dry.DryRun = true
+		result, err := AdoptTTL(ctx, client, dry)
+		require.NoError(t, err)
+		assert.True(t, result.DryRun)
+		assert.NotEmpty(t, result.Changes)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, cj.Labels, LabelManagedBy)
+	})
+
+	t.Run("keeps the name RBAC was created under", func(t *testing.T) {
+		legacy := handMadeCronJob("myapp-default-ttl", schedule)
+		legacy.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName = "myapp-default-ttl"
+		client := fake.NewClientset(legacy)
+
+		result, err := AdoptTTL(ctx, client, opts)
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-default-ttl", result.CronJobName)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "myapp", cj.Labels[LabelRelease])
+	})
+
+	t.Run("a CronJob set by helm-ttl is left alone", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Schedule:         schedule,
+			ServiceAccount:   "default",
+			ExpiresAt:        expiresAt,
+		})
+		require.NoError(t, err)
+		client := fake.NewClientset(cj)
+
+		result, err := AdoptTTL(ctx, client, opts)
+		require.NoError(t, err)
+		assert.Empty(t, result.Changes)
+		for _, a := range client.Actions() {
+			assert.Contains(t, []string{"get", "list"}, a.GetVerb())
+		}
+	})
+
+	t.Run("named CronJob", func(t *testing.T) {
+		client := fake.NewClientset(handMadeCronJob("nightly-teardown", schedule))
+
+		named := opts
+		named.CronJobName = "nightly-teardown"
+		result, err := AdoptTTL(ctx, client, named)
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-4a0c226a-ttl", result.CronJobName)
+
+		_, err = AdoptTTL(ctx, fake.NewClientset(), named)
+		assert.ErrorContains(t, err, `no CronJob nightly-teardown in namespace "default" to adopt as the TTL of release "myapp"`)
+	})
+
+	t.Run("refuses what it cannot adopt", func(t *testing.T) {
+		_, err := AdoptTTL(ctx, fake.NewClientset(handMadeCronJob("myapp-ttl", "0 3 * * *")), opts)
+		assert.ErrorContains(t, err, "cannot adopt CronJob myapp-ttl: invalid cron schedule")
+
+		_, err = AdoptTTL(ctx, fake.NewClientset(), opts)
+		assert.ErrorContains(t, err, "no CronJob myapp-4a0c226a-ttl or myapp-default-ttl or myapp-ttl")
+
+		existing := buildTestCronJob(t, "myapp", "default", "default", false)
+		_, err = AdoptTTL(ctx, fake.NewClientset(existing, handMadeCronJob("other", schedule)), AdoptTTLOptions{
+			ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", CronJobName: "other",
+		})
+		assert.ErrorContains(t, err, `release "myapp" already has a TTL in CronJob myapp-4a0c226a-ttl`)
+
+		labeled := handMadeCronJob("myapp-ttl", schedule)
+		labeled.Labels[LabelRelease] = "api"
+		_, err = AdoptTTL(ctx, fake.NewClientset(labeled), opts)
+		assert.ErrorContains(t, err, `it is labeled as the TTL of release "api"`)
+	})
+}
+
+func TestFormatAdoptResult(t *testing.T) {
+	result := &AdoptResult{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		AdoptedCronJob:   "myapp-ttl",
+		CronJobName:      "myapp-4a0c226a-ttl",
+		Expiry:           "2025-03-15T14:30:00Z",
+		Changes:          []string{"rename myapp-ttl to myapp-4a0c226a-ttl"},
+	}
+
+	out, err := FormatAdoptResult(result, "text")
+	require.NoError(t, err)
+	assert.Equal(t, "Adopted CronJob myapp-ttl as the TTL of release \"myapp\" in namespace \"default\", expires at 2025-03-15T14:30:00Z\n  rename myapp-ttl to myapp-4a0c226a-ttl\n", out)
+
+	result.DryRun = true
+	out, err = FormatAdoptResult(result, "text")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Would adopt CronJob myapp-ttl")
+
+	result.Changes = []string{}
+	out, err = FormatAdoptResult(result, "text")
+	require.NoError(t, err)
+	assert.Contains(t, out, "is already the TTL of release")
+}
@@ -0,0 +1,81 @@
+package ttl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/csaupgrade"
+)
+
+// applier is the part of a typed client that apply uses.
+type applier[T runtime.Object, AC any] interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (T, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (T, error)
+	Apply(ctx context.Context, ac AC, opts metav1.ApplyOptions) (T, error)
+}
+
+// apply server-side applies obj as the FieldManager. ac is the apply
+// configuration of obj's kind, with only its name and namespace set; obj
+// is copied into it. Fields set by other managers, such as labels added
+// by a policy controller, are kept, while fields helm-ttl set before and
+// no longer does are removed.
+func apply[T runtime.Object, AC any](ctx context.Context, c applier[T, AC], obj metav1.Object, ac AC) (T, error) {
+	var zero T
+	existing, err := c.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		return zero, err
+	default:
+		if _, err := upgradeManagedFields(ctx, c, existing); err != nil {
+			return zero, err
+		}
+	}
+
+	if err := toApplyConfiguration(obj, ac); err != nil {
+		return zero, err
+	}
+
+	return c.Apply(ctx, ac, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+}
+
+// upgradeManagedFields hands the fields helm-ttl wrote with Create and
+// Update, before it used server-side apply, over to its apply manager, so
+// the next apply can remove those it no longer sets. It returns obj as
+// saved, unchanged when there was nothing to hand over.
+func upgradeManagedFields[T runtime.Object, AC any](ctx context.Context, c applier[T, AC], obj T) (T, error) {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(obj, sets.New(FieldManager), FieldManager)
+	if err != nil || patch == nil {
+		return obj, err
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return obj, err
+	}
+
+	upgraded, err := c.Patch(ctx, accessor.GetName(), types.JSONPatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+	if err != nil {
+		return obj, fmt.Errorf("failed to take over managed fields of %s: %w", accessor.GetName(), err)
+	}
+
+	return upgraded, nil
+}
+
+// toApplyConfiguration copies a typed object into its apply
+// configuration, which shares its JSON form.
+func toApplyConfiguration(obj any, ac any) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, ac)
+}
@@ -0,0 +1,97 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	rbacv1ac "k8s.io/client-go/applyconfigurations/rbac/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// onApply returns a reactor that runs fn for server-side apply patches
+// only.
+func onApply(fn k8stesting.ReactionFunc) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch, ok := action.(k8stesting.PatchAction)
+		if !ok || patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+
+		return fn(action)
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	role := func(annotations map[string]string) *rbacv1.Role {
+		return &rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "myapp-4a0c226a-ttl",
+				Namespace:   "default",
+				Labels:      map[string]string{LabelManagedBy: LabelManagedByValue},
+				Annotations: annotations,
+			},
+			Rules: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"list"}}},
+		}
+	}
+	applyRole := func(t *testing.T, client *fake.Clientset, r *rbacv1.Role) *rbacv1.Role {
+		t.Helper()
+
+		saved, err := apply[*rbacv1.Role](ctx, client.RbacV1().Roles("default"), r, rbacv1ac.Role(r.Name, r.Namespace))
+		require.NoError(t, err)
+
+		return saved
+	}
+
+	t.Run("creates", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		saved := applyRole(t, client, role(nil))
+		assert.Equal(t, LabelManagedByValue, saved.Labels[LabelManagedBy])
+		assert.Equal(t, []string{"secrets"}, saved.Rules[0].Resources)
+		require.NotEmpty(t, saved.ManagedFields)
+		assert.Equal(t, FieldManager, saved.ManagedFields[0].Manager)
+		assert.Equal(t, metav1.ManagedFieldsOperationApply, saved.ManagedFields[0].Operation)
+	})
+
+	t.Run("keeps fields of other managers", func(t *testing.T) {
+		client := fake.NewClientset()
+		saved := applyRole(t, client, role(nil))
+		saved.Labels["team"] = "checkout"
+		_, err := client.RbacV1().Roles("default").Update(ctx, saved, metav1.UpdateOptions{FieldManager: "kubectl-label"})
+		require.NoError(t, err)
+
+		r := role(nil)
+		r.Rules[0].Verbs = []string{"list", "delete"}
+		saved = applyRole(t, client, r)
+		assert.Equal(t, "checkout", saved.Labels["team"])
+		assert.Equal(t, []string{"list", "delete"}, saved.Rules[0].Verbs)
+	})
+
+	t.Run("removes what helm-ttl no longer sets", func(t *testing.T) {
+		client := fake.NewClientset()
+		applyRole(t, client, role(map[string]string{AnnotationArgoCDTrackingID: "preview:rbac.authorization.k8s.io/Role:default/myapp-4a0c226a-ttl"}))
+
+		saved := applyRole(t, client, role(nil))
+		assert.NotContains(t, saved.Annotations, AnnotationArgoCDTrackingID)
+	})
+
+	t.Run("takes over fields helm-ttl wrote with an update", func(t *testing.T) {
+		client := fake.NewClientset()
+		_, err := client.RbacV1().Roles("default").Create(ctx, role(map[string]string{AnnotationArgoCDTrackingID: "preview"}), metav1.CreateOptions{FieldManager: FieldManager})
+		require.NoError(t, err)
+
+		saved := applyRole(t, client, role(nil))
+		assert.NotContains(t, saved.Annotations, AnnotationArgoCDTrackingID)
+		for _, mf := range saved.ManagedFields {
+			assert.NotEqual(t, metav1.ManagedFieldsOperationUpdate, mf.Operation, mf.Manager)
+		}
+	})
+}
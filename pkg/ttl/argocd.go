@@ -0,0 +1,141 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	// AnnotationArgoCDTrackingID ties a resource to an Argo CD Application
+	// under annotation tracking.
+	AnnotationArgoCDTrackingID = "argocd.argoproj.io/tracking-id"
+
+	// AnnotationArgoCDSyncOptions is set to Prune=false so that syncs of
+	// the Application never delete the TTL's resources.
+	AnnotationArgoCDSyncOptions = "argocd.argoproj.io/sync-options"
+
+	// AnnotationArgoCDCompareOptions is set to IgnoreExtraneous so that
+	// the TTL's resources, which are not in Git, do not leave the
+	// Application OutOfSync.
+	AnnotationArgoCDCompareOptions = "argocd.argoproj.io/compare-options"
+
+	// DefaultArgoCDNamespace is the namespace Argo CD is installed in by
+	// default.
+	DefaultArgoCDNamespace = "argocd"
+
+	argoCDConfigMap            = "argocd-cm"
+	argoCDDefaultInstanceLabel = "app.kubernetes.io/instance"
+)
+
+// ArgoCDOptions makes the TTL's resources part of the Argo CD Application
+// managing the release, so that syncing it neither prunes them nor reports
+// them as out of sync.
+type ArgoCDOptions struct {
+	// Application is the name Argo CD tracks the Application's resources
+	// under, <namespace>_<name> for Applications outside Argo CD's own
+	// namespace. Tracking is off when empty.
+	Application string
+	// Namespace is where Argo CD reads its argocd-cm ConfigMap from. It
+	// defaults to DefaultArgoCDNamespace.
+	Namespace string
+}
+
+// argoCDTracking is how Argo CD tracks the resources of an Application.
+type argoCDTracking struct {
+	application string
+	// method is label, annotation or annotation+label, as in the
+	// application.resourceTrackingMethod setting of argocd-cm.
+	method   string
+	labelKey string
+}
+
+// resolveArgoCDTracking reads the tracking method and instance label key
+// from argocd-cm, returning nil when opts disable tracking. Argo CD's
+// defaults are used when the ConfigMap cannot be read, since the TTL's
+// user rarely has access to Argo CD's namespace.
+func resolveArgoCDTracking(ctx context.Context, client kubernetes.Interface, opts ArgoCDOptions) *argoCDTracking {
+	if opts.Application == "" {
+		return nil
+	}
+
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = DefaultArgoCDNamespace
+	}
+
+	tracking := &argoCDTracking{
+		application: opts.Application,
+		method:      "annotation",
+		labelKey:    argoCDDefaultInstanceLabel,
+	}
+
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, argoCDConfigMap, metav1.GetOptions{})
+	if err != nil {
+		logger.Debug("using default Argo CD tracking", "namespace", namespace, "error", err)
+		return tracking
+	}
+
+	if method := cm.Data["application.resourceTrackingMethod"]; method != "" {
+		tracking.method = method
+	}
+	if key := cm.Data["application.instanceLabelKey"]; key != "" {
+		tracking.labelKey = key
+	}
+
+	return tracking
+}
+
+// apply adds the tracking label or annotation of the Application to objs,
+// along with the sync and compare options that keep them through syncs.
+// It does nothing on a nil tracking.
+func (t *argoCDTracking) apply(objs ...runtime.Object) {
+	if t == nil {
+		return
+	}
+
+	for _, obj := range objs {
+		meta := obj.(metav1.Object)
+
+		// The label and annotation maps are shared between the RBAC
+		// resources of a TTL, while the tracking ID is not
+		labels := maps.Clone(meta.GetLabels())
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		annotations := maps.Clone(meta.GetAnnotations())
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+
+		annotations[AnnotationArgoCDSyncOptions] = "Prune=false"
+		annotations[AnnotationArgoCDCompareOptions] = "IgnoreExtraneous"
+		if t.method != "label" {
+			annotations[AnnotationArgoCDTrackingID] = t.trackingID(obj)
+		}
+		if t.method == "label" || t.method == "annotation+label" {
+			labels[t.labelKey] = LabelValue(t.application)
+		}
+
+		meta.SetLabels(labels)
+		meta.SetAnnotations(annotations)
+	}
+}
+
+// trackingID returns the annotation tracking ID of obj,
+// <application>:<group>/<kind>:<namespace>/<name>.
+func (t *argoCDTracking) trackingID(obj runtime.Object) string {
+	var group string
+	if gvks, _, err := scheme.Scheme.ObjectKinds(obj); err == nil {
+		group = gvks[0].Group
+	}
+
+	meta := obj.(metav1.Object)
+
+	return fmt.Sprintf("%s:%s/%s:%s/%s", t.application, group, objectKind(obj), meta.GetNamespace(), meta.GetName())
+}
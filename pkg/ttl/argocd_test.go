@@ -0,0 +1,245 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func argoCDConfig(namespace string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "argocd-cm", Namespace: namespace},
+		Data:       data,
+	}
+}
+
+func TestResolveArgoCDTracking(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("disabled without an application", func(t *testing.T) {
+		assert.Nil(t, resolveArgoCDTracking(ctx, fake.NewClientset(), ArgoCDOptions{}))
+	})
+
+	t.Run("defaults without argocd-cm", func(t *testing.T) {
+		tracking := resolveArgoCDTracking(ctx, fake.NewClientset(), ArgoCDOptions{Application: "preview"})
+		assert.Equal(t, &argoCDTracking{application: "preview", method: "annotation", labelKey: "app.kubernetes.io/instance"}, tracking)
+	})
+
+	t.Run("reads argocd-cm from the argocd namespace", func(t *testing.T) {
+		client := fake.NewClientset(argoCDConfig("argocd", map[string]string{
+			"application.resourceTrackingMethod": "label",
+			"application.instanceLabelKey":       "argocd.argoproj.io/instance",
+		}))
+
+		tracking := resolveArgoCDTracking(ctx, client, ArgoCDOptions{Application: "preview"})
+		assert.Equal(t, "label", tracking.method)
+		assert.Equal(t, "argocd.argoproj.io/instance", tracking.labelKey)
+	})
+
+	t.Run("reads argocd-cm from another namespace", func(t *testing.T) {
+		client := fake.NewClientset(argoCDConfig("gitops", map[string]string{"application.resourceTrackingMethod": "annotation+label"}))
+
+		tracking := resolveArgoCDTracking(ctx, client, ArgoCDOptions{Application: "preview", Namespace: "gitops"})
+		assert.Equal(t, "annotation+label", tracking.method)
+		assert.Equal(t, "app.kubernetes.io/instance", tracking.labelKey)
+	})
+
+	t.Run("defaults when argocd-cm cannot be read", func(t *testing.T) {
+		client := fake.NewClientset(argoCDConfig("argocd", map[string]string{"application.resourceTrackingMethod": "label"}))
+		client.PrependReactor("get", "configmaps", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, assert.AnError
+		})
+
+		tracking := resolveArgoCDTracking(ctx, client, ArgoCDOptions{Application: "preview"})
+		assert.Equal(t, "annotation", tracking.method)
+	})
+}
+
+func TestArgoCDTrackingApply(t *testing.T) {
+	role := func() *rbacv1.ClusterRole {
+		return &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl"}}
+	}
+	cronJob := func() *batchv1.CronJob {
+		return &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{
+			Name:        "myapp-4a0c226a-ttl",
+			Namespace:   "default",
+			Labels:      map[string]string{LabelManagedBy: LabelManagedByValue},
+			Annotations: map[string]string{AnnotationGeneration: "1"},
+		}}
+	}
+
+	t.Run("nil tracking does nothing", func(t *testing.T) {
+		var tracking *argoCDTracking
+		cj := cronJob()
+		tracking.apply(cj)
+		assert.Equal(t, cronJob(), cj)
+	})
+
+	t.Run("annotation tracking", func(t *testing.T) {
+		tracking := &argoCDTracking{application: "preview", method: "annotation", labelKey: "app.kubernetes.io/instance"}
+		cj, cr := cronJob(), role()
+		tracking.apply(cj, cr)
+
+		assert.Equal(t, map[string]string{
+			AnnotationGeneration:           "1",
+			AnnotationArgoCDTrackingID:     "preview:batch/CronJob:default/myapp-4a0c226a-ttl",
+			AnnotationArgoCDSyncOptions:    "Prune=false",
+			AnnotationArgoCDCompareOptions: "IgnoreExtraneous",
+		}, cj.Annotations)
+		assert.Equal(t, map[string]string{LabelManagedBy: LabelManagedByValue}, cj.Labels)
+		assert.Equal(t, "preview:rbac.authorization.k8s.io/ClusterRole:/myapp-4a0c226a-ttl", cr.Annotations[AnnotationArgoCDTrackingID])
+	})
+
+	t.Run("core resources have an empty group", func(t *testing.T) {
+		tracking := &argoCDTracking{application: "preview", method: "annotation"}
+		sa := serviceAccount("myapp-4a0c226a-ttl", "default", nil, nil)
+		tracking.apply(sa)
+
+		assert.Equal(t, "preview:/ServiceAccount:default/myapp-4a0c226a-ttl", sa.Annotations[AnnotationArgoCDTrackingID])
+	})
+
+	t.Run("label tracking", func(t *testing.T) {
+		tracking := &argoCDTracking{application: "preview", method: "label", labelKey: "app.kubernetes.io/instance"}
+		cj := cronJob()
+		tracking.apply(cj)
+
+		assert.Equal(t, "preview", cj.Labels["app.kubernetes.io/instance"])
+		assert.Equal(t, LabelManagedByValue, cj.Labels[LabelManagedBy])
+		assert.NotContains(t, cj.Annotations, AnnotationArgoCDTrackingID)
+		assert.Equal(t, "Prune=false", cj.Annotations[AnnotationArgoCDSyncOptions])
+	})
+
+	t.Run("annotation and label tracking", func(t *testing.T) {
+		tracking := &argoCDTracking{application: "preview", method: "annotation+label", labelKey: "app.kubernetes.io/instance"}
+		cj := cronJob()
+		tracking.apply(cj)
+
+		assert.Equal(t, "preview", cj.Labels["app.kubernetes.io/instance"])
+		assert.Contains(t, cj.Annotations, AnnotationArgoCDTrackingID)
+	})
+
+	t.Run("label value is kept valid", func(t *testing.T) {
+		tracking := &argoCDTracking{application: "team-a_preview/with/slashes", method: "label", labelKey: "app.kubernetes.io/instance"}
+		cj := cronJob()
+		tracking.apply(cj)
+
+		assert.Equal(t, LabelValue("team-a_preview/with/slashes"), cj.Labels["app.kubernetes.io/instance"])
+	})
+
+	t.Run("shared maps are not modified", func(t *testing.T) {
+		tracking := &argoCDTracking{application: "preview", method: "annotation"}
+		labels := map[string]string{LabelManagedBy: LabelManagedByValue}
+		annotations := map[string]string{LabelRelease: "myapp"}
+		spec := releaseRBAC("myapp-4a0c226a-ttl", "myapp", "default", "default", "myapp-4a0c226a-ttl", false, "secrets")
+		spec.labels, spec.annotations = labels, annotations
+		objs := spec.objects()
+		tracking.apply(objs...)
+
+		assert.Equal(t, map[string]string{LabelRelease: "myapp"}, annotations)
+		assert.Equal(t, "preview:/ServiceAccount:default/myapp-4a0c226a-ttl", objs[0].(metav1.Object).GetAnnotations()[AnnotationArgoCDTrackingID])
+		assert.Equal(t, "preview:rbac.authorization.k8s.io/Role:default/myapp-4a0c226a-ttl", objs[1].(metav1.Object).GetAnnotations()[AnnotationArgoCDTrackingID])
+		assert.Equal(t, "preview:rbac.authorization.k8s.io/RoleBinding:default/myapp-4a0c226a-ttl", objs[2].(metav1.Object).GetAnnotations()[AnnotationArgoCDTrackingID])
+	})
+}
+
+func TestSetTTLArgoCDTracking(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("tracks the CronJob and RBAC", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "staging")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "staging",
+			CronjobNamespace:     "ops",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			DeleteNamespace:      true,
+			ArgoCD:               ArgoCDOptions{Application: "preview"},
+		})
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "preview:batch/CronJob:ops/myapp-80081014-ttl", cj.Annotations[AnnotationArgoCDTrackingID])
+		assert.Equal(t, "Prune=false", cj.Annotations[AnnotationArgoCDSyncOptions])
+		assert.Equal(t, "IgnoreExtraneous", cj.Annotations[AnnotationArgoCDCompareOptions])
+
+		sa, err := client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "preview:/ServiceAccount:ops/myapp-80081014-ttl", sa.Annotations[AnnotationArgoCDTrackingID])
+
+		role, err := client.RbacV1().Roles("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "preview:rbac.authorization.k8s.io/Role:staging/myapp-80081014-ttl", role.Annotations[AnnotationArgoCDTrackingID])
+
+		crb, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "preview:rbac.authorization.k8s.io/ClusterRoleBinding:/myapp-80081014-ttl", crb.Annotations[AnnotationArgoCDTrackingID])
+	})
+
+	t.Run("setting again without tracking removes it", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset(argoCDConfig("argocd", map[string]string{"application.resourceTrackingMethod": "annotation+label"}))
+		opts := SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			ArgoCD:               ArgoCDOptions{Application: "preview"},
+		}
+		_, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "preview", cj.Labels["app.kubernetes.io/instance"])
+
+		opts.ArgoCD = ArgoCDOptions{}
+		_, err = SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+
+		cj, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, cj.Labels, "app.kubernetes.io/instance")
+		assert.NotContains(t, cj.Annotations, AnnotationArgoCDTrackingID)
+		assert.NotContains(t, cj.Annotations, AnnotationArgoCDSyncOptions)
+
+		sa, err := client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, sa.Labels, "app.kubernetes.io/instance")
+		assert.NotContains(t, sa.Annotations, AnnotationArgoCDCompareOptions)
+	})
+
+	t.Run("exported resources are tracked", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+
+		objs, err := ExportTTL(ctx, cfg, fake.NewClientset(), SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			ArgoCD:               ArgoCDOptions{Application: "preview"},
+		})
+		require.NoError(t, err)
+		require.Len(t, objs, 4)
+		for _, obj := range objs {
+			assert.Equal(t, "Prune=false", obj.(metav1.Object).GetAnnotations()[AnnotationArgoCDSyncOptions], objectKind(obj))
+		}
+	})
+}
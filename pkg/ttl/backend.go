@@ -0,0 +1,157 @@
+package ttl
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	typedbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+)
+
+const (
+	// BackendCronJob keeps each TTL as a CronJob scheduled at its expiry.
+	// It is the default.
+	BackendCronJob = "cronjob"
+	// BackendJobSleep keeps each TTL as a Job that sleeps until its
+	// expiry, for clusters that do not allow CronJobs.
+	BackendJobSleep = "job-sleep"
+	// BackendController keeps each TTL as a ConfigMap that helm ttl
+	// controller expires with the Helm SDK, for clusters that should run
+	// no uninstall Jobs.
+	BackendController = "controller"
+	// BackendReleaseTTL keeps each TTL as a ReleaseTTL custom resource
+	// that helm ttl controller expires, for clusters whose TTLs are
+	// declared in Git.
+	BackendReleaseTTL = "releasettl"
+)
+
+// Backend keeps the TTLs of releases as Kubernetes objects. The rest of
+// helm-ttl builds, reads and writes TTLs as CronJobs; a backend other
+// than BackendCronJob translates them to and from the objects it keeps.
+type Backend interface {
+	// Name is the name --backend selects the backend by.
+	Name() string
+	// GroupVersionKind is the kind of the object a TTL is kept as, which
+	// its Events and owner references name.
+	GroupVersionKind() schema.GroupVersionKind
+	// CronJobs returns the TTLs kept in namespace.
+	CronJobs(client kubernetes.Interface, namespace string) typedbatchv1.CronJobInterface
+	// Object returns the object the backend keeps the TTL CronJob cj as
+	// when set at now, and fails for a TTL it cannot keep.
+	Object(cj *batchv1.CronJob, now time.Time) (runtime.Object, error)
+	// Rules are the rules the uninstall Job needs in the CronJob
+	// namespace beyond those the cronjob backend grants.
+	Rules() []rbacv1.PolicyRule
+	// RunsJobs reports whether the uninstall runs in a Job, which needs
+	// the ServiceAccount and RBAC of the TTL.
+	RunsJobs() bool
+}
+
+// backends are the backends --backend selects from, by name.
+var backends = map[string]Backend{
+	BackendCronJob:    cronJobBackend{},
+	BackendJobSleep:   jobSleepBackend{},
+	BackendController: controllerBackend{},
+	BackendReleaseTTL: releaseTTLBackend{},
+}
+
+// LookupBackend returns the backend named name, or the cronjob backend for
+// "".
+func LookupBackend(name string) (Backend, error) {
+	if name == "" {
+		name = BackendCronJob
+	}
+
+	backend, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q: use %s", name, strings.Join(slices.Sorted(maps.Keys(backends)), " or "))
+	}
+
+	return backend, nil
+}
+
+// WithBackend returns a client whose BatchV1 CronJobs are the TTLs kept by
+// the backend named name. The cronjob backend returns client unchanged,
+// and the releasettl backend, which needs a dynamic client, is only
+// available from WithReleaseTTLs.
+func WithBackend(client kubernetes.Interface, name string) (kubernetes.Interface, error) {
+	backend, err := LookupBackend(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch backend.Name() {
+	case BackendCronJob:
+		return client, nil
+	case BackendReleaseTTL:
+		return nil, fmt.Errorf("the %s backend needs a dynamic client; use WithReleaseTTLs", BackendReleaseTTL)
+	}
+
+	return &backendClient{Interface: client, backend: backend}, nil
+}
+
+// BackendOf returns the backend of a client from WithBackend, and the
+// cronjob backend for any other client.
+func BackendOf(client kubernetes.Interface) Backend {
+	if c, ok := client.(*backendClient); ok {
+		return c.backend
+	}
+
+	return cronJobBackend{}
+}
+
+// backendClient serves the CronJobs of BatchV1 from a backend.
+type backendClient struct {
+	kubernetes.Interface
+	backend Backend
+}
+
+// IsWatchListSemanticsUnSupported passes on to informers that the wrapped
+// client, such as a fake clientset, cannot stream the initial list of a
+// watch.
+func (c *backendClient) IsWatchListSemanticsUnSupported() bool {
+	unsupported, ok := c.Interface.(interface{ IsWatchListSemanticsUnSupported() bool })
+	return ok && unsupported.IsWatchListSemanticsUnSupported()
+}
+
+func (c *backendClient) BatchV1() typedbatchv1.BatchV1Interface {
+	return &backendBatch{BatchV1Interface: c.Interface.BatchV1(), client: c}
+}
+
+// backendBatch serves Jobs from the cluster and CronJobs from the backend.
+type backendBatch struct {
+	typedbatchv1.BatchV1Interface
+	client *backendClient
+}
+
+func (b *backendBatch) CronJobs(namespace string) typedbatchv1.CronJobInterface {
+	return b.client.backend.CronJobs(b.client.Interface, namespace)
+}
+
+// cronJobBackend keeps TTLs as CronJobs.
+type cronJobBackend struct{}
+
+func (cronJobBackend) Name() string { return BackendCronJob }
+
+func (cronJobBackend) GroupVersionKind() schema.GroupVersionKind {
+	return batchv1.SchemeGroupVersion.WithKind("CronJob")
+}
+
+func (cronJobBackend) CronJobs(client kubernetes.Interface, namespace string) typedbatchv1.CronJobInterface {
+	return client.BatchV1().CronJobs(namespace)
+}
+
+func (cronJobBackend) Object(cj *batchv1.CronJob, _ time.Time) (runtime.Object, error) {
+	return cj, nil
+}
+
+func (cronJobBackend) Rules() []rbacv1.PolicyRule { return nil }
+
+func (cronJobBackend) RunsJobs() bool { return true }
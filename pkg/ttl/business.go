@@ -0,0 +1,126 @@
+package ttl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// endOfDayHour is the hour eod and end of week stand for.
+const endOfDayHour = 17
+
+// partsOfDay are the hours the parts of a day stand for, as in monday
+// morning or friday eod.
+var partsOfDay = map[string]int{
+	"morning":   9,
+	"noon":      12,
+	"midday":    12,
+	"afternoon": 14,
+	"eod":       endOfDayHour,
+	"evening":   18,
+	"night":     21,
+}
+
+var (
+	endOfDayPattern       = regexp.MustCompile(`^(?:eod|cob|end of (?:the )?day|close of business)$`)
+	endOfWeekPattern      = regexp.MustCompile(`^(?:eow|end of (?:the )?week)$`)
+	dayPhrasePattern      = regexp.MustCompile(`^(?:this\s+)?([a-z]+)(?:\s+(morning|noon|midday|afternoon|eod|evening|night))?` + timeOfDayPattern + `$`)
+	weekdayNames          = map[string]time.Weekday{}
+	errNotABusinessPhrase = errors.New("not a business-calendar phrase")
+)
+
+func init() {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		weekdayNames[name] = d
+		weekdayNames[name[:3]] = d
+	}
+	weekdayNames["tues"] = time.Tuesday
+	weekdayNames["thur"] = time.Thursday
+	weekdayNames["thurs"] = time.Thursday
+}
+
+// parseBusinessPhrase parses the phrases people use for the end of a
+// working day or week: eod and end of day (17:00), eow and end of week
+// (Friday 17:00), and a day with a part of the day or a time, such as
+// monday morning, friday 6pm, tomorrow evening or tonight. A day is today,
+// tomorrow or the next occurrence of a weekday, today included while the
+// time is still ahead; eod and eow likewise move to the next day or week
+// once passed. It returns errNotABusinessPhrase for other input.
+func parseBusinessPhrase(input string, now time.Time) (time.Time, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(input), " "))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	at := func(day time.Time, hour, minute int) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, now.Location())
+	}
+
+	if endOfDayPattern.MatchString(s) {
+		t := at(today, endOfDayHour, 0)
+		if !t.After(now) {
+			t = at(today.AddDate(0, 0, 1), endOfDayHour, 0)
+		}
+
+		return t, nil
+	}
+
+	if endOfWeekPattern.MatchString(s) {
+		return nextWeekdayAt(today, time.Friday, now, func(day time.Time) time.Time {
+			return at(day, endOfDayHour, 0)
+		}), nil
+	}
+
+	if s == "tonight" {
+		s = "today night"
+	}
+
+	m := dayPhrasePattern.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, errNotABusinessPhrase
+	}
+
+	weekday, isWeekday := weekdayNames[m[1]]
+	if !isWeekday && m[1] != "today" && m[1] != "tomorrow" {
+		return time.Time{}, errNotABusinessPhrase
+	}
+
+	// A day alone is left to natural language parsing
+	if m[2] == "" && m[3] == "" {
+		return time.Time{}, errNotABusinessPhrase
+	}
+
+	if m[2] != "" && m[3] != "" {
+		return time.Time{}, fmt.Errorf("invalid time in %q: give either a part of the day or a time", input)
+	}
+
+	hour, minute, err := parseTimeOfDay(input, m[3], m[4], m[5])
+	if err != nil {
+		return time.Time{}, err
+	}
+	if m[2] != "" {
+		hour = partsOfDay[m[2]]
+	}
+
+	switch m[1] {
+	case "today":
+		return at(today, hour, minute), nil
+	case "tomorrow":
+		return at(today.AddDate(0, 0, 1), hour, minute), nil
+	}
+
+	return nextWeekdayAt(today, weekday, now, func(day time.Time) time.Time {
+		return at(day, hour, minute)
+	}), nil
+}
+
+// nextWeekdayAt returns at of the first day on weekday from today whose
+// time is after now.
+func nextWeekdayAt(today time.Time, weekday time.Weekday, now time.Time, at func(day time.Time) time.Time) time.Time {
+	day := today.AddDate(0, 0, (int(weekday)-int(today.Weekday())+7)%7)
+	if t := at(day); t.After(now) {
+		return t
+	}
+
+	return at(day.AddDate(0, 0, 7))
+}
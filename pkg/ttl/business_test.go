@@ -0,0 +1,88 @@
+package ttl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBusinessPhrase(t *testing.T) {
+	// A Wednesday morning
+	now := time.Date(2025, 6, 11, 10, 0, 0, 0, time.UTC)
+	date := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 6, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"eod", date(11, 17, 0)},
+		{"EOD", date(11, 17, 0)},
+		{"end of the day", date(11, 17, 0)},
+		{"close of business", date(11, 17, 0)},
+		{"eow", date(13, 17, 0)},
+		{"end of week", date(13, 17, 0)},
+		{"friday 17:00", date(13, 17, 0)},
+		{"friday 6pm", date(13, 18, 0)},
+		{"Friday at 6pm", date(13, 18, 0)},
+		{"fri eod", date(13, 17, 0)},
+		{"this friday evening", date(13, 18, 0)},
+		{"monday morning", date(16, 9, 0)},
+		{"wednesday 3pm", date(11, 15, 0)},
+		{"wednesday 9am", date(18, 9, 0)},
+		{"tomorrow afternoon", date(12, 14, 0)},
+		{"tonight", date(11, 21, 0)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := parseBusinessPhrase(tc.input, now)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+
+	t.Run("after hours", func(t *testing.T) {
+		// A Friday evening
+		late := time.Date(2025, 6, 13, 19, 0, 0, 0, time.UTC)
+
+		got, err := parseBusinessPhrase("eod", late)
+		require.NoError(t, err)
+		assert.Equal(t, date(14, 17, 0), got)
+
+		got, err = parseBusinessPhrase("eow", late)
+		require.NoError(t, err)
+		assert.Equal(t, date(20, 17, 0), got)
+	})
+
+	t.Run("other input", func(t *testing.T) {
+		for _, input := range []string{"friday", "next friday 6pm", "march 5pm", "in 2 hours"} {
+			_, err := parseBusinessPhrase(input, now)
+			assert.ErrorIs(t, err, errNotABusinessPhrase, input)
+		}
+	})
+
+	t.Run("invalid time", func(t *testing.T) {
+		_, err := parseBusinessPhrase("friday morning 9am", now)
+		assert.EqualError(t, err, `invalid time in "friday morning 9am": give either a part of the day or a time`)
+
+		_, err = parseBusinessPhrase("friday 13pm", now)
+		assert.EqualError(t, err, `invalid time in "friday 13pm": hour must be 1-12 with am/pm`)
+	})
+}
+
+func TestParseTimeInput_BusinessPhrases(t *testing.T) {
+	now := time.Date(2025, 6, 11, 10, 0, 0, 0, time.UTC)
+
+	got, err := ParseTimeInput("friday 6pm", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 6, 13, 18, 0, 0, 0, time.UTC), got)
+
+	// A weekday alone is its next occurrence, not the last one
+	got, err = ParseTimeInput("monday", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 6, 16, 0, 0, 0, 0, time.UTC), got)
+}
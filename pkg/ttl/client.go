@@ -0,0 +1,215 @@
+package ttl
+
+import (
+	"context"
+	"io"
+
+	"helm.sh/helm/v3/pkg/action"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Client manages the TTLs of releases for programs embedding helm-ttl. It
+// holds what the package functions take on every call: the Kubernetes
+// client, the Helm configuration of each release namespace, the namespaces
+// and the defaults of SetTTLOptions, so each call only names the release.
+// A Client is safe for concurrent use.
+type Client struct {
+	kube             kubernetes.Interface
+	kubeOptions      KubeOptions
+	helmConfig       func(namespace string) (*action.Configuration, error)
+	namespace        string
+	cronjobNamespace string
+	setDefaults      SetTTLOptions
+	logFetcher       LogFetcher
+	out              io.Writer
+}
+
+// ClientOption configures a Client built by NewClient.
+type ClientOption func(*Client)
+
+// WithKubeClient makes the Client use client rather than one built from
+// its KubeOptions, e.g. a fake clientset in tests.
+func WithKubeClient(client kubernetes.Interface) ClientOption {
+	return func(c *Client) { c.kube = client }
+}
+
+// WithKubeOptions sets the connection settings the Kubernetes client and
+// Helm configurations are built with. They default to those of
+// DefaultsFromEnv.
+func WithKubeOptions(opts KubeOptions) ClientOption {
+	return func(c *Client) { c.kubeOptions = opts }
+}
+
+// WithHelmConfig makes the Client read releases through newConfig, which
+// returns the Helm configuration of a release namespace, rather than
+// through NewConfiguration.
+func WithHelmConfig(newConfig func(namespace string) (*action.Configuration, error)) ClientOption {
+	return func(c *Client) { c.helmConfig = newConfig }
+}
+
+// WithNamespace sets the namespace of the releases, which defaults to
+// HELM_NAMESPACE or "default".
+func WithNamespace(namespace string) ClientOption {
+	return func(c *Client) { c.namespace = namespace }
+}
+
+// WithCronjobNamespace sets the namespace the TTL CronJobs live in, which
+// defaults to the release namespace.
+func WithCronjobNamespace(namespace string) ClientOption {
+	return func(c *Client) { c.cronjobNamespace = namespace }
+}
+
+// WithSetDefaults sets the options Set starts from, which default to
+// those of DefaultsFromEnv. Their release name, duration and namespaces
+// are ignored.
+func WithSetDefaults(opts SetTTLOptions) ClientOption {
+	return func(c *Client) { c.setDefaults = opts }
+}
+
+// WithLogFetcher sets how Run reads the logs of the uninstall pod, which
+// defaults to the Kubernetes API.
+func WithLogFetcher(logFetcher LogFetcher) ClientOption {
+	return func(c *Client) { c.logFetcher = logFetcher }
+}
+
+// WithOutput makes Run stream the logs of the uninstall pod to w, which
+// defaults to discarding them.
+func WithOutput(w io.Writer) ClientOption {
+	return func(c *Client) { c.out = w }
+}
+
+// NewClient returns a Client configured by opts. Without WithKubeClient it
+// connects with NewKubeClient.
+func NewClient(opts ...ClientOption) (*Client, error) {
+	defaults := DefaultsFromEnv()
+	c := &Client{
+		kubeOptions: defaults.Kube,
+		namespace:   defaults.Namespace,
+		setDefaults: defaults.SetTTL,
+		out:         io.Discard,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.kube == nil {
+		kube, err := NewKubeClient(c.kubeOptions)
+		if err != nil {
+			return nil, err
+		}
+		c.kube = kube
+	}
+
+	if c.helmConfig == nil {
+		kubeOptions := c.kubeOptions
+		c.helmConfig = func(namespace string) (*action.Configuration, error) {
+			return NewConfiguration(namespace, kubeOptions)
+		}
+	}
+
+	if c.logFetcher == nil {
+		c.logFetcher = NewKubeLogFetcher(c.kube)
+	}
+
+	return c, nil
+}
+
+// Kubernetes returns the Kubernetes client, for the package functions
+// Client has no method for.
+func (c *Client) Kubernetes() kubernetes.Interface {
+	return c.kube
+}
+
+// Namespace returns the namespace of the releases the Client manages.
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// InNamespace returns a copy of the Client managing the releases of
+// namespace, with their CronJobs in the same namespace unless
+// WithCronjobNamespace set another.
+func (c *Client) InNamespace(namespace string) *Client {
+	copied := *c
+	copied.namespace = namespace
+
+	return &copied
+}
+
+// cronjobNs returns the namespace of the TTL CronJobs.
+func (c *Client) cronjobNs() string {
+	if c.cronjobNamespace != "" {
+		return c.cronjobNamespace
+	}
+
+	return c.namespace
+}
+
+// SetOption changes the options of a single Set call.
+type SetOption func(*SetTTLOptions)
+
+// Set sets the TTL of a release to duration, in any format SetTTL
+// accepts, starting from the Client's set defaults.
+func (c *Client) Set(ctx context.Context, releaseName, duration string, opts ...SetOption) (*SetResult, error) {
+	setOpts := c.setDefaults
+	setOpts.ReleaseName = releaseName
+	setOpts.ReleaseNamespace = c.namespace
+	setOpts.CronjobNamespace = c.cronjobNs()
+	setOpts.Duration = duration
+	if setOpts.ServiceAccount == "" {
+		setOpts.ServiceAccount = "default"
+	}
+	for _, opt := range opts {
+		opt(&setOpts)
+	}
+
+	cfg, err := c.helmConfig(setOpts.ReleaseNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return SetTTL(ctx, cfg, c.kube, setOpts)
+}
+
+// Get returns the TTL of a release.
+func (c *Client) Get(ctx context.Context, releaseName string) (*TTLInfo, error) {
+	return GetTTL(ctx, c.kube, releaseName, c.namespace, c.cronjobNs())
+}
+
+// List returns the TTLs of the releases in the Client's namespace.
+func (c *Client) List(ctx context.Context) ([]TTLInfo, error) {
+	return ListTTLs(ctx, c.kube, c.cronjobNs(), c.namespace)
+}
+
+// Unset removes the TTL of a release.
+func (c *Client) Unset(ctx context.Context, releaseName string) error {
+	return UnsetTTL(ctx, c.kube, releaseName, c.namespace, c.cronjobNs())
+}
+
+// RunOption changes the options of a single Run call.
+type RunOption func(*RunTTLOptions)
+
+// Run uninstalls a release now by running its TTL Job, streaming its logs
+// to the Client's output.
+func (c *Client) Run(ctx context.Context, releaseName string, opts ...RunOption) (*RunTTLResult, error) {
+	runOpts := RunTTLOptions{
+		ReleaseName:      releaseName,
+		ReleaseNamespace: c.namespace,
+		CronjobNamespace: c.cronjobNs(),
+	}
+	for _, opt := range opts {
+		opt(&runOpts)
+	}
+
+	return RunTTL(ctx, c.kube, c.out, c.logFetcher, runOpts)
+}
+
+// CleanupOrphaned deletes the helm-ttl resources left behind by
+// uninstalled releases, in the Client's namespace unless opts names
+// namespaces or all of them.
+func (c *Client) CleanupOrphaned(ctx context.Context, opts CleanupOrphanedOptions) ([]OrphanedResource, error) {
+	if len(opts.Namespaces) == 0 && !opts.AllNamespaces {
+		opts.Namespaces = []string{c.namespace}
+	}
+
+	return CleanupOrphaned(ctx, c.kube, opts)
+}
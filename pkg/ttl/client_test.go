@@ -0,0 +1,143 @@
+package ttl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/action"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("HELM_NAMESPACE", "")
+
+	newClient := func(t *testing.T, opts ...ClientOption) (*Client, *fake.Clientset) {
+		t.Helper()
+		cfg, _ := setupTestRelease(t, "myapp", "staging")
+		kube := fake.NewClientset()
+
+		client, err := NewClient(append([]ClientOption{
+			WithKubeClient(kube),
+			WithNamespace("staging"),
+			WithHelmConfig(func(namespace string) (*action.Configuration, error) {
+				assert.Equal(t, "staging", namespace)
+				return cfg, nil
+			}),
+		}, opts...)...)
+		require.NoError(t, err)
+
+		return client, kube
+	}
+
+	t.Run("set, get, list and unset", func(t *testing.T) {
+		client, kube := newClient(t)
+		assert.Same(t, kube, client.Kubernetes())
+		assert.Equal(t, "staging", client.Namespace())
+
+		result, err := client.Set(ctx, "myapp", "24h", func(o *SetTTLOptions) {
+			o.CreateServiceAccount = true
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "staging", result.CronjobNamespace)
+
+		_, err = kube.CoreV1().ServiceAccounts("staging").Get(ctx, result.CronJobName, metav1.GetOptions{})
+		require.NoError(t, err)
+
+		info, err := client.Get(ctx, "myapp")
+		require.NoError(t, err)
+		assert.Equal(t, result.ExpiresAt, info.ScheduledDate)
+
+		ttls, err := client.List(ctx)
+		require.NoError(t, err)
+		assert.Len(t, ttls, 1)
+
+		require.NoError(t, client.Unset(ctx, "myapp"))
+		_, err = client.Get(ctx, "myapp")
+		assert.Error(t, err)
+	})
+
+	t.Run("cronjob namespace and set defaults", func(t *testing.T) {
+		client, kube := newClient(t,
+			WithCronjobNamespace("ops"),
+			WithSetDefaults(SetTTLOptions{ServiceAccount: "ttl-runner", HelmImage: "registry.example.com/helm:3"}),
+		)
+
+		allowAccessReviews(kube)
+		_, err := kube.CoreV1().ServiceAccounts("ops").Create(ctx, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "ttl-runner", Namespace: "ops"}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		_, err = client.Set(ctx, "myapp", "24h")
+		require.NoError(t, err)
+
+		list, err := kube.BatchV1().CronJobs("ops").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, list.Items, 1)
+		podSpec := list.Items[0].Spec.JobTemplate.Spec.Template.Spec
+		assert.Equal(t, "ttl-runner", podSpec.ServiceAccountName)
+		for _, c := range podSpec.InitContainers {
+			if c.Name == "helm-uninstall" {
+				assert.Equal(t, "registry.example.com/helm:3", c.Image)
+			}
+		}
+
+		_, err = client.Get(ctx, "myapp")
+		require.NoError(t, err)
+	})
+
+	t.Run("in another namespace", func(t *testing.T) {
+		client, kube := newClient(t)
+		other := client.InNamespace("preview")
+		assert.Equal(t, "preview", other.Namespace())
+		assert.Equal(t, "staging", client.Namespace())
+
+		_, err := other.Get(ctx, "myapp")
+		assert.Error(t, err)
+
+		_, err = kube.CoreV1().ServiceAccounts("preview").Create(ctx, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name:      "orphan-ttl",
+			Namespace: "preview",
+			Labels:    releaseLabels("orphan", "preview"),
+		}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		removed, err := other.CleanupOrphaned(ctx, CleanupOrphanedOptions{DryRun: true})
+		require.NoError(t, err)
+		require.Len(t, removed, 1)
+		assert.Equal(t, "orphan-ttl", removed[0].Name)
+
+		removed, err = client.CleanupOrphaned(ctx, CleanupOrphanedOptions{DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, removed)
+	})
+
+	t.Run("run dry run", func(t *testing.T) {
+		var out bytes.Buffer
+		client, _ := newClient(t, WithOutput(&out), WithSetDefaults(SetTTLOptions{CreateServiceAccount: true}))
+
+		_, err := client.Set(ctx, "myapp", "24h")
+		require.NoError(t, err)
+
+		result, err := client.Run(ctx, "myapp", func(o *RunTTLOptions) { o.DryRun = true })
+		require.NoError(t, err)
+		assert.True(t, result.DryRun)
+	})
+
+	t.Run("helm config error", func(t *testing.T) {
+		client, err := NewClient(
+			WithKubeClient(fake.NewClientset()),
+			WithHelmConfig(func(string) (*action.Configuration, error) { return nil, errors.New("no cluster") }),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, "default", client.Namespace())
+
+		_, err = client.Set(ctx, "myapp", "24h")
+		assert.EqualError(t, err, "no cluster")
+	})
+}
@@ -0,0 +1,129 @@
+package ttl
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// TTLColumns are the columns FormatTTLTable can show.
+var TTLColumns = []string{"release", "namespace", "cronjob-namespace", "expires", "remaining", "delete-ns", "schedule", "generation", "warning"}
+
+// DefaultTTLColumns are the columns helm ttl list shows without --columns.
+var DefaultTTLColumns = []string{"release", "namespace", "cronjob-namespace", "expires", "remaining", "warning"}
+
+// TTLSortKeys are the orders SortTTLs accepts.
+var TTLSortKeys = []string{"release", "namespace", "expires", "remaining"}
+
+// ttlColumn is the header and the cell of a TTLColumns column.
+type ttlColumn struct {
+	header string
+	value  func(TTLInfo) string
+}
+
+var ttlColumns = map[string]ttlColumn{
+	"release":           {"RELEASE", func(i TTLInfo) string { return i.ReleaseName }},
+	"namespace":         {"NAMESPACE", func(i TTLInfo) string { return i.ReleaseNamespace }},
+	"cronjob-namespace": {"CRONJOB NAMESPACE", func(i TTLInfo) string { return i.CronjobNamespace }},
+	"expires":           {"SCHEDULED DATE", func(i TTLInfo) string { return i.ScheduledDate }},
+	"remaining":         {"REMAINING", func(i TTLInfo) string { return i.Remaining }},
+	"delete-ns":         {"DELETE NAMESPACE", func(i TTLInfo) string { return yesNo(i.DeleteNamespace) }},
+	"schedule":          {"CRON SCHEDULE", func(i TTLInfo) string { return i.CronSchedule }},
+	"generation":        {"GENERATION", func(i TTLInfo) string { return strconv.FormatInt(i.Generation, 10) }},
+	"warning":           {"WARNING", func(i TTLInfo) string { return orNone(strings.Join(i.Warnings, "; ")) }},
+}
+
+// ParseTTLColumns reads a comma-separated list of TTLColumns, such as
+// release,namespace,remaining.
+func ParseTTLColumns(spec string) ([]string, error) {
+	var columns []string
+	for _, column := range strings.Split(spec, ",") {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if _, ok := ttlColumns[column]; !ok {
+			return nil, fmt.Errorf("unknown column %q: use %s", column, strings.Join(TTLColumns, ", "))
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
+
+// FormatTTLTable formats TTLs as a table of the given TTLColumns. With
+// noHeaders, for scripts, the header row and the message for no TTLs are
+// left out.
+func FormatTTLTable(ttls []TTLInfo, columns []string, noHeaders bool) string {
+	if len(ttls) == 0 {
+		if noHeaders {
+			return ""
+		}
+
+		return "No TTLs found.\n"
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+
+	cells := make([]string, len(columns))
+	if !noHeaders {
+		for i, column := range columns {
+			cells[i] = ttlColumns[column].header
+		}
+		_, _ = fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+
+	for _, info := range ttls {
+		for i, column := range columns {
+			cells[i] = ttlColumns[column].value(info)
+		}
+		_, _ = fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	_ = w.Flush()
+
+	return buf.String()
+}
+
+// SortTTLs orders TTLs by one of TTLSortKeys. expires and remaining both
+// put the TTLs that fire first, missed ones included, first.
+func SortTTLs(ttls []TTLInfo, by string) error {
+	if !slices.Contains(TTLSortKeys, by) {
+		return fmt.Errorf("invalid sort key %q: use %s", by, strings.Join(TTLSortKeys, ", "))
+	}
+
+	sort.SliceStable(ttls, func(i, j int) bool {
+		a, b := ttls[i], ttls[j]
+		switch by {
+		case "namespace":
+			if a.ReleaseNamespace != b.ReleaseNamespace {
+				return a.ReleaseNamespace < b.ReleaseNamespace
+			}
+		case "expires", "remaining":
+			ta, _ := time.Parse(time.RFC3339, a.ScheduledDate)
+			tb, _ := time.Parse(time.RFC3339, b.ScheduledDate)
+			if !ta.Equal(tb) {
+				return ta.Before(tb)
+			}
+		}
+
+		if a.ReleaseName != b.ReleaseName {
+			return a.ReleaseName < b.ReleaseName
+		}
+
+		return a.ReleaseNamespace < b.ReleaseNamespace
+	})
+
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
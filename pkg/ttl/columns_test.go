@@ -0,0 +1,67 @@
+package ttl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTTLColumns(t *testing.T) {
+	columns, err := ParseTTLColumns("release, Remaining,delete-ns")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"release", "remaining", "delete-ns"}, columns)
+
+	_, err = ParseTTLColumns("release,age")
+	assert.EqualError(t, err, `unknown column "age": use release, namespace, cronjob-namespace, expires, remaining, delete-ns, schedule, generation, warning`)
+}
+
+func TestFormatTTLTable(t *testing.T) {
+	ttls := []TTLInfo{
+		{ReleaseName: "cart", ReleaseNamespace: "shop", ScheduledDate: "2025-03-10T09:00:00Z", Remaining: "2d", DeleteNamespace: true},
+		{ReleaseName: "search", ReleaseNamespace: "default", ScheduledDate: "2025-03-09T09:00:00Z", Remaining: "1d", Generation: 3},
+	}
+
+	assert.Equal(t, "RELEASE  REMAINING  DELETE NAMESPACE\n"+
+		"cart     2d         yes\n"+
+		"search   1d         no\n", FormatTTLTable(ttls, []string{"release", "remaining", "delete-ns"}, false))
+	assert.Equal(t, "GENERATION  WARNING\n"+
+		"0           -\n"+
+		"3           -\n", FormatTTLTable(ttls, []string{"generation", "warning"}, false))
+	assert.Equal(t, "cart    2d\n"+
+		"search  1d\n", FormatTTLTable(ttls, []string{"release", "remaining"}, true))
+	assert.Equal(t, "No TTLs found.\n", FormatTTLTable(nil, DefaultTTLColumns, false))
+	assert.Empty(t, FormatTTLTable(nil, DefaultTTLColumns, true))
+}
+
+func TestSortTTLs(t *testing.T) {
+	ttls := func() []TTLInfo {
+		return []TTLInfo{
+			{ReleaseName: "api", ReleaseNamespace: "staging", ScheduledDate: "2025-03-12T09:00:00Z"},
+			{ReleaseName: "cart", ReleaseNamespace: "default", ScheduledDate: "2025-03-10T09:00:00Z"},
+			{ReleaseName: "web", ReleaseNamespace: "default", ScheduledDate: "2025-03-11T09:00:00Z"},
+		}
+	}
+	names := func(ttls []TTLInfo) []string {
+		var names []string
+		for _, info := range ttls {
+			names = append(names, info.ReleaseName)
+		}
+		return names
+	}
+
+	for by, want := range map[string][]string{
+		"release":   {"api", "cart", "web"},
+		"namespace": {"cart", "web", "api"},
+		"expires":   {"cart", "web", "api"},
+		"remaining": {"cart", "web", "api"},
+	} {
+		t.Run(by, func(t *testing.T) {
+			sorted := ttls()
+			require.NoError(t, SortTTLs(sorted, by))
+			assert.Equal(t, want, names(sorted))
+		})
+	}
+
+	assert.EqualError(t, SortTTLs(ttls(), "age"), `invalid sort key "age": use release, namespace, expires, remaining`)
+}
@@ -0,0 +1,415 @@
+package ttl
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
+	"k8s.io/client-go/kubernetes"
+	typedbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// controllerSpecKey is the key of the ConfigMap of a controller TTL that
+// holds the spec of its CronJob, as JSON.
+const controllerSpecKey = "cronjob-spec.json"
+
+// controllerContainers are the containers of a TTL CronJob whose work the
+// controller does itself.
+var controllerContainers = []string{
+	expiryGuardContainer, "helm-uninstall", "verify-uninstall", "delete-namespace", selfCleanupContainer,
+}
+
+// controllerBackend keeps each TTL as a ConfigMap that helm ttl
+// controller reads, uninstalling the release with the Helm SDK once the
+// TTL expires. No Job runs, so the TTL needs no images, ServiceAccount or
+// RBAC.
+type controllerBackend struct{}
+
+func (controllerBackend) Name() string { return BackendController }
+
+func (controllerBackend) GroupVersionKind() schema.GroupVersionKind {
+	return corev1.SchemeGroupVersion.WithKind("ConfigMap")
+}
+
+func (controllerBackend) CronJobs(client kubernetes.Interface, namespace string) typedbatchv1.CronJobInterface {
+	return &controllerCronJobs{configMaps: client.CoreV1().ConfigMaps(namespace)}
+}
+
+func (controllerBackend) Object(cj *batchv1.CronJob, _ time.Time) (runtime.Object, error) {
+	return controllerConfigMap(cj)
+}
+
+func (controllerBackend) Rules() []rbacv1.PolicyRule { return nil }
+
+func (controllerBackend) RunsJobs() bool { return false }
+
+// checkControllerTTL fails for a TTL the controller cannot expire for
+// the backend named backend: a namespace TTL, one without an expiry, or
+// one whose uninstall runs more than the controller does.
+func checkControllerTTL(cj *batchv1.CronJob, backend string) error {
+	if IsNamespaceTTL(cj) {
+		return fmt.Errorf("the %s backend does not support namespace TTLs", backend)
+	}
+
+	if _, err := time.Parse(time.RFC3339, cj.Annotations[AnnotationExpiresAt]); err != nil {
+		return fmt.Errorf("the %s backend needs the expiry of TTL %s in its %s annotation", backend, cj.Name, AnnotationExpiresAt)
+	}
+
+	if cj.Annotations[AnnotationNamespaceDeleteDelay] != "" {
+		return fmt.Errorf("the %s backend does not support --namespace-delete-delay", backend)
+	}
+
+	podSpec := cj.Spec.JobTemplate.Spec.Template.Spec
+	for _, c := range slices.Concat(podSpec.InitContainers, podSpec.Containers) {
+		if !slices.Contains(controllerContainers, c.Name) {
+			return fmt.Errorf("the %s backend cannot run the %s container of TTL %s: --abort-window, --two-phase, --delete-pvcs and --post-delete need the cronjob or job-sleep backend", backend, c.Name, cj.Name)
+		}
+	}
+
+	return nil
+}
+
+// controllerConfigMap returns the ConfigMap keeping the TTL of cj: its
+// labels and annotations, and its spec for the commands that read it. It
+// fails for a TTL whose uninstall runs more than the controller does.
+func controllerConfigMap(cj *batchv1.CronJob) (*corev1.ConfigMap, error) {
+	if err := checkControllerTTL(cj, BackendController); err != nil {
+		return nil, err
+	}
+
+	spec, err := json.Marshal(cj.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode TTL %s: %w", cj.Name, err)
+	}
+
+	labels := maps.Clone(cj.Labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[LabelBackend] = BackendController
+
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            cj.Name,
+			Namespace:       cj.Namespace,
+			Labels:          labels,
+			Annotations:     maps.Clone(cj.Annotations),
+			ResourceVersion: cj.ResourceVersion,
+			OwnerReferences: cj.OwnerReferences,
+		},
+		Data: map[string]string{controllerSpecKey: string(spec)},
+	}, nil
+}
+
+// controllerCronJobOf returns the TTL CronJob a ConfigMap from
+// controllerConfigMap keeps.
+func controllerCronJobOf(cm *corev1.ConfigMap) (*batchv1.CronJob, error) {
+	meta := *cm.ObjectMeta.DeepCopy()
+	meta.ManagedFields = nil
+	delete(meta.Labels, LabelBackend)
+
+	cj := &batchv1.CronJob{ObjectMeta: meta}
+	if err := json.Unmarshal([]byte(cm.Data[controllerSpecKey]), &cj.Spec); err != nil {
+		return nil, fmt.Errorf("failed to read TTL %s: %w", cm.Name, err)
+	}
+
+	return cj, nil
+}
+
+// controllerCronJobs serves the TTLs of a namespace from the ConfigMaps of
+// the controller backend.
+type controllerCronJobs struct {
+	configMaps typedcorev1.ConfigMapInterface
+}
+
+var _ typedbatchv1.CronJobInterface = &controllerCronJobs{}
+
+func (c *controllerCronJobs) Create(ctx context.Context, cj *batchv1.CronJob, opts metav1.CreateOptions) (*batchv1.CronJob, error) {
+	cm, err := controllerConfigMap(cj)
+	if err != nil {
+		return nil, err
+	}
+	cm.ResourceVersion = ""
+
+	return fromConfigMap(c.configMaps.Create(ctx, cm, opts))
+}
+
+func (c *controllerCronJobs) Update(ctx context.Context, cj *batchv1.CronJob, opts metav1.UpdateOptions) (*batchv1.CronJob, error) {
+	if _, err := c.get(ctx, cj.Name); err != nil {
+		return nil, err
+	}
+
+	cm, err := controllerConfigMap(cj)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromConfigMap(c.configMaps.Update(ctx, cm, opts))
+}
+
+func (c *controllerCronJobs) UpdateStatus(context.Context, *batchv1.CronJob, metav1.UpdateOptions) (*batchv1.CronJob, error) {
+	return nil, errors.NewMethodNotSupported(corev1.Resource("configmaps"), "update status of")
+}
+
+func (c *controllerCronJobs) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	if _, err := c.get(ctx, name); err != nil {
+		return err
+	}
+
+	return c.configMaps.Delete(ctx, name, opts)
+}
+
+func (c *controllerCronJobs) DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	return c.configMaps.DeleteCollection(ctx, opts, withBackendSelector(listOpts, BackendController))
+}
+
+func (c *controllerCronJobs) Get(ctx context.Context, name string, _ metav1.GetOptions) (*batchv1.CronJob, error) {
+	return fromConfigMap(c.get(ctx, name))
+}
+
+// get returns the ConfigMap of a controller TTL, and NotFound for other
+// ConfigMaps.
+func (c *controllerCronJobs) get(ctx context.Context, name string) (*corev1.ConfigMap, error) {
+	cm, err := c.configMaps.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if cm.Labels[LabelBackend] != BackendController {
+		return nil, errors.NewNotFound(corev1.Resource("configmaps"), name)
+	}
+
+	return cm, nil
+}
+
+func (c *controllerCronJobs) List(ctx context.Context, opts metav1.ListOptions) (*batchv1.CronJobList, error) {
+	configMaps, err := c.configMaps.List(ctx, withBackendSelector(opts, BackendController))
+	if err != nil {
+		return nil, err
+	}
+
+	list := &batchv1.CronJobList{ListMeta: configMaps.ListMeta}
+	for i := range configMaps.Items {
+		cj, err := controllerCronJobOf(&configMaps.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, *cj)
+	}
+
+	return list, nil
+}
+
+// Watch converts the ConfigMaps of each event, dropping those that fail
+// to.
+func (c *controllerCronJobs) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	w, err := c.configMaps.Watch(ctx, withBackendSelector(opts, BackendController))
+	if err != nil {
+		return nil, err
+	}
+
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		cm, ok := e.Object.(*corev1.ConfigMap)
+		if !ok {
+			return e, true
+		}
+
+		// Bookmarks only carry a resource version, and end the initial
+		// list of a watch-list
+		if e.Type == watch.Bookmark {
+			e.Object = &batchv1.CronJob{ObjectMeta: cm.ObjectMeta}
+			return e, true
+		}
+
+		cj, err := controllerCronJobOf(cm)
+		if err != nil {
+			return e, false
+		}
+		e.Object = cj
+
+		return e, true
+	}), nil
+}
+
+// Patch patches the ConfigMap of a TTL, so only patches of the metadata,
+// which ConfigMaps and CronJobs share, are supported. Apply patches go
+// through Apply.
+func (c *controllerCronJobs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*batchv1.CronJob, error) {
+	if pt == types.ApplyPatchType {
+		return c.apply(ctx, data, opts.FieldManager, opts.DryRun)
+	}
+
+	return fromConfigMap(c.configMaps.Patch(ctx, name, pt, data, opts, subresources...))
+}
+
+// Apply creates or updates the ConfigMap of a TTL from a CronJob apply
+// configuration, which must hold the whole CronJob.
+func (c *controllerCronJobs) Apply(ctx context.Context, cj *batchv1ac.CronJobApplyConfiguration, opts metav1.ApplyOptions) (*batchv1.CronJob, error) {
+	data, err := json.Marshal(cj)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.apply(ctx, data, opts.FieldManager, opts.DryRun)
+}
+
+func (c *controllerCronJobs) ApplyStatus(context.Context, *batchv1ac.CronJobApplyConfiguration, metav1.ApplyOptions) (*batchv1.CronJob, error) {
+	return nil, errors.NewMethodNotSupported(corev1.Resource("configmaps"), "apply status of")
+}
+
+func (c *controllerCronJobs) apply(ctx context.Context, data []byte, fieldManager string, dryRun []string) (*batchv1.CronJob, error) {
+	var cj batchv1.CronJob
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return nil, fmt.Errorf("failed to read CronJob: %w", err)
+	}
+	if cj.Name == "" {
+		return nil, fmt.Errorf("cronJob.Name must be provided to Apply")
+	}
+
+	if _, err := c.get(ctx, cj.Name); errors.IsNotFound(err) {
+		return c.Create(ctx, &cj, metav1.CreateOptions{DryRun: dryRun, FieldManager: fieldManager})
+	} else if err != nil {
+		return nil, err
+	}
+
+	return c.Update(ctx, &cj, metav1.UpdateOptions{DryRun: dryRun, FieldManager: fieldManager})
+}
+
+// fromConfigMap converts the result of a ConfigMap call.
+func fromConfigMap(cm *corev1.ConfigMap, err error) (*batchv1.CronJob, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return controllerCronJobOf(cm)
+}
+
+// ExpireTTL does what the uninstall Job of a TTL would, for a TTL of a
+// backend that runs no Jobs: it uninstalls the release with the Helm SDK,
+// deletes the release namespace when the TTL was set with
+// --delete-namespace, and removes the TTL. client must be of the backend
+// of the TTL. newConfig
+// returns the Helm configuration of a namespace for the storage driver
+// the TTL was set with.
+//
+// A failed expiry is retried by calling ExpireTTL again, so a release that
+// is already gone counts as uninstalled.
+func ExpireTTL(ctx context.Context, client kubernetes.Interface, cj *batchv1.CronJob, newConfig func(namespace, driver string) (*action.Configuration, error)) error {
+	releaseName, releaseNamespace := OriginalLabelValue(cj, LabelRelease), OriginalLabelValue(cj, LabelReleaseNamespace)
+	subject := fmt.Sprintf("release %q in namespace %q", releaseName, releaseNamespace)
+
+	err := uninstallRelease(cj, releaseName, releaseNamespace, newConfig)
+	if err == nil && cj.Labels[LabelDeleteNamespace] == "true" {
+		err = client.CoreV1().Namespaces().Delete(ctx, releaseNamespace, metav1.DeleteOptions{})
+		if errors.IsNotFound(err) {
+			err = nil
+		} else if err != nil {
+			err = fmt.Errorf("failed to delete namespace %q: %w", releaseNamespace, err)
+		}
+	}
+	if err != nil {
+		_ = recordEvent(ctx, client, cj, corev1.EventTypeWarning, EventReasonTTLExpiredUninstall,
+			fmt.Sprintf("helm ttl controller failed to uninstall %s: %v", subject, err))
+		return err
+	}
+
+	// Record history and an event (best effort)
+	_ = RecordHistory(ctx, client, releaseName, releaseNamespace, cj.Namespace, HistoryEntry{
+		Operation: OperationExpire,
+		OldExpiry: controllerExpiry(cj),
+	})
+	_ = recordEvent(ctx, client, cj, corev1.EventTypeNormal, EventReasonTTLExpiredUninstall,
+		"helm ttl controller uninstalled "+subject)
+
+	err = client.BatchV1().CronJobs(cj.Namespace).Delete(ctx, cj.Name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete TTL %s: %w", cj.Name, err)
+	}
+
+	return nil
+}
+
+// uninstallRelease runs the helm uninstall of a TTL CronJob with the Helm
+// SDK.
+func uninstallRelease(cj *batchv1.CronJob, releaseName, releaseNamespace string, newConfig func(namespace, driver string) (*action.Configuration, error)) error {
+	cfg, err := newConfig(releaseNamespace, cronJobDriver(cj))
+	if err != nil {
+		return fmt.Errorf("failed to load the Helm configuration of namespace %q: %w", releaseNamespace, err)
+	}
+
+	u := cronJobUninstallOptions(cj)
+	uninstall := action.NewUninstall(cfg)
+	uninstall.Wait = u.Wait
+	// 5m is the default --timeout of helm uninstall
+	uninstall.Timeout = cmp.Or(u.Timeout, 5*time.Minute)
+	uninstall.KeepHistory = u.KeepHistory
+	uninstall.DisableHooks = u.NoHooks
+	uninstall.DeletionPropagation = cmp.Or(u.Cascade, "background")
+	uninstall.IgnoreNotFound = true
+	if _, err := uninstall.Run(releaseName); err != nil {
+		return fmt.Errorf("failed to uninstall release %q: %w", releaseName, err)
+	}
+
+	return nil
+}
+
+// controllerExpiry returns the expiry of a TTL the controller expires,
+// which checkControllerTTL requires.
+func controllerExpiry(cj *batchv1.CronJob) string {
+	expiresAt, err := time.Parse(time.RFC3339, cj.Annotations[AnnotationExpiresAt])
+	if err != nil {
+		return ""
+	}
+
+	return FormatScheduledDate(expiresAt)
+}
+
+// cronJobUninstallOptions returns the options of the helm uninstall a TTL
+// CronJob runs, from the command of its helm-uninstall container.
+func cronJobUninstallOptions(cj *batchv1.CronJob) UninstallOptions {
+	var u UninstallOptions
+	for _, c := range cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers {
+		if c.Name != "helm-uninstall" {
+			continue
+		}
+
+		args := uninstallArgs(unwrappedCommand(c))
+		for i := 0; i < len(args); i++ {
+			switch args[i] {
+			case "--wait":
+				u.Wait = true
+			case "--keep-history":
+				u.KeepHistory = true
+			case "--no-hooks":
+				u.NoHooks = true
+			case "--timeout":
+				if i+1 < len(args) {
+					u.Timeout, _ = time.ParseDuration(args[i+1])
+					i++
+				}
+			case "--cascade":
+				if i+1 < len(args) {
+					u.Cascade = args[i+1]
+					i++
+				}
+			}
+		}
+	}
+
+	return u
+}
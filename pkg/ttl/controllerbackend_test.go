@@ -0,0 +1,207 @@
+package ttl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"helm.sh/helm/v3/pkg/action"
+)
+
+func TestControllerConfigMap(t *testing.T) {
+	opts := CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "staging",
+		CronjobNamespace: "ops",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		ExpiresAt:        time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		Uninstall:        UninstallOptions{Wait: true, Timeout: 10 * time.Minute, Cascade: "foreground"},
+	}
+	cj, err := BuildCronJob(opts)
+	require.NoError(t, err)
+
+	cm, err := controllerConfigMap(cj)
+	require.NoError(t, err)
+	assert.Equal(t, "myapp-80081014-ttl", cm.Name)
+	assert.Equal(t, BackendController, cm.Labels[LabelBackend])
+	assert.Empty(t, cj.Labels[LabelBackend])
+
+	got, err := controllerCronJobOf(cm)
+	require.NoError(t, err)
+	assert.Equal(t, cj.Labels, got.Labels)
+	assert.Equal(t, cj.Annotations, got.Annotations)
+	assert.Equal(t, cj.Spec, got.Spec)
+	assert.Equal(t, UninstallOptions{Wait: true, Timeout: 10 * time.Minute, Cascade: "foreground"}, cronJobUninstallOptions(got))
+
+	t.Run("abort window unsupported", func(t *testing.T) {
+		opts := opts
+		opts.AbortWindow = time.Minute
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		_, err = controllerConfigMap(cj)
+		assert.ErrorContains(t, err, "need the cronjob or job-sleep backend")
+	})
+
+	t.Run("expiry required", func(t *testing.T) {
+		opts := opts
+		opts.ExpiresAt = time.Time{}
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		_, err = controllerConfigMap(cj)
+		assert.EqualError(t, err, "the controller backend needs the expiry of TTL myapp-80081014-ttl in its helm-ttl/expires-at annotation")
+	})
+}
+
+func TestControllerBackend(t *testing.T) {
+	ctx := context.Background()
+	setOpts := SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "2d",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	}
+	setup := func(t *testing.T) (*action.Configuration, *fake.Clientset, kubernetes.Interface) {
+		t.Helper()
+
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		wrapped, err := WithBackend(client, BackendController)
+		require.NoError(t, err)
+
+		_, err = SetTTL(ctx, cfg, wrapped, setOpts)
+		require.NoError(t, err)
+
+		return cfg, client, wrapped
+	}
+
+	t.Run("set creates a config map", func(t *testing.T) {
+		_, client, _ := setup(t)
+
+		cronJobs, err := client.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, cronJobs.Items)
+
+		cm, err := client.CoreV1().ConfigMaps("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, BackendController, cm.Labels[LabelBackend])
+
+		// No Job runs, so no ServiceAccount or RBAC is created
+		sas, err := client.CoreV1().ServiceAccounts("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, sas.Items)
+		roles, err := client.RbacV1().Roles("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, roles.Items)
+	})
+
+	t.Run("get and list", func(t *testing.T) {
+		_, client, wrapped := setup(t)
+		// Other ConfigMaps are not TTLs
+		_, err := client.CoreV1().ConfigMaps("default").Create(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		info, err := GetTTL(ctx, wrapped, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "myapp", info.ReleaseName)
+
+		infos, err := ListTTLs(ctx, wrapped, "default", "")
+		require.NoError(t, err)
+		assert.Len(t, infos, 1)
+
+		_, err = wrapped.BatchV1().CronJobs("default").Get(ctx, "settings", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("extend and unset", func(t *testing.T) {
+		_, client, wrapped := setup(t)
+		before, err := client.CoreV1().ConfigMaps("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+
+		_, err = ExtendTTL(ctx, wrapped, ExtendTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", By: 24 * time.Hour})
+		require.NoError(t, err)
+
+		after, err := client.CoreV1().ConfigMaps("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotEqual(t, before.Annotations[AnnotationExpiresAt], after.Annotations[AnnotationExpiresAt])
+
+		require.NoError(t, UnsetTTL(ctx, wrapped, "myapp", "default", "default"))
+		_, err = client.CoreV1().ConfigMaps("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("expire uninstalls the release", func(t *testing.T) {
+		cfg, client, wrapped := setup(t)
+		cj, err := wrapped.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+
+		var drivers []string
+		err = ExpireTTL(ctx, wrapped, cj, func(namespace, driver string) (*action.Configuration, error) {
+			assert.Equal(t, "default", namespace)
+			drivers = append(drivers, driver)
+			return cfg, nil
+		})
+		require.NoError(t, err)
+		assert.Len(t, drivers, 1)
+
+		_, err = cfg.Releases.Deployed("myapp")
+		assert.Error(t, err)
+
+		_, err = client.CoreV1().ConfigMaps("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+
+		history, err := GetHistory(ctx, wrapped, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, OperationExpire, history[len(history)-1].Operation)
+		assert.NotEmpty(t, history[len(history)-1].OldExpiry)
+
+		events, err := client.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.NotEmpty(t, events.Items)
+		event := events.Items[len(events.Items)-1]
+		assert.Equal(t, EventReasonTTLExpiredUninstall, event.Reason)
+		assert.Equal(t, "ConfigMap", event.InvolvedObject.Kind)
+	})
+
+	t.Run("failed expire keeps the TTL", func(t *testing.T) {
+		_, client, wrapped := setup(t)
+		cj, err := wrapped.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+
+		err = ExpireTTL(ctx, wrapped, cj, func(string, string) (*action.Configuration, error) {
+			return nil, errors.New("cluster unreachable")
+		})
+		assert.ErrorContains(t, err, "cluster unreachable")
+
+		_, err = client.CoreV1().ConfigMaps("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("run rejected", func(t *testing.T) {
+		_, _, wrapped := setup(t)
+
+		_, err := RunTTL(ctx, wrapped, nil, nil, RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+		assert.ErrorContains(t, err, "the controller backend runs no uninstall Job")
+	})
+
+	t.Run("namespace TTL rejected", func(t *testing.T) {
+		wrapped, err := WithBackend(fake.NewClientset(), BackendController)
+		require.NoError(t, err)
+
+		_, err = SetNamespaceTTL(ctx, wrapped, SetNamespaceTTLOptions{Namespace: "preview", CronjobNamespace: "ops", Duration: "2d"})
+		assert.EqualError(t, err, "the controller backend does not support namespace TTLs")
+	})
+}
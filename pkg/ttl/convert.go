@@ -0,0 +1,98 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ConvertTTLOptions selects the TTLs ConvertTTLs converts.
+type ConvertTTLOptions struct {
+	// ReleaseName is the release whose TTL is converted. Empty converts
+	// every release TTL in CronjobNamespace.
+	ReleaseName      string
+	ReleaseNamespace string
+	CronjobNamespace string
+	// To is the backend to convert to.
+	To string
+}
+
+// ConvertTTLs returns the TTLs client reads as the objects the backend
+// opts.To keeps them as, e.g. the ReleaseTTLs of CronJob TTLs or the
+// CronJobs of ReleaseTTLs, ready to apply. Nothing in the cluster
+// changes. A CronJob converted from a TTL the controller expires runs as
+// the default ServiceAccount.
+func ConvertTTLs(ctx context.Context, client kubernetes.Interface, opts ConvertTTLOptions) ([]runtime.Object, error) {
+	to, err := LookupBackend(opts.To)
+	if err != nil {
+		return nil, err
+	}
+
+	var cronJobs []batchv1.CronJob
+	if opts.ReleaseName != "" {
+		cj, err := findCronJob(ctx, client, opts.ReleaseName, opts.ReleaseNamespace, opts.CronjobNamespace)
+		if errors.IsNotFound(err) {
+			return nil, &TTLNotFoundError{Name: opts.ReleaseName}
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get CronJob: %w", err)
+		}
+		cronJobs = append(cronJobs, *cj)
+	} else {
+		list, err := client.BatchV1().CronJobs(opts.CronjobNamespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.Set{LabelManagedBy: LabelManagedByValue}.String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list TTLs: %w", err)
+		}
+		for _, cj := range list.Items {
+			if !IsNamespaceTTL(&cj) {
+				cronJobs = append(cronJobs, cj)
+			}
+		}
+	}
+
+	now := time.Now()
+	objs := make([]runtime.Object, 0, len(cronJobs))
+	for _, cj := range cronJobs {
+		obj, err := to.Object(portableCronJob(&cj), now)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+
+	if err := setKinds(objs); err != nil {
+		return nil, err
+	}
+
+	return objs, nil
+}
+
+// portableCronJob returns a copy of cj without the fields the cluster
+// sets, so it can be applied to another cluster or kept in Git.
+func portableCronJob(cj *batchv1.CronJob) *batchv1.CronJob {
+	out := cj.DeepCopy()
+	out.TypeMeta = metav1.TypeMeta{}
+	out.ObjectMeta = portableObjectMeta(out.ObjectMeta)
+	out.Status = batchv1.CronJobStatus{}
+
+	return out
+}
+
+// portableObjectMeta returns the name, namespace, labels and annotations
+// of meta, leaving out what the cluster sets.
+func portableObjectMeta(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:        meta.Name,
+		Namespace:   meta.Namespace,
+		Labels:      meta.Labels,
+		Annotations: meta.Annotations,
+	}
+}
@@ -0,0 +1,67 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/josegonzalez/helm-ttl/pkg/api/v1alpha1"
+)
+
+func TestConvertTTLs(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset()
+	_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "2d",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	})
+	require.NoError(t, err)
+
+	t.Run("cronjob to releasettl", func(t *testing.T) {
+		objs, err := ConvertTTLs(ctx, client, ConvertTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", To: BackendReleaseTTL})
+		require.NoError(t, err)
+		require.Len(t, objs, 1)
+
+		rt, ok := objs[0].(*v1alpha1.ReleaseTTL)
+		require.True(t, ok)
+		assert.Equal(t, "myapp-4a0c226a-ttl", rt.Name)
+		assert.Equal(t, "myapp", rt.Spec.Release)
+		assert.Empty(t, rt.ResourceVersion)
+		assert.Equal(t, v1alpha1.SchemeGroupVersion.WithKind(v1alpha1.Kind), rt.GroupVersionKind())
+	})
+
+	t.Run("releasettl to cronjob", func(t *testing.T) {
+		wrapped := WithReleaseTTLs(fake.NewClientset(), newReleaseTTLClient())
+		_, err := SetTTL(ctx, cfg, wrapped, SetTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", Duration: "2d"})
+		require.NoError(t, err)
+
+		objs, err := ConvertTTLs(ctx, wrapped, ConvertTTLOptions{CronjobNamespace: "default", To: BackendCronJob})
+		require.NoError(t, err)
+		require.Len(t, objs, 1)
+
+		cj, ok := objs[0].(*batchv1.CronJob)
+		require.True(t, ok)
+		assert.Equal(t, "myapp-4a0c226a-ttl", cj.Name)
+		assert.Equal(t, "CronJob", cj.Kind)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := ConvertTTLs(ctx, client, ConvertTTLOptions{ReleaseName: "other", ReleaseNamespace: "default", CronjobNamespace: "default", To: BackendReleaseTTL})
+		var notFound *TTLNotFoundError
+		assert.ErrorAs(t, err, &notFound)
+	})
+
+	t.Run("unknown backend", func(t *testing.T) {
+		_, err := ConvertTTLs(ctx, client, ConvertTTLOptions{CronjobNamespace: "default", To: "deployment"})
+		assert.ErrorContains(t, err, `unknown backend "deployment"`)
+	})
+}
@@ -1,9 +1,14 @@
 package ttl
 
 import (
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
 	"fmt"
+	"maps"
+	"regexp"
 	"strings"
+	"time"
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -25,6 +30,9 @@ const (
 	LabelRelease = "helm-ttl/release"
 	// LabelReleaseNamespace is the label for the release namespace.
 	LabelReleaseNamespace = "helm-ttl/release-namespace"
+	// LabelNamespace marks the resources of a namespace TTL with the
+	// namespace it deletes.
+	LabelNamespace = "helm-ttl/namespace"
 	// LabelCronjobNamespace is the label for the CronJob namespace.
 	LabelCronjobNamespace = "helm-ttl/cronjob-namespace"
 	// LabelDeleteNamespace indicates whether the namespace should be deleted.
@@ -32,11 +40,56 @@ const (
 	// LabelTriggeredBy indicates how the Job was triggered.
 	LabelTriggeredBy = "helm-ttl/triggered-by"
 
+	// FieldManager is the field manager helm-ttl writes its CronJobs,
+	// ServiceAccounts and RBAC with. They are server-side applied, so
+	// fields other controllers set on them are kept.
+	FieldManager = "helm-ttl"
+
+	// AnnotationGeneration counts the updates made to a TTL, for optimistic concurrency.
+	AnnotationGeneration = "helm-ttl/generation"
+	// AnnotationNamespaceDeleteDelay records how long the Job waits after
+	// the uninstall before deleting the release namespace.
+	AnnotationNamespaceDeleteDelay = "helm-ttl/namespace-delete-delay"
+	// AnnotationExpiresAt records the RFC3339 time the TTL expires at,
+	// since the cron schedule has no year.
+	AnnotationExpiresAt = "helm-ttl/expires-at"
+	// AnnotationOriginalDuration records the duration the TTL was set
+	// for, such as 168h, which extending it leaves unchanged.
+	AnnotationOriginalDuration = "helm-ttl/original-duration"
+	// AnnotationRequestedAt records the RFC3339 time a TTL was set to
+	// expire at when its expiry was rounded up to the minute.
+	AnnotationRequestedAt = "helm-ttl/requested-at"
+	// AnnotationCronJob records on a release's storage records the
+	// namespace/name of the CronJob implementing its TTL.
+	AnnotationCronJob = "helm-ttl/cronjob"
+	// AnnotationIstioInject and AnnotationLinkerdInject control whether
+	// Istio and Linkerd inject their proxy into a pod.
+	AnnotationIstioInject   = "sidecar.istio.io/inject"
+	AnnotationLinkerdInject = "linkerd.io/inject"
+
+	// expiryGuardContainer is the name of the init container that stops a
+	// CronJob firing in the wrong year from uninstalling anything.
+	expiryGuardContainer = "expiry-guard"
+	// selfCleanupContainer is the name of the main container, which
+	// deletes the TTL once the uninstall is done.
+	selfCleanupContainer = "self-cleanup"
+	// expiryGuardSlack is how long before the expiry the guard still lets
+	// the uninstall run. Clock and time zone skew stay well within it,
+	// while a CronJob firing in the wrong year is months early.
+	expiryGuardSlack = 24 * time.Hour
+
+	// cleanupBinary is the path of the helm-ttl-cleanup binary in its image.
+	cleanupBinary = "/helm-ttl-cleanup"
+
 	// maxResourceNameLen is the max length for CronJob names.
 	// CronJob creates Jobs with a suffix, and Jobs create Pods with a suffix.
 	// CronJob name + "-" + 10-char timestamp = Job name (max 63 chars)
 	// We limit CronJob names to 52 chars to be safe.
 	maxResourceNameLen = 52
+
+	// resourceNameHashLen is the length of the hash ResourceName puts
+	// between the release name and the -ttl suffix.
+	resourceNameHashLen = 8
 )
 
 // DefaultHelmImage is the default Helm container image, parsed from the embedded Dockerfile.
@@ -58,14 +111,118 @@ func parseImageFromDockerfile(dockerfile string) string {
 }
 
 // ResourceName returns the standard resource name for a release TTL.
-// Format: <release>-<releaseNamespace>-ttl
-func ResourceName(releaseName, releaseNamespace string) (string, error) {
-	name := fmt.Sprintf("%s-%s-ttl", releaseName, releaseNamespace)
-	if len(name) > maxResourceNameLen {
-		return "", fmt.Errorf("resource name %q exceeds maximum length of %d characters (got %d); use shorter release or namespace names", name, maxResourceNameLen, len(name))
+// Format: <release>-<hash>-ttl, where hash is taken from the SHA-256 of
+// <releaseNamespace>/<release> and the release is truncated to keep the
+// name within maxResourceNameLen. The hash covers both full names, so
+// long or similar names never share resources. TTLs set before names were
+// hashed are named <release>-<releaseNamespace>-ttl; findCronJob still
+// finds them by their labels.
+func ResourceName(releaseName, releaseNamespace string) string {
+	sum := sha256.Sum256([]byte(releaseNamespace + "/" + releaseName))
+	hash := hex.EncodeToString(sum[:])[:resourceNameHashLen]
+
+	prefix := releaseName
+	if maxLen := maxResourceNameLen - resourceNameHashLen - len("--ttl"); len(prefix) > maxLen {
+		prefix = strings.TrimRight(prefix[:maxLen], "-.")
+	}
+
+	return fmt.Sprintf("%s-%s-ttl", prefix, hash)
+}
+
+// UninstallOptions contains the flags passed to `helm uninstall` when the
+// TTL fires.
+type UninstallOptions struct {
+	Wait        bool
+	Timeout     time.Duration
+	KeepHistory bool
+	Cascade     string
+	NoHooks     bool
+	// IgnoreNotFound lets a retried Job succeed when an earlier attempt
+	// already uninstalled the release: Command then skips the uninstall
+	// when helm list no longer shows it. Unlike helm uninstall
+	// --ignore-not-found, this works with any helm 3.
+	IgnoreNotFound bool
+}
+
+// validCascades are the deletion cascading policies accepted by helm uninstall.
+var validCascades = map[string]bool{
+	"background": true,
+	"orphan":     true,
+	"foreground": true,
+}
+
+// Validate checks the uninstall options for values helm would reject.
+func (u UninstallOptions) Validate() error {
+	if u.Cascade != "" && !validCascades[u.Cascade] {
+		return fmt.Errorf("invalid cascade %q; valid values: background, orphan, foreground", u.Cascade)
 	}
 
-	return name, nil
+	if u.Timeout < 0 {
+		return fmt.Errorf("uninstall timeout must not be negative, got %s", u.Timeout)
+	}
+
+	return nil
+}
+
+// Args returns the helm uninstall command line for a release.
+func (u UninstallOptions) Args(releaseName, releaseNamespace string) []string {
+	args := []string{"helm", "uninstall", releaseName, "--namespace", releaseNamespace}
+	if u.Wait {
+		args = append(args, "--wait")
+	}
+	if u.Timeout > 0 {
+		args = append(args, "--timeout", u.Timeout.String())
+	}
+	if u.KeepHistory {
+		args = append(args, "--keep-history")
+	}
+	if u.Cascade != "" {
+		args = append(args, "--cascade", u.Cascade)
+	}
+	if u.NoHooks {
+		args = append(args, "--no-hooks")
+	}
+
+	return args
+}
+
+// Command returns the command the uninstall Job runs for a release: Args,
+// wrapped with IgnoreNotFound in a script that first checks the release
+// still exists. helm list exits non-zero on API errors, so only a release
+// that is really gone is skipped.
+func (u UninstallOptions) Command(releaseName, releaseNamespace string) []string {
+	args := u.Args(releaseName, releaseNamespace)
+	if !u.IgnoreNotFound {
+		return args
+	}
+
+	script := releaseGoneCheck(releaseName, releaseNamespace, "uninstall") + "exec " + strings.Join(args, " ")
+
+	return []string{"sh", "-c", script}
+}
+
+// releaseGoneCheck returns the start of a script that exits successfully,
+// with nothing to do, when helm list no longer shows the release.
+func releaseGoneCheck(releaseName, releaseNamespace, nothingTo string) string {
+	return fmt.Sprintf(`found=$(helm list --namespace %s --filter '^%s$' --deployed --failed --pending --superseded --uninstalling --short --max 0) || exit 1
+if [ -z "$found" ]; then
+  echo "release %s not found in namespace %s; nothing to %s"
+  exit 0
+fi
+`,
+		releaseNamespace, regexp.QuoteMeta(releaseName), releaseName, releaseNamespace, nothingTo)
+}
+
+// uninstallArgs returns the helm uninstall command line of a command built
+// by UninstallOptions.Command.
+func uninstallArgs(cmd []string) []string {
+	if len(cmd) == 3 && cmd[0] == "sh" && strings.HasPrefix(cmd[2], "found=$(helm list ") {
+		if _, args, ok := strings.Cut(cmd[2], "\nexec "); ok {
+			return strings.Fields(args)
+		}
+	}
+
+	return cmd
 }
 
 // CronJobOptions contains the parameters for building a CronJob.
@@ -78,6 +235,78 @@ type CronJobOptions struct {
 	HelmImage        string
 	KubectlImage     string
 	DeleteNamespace  bool
+	Uninstall        UninstallOptions
+	Pod              PodOptions
+	ImagePullSecrets []string
+	RegistryPrefix   string
+	Security         SecurityOptions
+	// CleanupImage, when set, runs namespace deletion and self-cleanup with
+	// the API-only helm-ttl-cleanup binary from this image instead of
+	// kubectl.
+	CleanupImage string
+	// NamespaceDeleteDelay is how long to wait after the uninstall before
+	// deleting the namespace, so finalizers and controllers such as
+	// external-dns can observe the teardown. Requires DeleteNamespace.
+	NamespaceDeleteDelay time.Duration
+	// Driver is the Helm storage driver the release is stored with:
+	// secrets (the default), configmaps or sql.
+	Driver string
+	// PostDelete removes leftovers of the release after the uninstall.
+	PostDelete PostDeleteOptions
+	// Job controls retries and deadlines of the uninstall Job.
+	Job JobOptions
+	// OnFailureWebhook, when set, is an http or https URL each failing
+	// step of the uninstall Job posts a notify.FailureReport to.
+	OnFailureWebhook string
+	// OnFailureWebhookProxy, when set, is the URL of the proxy the
+	// failure reports go through; the steps themselves do not use it.
+	OnFailureWebhookProxy string
+	// OnFailureWebhookCA holds PEM certificates the failure reports
+	// trust besides the system roots, e.g. for a webhook behind a private
+	// CA.
+	OnFailureWebhookCA []byte
+	// TwoPhaseGrace, when positive, makes the Job run helm uninstall
+	// --dry-run first, publish the release manifest to a ConfigMap and an
+	// UninstallPending Event in the CronJob namespace, and wait this long
+	// before the real uninstall.
+	TwoPhaseGrace time.Duration
+	// AbortWindow, when positive, makes the Job wait this long before the
+	// uninstall, failing without uninstalling or retrying as soon as the
+	// CronJob is annotated helm-ttl/abort=true.
+	AbortWindow time.Duration
+	// ExpiresAt is the time Schedule was derived from. When set, it is
+	// recorded in the helm-ttl/expires-at annotation and an expiry-guard
+	// init container fails the Job if the schedule fires more than a day
+	// early, e.g. a year before the intended expiry.
+	ExpiresAt time.Time
+	// RequestedAt, when set and not ExpiresAt, is the time the TTL was set
+	// to expire at before ExpiresAt was rounded up to the minute, recorded
+	// in the helm-ttl/requested-at annotation.
+	RequestedAt time.Time
+	// Duration, when positive, is the duration the TTL was set for,
+	// recorded in the helm-ttl/original-duration annotation.
+	Duration time.Duration
+	// Name is the CronJob name; it defaults to ResourceName. It is set to
+	// keep the name of a TTL set before names were hashed.
+	Name string
+	// Labels and Annotations are added to the CronJob, its Job template
+	// and pod template. The labels and annotations of helm-ttl win over
+	// them.
+	Labels      map[string]string
+	Annotations map[string]string
+	// SidecarInjection lets Istio and Linkerd inject their proxy into the
+	// uninstall pod. By default it is annotated against injection, since
+	// a proxy that keeps running keeps the Job from ever completing.
+	SidecarInjection bool
+}
+
+// noSidecarAnnotations returns the pod annotations that keep Istio and
+// Linkerd from injecting their proxy.
+func noSidecarAnnotations() map[string]string {
+	return map[string]string{
+		AnnotationIstioInject:   "false",
+		AnnotationLinkerdInject: "disabled",
+	}
 }
 
 // BuildCronJob constructs a Kubernetes CronJob that will uninstall a Helm release
@@ -87,88 +316,228 @@ func BuildCronJob(opts CronJobOptions) (*batchv1.CronJob, error) {
 		return nil, fmt.Errorf("cannot use --delete-namespace when CronJob namespace (%s) equals release namespace (%s); the CronJob would delete its own namespace", opts.CronjobNamespace, opts.ReleaseNamespace)
 	}
 
-	name, err := ResourceName(opts.ReleaseName, opts.ReleaseNamespace)
-	if err != nil {
+	if err := validateNamespaceDeleteDelay(opts.NamespaceDeleteDelay, opts.DeleteNamespace); err != nil {
+		return nil, err
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = ResourceName(opts.ReleaseName, opts.ReleaseNamespace)
+	}
+
+	if err := opts.Uninstall.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := opts.PostDelete.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := validateTwoPhaseGrace(opts.TwoPhaseGrace); err != nil {
+		return nil, err
+	}
+
+	if err := validateAbortWindow(opts.AbortWindow); err != nil {
 		return nil, err
 	}
 
-	if opts.HelmImage == "" {
-		opts.HelmImage = DefaultHelmImage
+	waits := opts.NamespaceDeleteDelay + opts.TwoPhaseGrace + opts.AbortWindow
+	if err := opts.Job.Validate(opts.Uninstall.Timeout, waits); err != nil {
+		return nil, err
 	}
 
-	if opts.KubectlImage == "" {
-		opts.KubectlImage = DefaultKubectlImage
+	if err := validateFailureWebhook(opts.OnFailureWebhook); err != nil {
+		return nil, err
 	}
 
+	if err := validateFailureTransport(opts); err != nil {
+		return nil, err
+	}
+
+	// A retried Job runs every step again, so each must tolerate the
+	// work of an earlier attempt being done
+	backoffLimit := opts.Job.backoffLimit()
+	opts.Uninstall.IgnoreNotFound = opts.Uninstall.IgnoreNotFound || backoffLimit > 0
+
+	storage, err := StorageResource(opts.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	images := GetEffectiveImages(ImageOptions{
+		HelmImage:      opts.HelmImage,
+		KubectlImage:   opts.KubectlImage,
+		RegistryPrefix: opts.RegistryPrefix,
+		CleanupImage:   opts.CleanupImage,
+	})
+
 	deleteNsStr := "false"
 	if opts.DeleteNamespace {
 		deleteNsStr = "true"
 	}
 
-	labels := map[string]string{
-		LabelManagedBy:        LabelManagedByValue,
-		LabelRelease:          opts.ReleaseName,
-		LabelReleaseNamespace: opts.ReleaseNamespace,
-		LabelCronjobNamespace: opts.CronjobNamespace,
-		LabelDeleteNamespace:  deleteNsStr,
+	labels := releaseLabels(opts.ReleaseName, opts.ReleaseNamespace)
+	labels[LabelCronjobNamespace] = LabelValue(opts.CronjobNamespace)
+	labels[LabelDeleteNamespace] = deleteNsStr
+
+	annotations := releaseAnnotations(opts.ReleaseName, opts.ReleaseNamespace)
+	annotations[LabelCronjobNamespace] = opts.CronjobNamespace
+	if opts.NamespaceDeleteDelay > 0 {
+		annotations[AnnotationNamespaceDeleteDelay] = opts.NamespaceDeleteDelay.String()
 	}
 
 	// Init container 1: helm uninstall
 	helmUninstall := corev1.Container{
 		Name:    "helm-uninstall",
-		Image:   opts.HelmImage,
-		Command: []string{"helm", "uninstall", opts.ReleaseName, "--namespace", opts.ReleaseNamespace},
+		Image:   images.Helm,
+		Command: opts.Uninstall.Command(opts.ReleaseName, opts.ReleaseNamespace),
+	}
+	if storage != "secrets" {
+		helmUninstall.Env = []corev1.EnvVar{{Name: "HELM_DRIVER", Value: opts.Driver}}
+	}
+
+	cleanupImage := images.Kubectl
+	if images.Cleanup != "" {
+		cleanupImage = images.Cleanup
 	}
 
-	initContainers := []corev1.Container{helmUninstall}
+	// Two-phase init containers (conditional): publish what the uninstall
+	// will delete, then wait before running it
+	var initContainers []corev1.Container
+	if opts.TwoPhaseGrace > 0 {
+		annotations[AnnotationTwoPhaseGrace] = opts.TwoPhaseGrace.String()
+		initContainers = twoPhaseContainers(opts, name, images.Helm, images.Kubectl, images.Cleanup)
+	}
+
+	// Abort window init container (conditional): last chance to cancel
+	if opts.AbortWindow > 0 {
+		annotations[AnnotationAbortWindow] = opts.AbortWindow.String()
+		initContainers = append(initContainers, corev1.Container{
+			Name:    abortWindowContainer,
+			Image:   cleanupImage,
+			Command: abortWindowCmd(name, opts.CronjobNamespace, opts.ReleaseName, opts.AbortWindow, images.Cleanup != ""),
+		})
+	}
+	initContainers = append(initContainers, helmUninstall)
+
+	if opts.Duration > 0 {
+		annotations[AnnotationOriginalDuration] = FormatDuration(opts.Duration)
+	}
+
+	if !opts.RequestedAt.IsZero() && !opts.RequestedAt.Equal(opts.ExpiresAt) {
+		annotations[AnnotationRequestedAt] = FormatScheduledDate(opts.RequestedAt.UTC())
+	}
+
+	// Guard init container: refuse to uninstall when the year-less
+	// schedule fires long before the expiry
+	if !opts.ExpiresAt.IsZero() {
+		annotations[AnnotationExpiresAt] = FormatScheduledDate(opts.ExpiresAt.UTC())
+		guard := corev1.Container{
+			Name:    expiryGuardContainer,
+			Image:   cleanupImage,
+			Command: expiryGuardCmd(opts.ExpiresAt, images.Cleanup != ""),
+		}
+		initContainers = append([]corev1.Container{guard}, initContainers...)
+	}
+
+	deleteNsCmd := []string{"kubectl", "delete", "namespace", opts.ReleaseNamespace, "--ignore-not-found"}
+	if opts.NamespaceDeleteDelay > 0 {
+		deleteNsCmd = delayedDeleteNamespaceCmd(opts.ReleaseNamespace, opts.NamespaceDeleteDelay)
+	}
+	selfCleanupCmd := []string{"kubectl", "delete", "cronjob", name, "--namespace", opts.CronjobNamespace, "--ignore-not-found"}
+	if images.Cleanup != "" {
+		deleteNsCmd = []string{cleanupBinary, "delete-namespace", opts.ReleaseNamespace}
+		if opts.NamespaceDeleteDelay > 0 {
+			deleteNsCmd = []string{cleanupBinary, "delete-namespace", "--delay", opts.NamespaceDeleteDelay.String(), opts.ReleaseNamespace}
+		}
+		selfCleanupCmd = []string{cleanupBinary, "delete-cronjob", "--namespace", opts.CronjobNamespace, name}
+	}
+
+	// Init container 2: verify the release's storage records are gone, so
+	// the Job fails if helm exited 0 but left state behind. The sql driver
+	// keeps them outside the cluster, where they cannot be checked.
+	if storage != "" {
+		verify := corev1.Container{
+			Name:    "verify-uninstall",
+			Image:   cleanupImage,
+			Command: verifyUninstallCmd(opts.ReleaseName, opts.ReleaseNamespace, storage, opts.Uninstall.KeepHistory),
+		}
+		if images.Cleanup != "" {
+			verify.Command = []string{cleanupBinary, "verify-uninstalled", "--namespace", opts.ReleaseNamespace}
+			if storage != "secrets" {
+				verify.Command = append(verify.Command, "--storage", storage)
+			}
+			if opts.Uninstall.KeepHistory {
+				verify.Command = append(verify.Command, "--keep-history")
+			}
+			verify.Command = append(verify.Command, opts.ReleaseName)
+		}
+		initContainers = append(initContainers, verify)
+	}
 
-	// Init container 2 (conditional): kubectl delete namespace
+	// Post-delete init containers (conditional): remove leftovers such as PVCs
+	initContainers = append(initContainers, opts.PostDelete.containers(opts.ReleaseName, opts.ReleaseNamespace, images.Kubectl, images.Cleanup)...)
+
+	// Init container 3 (conditional): delete namespace
 	if opts.DeleteNamespace {
 		deleteNs := corev1.Container{
 			Name:    "delete-namespace",
-			Image:   opts.KubectlImage,
-			Command: []string{"kubectl", "delete", "namespace", opts.ReleaseNamespace},
+			Image:   cleanupImage,
+			Command: deleteNsCmd,
 		}
 		initContainers = append(initContainers, deleteNs)
 	}
 
 	// Main container: self-cleanup (delete the CronJob itself)
 	selfCleanup := corev1.Container{
-		Name:    "self-cleanup",
-		Image:   opts.KubectlImage,
-		Command: []string{"kubectl", "delete", "cronjob", name, "--namespace", opts.CronjobNamespace},
+		Name:    selfCleanupContainer,
+		Image:   cleanupImage,
+		Command: selfCleanupCmd,
+	}
+
+	labels = merged(opts.Labels, labels)
+	templateAnnotations := maps.Clone(opts.Annotations)
+	if !opts.SidecarInjection {
+		templateAnnotations = merged(noSidecarAnnotations(), opts.Annotations)
 	}
 
-	var failedLimit int32
+	failedLimit := opts.Job.failedHistoryLimit()
 	var successLimit int32 = 1
-	var backoffLimit int32
+	activeDeadline := opts.Job.activeDeadlineSeconds(opts.Uninstall.Timeout, waits)
+	startingDeadline := opts.Job.startingDeadlineSeconds()
 
 	cronjob := &batchv1.CronJob{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: opts.CronjobNamespace,
-			Labels:    labels,
+			Name:        name,
+			Namespace:   opts.CronjobNamespace,
+			Labels:      labels,
+			Annotations: merged(opts.Annotations, annotations),
 		},
 		Spec: batchv1.CronJobSpec{
 			Schedule:                   opts.Schedule,
 			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			StartingDeadlineSeconds:    &startingDeadline,
 			FailedJobsHistoryLimit:     &failedLimit,
 			SuccessfulJobsHistoryLimit: &successLimit,
 			JobTemplate: batchv1.JobTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
+					Labels:      labels,
+					Annotations: templateAnnotations,
 				},
 				Spec: batchv1.JobSpec{
-					BackoffLimit: &backoffLimit,
+					BackoffLimit:          &backoffLimit,
+					ActiveDeadlineSeconds: &activeDeadline,
 					Template: corev1.PodTemplateSpec{
 						ObjectMeta: metav1.ObjectMeta{
-							Labels: labels,
+							Labels:      labels,
+							Annotations: templateAnnotations,
 						},
 						Spec: corev1.PodSpec{
 							ServiceAccountName: opts.ServiceAccount,
 							RestartPolicy:      corev1.RestartPolicyNever,
 							InitContainers:     initContainers,
 							Containers:         []corev1.Container{selfCleanup},
+							ImagePullSecrets:   imagePullSecrets(opts.ImagePullSecrets),
 						},
 					},
 				},
@@ -176,12 +545,43 @@ func BuildCronJob(opts CronJobOptions) (*batchv1.CronJob, error) {
 		},
 	}
 
+	if opts.AbortWindow > 0 {
+		cronjob.Spec.JobTemplate.Spec.PodFailurePolicy = abortPodFailurePolicy()
+	}
+
+	if opts.TwoPhaseGrace > 0 {
+		podSpec := &cronjob.Spec.JobTemplate.Spec.Template.Spec
+		podSpec.Volumes = append(podSpec.Volumes, auditVolumeSource())
+	}
+
+	if opts.OnFailureWebhook != "" {
+		reportFailures(&cronjob.Spec.JobTemplate.Spec.Template.Spec, opts)
+	}
+
+	applyPodOptions(&cronjob.Spec.JobTemplate.Spec.Template.Spec, opts.Pod)
+	applySecurityContext(&cronjob.Spec.JobTemplate.Spec.Template.Spec, opts.Security)
+
 	return cronjob, nil
 }
 
-// BuildJobFromCronJob creates a Job from a CronJob's job template.
+// BuildJobFromCronJob creates a Job from a CronJob's job template. The
+// expiry guard and abort window are dropped, since running a TTL by hand
+// is meant to be early and is already confirmed. The Job is not retried:
+// run watches a single pod, and reports its failure rather than waiting
+// out the retries of the schedule.
 func BuildJobFromCronJob(cj *batchv1.CronJob, jobName string) *batchv1.Job {
 	jobSpec := *cj.Spec.JobTemplate.Spec.DeepCopy()
+	podSpec := &jobSpec.Template.Spec
+	initContainers := podSpec.InitContainers[:0]
+	for _, c := range podSpec.InitContainers {
+		if c.Name != expiryGuardContainer && c.Name != abortWindowContainer {
+			initContainers = append(initContainers, c)
+		}
+	}
+	podSpec.InitContainers = initContainers
+	jobSpec.PodFailurePolicy = nil
+	var backoffLimit int32
+	jobSpec.BackoffLimit = &backoffLimit
 
 	labels := make(map[string]string)
 	for k, v := range cj.Labels {
@@ -191,10 +591,142 @@ func BuildJobFromCronJob(cj *batchv1.CronJob, jobName string) *batchv1.Job {
 
 	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      jobName,
-			Namespace: cj.Namespace,
-			Labels:    labels,
+			Name:        jobName,
+			Namespace:   cj.Namespace,
+			Labels:      labels,
+			Annotations: maps.Clone(cj.Spec.JobTemplate.Annotations),
 		},
 		Spec: jobSpec,
 	}
 }
+
+// StorageResource returns the resource the Helm storage driver keeps
+// releases in: secrets for "" (the default), secret and secrets, and
+// configmaps for configmap and configmaps. The sql driver keeps them in a
+// database, so its resource is "". Other drivers, such as memory, cannot
+// be reached from the uninstall Job and are rejected.
+func StorageResource(driver string) (string, error) {
+	switch driver {
+	case "", "secret", "secrets":
+		return "secrets", nil
+	case "configmap", "configmaps":
+		return "configmaps", nil
+	case "sql":
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported Helm storage driver %q for a TTL: use secrets, configmaps or sql", driver)
+	}
+}
+
+// ReleaseStorageSelector returns the label selector matching the Secrets
+// or ConfigMaps helm stores a release's history in. With keepHistory, records marked
+// uninstalled are expected to remain and are not matched.
+func ReleaseStorageSelector(releaseName string, keepHistory bool) string {
+	selector := "owner=helm,name=" + releaseName
+	if keepHistory {
+		selector += ",status!=uninstalled"
+	}
+
+	return selector
+}
+
+// verifyUninstallCmd returns a kubectl command that fails when the release
+// still has storage records of the given resource after helm uninstall.
+func verifyUninstallCmd(releaseName, releaseNamespace, storage string, keepHistory bool) []string {
+	script := fmt.Sprintf(`left=$(kubectl get %s --namespace %s --selector '%s' --output name) || exit 1
+if [ -n "$left" ]; then
+  echo "release %s still has storage records after uninstall:"
+  echo "$left"
+  exit 1
+fi
+echo "release %s uninstalled"`,
+		storage, releaseNamespace, ReleaseStorageSelector(releaseName, keepHistory), releaseName, releaseName)
+
+	return []string{"sh", "-c", script}
+}
+
+// expiryGuardCmd returns a command that fails unless it runs no more than
+// expiryGuardSlack before expiresAt.
+func expiryGuardCmd(expiresAt time.Time, cleanupImage bool) []string {
+	notBefore := expiresAt.Add(-expiryGuardSlack)
+	if cleanupImage {
+		return []string{cleanupBinary, "check-expiry", notBefore.UTC().Format(time.RFC3339)}
+	}
+
+	script := fmt.Sprintf(`if [ "$(date +%%s)" -lt %d ]; then echo "refusing to uninstall before %s: the CronJob fired early, e.g. in the wrong year" >&2; exit 1; fi`,
+		notBefore.Unix(), notBefore.UTC().Format(time.RFC3339))
+
+	return []string{"sh", "-c", script}
+}
+
+// setExpiry records a new expiry on a TTL CronJob built with ExpiresAt,
+// updating its annotation and expiry guard.
+func setExpiry(cj *batchv1.CronJob, expiresAt time.Time) {
+	spec := &cj.Spec.JobTemplate.Spec.Template.Spec
+	for i, c := range spec.InitContainers {
+		if c.Name != expiryGuardContainer {
+			continue
+		}
+
+		spec.InitContainers[i].Command = expiryGuardCmd(expiresAt, len(c.Command) > 0 && c.Command[0] == cleanupBinary)
+		if reportsFailures(c) {
+			wrapFailureReport(&spec.InitContainers[i])
+		}
+		if cj.Annotations == nil {
+			cj.Annotations = make(map[string]string)
+		}
+		cj.Annotations[AnnotationExpiresAt] = FormatScheduledDate(expiresAt.UTC())
+	}
+}
+
+// validateNamespaceDeleteDelay rejects negative delays and delays without
+// namespace deletion.
+func validateNamespaceDeleteDelay(delay time.Duration, deleteNamespace bool) error {
+	if delay < 0 {
+		return fmt.Errorf("invalid --namespace-delete-delay %s: must not be negative", delay)
+	}
+
+	if delay > 0 && !deleteNamespace {
+		return fmt.Errorf("--namespace-delete-delay requires --delete-namespace")
+	}
+
+	return nil
+}
+
+// delayedDeleteNamespaceCmd returns a kubectl command that waits delay
+// before deleting the namespace, checking every namespaceDeletePollInterval
+// and finishing early if someone else already deleted it.
+func delayedDeleteNamespaceCmd(namespace string, delay time.Duration) []string {
+	script := fmt.Sprintf(`end=$(($(date +%%s) + %d))
+echo "waiting %s before deleting namespace %s"
+while [ "$(date +%%s)" -lt "$end" ]; do
+  ns=$(kubectl get namespace %s --ignore-not-found --output name) || exit 1
+  if [ -z "$ns" ]; then
+    echo "namespace %s already deleted"
+    exit 0
+  fi
+  sleep %d
+done
+kubectl delete namespace %s --ignore-not-found`,
+		int64(delay.Seconds()), delay, namespace, namespace, namespace, int64(namespaceDeletePollInterval.Seconds()), namespace)
+
+	return []string{"sh", "-c", script}
+}
+
+// imagePullSecrets converts secret names into pod image pull secret
+// references, skipping blanks and duplicates.
+func imagePullSecrets(names []string) []corev1.LocalObjectReference {
+	var refs []corev1.LocalObjectReference
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		refs = append(refs, corev1.LocalObjectReference{Name: name})
+	}
+
+	return refs
+}
@@ -3,6 +3,7 @@ package ttl
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -52,27 +53,28 @@ func TestEmbeddedDefaults(t *testing.T) {
 
 func TestResourceName(t *testing.T) {
 	t.Run("basic name", func(t *testing.T) {
-		name, err := ResourceName("myapp", "staging")
-		require.NoError(t, err)
-		assert.Equal(t, "myapp-staging-ttl", name)
+		assert.Equal(t, "myapp-80081014-ttl", ResourceName("myapp", "staging"))
 	})
 
-	t.Run("name at limit", func(t *testing.T) {
-		// Create a name that's exactly at the limit
-		release := strings.Repeat("a", 22)
-		ns := strings.Repeat("b", 22)
-		name, err := ResourceName(release, ns)
-		require.NoError(t, err)
-		assert.Len(t, name, 49) // 22 + 1 + 22 + 4 = 49
-		assert.True(t, len(name) <= maxResourceNameLen)
+	t.Run("long names are truncated", func(t *testing.T) {
+		release := strings.Repeat("a", 53)
+		ns := strings.Repeat("b", 63)
+		name := ResourceName(release, ns)
+		assert.Len(t, name, maxResourceNameLen)
+		assert.True(t, strings.HasPrefix(name, strings.Repeat("a", 39)+"-"))
+		assert.True(t, strings.HasSuffix(name, "-ttl"))
 	})
 
-	t.Run("name exceeds limit", func(t *testing.T) {
-		release := strings.Repeat("a", 30)
-		ns := strings.Repeat("b", 30)
-		_, err := ResourceName(release, ns)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "exceeds maximum length")
+	t.Run("truncation does not end on a separator", func(t *testing.T) {
+		name := ResourceName(strings.Repeat("a", 37)+"-.preview", "previews")
+		assert.True(t, strings.HasPrefix(name, strings.Repeat("a", 37)+"-"))
+		assert.NotContains(t, name, "-.")
+		assert.Len(t, name, 50)
+	})
+
+	t.Run("names differ where the old format collided", func(t *testing.T) {
+		assert.NotEqual(t, ResourceName("a-b", "c"), ResourceName("a", "b-c"))
+		assert.NotEqual(t, ResourceName(strings.Repeat("a", 40)+"x", "ns"), ResourceName(strings.Repeat("a", 40)+"y", "ns"))
 	})
 }
 
@@ -91,7 +93,7 @@ func TestBuildCronJob(t *testing.T) {
 		cj, err := BuildCronJob(opts)
 		require.NoError(t, err)
 
-		assert.Equal(t, "myapp-default-ttl", cj.Name)
+		assert.Equal(t, "myapp-4a0c226a-ttl", cj.Name)
 		assert.Equal(t, "default", cj.Namespace)
 		assert.Equal(t, "30 14 15 6 *", cj.Spec.Schedule)
 
@@ -104,14 +106,18 @@ func TestBuildCronJob(t *testing.T) {
 
 		// Check init containers
 		spec := cj.Spec.JobTemplate.Spec.Template.Spec
-		assert.Len(t, spec.InitContainers, 1)
+		assert.Len(t, spec.InitContainers, 2)
 		assert.Equal(t, "helm-uninstall", spec.InitContainers[0].Name)
-		assert.Equal(t, []string{"helm", "uninstall", "myapp", "--namespace", "default"}, spec.InitContainers[0].Command)
+		assert.Equal(t, UninstallOptions{IgnoreNotFound: true}.Command("myapp", "default"), spec.InitContainers[0].Command)
+		assert.Equal(t, "verify-uninstall", spec.InitContainers[1].Name)
+		assert.Equal(t, "alpine/k8s:1.29", spec.InitContainers[1].Image)
+		assert.Equal(t, []string{"sh", "-c"}, spec.InitContainers[1].Command[:2])
+		assert.Contains(t, spec.InitContainers[1].Command[2], "kubectl get secrets --namespace default --selector 'owner=helm,name=myapp' --output name")
 
 		// Check main container
 		assert.Len(t, spec.Containers, 1)
 		assert.Equal(t, "self-cleanup", spec.Containers[0].Name)
-		assert.Equal(t, []string{"kubectl", "delete", "cronjob", "myapp-default-ttl", "--namespace", "default"}, spec.Containers[0].Command)
+		assert.Equal(t, []string{"kubectl", "delete", "cronjob", "myapp-4a0c226a-ttl", "--namespace", "default", "--ignore-not-found"}, spec.Containers[0].Command)
 
 		// Check service account
 		assert.Equal(t, "default", spec.ServiceAccountName)
@@ -130,7 +136,7 @@ func TestBuildCronJob(t *testing.T) {
 		cj, err := BuildCronJob(opts)
 		require.NoError(t, err)
 
-		assert.Equal(t, "myapp-staging-ttl", cj.Name)
+		assert.Equal(t, "myapp-80081014-ttl", cj.Name)
 		assert.Equal(t, "ops", cj.Namespace)
 		assert.Equal(t, "staging", cj.Labels[LabelReleaseNamespace])
 		assert.Equal(t, "ops", cj.Labels[LabelCronjobNamespace])
@@ -152,10 +158,53 @@ func TestBuildCronJob(t *testing.T) {
 		assert.Equal(t, "true", cj.Labels[LabelDeleteNamespace])
 
 		spec := cj.Spec.JobTemplate.Spec.Template.Spec
-		assert.Len(t, spec.InitContainers, 2)
+		assert.Len(t, spec.InitContainers, 3)
 		assert.Equal(t, "helm-uninstall", spec.InitContainers[0].Name)
-		assert.Equal(t, "delete-namespace", spec.InitContainers[1].Name)
-		assert.Equal(t, []string{"kubectl", "delete", "namespace", "staging"}, spec.InitContainers[1].Command)
+		assert.Equal(t, "verify-uninstall", spec.InitContainers[1].Name)
+		assert.Equal(t, "delete-namespace", spec.InitContainers[2].Name)
+		assert.Equal(t, []string{"kubectl", "delete", "namespace", "staging", "--ignore-not-found"}, spec.InitContainers[2].Command)
+	})
+
+	t.Run("with namespace delete delay", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "staging",
+			CronjobNamespace:     "ops",
+			Schedule:             "0 12 1 1 *",
+			ServiceAccount:       "ttl-sa",
+			DeleteNamespace:      true,
+			NamespaceDeleteDelay: 10 * time.Minute,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "10m0s", cj.Annotations[AnnotationNamespaceDeleteDelay])
+
+		cmd := cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[2].Command
+		require.Len(t, cmd, 3)
+		assert.Equal(t, []string{"sh", "-c"}, cmd[:2])
+		assert.Contains(t, cmd[2], "end=$(($(date +%s) + 600))")
+		assert.Contains(t, cmd[2], "kubectl get namespace staging --ignore-not-found --output name")
+		assert.Contains(t, cmd[2], "sleep 10\n")
+		assert.Contains(t, cmd[2], "kubectl delete namespace staging --ignore-not-found")
+	})
+
+	t.Run("namespace delete delay rejected", func(t *testing.T) {
+		opts := CronJobOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "staging",
+			CronjobNamespace:     "ops",
+			Schedule:             "0 12 1 1 *",
+			ServiceAccount:       "ttl-sa",
+			NamespaceDeleteDelay: time.Minute,
+		}
+
+		_, err := BuildCronJob(opts)
+		assert.EqualError(t, err, "--namespace-delete-delay requires --delete-namespace")
+
+		opts.DeleteNamespace = true
+		opts.NamespaceDeleteDelay = -time.Minute
+		_, err = BuildCronJob(opts)
+		assert.EqualError(t, err, "invalid --namespace-delete-delay -1m0s: must not be negative")
 	})
 
 	t.Run("delete-namespace rejected when same namespace", func(t *testing.T) {
@@ -190,7 +239,7 @@ func TestBuildCronJob(t *testing.T) {
 		assert.Equal(t, DefaultKubectlImage, spec.Containers[0].Image)
 	})
 
-	t.Run("name too long", func(t *testing.T) {
+	t.Run("long names", func(t *testing.T) {
 		opts := CronJobOptions{
 			ReleaseName:      strings.Repeat("a", 30),
 			ReleaseNamespace: strings.Repeat("b", 30),
@@ -199,9 +248,24 @@ func TestBuildCronJob(t *testing.T) {
 			ServiceAccount:   "default",
 		}
 
-		_, err := BuildCronJob(opts)
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "exceeds maximum length")
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+		assert.Equal(t, ResourceName(opts.ReleaseName, opts.ReleaseNamespace), cj.Name)
+	})
+
+	t.Run("name override", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Schedule:         "0 12 1 1 *",
+			ServiceAccount:   "default",
+			Name:             "myapp-default-ttl",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-default-ttl", cj.Name)
+		self := cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0]
+		assert.Contains(t, self.Command, "myapp-default-ttl")
 	})
 
 	t.Run("labels propagated to pod template", func(t *testing.T) {
@@ -233,12 +297,222 @@ func TestBuildCronJob(t *testing.T) {
 		cj, err := BuildCronJob(opts)
 		require.NoError(t, err)
 
-		assert.Equal(t, int32(0), *cj.Spec.FailedJobsHistoryLimit)
+		assert.Equal(t, DefaultFailedJobsHistoryLimit, *cj.Spec.FailedJobsHistoryLimit)
 		assert.Equal(t, int32(1), *cj.Spec.SuccessfulJobsHistoryLimit)
-		assert.Equal(t, int32(0), *cj.Spec.JobTemplate.Spec.BackoffLimit)
+		assert.Equal(t, DefaultBackoffLimit, *cj.Spec.JobTemplate.Spec.BackoffLimit)
+		assert.Equal(t, DefaultActiveDeadlineSeconds, *cj.Spec.JobTemplate.Spec.ActiveDeadlineSeconds)
+		assert.Equal(t, DefaultStartingDeadlineSeconds, *cj.Spec.StartingDeadlineSeconds)
+	})
+}
+
+func TestUninstallOptions(t *testing.T) {
+	t.Run("default args", func(t *testing.T) {
+		args := UninstallOptions{}.Args("myapp", "staging")
+		assert.Equal(t, []string{"helm", "uninstall", "myapp", "--namespace", "staging"}, args)
+	})
+
+	t.Run("all flags", func(t *testing.T) {
+		args := UninstallOptions{
+			Wait:        true,
+			Timeout:     10 * time.Minute,
+			KeepHistory: true,
+			Cascade:     "foreground",
+			NoHooks:     true,
+		}.Args("myapp", "staging")
+		assert.Equal(t, []string{
+			"helm", "uninstall", "myapp", "--namespace", "staging",
+			"--wait", "--timeout", "10m0s", "--keep-history", "--cascade", "foreground", "--no-hooks",
+		}, args)
+	})
+
+	t.Run("command", func(t *testing.T) {
+		assert.Equal(t, []string{"helm", "uninstall", "myapp", "--namespace", "staging"}, UninstallOptions{}.Command("myapp", "staging"))
+	})
+
+	t.Run("command ignoring a missing release", func(t *testing.T) {
+		cmd := UninstallOptions{Wait: true, IgnoreNotFound: true}.Command("my.app", "staging")
+		require.Len(t, cmd, 3)
+		assert.Equal(t, []string{"sh", "-c"}, cmd[:2])
+		assert.Equal(t, `found=$(helm list --namespace staging --filter '^my\.app$' --deployed --failed --pending --superseded --uninstalling --short --max 0) || exit 1
+if [ -z "$found" ]; then
+  echo "release my.app not found in namespace staging; nothing to uninstall"
+  exit 0
+fi
+exec helm uninstall my.app --namespace staging --wait`, cmd[2])
+		assert.Equal(t, []string{"helm", "uninstall", "my.app", "--namespace", "staging", "--wait"}, uninstallArgs(cmd))
+	})
+
+	t.Run("valid options", func(t *testing.T) {
+		for _, cascade := range []string{"", "background", "orphan", "foreground"} {
+			assert.NoError(t, UninstallOptions{Cascade: cascade}.Validate())
+		}
+	})
+
+	t.Run("invalid cascade", func(t *testing.T) {
+		err := UninstallOptions{Cascade: "sideways"}.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid cascade")
+	})
+
+	t.Run("negative timeout", func(t *testing.T) {
+		err := UninstallOptions{Timeout: -time.Second}.Validate()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "must not be negative")
 	})
 }
 
+func TestBuildCronJob_UninstallOptions(t *testing.T) {
+	t.Run("flags are passed to helm uninstall", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Schedule:         "0 12 1 1 *",
+			ServiceAccount:   "default",
+			Uninstall:        UninstallOptions{Wait: true, Timeout: 10 * time.Minute},
+		})
+		require.NoError(t, err)
+
+		spec := cj.Spec.JobTemplate.Spec.Template.Spec
+		assert.Equal(t, []string{"helm", "uninstall", "myapp", "--namespace", "default", "--wait", "--timeout", "10m0s"}, uninstallArgs(spec.InitContainers[0].Command))
+	})
+
+	t.Run("invalid options rejected", func(t *testing.T) {
+		_, err := BuildCronJob(CronJobOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Schedule:         "0 12 1 1 *",
+			ServiceAccount:   "default",
+			Uninstall:        UninstallOptions{Cascade: "sideways"},
+		})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid cascade")
+	})
+}
+
+func TestBuildCronJob_ImagePullSecrets(t *testing.T) {
+	cj, err := BuildCronJob(CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		ImagePullSecrets: []string{"registry-a", " ", "registry-b", "registry-a"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "registry-a"}, {Name: "registry-b"}},
+		cj.Spec.JobTemplate.Spec.Template.Spec.ImagePullSecrets)
+}
+
+func TestBuildCronJob_LabelsAndAnnotations(t *testing.T) {
+	cj, err := BuildCronJob(CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		Labels:           map[string]string{"cost-center": "1234", LabelRelease: "other"},
+		Annotations:      map[string]string{"karpenter.sh/do-not-disrupt": "true", LabelRelease: "other"},
+	})
+	require.NoError(t, err)
+
+	for _, labels := range []map[string]string{cj.Labels, cj.Spec.JobTemplate.Labels, cj.Spec.JobTemplate.Spec.Template.Labels} {
+		assert.Equal(t, "1234", labels["cost-center"])
+		assert.Equal(t, "myapp", labels[LabelRelease])
+	}
+
+	assert.Equal(t, "true", cj.Annotations["karpenter.sh/do-not-disrupt"])
+	assert.Equal(t, "myapp", cj.Annotations[LabelRelease])
+	for _, annotations := range []map[string]string{cj.Spec.JobTemplate.Annotations, cj.Spec.JobTemplate.Spec.Template.Annotations} {
+		assert.Equal(t, "true", annotations["karpenter.sh/do-not-disrupt"])
+	}
+
+	job := BuildJobFromCronJob(cj, "myapp-manual")
+	assert.Equal(t, "1234", job.Labels["cost-center"])
+	assert.Equal(t, "true", job.Annotations["karpenter.sh/do-not-disrupt"])
+	assert.Equal(t, "true", job.Spec.Template.Annotations["karpenter.sh/do-not-disrupt"])
+}
+
+func TestBuildCronJob_SidecarInjection(t *testing.T) {
+	opts := CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{AnnotationIstioInject: "false", AnnotationLinkerdInject: "disabled"},
+			cj.Spec.JobTemplate.Spec.Template.Annotations)
+		assert.NotContains(t, cj.Annotations, AnnotationIstioInject)
+	})
+
+	t.Run("annotations override the default", func(t *testing.T) {
+		opts := opts
+		opts.Annotations = map[string]string{AnnotationIstioInject: "true"}
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+		assert.Equal(t, "true", cj.Spec.JobTemplate.Spec.Template.Annotations[AnnotationIstioInject])
+		assert.Equal(t, "disabled", cj.Spec.JobTemplate.Spec.Template.Annotations[AnnotationLinkerdInject])
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		opts := opts
+		opts.SidecarInjection = true
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+		assert.Nil(t, cj.Spec.JobTemplate.Spec.Template.Annotations)
+	})
+}
+
+func TestBuildCronJob_CleanupImage(t *testing.T) {
+	cj, err := BuildCronJob(CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "staging",
+		CronjobNamespace: "ops",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		DeleteNamespace:  true,
+		CleanupImage:     "registry.example.com/helm-ttl-cleanup:v1",
+	})
+	require.NoError(t, err)
+
+	spec := cj.Spec.JobTemplate.Spec.Template.Spec
+	require.Len(t, spec.InitContainers, 3)
+	assert.Equal(t, DefaultHelmImage, spec.InitContainers[0].Image)
+
+	assert.Equal(t, "registry.example.com/helm-ttl-cleanup:v1", spec.InitContainers[1].Image)
+	assert.Equal(t, []string{"/helm-ttl-cleanup", "verify-uninstalled", "--namespace", "staging", "myapp"}, spec.InitContainers[1].Command)
+
+	assert.Equal(t, "registry.example.com/helm-ttl-cleanup:v1", spec.InitContainers[2].Image)
+	assert.Equal(t, []string{"/helm-ttl-cleanup", "delete-namespace", "staging"}, spec.InitContainers[2].Command)
+
+	assert.Equal(t, "registry.example.com/helm-ttl-cleanup:v1", spec.Containers[0].Image)
+	assert.Equal(t, []string{"/helm-ttl-cleanup", "delete-cronjob", "--namespace", "ops", "myapp-80081014-ttl"}, spec.Containers[0].Command)
+}
+
+func TestBuildCronJob_CleanupImageNamespaceDeleteDelay(t *testing.T) {
+	cj, err := BuildCronJob(CronJobOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "staging",
+		CronjobNamespace:     "ops",
+		Schedule:             "0 12 1 1 *",
+		ServiceAccount:       "default",
+		DeleteNamespace:      true,
+		NamespaceDeleteDelay: 90 * time.Second,
+		CleanupImage:         "registry.example.com/helm-ttl-cleanup:v1",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/helm-ttl-cleanup", "delete-namespace", "--delay", "1m30s", "staging"},
+		cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[2].Command)
+}
+
 func TestBuildJobFromCronJob(t *testing.T) {
 	makeCronJob := func() *batchv1.CronJob {
 		cj, err := BuildCronJob(CronJobOptions{
@@ -256,17 +530,17 @@ func TestBuildJobFromCronJob(t *testing.T) {
 
 	t.Run("self-cleanup container command preserved", func(t *testing.T) {
 		cj := makeCronJob()
-		job := BuildJobFromCronJob(cj, "myapp-staging-ttl-run")
+		job := BuildJobFromCronJob(cj, "myapp-80081014-ttl-run")
 
 		containers := job.Spec.Template.Spec.Containers
 		require.Len(t, containers, 1)
 		assert.Equal(t, "self-cleanup", containers[0].Name)
-		assert.Equal(t, []string{"kubectl", "delete", "cronjob", "myapp-staging-ttl", "--namespace", "ops"}, containers[0].Command)
+		assert.Equal(t, []string{"kubectl", "delete", "cronjob", "myapp-80081014-ttl", "--namespace", "ops", "--ignore-not-found"}, containers[0].Command)
 	})
 
 	t.Run("labels copied plus triggered-by", func(t *testing.T) {
 		cj := makeCronJob()
-		job := BuildJobFromCronJob(cj, "myapp-staging-ttl-run")
+		job := BuildJobFromCronJob(cj, "myapp-80081014-ttl-run")
 
 		assert.Equal(t, LabelManagedByValue, job.Labels[LabelManagedBy])
 		assert.Equal(t, "myapp", job.Labels[LabelRelease])
@@ -277,19 +551,30 @@ func TestBuildJobFromCronJob(t *testing.T) {
 
 	t.Run("init containers preserved", func(t *testing.T) {
 		cj := makeCronJob()
-		job := BuildJobFromCronJob(cj, "myapp-staging-ttl-run")
+		job := BuildJobFromCronJob(cj, "myapp-80081014-ttl-run")
 
 		initContainers := job.Spec.Template.Spec.InitContainers
-		require.Len(t, initContainers, 1)
+		require.Len(t, initContainers, 2)
 		assert.Equal(t, "helm-uninstall", initContainers[0].Name)
-		assert.Equal(t, []string{"helm", "uninstall", "myapp", "--namespace", "staging"}, initContainers[0].Command)
+		assert.Equal(t, []string{"helm", "uninstall", "myapp", "--namespace", "staging"}, uninstallArgs(initContainers[0].Command))
+		assert.Equal(t, "verify-uninstall", initContainers[1].Name)
+	})
+
+	t.Run("not retried", func(t *testing.T) {
+		cj := makeCronJob()
+		job := BuildJobFromCronJob(cj, "myapp-80081014-ttl-run")
+
+		require.NotNil(t, job.Spec.BackoffLimit)
+		assert.Equal(t, int32(0), *job.Spec.BackoffLimit)
+		assert.Nil(t, job.Spec.PodFailurePolicy)
+		assert.Equal(t, DefaultBackoffLimit, *cj.Spec.JobTemplate.Spec.BackoffLimit)
 	})
 
 	t.Run("job name and namespace", func(t *testing.T) {
 		cj := makeCronJob()
-		job := BuildJobFromCronJob(cj, "myapp-staging-ttl-run")
+		job := BuildJobFromCronJob(cj, "myapp-80081014-ttl-run")
 
-		assert.Equal(t, "myapp-staging-ttl-run", job.Name)
+		assert.Equal(t, "myapp-80081014-ttl-run", job.Name)
 		assert.Equal(t, "ops", job.Namespace)
 	})
 
@@ -298,7 +583,7 @@ func TestBuildJobFromCronJob(t *testing.T) {
 		origCmd := make([]string, len(cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Command))
 		copy(origCmd, cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Command)
 
-		_ = BuildJobFromCronJob(cj, "myapp-staging-ttl-run")
+		_ = BuildJobFromCronJob(cj, "myapp-80081014-ttl-run")
 
 		assert.Equal(t, origCmd, cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Command)
 	})
@@ -314,12 +599,32 @@ func TestBuildJobFromCronJob(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		job := BuildJobFromCronJob(cj, "myapp-staging-ttl-run")
+		job := BuildJobFromCronJob(cj, "myapp-80081014-ttl-run")
+
+		initContainers := job.Spec.Template.Spec.InitContainers
+		require.Len(t, initContainers, 3)
+		assert.Equal(t, "helm-uninstall", initContainers[0].Name)
+		assert.Equal(t, "verify-uninstall", initContainers[1].Name)
+		assert.Equal(t, "delete-namespace", initContainers[2].Name)
+	})
+
+	t.Run("expiry guard dropped", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "staging",
+			CronjobNamespace: "ops",
+			Schedule:         "0 12 1 1 *",
+			ExpiresAt:        time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC),
+		})
+		require.NoError(t, err)
+
+		job := BuildJobFromCronJob(cj, "myapp-80081014-ttl-run")
 
 		initContainers := job.Spec.Template.Spec.InitContainers
 		require.Len(t, initContainers, 2)
 		assert.Equal(t, "helm-uninstall", initContainers[0].Name)
-		assert.Equal(t, "delete-namespace", initContainers[1].Name)
+		assert.Equal(t, "verify-uninstall", initContainers[1].Name)
+		assert.Len(t, cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers, 3)
 	})
 }
 
@@ -358,3 +663,205 @@ func TestBuildJobFromCronJob_ManualCronJob(t *testing.T) {
 	// Container that's not named self-cleanup should be unchanged
 	assert.Equal(t, []string{"nginx"}, job.Spec.Template.Spec.Containers[0].Command)
 }
+
+func TestBuildCronJob_VerifyUninstall(t *testing.T) {
+	build := func(t *testing.T, opts CronJobOptions) corev1.Container {
+		t.Helper()
+		opts.ReleaseName = "myapp"
+		opts.ReleaseNamespace = "staging"
+		opts.CronjobNamespace = "ops"
+		opts.Schedule = "0 12 1 1 *"
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		return cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[1]
+	}
+
+	t.Run("keep-history ignores uninstalled records", func(t *testing.T) {
+		c := build(t, CronJobOptions{Uninstall: UninstallOptions{KeepHistory: true}})
+		assert.Contains(t, c.Command[2], "--selector 'owner=helm,name=myapp,status!=uninstalled'")
+	})
+
+	t.Run("keep-history with cleanup image", func(t *testing.T) {
+		c := build(t, CronJobOptions{Uninstall: UninstallOptions{KeepHistory: true}, CleanupImage: "helm-ttl-cleanup:v1"})
+		assert.Equal(t, []string{"/helm-ttl-cleanup", "verify-uninstalled", "--namespace", "staging", "--keep-history", "myapp"}, c.Command)
+	})
+
+	t.Run("script fails when records remain", func(t *testing.T) {
+		c := build(t, CronJobOptions{})
+		assert.Contains(t, c.Command[2], `if [ -n "$left" ]; then`)
+		assert.Contains(t, c.Command[2], "exit 1")
+	})
+}
+
+func TestBuildCronJob_ExpiryGuard(t *testing.T) {
+	expiresAt := time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC)
+	build := func(t *testing.T, opts CronJobOptions) *batchv1.CronJob {
+		t.Helper()
+		opts.ReleaseName = "myapp"
+		opts.ReleaseNamespace = "staging"
+		opts.CronjobNamespace = "ops"
+		opts.Schedule = TimeToCronSchedule(expiresAt)
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		return cj
+	}
+
+	t.Run("no guard without ExpiresAt", func(t *testing.T) {
+		cj := build(t, CronJobOptions{})
+		assert.NotContains(t, cj.Annotations, AnnotationExpiresAt)
+		assert.Equal(t, "helm-uninstall", cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[0].Name)
+	})
+
+	t.Run("guard runs before the uninstall", func(t *testing.T) {
+		cj := build(t, CronJobOptions{ExpiresAt: expiresAt})
+		assert.Equal(t, "2027-01-01T12:00:00Z", cj.Annotations[AnnotationExpiresAt])
+
+		spec := cj.Spec.JobTemplate.Spec.Template.Spec
+		require.Len(t, spec.InitContainers, 3)
+		guard := spec.InitContainers[0]
+		assert.Equal(t, "expiry-guard", guard.Name)
+		assert.Equal(t, DefaultKubectlImage, guard.Image)
+		assert.Equal(t, "sh", guard.Command[0])
+		assert.Contains(t, guard.Command[2], `if [ "$(date +%s)" -lt 1798718400 ]; then`)
+		assert.Contains(t, guard.Command[2], "refusing to uninstall before 2026-12-31T12:00:00Z")
+		assert.Contains(t, guard.Command[2], "exit 1")
+		assert.NotNil(t, guard.SecurityContext)
+		assert.Equal(t, "helm-uninstall", spec.InitContainers[1].Name)
+	})
+
+	t.Run("guard with cleanup image", func(t *testing.T) {
+		cj := build(t, CronJobOptions{ExpiresAt: expiresAt, CleanupImage: "helm-ttl-cleanup:v1"})
+
+		guard := cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[0]
+		assert.Equal(t, "helm-ttl-cleanup:v1", guard.Image)
+		assert.Equal(t, []string{"/helm-ttl-cleanup", "check-expiry", "2026-12-31T12:00:00Z"}, guard.Command)
+	})
+
+	t.Run("expiry in another time zone", func(t *testing.T) {
+		cj := build(t, CronJobOptions{ExpiresAt: expiresAt.In(time.FixedZone("EST", -5*3600))})
+		assert.Equal(t, "2027-01-01T12:00:00Z", cj.Annotations[AnnotationExpiresAt])
+	})
+}
+
+func TestSetExpiry(t *testing.T) {
+	expiresAt := time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC)
+	extended := time.Date(2027, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("updates annotation and guard", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", Schedule: "0 12 1 1 *", ExpiresAt: expiresAt})
+		require.NoError(t, err)
+
+		setExpiry(cj, extended)
+		assert.Equal(t, "2027-02-01T12:00:00Z", cj.Annotations[AnnotationExpiresAt])
+		assert.Contains(t, cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[0].Command[2], "refusing to uninstall before 2027-01-31T12:00:00Z")
+	})
+
+	t.Run("keeps the cleanup image guard", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", Schedule: "0 12 1 1 *", ExpiresAt: expiresAt, CleanupImage: "helm-ttl-cleanup:v1"})
+		require.NoError(t, err)
+
+		setExpiry(cj, extended)
+		assert.Equal(t, []string{"/helm-ttl-cleanup", "check-expiry", "2027-01-31T12:00:00Z"}, cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[0].Command)
+	})
+
+	t.Run("CronJob without a guard is left alone", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", Schedule: "0 12 1 1 *"})
+		require.NoError(t, err)
+		before := cj.DeepCopy()
+
+		setExpiry(cj, extended)
+		assert.Equal(t, before, cj)
+	})
+
+	t.Run("guard without annotations", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", Schedule: "0 12 1 1 *", ExpiresAt: expiresAt})
+		require.NoError(t, err)
+		cj.Annotations = nil
+
+		setExpiry(cj, extended)
+		assert.Equal(t, "2027-02-01T12:00:00Z", cj.Annotations[AnnotationExpiresAt])
+	})
+}
+
+func TestBuildCronJob_Driver(t *testing.T) {
+	build := func(t *testing.T, opts CronJobOptions) corev1.PodSpec {
+		t.Helper()
+		opts.ReleaseName = "myapp"
+		opts.ReleaseNamespace = "staging"
+		opts.CronjobNamespace = "ops"
+		opts.Schedule = "0 12 1 1 *"
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		return cj.Spec.JobTemplate.Spec.Template.Spec
+	}
+
+	t.Run("secrets leaves HELM_DRIVER unset", func(t *testing.T) {
+		spec := build(t, CronJobOptions{Driver: "secrets"})
+		assert.Equal(t, []corev1.EnvVar{{Name: "HOME", Value: "/tmp"}}, spec.InitContainers[0].Env)
+		assert.Contains(t, spec.InitContainers[1].Command[2], "kubectl get secrets --namespace staging")
+	})
+
+	t.Run("configmaps", func(t *testing.T) {
+		spec := build(t, CronJobOptions{Driver: "configmap"})
+		assert.Contains(t, spec.InitContainers[0].Env, corev1.EnvVar{Name: "HELM_DRIVER", Value: "configmap"})
+		assert.Contains(t, spec.InitContainers[1].Command[2], "kubectl get configmaps --namespace staging")
+	})
+
+	t.Run("configmaps with cleanup image", func(t *testing.T) {
+		spec := build(t, CronJobOptions{Driver: "configmaps", CleanupImage: "helm-ttl-cleanup:v1"})
+		assert.Equal(t, []string{"/helm-ttl-cleanup", "verify-uninstalled", "--namespace", "staging", "--storage", "configmaps", "myapp"}, spec.InitContainers[1].Command)
+	})
+
+	t.Run("sql skips the storage check", func(t *testing.T) {
+		spec := build(t, CronJobOptions{Driver: "sql"})
+		assert.Contains(t, spec.InitContainers[0].Env, corev1.EnvVar{Name: "HELM_DRIVER", Value: "sql"})
+		for _, c := range spec.InitContainers {
+			assert.NotEqual(t, "verify-uninstall", c.Name)
+		}
+	})
+
+	t.Run("unsupported driver", func(t *testing.T) {
+		_, err := BuildCronJob(CronJobOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", Schedule: "0 12 1 1 *", Driver: "memory"})
+		assert.EqualError(t, err, `unsupported Helm storage driver "memory" for a TTL: use secrets, configmaps or sql`)
+	})
+}
+
+func TestStorageResource(t *testing.T) {
+	tests := map[string]string{
+		"":           "secrets",
+		"secret":     "secrets",
+		"secrets":    "secrets",
+		"configmap":  "configmaps",
+		"configmaps": "configmaps",
+		"sql":        "",
+	}
+	for driver, want := range tests {
+		got, err := StorageResource(driver)
+		require.NoError(t, err, driver)
+		assert.Equal(t, want, got, driver)
+	}
+
+	_, err := StorageResource("memory")
+	assert.Error(t, err)
+}
+
+func TestCronJobDriver(t *testing.T) {
+	cj, err := BuildCronJob(CronJobOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", Schedule: "0 12 1 1 *", Driver: "sql"})
+	require.NoError(t, err)
+	assert.Equal(t, "sql", cronJobDriver(cj))
+
+	cj, err = BuildCronJob(CronJobOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", Schedule: "0 12 1 1 *"})
+	require.NoError(t, err)
+	assert.Equal(t, "secrets", cronJobDriver(cj))
+}
+
+func TestReleaseStorageSelector(t *testing.T) {
+	assert.Equal(t, "owner=helm,name=myapp", ReleaseStorageSelector("myapp", false))
+	assert.Equal(t, "owner=helm,name=myapp,status!=uninstalled", ReleaseStorageSelector("myapp", true))
+}
@@ -0,0 +1,210 @@
+package ttl
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateOrder controls how numeric dates such as 03/04 are read.
+type DateOrder string
+
+const (
+	// DateOrderStrict refuses numeric dates whose month and day could be
+	// swapped (e.g. 03/04) and is the default.
+	DateOrderStrict DateOrder = ""
+	// DateOrderMDY reads numeric dates as month/day[/year].
+	DateOrderMDY DateOrder = "mdy"
+	// DateOrderDMY reads numeric dates as day/month[/year].
+	DateOrderDMY DateOrder = "dmy"
+)
+
+// ParseDateOrder validates a date order setting. An empty string or
+// "strict" selects DateOrderStrict.
+func ParseDateOrder(s string) (DateOrder, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "strict":
+		return DateOrderStrict, nil
+	case string(DateOrderMDY):
+		return DateOrderMDY, nil
+	case string(DateOrderDMY):
+		return DateOrderDMY, nil
+	default:
+		return DateOrderStrict, fmt.Errorf("invalid date order %q: must be strict, mdy or dmy", s)
+	}
+}
+
+const timeOfDayPattern = `(?:\s+(?:at\s+)?(\d{1,2})(?::(\d{2}))?\s*(am|pm)?)?`
+
+var (
+	isoDatePattern       = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})(?:[t\s]+(\d{1,2}):(\d{2}))?$`)
+	numericDatePattern   = regexp.MustCompile(`^(\d{1,2})/(\d{1,2})(?:/(\d{4}|\d{2}))?` + timeOfDayPattern + `$`)
+	monthDayDatePattern  = regexp.MustCompile(`^([a-z]+)\.?\s+(\d{1,2})(?:st|nd|rd|th)?(?:,?\s+(\d{4}))?` + timeOfDayPattern + `$`)
+	dayMonthDatePattern  = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?([a-z]+)\.?(?:,?\s+(\d{4}))?` + timeOfDayPattern + `$`)
+	monthNames           = map[string]time.Month{}
+	errNotAnExplicitDate = errors.New("not an explicit date")
+)
+
+func init() {
+	for m := time.January; m <= time.December; m++ {
+		name := strings.ToLower(m.String())
+		monthNames[name] = m
+		monthNames[name[:3]] = m
+	}
+	monthNames["sept"] = time.September
+}
+
+// parseExplicitDate parses calendar dates that natural-language parsing
+// gets wrong or cannot read: ISO dates (2025-04-03 17:00), numeric dates
+// (04/03, 04/03/2025 5pm) and dates with a month name (April 3, 3rd of
+// April 5pm). A date without a time means midnight, and a date without a
+// year means its next occurrence. It returns errNotAnExplicitDate when the
+// input is not in one of these forms.
+func parseExplicitDate(input string, now time.Time, order DateOrder) (time.Time, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(input), " "))
+
+	if m := isoDatePattern.FindStringSubmatch(s); m != nil {
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		day, _ := strconv.Atoi(m[3])
+		return buildDate(input, now, year, month, day, m[4], m[5], "")
+	}
+
+	if m := numericDatePattern.FindStringSubmatch(s); m != nil {
+		first, _ := strconv.Atoi(m[1])
+		second, _ := strconv.Atoi(m[2])
+
+		month, day, err := numericMonthDay(input, first, second, order)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		year := 0
+		if m[3] != "" {
+			year, _ = strconv.Atoi(m[3])
+			if year < 100 {
+				year += 2000
+			}
+		}
+
+		return buildDate(input, now, year, month, day, m[4], m[5], m[6])
+	}
+
+	if m := monthDayDatePattern.FindStringSubmatch(s); m != nil {
+		if month, ok := monthNames[m[1]]; ok {
+			day, _ := strconv.Atoi(m[2])
+			year, _ := strconv.Atoi(m[3])
+			return buildDate(input, now, year, int(month), day, m[4], m[5], m[6])
+		}
+	}
+
+	if m := dayMonthDatePattern.FindStringSubmatch(s); m != nil {
+		if month, ok := monthNames[m[2]]; ok {
+			day, _ := strconv.Atoi(m[1])
+			year, _ := strconv.Atoi(m[3])
+			return buildDate(input, now, year, int(month), day, m[4], m[5], m[6])
+		}
+	}
+
+	return time.Time{}, errNotAnExplicitDate
+}
+
+// numericMonthDay resolves the month and day of a numeric date such as
+// 03/04 according to the date order.
+func numericMonthDay(input string, first, second int, order DateOrder) (int, int, error) {
+	switch order {
+	case DateOrderMDY:
+		return first, second, nil
+	case DateOrderDMY:
+		return second, first, nil
+	}
+
+	switch {
+	case first > 12 && second <= 12:
+		return second, first, nil
+	case second > 12 && first <= 12:
+		return first, second, nil
+	case first == second || first > 12:
+		return first, second, nil
+	}
+
+	return 0, 0, fmt.Errorf("ambiguous date %q: it could mean %s %d (month/day) or %s %d (day/month); "+
+		"use a month name (e.g. %q) or an ISO date (YYYY-MM-DD), or set the date order to mdy or dmy",
+		input, time.Month(first), second, time.Month(second), first,
+		fmt.Sprintf("%s %d", time.Month(first), second))
+}
+
+// buildDate validates the date and time components and returns the
+// resulting time in now's location. A zero year selects the next
+// occurrence of the date.
+func buildDate(input string, now time.Time, year, month, day int, hourStr, minuteStr, meridiem string) (time.Time, error) {
+	hour, minute, err := parseTimeOfDay(input, hourStr, minuteStr, meridiem)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if month < 1 || month > 12 {
+		return time.Time{}, fmt.Errorf("invalid date %q: month must be 1-12", input)
+	}
+
+	// 2024 is a leap year, so this accepts February 29
+	if day < 1 || time.Date(2024, time.Month(month), day, 0, 0, 0, 0, time.UTC).Day() != day {
+		return time.Time{}, fmt.Errorf("invalid date %q: %s has no day %d", input, time.Month(month), day)
+	}
+
+	if year != 0 {
+		t := time.Date(year, time.Month(month), day, hour, minute, 0, 0, now.Location())
+		if t.Day() != day {
+			return time.Time{}, fmt.Errorf("invalid date %q: %s %d does not exist in %d", input, time.Month(month), day, year)
+		}
+
+		return t, nil
+	}
+
+	for _, y := range []int{now.Year(), now.Year() + 1} {
+		t := time.Date(y, time.Month(month), day, hour, minute, 0, 0, now.Location())
+		if t.Day() == day && t.After(now) {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q: %s %d does not occur within the next year", input, time.Month(month), day)
+}
+
+// parseTimeOfDay validates the groups of timeOfDayPattern and returns the
+// hour and minute they give, or midnight when there is no time.
+func parseTimeOfDay(input, hourStr, minuteStr, meridiem string) (int, int, error) {
+	if hourStr == "" {
+		return 0, 0, nil
+	}
+
+	hour, _ := strconv.Atoi(hourStr)
+	minute := 0
+	if minuteStr != "" {
+		minute, _ = strconv.Atoi(minuteStr)
+	}
+
+	switch meridiem {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, fmt.Errorf("invalid time in %q: hour must be 1-12 with am/pm", input)
+		}
+		hour %= 12
+		if meridiem == "pm" {
+			hour += 12
+		}
+	default:
+		if minuteStr == "" {
+			return 0, 0, fmt.Errorf("invalid time in %q: use 17:00 or 5pm", input)
+		}
+	}
+
+	if hour > 23 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid time in %q", input)
+	}
+
+	return hour, minute, nil
+}
@@ -0,0 +1,182 @@
+package ttl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDateOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected DateOrder
+	}{
+		{"", DateOrderStrict},
+		{"strict", DateOrderStrict},
+		{"mdy", DateOrderMDY},
+		{" MDY ", DateOrderMDY},
+		{"dmy", DateOrderDMY},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			order, err := ParseDateOrder(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, order)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ParseDateOrder("ymd")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "must be strict, mdy or dmy")
+	})
+}
+
+func TestParseTimeInputWithOrder_Dates(t *testing.T) {
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	date := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		order    DateOrder
+		expected time.Time
+	}{
+		// ISO dates are never ambiguous
+		{"iso date", "2025-04-03", DateOrderStrict, date(2025, time.April, 3, 0, 0)},
+		{"iso date with time", "2025-04-03 17:30", DateOrderStrict, date(2025, time.April, 3, 17, 30)},
+		{"iso date with T separator", "2025-04-03T08:05", DateOrderStrict, date(2025, time.April, 3, 8, 5)},
+		{"iso date ignores order", "2025-04-03", DateOrderDMY, date(2025, time.April, 3, 0, 0)},
+
+		// Numeric dates that can only be read one way
+		{"day over 12 first", "13/04", DateOrderStrict, date(2025, time.April, 13, 0, 0)},
+		{"day over 12 second", "04/13", DateOrderStrict, date(2025, time.April, 13, 0, 0)},
+		{"same month and day", "05/05", DateOrderStrict, date(2025, time.May, 5, 0, 0)},
+		{"unambiguous with time", "25/12 5pm", DateOrderStrict, date(2025, time.December, 25, 17, 0)},
+
+		// Numeric dates with an explicit order
+		{"mdy", "05/06", DateOrderMDY, date(2025, time.May, 6, 0, 0)},
+		{"dmy", "05/06", DateOrderDMY, date(2025, time.June, 5, 0, 0)},
+		{"mdy with time", "05/06 5pm", DateOrderMDY, date(2025, time.May, 6, 17, 0)},
+		{"dmy with time", "05/06 5pm", DateOrderDMY, date(2025, time.June, 5, 17, 0)},
+		{"mdy with year", "05/06/2025 17:00", DateOrderMDY, date(2025, time.May, 6, 17, 0)},
+		{"dmy with two-digit year", "05/06/25 at 9:15am", DateOrderDMY, date(2025, time.June, 5, 9, 15)},
+
+		// Month names
+		{"month day", "April 3", DateOrderStrict, date(2025, time.April, 3, 0, 0)},
+		{"month day with pm", "April 3 5pm", DateOrderStrict, date(2025, time.April, 3, 17, 0)},
+		{"month day with at", "april 3 at 5:30 pm", DateOrderStrict, date(2025, time.April, 3, 17, 30)},
+		{"abbreviated month", "Apr 3", DateOrderStrict, date(2025, time.April, 3, 0, 0)},
+		{"abbreviated month with dot", "Sept. 3", DateOrderStrict, date(2025, time.September, 3, 0, 0)},
+		{"ordinal day", "April 3rd 17:00", DateOrderStrict, date(2025, time.April, 3, 17, 0)},
+		{"month day year", "April 3, 2025 5pm", DateOrderStrict, date(2025, time.April, 3, 17, 0)},
+		{"day month", "3 April", DateOrderStrict, date(2025, time.April, 3, 0, 0)},
+		{"day of month", "3rd of April 17:00", DateOrderStrict, date(2025, time.April, 3, 17, 0)},
+		{"12am is midnight", "April 3 12am", DateOrderStrict, date(2025, time.April, 3, 0, 0)},
+		{"12pm is noon", "April 3 12pm", DateOrderStrict, date(2025, time.April, 3, 12, 0)},
+		{"extra whitespace", "  April   3  ", DateOrderStrict, date(2025, time.April, 3, 0, 0)},
+
+		// Dates without a year roll over to their next occurrence
+		{"past date rolls to next year", "January 5", DateOrderStrict, date(2026, time.January, 5, 0, 0)},
+		{"later today stays this year", "March 10 10am", DateOrderStrict, date(2025, time.March, 10, 10, 0)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ParseTimeInputWithOrder(tc.input, now, tc.order)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestParseTimeInputWithOrder_DateErrors(t *testing.T) {
+	now := time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		input    string
+		order    DateOrder
+		contains string
+	}{
+		{"ambiguous numeric date", "03/04", DateOrderStrict, `ambiguous date "03/04": it could mean March 4 (month/day) or April 3 (day/month)`},
+		{"ambiguous numeric date with time", "03/04 5pm", DateOrderStrict, "ambiguous date"},
+		{"ambiguous numeric date with year", "1/2/2025", DateOrderStrict, "ambiguous date"},
+		{"month out of range", "13/13", DateOrderStrict, "month must be 1-12"},
+		{"mdy month out of range", "13/04", DateOrderMDY, "month must be 1-12"},
+		{"dmy month out of range", "04/13", DateOrderDMY, "month must be 1-12"},
+		{"day out of range", "April 31", DateOrderStrict, "April has no day 31"},
+		{"day zero", "2025-04-00", DateOrderStrict, "has no day 0"},
+		{"bare hour", "April 3 5", DateOrderStrict, "use 17:00 or 5pm"},
+		{"hour out of range with pm", "April 3 13pm", DateOrderStrict, "hour must be 1-12"},
+		{"hour out of range", "April 3 25:00", DateOrderStrict, "invalid time"},
+		{"minute out of range", "April 3 10:75", DateOrderStrict, "invalid time"},
+		{"past date with year", "2024-04-03", DateOrderStrict, "not in the future"},
+		{"beyond maximum", "2026-12-01", DateOrderStrict, "maximum"},
+		{"unrecognized text", "whenever", DateOrderStrict, "not in the future"},
+		{"unsupported numeric format", "03.04", DateOrderStrict, "could not parse time input"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseTimeInputWithOrder(tc.input, now, tc.order)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.contains)
+		})
+	}
+}
+
+func TestParseTimeInput_RefusesAmbiguousDates(t *testing.T) {
+	now := time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	_, err := ParseTimeInput("03/04 5pm", now)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ambiguous date")
+}
+
+func TestBuildDate_NextOccurrence(t *testing.T) {
+	now := time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+
+	t.Run("earlier today rolls to next year", func(t *testing.T) {
+		result, err := buildDate("January 10 8am", now, 0, 1, 10, "8", "", "am")
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2026, time.January, 10, 8, 0, 0, 0, time.UTC), result)
+	})
+
+	t.Run("explicit year does not roll over", func(t *testing.T) {
+		result, err := buildDate("2025-01-05", now, 2025, 1, 5, "", "", "")
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2025, time.January, 5, 0, 0, 0, 0, time.UTC), result)
+	})
+}
+
+func TestBuildDate_LeapDay(t *testing.T) {
+	t.Run("next leap day", func(t *testing.T) {
+		now := time.Date(2027, 3, 1, 0, 0, 0, 0, time.UTC)
+
+		result, err := buildDate("Feb 29", now, 0, 2, 29, "", "", "")
+		require.NoError(t, err)
+		assert.Equal(t, time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC), result)
+	})
+
+	t.Run("no leap day within a year", func(t *testing.T) {
+		now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+		_, err := buildDate("Feb 29", now, 0, 2, 29, "", "", "")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "does not occur within the next year")
+	})
+
+	t.Run("leap day in a common year", func(t *testing.T) {
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		_, err := buildDate("2025-02-29", now, 2025, 2, 29, "", "", "")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "February 29 does not exist in 2025")
+	})
+}
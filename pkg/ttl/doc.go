@@ -0,0 +1,24 @@
+// Package ttl implements helm-ttl: it sets, reads and removes the TTLs
+// that uninstall Helm releases, and namespaces, once they expire, and
+// cleans up what they leave behind. The helm ttl commands are thin
+// wrappers around it.
+//
+// Programs embedding helm-ttl can use a Client, which carries the
+// Kubernetes client, the Helm configuration and the namespaces, so each
+// call only names the release:
+//
+//	client, err := ttl.NewClient(ttl.WithNamespace("preview"))
+//	if err != nil {
+//		return err
+//	}
+//
+//	result, err := client.Set(ctx, "my-release", "7d", func(o *ttl.SetTTLOptions) {
+//		o.CreateServiceAccount = true
+//	})
+//
+// NewClient reads its defaults from the environment Helm gives plugins,
+// as DefaultsFromEnv does. The package functions, such as SetTTL, GetTTL
+// and CleanupOrphaned, take the clients and options explicitly for
+// callers that need more control; Client.Kubernetes returns the client to
+// pass them.
+package ttl
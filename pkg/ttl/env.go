@@ -0,0 +1,74 @@
+package ttl
+
+import (
+	"os"
+	"strings"
+)
+
+// Defaults holds the settings the CLI reads from the environment, for
+// library users that want the same behavior without parsing it themselves.
+type Defaults struct {
+	// Namespace is HELM_NAMESPACE, or "default".
+	Namespace string
+	Kube      KubeOptions
+	// SetTTL has the release and CronJob namespaces and the HELM_TTL_*
+	// settings filled in; callers add the release name and duration.
+	SetTTL SetTTLOptions
+}
+
+// DefaultsFromEnv builds the options the CLI would use when no flags are
+// given, from HELM_NAMESPACE, HELM_KUBECONTEXT, KUBECONFIG, the other
+// HELM_KUBE* connection variables listed on KubeOptions, HELM_DRIVER,
+// HELM_TTL_BACKEND, HELM_TTL_DATE_ORDER, HELM_TTL_IMAGE_PULL_SECRETS and
+// HELM_TTL_REGISTRY_PREFIX.
+func DefaultsFromEnv() Defaults {
+	namespace := envNamespace()
+
+	return Defaults{
+		Namespace: namespace,
+		Kube: KubeOptions{
+			Driver:  envDriver(),
+			Backend: os.Getenv("HELM_TTL_BACKEND"),
+		}.withEnv(),
+		SetTTL: SetTTLOptions{
+			ReleaseNamespace: namespace,
+			CronjobNamespace: namespace,
+			ServiceAccount:   "default",
+			DateOrder:        os.Getenv("HELM_TTL_DATE_ORDER"),
+			ImagePullSecrets: envImagePullSecrets(),
+			RegistryPrefix:   os.Getenv("HELM_TTL_REGISTRY_PREFIX"),
+			Driver:           envDriver(),
+		},
+	}
+}
+
+func envNamespace() string {
+	if ns := os.Getenv("HELM_NAMESPACE"); ns != "" {
+		return ns
+	}
+
+	return "default"
+}
+
+func envDriver() string {
+	if driver := os.Getenv("HELM_DRIVER"); driver != "" {
+		return driver
+	}
+
+	return "secrets"
+}
+
+func envImagePullSecrets() []string {
+	return envList("HELM_TTL_IMAGE_PULL_SECRETS")
+}
+
+// envList splits the comma-separated environment variable key, returning
+// nil when it is unset.
+func envList(key string) []string {
+	env := os.Getenv(key)
+	if env == "" {
+		return nil
+	}
+
+	return strings.Split(env, ",")
+}
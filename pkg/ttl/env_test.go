@@ -0,0 +1,65 @@
+package ttl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultsFromEnv(t *testing.T) {
+	t.Run("unset", func(t *testing.T) {
+		for _, key := range []string{"HELM_NAMESPACE", "HELM_KUBECONTEXT", "KUBECONFIG", "HELM_DRIVER", "HELM_TTL_BACKEND", "HELM_TTL_DATE_ORDER", "HELM_TTL_IMAGE_PULL_SECRETS", "HELM_TTL_REGISTRY_PREFIX",
+			"HELM_KUBEAPISERVER", "HELM_KUBETOKEN", "HELM_KUBEASUSER", "HELM_KUBEASGROUPS", "HELM_KUBECAFILE", "HELM_KUBEINSECURE_SKIP_TLS_VERIFY", "HELM_KUBETLS_SERVER_NAME", "HELM_BURST_LIMIT", "HELM_QPS"} {
+			t.Setenv(key, "")
+		}
+
+		defaults := DefaultsFromEnv()
+		assert.Equal(t, Defaults{
+			Namespace: "default",
+			Kube:      KubeOptions{Driver: "secrets"},
+			SetTTL: SetTTLOptions{
+				ReleaseNamespace: "default",
+				CronjobNamespace: "default",
+				ServiceAccount:   "default",
+				Driver:           "secrets",
+			},
+		}, defaults)
+	})
+
+	t.Run("set", func(t *testing.T) {
+		t.Setenv("HELM_NAMESPACE", "staging")
+		t.Setenv("HELM_KUBECONTEXT", "kind-dev")
+		t.Setenv("KUBECONFIG", "/tmp/kubeconfig")
+		t.Setenv("HELM_DRIVER", "configmap")
+		t.Setenv("HELM_TTL_BACKEND", "job-sleep")
+		t.Setenv("HELM_TTL_DATE_ORDER", "dmy")
+		t.Setenv("HELM_TTL_IMAGE_PULL_SECRETS", "regcred,mirror")
+		t.Setenv("HELM_TTL_REGISTRY_PREFIX", "registry.example.com/mirror")
+		t.Setenv("HELM_KUBEAPISERVER", "https://10.0.0.1:6443")
+		t.Setenv("HELM_KUBEASGROUPS", "ops,ci")
+		t.Setenv("HELM_KUBEINSECURE_SKIP_TLS_VERIFY", "true")
+		t.Setenv("HELM_QPS", "2.5")
+
+		defaults := DefaultsFromEnv()
+		assert.Equal(t, "staging", defaults.Namespace)
+		assert.Equal(t, KubeOptions{
+			KubeContext:           "kind-dev",
+			Kubeconfig:            "/tmp/kubeconfig",
+			Driver:                "configmap",
+			Backend:               "job-sleep",
+			APIServer:             "https://10.0.0.1:6443",
+			AsGroups:              []string{"ops", "ci"},
+			InsecureSkipTLSVerify: true,
+			QPS:                   2.5,
+		}, defaults.Kube)
+		assert.Equal(t, SetTTLOptions{
+			ReleaseNamespace: "staging",
+			CronjobNamespace: "staging",
+			ServiceAccount:   "default",
+			DateOrder:        "dmy",
+			ImagePullSecrets: []string{"regcred", "mirror"},
+			RegistryPrefix:   "registry.example.com/mirror",
+			Driver:           "configmap",
+		}, defaults.SetTTL)
+	})
+}
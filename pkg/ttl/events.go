@@ -0,0 +1,79 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Reasons of the Events recorded on TTL CronJobs.
+const (
+	EventReasonTTLSet              = "TTLSet"
+	EventReasonTTLExtended         = "TTLExtended"
+	EventReasonTTLUnset            = "TTLUnset"
+	EventReasonTTLExpiredUninstall = "TTLExpiredUninstall"
+)
+
+// eventComponent is the source and reporting controller of the Events
+// helm-ttl records.
+const eventComponent = "helm-ttl"
+
+// recordEvent records a Kubernetes Event on a TTL CronJob, so TTL
+// activity shows in kubectl describe, kubectl get events and event-based
+// alerting. The Event lives in the CronJob namespace and outlives the
+// CronJob by the cluster's event TTL.
+func recordEvent(ctx context.Context, client kubernetes.Interface, cj *batchv1.CronJob, eventType, reason, message string) error {
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cj.Name + "." + strconv.FormatInt(now.UnixNano(), 16),
+			Namespace: cj.Namespace,
+			Labels:    eventLabels(cj),
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion:      BackendOf(client).GroupVersionKind().GroupVersion().String(),
+			Kind:            BackendOf(client).GroupVersionKind().Kind,
+			Name:            cj.Name,
+			Namespace:       cj.Namespace,
+			UID:             cj.UID,
+			ResourceVersion: cj.ResourceVersion,
+		},
+		Type:                eventType,
+		Reason:              reason,
+		Message:             message,
+		Source:              corev1.EventSource{Component: eventComponent},
+		ReportingController: eventComponent,
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+	}
+
+	if _, err := client.CoreV1().Events(cj.Namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to record %s event: %w", reason, err)
+	}
+
+	return nil
+}
+
+// eventLabels returns the labels of the Events recorded on a CronJob: the
+// release labels of a release TTL, or the namespace label of a namespace
+// TTL.
+func eventLabels(cj *batchv1.CronJob) map[string]string {
+	if IsNamespaceTTL(cj) {
+		return map[string]string{
+			LabelManagedBy: LabelManagedByValue,
+			LabelNamespace: cj.Labels[LabelNamespace],
+		}
+	}
+
+	return map[string]string{
+		LabelManagedBy:        LabelManagedByValue,
+		LabelRelease:          cj.Labels[LabelRelease],
+		LabelReleaseNamespace: cj.Labels[LabelReleaseNamespace],
+	}
+}
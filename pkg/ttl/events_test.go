@@ -0,0 +1,172 @@
+package ttl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// listEvents returns the Events recorded in a namespace.
+func listEvents(t *testing.T, client *fake.Clientset, namespace string) []corev1.Event {
+	t.Helper()
+
+	events, err := client.CoreV1().Events(namespace).List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+
+	return events.Items
+}
+
+func TestRecordEvent(t *testing.T) {
+	ctx := context.Background()
+	cj := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{
+		Name:            "myapp-80081014-ttl",
+		Namespace:       "ops",
+		UID:             "1234",
+		ResourceVersion: "42",
+		Labels: map[string]string{
+			LabelRelease:          "myapp",
+			LabelReleaseNamespace: "staging",
+		},
+	}}
+
+	t.Run("records the event on the CronJob", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		require.NoError(t, recordEvent(ctx, client, cj, corev1.EventTypeNormal, EventReasonTTLSet, "TTL set"))
+
+		events := listEvents(t, client, "ops")
+		require.Len(t, events, 1)
+		ev := events[0]
+		assert.Contains(t, ev.Name, "myapp-80081014-ttl.")
+		assert.Equal(t, corev1.ObjectReference{
+			APIVersion:      "batch/v1",
+			Kind:            "CronJob",
+			Name:            "myapp-80081014-ttl",
+			Namespace:       "ops",
+			UID:             "1234",
+			ResourceVersion: "42",
+		}, ev.InvolvedObject)
+		assert.Equal(t, corev1.EventTypeNormal, ev.Type)
+		assert.Equal(t, "TTLSet", ev.Reason)
+		assert.Equal(t, "TTL set", ev.Message)
+		assert.Equal(t, "helm-ttl", ev.Source.Component)
+		assert.Equal(t, "helm-ttl", ev.ReportingController)
+		assert.Equal(t, int32(1), ev.Count)
+		assert.False(t, ev.FirstTimestamp.IsZero())
+		assert.Equal(t, "myapp", ev.Labels[LabelRelease])
+		assert.Equal(t, "staging", ev.Labels[LabelReleaseNamespace])
+		assert.Equal(t, LabelManagedByValue, ev.Labels[LabelManagedBy])
+	})
+
+	t.Run("create error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("create", "events", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		err := recordEvent(ctx, client, cj, corev1.EventTypeNormal, EventReasonTTLSet, "TTL set")
+		assert.EqualError(t, err, "failed to record TTLSet event: forbidden")
+	})
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("set, extend and unset", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		})
+		require.NoError(t, err)
+		_, err = ExtendTTL(ctx, client, ExtendTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", By: 24 * time.Hour})
+		require.NoError(t, err)
+		require.NoError(t, UnsetTTL(ctx, client, "myapp", "default", "default"))
+
+		events := listEvents(t, client, "default")
+		require.Len(t, events, 3)
+		reasons := []string{events[0].Reason, events[1].Reason, events[2].Reason}
+		assert.ElementsMatch(t, []string{"TTLSet", "TTLExtended", "TTLUnset"}, reasons)
+		for _, ev := range events {
+			assert.Equal(t, corev1.EventTypeNormal, ev.Type)
+			assert.Equal(t, "myapp-4a0c226a-ttl", ev.InvolvedObject.Name)
+			switch ev.Reason {
+			case EventReasonTTLSet:
+				assert.Contains(t, ev.Message, `TTL set for release "myapp" in namespace "default": uninstall at `)
+			case EventReasonTTLExtended:
+				assert.Contains(t, ev.Message, `TTL for release "myapp" in namespace "default" extended by 1d0h0m: uninstall at `)
+			case EventReasonTTLUnset:
+				assert.Equal(t, `TTL removed for release "myapp" in namespace "default"`, ev.Message)
+			}
+		}
+	})
+
+	t.Run("event failures do not fail the operation", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		client.PrependReactor("create", "events", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		})
+		require.NoError(t, err)
+		require.NoError(t, UnsetTTL(ctx, client, "myapp", "default", "default"))
+	})
+
+	t.Run("run", func(t *testing.T) {
+		for name, exitCode := range map[string]int32{"success": 0, "failure": 1} {
+			t.Run(name, func(t *testing.T) {
+				cj := buildTestCronJob(t, "myapp", "default", "default", false)
+				pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+					[]string{"helm-uninstall"}, []string{"self-cleanup"},
+					map[string]int32{"helm-uninstall": exitCode})
+				client := fake.NewClientset(cj, pod)
+
+				_, _ = RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+
+				events := listEvents(t, client, "default")
+				require.Len(t, events, 1)
+				assert.Equal(t, EventReasonTTLExpiredUninstall, events[0].Reason)
+				if exitCode == 0 {
+					assert.Equal(t, corev1.EventTypeNormal, events[0].Type)
+					assert.Equal(t, `helm ttl run uninstalled release "myapp" in namespace "default"`, events[0].Message)
+				} else {
+					assert.Equal(t, corev1.EventTypeWarning, events[0].Type)
+					assert.Equal(t, `helm ttl run failed to uninstall release "myapp" in namespace "default"`, events[0].Message)
+				}
+			})
+		}
+	})
+
+	t.Run("dry run records nothing", func(t *testing.T) {
+		client := fake.NewClientset(buildTestCronJob(t, "myapp", "default", "default", false))
+
+		_, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, listEvents(t, client, "default"))
+	})
+}
@@ -0,0 +1,130 @@
+package ttl
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// ExportTTL returns the resources SetTTL would create or update for opts,
+// the ServiceAccount and RBAC first and the CronJob, or the Job of the
+// job-sleep backend, last, with its scale-down CronJob after it, without
+// changing anything in the cluster. It lets GitOps users commit the TTL to their
+// repository and leave applying it to Argo CD or Flux.
+//
+// The release must exist and the namespace policy still applies. The
+// service account is not looked up when it is not created, since it may
+// be applied along with the manifests.
+func ExportTTL(ctx context.Context, cfg *action.Configuration, client kubernetes.Interface, opts SetTTLOptions) ([]runtime.Object, error) {
+	plan, err := planSet(ctx, cfg, client, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []runtime.Object
+	if opts.CreateServiceAccount && BackendOf(client).RunsJobs() {
+		objs = plan.rbac(opts).objects()
+		plan.tracking.apply(objs...)
+	}
+
+	generation := int64(1)
+	if plan.existing != nil {
+		generation = cronJobGeneration(plan.existing) + 1
+	}
+	setGeneration(plan.cj, generation)
+	obj, err := BackendOf(client).Object(plan.cj, plan.now)
+	if err != nil {
+		return nil, err
+	}
+	objs = append(objs, obj)
+	if plan.scaleDown != nil {
+		objs = append(objs, plan.scaleDown)
+	}
+
+	if err := setKinds(objs); err != nil {
+		return nil, err
+	}
+
+	return objs, nil
+}
+
+// setKinds sets the apiVersion and kind of the built-in resources among
+// objs, which typed objects leave empty. A ReleaseTTL has them already.
+func setKinds(objs []runtime.Object) error {
+	for _, obj := range objs {
+		if !obj.GetObjectKind().GroupVersionKind().Empty() {
+			continue
+		}
+
+		gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+		if err != nil {
+			return fmt.Errorf("failed to find the kind of %T: %w", obj, err)
+		}
+		obj.GetObjectKind().SetGroupVersionKind(gvks[0])
+	}
+
+	return nil
+}
+
+// FormatManifests renders resources as a multi-document YAML stream that
+// kubectl apply -f accepts.
+func FormatManifests(objs []runtime.Object) (string, error) {
+	docs := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		out, err := k8syaml.Marshal(obj)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal %s: %w", objectKind(obj), err)
+		}
+		docs = append(docs, "---\n"+string(out))
+	}
+
+	return strings.Join(docs, ""), nil
+}
+
+// WriteManifests writes each resource to its own YAML file in dir,
+// creating dir if needed, and returns the paths written. Files are named
+// <kind>[-<namespace>]-<name>.yaml, so exporting the same TTL again
+// overwrites them.
+func WriteManifests(dir string, objs []runtime.Object) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	paths := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		out, err := FormatManifests([]runtime.Object{obj})
+		if err != nil {
+			return paths, err
+		}
+
+		path := filepath.Join(dir, manifestFileName(obj))
+		if err := os.WriteFile(path, []byte(out), 0o644); err != nil {
+			return paths, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// manifestFileName returns the file WriteManifests writes a resource to.
+func manifestFileName(obj runtime.Object) string {
+	meta := obj.(metav1.Object)
+	kind := cmp.Or(obj.GetObjectKind().GroupVersionKind().Kind, objectKind(obj))
+	parts := []string{strings.ToLower(kind)}
+	if meta.GetNamespace() != "" {
+		parts = append(parts, meta.GetNamespace())
+	}
+
+	return strings.Join(append(parts, meta.GetName()), "-") + ".yaml"
+}
@@ -0,0 +1,241 @@
+package ttl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestExportTTL(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("exports the resources SetTTL creates without creating them", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "staging")
+		client := fake.NewClientset()
+		opts := SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "staging",
+			CronjobNamespace:     "ops",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			DeleteNamespace:      true,
+		}
+
+		objs, err := ExportTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+
+		var kinds []string
+		for _, obj := range objs {
+			kinds = append(kinds, obj.GetObjectKind().GroupVersionKind().Kind)
+		}
+		assert.Equal(t, []string{"ServiceAccount", "Role", "RoleBinding", "Role", "RoleBinding", "ClusterRole", "ClusterRoleBinding", "CronJob"}, kinds)
+		assert.Equal(t, "rbac.authorization.k8s.io/v1", objs[1].GetObjectKind().GroupVersionKind().GroupVersion().String())
+
+		cj, ok := objs[len(objs)-1].(*batchv1.CronJob)
+		require.True(t, ok)
+		assert.Equal(t, "myapp-80081014-ttl", cj.Name)
+		assert.Equal(t, "ops", cj.Namespace)
+		assert.Equal(t, "myapp-80081014-ttl", cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
+		assert.Equal(t, int64(1), cronJobGeneration(cj))
+
+		// Nothing was written to the cluster
+		for _, action := range client.Actions() {
+			assert.Contains(t, []string{"get", "list"}, action.GetVerb(), action)
+		}
+
+		// The same resources as SetTTL creates
+		_, err = SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+		for _, obj := range objs[:len(objs)-1] {
+			meta := obj.(metav1.Object)
+			var got metav1.Object
+			switch obj.(type) {
+			case *corev1.ServiceAccount:
+				got, err = client.CoreV1().ServiceAccounts(meta.GetNamespace()).Get(ctx, meta.GetName(), metav1.GetOptions{})
+			case *rbacv1.Role:
+				got, err = client.RbacV1().Roles(meta.GetNamespace()).Get(ctx, meta.GetName(), metav1.GetOptions{})
+			case *rbacv1.RoleBinding:
+				got, err = client.RbacV1().RoleBindings(meta.GetNamespace()).Get(ctx, meta.GetName(), metav1.GetOptions{})
+			case *rbacv1.ClusterRole:
+				got, err = client.RbacV1().ClusterRoles().Get(ctx, meta.GetName(), metav1.GetOptions{})
+			case *rbacv1.ClusterRoleBinding:
+				got, err = client.RbacV1().ClusterRoleBindings().Get(ctx, meta.GetName(), metav1.GetOptions{})
+			}
+			require.NoError(t, err, objectKind(obj))
+			assert.Equal(t, meta.GetLabels(), got.GetLabels(), objectKind(obj))
+		}
+	})
+
+	t.Run("existing service account is neither exported nor checked", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		objs, err := ExportTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Duration:         "2d",
+			ServiceAccount:   "cleaner",
+		})
+		require.NoError(t, err)
+		require.Len(t, objs, 1)
+		assert.Equal(t, "cleaner", objs[0].(*batchv1.CronJob).Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
+	})
+
+	t.Run("existing TTL bumps the generation", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		opts := SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		}
+		_, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+
+		objs, err := ExportTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), cronJobGeneration(objs[len(objs)-1].(*batchv1.CronJob)))
+	})
+
+	t.Run("policy still applies", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: policy.ConfigMapName, Namespace: "default"},
+			Data:       map[string]string{policy.KeyMaxDuration: "1d"},
+		})
+
+		_, err := ExportTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Duration:         "2d",
+		})
+		var exceeded *policy.MaxDurationExceededError
+		assert.ErrorAs(t, err, &exceeded)
+	})
+
+	t.Run("release not found", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "other", "default")
+
+		_, err := ExportTTL(ctx, cfg, fake.NewClientset(), SetTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", Duration: "2d"})
+		var notFound *ReleaseNotFoundError
+		assert.ErrorAs(t, err, &notFound)
+	})
+
+	t.Run("CronJob lookup error", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		client.PrependReactor("get", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, assert.AnError
+		})
+
+		_, err := ExportTTL(ctx, cfg, client, SetTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", Duration: "2d"})
+		assert.ErrorContains(t, err, "failed to check existing CronJob")
+	})
+}
+
+func testManifests(t *testing.T) []runtime.Object {
+	t.Helper()
+
+	cfg, _ := setupTestRelease(t, "myapp", "staging")
+	objs, err := ExportTTL(context.Background(), cfg, fake.NewClientset(), SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "staging",
+		CronjobNamespace:     "ops",
+		Duration:             "2d",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+		DeleteNamespace:      true,
+	})
+	require.NoError(t, err)
+
+	return objs
+}
+
+func TestFormatManifests(t *testing.T) {
+	out, err := FormatManifests(testManifests(t))
+	require.NoError(t, err)
+
+	docs := strings.Split(strings.TrimPrefix(out, "---\n"), "---\n")
+	require.Len(t, docs, 8)
+	assert.True(t, strings.HasPrefix(docs[0], "apiVersion: v1\nkind: ServiceAccount\n"))
+	assert.True(t, strings.HasPrefix(docs[7], "apiVersion: batch/v1\nkind: CronJob\n"))
+	assert.Contains(t, docs[7], "name: myapp-80081014-ttl\n")
+
+	t.Run("marshal error", func(t *testing.T) {
+		_, err := FormatManifests([]runtime.Object{&unmarshalable{}})
+		assert.Error(t, err)
+	})
+}
+
+// unmarshalable is a resource that cannot be rendered as YAML.
+type unmarshalable struct {
+	corev1.ConfigMap
+	Bad func() `json:"bad"`
+}
+
+func TestWriteManifests(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ttl")
+
+	paths, err := WriteManifests(dir, testManifests(t))
+	require.NoError(t, err)
+
+	var names []string
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+	}
+	assert.Equal(t, []string{
+		"serviceaccount-ops-myapp-80081014-ttl.yaml",
+		"role-staging-myapp-80081014-ttl.yaml",
+		"rolebinding-staging-myapp-80081014-ttl.yaml",
+		"role-ops-myapp-80081014-ttl.yaml",
+		"rolebinding-ops-myapp-80081014-ttl.yaml",
+		"clusterrole-myapp-80081014-ttl.yaml",
+		"clusterrolebinding-myapp-80081014-ttl.yaml",
+		"cronjob-ops-myapp-80081014-ttl.yaml",
+	}, names)
+
+	data, err := os.ReadFile(filepath.Join(dir, "cronjob-ops-myapp-80081014-ttl.yaml"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "---\napiVersion: batch/v1\nkind: CronJob\n"))
+
+	t.Run("directory cannot be created", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(file, nil, 0o644))
+
+		_, err := WriteManifests(filepath.Join(file, "ttl"), testManifests(t))
+		assert.ErrorContains(t, err, "failed to create")
+	})
+
+	t.Run("file cannot be written", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "serviceaccount-ops-myapp-80081014-ttl.yaml"), 0o755))
+
+		paths, err := WriteManifests(dir, testManifests(t))
+		assert.ErrorContains(t, err, "failed to write")
+		assert.Empty(t, paths)
+	})
+
+	t.Run("marshal error", func(t *testing.T) {
+		_, err := WriteManifests(t.TempDir(), []runtime.Object{&unmarshalable{}})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,273 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"helm.sh/helm/v3/pkg/action"
+)
+
+// ExtendResult reports the outcome of extending one TTL.
+type ExtendResult struct {
+	ReleaseName      string `json:"release_name" yaml:"release_name"`
+	ReleaseNamespace string `json:"release_namespace" yaml:"release_namespace"`
+	OldExpiry        string `json:"old_expiry,omitempty" yaml:"old_expiry,omitempty"`
+	NewExpiry        string `json:"new_expiry,omitempty" yaml:"new_expiry,omitempty"`
+	// Error is set when this TTL could not be extended.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// DurationSeconds is how long extending this TTL took; set by
+	// ExtendTTLs.
+	DurationSeconds float64 `json:"duration_seconds,omitempty" yaml:"duration_seconds,omitempty"`
+	// Warnings lists what was skipped to extend the TTL, such as a policy
+	// that could not be read.
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// ExtendTTLOptions contains the parameters for extending the TTL of a
+// release.
+type ExtendTTLOptions struct {
+	ReleaseName      string
+	ReleaseNamespace string
+	CronjobNamespace string
+	By               time.Duration
+	// ExpectedGeneration, when set, makes ExtendTTL fail with a
+	// ConflictError unless the TTL is at this generation.
+	ExpectedGeneration *int64
+}
+
+// ExtendTTL pushes the expiry of a release's TTL out by the given
+// duration. A TTL whose date has already passed is extended from now.
+func ExtendTTL(ctx context.Context, client kubernetes.Interface, opts ExtendTTLOptions) (*ExtendResult, error) {
+	releaseName, releaseNamespace, cronjobNamespace, by := opts.ReleaseName, opts.ReleaseNamespace, opts.CronjobNamespace, opts.By
+	if by <= 0 {
+		return nil, fmt.Errorf("extension must be positive, got %s", by)
+	}
+
+	cj, err := findCronJob(ctx, client, releaseName, releaseNamespace, cronjobNamespace)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, &TTLNotFoundError{Name: releaseName}
+		}
+
+		return nil, fmt.Errorf("failed to get CronJob: %w", err)
+	}
+
+	if err := checkGeneration(releaseName, opts.ExpectedGeneration, cronJobGeneration(cj)); err != nil {
+		return nil, err
+	}
+
+	pol, policyWarning, err := loadPolicy(ctx, client, releaseNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// A concurrent extend or set makes the update conflict; extend the
+	// latest expiry again unless the caller expects a generation
+	var (
+		now                  time.Time
+		oldExpiry, newExpiry time.Time
+		updated              *batchv1.CronJob
+	)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var err error
+		now = time.Now()
+		oldExpiry, _, err = resolveExpiry(cj, now)
+		if err != nil {
+			return fmt.Errorf("failed to parse CronJob schedule: %w", err)
+		}
+
+		base := oldExpiry
+		if base.Before(now) {
+			base = now
+		}
+
+		newExpiry = base.Add(by)
+		logger.Debug("extending TTL", "release", releaseName, "by", by, "oldExpiry", oldExpiry, "newExpiry", newExpiry)
+		if newExpiry.Sub(now) > maxTTLDuration {
+			return fmt.Errorf("TTL exceeds maximum of ~11 months")
+		}
+
+		if err := pol.Check(newExpiry, now); err != nil {
+			return err
+		}
+
+		current := cronJobGeneration(cj)
+		cj.Spec.Schedule = TimeToCronSchedule(newExpiry)
+		setExpiry(cj, newExpiry)
+		setGeneration(cj, current+1)
+		// An abort of the old expiry does not cancel the new one
+		delete(cj.Annotations, AnnotationAbort)
+		updated, err = client.BatchV1().CronJobs(cronjobNamespace).Update(ctx, cj, metav1.UpdateOptions{FieldManager: FieldManager})
+		if errors.IsConflict(err) {
+			if opts.ExpectedGeneration != nil {
+				return serverConflict(ctx, client, releaseName, cronjobNamespace, cj.Name, current)
+			}
+
+			latest, getErr := client.BatchV1().CronJobs(cronjobNamespace).Get(ctx, cj.Name, metav1.GetOptions{})
+			if getErr != nil {
+				if errors.IsNotFound(getErr) {
+					return &TTLNotFoundError{Name: releaseName}
+				}
+
+				return fmt.Errorf("failed to get CronJob: %w", getErr)
+			}
+			cj = latest
+
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update CronJob: %w", err)
+		}
+
+		return nil
+	})
+	if errors.IsConflict(err) {
+		return nil, fmt.Errorf("failed to update CronJob: still conflicting after %d attempts: %w", retry.DefaultRetry.Steps, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the release annotations current (best effort)
+	_ = annotateReleaseStorage(ctx, client, cronJobDriver(updated), releaseName, releaseNamespace, updated.Namespace+"/"+updated.Name, newExpiry)
+
+	result := &ExtendResult{
+		ReleaseName:      releaseName,
+		ReleaseNamespace: releaseNamespace,
+		OldExpiry:        FormatScheduledDate(oldExpiry),
+		NewExpiry:        cronJobExpiry(cj.Spec.Schedule, now),
+		Warnings:         warnings(policyWarning),
+	}
+
+	// Record history (best effort)
+	_ = RecordHistory(ctx, client, releaseName, releaseNamespace, cronjobNamespace, HistoryEntry{
+		Operation: OperationExtend,
+		OldExpiry: result.OldExpiry,
+		NewExpiry: result.NewExpiry,
+	})
+	_ = recordEvent(ctx, client, updated, corev1.EventTypeNormal, EventReasonTTLExtended,
+		fmt.Sprintf("TTL for release %q in namespace %q extended by %s: uninstall at %s", releaseName, releaseNamespace, FormatRemaining(by), result.NewExpiry))
+
+	return result, nil
+}
+
+// ExtendTTLsOptions selects the TTLs extended by ExtendTTLs.
+type ExtendTTLsOptions struct {
+	ReleaseNamespace string
+	CronjobNamespace string
+	// Selector is a label selector matched against the release labels
+	// (helm install --labels). Empty matches every release with a TTL.
+	Selector string
+	By       time.Duration
+}
+
+// ExtendTTLs extends every TTL in a namespace whose release matches the
+// selector. A failure on one release is reported in its result and does
+// not stop the others.
+func ExtendTTLs(ctx context.Context, cfg *action.Configuration, client kubernetes.Interface, opts ExtendTTLsOptions) ([]ExtendResult, error) {
+	selector, err := labels.Parse(opts.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", opts.Selector, err)
+	}
+
+	// The permission checks of ListTTLs are not needed to extend
+	ttls, err := listTTLs(ctx, client, opts.CronjobNamespace, opts.ReleaseNamespace, false)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []ExtendResult{}
+	for _, info := range ttls {
+		if !selector.Empty() {
+			rel, err := cfg.Releases.Last(info.ReleaseName)
+			if err != nil || !selector.Matches(labels.Set(rel.Labels)) {
+				continue
+			}
+		}
+
+		started := time.Now()
+		result, err := ExtendTTL(ctx, client, ExtendTTLOptions{
+			ReleaseName:      info.ReleaseName,
+			ReleaseNamespace: info.ReleaseNamespace,
+			CronjobNamespace: opts.CronjobNamespace,
+			By:               opts.By,
+		})
+		if err != nil {
+			result = &ExtendResult{
+				ReleaseName:      info.ReleaseName,
+				ReleaseNamespace: info.ReleaseNamespace,
+				OldExpiry:        info.ScheduledDate,
+				Error:            err.Error(),
+			}
+		}
+
+		result.DurationSeconds = time.Since(started).Seconds()
+		results = append(results, *result)
+	}
+
+	return results, nil
+}
+
+// ListTTLs returns the release TTLs whose CronJobs live in
+// cronjobNamespace, sorted by release name, with warnings for those whose ServiceAccount or
+// RBAC is missing. A non-empty releaseNamespace limits them to releases
+// in that namespace.
+func ListTTLs(ctx context.Context, client kubernetes.Interface, cronjobNamespace, releaseNamespace string) ([]TTLInfo, error) {
+	return listTTLs(ctx, client, cronjobNamespace, releaseNamespace, true)
+}
+
+// listTTLs is ListTTLs, checking the ServiceAccount and RBAC of each TTL
+// only with checkPermissions.
+func listTTLs(ctx context.Context, client kubernetes.Interface, cronjobNamespace, releaseNamespace string, checkPermissions bool) ([]TTLInfo, error) {
+	selector := labels.Set{LabelManagedBy: LabelManagedByValue}
+	if releaseNamespace != "" {
+		selector[LabelReleaseNamespace] = LabelValue(releaseNamespace)
+	}
+
+	cronJobs, err := client.BatchV1().CronJobs(cronjobNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CronJobs: %w", err)
+	}
+
+	now := time.Now()
+	ttls := []TTLInfo{}
+	for i := range cronJobs.Items {
+		cj := &cronJobs.Items[i]
+		if IsNamespaceTTL(cj) {
+			continue
+		}
+
+		info, err := CronJobInfo(cj, now)
+		if err != nil {
+			// Not a schedule helm-ttl wrote; skip it
+			continue
+		}
+
+		if checkPermissions {
+			info.Warnings = append(info.Warnings, permissionWarnings(ctx, client, cj, info.ReleaseNamespace)...)
+		}
+		ttls = append(ttls, *info)
+	}
+
+	sort.Slice(ttls, func(i, j int) bool {
+		if ttls[i].ReleaseName != ttls[j].ReleaseName {
+			return ttls[i].ReleaseName < ttls[j].ReleaseName
+		}
+
+		return ttls[i].ReleaseNamespace < ttls[j].ReleaseNamespace
+	})
+
+	return ttls, nil
+}
@@ -0,0 +1,487 @@
+package ttl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
+)
+
+// extendTestCronJob returns a TTL CronJob set now that fires at expiry.
+func extendTestCronJob(t *testing.T, releaseName, releaseNamespace string, expiry time.Time) *batchv1.CronJob {
+	t.Helper()
+
+	cj, err := BuildCronJob(CronJobOptions{
+		ReleaseName:      releaseName,
+		ReleaseNamespace: releaseNamespace,
+		CronjobNamespace: releaseNamespace,
+		Schedule:         TimeToCronSchedule(expiry),
+		ServiceAccount:   "default",
+	})
+	require.NoError(t, err)
+	cj.CreationTimestamp = metav1.Now()
+
+	return cj
+}
+
+// setupLabeledReleases stores deployed releases with the given labels.
+func setupLabeledReleases(t *testing.T, namespace string, releases map[string]map[string]string) *action.Configuration {
+	t.Helper()
+
+	store := storage.Init(driver.NewMemory())
+	for name, lbls := range releases {
+		require.NoError(t, store.Create(&release.Release{
+			Name:      name,
+			Namespace: namespace,
+			Version:   1,
+			Labels:    lbls,
+			Info:      &release.Info{Status: release.StatusDeployed},
+			Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "test-chart", Version: "1.0.0"}},
+		}))
+	}
+
+	return &action.Configuration{
+		Releases:   store,
+		KubeClient: &kubefake.PrintingKubeClient{},
+		Log:        func(format string, v ...interface{}) {},
+	}
+}
+
+func scheduledTime(t *testing.T, s string) time.Time {
+	t.Helper()
+
+	parsed, err := time.Parse(time.RFC3339, s)
+	require.NoError(t, err)
+
+	return parsed
+}
+
+func TestExtendTTL(t *testing.T) {
+	extendOpts := func(by time.Duration) ExtendTTLOptions {
+		return ExtendTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", By: by}
+	}
+	ctx := context.Background()
+
+	t.Run("extends from the current expiry", func(t *testing.T) {
+		expiry := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+		client := fake.NewClientset(extendTestCronJob(t, "myapp", "default", expiry))
+
+		result, err := ExtendTTL(ctx, client, extendOpts(7*24*time.Hour))
+		require.NoError(t, err)
+		assert.True(t, expiry.Equal(scheduledTime(t, result.OldExpiry)))
+		assert.True(t, expiry.Add(7*24*time.Hour).Equal(scheduledTime(t, result.NewExpiry)))
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, TimeToCronSchedule(expiry.Add(7*24*time.Hour)), cj.Spec.Schedule)
+		assert.Equal(t, int64(1), cronJobGeneration(cj))
+
+		entries, err := GetHistory(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, OperationExtend, entries[0].Operation)
+		assert.Equal(t, result.OldExpiry, entries[0].OldExpiry)
+		assert.Equal(t, result.NewExpiry, entries[0].NewExpiry)
+	})
+
+	t.Run("updates the expiry guard", func(t *testing.T) {
+		expiry := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+		cj, err := BuildCronJob(CronJobOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Schedule:         TimeToCronSchedule(expiry),
+			ServiceAccount:   "default",
+			CleanupImage:     "helm-ttl-cleanup:v1",
+			ExpiresAt:        expiry,
+		})
+		require.NoError(t, err)
+		client := fake.NewClientset(cj)
+
+		_, err = ExtendTTL(ctx, client, extendOpts(24*time.Hour))
+		require.NoError(t, err)
+
+		cj, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		newExpiry := expiry.Add(24 * time.Hour)
+		assert.Equal(t, FormatScheduledDate(newExpiry.UTC()), cj.Annotations[AnnotationExpiresAt])
+		assert.Equal(t, expiryGuardCmd(newExpiry, true), cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[0].Command)
+	})
+
+	t.Run("missed TTL extends from now", func(t *testing.T) {
+		cj := extendTestCronJob(t, "myapp", "default", time.Now().Add(-2*time.Hour))
+		cj.CreationTimestamp = metav1.NewTime(time.Now().Add(-3 * time.Hour))
+		client := fake.NewClientset(cj)
+
+		before := time.Now()
+		result, err := ExtendTTL(ctx, client, extendOpts(time.Hour))
+		require.NoError(t, err)
+		assert.WithinDuration(t, before.Add(time.Hour), scheduledTime(t, result.NewExpiry), 2*time.Minute)
+	})
+
+	t.Run("exceeds maximum", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "myapp", "default", time.Now().Add(300*24*time.Hour)))
+
+		_, err := ExtendTTL(ctx, client, extendOpts(60*24*time.Hour))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "exceeds maximum")
+	})
+
+	t.Run("exceeds namespace policy", func(t *testing.T) {
+		client := fake.NewClientset(
+			extendTestCronJob(t, "myapp", "default", time.Now().Add(48*time.Hour)),
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: policy.ConfigMapName, Namespace: "default"},
+				Data:       map[string]string{policy.KeyMaxDuration: "3d"},
+			},
+		)
+
+		_, err := ExtendTTL(ctx, client, extendOpts(48*time.Hour))
+		var exceeded *policy.MaxDurationExceededError
+		assert.True(t, errors.As(err, &exceeded))
+	})
+
+	t.Run("invalid namespace policy", func(t *testing.T) {
+		client := fake.NewClientset(
+			extendTestCronJob(t, "myapp", "default", time.Now().Add(48*time.Hour)),
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: policy.ConfigMapName, Namespace: "default"},
+				Data:       map[string]string{policy.KeyMaxDuration: "soon"},
+			},
+		)
+
+		_, err := ExtendTTL(ctx, client, extendOpts(time.Hour))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid maxDuration")
+	})
+
+	t.Run("namespace policy not readable", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "myapp", "default", time.Now().Add(48*time.Hour)))
+		client.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(corev1.Resource("configmaps"), policy.ConfigMapName, fmt.Errorf("denied"))
+		})
+
+		result, err := ExtendTTL(ctx, client, extendOpts(time.Hour))
+		require.NoError(t, err)
+		assert.Len(t, result.Warnings, 1)
+	})
+
+	t.Run("TTL not found", func(t *testing.T) {
+		_, err := ExtendTTL(ctx, fake.NewClientset(), extendOpts(time.Hour))
+		var notFound *TTLNotFoundError
+		assert.True(t, errors.As(err, &notFound))
+	})
+
+	t.Run("non-positive extension", func(t *testing.T) {
+		_, err := ExtendTTL(ctx, fake.NewClientset(), extendOpts(0))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "must be positive")
+	})
+
+	t.Run("invalid schedule", func(t *testing.T) {
+		cj := extendTestCronJob(t, "myapp", "default", time.Now().Add(time.Hour))
+		cj.Spec.Schedule = "@daily"
+		client := fake.NewClientset(cj)
+
+		_, err := ExtendTTL(ctx, client, extendOpts(time.Hour))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to parse CronJob schedule")
+	})
+
+	t.Run("get error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := ExtendTTL(ctx, client, extendOpts(time.Hour))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to get CronJob")
+	})
+
+	t.Run("update error", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "myapp", "default", time.Now().Add(time.Hour)))
+		client.PrependReactor("update", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := ExtendTTL(ctx, client, extendOpts(time.Hour))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to update CronJob")
+	})
+
+	t.Run("stale expected generation", func(t *testing.T) {
+		cj := extendTestCronJob(t, "myapp", "default", time.Now().Add(time.Hour))
+		setGeneration(cj, 2)
+		client := fake.NewClientset(cj)
+
+		opts := extendOpts(time.Hour)
+		expected := int64(1)
+		opts.ExpectedGeneration = &expected
+		_, err := ExtendTTL(ctx, client, opts)
+		var conflict *ConflictError
+		require.True(t, errors.As(err, &conflict))
+		assert.Equal(t, int64(1), conflict.Expected)
+		assert.Equal(t, int64(2), conflict.Actual)
+	})
+
+	// concurrentExtend makes the first update of the CronJob lose a race
+	// with another extend by a day. Reactors run with the fake client
+	// locked, so the other extend writes to its tracker directly.
+	concurrentExtend := func(t *testing.T, client *fake.Clientset) {
+		raced := false
+		client.PrependReactor("update", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			if raced {
+				return false, nil, nil
+			}
+
+			raced = true
+			gvr := batchv1.SchemeGroupVersion.WithResource("cronjobs")
+			obj, err := client.Tracker().Get(gvr, "default", "myapp-4a0c226a-ttl")
+			require.NoError(t, err)
+			other := obj.(*batchv1.CronJob).DeepCopy()
+			expiry, _, err := resolveExpiry(other, time.Now())
+			require.NoError(t, err)
+			other.Spec.Schedule = TimeToCronSchedule(expiry.Add(24 * time.Hour))
+			setExpiry(other, expiry.Add(24*time.Hour))
+			setGeneration(other, cronJobGeneration(other)+1)
+			require.NoError(t, client.Tracker().Update(gvr, other, "default"))
+
+			return true, nil, apierrors.NewConflict(batchv1.Resource("cronjobs"), "myapp-4a0c226a-ttl", errors.New("object was modified"))
+		})
+	}
+
+	t.Run("updated concurrently", func(t *testing.T) {
+		expiry := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+		client := fake.NewClientset(extendTestCronJob(t, "myapp", "default", expiry))
+		concurrentExtend(t, client)
+
+		result, err := ExtendTTL(ctx, client, extendOpts(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, FormatScheduledDate(expiry.Add(24*time.Hour)), result.OldExpiry)
+		assert.Equal(t, FormatScheduledDate(expiry.Add(25*time.Hour)), result.NewExpiry)
+	})
+
+	t.Run("updated concurrently with expected generation", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "myapp", "default", time.Now().Add(48*time.Hour)))
+		concurrentExtend(t, client)
+
+		opts := extendOpts(time.Hour)
+		expected := int64(0)
+		opts.ExpectedGeneration = &expected
+		_, err := ExtendTTL(ctx, client, opts)
+		var conflict *ConflictError
+		require.True(t, errors.As(err, &conflict))
+		assert.Equal(t, int64(1), conflict.Actual)
+	})
+
+	t.Run("keeps conflicting", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, "myapp", "default", time.Now().Add(time.Hour)))
+		client.PrependReactor("update", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewConflict(batchv1.Resource("cronjobs"), "myapp-4a0c226a-ttl", errors.New("object was modified"))
+		})
+
+		_, err := ExtendTTL(ctx, client, extendOpts(time.Hour))
+		assert.ErrorContains(t, err, "still conflicting after 5 attempts")
+	})
+}
+
+func TestExtendTTLs(t *testing.T) {
+	ctx := context.Background()
+	expiry := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+
+	cfg := setupLabeledReleases(t, "default", map[string]map[string]string{
+		"cart":     {"team": "checkout"},
+		"payments": {"team": "checkout"},
+		"search":   {"team": "discovery"},
+	})
+	newClient := func() *fake.Clientset {
+		return fake.NewClientset(
+			extendTestCronJob(t, "cart", "default", expiry),
+			extendTestCronJob(t, "payments", "default", expiry),
+			extendTestCronJob(t, "search", "default", expiry),
+		)
+	}
+
+	t.Run("extends matching releases", func(t *testing.T) {
+		client := newClient()
+
+		results, err := ExtendTTLs(ctx, cfg, client, ExtendTTLsOptions{
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Selector:         "team=checkout",
+			By:               7 * 24 * time.Hour,
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, "cart", results[0].ReleaseName)
+		assert.Equal(t, "payments", results[1].ReleaseName)
+		for _, r := range results {
+			assert.Empty(t, r.Error)
+			assert.True(t, expiry.Add(7*24*time.Hour).Equal(scheduledTime(t, r.NewExpiry)))
+			assert.Positive(t, r.DurationSeconds)
+		}
+
+		search, err := client.BatchV1().CronJobs("default").Get(ctx, "search-81bd4a47-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, TimeToCronSchedule(expiry), search.Spec.Schedule)
+	})
+
+	t.Run("skips the permission checks", func(t *testing.T) {
+		client := newClient()
+
+		_, err := ExtendTTLs(ctx, cfg, client, ExtendTTLsOptions{
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			By:               time.Hour,
+		})
+		require.NoError(t, err)
+		for _, a := range client.Actions() {
+			assert.NotEqual(t, "serviceaccounts", a.GetResource().Resource)
+		}
+	})
+
+	t.Run("empty selector extends everything", func(t *testing.T) {
+		results, err := ExtendTTLs(ctx, cfg, newClient(), ExtendTTLsOptions{
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			By:               time.Hour,
+		})
+		require.NoError(t, err)
+		assert.Len(t, results, 3)
+	})
+
+	t.Run("reports failures per release", func(t *testing.T) {
+		client := newClient()
+		client.PrependReactor("update", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			cj := action.(k8stesting.UpdateAction).GetObject().(*batchv1.CronJob)
+			if cj.Name == "cart-589dfa7a-ttl" {
+				return true, nil, errors.New("forbidden")
+			}
+
+			return false, nil, nil
+		})
+
+		results, err := ExtendTTLs(ctx, cfg, client, ExtendTTLsOptions{
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Selector:         "team=checkout",
+			By:               time.Hour,
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Contains(t, results[0].Error, "failed to update CronJob")
+		assert.Equal(t, FormatScheduledDate(expiry), results[0].OldExpiry)
+		assert.Empty(t, results[0].NewExpiry)
+		assert.Empty(t, results[1].Error)
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		_, err := ExtendTTLs(ctx, cfg, newClient(), ExtendTTLsOptions{Selector: "team in (", By: time.Hour})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid label selector")
+	})
+
+	t.Run("list error", func(t *testing.T) {
+		client := newClient()
+		client.PrependReactor("list", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := ExtendTTLs(ctx, cfg, client, ExtendTTLsOptions{By: time.Hour})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to list CronJobs")
+	})
+}
+
+func TestListTTLs(t *testing.T) {
+	ctx := context.Background()
+	expiry := time.Now().Add(48 * time.Hour)
+
+	other := extendTestCronJob(t, "web", "staging", expiry)
+	other.Namespace = "default"
+	invalid := extendTestCronJob(t, "broken", "default", expiry)
+	invalid.Spec.Schedule = "@daily"
+	unmanaged := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "default"}}
+
+	client := fake.NewClientset(
+		extendTestCronJob(t, "search", "default", expiry),
+		extendTestCronJob(t, "cart", "default", expiry),
+		other, invalid, unmanaged,
+	)
+
+	t.Run("by release namespace", func(t *testing.T) {
+		ttls, err := ListTTLs(ctx, client, "default", "default")
+		require.NoError(t, err)
+		require.Len(t, ttls, 2)
+		assert.Equal(t, "cart", ttls[0].ReleaseName)
+		assert.Equal(t, "search", ttls[1].ReleaseName)
+		assert.Equal(t, "default", ttls[0].CronjobNamespace)
+	})
+
+	t.Run("all release namespaces", func(t *testing.T) {
+		ttls, err := ListTTLs(ctx, client, "default", "")
+		require.NoError(t, err)
+		require.Len(t, ttls, 3)
+		assert.Equal(t, "web", ttls[2].ReleaseName)
+		assert.Equal(t, "staging", ttls[2].ReleaseNamespace)
+	})
+
+	t.Run("warns about missing service accounts", func(t *testing.T) {
+		withSA := fake.NewClientset(
+			extendTestCronJob(t, "cart", "default", expiry),
+			&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}},
+		)
+		ttls, err := ListTTLs(ctx, withSA, "default", "default")
+		require.NoError(t, err)
+		require.Len(t, ttls, 1)
+		assert.Empty(t, ttls[0].Warnings)
+
+		ttls, err = ListTTLs(ctx, client, "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ServiceAccount default not found in namespace default"}, ttls[0].Warnings)
+	})
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90m":     90 * time.Minute,
+		"3d":      72 * time.Hour,
+		"1w":      7 * 24 * time.Hour,
+		"2 weeks": 14 * 24 * time.Hour,
+	}
+	for input, want := range tests {
+		d, err := ParseDuration(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, d, input)
+	}
+
+	for _, input := range []string{"0w", "0d", "-1h", "0 days"} {
+		_, err := ParseDuration(input)
+		assert.Error(t, err, input)
+		assert.Contains(t, err.Error(), "must be positive", input)
+	}
+
+	_, err := ParseDuration("tomorrow")
+	assert.ErrorIs(t, err, errNotADuration)
+}
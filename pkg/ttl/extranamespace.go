@@ -0,0 +1,149 @@
+package ttl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	batchv1 "k8s.io/api/batch/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// AnnotationExtraNamespaces lists, comma-separated, the namespaces outside
+// the release namespace a TTL CronJob was granted access to, so their
+// RBAC is cleaned up with it.
+const AnnotationExtraNamespaces = "helm-ttl/extra-namespaces"
+
+// validateExtraNamespaces checks the namespaces passed with
+// --extra-namespace and returns them sorted and deduplicated.
+func validateExtraNamespaces(namespaces []string, createServiceAccount bool, releaseNamespace, cronjobNamespace string) ([]string, error) {
+	if len(namespaces) == 0 {
+		return nil, nil
+	}
+
+	if !createServiceAccount {
+		return nil, fmt.Errorf("--extra-namespace requires --create-service-account")
+	}
+
+	var valid []string
+	for _, ns := range namespaces {
+		switch ns = strings.TrimSpace(ns); ns {
+		case "":
+			return nil, fmt.Errorf("--extra-namespace cannot be empty")
+		case releaseNamespace:
+			return nil, fmt.Errorf("--extra-namespace %s is the release namespace", ns)
+		case cronjobNamespace:
+			return nil, fmt.Errorf("--extra-namespace %s is the CronJob namespace", ns)
+		}
+
+		valid = append(valid, ns)
+	}
+
+	slices.Sort(valid)
+	return slices.Compact(valid), nil
+}
+
+// manifestNamespaceRules returns, for each of namespaces, the rules letting
+// helm uninstall delete what the release manifest creates there. It fails
+// for a namespace the release has nothing in, which is most likely a typo.
+func manifestNamespaceRules(manifest string, namespaces []string) (map[string][]rbacv1.PolicyRule, error) {
+	if len(namespaces) == 0 {
+		return nil, nil
+	}
+
+	resources := make(map[string][]apiResource, len(namespaces))
+	for _, ns := range namespaces {
+		resources[ns] = nil
+	}
+
+	dec := yaml.NewDecoder(strings.NewReader(manifest))
+	for {
+		var obj struct {
+			APIVersion string `yaml:"apiVersion"`
+			Kind       string `yaml:"kind"`
+			Metadata   struct {
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}
+
+		err := dec.Decode(&obj)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse release manifest: %w", err)
+		}
+
+		found, ok := resources[obj.Metadata.Namespace]
+		if !ok || obj.Kind == "" {
+			continue
+		}
+
+		gv, err := schema.ParseGroupVersion(obj.APIVersion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse release manifest: %w", err)
+		}
+
+		plural, _ := meta.UnsafeGuessKindToResource(gv.WithKind(obj.Kind))
+		r := apiResource{group: plural.Group, resource: plural.Resource}
+		if !slices.Contains(found, r) {
+			resources[obj.Metadata.Namespace] = append(found, r)
+		}
+	}
+
+	rules := make(map[string][]rbacv1.PolicyRule, len(namespaces))
+	for _, ns := range slices.Sorted(maps.Keys(resources)) {
+		if len(resources[ns]) == 0 {
+			return nil, fmt.Errorf("release has no resources in --extra-namespace %s", ns)
+		}
+
+		for _, r := range resources[ns] {
+			rules[ns] = append(rules[ns], rbacv1.PolicyRule{
+				APIGroups: []string{r.group},
+				Resources: []string{r.resource},
+				Verbs:     []string{"get", "list", "watch", "delete"},
+			})
+		}
+	}
+
+	return rules, nil
+}
+
+// extraNamespaceRBAC returns the Role and RoleBinding letting a TTL
+// CronJob uninstall what its release created in namespace. They carry the
+// CronJob namespace label, since neither namespace of the release tells
+// where the CronJob they belong to lives.
+func extraNamespaceRBAC(name, serviceAccountName, namespace, cronjobNamespace string, rules []rbacv1.PolicyRule, labels, annotations map[string]string) (*rbacv1.Role, *rbacv1.RoleBinding) {
+	labels, annotations = maps.Clone(labels), maps.Clone(annotations)
+	labels[LabelCronjobNamespace] = LabelValue(cronjobNamespace)
+	annotations[LabelCronjobNamespace] = cronjobNamespace
+
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Rules: rules,
+	}
+
+	return role, roleBinding(name, namespace, serviceAccountName, cronjobNamespace, labels, annotations)
+}
+
+// cronJobExtraNamespaces returns the namespaces recorded in a TTL
+// CronJob's helm-ttl/extra-namespaces annotation.
+func cronJobExtraNamespaces(cj *batchv1.CronJob) []string {
+	if cj == nil || cj.Annotations[AnnotationExtraNamespaces] == "" {
+		return nil
+	}
+
+	return strings.Split(cj.Annotations[AnnotationExtraNamespaces], ",")
+}
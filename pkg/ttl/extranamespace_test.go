@@ -0,0 +1,224 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const spanningManifest = `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: myapp
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myapp-dashboard
+  namespace: monitoring
+---
+apiVersion: monitoring.coreos.com/v1
+kind: ServiceMonitor
+metadata:
+  name: myapp
+  namespace: monitoring
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: myapp-grafana
+  namespace: monitoring
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: allow-myapp
+  namespace: ingress
+`
+
+func TestValidateExtraNamespaces(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces []string
+		createSA   bool
+		want       []string
+		err        string
+	}{
+		{name: "none", want: nil},
+		{name: "sorted and deduplicated", namespaces: []string{"monitoring", " ingress", "monitoring"}, createSA: true, want: []string{"ingress", "monitoring"}},
+		{name: "without service account", namespaces: []string{"monitoring"}, err: "--extra-namespace requires --create-service-account"},
+		{name: "empty", namespaces: []string{" "}, createSA: true, err: "--extra-namespace cannot be empty"},
+		{name: "release namespace", namespaces: []string{"staging"}, createSA: true, err: "--extra-namespace staging is the release namespace"},
+		{name: "cronjob namespace", namespaces: []string{"ops"}, createSA: true, err: "--extra-namespace ops is the CronJob namespace"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateExtraNamespaces(tt.namespaces, tt.createSA, "staging", "ops")
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestManifestNamespaceRules(t *testing.T) {
+	verbs := []string{"get", "list", "watch", "delete"}
+
+	rules, err := manifestNamespaceRules(spanningManifest, []string{"ingress", "monitoring"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]rbacv1.PolicyRule{
+		"ingress": {
+			{APIGroups: []string{"networking.k8s.io"}, Resources: []string{"networkpolicies"}, Verbs: verbs},
+		},
+		"monitoring": {
+			{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: verbs},
+			{APIGroups: []string{"monitoring.coreos.com"}, Resources: []string{"servicemonitors"}, Verbs: verbs},
+		},
+	}, rules)
+
+	t.Run("none", func(t *testing.T) {
+		rules, err := manifestNamespaceRules(spanningManifest, nil)
+		require.NoError(t, err)
+		assert.Nil(t, rules)
+	})
+
+	t.Run("namespace without resources", func(t *testing.T) {
+		_, err := manifestNamespaceRules(spanningManifest, []string{"monitoring", "logging"})
+		assert.EqualError(t, err, "release has no resources in --extra-namespace logging")
+	})
+
+	t.Run("invalid manifest", func(t *testing.T) {
+		_, err := manifestNamespaceRules("kind: [", []string{"monitoring"})
+		assert.ErrorContains(t, err, "failed to parse release manifest")
+	})
+
+	t.Run("invalid apiVersion", func(t *testing.T) {
+		_, err := manifestNamespaceRules("apiVersion: a/b/c\nkind: Widget\nmetadata:\n  namespace: monitoring\n", []string{"monitoring"})
+		assert.ErrorContains(t, err, "failed to parse release manifest")
+	})
+}
+
+func TestCronJobExtraNamespaces(t *testing.T) {
+	assert.Nil(t, cronJobExtraNamespaces(nil))
+	assert.Nil(t, cronJobExtraNamespaces(&batchv1.CronJob{}))
+	assert.Equal(t, []string{"ingress", "monitoring"}, cronJobExtraNamespaces(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{AnnotationExtraNamespaces: "ingress,monitoring"},
+	}}))
+}
+
+func TestSetTTLExtraNamespaces(t *testing.T) {
+	ctx := context.Background()
+
+	options := func() SetTTLOptions {
+		return SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "staging",
+			CronjobNamespace:     "ops",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			ExtraNamespaces:      []string{"monitoring", "ingress"},
+		}
+	}
+
+	cfg, store := setupTestRelease(t, "myapp", "staging")
+	rel, err := store.Last("myapp")
+	require.NoError(t, err)
+	rel.Manifest = spanningManifest
+	require.NoError(t, store.Update(rel))
+
+	client := fake.NewClientset()
+	result, err := SetTTL(ctx, cfg, client, options())
+	require.NoError(t, err)
+
+	cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "ingress,monitoring", cj.Annotations[AnnotationExtraNamespaces])
+
+	role, err := client.RbacV1().Roles("monitoring").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Len(t, role.Rules, 2)
+	ns, name := OwningCronJob(role)
+	assert.Equal(t, "ops", ns)
+	assert.Equal(t, "myapp-80081014-ttl", name)
+
+	binding, err := client.RbacV1().RoleBindings("ingress").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []rbacv1.Subject{{Kind: "ServiceAccount", Name: "myapp-80081014-ttl", Namespace: "ops"}}, binding.Subjects)
+
+	assert.Contains(t, result.RBAC, OrphanedResource{Kind: "Role", Name: "myapp-80081014-ttl", Namespace: "ingress"})
+	assert.Contains(t, result.RBAC, OrphanedResource{Kind: "RoleBinding", Name: "myapp-80081014-ttl", Namespace: "monitoring"})
+
+	t.Run("still in use by its CronJob", func(t *testing.T) {
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"monitoring"}, DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, orphaned)
+	})
+
+	t.Run("dropped namespaces lose their RBAC", func(t *testing.T) {
+		opts := options()
+		opts.ExtraNamespaces = []string{"monitoring"}
+		_, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "monitoring", cj.Annotations[AnnotationExtraNamespaces])
+
+		_, err = client.RbacV1().Roles("ingress").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+		_, err = client.RbacV1().Roles("monitoring").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+	})
+
+	t.Run("unset removes the RBAC", func(t *testing.T) {
+		require.NoError(t, UnsetTTL(ctx, client, "myapp", "staging", "ops"))
+
+		_, err := client.RbacV1().Roles("monitoring").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+		_, err = client.RbacV1().RoleBindings("monitoring").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+	})
+
+	t.Run("export includes the RBAC", func(t *testing.T) {
+		objs, err := ExportTTL(ctx, cfg, fake.NewClientset(), options())
+		require.NoError(t, err)
+
+		var names []string
+		for _, obj := range objs {
+			names = append(names, manifestFileName(obj))
+		}
+		assert.Contains(t, names, "role-ingress-myapp-80081014-ttl.yaml")
+		assert.Contains(t, names, "rolebinding-monitoring-myapp-80081014-ttl.yaml")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		opts := options()
+		opts.CreateServiceAccount = false
+		_, err := SetTTL(ctx, cfg, fake.NewClientset(), opts)
+		assert.EqualError(t, err, "--extra-namespace requires --create-service-account")
+
+		opts = options()
+		opts.ExtraNamespaces = []string{"logging"}
+		_, err = SetTTL(ctx, cfg, fake.NewClientset(), opts)
+		assert.EqualError(t, err, "release has no resources in --extra-namespace logging")
+	})
+}
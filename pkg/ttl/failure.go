@@ -0,0 +1,137 @@
+package ttl
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/josegonzalez/helm-ttl/pkg/notify"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// failureLogLines is how many of the last lines of its output a failing
+// step reports.
+const failureLogLines = 50
+
+// failureReportScript runs its arguments as a command, and when the
+// command fails posts a notify.FailureReport with the tail of its output
+// to the webhook before exiting with the same code. It needs only sh,
+// tee, tail, tr, sed, awk and wget, which the alpine-based helm and
+// kubectl images ship. Control characters are dropped from the logs, and
+// backslashes, quotes and newlines escaped, so the body is valid JSON.
+// The report proxy is only exported once the command has run, so it does
+// not route the command's own requests, and a CA bundle is passed to wget
+// with --ca-certificate, which needs GNU wget.
+var failureReportScript = fmt.Sprintf(`log="/tmp/helm-ttl-$%[1]s.log"
+{ "$@" 2>&1; echo $? >"$log.status"; } | tee "$log"
+code=$(cat "$log.status")
+if [ "$code" -eq 0 ]; then exit 0; fi
+logs=$(tail -n %[3]d "$log" | tr '\t' ' ' | tr -d '\000-\010\013-\037' | sed -e 's/\\/\\\\/g' -e 's/"/\\"/g' | awk '{printf "%%s\\n", $0}')
+body=$(printf '{"release":"%%s","namespace":"%%s","container":"%%s","pod":"%%s","exitCode":%%d,"logs":"%%s"}' "$RELEASE_NAME" "$RELEASE_NAMESPACE" "$%[1]s" "$HOSTNAME" "$code" "$logs")
+if [ -n "$%[4]s" ]; then export http_proxy="$%[4]s" https_proxy="$%[4]s"; fi
+set --
+if [ -n "$%[5]s" ]; then printf '%%s\n' "$%[5]s" >"$log.ca"; set -- --ca-certificate="$log.ca"; fi
+wget -q -O /dev/null -T 10 --header "Content-Type: application/json" --post-data "$body" "$@" "$%[2]s" || echo "failed to report the failure to the webhook" >&2
+exit "$code"`, notify.FailureContainerEnv, notify.FailureWebhookEnv, failureLogLines, notify.FailureProxyEnv, notify.FailureCABundleEnv)
+
+// validateFailureWebhook checks the URL passed with --on-failure-webhook.
+func validateFailureWebhook(webhook string) error {
+	if webhook == "" {
+		return nil
+	}
+
+	u, err := url.Parse(webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid --on-failure-webhook %q: use an http or https URL", webhook)
+	}
+
+	return nil
+}
+
+// validateFailureTransport checks the proxy and CA bundle failure
+// reports are sent with, which only apply with a webhook.
+func validateFailureTransport(opts CronJobOptions) error {
+	if opts.OnFailureWebhook == "" {
+		if opts.OnFailureWebhookProxy != "" {
+			return fmt.Errorf("--on-failure-webhook-proxy requires --on-failure-webhook")
+		}
+		if len(opts.OnFailureWebhookCA) > 0 {
+			return fmt.Errorf("--on-failure-webhook-ca-file requires --on-failure-webhook")
+		}
+
+		return nil
+	}
+
+	if opts.OnFailureWebhookProxy != "" {
+		u, err := url.Parse(opts.OnFailureWebhookProxy)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid --on-failure-webhook-proxy %q: use an http or https URL", opts.OnFailureWebhookProxy)
+		}
+	}
+
+	if len(opts.OnFailureWebhookCA) > 0 && !x509.NewCertPool().AppendCertsFromPEM(opts.OnFailureWebhookCA) {
+		return fmt.Errorf("no valid PEM certificates found in the --on-failure-webhook-ca-file")
+	}
+
+	return nil
+}
+
+// reportFailures makes each container of an uninstall Job report its
+// failure to the webhook of opts, through its proxy and trusting its CA
+// bundle when set. The helm-ttl-cleanup binary reports by itself when it
+// finds the webhook in its environment; other commands are wrapped in
+// failureReportScript. Each failed attempt of a retried Job is reported.
+func reportFailures(spec *corev1.PodSpec, opts CronJobOptions) {
+	for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+		for i := range containers {
+			c := &containers[i]
+			envs := []corev1.EnvVar{
+				{Name: notify.FailureWebhookEnv, Value: opts.OnFailureWebhook},
+				{Name: notify.FailureContainerEnv, Value: c.Name},
+				{Name: "RELEASE_NAME", Value: opts.ReleaseName},
+				{Name: "RELEASE_NAMESPACE", Value: opts.ReleaseNamespace},
+			}
+			if opts.OnFailureWebhookProxy != "" {
+				envs = append(envs, corev1.EnvVar{Name: notify.FailureProxyEnv, Value: opts.OnFailureWebhookProxy})
+			}
+			if len(opts.OnFailureWebhookCA) > 0 {
+				envs = append(envs, corev1.EnvVar{Name: notify.FailureCABundleEnv, Value: string(opts.OnFailureWebhookCA)})
+			}
+
+			for _, env := range envs {
+				if !slices.ContainsFunc(c.Env, func(e corev1.EnvVar) bool { return e.Name == env.Name }) {
+					c.Env = append(c.Env, env)
+				}
+			}
+
+			wrapFailureReport(c)
+		}
+	}
+}
+
+// wrapFailureReport wraps the command of a container reporting its
+// failures in failureReportScript, unless it runs helm-ttl-cleanup.
+func wrapFailureReport(c *corev1.Container) {
+	if len(c.Command) == 0 || c.Command[0] == cleanupBinary {
+		return
+	}
+
+	c.Command = append([]string{"sh", "-c", failureReportScript, "sh"}, c.Command...)
+}
+
+// reportsFailures reports whether a container reports its failures to a
+// webhook.
+func reportsFailures(c corev1.Container) bool {
+	return slices.ContainsFunc(c.Env, func(e corev1.EnvVar) bool { return e.Name == notify.FailureWebhookEnv })
+}
+
+// unwrappedCommand returns the command of a container without
+// failureReportScript.
+func unwrappedCommand(c corev1.Container) []string {
+	if len(c.Command) > 4 && c.Command[0] == "sh" && c.Command[2] == failureReportScript {
+		return c.Command[4:]
+	}
+
+	return c.Command
+}
@@ -0,0 +1,224 @@
+package ttl
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateFailureWebhook(t *testing.T) {
+	for _, webhook := range []string{"", "https://hooks.example.com/ttl", "http://alerts.monitoring.svc:8080/"} {
+		assert.NoError(t, validateFailureWebhook(webhook), webhook)
+	}
+
+	for _, webhook := range []string{"hooks.example.com", "ftp://hooks.example.com", "https://", "http://[::1"} {
+		assert.EqualError(t, validateFailureWebhook(webhook), `invalid --on-failure-webhook "`+webhook+`": use an http or https URL`)
+	}
+}
+
+func TestBuildCronJob_OnFailureWebhook(t *testing.T) {
+	opts := CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "staging",
+		CronjobNamespace: "ops",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		DeleteNamespace:  true,
+		PostDelete:       PostDeleteOptions{Commands: []string{"kubectl delete secret leftover"}},
+		ExpiresAt:        time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC),
+		OnFailureWebhook: "https://hooks.example.com/ttl",
+	}
+
+	env := func(name string) []corev1.EnvVar {
+		return []corev1.EnvVar{
+			{Name: notify.FailureWebhookEnv, Value: "https://hooks.example.com/ttl"},
+			{Name: notify.FailureContainerEnv, Value: name},
+			{Name: "RELEASE_NAME", Value: "myapp"},
+			{Name: "RELEASE_NAMESPACE", Value: "staging"},
+		}
+	}
+
+	t.Run("kubectl image", func(t *testing.T) {
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		spec := cj.Spec.JobTemplate.Spec.Template.Spec
+		containers := append(spec.InitContainers, spec.Containers...)
+		require.Len(t, containers, 6)
+		for _, c := range containers {
+			assert.Equal(t, []string{"sh", "-c", failureReportScript, "sh"}, c.Command[:4], c.Name)
+			for _, e := range env(c.Name) {
+				assert.Contains(t, c.Env, e, c.Name)
+			}
+		}
+
+		assert.Equal(t, []string{"helm", "uninstall", "myapp", "--namespace", "staging"}, uninstallArgs(unwrappedCommand(containers[1])))
+		assert.Equal(t, []string{"sh", "-c", "kubectl delete secret leftover"}, unwrappedCommand(containers[3]))
+
+		// Post-delete commands already set the release variables
+		names := map[string]int{}
+		for _, e := range containers[3].Env {
+			names[e.Name]++
+		}
+		assert.Equal(t, 1, names["RELEASE_NAME"])
+	})
+
+	t.Run("cleanup image reports by itself", func(t *testing.T) {
+		o := opts
+		o.CleanupImage = "ghcr.io/josegonzalez/helm-ttl-cleanup:latest"
+		cj, err := BuildCronJob(o)
+		require.NoError(t, err)
+
+		spec := cj.Spec.JobTemplate.Spec.Template.Spec
+		assert.Equal(t, cleanupBinary, spec.InitContainers[0].Command[0])
+		assert.Equal(t, env(expiryGuardContainer), spec.InitContainers[0].Env[:4])
+		assert.Equal(t, cleanupBinary, spec.Containers[0].Command[0])
+		assert.Equal(t, "sh", spec.InitContainers[1].Command[0])
+	})
+
+	t.Run("proxy and CA bundle", func(t *testing.T) {
+		o := opts
+		o.OnFailureWebhookProxy = "http://proxy.example.com:3128"
+		o.OnFailureWebhookCA = testCABundle(t)
+		cj, err := BuildCronJob(o)
+		require.NoError(t, err)
+
+		spec := cj.Spec.JobTemplate.Spec.Template.Spec
+		for _, c := range append(spec.InitContainers, spec.Containers...) {
+			assert.Contains(t, c.Env, corev1.EnvVar{Name: notify.FailureProxyEnv, Value: "http://proxy.example.com:3128"}, c.Name)
+			assert.Contains(t, c.Env, corev1.EnvVar{Name: notify.FailureCABundleEnv, Value: string(o.OnFailureWebhookCA)}, c.Name)
+			for _, e := range c.Env {
+				assert.NotEqual(t, "HTTPS_PROXY", e.Name, c.Name)
+			}
+		}
+	})
+
+	t.Run("invalid proxy and CA bundle", func(t *testing.T) {
+		o := opts
+		o.OnFailureWebhookProxy = "proxy.example.com:3128"
+		_, err := BuildCronJob(o)
+		assert.EqualError(t, err, `invalid --on-failure-webhook-proxy "proxy.example.com:3128": use an http or https URL`)
+
+		o = opts
+		o.OnFailureWebhookCA = []byte("not a certificate")
+		_, err = BuildCronJob(o)
+		assert.EqualError(t, err, "no valid PEM certificates found in the --on-failure-webhook-ca-file")
+
+		o = opts
+		o.OnFailureWebhook = ""
+		o.OnFailureWebhookProxy = "http://proxy.example.com:3128"
+		_, err = BuildCronJob(o)
+		assert.EqualError(t, err, "--on-failure-webhook-proxy requires --on-failure-webhook")
+	})
+
+	t.Run("without webhook", func(t *testing.T) {
+		o := opts
+		o.OnFailureWebhook = ""
+		cj, err := BuildCronJob(o)
+		require.NoError(t, err)
+
+		for _, c := range cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers {
+			assert.False(t, reportsFailures(c), c.Name)
+			assert.Equal(t, c.Command, unwrappedCommand(c), c.Name)
+		}
+	})
+
+	t.Run("invalid webhook", func(t *testing.T) {
+		o := opts
+		o.OnFailureWebhook = "hooks.example.com"
+		_, err := BuildCronJob(o)
+		assert.EqualError(t, err, `invalid --on-failure-webhook "hooks.example.com": use an http or https URL`)
+	})
+
+	t.Run("extending keeps the guard reporting", func(t *testing.T) {
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		extended := opts.ExpiresAt.Add(48 * time.Hour)
+		setExpiry(cj, extended)
+
+		guard := cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[0]
+		assert.Equal(t, []string{"sh", "-c", failureReportScript, "sh"}, guard.Command[:4])
+		assert.Equal(t, expiryGuardCmd(extended, false), unwrappedCommand(guard))
+	})
+
+	t.Run("dry run shows the uninstall command", func(t *testing.T) {
+		o := opts
+		o.ReleaseNamespace, o.CronjobNamespace, o.DeleteNamespace = "default", "default", false
+		cj, err := BuildCronJob(o)
+		require.NoError(t, err)
+
+		client := fake.NewClientset(cj)
+		result, err := RunTTL(context.Background(), client, io.Discard, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", DryRun: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"helm", "uninstall", "myapp", "--namespace", "default"}, result.UninstallCommand)
+	})
+}
+
+// testCABundle returns a PEM certificate to trust.
+func testCABundle(t *testing.T) []byte {
+	t.Helper()
+
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+}
+
+func TestFailureReportScript(t *testing.T) {
+	// A stand-in wget recording its arguments and proxy
+	bin := t.TempDir()
+	out := filepath.Join(bin, "wget.out")
+	wget := "#!/bin/sh\necho \"proxy=$https_proxy\" >" + out + "\nfor a in \"$@\"; do echo \"$a\" >>" + out + "; done\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "wget"), []byte(wget), 0o755))
+
+	container := "report-test-" + filepath.Base(bin)
+	t.Cleanup(func() {
+		for _, suffix := range []string{"", ".status", ".ca"} {
+			_ = os.Remove("/tmp/helm-ttl-" + container + ".log" + suffix)
+		}
+	})
+
+	ca := testCABundle(t)
+	cmd := exec.Command("sh", "-c", failureReportScript, "sh", "sh", "-c", `echo "step proxy=$https_proxy"; exit 3`)
+	cmd.Env = append(os.Environ(),
+		"PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"),
+		notify.FailureWebhookEnv+"=https://hooks.example.com/ttl",
+		notify.FailureContainerEnv+"="+container,
+		notify.FailureProxyEnv+"=http://proxy.example.com:3128",
+		notify.FailureCABundleEnv+"="+string(ca),
+		"https_proxy=",
+	)
+	output, err := cmd.Output()
+
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode())
+	assert.Equal(t, "step proxy=\n", string(output))
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	args := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, "proxy=http://proxy.example.com:3128", args[0])
+	assert.Equal(t, "https://hooks.example.com/ttl", args[len(args)-1])
+
+	caArg := args[len(args)-2]
+	require.True(t, strings.HasPrefix(caArg, "--ca-certificate="), caArg)
+	written, err := os.ReadFile(strings.TrimPrefix(caArg, "--ca-certificate="))
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(string(ca)), strings.TrimSpace(string(written)))
+}
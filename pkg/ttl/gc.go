@@ -0,0 +1,252 @@
+package ttl
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Categories of resources GarbageCollect sweeps.
+const (
+	// GCStaleCronJobs are TTL CronJobs whose release or namespace is gone.
+	GCStaleCronJobs = "stale-cronjobs"
+	// GCStuckCronJobs are TTL CronJobs whose expiry passed long ago
+	// without them firing or finishing the uninstall.
+	GCStuckCronJobs = "stuck-cronjobs"
+	// GCRunJobs are the finished Jobs of helm ttl run invocations that
+	// were interrupted before removing them.
+	GCRunJobs = "run-jobs"
+	// GCOrphanedRBAC are ServiceAccounts and RBAC resources whose CronJob
+	// is gone or swept.
+	GCOrphanedRBAC = "orphaned-rbac"
+)
+
+// GCCategories are the categories of GarbageCollect, in the order they are
+// swept. CronJobs go first, so the RBAC of those swept is found in the
+// same run.
+var GCCategories = []string{GCStaleCronJobs, GCStuckCronJobs, GCRunJobs, GCOrphanedRBAC}
+
+// DefaultStuckAfter is how long past its expiry a CronJob must be to count
+// as stuck. It leaves room for the default starting deadline of a day and
+// the Job itself.
+const DefaultStuckAfter = 48 * time.Hour
+
+// GCOptions selects what GarbageCollect sweeps.
+type GCOptions struct {
+	CleanupOrphanedOptions
+	// Categories are the GCCategories to sweep; empty sweeps them all.
+	Categories []string
+	// StuckAfter is how long past its expiry a CronJob must be for
+	// GCStuckCronJobs; it defaults to DefaultStuckAfter.
+	StuckAfter time.Duration
+}
+
+// GCResult is what GarbageCollect deleted, or would delete with DryRun, by
+// category.
+type GCResult struct {
+	DryRun     bool               `json:"dry_run" yaml:"dry_run"`
+	Categories []GCCategoryResult `json:"categories" yaml:"categories"`
+}
+
+// GCCategoryResult is what GarbageCollect found in one of GCCategories.
+type GCCategoryResult struct {
+	Category  string             `json:"category" yaml:"category"`
+	Resources []OrphanedResource `json:"resources" yaml:"resources"`
+}
+
+// Resources returns the resources of every category, in the order they
+// were swept.
+func (r *GCResult) Resources() []OrphanedResource {
+	var resources []OrphanedResource
+	for _, c := range r.Categories {
+		resources = append(resources, c.Resources...)
+	}
+
+	return resources
+}
+
+// GarbageCollect sweeps the helm-ttl resources nothing will clean up:
+// CronJobs whose release is gone, CronJobs stuck past their expiry, the
+// Jobs left behind by interrupted helm ttl run invocations, and the
+// ServiceAccounts and RBAC of CronJobs that are gone. A stuck CronJob is
+// deleted without uninstalling its release, and resources of a TTL whose
+// Job is still running are left alone.
+//
+// Like CleanupOrphaned, namespaces are swept opts.Concurrency at a time
+// and a namespace that fails does not stop the others: what was found is
+// returned with the errors of every failed namespace joined.
+func GarbageCollect(ctx context.Context, client kubernetes.Interface, opts GCOptions) (*GCResult, error) {
+	labelSelector := fmt.Sprintf("%s=%s", LabelManagedBy, LabelManagedByValue)
+	if opts.Selector != "" {
+		if _, err := labels.Parse(opts.Selector); err != nil {
+			return nil, fmt.Errorf("invalid label selector %q: %w", opts.Selector, err)
+		}
+
+		labelSelector += "," + opts.Selector
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 0 {
+		return nil, fmt.Errorf("invalid concurrency %d: must not be negative", concurrency)
+	}
+	if concurrency == 0 {
+		concurrency = DefaultCleanupConcurrency
+	}
+
+	if opts.OlderThan < 0 {
+		return nil, fmt.Errorf("invalid age %s: must not be negative", opts.OlderThan)
+	}
+
+	stuckAfter := opts.StuckAfter
+	if stuckAfter < 0 {
+		return nil, fmt.Errorf("invalid stuck age %s: must not be negative", stuckAfter)
+	}
+	if stuckAfter == 0 {
+		stuckAfter = DefaultStuckAfter
+	}
+
+	categories := opts.Categories
+	if len(categories) == 0 {
+		categories = GCCategories
+	}
+	for _, category := range categories {
+		if !slices.Contains(GCCategories, category) {
+			return nil, fmt.Errorf("unknown category %q: use %s", category, strings.Join(GCCategories, ", "))
+		}
+	}
+
+	now := time.Now()
+	o := &orphanSweep{client: client, selector: labelSelector, stale: make(map[string]bool), dryRun: opts.DryRun}
+	if opts.OlderThan > 0 {
+		o.cutoff = now.Add(-opts.OlderThan)
+	}
+
+	namespaces := opts.Namespaces
+	if opts.AllNamespaces {
+		nsList, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list namespaces: %w", err)
+		}
+
+		namespaces = make([]string, 0, len(nsList.Items))
+		for _, ns := range nsList.Items {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+
+	result := &GCResult{DryRun: opts.DryRun}
+	var errs []error
+	for _, category := range GCCategories {
+		if !slices.Contains(categories, category) {
+			continue
+		}
+
+		var sweeps []sweep
+		switch category {
+		case GCStaleCronJobs:
+			sweeps = sweepNamespaces(namespaces, concurrency, func(ns string) sweep {
+				return o.cronJobs(ctx, ns, func(cj *batchv1.CronJob) bool {
+					return releaseGone(ctx, client, cj) || namespaceGone(ctx, client, cj)
+				})
+			})
+		case GCStuckCronJobs:
+			sweeps = sweepNamespaces(namespaces, concurrency, func(ns string) sweep {
+				return o.cronJobs(ctx, ns, func(cj *batchv1.CronJob) bool {
+					expiry, missed, err := resolveExpiry(cj, now)
+					return err == nil && missed && expiry.Before(now.Add(-stuckAfter))
+				})
+			})
+		case GCRunJobs:
+			sweeps = sweepNamespaces(namespaces, concurrency, func(ns string) sweep {
+				return o.runJobs(ctx, ns)
+			})
+		case GCOrphanedRBAC:
+			sweeps = append([]sweep{o.clusterRBAC(ctx)}, sweepNamespaces(namespaces, concurrency, func(ns string) sweep {
+				return o.namespacedRBAC(ctx, ns)
+			})...)
+		}
+
+		found := GCCategoryResult{Category: category, Resources: []OrphanedResource{}}
+		for _, s := range sweeps {
+			for _, key := range s.stale {
+				o.stale[key] = true
+			}
+			found.Resources = append(found.Resources, s.orphaned...)
+			if s.err != nil {
+				errs = append(errs, s.err)
+			}
+		}
+		result.Categories = append(result.Categories, found)
+	}
+
+	return result, stderrors.Join(errs...)
+}
+
+// runJobs finds, and unless dryRun deletes, the finished Jobs of helm ttl
+// run in ns. A Job still running is left to finish the uninstall.
+func (o *orphanSweep) runJobs(ctx context.Context, ns string) (s sweep) {
+	client := o.client
+	jobs, err := client.BatchV1().Jobs(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: o.selector + "," + LabelTriggeredBy + "=run",
+	})
+	if err != nil {
+		s.err = fmt.Errorf("failed to list Jobs in %s: %w", ns, err)
+		return s
+	}
+
+	// Background propagation removes the Job at once, and its pod after
+	background := metav1.DeletePropagationBackground
+	for _, job := range jobs.Items {
+		if o.recent(&job) || !jobFinished(&job) {
+			continue
+		}
+
+		s.orphaned = append(s.orphaned, OrphanedResource{Kind: "Job", Name: job.Name, Namespace: ns})
+		if !o.dryRun {
+			if err := client.BatchV1().Jobs(ns).Delete(ctx, job.Name, metav1.DeleteOptions{PropagationPolicy: &background}); err != nil && !errors.IsNotFound(err) {
+				s.err = fmt.Errorf("failed to delete Job %s in %s: %w", job.Name, ns, err)
+				return s
+			}
+		}
+	}
+
+	return s
+}
+
+// FormatGCResult formats the result of GarbageCollect, listing what was
+// deleted, or would be with DryRun, under each category swept.
+func FormatGCResult(result *GCResult, format string) (string, error) {
+	if format != "text" {
+		return formatStructured(result, format)
+	}
+
+	verb := "Deleted"
+	if result.DryRun {
+		verb = "Would delete"
+	}
+
+	var buf bytes.Buffer
+	for _, c := range result.Categories {
+		if len(c.Resources) == 0 {
+			_, _ = fmt.Fprintf(&buf, "%s: nothing found\n", c.Category)
+			continue
+		}
+
+		_, _ = fmt.Fprintf(&buf, "%s:\n", c.Category)
+		for _, r := range c.Resources {
+			_, _ = fmt.Fprintf(&buf, "  %s %s\n", verb, r)
+		}
+	}
+
+	return buf.String(), nil
+}
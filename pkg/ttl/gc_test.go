@@ -0,0 +1,183 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// gcObjects returns a TTL of each kind GarbageCollect tells apart, all in
+// namespace default: gone, whose release was uninstalled by hand; stuck,
+// expired three days ago; late, expired an hour ago; and the Jobs of an
+// interrupted helm ttl run of late, one finished and one still running.
+func gcObjects(t *testing.T) []runtime.Object {
+	t.Helper()
+	now := time.Now().Truncate(time.Minute)
+	expiring := func(release string, expiry time.Time) *batchv1.CronJob {
+		cj := buildTestCronJob(t, release, "default", "default", false)
+		cj.Spec.Schedule = TimeToCronSchedule(expiry)
+		cj.Annotations[AnnotationExpiresAt] = expiry.Format(time.RFC3339)
+		return cj
+	}
+	release := func(name string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      "sh.helm.release.v1." + name + ".v1",
+			Namespace: "default",
+			Labels:    map[string]string{"owner": "helm", "name": name, "status": "deployed"},
+		}}
+	}
+
+	late := expiring("late", now.Add(-time.Hour))
+	finished := BuildJobFromCronJob(late, late.Name+"-run")
+	finished.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+	running := BuildJobFromCronJob(late, late.Name+"-run-2")
+
+	return []runtime.Object{
+		expiring("gone", now.Add(time.Hour)),
+		expiring("stuck", now.Add(-72*time.Hour)), release("stuck"),
+		late, release("late"),
+		finished, running,
+	}
+}
+
+func TestGarbageCollect(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("dry run reports each category", func(t *testing.T) {
+		client := fake.NewClientset(gcObjects(t)...)
+
+		result, err := GarbageCollect(ctx, client, GCOptions{
+			CleanupOrphanedOptions: CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true},
+		})
+		require.NoError(t, err)
+		assert.True(t, result.DryRun)
+		assert.Equal(t, []GCCategoryResult{
+			{Category: GCStaleCronJobs, Resources: []OrphanedResource{{Kind: "CronJob", Name: ResourceName("gone", "default"), Namespace: "default"}}},
+			{Category: GCStuckCronJobs, Resources: []OrphanedResource{{Kind: "CronJob", Name: ResourceName("stuck", "default"), Namespace: "default"}}},
+			{Category: GCRunJobs, Resources: []OrphanedResource{{Kind: "Job", Name: ResourceName("late", "default") + "-run", Namespace: "default"}}},
+			{Category: GCOrphanedRBAC, Resources: []OrphanedResource{}},
+		}, result.Categories)
+
+		_, err = client.BatchV1().CronJobs("default").Get(ctx, ResourceName("stuck", "default"), metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("deletes what it finds", func(t *testing.T) {
+		client := fake.NewClientset(gcObjects(t)...)
+
+		result, err := GarbageCollect(ctx, client, GCOptions{
+			CleanupOrphanedOptions: CleanupOrphanedOptions{Namespaces: []string{"default"}},
+		})
+		require.NoError(t, err)
+		assert.Len(t, result.Resources(), 3)
+
+		cronJobs, err := client.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, cronJobs.Items, 1)
+		assert.Equal(t, ResourceName("late", "default"), cronJobs.Items[0].Name)
+
+		jobs, err := client.BatchV1().Jobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, jobs.Items, 1)
+		assert.Equal(t, ResourceName("late", "default")+"-run-2", jobs.Items[0].Name)
+	})
+
+	t.Run("sweeps the RBAC of stuck CronJobs", func(t *testing.T) {
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name:      ResourceName("stuck", "default"),
+			Namespace: "default",
+			Labels: map[string]string{
+				LabelManagedBy:        LabelManagedByValue,
+				LabelRelease:          "stuck",
+				LabelReleaseNamespace: "default",
+				LabelCronjobNamespace: "default",
+			},
+		}}
+		client := fake.NewClientset(append(gcObjects(t), sa)...)
+
+		result, err := GarbageCollect(ctx, client, GCOptions{
+			CleanupOrphanedOptions: CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true},
+			Categories:             []string{GCStuckCronJobs, GCOrphanedRBAC},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []OrphanedResource{
+			{Kind: "CronJob", Name: ResourceName("stuck", "default"), Namespace: "default"},
+			{Kind: "ServiceAccount", Name: sa.Name, Namespace: "default"},
+		}, result.Resources())
+	})
+
+	t.Run("stuck after", func(t *testing.T) {
+		// Without the running Job, late is stuck too after half an hour
+		objs := gcObjects(t)
+		client := fake.NewClientset(objs[:len(objs)-1]...)
+
+		result, err := GarbageCollect(ctx, client, GCOptions{
+			CleanupOrphanedOptions: CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true},
+			Categories:             []string{GCStuckCronJobs},
+			StuckAfter:             30 * time.Minute,
+		})
+		require.NoError(t, err)
+		require.Len(t, result.Categories, 1)
+		assert.Len(t, result.Categories[0].Resources, 2)
+	})
+
+	t.Run("only the categories asked for", func(t *testing.T) {
+		client := fake.NewClientset(gcObjects(t)...)
+
+		result, err := GarbageCollect(ctx, client, GCOptions{
+			CleanupOrphanedOptions: CleanupOrphanedOptions{Namespaces: []string{"default"}},
+			Categories:             []string{GCRunJobs},
+		})
+		require.NoError(t, err)
+		require.Len(t, result.Categories, 1)
+		assert.Equal(t, GCRunJobs, result.Categories[0].Category)
+
+		_, err = client.BatchV1().CronJobs("default").Get(ctx, ResourceName("gone", "default"), metav1.GetOptions{})
+		assert.NoError(t, err)
+		_, err = client.BatchV1().Jobs("default").Get(ctx, ResourceName("late", "default")+"-run", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		_, err := GarbageCollect(ctx, client, GCOptions{Categories: []string{"pods"}})
+		assert.EqualError(t, err, `unknown category "pods": use stale-cronjobs, stuck-cronjobs, run-jobs, orphaned-rbac`)
+
+		_, err = GarbageCollect(ctx, client, GCOptions{StuckAfter: -time.Hour})
+		assert.EqualError(t, err, "invalid stuck age -1h0m0s: must not be negative")
+	})
+}
+
+func TestFormatGCResult(t *testing.T) {
+	result := &GCResult{
+		DryRun: true,
+		Categories: []GCCategoryResult{
+			{Category: GCStaleCronJobs, Resources: []OrphanedResource{{Kind: "CronJob", Name: "myapp-4a0c226a-ttl", Namespace: "default"}}},
+			{Category: GCOrphanedRBAC, Resources: []OrphanedResource{}},
+		},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := FormatGCResult(result, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "stale-cronjobs:\n  Would delete CronJob myapp-4a0c226a-ttl in namespace default\norphaned-rbac: nothing found\n", out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatGCResult(result, "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"dry_run": true`)
+		assert.Contains(t, out, `"category": "orphaned-rbac"`)
+		assert.Contains(t, out, `"resources": []`)
+	})
+}
@@ -0,0 +1,210 @@
+package ttl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// History operations.
+const (
+	OperationSet    = "set"
+	OperationExtend = "extend"
+	OperationUnset  = "unset"
+	OperationRun    = "run"
+	// OperationExpire is recorded by helm ttl controller when it expires
+	// a TTL of the controller backend.
+	OperationExpire = "expire"
+	// OperationImport is recorded by helm ttl import when it recreates a
+	// TTL from another cluster.
+	OperationImport = "import"
+	// OperationAdopt is recorded by helm ttl adopt when it takes over a
+	// CronJob helm-ttl did not create, or created with other labels.
+	OperationAdopt = "adopt"
+)
+
+const (
+	// historyKey is the ConfigMap data key holding the JSON history.
+	historyKey = "history"
+	// maxHistoryEntries bounds the history kept per release.
+	maxHistoryEntries = 100
+)
+
+// HistoryEntry records one operation on a release's TTL.
+type HistoryEntry struct {
+	Time      string `json:"time" yaml:"time"`
+	Operation string `json:"operation" yaml:"operation"`
+	User      string `json:"user" yaml:"user"`
+	OldExpiry string `json:"old_expiry,omitempty" yaml:"old_expiry,omitempty"`
+	NewExpiry string `json:"new_expiry,omitempty" yaml:"new_expiry,omitempty"`
+}
+
+// HistoryConfigMapName returns the name of the ConfigMap holding a
+// release's TTL history. It outlives the CronJob so unset and fired TTLs
+// keep their trail.
+func HistoryConfigMapName(releaseName, releaseNamespace string) string {
+	return ResourceName(releaseName, releaseNamespace) + "-history"
+}
+
+// historyConfigMap returns a release's history ConfigMap. Like
+// findCronJob, it is looked up by the release labels first, finding
+// ConfigMaps named by older versions, and read by HistoryConfigMapName
+// otherwise. A release without history returns the NotFound error of the
+// read.
+func historyConfigMap(ctx context.Context, configMaps corev1client.ConfigMapInterface, releaseName, releaseNamespace string) (*corev1.ConfigMap, error) {
+	name := HistoryConfigMapName(releaseName, releaseNamespace)
+
+	list, err := configMaps.List(ctx, metav1.ListOptions{LabelSelector: releaseSelector(releaseName, releaseNamespace)})
+	if err == nil {
+		var found *corev1.ConfigMap
+		for i := range list.Items {
+			cm := &list.Items[i]
+			if !strings.HasSuffix(cm.Name, "-history") || !ownedByRelease(cm, releaseName, releaseNamespace) {
+				continue
+			}
+
+			if found == nil || cm.Name == name {
+				found = cm
+			}
+		}
+
+		if found != nil {
+			return found, nil
+		}
+	}
+
+	return configMaps.Get(ctx, name, metav1.GetOptions{})
+}
+
+// GetHistory returns the recorded TTL operations for a release, oldest
+// first. A release without history returns an empty list.
+func GetHistory(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace, cronjobNamespace string) ([]HistoryEntry, error) {
+	cm, err := historyConfigMap(ctx, client.CoreV1().ConfigMaps(cronjobNamespace), releaseName, releaseNamespace)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return []HistoryEntry{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to get history ConfigMap: %w", err)
+	}
+
+	return decodeHistory(cm)
+}
+
+// RecordHistory appends an entry to a release's TTL history, filling in
+// the time and the requesting user when they are empty.
+func RecordHistory(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace, cronjobNamespace string, entry HistoryEntry) error {
+	name := HistoryConfigMapName(releaseName, releaseNamespace)
+
+	if entry.Time == "" {
+		entry.Time = FormatScheduledDate(time.Now())
+	}
+
+	if entry.User == "" {
+		entry.User = currentUser(ctx, client)
+	}
+
+	configMaps := client.CoreV1().ConfigMaps(cronjobNamespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := historyConfigMap(ctx, configMaps, releaseName, releaseNamespace)
+		if errors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   cronjobNamespace,
+					Labels:      releaseLabels(releaseName, releaseNamespace),
+					Annotations: releaseAnnotations(releaseName, releaseNamespace),
+				},
+			}
+
+			if err := encodeHistory(cm, []HistoryEntry{entry}); err != nil {
+				return err
+			}
+
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				// Lost a race with another writer; retry as an update
+				return errors.NewConflict(corev1.Resource("configmaps"), name, err)
+			}
+
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get history ConfigMap: %w", err)
+		}
+
+		entries, err := decodeHistory(cm)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, entry)
+		if len(entries) > maxHistoryEntries {
+			entries = entries[len(entries)-maxHistoryEntries:]
+		}
+
+		if err := encodeHistory(cm, entries); err != nil {
+			return err
+		}
+
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// currentUser returns the username the client authenticates as, or
+// "unknown" when the API server cannot tell.
+func currentUser(ctx context.Context, client kubernetes.Interface) string {
+	review, err := client.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil || review.Status.UserInfo.Username == "" {
+		return "unknown"
+	}
+
+	return review.Status.UserInfo.Username
+}
+
+func decodeHistory(cm *corev1.ConfigMap) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+	if data := cm.Data[historyKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse history ConfigMap %s: %w", cm.Name, err)
+		}
+	}
+
+	return entries, nil
+}
+
+func encodeHistory(cm *corev1.ConfigMap, entries []HistoryEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode history: %w", err)
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[historyKey] = string(data)
+
+	return nil
+}
+
+// cronJobExpiry returns the formatted time a TTL CronJob fires, or "" if
+// its schedule cannot be read.
+func cronJobExpiry(schedule string, setAt time.Time) string {
+	t, _, err := ResolveCronSchedule(schedule, setAt, time.Now())
+	if err != nil {
+		return ""
+	}
+
+	return FormatScheduledDate(t)
+}
@@ -0,0 +1,274 @@
+package ttl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// withUser makes SelfSubjectReviews on the fake client report username.
+func withUser(client *fake.Clientset, username string) {
+	client.PrependReactor("create", "selfsubjectreviews", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &authenticationv1.SelfSubjectReview{
+			Status: authenticationv1.SelfSubjectReviewStatus{
+				UserInfo: authenticationv1.UserInfo{Username: username},
+			},
+		}, nil
+	})
+}
+
+func TestHistoryConfigMapName(t *testing.T) {
+	assert.Equal(t, "myapp-4a0c226a-ttl-history", HistoryConfigMapName("myapp", "default"))
+}
+
+func TestRecordHistory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("creates the ConfigMap", func(t *testing.T) {
+		client := fake.NewClientset()
+		withUser(client, "alice@example.com")
+
+		err := RecordHistory(ctx, client, "myapp", "default", "ops", HistoryEntry{
+			Operation: OperationSet,
+			NewExpiry: "2025-06-15T14:30:00Z",
+		})
+		require.NoError(t, err)
+
+		cm, err := client.CoreV1().ConfigMaps("ops").Get(ctx, "myapp-4a0c226a-ttl-history", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, LabelManagedByValue, cm.Labels[LabelManagedBy])
+		assert.Equal(t, "myapp", cm.Labels[LabelRelease])
+		assert.Equal(t, "default", cm.Labels[LabelReleaseNamespace])
+
+		entries, err := GetHistory(ctx, client, "myapp", "default", "ops")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, OperationSet, entries[0].Operation)
+		assert.Equal(t, "alice@example.com", entries[0].User)
+		assert.Equal(t, "2025-06-15T14:30:00Z", entries[0].NewExpiry)
+		assert.NotEmpty(t, entries[0].Time)
+	})
+
+	t.Run("appends to existing history", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		require.NoError(t, RecordHistory(ctx, client, "myapp", "default", "default", HistoryEntry{Operation: OperationSet}))
+		require.NoError(t, RecordHistory(ctx, client, "myapp", "default", "default", HistoryEntry{Operation: OperationUnset, User: "bob"}))
+
+		entries, err := GetHistory(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, OperationSet, entries[0].Operation)
+		assert.Equal(t, "unknown", entries[0].User)
+		assert.Equal(t, OperationUnset, entries[1].Operation)
+		assert.Equal(t, "bob", entries[1].User)
+	})
+
+	t.Run("keeps the most recent entries", func(t *testing.T) {
+		client := fake.NewClientset()
+		for i := 0; i < maxHistoryEntries+5; i++ {
+			require.NoError(t, RecordHistory(ctx, client, "myapp", "default", "default", HistoryEntry{
+				Operation: OperationRun,
+				User:      fmt.Sprintf("user-%d", i),
+			}))
+		}
+
+		entries, err := GetHistory(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		require.Len(t, entries, maxHistoryEntries)
+		assert.Equal(t, "user-5", entries[0].User)
+		assert.Equal(t, fmt.Sprintf("user-%d", maxHistoryEntries+4), entries[maxHistoryEntries-1].User)
+	})
+
+	t.Run("retries when the ConfigMap is created concurrently", func(t *testing.T) {
+		client := fake.NewClientset()
+		raced := false
+		client.PrependReactor("create", "configmaps", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			if raced {
+				return false, nil, nil
+			}
+
+			raced = true
+			// Another writer creates the ConfigMap first
+			err := client.Tracker().Add(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl-history", Namespace: "default"},
+				Data:       map[string]string{historyKey: `[{"time":"t0","operation":"set","user":"carol"}]`},
+			})
+			require.NoError(t, err)
+
+			return true, nil, apierrors.NewAlreadyExists(corev1.Resource("configmaps"), "myapp-4a0c226a-ttl-history")
+		})
+
+		require.NoError(t, RecordHistory(ctx, client, "myapp", "default", "default", HistoryEntry{Operation: OperationUnset, User: "dave"}))
+
+		entries, err := GetHistory(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "carol", entries[0].User)
+		assert.Equal(t, "dave", entries[1].User)
+	})
+
+	t.Run("get error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "configmaps", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		err := RecordHistory(ctx, client, "myapp", "default", "default", HistoryEntry{Operation: OperationSet, User: "alice"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to get history ConfigMap")
+	})
+
+	t.Run("corrupt history", func(t *testing.T) {
+		client := fake.NewClientset(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl-history", Namespace: "default"},
+			Data:       map[string]string{historyKey: "not json"},
+		})
+
+		err := RecordHistory(ctx, client, "myapp", "default", "default", HistoryEntry{Operation: OperationSet, User: "alice"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to parse history ConfigMap")
+	})
+}
+
+func TestGetHistory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("no history", func(t *testing.T) {
+		entries, err := GetHistory(ctx, fake.NewClientset(), "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.NotNil(t, entries)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "configmaps", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := GetHistory(ctx, client, "myapp", "default", "default")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to get history ConfigMap")
+	})
+
+	t.Run("falls back to the name when listing fails", func(t *testing.T) {
+		client := fake.NewClientset()
+		require.NoError(t, RecordHistory(ctx, client, "myapp", "default", "default", HistoryEntry{Operation: OperationSet, User: "alice"}))
+		client.PrependReactor("list", "configmaps", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		entries, err := GetHistory(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("ignores other ConfigMaps of the release", func(t *testing.T) {
+		client := fake.NewClientset(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:        "myapp-settings",
+			Namespace:   "default",
+			Labels:      releaseLabels("myapp", "default"),
+			Annotations: releaseAnnotations("myapp", "default"),
+		}})
+
+		entries, err := GetHistory(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestCronJobExpiry(t *testing.T) {
+	assert.Equal(t, "", cronJobExpiry("not a schedule", metav1.Now().Time))
+	assert.NotEmpty(t, cronJobExpiry("30 14 15 6 *", metav1.Now().Time))
+}
+
+func TestHistory_RecordedByOperations(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset()
+	withUser(client, "alice")
+
+	setOpts := SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "24h",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	}
+	_, err := SetTTL(ctx, cfg, client, setOpts)
+	require.NoError(t, err)
+
+	setOpts.Duration = "48h"
+	_, err = SetTTL(ctx, cfg, client, setOpts)
+	require.NoError(t, err)
+
+	pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+		[]string{"helm-uninstall"}, []string{"self-cleanup"},
+		map[string]int32{"helm-uninstall": 0, "self-cleanup": 0})
+	require.NoError(t, client.Tracker().Add(pod))
+	_, err = RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+	require.NoError(t, err)
+
+	// Recreate the TTL so unset has something to remove
+	_, err = SetTTL(ctx, cfg, client, setOpts)
+	require.NoError(t, err)
+	require.NoError(t, UnsetTTL(ctx, client, "myapp", "default", "default"))
+
+	entries, err := GetHistory(ctx, client, "myapp", "default", "default")
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+
+	assert.Equal(t, OperationSet, entries[0].Operation)
+	assert.Equal(t, "alice", entries[0].User)
+	assert.Empty(t, entries[0].OldExpiry)
+	assert.NotEmpty(t, entries[0].NewExpiry)
+
+	assert.Equal(t, OperationSet, entries[1].Operation)
+	assert.Equal(t, entries[0].NewExpiry, entries[1].OldExpiry)
+	assert.NotEqual(t, entries[1].OldExpiry, entries[1].NewExpiry)
+
+	assert.Equal(t, OperationRun, entries[2].Operation)
+	assert.Equal(t, entries[1].NewExpiry, entries[2].OldExpiry)
+
+	assert.Equal(t, OperationSet, entries[3].Operation)
+
+	assert.Equal(t, OperationUnset, entries[4].Operation)
+	assert.Equal(t, entries[3].NewExpiry, entries[4].OldExpiry)
+	assert.Empty(t, entries[4].NewExpiry)
+}
+
+func TestHistory_FailureDoesNotFailOperation(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset()
+	for _, verb := range []string{"create", "update"} {
+		client.PrependReactor(verb, "configmaps", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+	}
+
+	_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "24h",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	})
+	require.NoError(t, err)
+	require.NoError(t, UnsetTTL(ctx, client, "myapp", "default", "default"))
+}
@@ -0,0 +1,75 @@
+package ttl
+
+import (
+	"os"
+	"strings"
+)
+
+// ImageOptions contains image overrides for the uninstall pod.
+type ImageOptions struct {
+	HelmImage    string
+	KubectlImage string
+	// RegistryPrefix rewrites the default images to pull from a mirror,
+	// e.g. registry.example.com/mirror. Explicit images are used as-is.
+	// It falls back to HELM_TTL_REGISTRY_PREFIX.
+	RegistryPrefix string
+	// CleanupImage is the optional helm-ttl-cleanup image that replaces
+	// kubectl.
+	CleanupImage string
+}
+
+// EffectiveImages lists the images the uninstall pod will run.
+type EffectiveImages struct {
+	Helm    string `json:"helm" yaml:"helm"`
+	Kubectl string `json:"kubectl,omitempty" yaml:"kubectl,omitempty"`
+	Cleanup string `json:"cleanup,omitempty" yaml:"cleanup,omitempty"`
+}
+
+// GetEffectiveImages returns the images that would be used for the given
+// overrides, so they can be mirrored before scheduling TTLs.
+func GetEffectiveImages(opts ImageOptions) EffectiveImages {
+	prefix := opts.RegistryPrefix
+	if prefix == "" {
+		prefix = os.Getenv("HELM_TTL_REGISTRY_PREFIX")
+	}
+
+	images := EffectiveImages{
+		Helm:    opts.HelmImage,
+		Kubectl: opts.KubectlImage,
+		Cleanup: opts.CleanupImage,
+	}
+
+	if images.Helm == "" {
+		images.Helm = withRegistryPrefix(prefix, DefaultHelmImage)
+	}
+
+	// The cleanup image replaces kubectl entirely
+	if images.Cleanup != "" {
+		images.Kubectl = ""
+	} else if images.Kubectl == "" {
+		images.Kubectl = withRegistryPrefix(prefix, DefaultKubectlImage)
+	}
+
+	return images
+}
+
+// withRegistryPrefix moves an image reference to another registry,
+// replacing the registry host if the reference has one.
+func withRegistryPrefix(prefix, image string) string {
+	prefix = strings.TrimSuffix(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return image
+	}
+
+	if host, rest, ok := strings.Cut(image, "/"); ok && isRegistryHost(host) {
+		image = rest
+	}
+
+	return prefix + "/" + image
+}
+
+// isRegistryHost reports whether the first component of an image
+// reference is a registry host rather than a repository path.
+func isRegistryHost(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost"
+}
@@ -0,0 +1,68 @@
+package ttl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEffectiveImages(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		t.Setenv("HELM_TTL_REGISTRY_PREFIX", "")
+
+		images := GetEffectiveImages(ImageOptions{})
+		assert.Equal(t, EffectiveImages{Helm: DefaultHelmImage, Kubectl: DefaultKubectlImage}, images)
+	})
+
+	t.Run("explicit images", func(t *testing.T) {
+		images := GetEffectiveImages(ImageOptions{
+			HelmImage:      "custom/helm:v3",
+			KubectlImage:   "custom/kubectl:v1",
+			RegistryPrefix: "registry.example.com",
+		})
+		assert.Equal(t, EffectiveImages{Helm: "custom/helm:v3", Kubectl: "custom/kubectl:v1"}, images)
+	})
+
+	t.Run("registry prefix", func(t *testing.T) {
+		images := GetEffectiveImages(ImageOptions{RegistryPrefix: "registry.example.com/mirror/"})
+		assert.Equal(t, "registry.example.com/mirror/"+DefaultHelmImage, images.Helm)
+		assert.Equal(t, "registry.example.com/mirror/"+DefaultKubectlImage, images.Kubectl)
+	})
+
+	t.Run("cleanup image replaces kubectl", func(t *testing.T) {
+		images := GetEffectiveImages(ImageOptions{CleanupImage: "helm-ttl-cleanup:v1", RegistryPrefix: "mirror.example.com"})
+		assert.Equal(t, EffectiveImages{
+			Helm:    "mirror.example.com/" + DefaultHelmImage,
+			Cleanup: "helm-ttl-cleanup:v1",
+		}, images)
+	})
+
+	t.Run("registry prefix from environment", func(t *testing.T) {
+		t.Setenv("HELM_TTL_REGISTRY_PREFIX", "mirror.local:5000")
+
+		images := GetEffectiveImages(ImageOptions{})
+		assert.Equal(t, "mirror.local:5000/"+DefaultHelmImage, images.Helm)
+	})
+}
+
+func TestWithRegistryPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		image    string
+		expected string
+	}{
+		{"no prefix", "", "alpine/helm:latest", "alpine/helm:latest"},
+		{"docker hub image", "mirror.example.com", "alpine/helm:latest", "mirror.example.com/alpine/helm:latest"},
+		{"official image", "mirror.example.com", "busybox:1.36", "mirror.example.com/busybox:1.36"},
+		{"replaces registry host", "mirror.example.com", "docker.io/alpine/helm:latest", "mirror.example.com/alpine/helm:latest"},
+		{"replaces registry with port", "mirror.example.com", "localhost:5000/alpine/helm:latest", "mirror.example.com/alpine/helm:latest"},
+		{"replaces localhost", "mirror.example.com", "localhost/alpine/helm:latest", "mirror.example.com/alpine/helm:latest"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, withRegistryPrefix(tc.prefix, tc.image))
+		})
+	}
+}
@@ -7,26 +7,77 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
 )
 
 // LogFetcher abstracts pod log retrieval for testability.
 type LogFetcher func(ctx context.Context, namespace, podName, containerName string) (io.ReadCloser, error)
 
-// NewKubeLogFetcher returns a LogFetcher that uses the Kubernetes API.
+// NewKubeLogFetcher returns a LogFetcher that uses the Kubernetes API. It
+// follows the logs, so the stream ends when the container terminates.
 func NewKubeLogFetcher(client kubernetes.Interface) LogFetcher {
 	return func(ctx context.Context, namespace, podName, containerName string) (io.ReadCloser, error) {
 		opts := &corev1.PodLogOptions{
 			Container: containerName,
+			Follow:    true,
 		}
 		return client.CoreV1().Pods(namespace).GetLogs(podName, opts).Stream(ctx)
 	}
 }
 
-// waitForPod polls until a pod owned by the given job appears.
-func waitForPod(ctx context.Context, client kubernetes.Interface, namespace, jobName string) (*corev1.Pod, error) {
+// watchResync is how long a pod watch may stay quiet before the pods are
+// read again, in case the watch silently stopped delivering events.
+var watchResync = 30 * time.Second
+
+// podWaiter blocks until pods change. It watches them, and falls back to
+// polling every interval once a watch cannot be opened, e.g. because the
+// caller may get and list pods but not watch them.
+type podWaiter struct {
+	client    kubernetes.Interface
+	namespace string
+	interval  time.Duration
+	polling   bool
+}
+
+// next returns when a pod matching opts may have changed since opts'
+// resource version, or with ctx's error when ctx is done first.
+func (w *podWaiter) next(ctx context.Context, opts metav1.ListOptions) error {
+	if !w.polling {
+		watcher, err := w.client.CoreV1().Pods(w.namespace).Watch(ctx, opts)
+		if err == nil {
+			defer watcher.Stop()
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-watcher.ResultChan():
+				// An event, or a closed watch: either way, look again
+				return nil
+			case <-time.After(watchResync):
+				return nil
+			}
+		}
+
+		logger.Debug("watching pods failed, polling instead", "namespace", w.namespace, "interval", w.interval, "error", err)
+		w.polling = true
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(w.interval):
+		return nil
+	}
+}
+
+// waitForPod waits until a pod owned by the given job appears, watching
+// for it or polling every interval.
+func waitForPod(ctx context.Context, client kubernetes.Interface, namespace, jobName string, interval time.Duration) (*corev1.Pod, error) {
 	labelSelector := fmt.Sprintf("job-name=%s", jobName)
+	waiter := &podWaiter{client: client, namespace: namespace, interval: interval}
 	for {
 		pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
 			LabelSelector: labelSelector,
@@ -39,35 +90,109 @@ func waitForPod(ctx context.Context, client kubernetes.Interface, namespace, job
 			return &pods.Items[0], nil
 		}
 
+		opts := metav1.ListOptions{LabelSelector: labelSelector, ResourceVersion: pods.ResourceVersion}
+		if err := waiter.next(ctx, opts); err != nil {
+			return nil, fmt.Errorf("timed out waiting for pod (job %s): %w", jobName, err)
+		}
+	}
+}
+
+// namespaceDeletePollInterval is how often a delayed namespace deletion
+// checks whether the namespace is already gone.
+var namespaceDeletePollInterval = 10 * time.Second
+
+// waitNamespaceDeleteDelay waits delay before a namespace is deleted. It
+// reports false when the namespace disappears before the delay ends.
+func waitNamespaceDeleteDelay(ctx context.Context, client kubernetes.Interface, namespace string, delay time.Duration) (bool, error) {
+	deadline := time.Now().Add(delay)
+	for {
+		_, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+
+			return false, fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return true, nil
+		}
+
 		select {
 		case <-ctx.Done():
-			return nil, fmt.Errorf("timed out waiting for pod (job %s): %w", jobName, ctx.Err())
-		case <-time.After(1 * time.Second):
+			return false, fmt.Errorf("timed out waiting to delete namespace %s: %w", namespace, ctx.Err())
+		case <-time.After(min(remaining, namespaceDeletePollInterval)):
 		}
 	}
 }
 
-// waitForContainerTermination polls until the named container has terminated.
-func waitForContainerTermination(ctx context.Context, client kubernetes.Interface, namespace, podName, containerName string) (int32, error) {
+// waitForContainerTermination waits until the named container has
+// terminated and returns its terminated state.
+func waitForContainerTermination(ctx context.Context, client kubernetes.Interface, namespace, podName, containerName string, interval time.Duration) (*corev1.ContainerStateTerminated, error) {
+	state, err := waitForContainer(ctx, client, namespace, podName, containerName, interval, func(s corev1.ContainerState) bool {
+		return s.Terminated != nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return state.Terminated, nil
+}
+
+// waitForContainerStart waits until the named container is running or has
+// terminated, i.e. until it has logs to follow.
+func waitForContainerStart(ctx context.Context, client kubernetes.Interface, namespace, podName, containerName string, interval time.Duration) error {
+	_, err := waitForContainer(ctx, client, namespace, podName, containerName, interval, func(s corev1.ContainerState) bool {
+		return s.Running != nil || s.Terminated != nil
+	})
+
+	return err
+}
+
+// waitForContainer waits until the state of the named container satisfies
+// done, watching the pod or polling it every interval, and returns that
+// state.
+func waitForContainer(ctx context.Context, client kubernetes.Interface, namespace, podName, containerName string, interval time.Duration, done func(corev1.ContainerState) bool) (*corev1.ContainerState, error) {
+	waiter := &podWaiter{client: client, namespace: namespace, interval: interval}
 	for {
 		pod, err := client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
 		if err != nil {
-			return -1, fmt.Errorf("failed to get pod %s: %w", podName, err)
+			return nil, fmt.Errorf("failed to get pod %s: %w", podName, err)
 		}
 
 		allStatuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
 		for _, cs := range allStatuses {
-			if cs.Name == containerName && cs.State.Terminated != nil {
-				return cs.State.Terminated.ExitCode, nil
+			if cs.Name == containerName && done(cs.State) {
+				return &cs.State, nil
 			}
 		}
 
-		select {
-		case <-ctx.Done():
-			return -1, fmt.Errorf("timed out waiting for container %s in pod %s: %w", containerName, podName, ctx.Err())
-		case <-time.After(1 * time.Second):
+		opts := metav1.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", podName).String(),
+			ResourceVersion: pod.ResourceVersion,
 		}
+		if err := waiter.next(ctx, opts); err != nil {
+			return nil, fmt.Errorf("timed out waiting for container %s in pod %s: %w", containerName, podName, err)
+		}
+	}
+}
+
+// containerResult records the exit code and timing of a terminated container.
+func containerResult(name string, terminated *corev1.ContainerStateTerminated) ContainerResult {
+	r := ContainerResult{Name: name, ExitCode: terminated.ExitCode}
+	if !terminated.StartedAt.IsZero() {
+		r.StartedAt = FormatScheduledDate(terminated.StartedAt.Time)
+	}
+	if !terminated.FinishedAt.IsZero() {
+		r.FinishedAt = FormatScheduledDate(terminated.FinishedAt.Time)
 	}
+	if !terminated.StartedAt.IsZero() && !terminated.FinishedAt.IsZero() {
+		r.DurationSeconds = terminated.FinishedAt.Sub(terminated.StartedAt.Time).Seconds()
+	}
+
+	return r
 }
 
 // streamContainerLogs fetches and writes container logs to w with a header.
@@ -3,6 +3,7 @@ package ttl
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"strings"
 	"testing"
@@ -12,7 +13,10 @@ import (
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestWaitForPod(t *testing.T) {
@@ -26,7 +30,74 @@ func TestWaitForPod(t *testing.T) {
 		})
 
 		ctx := context.Background()
-		pod, err := waitForPod(ctx, client, "default", "test-job")
+		pod, err := waitForPod(ctx, client, "default", "test-job", time.Millisecond)
+		require.NoError(t, err)
+		assert.Equal(t, "test-pod", pod.Name)
+	})
+
+	t.Run("pod appears while watching", func(t *testing.T) {
+		client := fake.NewClientset()
+		watching := make(chan struct{})
+		client.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+			assert.Equal(t, "job-name=test-job", action.(k8stesting.WatchAction).GetWatchRestrictions().Labels.String())
+			close(watching)
+			return false, nil, nil
+		})
+		go func() {
+			<-watching
+			_, _ = client.CoreV1().Pods("default").Create(context.Background(), &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Namespace: "default", Labels: map[string]string{"job-name": "test-job"}},
+			}, metav1.CreateOptions{})
+		}()
+
+		// The poll interval is never reached: the watch delivers the pod
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		pod, err := waitForPod(ctx, client, "default", "test-job", time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, "test-pod", pod.Name)
+	})
+
+	t.Run("polls when pods cannot be watched", func(t *testing.T) {
+		client := fake.NewClientset()
+		watches := 0
+		client.PrependWatchReactor("pods", func(_ k8stesting.Action) (bool, watch.Interface, error) {
+			watches++
+			return true, nil, errors.New("forbidden")
+		})
+		lists := 0
+		client.PrependReactor("list", "pods", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			lists++
+			if lists < 3 {
+				return true, &corev1.PodList{}, nil
+			}
+
+			return true, &corev1.PodList{Items: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Labels: map[string]string{"job-name": "test-job"}}}}}, nil
+		})
+
+		pod, err := waitForPod(context.Background(), client, "default", "test-job", time.Millisecond)
+		require.NoError(t, err)
+		assert.Equal(t, "test-pod", pod.Name)
+		assert.Equal(t, 1, watches, "a failed watch is not retried")
+	})
+
+	t.Run("quiet watch is resynced", func(t *testing.T) {
+		watchResync = time.Millisecond
+		t.Cleanup(func() { watchResync = 30 * time.Second })
+
+		client := fake.NewClientset()
+		lists := 0
+		client.PrependReactor("list", "pods", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			lists++
+			if lists < 3 {
+				return true, &corev1.PodList{}, nil
+			}
+
+			return true, &corev1.PodList{Items: []corev1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Labels: map[string]string{"job-name": "test-job"}}}}}, nil
+		})
+
+		pod, err := waitForPod(context.Background(), client, "default", "test-job", time.Hour)
 		require.NoError(t, err)
 		assert.Equal(t, "test-pod", pod.Name)
 	})
@@ -37,7 +108,7 @@ func TestWaitForPod(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 		defer cancel()
 
-		_, err := waitForPod(ctx, client, "default", "test-job")
+		_, err := waitForPod(ctx, client, "default", "test-job", time.Millisecond)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "timed out waiting for pod")
 	})
@@ -65,9 +136,9 @@ func TestWaitForContainerTermination(t *testing.T) {
 		})
 
 		ctx := context.Background()
-		exitCode, err := waitForContainerTermination(ctx, client, "default", "test-pod", "test-container")
+		terminated, err := waitForContainerTermination(ctx, client, "default", "test-pod", "test-container", time.Millisecond)
 		require.NoError(t, err)
-		assert.Equal(t, int32(0), exitCode)
+		assert.Equal(t, int32(0), terminated.ExitCode)
 	})
 
 	t.Run("non-zero exit", func(t *testing.T) {
@@ -91,9 +162,9 @@ func TestWaitForContainerTermination(t *testing.T) {
 		})
 
 		ctx := context.Background()
-		exitCode, err := waitForContainerTermination(ctx, client, "default", "test-pod", "test-container")
+		terminated, err := waitForContainerTermination(ctx, client, "default", "test-pod", "test-container", time.Millisecond)
 		require.NoError(t, err)
-		assert.Equal(t, int32(1), exitCode)
+		assert.Equal(t, int32(1), terminated.ExitCode)
 	})
 
 	t.Run("init container termination", func(t *testing.T) {
@@ -117,9 +188,9 @@ func TestWaitForContainerTermination(t *testing.T) {
 		})
 
 		ctx := context.Background()
-		exitCode, err := waitForContainerTermination(ctx, client, "default", "test-pod", "init-container")
+		terminated, err := waitForContainerTermination(ctx, client, "default", "test-pod", "init-container", time.Millisecond)
 		require.NoError(t, err)
-		assert.Equal(t, int32(0), exitCode)
+		assert.Equal(t, int32(0), terminated.ExitCode)
 	})
 
 	t.Run("timeout waiting for termination", func(t *testing.T) {
@@ -143,12 +214,128 @@ func TestWaitForContainerTermination(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 		defer cancel()
 
-		_, err := waitForContainerTermination(ctx, client, "default", "test-pod", "test-container")
+		_, err := waitForContainerTermination(ctx, client, "default", "test-pod", "test-container", time.Millisecond)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "timed out waiting for container")
 	})
 }
 
+func TestWaitForContainerStart(t *testing.T) {
+	pod := func(state corev1.ContainerState) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Namespace: "default"},
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{{Name: "helm-uninstall", State: state}},
+			},
+		}
+	}
+
+	t.Run("running", func(t *testing.T) {
+		client := fake.NewClientset(pod(corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}))
+
+		err := waitForContainerStart(context.Background(), client, "default", "test-pod", "helm-uninstall", time.Millisecond)
+		assert.NoError(t, err)
+	})
+
+	t.Run("already terminated", func(t *testing.T) {
+		client := fake.NewClientset(pod(corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}))
+
+		err := waitForContainerStart(context.Background(), client, "default", "test-pod", "helm-uninstall", time.Millisecond)
+		assert.NoError(t, err)
+	})
+
+	t.Run("still waiting", func(t *testing.T) {
+		client := fake.NewClientset(pod(corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := waitForContainerStart(ctx, client, "default", "test-pod", "helm-uninstall", time.Millisecond)
+		assert.ErrorContains(t, err, "timed out waiting for container helm-uninstall in pod test-pod")
+	})
+
+	t.Run("watches the pod until the container starts", func(t *testing.T) {
+		client := fake.NewClientset(pod(corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{}}))
+		watching := make(chan struct{})
+		client.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+			assert.Equal(t, "metadata.name=test-pod", action.(k8stesting.WatchAction).GetWatchRestrictions().Fields.String())
+			close(watching)
+			return false, nil, nil
+		})
+		go func() {
+			<-watching
+			p := pod(corev1.ContainerState{Running: &corev1.ContainerStateRunning{}})
+			_, _ = client.CoreV1().Pods("default").UpdateStatus(context.Background(), p, metav1.UpdateOptions{})
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := waitForContainerStart(ctx, client, "default", "test-pod", "helm-uninstall", time.Hour)
+		assert.NoError(t, err)
+	})
+
+	t.Run("pod lookup error", func(t *testing.T) {
+		err := waitForContainerStart(context.Background(), fake.NewClientset(), "default", "test-pod", "helm-uninstall", time.Millisecond)
+		assert.ErrorContains(t, err, "failed to get pod test-pod")
+	})
+}
+
+func TestNewKubeLogFetcher(t *testing.T) {
+	client := fake.NewClientset()
+
+	rc, err := NewKubeLogFetcher(client)(context.Background(), "default", "test-pod", "helm-uninstall")
+	require.NoError(t, err)
+	defer func() { _ = rc.Close() }()
+
+	actions := client.Actions()
+	require.Len(t, actions, 1)
+	opts, ok := actions[0].(k8stesting.GenericAction).GetValue().(*corev1.PodLogOptions)
+	require.True(t, ok)
+	assert.Equal(t, "helm-uninstall", opts.Container)
+	assert.True(t, opts.Follow)
+}
+
+func TestWaitNamespaceDeleteDelay(t *testing.T) {
+	namespaceDeletePollInterval = time.Millisecond
+	t.Cleanup(func() { namespaceDeletePollInterval = 10 * time.Second })
+
+	ctx := context.Background()
+
+	t.Run("delay elapses", func(t *testing.T) {
+		client := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "staging"}})
+
+		exists, err := waitNamespaceDeleteDelay(ctx, client, "staging", 5*time.Millisecond)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("namespace already deleted", func(t *testing.T) {
+		exists, err := waitNamespaceDeleteDelay(ctx, fake.NewClientset(), "staging", time.Hour)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("get error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "namespaces", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := waitNamespaceDeleteDelay(ctx, client, "staging", time.Hour)
+		assert.EqualError(t, err, "failed to get namespace staging: forbidden")
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		client := fake.NewClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "staging"}})
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := waitNamespaceDeleteDelay(cancelled, client, "staging", time.Hour)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
 func TestStreamContainerLogs(t *testing.T) {
 	t.Run("writes header and log content", func(t *testing.T) {
 		logContent := "line 1\nline 2\n"
@@ -0,0 +1,432 @@
+package ttl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/notify"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
+	"k8s.io/client-go/kubernetes"
+	typedbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+)
+
+const (
+	// LabelBackend marks the objects of TTLs not kept as CronJobs with
+	// their backend, telling the Jobs of job-sleep TTLs apart from those
+	// of helm ttl run, and controller TTLs from other ConfigMaps.
+	LabelBackend = "helm-ttl/backend"
+	// AnnotationSchedule records on the Job of a job-sleep TTL the cron
+	// schedule of its expiry, which a CronJob keeps in its spec.
+	AnnotationSchedule = "helm-ttl/schedule"
+	// annotationActiveDeadline records the active deadline of the
+	// uninstall, before the wait for the expiry was added to it.
+	annotationActiveDeadline = "helm-ttl/active-deadline-seconds"
+
+	// waitForExpiryContainer is the name of the init container a job-sleep
+	// TTL sleeps in until its expiry.
+	waitForExpiryContainer = "wait-for-expiry"
+)
+
+// jobControllerLabels are the labels Kubernetes adds to the pod template
+// of a Job, which a Job created from the template must not carry.
+var jobControllerLabels = []string{
+	"controller-uid", "job-name",
+	"batch.kubernetes.io/controller-uid", "batch.kubernetes.io/job-name",
+}
+
+// jobSleepBackend keeps each TTL as a Job created when the TTL is set,
+// whose first init container sleeps until the expiry. Changing the expiry
+// or the uninstall replaces the Job, since the pod template of a Job
+// cannot change.
+type jobSleepBackend struct{}
+
+func (jobSleepBackend) Name() string { return BackendJobSleep }
+
+func (jobSleepBackend) GroupVersionKind() schema.GroupVersionKind {
+	return batchv1.SchemeGroupVersion.WithKind("Job")
+}
+
+func (jobSleepBackend) CronJobs(client kubernetes.Interface, namespace string) typedbatchv1.CronJobInterface {
+	return &jobSleepCronJobs{jobs: client.BatchV1().Jobs(namespace)}
+}
+
+func (jobSleepBackend) Object(cj *batchv1.CronJob, now time.Time) (runtime.Object, error) {
+	return sleepJob(cj, now)
+}
+
+func (jobSleepBackend) RunsJobs() bool { return true }
+
+// Rules lets the uninstall Job delete itself once done.
+func (jobSleepBackend) Rules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{{
+		APIGroups: []string{"batch"},
+		Resources: []string{"jobs"},
+		Verbs:     []string{"get", "delete"},
+	}}
+}
+
+// sleepJob returns the Job keeping the TTL of cj: the Job cj would run,
+// waiting for the expiry in a container before its expiry guard, deleting
+// itself instead of the CronJob once done, and with the wait added to its
+// active deadline.
+func sleepJob(cj *batchv1.CronJob, now time.Time) (*batchv1.Job, error) {
+	spec := cj.Spec.JobTemplate.Spec.DeepCopy()
+	podSpec := &spec.Template.Spec
+	for _, c := range podSpec.InitContainers {
+		switch c.Name {
+		case abortWindowContainer:
+			return nil, fmt.Errorf("the %s backend does not support --abort-window", BackendJobSleep)
+		case "publish-manifest":
+			return nil, fmt.Errorf("the %s backend does not support --two-phase", BackendJobSleep)
+		}
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, cj.Annotations[AnnotationExpiresAt])
+	guard := slices.IndexFunc(podSpec.InitContainers, func(c corev1.Container) bool { return c.Name == expiryGuardContainer })
+	if err != nil || guard < 0 {
+		return nil, fmt.Errorf("the %s backend needs the expiry of TTL %s in its %s annotation", BackendJobSleep, cj.Name, AnnotationExpiresAt)
+	}
+
+	// The wait runs where the guard does, with the same image and settings
+	wait := *podSpec.InitContainers[guard].DeepCopy()
+	wait.Name = waitForExpiryContainer
+	wait.Command = waitForExpiryCmd(expiresAt, unwrappedCommand(wait)[0] == cleanupBinary)
+	if reportsFailures(wait) {
+		for i := range wait.Env {
+			if wait.Env[i].Name == notify.FailureContainerEnv {
+				wait.Env[i].Value = waitForExpiryContainer
+			}
+		}
+		wrapFailureReport(&wait)
+	}
+	podSpec.InitContainers = slices.Insert(podSpec.InitContainers, guard, wait)
+
+	for i, c := range podSpec.Containers {
+		if c.Name != selfCleanupContainer {
+			continue
+		}
+
+		podSpec.Containers[i].Command = deleteJobCmd(cj.Name, cj.Namespace, unwrappedCommand(c)[0] == cleanupBinary)
+		if reportsFailures(c) {
+			wrapFailureReport(&podSpec.Containers[i])
+		}
+	}
+
+	annotations := maps.Clone(cj.Annotations)
+	annotations[AnnotationSchedule] = cj.Spec.Schedule
+	if spec.ActiveDeadlineSeconds != nil {
+		annotations[annotationActiveDeadline] = strconv.FormatInt(*spec.ActiveDeadlineSeconds, 10)
+		deadline := *spec.ActiveDeadlineSeconds + max(0, int64(math.Ceil(expiresAt.Sub(now).Seconds())))
+		spec.ActiveDeadlineSeconds = &deadline
+	}
+
+	// A CronJob keeping no failed Jobs becomes a Job removed once finished
+	if limit := cj.Spec.FailedJobsHistoryLimit; limit != nil && *limit == 0 {
+		var ttl int32
+		spec.TTLSecondsAfterFinished = &ttl
+	}
+	if cj.Spec.Suspend != nil && *cj.Spec.Suspend {
+		spec.Suspend = cj.Spec.Suspend
+	}
+
+	labels := maps.Clone(cj.Labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[LabelBackend] = BackendJobSleep
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            cj.Name,
+			Namespace:       cj.Namespace,
+			Labels:          labels,
+			Annotations:     annotations,
+			ResourceVersion: cj.ResourceVersion,
+			OwnerReferences: cj.OwnerReferences,
+		},
+		Spec: *spec,
+	}, nil
+}
+
+// cronJobOf returns the TTL CronJob a Job from sleepJob keeps. Its
+// template still deletes the Job once done, so a TTL run by hand removes
+// it like the CronJob of the cronjob backend.
+func cronJobOf(job *batchv1.Job) *batchv1.CronJob {
+	meta := *job.ObjectMeta.DeepCopy()
+	meta.ManagedFields = nil
+	delete(meta.Labels, LabelBackend)
+	schedule := meta.Annotations[AnnotationSchedule]
+	delete(meta.Annotations, AnnotationSchedule)
+
+	spec := job.Spec.DeepCopy()
+	spec.Selector = nil
+	spec.ManualSelector = nil
+	for _, label := range jobControllerLabels {
+		delete(spec.Template.Labels, label)
+	}
+	spec.Template.Spec.InitContainers = slices.DeleteFunc(spec.Template.Spec.InitContainers, func(c corev1.Container) bool {
+		return c.Name == waitForExpiryContainer
+	})
+
+	spec.ActiveDeadlineSeconds = nil
+	if deadline, err := strconv.ParseInt(meta.Annotations[annotationActiveDeadline], 10, 64); err == nil {
+		spec.ActiveDeadlineSeconds = &deadline
+	}
+	delete(meta.Annotations, annotationActiveDeadline)
+
+	var failedLimit *int32
+	if spec.TTLSecondsAfterFinished != nil && *spec.TTLSecondsAfterFinished == 0 {
+		failedLimit, spec.TTLSecondsAfterFinished = spec.TTLSecondsAfterFinished, nil
+	}
+	var suspend *bool
+	if spec.Suspend != nil && *spec.Suspend {
+		suspend = spec.Suspend
+	}
+	spec.Suspend = nil
+
+	return &batchv1.CronJob{
+		ObjectMeta: meta,
+		Spec: batchv1.CronJobSpec{
+			Schedule:               schedule,
+			Suspend:                suspend,
+			ConcurrencyPolicy:      batchv1.ForbidConcurrent,
+			FailedJobsHistoryLimit: failedLimit,
+			JobTemplate: batchv1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      maps.Clone(spec.Template.Labels),
+					Annotations: maps.Clone(spec.Template.Annotations),
+				},
+				Spec: *spec,
+			},
+		},
+	}
+}
+
+// waitForExpiryCmd returns a command sleeping until expiresAt.
+func waitForExpiryCmd(expiresAt time.Time, cleanupImage bool) []string {
+	if cleanupImage {
+		return []string{cleanupBinary, "sleep-until", expiresAt.UTC().Format(time.RFC3339)}
+	}
+
+	script := fmt.Sprintf(`now=$(date +%%s)
+if [ "$now" -lt %[1]d ]; then
+  echo "waiting until %[2]s before uninstalling"
+  sleep $((%[1]d - now))
+fi`, expiresAt.Unix(), expiresAt.UTC().Format(time.RFC3339))
+
+	return []string{"sh", "-c", script}
+}
+
+// deleteJobCmd returns a command deleting the Job of a job-sleep TTL.
+func deleteJobCmd(name, namespace string, cleanupImage bool) []string {
+	if cleanupImage {
+		return []string{cleanupBinary, "delete-job", "--namespace", namespace, name}
+	}
+
+	return []string{"kubectl", "delete", "job", name, "--namespace", namespace, "--ignore-not-found"}
+}
+
+// jobSleepCronJobs serves the TTLs of a namespace from the Jobs of the
+// job-sleep backend.
+type jobSleepCronJobs struct {
+	jobs typedbatchv1.JobInterface
+}
+
+var _ typedbatchv1.CronJobInterface = &jobSleepCronJobs{}
+
+func (c *jobSleepCronJobs) Create(ctx context.Context, cj *batchv1.CronJob, opts metav1.CreateOptions) (*batchv1.CronJob, error) {
+	job, err := sleepJob(cj, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	job.ResourceVersion = ""
+
+	return toCronJob(c.jobs.Create(ctx, job, opts))
+}
+
+// Update changes only the labels and annotations of the Job when the
+// uninstall and expiry stay the same, and replaces the Job otherwise.
+func (c *jobSleepCronJobs) Update(ctx context.Context, cj *batchv1.CronJob, opts metav1.UpdateOptions) (*batchv1.CronJob, error) {
+	existing, err := c.get(ctx, cj.Name)
+	if err != nil {
+		return nil, err
+	}
+	if cj.ResourceVersion != "" && cj.ResourceVersion != existing.ResourceVersion {
+		return nil, errors.NewConflict(batchv1.Resource("jobs"), cj.Name, fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+
+	desired, err := sleepJob(cj, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	current := cronJobOf(existing)
+	if current.Annotations[AnnotationExpiresAt] == cj.Annotations[AnnotationExpiresAt] &&
+		equality.Semantic.DeepEqual(current.Spec.JobTemplate.Spec, cj.Spec.JobTemplate.Spec) {
+		existing.Labels = desired.Labels
+		existing.Annotations = desired.Annotations
+
+		return toCronJob(c.jobs.Update(ctx, existing, opts))
+	}
+
+	// Background propagation removes the Job at once, and its pod after
+	background := metav1.DeletePropagationBackground
+	if err := c.jobs.Delete(ctx, existing.Name, metav1.DeleteOptions{
+		Preconditions:     &metav1.Preconditions{UID: &existing.UID},
+		PropagationPolicy: &background,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to replace Job %s: %w", existing.Name, err)
+	}
+	desired.ResourceVersion = ""
+
+	return toCronJob(c.jobs.Create(ctx, desired, metav1.CreateOptions{DryRun: opts.DryRun, FieldManager: opts.FieldManager}))
+}
+
+func (c *jobSleepCronJobs) UpdateStatus(context.Context, *batchv1.CronJob, metav1.UpdateOptions) (*batchv1.CronJob, error) {
+	return nil, errors.NewMethodNotSupported(batchv1.Resource("jobs"), "update status of")
+}
+
+func (c *jobSleepCronJobs) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.jobs.Delete(ctx, name, withPropagation(opts))
+}
+
+func (c *jobSleepCronJobs) DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	return c.jobs.DeleteCollection(ctx, withPropagation(opts), withBackendSelector(listOpts, BackendJobSleep))
+}
+
+func (c *jobSleepCronJobs) Get(ctx context.Context, name string, _ metav1.GetOptions) (*batchv1.CronJob, error) {
+	return toCronJob(c.get(ctx, name))
+}
+
+// get returns the Job of a job-sleep TTL, and NotFound for other Jobs.
+func (c *jobSleepCronJobs) get(ctx context.Context, name string) (*batchv1.Job, error) {
+	job, err := c.jobs.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if job.Labels[LabelBackend] != BackendJobSleep {
+		return nil, errors.NewNotFound(batchv1.Resource("jobs"), name)
+	}
+
+	return job, nil
+}
+
+func (c *jobSleepCronJobs) List(ctx context.Context, opts metav1.ListOptions) (*batchv1.CronJobList, error) {
+	jobs, err := c.jobs.List(ctx, withBackendSelector(opts, BackendJobSleep))
+	if err != nil {
+		return nil, err
+	}
+
+	list := &batchv1.CronJobList{ListMeta: jobs.ListMeta}
+	for i := range jobs.Items {
+		list.Items = append(list.Items, *cronJobOf(&jobs.Items[i]))
+	}
+
+	return list, nil
+}
+
+func (c *jobSleepCronJobs) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	w, err := c.jobs.Watch(ctx, withBackendSelector(opts, BackendJobSleep))
+	if err != nil {
+		return nil, err
+	}
+
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		if job, ok := e.Object.(*batchv1.Job); ok {
+			e.Object = cronJobOf(job)
+		}
+
+		return e, true
+	}), nil
+}
+
+// Patch patches the Job of a TTL, so only patches of the metadata, which
+// Jobs and CronJobs share, are supported. Apply patches go through Apply.
+func (c *jobSleepCronJobs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*batchv1.CronJob, error) {
+	if pt == types.ApplyPatchType {
+		return c.apply(ctx, data, opts.FieldManager, opts.DryRun)
+	}
+
+	return toCronJob(c.jobs.Patch(ctx, name, pt, data, opts, subresources...))
+}
+
+// Apply creates or updates the Job of a TTL from a CronJob apply
+// configuration, which must hold the whole CronJob.
+func (c *jobSleepCronJobs) Apply(ctx context.Context, cj *batchv1ac.CronJobApplyConfiguration, opts metav1.ApplyOptions) (*batchv1.CronJob, error) {
+	data, err := json.Marshal(cj)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.apply(ctx, data, opts.FieldManager, opts.DryRun)
+}
+
+func (c *jobSleepCronJobs) ApplyStatus(context.Context, *batchv1ac.CronJobApplyConfiguration, metav1.ApplyOptions) (*batchv1.CronJob, error) {
+	return nil, errors.NewMethodNotSupported(batchv1.Resource("jobs"), "apply status of")
+}
+
+func (c *jobSleepCronJobs) apply(ctx context.Context, data []byte, fieldManager string, dryRun []string) (*batchv1.CronJob, error) {
+	var cj batchv1.CronJob
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return nil, fmt.Errorf("failed to read CronJob: %w", err)
+	}
+	if cj.Name == "" {
+		return nil, fmt.Errorf("cronJob.Name must be provided to Apply")
+	}
+
+	if _, err := c.get(ctx, cj.Name); errors.IsNotFound(err) {
+		return c.Create(ctx, &cj, metav1.CreateOptions{DryRun: dryRun, FieldManager: fieldManager})
+	} else if err != nil {
+		return nil, err
+	}
+
+	return c.Update(ctx, &cj, metav1.UpdateOptions{DryRun: dryRun, FieldManager: fieldManager})
+}
+
+// toCronJob converts the result of a Job call.
+func toCronJob(job *batchv1.Job, err error) (*batchv1.CronJob, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return cronJobOf(job), nil
+}
+
+// withBackendSelector narrows a list to the objects of the TTLs of a
+// backend.
+func withBackendSelector(opts metav1.ListOptions, backend string) metav1.ListOptions {
+	selector := LabelBackend + "=" + backend
+	if opts.LabelSelector != "" {
+		selector = opts.LabelSelector + "," + selector
+	}
+	opts.LabelSelector = selector
+
+	return opts
+}
+
+// withPropagation deletes the pods of a Job with it, which the API
+// otherwise orphans.
+func withPropagation(opts metav1.DeleteOptions) metav1.DeleteOptions {
+	if opts.PropagationPolicy == nil {
+		background := metav1.DeletePropagationBackground
+		opts.PropagationPolicy = &background
+	}
+
+	return opts
+}
@@ -0,0 +1,293 @@
+package ttl
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLookupBackend(t *testing.T) {
+	backend, err := LookupBackend("")
+	require.NoError(t, err)
+	assert.Equal(t, BackendCronJob, backend.Name())
+
+	backend, err = LookupBackend("job-sleep")
+	require.NoError(t, err)
+	assert.Equal(t, "Job", backend.GroupVersionKind().Kind)
+
+	_, err = LookupBackend("deployment")
+	assert.EqualError(t, err, `unknown backend "deployment": use controller or cronjob or job-sleep or releasettl`)
+}
+
+func TestWithBackend(t *testing.T) {
+	client := fake.NewClientset()
+
+	wrapped, err := WithBackend(client, BackendCronJob)
+	require.NoError(t, err)
+	assert.Same(t, client, wrapped)
+	assert.Equal(t, BackendCronJob, BackendOf(wrapped).Name())
+
+	wrapped, err = WithBackend(client, BackendJobSleep)
+	require.NoError(t, err)
+	assert.Equal(t, BackendJobSleep, BackendOf(wrapped).Name())
+	_, ok := wrapped.BatchV1().CronJobs("ops").(*jobSleepCronJobs)
+	assert.True(t, ok)
+
+	_, err = WithBackend(client, "deployment")
+	assert.Error(t, err)
+}
+
+func TestSleepJob(t *testing.T) {
+	now := time.Date(2026, 1, 1, 11, 0, 0, 0, time.UTC)
+	opts := CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "staging",
+		CronjobNamespace: "ops",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		ExpiresAt:        time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	cj, err := BuildCronJob(opts)
+	require.NoError(t, err)
+
+	job, err := sleepJob(cj, now)
+	require.NoError(t, err)
+	assert.Equal(t, "myapp-80081014-ttl", job.Name)
+	assert.Equal(t, "ops", job.Namespace)
+	assert.Equal(t, BackendJobSleep, job.Labels[LabelBackend])
+	assert.Equal(t, "0 12 1 1 *", job.Annotations[AnnotationSchedule])
+	assert.Equal(t, DefaultActiveDeadlineSeconds+3600, *job.Spec.ActiveDeadlineSeconds)
+
+	var names []string
+	for _, c := range job.Spec.Template.Spec.InitContainers {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"wait-for-expiry", "expiry-guard", "helm-uninstall", "verify-uninstall"}, names)
+
+	wait := job.Spec.Template.Spec.InitContainers[0]
+	assert.Equal(t, DefaultKubectlImage, wait.Image)
+	script := wait.Command[2]
+	assert.Contains(t, script, `if [ "$now" -lt 1767268800 ]; then`)
+	assert.Contains(t, script, "waiting until 2026-01-01T12:00:00Z before uninstalling")
+	assert.NoError(t, exec.Command("sh", "-n", "-c", script).Run())
+
+	cleanup := job.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, []string{"kubectl", "delete", "job", "myapp-80081014-ttl", "--namespace", "ops", "--ignore-not-found"}, cleanup.Command)
+
+	t.Run("round trip", func(t *testing.T) {
+		job := job.DeepCopy()
+		// The job controller fills in the selector and pod labels
+		job.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"batch.kubernetes.io/controller-uid": "1234"}}
+		job.Spec.Template.Labels["batch.kubernetes.io/controller-uid"] = "1234"
+		job.Spec.Template.Labels["job-name"] = job.Name
+
+		got := cronJobOf(job)
+		assert.Equal(t, cj.Spec.Schedule, got.Spec.Schedule)
+		assert.Equal(t, cj.Labels, got.Labels)
+		assert.Equal(t, cj.Annotations, got.Annotations)
+		assert.Equal(t, cj.Spec.JobTemplate.Spec.ActiveDeadlineSeconds, got.Spec.JobTemplate.Spec.ActiveDeadlineSeconds)
+		assert.Equal(t, cj.Spec.JobTemplate.Spec.Template.Labels, got.Spec.JobTemplate.Spec.Template.Labels)
+		assert.Equal(t, cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers, got.Spec.JobTemplate.Spec.Template.Spec.InitContainers)
+		assert.Nil(t, got.Spec.JobTemplate.Spec.Selector)
+	})
+
+	t.Run("expiry passed", func(t *testing.T) {
+		job, err := sleepJob(cj, opts.ExpiresAt.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, DefaultActiveDeadlineSeconds, *job.Spec.ActiveDeadlineSeconds)
+	})
+
+	t.Run("cleanup image", func(t *testing.T) {
+		opts := opts
+		opts.CleanupImage = "registry.example.com/helm-ttl-cleanup:v1"
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		job, err := sleepJob(cj, now)
+		require.NoError(t, err)
+		assert.Equal(t, []string{cleanupBinary, "sleep-until", "2026-01-01T12:00:00Z"}, job.Spec.Template.Spec.InitContainers[0].Command)
+		assert.Equal(t, []string{cleanupBinary, "delete-job", "--namespace", "ops", "myapp-80081014-ttl"}, job.Spec.Template.Spec.Containers[0].Command)
+	})
+
+	t.Run("failed history limit 0", func(t *testing.T) {
+		opts := opts
+		limit := int32(0)
+		opts.Job = JobOptions{FailedHistoryLimit: &limit}
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		job, err := sleepJob(cj, now)
+		require.NoError(t, err)
+		assert.Equal(t, int32(0), *job.Spec.TTLSecondsAfterFinished)
+		assert.Equal(t, int32(0), *cronJobOf(job).Spec.FailedJobsHistoryLimit)
+	})
+
+	t.Run("abort window unsupported", func(t *testing.T) {
+		opts := opts
+		opts.AbortWindow = time.Minute
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		_, err = sleepJob(cj, now)
+		assert.EqualError(t, err, "the job-sleep backend does not support --abort-window")
+	})
+
+	t.Run("two-phase unsupported", func(t *testing.T) {
+		opts := opts
+		opts.TwoPhaseGrace = time.Minute
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		_, err = sleepJob(cj, now)
+		assert.EqualError(t, err, "the job-sleep backend does not support --two-phase")
+	})
+
+	t.Run("expiry required", func(t *testing.T) {
+		opts := opts
+		opts.ExpiresAt = time.Time{}
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		_, err = sleepJob(cj, now)
+		assert.EqualError(t, err, "the job-sleep backend needs the expiry of TTL myapp-80081014-ttl in its helm-ttl/expires-at annotation")
+	})
+}
+
+func TestJobSleepBackend(t *testing.T) {
+	ctx := context.Background()
+	setOpts := SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "2d",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	}
+	setup := func(t *testing.T) (*fake.Clientset, kubernetes.Interface) {
+		t.Helper()
+
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		wrapped, err := WithBackend(client, BackendJobSleep)
+		require.NoError(t, err)
+
+		_, err = SetTTL(ctx, cfg, wrapped, setOpts)
+		require.NoError(t, err)
+
+		return client, wrapped
+	}
+
+	t.Run("set creates a job", func(t *testing.T) {
+		client, _ := setup(t)
+
+		cronJobs, err := client.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, cronJobs.Items)
+
+		job, err := client.BatchV1().Jobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, BackendJobSleep, job.Labels[LabelBackend])
+		assert.Equal(t, waitForExpiryContainer, job.Spec.Template.Spec.InitContainers[0].Name)
+
+		role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Contains(t, role.Rules, jobSleepBackend{}.Rules()[0])
+		assert.Equal(t, "Job", role.OwnerReferences[0].Kind)
+	})
+
+	t.Run("get and list", func(t *testing.T) {
+		client, wrapped := setup(t)
+		// The Jobs of helm ttl run are not TTLs
+		_, err := client.BatchV1().Jobs("default").Create(ctx, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "myapp-run", Namespace: "default"}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		info, err := GetTTL(ctx, wrapped, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "myapp", info.ReleaseName)
+
+		infos, err := ListTTLs(ctx, wrapped, "default", "")
+		require.NoError(t, err)
+		assert.Len(t, infos, 1)
+
+		_, err = wrapped.BatchV1().CronJobs("default").Get(ctx, "myapp-run", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("extend replaces the job", func(t *testing.T) {
+		client, wrapped := setup(t)
+		before, err := client.BatchV1().Jobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+
+		_, err = ExtendTTL(ctx, wrapped, ExtendTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", By: 24 * time.Hour})
+		require.NoError(t, err)
+
+		after, err := client.BatchV1().Jobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotEqual(t, before.Annotations[AnnotationExpiresAt], after.Annotations[AnnotationExpiresAt])
+		assert.Greater(t, *after.Spec.ActiveDeadlineSeconds, *before.Spec.ActiveDeadlineSeconds)
+	})
+
+	t.Run("metadata update keeps the job", func(t *testing.T) {
+		_, wrapped := setup(t)
+		cronJobs := wrapped.BatchV1().CronJobs("default")
+		cj, err := cronJobs.Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		cj.Annotations["example.com/owner"] = "team-a"
+
+		updated, err := cronJobs.Update(ctx, cj, metav1.UpdateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, cj.UID, updated.UID)
+		assert.Equal(t, "team-a", updated.Annotations["example.com/owner"])
+	})
+
+	t.Run("stale update conflicts", func(t *testing.T) {
+		_, wrapped := setup(t)
+		cronJobs := wrapped.BatchV1().CronJobs("default")
+		cj, err := cronJobs.Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		cj.ResourceVersion = "stale"
+
+		_, err = cronJobs.Update(ctx, cj, metav1.UpdateOptions{})
+		assert.True(t, apierrors.IsConflict(err))
+	})
+
+	t.Run("unset deletes the job", func(t *testing.T) {
+		client, wrapped := setup(t)
+
+		require.NoError(t, UnsetTTL(ctx, wrapped, "myapp", "default", "default"))
+		_, err := client.BatchV1().Jobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("abort window rejected", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		wrapped, err := WithBackend(fake.NewClientset(), BackendJobSleep)
+		require.NoError(t, err)
+
+		opts := setOpts
+		opts.AbortWindow = time.Minute
+		_, err = SetTTL(ctx, cfg, wrapped, opts)
+		assert.EqualError(t, err, "the job-sleep backend does not support --abort-window")
+	})
+
+	t.Run("export", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		wrapped, err := WithBackend(fake.NewClientset(), BackendJobSleep)
+		require.NoError(t, err)
+
+		objs, err := ExportTTL(ctx, cfg, wrapped, setOpts)
+		require.NoError(t, err)
+		job, ok := objs[len(objs)-1].(*batchv1.Job)
+		require.True(t, ok)
+		assert.Equal(t, BackendJobSleep, job.Labels[LabelBackend])
+	})
+}
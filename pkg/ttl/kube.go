@@ -1,11 +1,18 @@
 package ttl
 
 import (
+	"cmp"
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/josegonzalez/helm-ttl/pkg/batchcompat"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
@@ -17,6 +24,59 @@ type KubeOptions struct {
 	KubeContext string
 	Kubeconfig  string
 	Driver      string
+	// Backend is the backend TTLs are kept with: cronjob, job-sleep,
+	// controller or releasettl. Empty means HELM_TTL_BACKEND, else cronjob.
+	Backend string
+
+	// The settings below override the kubeconfig like the helm flags of
+	// the same names. Each falls back to the environment variable Helm
+	// passes it to plugins as: HELM_KUBEAPISERVER, HELM_KUBETOKEN,
+	// HELM_KUBEASUSER, HELM_KUBEASGROUPS (comma-separated),
+	// HELM_KUBECAFILE, HELM_KUBEINSECURE_SKIP_TLS_VERIFY,
+	// HELM_KUBETLS_SERVER_NAME, HELM_BURST_LIMIT and HELM_QPS.
+	APIServer             string
+	Token                 string
+	AsUser                string
+	AsGroups              []string
+	CAFile                string
+	InsecureSkipTLSVerify bool
+	TLSServerName         string
+	// BurstLimit and QPS throttle the client; zero keeps the default of
+	// Helm, 100, and of client-go.
+	BurstLimit int
+	QPS        float32
+	// Timeout bounds each API request, including those made without a
+	// context, such as the Helm storage lookups and the discovery of the
+	// CronJob API. It also cuts off watches and followed logs, so RunTTL
+	// needs it longer than the run. Zero leaves requests to their context.
+	Timeout time.Duration
+}
+
+// withEnv returns opts with the connection settings they leave unset
+// read from the environment Helm gives plugins.
+func (opts KubeOptions) withEnv() KubeOptions {
+	opts.KubeContext = cmp.Or(opts.KubeContext, os.Getenv("HELM_KUBECONTEXT"))
+	opts.Kubeconfig = cmp.Or(opts.Kubeconfig, os.Getenv("KUBECONFIG"))
+	opts.APIServer = cmp.Or(opts.APIServer, os.Getenv("HELM_KUBEAPISERVER"))
+	opts.Token = cmp.Or(opts.Token, os.Getenv("HELM_KUBETOKEN"))
+	opts.AsUser = cmp.Or(opts.AsUser, os.Getenv("HELM_KUBEASUSER"))
+	if len(opts.AsGroups) == 0 {
+		opts.AsGroups = envList("HELM_KUBEASGROUPS")
+	}
+	opts.CAFile = cmp.Or(opts.CAFile, os.Getenv("HELM_KUBECAFILE"))
+	if !opts.InsecureSkipTLSVerify {
+		opts.InsecureSkipTLSVerify, _ = strconv.ParseBool(os.Getenv("HELM_KUBEINSECURE_SKIP_TLS_VERIFY"))
+	}
+	opts.TLSServerName = cmp.Or(opts.TLSServerName, os.Getenv("HELM_KUBETLS_SERVER_NAME"))
+	if opts.BurstLimit == 0 {
+		opts.BurstLimit, _ = strconv.Atoi(os.Getenv("HELM_BURST_LIMIT"))
+	}
+	if opts.QPS == 0 {
+		qps, _ := strconv.ParseFloat(os.Getenv("HELM_QPS"), 32)
+		opts.QPS = float32(qps)
+	}
+
+	return opts
 }
 
 // RESTClientGetter implements genericclioptions.RESTClientGetter interface
@@ -24,6 +84,9 @@ type RESTClientGetter struct {
 	namespace   string
 	kubeContext string
 	kubeconfig  string
+	// opts holds the other connection settings, with the environment
+	// applied.
+	opts KubeOptions
 }
 
 // NewRESTClientGetter creates a new RESTClientGetter
@@ -32,12 +95,85 @@ func NewRESTClientGetter(namespace string, opts KubeOptions) *RESTClientGetter {
 		namespace:   namespace,
 		kubeContext: opts.KubeContext,
 		kubeconfig:  opts.Kubeconfig,
+		opts:        opts.withEnv(),
 	}
 }
 
-// ToRESTConfig returns a REST config
+// ToRESTConfig returns a REST config whose API calls are logged at debug
+// level and retried with backoff when throttled. Without a kubeconfig or
+// API server it uses the service account of the pod it runs in, so
+// helm-ttl can run inside the cluster.
 func (r *RESTClientGetter) ToRESTConfig() (*rest.Config, error) {
-	return r.ToRawKubeConfigLoader().ClientConfig()
+	config, err := r.toRESTConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	config.Burst = defaultBurstLimit
+	if r.opts.BurstLimit > 0 {
+		config.Burst = r.opts.BurstLimit
+	}
+	if r.opts.QPS > 0 {
+		config.QPS = r.opts.QPS
+	}
+	if r.opts.Timeout > 0 {
+		config.Timeout = r.opts.Timeout
+	}
+
+	// Each attempt is logged; retries wrap the logging
+	logRequests(config)
+	retryThrottled(config)
+	return config, nil
+}
+
+// defaultBurstLimit is the client-side burst Helm allows by default.
+const defaultBurstLimit = 100
+
+// loadInClusterConfig reads the config of the pod helm-ttl runs in; tests
+// replace it.
+var loadInClusterConfig = rest.InClusterConfig
+
+func (r *RESTClientGetter) toRESTConfig() (*rest.Config, error) {
+	loader := r.ToRawKubeConfigLoader()
+
+	// clientcmd falls back to the in-cluster config itself, but drops
+	// impersonation and the TLS overrides when it does.
+	raw, err := loader.RawConfig()
+	if err != nil || len(raw.Clusters) > 0 || r.opts.APIServer != "" {
+		return loader.ClientConfig()
+	}
+
+	config, err := loadInClusterConfig()
+	if errors.Is(err, rest.ErrNotInCluster) {
+		// Report the missing kubeconfig rather than the missing pod
+		return loader.ClientConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("using in-cluster config", "host", config.Host)
+
+	if r.opts.Token != "" {
+		config.BearerToken = r.opts.Token
+		config.BearerTokenFile = ""
+	}
+	if r.opts.CAFile != "" {
+		config.CAFile = r.opts.CAFile
+		config.CAData = nil
+	}
+	if r.opts.InsecureSkipTLSVerify {
+		config.Insecure = true
+		config.CAFile = ""
+		config.CAData = nil
+	}
+	if r.opts.TLSServerName != "" {
+		config.ServerName = r.opts.TLSServerName
+	}
+	config.Impersonate.UserName = r.opts.AsUser
+	config.Impersonate.Groups = r.opts.AsGroups
+
+	return config, nil
 }
 
 // ToDiscoveryClient returns a discovery client
@@ -87,17 +223,58 @@ func (r *RESTClientGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
 		configOverrides.CurrentContext = context
 	}
 	configOverrides.Context.Namespace = r.namespace
+	configOverrides.ClusterInfo.Server = r.opts.APIServer
+	configOverrides.ClusterInfo.CertificateAuthority = r.opts.CAFile
+	configOverrides.ClusterInfo.InsecureSkipTLSVerify = r.opts.InsecureSkipTLSVerify
+	configOverrides.ClusterInfo.TLSServerName = r.opts.TLSServerName
+	configOverrides.AuthInfo.Token = r.opts.Token
+	configOverrides.AuthInfo.Impersonate = r.opts.AsUser
+	configOverrides.AuthInfo.ImpersonateGroups = r.opts.AsGroups
 
 	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
 }
 
-// NewKubeClient creates a new Kubernetes clientset from the current kubeconfig.
+// NewKubeClient creates a new Kubernetes clientset from the current
+// kubeconfig, or the in-cluster config inside a pod, keeping TTLs with the backend of opts. With the cronjob
+// backend, on clusters without batch/v1 CronJobs it manages them in
+// batch/v1beta1, and on clusters with neither it fails.
 func NewKubeClient(opts KubeOptions) (kubernetes.Interface, error) {
+	backend := opts.Backend
+	if backend == "" {
+		backend = os.Getenv("HELM_TTL_BACKEND")
+	}
+	if _, err := LookupBackend(backend); err != nil {
+		return nil, err
+	}
+
 	getter := NewRESTClientGetter("default", opts)
 	config, err := getter.ToRESTConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	return kubernetes.NewForConfig(config)
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if backend == "" || backend == BackendCronJob {
+		wrapped, err := batchcompat.Wrap(client)
+		if err != nil {
+			return nil, fmt.Errorf("%w; use --backend %s on clusters without CronJobs", err, BackendJobSleep)
+		}
+
+		return wrapped, nil
+	}
+
+	if backend == BackendReleaseTTL {
+		dyn, err := dynamic.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+
+		return WithReleaseTTLs(client, dyn), nil
+	}
+
+	return WithBackend(client, backend)
 }
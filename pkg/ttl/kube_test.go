@@ -4,9 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/rest"
 )
 
 func TestNewRESTClientGetter(t *testing.T) {
@@ -155,6 +157,145 @@ func TestRESTClientGetter_ToRESTConfig_OptsKubeconfig(t *testing.T) {
 	assert.Equal(t, "https://127.0.0.1:6443", config.Host)
 }
 
+func TestRESTClientGetter_ToRESTConfig_HelmEnv(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("KUBECONFIG", "")
+	t.Setenv("HELM_KUBEAPISERVER", "https://10.0.0.1:6443")
+	t.Setenv("HELM_KUBETOKEN", "ci-token")
+	t.Setenv("HELM_KUBEASUSER", "deployer")
+	t.Setenv("HELM_KUBEASGROUPS", "ops,ci")
+	t.Setenv("HELM_KUBEINSECURE_SKIP_TLS_VERIFY", "true")
+	t.Setenv("HELM_KUBETLS_SERVER_NAME", "kube.example.com")
+	t.Setenv("HELM_BURST_LIMIT", "250")
+	t.Setenv("HELM_QPS", "50")
+
+	config, err := NewRESTClientGetter("default", KubeOptions{}).ToRESTConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "https://10.0.0.1:6443", config.Host)
+	assert.Equal(t, "ci-token", config.BearerToken)
+	assert.Equal(t, "deployer", config.Impersonate.UserName)
+	assert.Equal(t, []string{"ops", "ci"}, config.Impersonate.Groups)
+	assert.True(t, config.Insecure)
+	assert.Equal(t, "kube.example.com", config.ServerName)
+	assert.Equal(t, 250, config.Burst)
+	assert.Equal(t, float32(50), config.QPS)
+
+	t.Run("options override the environment", func(t *testing.T) {
+		config, err := NewRESTClientGetter("default", KubeOptions{
+			APIServer:  "https://10.0.0.2:6443",
+			Token:      "flag-token",
+			AsGroups:   []string{"admins"},
+			BurstLimit: 10,
+			Timeout:    time.Minute,
+		}).ToRESTConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "https://10.0.0.2:6443", config.Host)
+		assert.Equal(t, "flag-token", config.BearerToken)
+		assert.Equal(t, []string{"admins"}, config.Impersonate.Groups)
+		assert.Equal(t, "deployer", config.Impersonate.UserName)
+		assert.Equal(t, 10, config.Burst)
+		assert.Equal(t, time.Minute, config.Timeout)
+	})
+
+	t.Run("overrides the kubeconfig", func(t *testing.T) {
+		config, err := NewRESTClientGetter("default", KubeOptions{Kubeconfig: createTestKubeconfig(t)}).ToRESTConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "https://10.0.0.1:6443", config.Host)
+		assert.Equal(t, "ci-token", config.BearerToken)
+	})
+}
+
+func TestRESTClientGetter_ToRESTConfig_CAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "proxy-ca.crt")
+	require.NoError(t, os.WriteFile(caFile, []byte("test"), 0600))
+	t.Setenv("HELM_KUBEAPISERVER", "")
+	t.Setenv("HELM_KUBEINSECURE_SKIP_TLS_VERIFY", "")
+
+	t.Run("replaces the TLS settings of the kubeconfig", func(t *testing.T) {
+		t.Setenv("HELM_KUBECAFILE", "")
+
+		config, err := NewRESTClientGetter("default", KubeOptions{
+			Kubeconfig: createTestKubeconfig(t),
+			CAFile:     caFile,
+			APIServer:  "https://proxy.example.com:8443",
+		}).ToRESTConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "https://proxy.example.com:8443", config.Host)
+		assert.Equal(t, caFile, config.CAFile)
+		assert.False(t, config.Insecure)
+	})
+
+	t.Run("from HELM_KUBECAFILE", func(t *testing.T) {
+		t.Setenv("HELM_KUBECAFILE", caFile)
+
+		config, err := NewRESTClientGetter("default", KubeOptions{Kubeconfig: createTestKubeconfig(t)}).ToRESTConfig()
+		require.NoError(t, err)
+		assert.Equal(t, caFile, config.CAFile)
+		assert.False(t, config.Insecure)
+	})
+}
+
+func TestRESTClientGetter_ToRESTConfig_DefaultBurst(t *testing.T) {
+	t.Setenv("HELM_BURST_LIMIT", "")
+	t.Setenv("HELM_QPS", "")
+
+	config, err := NewRESTClientGetter("default", KubeOptions{Kubeconfig: createTestKubeconfig(t)}).ToRESTConfig()
+	require.NoError(t, err)
+	assert.Equal(t, 100, config.Burst)
+	assert.Zero(t, config.QPS)
+}
+
+func TestRESTClientGetter_ToRESTConfig_InCluster(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("KUBECONFIG", "")
+	t.Setenv("HELM_KUBEAPISERVER", "")
+	t.Setenv("HELM_KUBETOKEN", "")
+	t.Setenv("HELM_KUBEASUSER", "")
+	t.Setenv("HELM_KUBEASGROUPS", "")
+
+	calls := 0
+	orig := loadInClusterConfig
+	t.Cleanup(func() { loadInClusterConfig = orig })
+	loadInClusterConfig = func() (*rest.Config, error) {
+		calls++
+		return &rest.Config{
+			Host:            "https://10.96.0.1:443",
+			BearerTokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+		}, nil
+	}
+
+	t.Run("without a kubeconfig", func(t *testing.T) {
+		config, err := NewRESTClientGetter("default", KubeOptions{AsUser: "jane"}).ToRESTConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "https://10.96.0.1:443", config.Host)
+		assert.Equal(t, "/var/run/secrets/kubernetes.io/serviceaccount/token", config.BearerTokenFile)
+		assert.Equal(t, "jane", config.Impersonate.UserName)
+		assert.Equal(t, 100, config.Burst)
+	})
+
+	t.Run("token overrides the service account", func(t *testing.T) {
+		config, err := NewRESTClientGetter("default", KubeOptions{Token: "ci-token"}).ToRESTConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "ci-token", config.BearerToken)
+		assert.Empty(t, config.BearerTokenFile)
+	})
+
+	t.Run("a kubeconfig takes priority", func(t *testing.T) {
+		calls = 0
+		config, err := NewRESTClientGetter("default", KubeOptions{Kubeconfig: createTestKubeconfig(t)}).ToRESTConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "https://127.0.0.1:6443", config.Host)
+		assert.Zero(t, calls)
+	})
+
+	t.Run("not in a cluster", func(t *testing.T) {
+		loadInClusterConfig = func() (*rest.Config, error) { return nil, rest.ErrNotInCluster }
+
+		_, err := NewRESTClientGetter("default", KubeOptions{}).ToRESTConfig()
+		assert.ErrorContains(t, err, "no configuration has been provided")
+	})
+}
+
 func TestRESTClientGetter_ToDiscoveryClient_Success(t *testing.T) {
 	kubeconfigPath := createTestKubeconfig(t)
 	_ = os.Setenv("KUBECONFIG", kubeconfigPath)
@@ -203,3 +344,19 @@ func TestNewKubeClient_OptsKubeconfig(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotNil(t, client)
 }
+
+func TestNewKubeClient_Backend(t *testing.T) {
+	kubeconfigPath := createTestKubeconfig(t)
+
+	client, err := NewKubeClient(KubeOptions{Kubeconfig: kubeconfigPath, Backend: BackendJobSleep})
+	require.NoError(t, err)
+	assert.Equal(t, BackendJobSleep, BackendOf(client).Name())
+
+	t.Setenv("HELM_TTL_BACKEND", BackendJobSleep)
+	client, err = NewKubeClient(KubeOptions{Kubeconfig: kubeconfigPath})
+	require.NoError(t, err)
+	assert.Equal(t, BackendJobSleep, BackendOf(client).Name())
+
+	_, err = NewKubeClient(KubeOptions{Kubeconfig: kubeconfigPath, Backend: "deployment"})
+	assert.EqualError(t, err, `unknown backend "deployment": use controller or cronjob or job-sleep or releasettl`)
+}
@@ -0,0 +1,169 @@
+package ttl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// labelValueHashLen is the length of the hash suffix LabelValue appends
+	// to values it had to change.
+	labelValueHashLen = 10
+)
+
+// invalidLabelValueChars matches the runs of characters not allowed in a
+// label value.
+var invalidLabelValueChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// LabelValue returns s as a valid label value. A value that is too long or
+// contains characters labels do not allow is sanitized and suffixed with a
+// hash of s, so different inputs keep different values. The original is
+// kept in the annotation of the same key; see OriginalLabelValue.
+func LabelValue(s string) string {
+	if len(validation.IsValidLabelValue(s)) == 0 {
+		return s
+	}
+
+	sum := sha256.Sum256([]byte(s))
+	suffix := hex.EncodeToString(sum[:])[:labelValueHashLen]
+
+	v := invalidLabelValueChars.ReplaceAllString(s, "-")
+	if maxLen := validation.LabelValueMaxLength - labelValueHashLen - 1; len(v) > maxLen {
+		v = v[:maxLen]
+	}
+
+	v = strings.Trim(v, "-_.")
+	if v == "" {
+		return suffix
+	}
+
+	return v + "-" + suffix
+}
+
+// releaseLabels returns the labels helm-ttl puts on the resources it
+// creates for a release TTL, with sanitized values.
+func releaseLabels(releaseName, releaseNamespace string) map[string]string {
+	return map[string]string{
+		LabelManagedBy:        LabelManagedByValue,
+		LabelRelease:          LabelValue(releaseName),
+		LabelReleaseNamespace: LabelValue(releaseNamespace),
+		LabelSchemaVersion:    schemaVersionValue,
+	}
+}
+
+// releaseAnnotations returns the original values of the release labels,
+// which LabelValue may have changed.
+func releaseAnnotations(releaseName, releaseNamespace string) map[string]string {
+	return map[string]string{
+		LabelRelease:          releaseName,
+		LabelReleaseNamespace: releaseNamespace,
+	}
+}
+
+// OriginalLabelValue returns the original value of a helm-ttl label on
+// obj. It is read from the annotation of the same key, falling back to the
+// label itself for resources created before values were sanitized.
+func OriginalLabelValue(obj metav1.Object, key string) string {
+	if v, ok := obj.GetAnnotations()[key]; ok {
+		return v
+	}
+
+	return obj.GetLabels()[key]
+}
+
+// ownedByRelease reports whether obj was created for the TTL of a
+// release. It compares the original label values, since sanitized ones of
+// different releases may match the same selector.
+func ownedByRelease(obj metav1.Object, releaseName, releaseNamespace string) bool {
+	return OriginalLabelValue(obj, LabelRelease) == releaseName &&
+		OriginalLabelValue(obj, LabelReleaseNamespace) == releaseNamespace
+}
+
+// releaseSelector returns the label selector of the resources helm-ttl
+// creates for a release TTL, whatever schema version they were written
+// with.
+func releaseSelector(releaseName, releaseNamespace string) string {
+	return labels.SelectorFromSet(identityLabels(releaseLabels(releaseName, releaseNamespace))).String()
+}
+
+// setAnnotations sets the given annotations on meta, keeping any others.
+func setAnnotations(meta *metav1.ObjectMeta, annotations map[string]string) {
+	if len(annotations) == 0 {
+		return
+	}
+
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string, len(annotations))
+	}
+
+	for k, v := range annotations {
+		meta.Annotations[k] = v
+	}
+}
+
+// ParseCronJobLabels converts key=value pairs (e.g. from repeated
+// --cronjob-label flags) into labels for the CronJob of a TTL, its Job
+// template and pod template, such as a cost-center label. Keys under
+// helm-ttl/ and app.kubernetes.io/managed-by are reserved.
+func ParseCronJobLabels(values []string) (map[string]string, error) {
+	labels, err := parseKeyValues("--cronjob-label", "labels", values, validation.IsValidLabelValue)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := labels[LabelManagedBy]; ok {
+		return nil, fmt.Errorf("invalid --cronjob-label key %q: the label is reserved", LabelManagedBy)
+	}
+
+	return labels, nil
+}
+
+// ParseCronJobAnnotations converts key=value pairs (e.g. from repeated
+// --cronjob-annotation flags) into annotations for the CronJob of a TTL,
+// its Job template and pod template, such as
+// karpenter.sh/do-not-disrupt=true. Keys under helm-ttl/ are reserved.
+func ParseCronJobAnnotations(values []string) (map[string]string, error) {
+	return parseKeyValues("--cronjob-annotation", "annotations", values, nil)
+}
+
+// parseKeyValues converts the key=value pairs of a repeated flag into a
+// map, checking keys are qualified names outside helm-ttl/ and, when
+// validValue is set, the values too. Values may contain = and commas.
+func parseKeyValues(flag, kind string, values []string, validValue func(string) []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	m := make(map[string]string, len(values))
+	for _, kv := range values {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %q: expected key=value", flag, kv)
+		}
+
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid %s key %q: %s", flag, key, strings.Join(errs, "; "))
+		}
+
+		if strings.HasPrefix(key, "helm-ttl/") {
+			return nil, fmt.Errorf("invalid %s key %q: helm-ttl/ %s are reserved", flag, key, kind)
+		}
+
+		if validValue != nil {
+			if errs := validValue(value); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid %s value %q: %s", flag, value, strings.Join(errs, "; "))
+			}
+		}
+
+		m[key] = value
+	}
+
+	return m, nil
+}
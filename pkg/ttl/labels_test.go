@@ -0,0 +1,174 @@
+package ttl
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLabelValue(t *testing.T) {
+	t.Run("valid values are unchanged", func(t *testing.T) {
+		for _, v := range []string{"myapp", "MyApp", "my_app.v2", "", strings.Repeat("a", 63)} {
+			assert.Equal(t, v, LabelValue(v))
+		}
+	})
+
+	t.Run("long values are truncated and hashed", func(t *testing.T) {
+		long := strings.Repeat("a", 70)
+		v := LabelValue(long)
+		assert.Len(t, v, 63)
+		assert.Empty(t, validation.IsValidLabelValue(v))
+		assert.True(t, strings.HasPrefix(v, strings.Repeat("a", 52)+"-"))
+		assert.NotEqual(t, v, LabelValue(long+"b"))
+		assert.Equal(t, v, LabelValue(long))
+	})
+
+	t.Run("invalid characters are replaced", func(t *testing.T) {
+		v := LabelValue("my app/v2")
+		assert.Regexp(t, `^my-app-v2-[0-9a-f]{10}$`, v)
+		assert.NotEqual(t, v, LabelValue("my-app-v2"))
+	})
+
+	t.Run("ends are trimmed to alphanumerics", func(t *testing.T) {
+		assert.Regexp(t, `^app-[0-9a-f]{10}$`, LabelValue("-app-"))
+		assert.Regexp(t, `^[0-9a-f]{10}$`, LabelValue("!!!"))
+	})
+}
+
+func TestOriginalLabelValue(t *testing.T) {
+	obj := &metav1.ObjectMeta{
+		Labels:      map[string]string{LabelRelease: "sanitized", LabelReleaseNamespace: "default"},
+		Annotations: map[string]string{LabelRelease: "original"},
+	}
+
+	assert.Equal(t, "original", OriginalLabelValue(obj, LabelRelease))
+	assert.Equal(t, "default", OriginalLabelValue(obj, LabelReleaseNamespace))
+	assert.Empty(t, OriginalLabelValue(obj, LabelCronjobNamespace))
+}
+
+func TestSetAnnotations(t *testing.T) {
+	meta := &metav1.ObjectMeta{}
+	setAnnotations(meta, nil)
+	assert.Nil(t, meta.Annotations)
+
+	meta.Annotations = map[string]string{"other": "kept"}
+	setAnnotations(meta, map[string]string{LabelRelease: "myapp"})
+	assert.Equal(t, map[string]string{"other": "kept", LabelRelease: "myapp"}, meta.Annotations)
+
+	meta = &metav1.ObjectMeta{}
+	setAnnotations(meta, map[string]string{LabelRelease: "myapp"})
+	assert.Equal(t, map[string]string{LabelRelease: "myapp"}, meta.Annotations)
+}
+
+func TestSanitizedLabels(t *testing.T) {
+	ctx := context.Background()
+
+	// A release name no label value can hold, as can happen with storage
+	// drivers that do not validate names
+	release := "my app"
+
+	t.Run("CronJob keeps the original values in annotations", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{
+			ReleaseName:      release,
+			ReleaseNamespace: "default",
+			CronjobNamespace: "ops",
+			Schedule:         "30 14 15 3 *",
+			ServiceAccount:   "default",
+		})
+		require.NoError(t, err)
+
+		for _, v := range cj.Labels {
+			assert.Empty(t, validation.IsValidLabelValue(v))
+		}
+		assert.Equal(t, LabelValue(release), cj.Labels[LabelRelease])
+		assert.Equal(t, release, cj.Annotations[LabelRelease])
+		assert.Equal(t, "ops", cj.Annotations[LabelCronjobNamespace])
+		assert.Equal(t, release, OriginalLabelValue(cj, LabelRelease))
+	})
+
+	t.Run("orphan check reads the original values", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: ResourceName(release, "default"), Namespace: "default"}})
+
+		assert.False(t, isOrphaned(ctx, client, &metav1.ObjectMeta{
+			Labels:      releaseLabels(release, "default"),
+			Annotations: releaseAnnotations(release, "default"),
+		}, nil))
+		assert.True(t, isOrphaned(ctx, client, &metav1.ObjectMeta{
+			Labels: releaseLabels(release, "default"),
+		}, nil))
+	})
+
+	t.Run("list reports the original values", func(t *testing.T) {
+		client := fake.NewClientset(extendTestCronJob(t, release, "default", time.Now().Add(time.Hour)))
+
+		ttls, err := ListTTLs(ctx, client, "default", "default")
+		require.NoError(t, err)
+		require.Len(t, ttls, 1)
+		assert.Equal(t, release, ttls[0].ReleaseName)
+	})
+
+	t.Run("RBAC and history carry the original values", func(t *testing.T) {
+		client := fake.NewClientset()
+		require.NoError(t, CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true))
+
+		sa, err := client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "myapp", sa.Annotations[LabelRelease])
+
+		crb, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "staging", crb.Annotations[LabelReleaseNamespace])
+
+		require.NoError(t, RecordHistory(ctx, client, "myapp", "staging", "ops", HistoryEntry{Operation: OperationSet, User: "alice"}))
+		cm, err := client.CoreV1().ConfigMaps("ops").Get(ctx, HistoryConfigMapName("myapp", "staging"), metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "myapp", cm.Annotations[LabelRelease])
+	})
+}
+
+func TestParseCronJobLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   map[string]string
+		err    string
+	}{
+		{name: "none"},
+		{name: "labels", values: []string{"cost-center=1234", "example.com/team=platform"}, want: map[string]string{"cost-center": "1234", "example.com/team": "platform"}},
+		{name: "missing value", values: []string{"team"}, err: `invalid --cronjob-label "team": expected key=value`},
+		{name: "invalid key", values: []string{"bad key=x"}, err: `invalid --cronjob-label key "bad key"`},
+		{name: "invalid value", values: []string{"team=a,b"}, err: `invalid --cronjob-label value "a,b"`},
+		{name: "reserved key", values: []string{"helm-ttl/release=x"}, err: `invalid --cronjob-label key "helm-ttl/release": helm-ttl/ labels are reserved`},
+		{name: "managed-by", values: []string{"app.kubernetes.io/managed-by=me"}, err: `invalid --cronjob-label key "app.kubernetes.io/managed-by": the label is reserved`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCronJobLabels(tt.values)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseCronJobAnnotations(t *testing.T) {
+	got, err := ParseCronJobAnnotations([]string{"karpenter.sh/do-not-disrupt=true", "note=a=b, c"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"karpenter.sh/do-not-disrupt": "true", "note": "a=b, c"}, got)
+
+	_, err = ParseCronJobAnnotations([]string{"helm-ttl/generation=3"})
+	assert.EqualError(t, err, `invalid --cronjob-annotation key "helm-ttl/generation": helm-ttl/ annotations are reserved`)
+}
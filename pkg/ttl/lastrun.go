@@ -0,0 +1,156 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// LastRun is the most recent failed Job of a TTL, kept by the CronJob's
+// failedJobsHistoryLimit, with the logs of the containers that failed in
+// its last pod. Job is empty when no failed Job is left.
+type LastRun struct {
+	Job            string         `json:"job,omitempty" yaml:"job,omitempty"`
+	LastFailedTime string         `json:"last_failed_time,omitempty" yaml:"last_failed_time,omitempty"`
+	Reason         string         `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Message        string         `json:"message,omitempty" yaml:"message,omitempty"`
+	Pod            string         `json:"pod,omitempty" yaml:"pod,omitempty"`
+	Containers     []ContainerLog `json:"containers,omitempty" yaml:"containers,omitempty"`
+}
+
+// ContainerLog is the exit code and the tail of the logs of a container
+// that failed. Error explains why the logs could not be read, e.g. after
+// the node removed them.
+type ContainerLog struct {
+	Name     string `json:"name" yaml:"name"`
+	ExitCode int32  `json:"exit_code" yaml:"exit_code"`
+	Logs     string `json:"logs,omitempty" yaml:"logs,omitempty"`
+	Error    string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ttlJobSelector selects the Jobs run for the TTL of a release, by the
+// CronJob or by `helm ttl run`.
+func ttlJobSelector(releaseName, releaseNamespace string) string {
+	return labels.SelectorFromSet(labels.Set{
+		LabelRelease:          LabelValue(releaseName),
+		LabelReleaseNamespace: LabelValue(releaseNamespace),
+	}).String()
+}
+
+// LastFailedRun returns the most recent failed Job of the TTL for a
+// release, with the last failureLogLines lines of the logs of each
+// container that failed in its newest pod.
+func LastFailedRun(ctx context.Context, client kubernetes.Interface, logFetcher LogFetcher, releaseName, releaseNamespace, cronjobNamespace string) (*LastRun, error) {
+	jobs, err := client.BatchV1().Jobs(cronjobNamespace).List(ctx, metav1.ListOptions{LabelSelector: ttlJobSelector(releaseName, releaseNamespace)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Jobs: %w", err)
+	}
+
+	var last *batchv1.Job
+	var failed batchv1.JobCondition
+	for i, job := range jobs.Items {
+		for _, cond := range job.Status.Conditions {
+			if cond.Type != batchv1.JobFailed || cond.Status != corev1.ConditionTrue {
+				continue
+			}
+
+			if last == nil || cond.LastTransitionTime.After(failed.LastTransitionTime.Time) {
+				last, failed = &jobs.Items[i], cond
+			}
+		}
+	}
+
+	if last == nil {
+		return &LastRun{}, nil
+	}
+
+	run := &LastRun{Job: last.Name, Reason: failed.Reason, Message: failed.Message}
+	if !failed.LastTransitionTime.IsZero() {
+		run.LastFailedTime = FormatScheduledDate(failed.LastTransitionTime.Time)
+	}
+
+	pod, err := newestJobPod(ctx, client, cronjobNamespace, last.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if pod == nil {
+		return run, nil
+	}
+
+	run.Pod = pod.Name
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		terminated := status.State.Terminated
+		if terminated == nil || terminated.ExitCode == 0 {
+			continue
+		}
+
+		c := ContainerLog{Name: status.Name, ExitCode: terminated.ExitCode}
+		logs, err := containerLogTail(ctx, logFetcher, cronjobNamespace, pod.Name, status.Name, failureLogLines)
+		if err != nil {
+			c.Error = err.Error()
+		}
+		c.Logs = logs
+		run.Containers = append(run.Containers, c)
+	}
+
+	return run, nil
+}
+
+// containerLogTail returns the last n lines of the logs of a container.
+func containerLogTail(ctx context.Context, logFetcher LogFetcher, namespace, podName, containerName string, n int) (string, error) {
+	rc, err := logFetcher(ctx, namespace, podName, containerName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get logs for container %s: %w", containerName, err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return "", fmt.Errorf("failed to read logs for container %s: %w", containerName, err)
+	}
+
+	logs := strings.TrimRight(string(data), "\n")
+	if logs == "" {
+		return "", nil
+	}
+
+	lines := strings.Split(logs, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// formatLastRun formats the last failed run lines of the text output.
+func formatLastRun(run LastRun) string {
+	if run.Job == "" {
+		return "Last Failed Run:  none\n"
+	}
+
+	out := fmt.Sprintf("Last Failed Run:  %s (Job %s)\n", run.LastFailedTime, run.Job)
+	if run.Reason != "" {
+		out += fmt.Sprintf("  Reason:         %s: %s\n", run.Reason, run.Message)
+	}
+	if run.Pod != "" {
+		out += fmt.Sprintf("  Pod:            %s\n", run.Pod)
+	}
+
+	for _, c := range run.Containers {
+		out += fmt.Sprintf("==> Container: %s (exit code %d) <==\n", c.Name, c.ExitCode)
+		if c.Error != "" {
+			out += fmt.Sprintf("(%s)\n", c.Error)
+		}
+		out += c.Logs
+	}
+
+	return out
+}
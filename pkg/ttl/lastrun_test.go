@@ -0,0 +1,211 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// failedJob returns a TTL Job for myapp in staging that failed at t.
+func failedJob(name string, t time.Time) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "ops",
+			Labels:    releaseLabels("myapp", "staging"),
+		},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobComplete, Status: corev1.ConditionFalse},
+			{
+				Type:               batchv1.JobFailed,
+				Status:             corev1.ConditionTrue,
+				Reason:             "BackoffLimitExceeded",
+				Message:            "Job has reached the specified backoff limit",
+				LastTransitionTime: metav1.NewTime(t),
+			},
+		}},
+	}
+}
+
+// jobPod returns a pod of a Job created at t, with the given init
+// container exit codes.
+func jobPod(name, job string, t time.Time, exitCodes map[string]int32) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         "ops",
+		Labels:            map[string]string{"job-name": job},
+		CreationTimestamp: metav1.NewTime(t),
+	}}
+
+	for _, c := range []string{"helm-uninstall", "verify-uninstall"} {
+		status := corev1.ContainerStatus{Name: c}
+		if code, ok := exitCodes[c]; ok {
+			status.State.Terminated = &corev1.ContainerStateTerminated{ExitCode: code}
+		} else {
+			status.State.Waiting = &corev1.ContainerStateWaiting{Reason: "PodInitializing"}
+		}
+		pod.Status.InitContainerStatuses = append(pod.Status.InitContainerStatuses, status)
+	}
+
+	return pod
+}
+
+func TestLastFailedRun(t *testing.T) {
+	ctx := context.Background()
+	failedAt := time.Date(2026, 3, 15, 14, 35, 0, 0, time.UTC)
+
+	t.Run("newest failed Job and pod", func(t *testing.T) {
+		client := fake.NewClientset(
+			failedJob("myapp-ttl-1", failedAt.Add(-time.Hour)),
+			failedJob("myapp-ttl-2", failedAt),
+			jobPod("myapp-ttl-2-old", "myapp-ttl-2", failedAt.Add(-10*time.Minute), map[string]int32{"helm-uninstall": 1}),
+			jobPod("myapp-ttl-2-new", "myapp-ttl-2", failedAt.Add(-5*time.Minute), map[string]int32{"helm-uninstall": 0, "verify-uninstall": 1}),
+		)
+
+		var fetched []string
+		fetcher := func(_ context.Context, namespace, pod, container string) (io.ReadCloser, error) {
+			fetched = append(fetched, namespace+"/"+pod+"/"+container)
+			return io.NopCloser(strings.NewReader(`release "myapp" still has storage records after uninstall` + "\n")), nil
+		}
+
+		run, err := LastFailedRun(ctx, client, fetcher, "myapp", "staging", "ops")
+		require.NoError(t, err)
+		assert.Equal(t, &LastRun{
+			Job:            "myapp-ttl-2",
+			LastFailedTime: "2026-03-15T14:35:00Z",
+			Reason:         "BackoffLimitExceeded",
+			Message:        "Job has reached the specified backoff limit",
+			Pod:            "myapp-ttl-2-new",
+			Containers: []ContainerLog{{
+				Name:     "verify-uninstall",
+				ExitCode: 1,
+				Logs:     `release "myapp" still has storage records after uninstall` + "\n",
+			}},
+		}, run)
+		assert.Equal(t, []string{"ops/myapp-ttl-2-new/verify-uninstall"}, fetched)
+	})
+
+	t.Run("no failed Job", func(t *testing.T) {
+		job := failedJob("myapp-ttl-1", failedAt)
+		job.Status.Conditions = nil
+		client := fake.NewClientset(job)
+
+		run, err := LastFailedRun(ctx, client, testLogFetcher(""), "myapp", "staging", "ops")
+		require.NoError(t, err)
+		assert.Equal(t, &LastRun{}, run)
+	})
+
+	t.Run("pods already gone", func(t *testing.T) {
+		client := fake.NewClientset(failedJob("myapp-ttl-1", failedAt))
+
+		run, err := LastFailedRun(ctx, client, testLogFetcher(""), "myapp", "staging", "ops")
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-ttl-1", run.Job)
+		assert.Empty(t, run.Pod)
+		assert.Empty(t, run.Containers)
+	})
+
+	t.Run("logs unavailable", func(t *testing.T) {
+		client := fake.NewClientset(
+			failedJob("myapp-ttl-1", failedAt),
+			jobPod("myapp-ttl-1-abcde", "myapp-ttl-1", failedAt, map[string]int32{"helm-uninstall": 1}),
+		)
+		fetcher := func(context.Context, string, string, string) (io.ReadCloser, error) {
+			return nil, fmt.Errorf("unable to retrieve container logs")
+		}
+
+		run, err := LastFailedRun(ctx, client, fetcher, "myapp", "staging", "ops")
+		require.NoError(t, err)
+		assert.Equal(t, []ContainerLog{{
+			Name:     "helm-uninstall",
+			ExitCode: 1,
+			Error:    "failed to get logs for container helm-uninstall: unable to retrieve container logs",
+		}}, run.Containers)
+	})
+
+	t.Run("list errors", func(t *testing.T) {
+		for _, resource := range []string{"jobs", "pods"} {
+			client := fake.NewClientset(failedJob("myapp-ttl-1", failedAt))
+			client.PrependReactor("list", resource, func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, fmt.Errorf("forbidden")
+			})
+
+			_, err := LastFailedRun(ctx, client, testLogFetcher(""), "myapp", "staging", "ops")
+			assert.ErrorContains(t, err, "forbidden", resource)
+		}
+	})
+}
+
+func TestContainerLogTail(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		logs string
+		want string
+	}{
+		{name: "empty", logs: "", want: ""},
+		{name: "short", logs: "one\ntwo\n", want: "one\ntwo\n"},
+		{name: "no trailing newline", logs: "one\ntwo", want: "one\ntwo\n"},
+		{name: "long", logs: "one\ntwo\nthree\nfour\n", want: "three\nfour\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := containerLogTail(ctx, testLogFetcher(tt.logs), "ops", "pod", "helm-uninstall", 2)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("read error", func(t *testing.T) {
+		fetcher := func(context.Context, string, string, string) (io.ReadCloser, error) {
+			return io.NopCloser(errReader{}), nil
+		}
+
+		_, err := containerLogTail(ctx, fetcher, "ops", "pod", "helm-uninstall", 2)
+		assert.EqualError(t, err, "failed to read logs for container helm-uninstall: connection reset")
+	})
+}
+
+// errReader fails every read.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, fmt.Errorf("connection reset")
+}
+
+func TestFormatLastRun(t *testing.T) {
+	assert.Equal(t, "Last Failed Run:  none\n", formatLastRun(LastRun{}))
+
+	assert.Equal(t, "Last Failed Run:  2026-03-15T14:35:00Z (Job myapp-ttl-1)\n"+
+		"  Reason:         DeadlineExceeded: Job was active longer than specified deadline\n"+
+		"  Pod:            myapp-ttl-1-abcde\n"+
+		"==> Container: helm-uninstall (exit code 1) <==\n"+
+		"Error: uninstall: timed out\n"+
+		"==> Container: verify-uninstall (exit code 2) <==\n"+
+		"(failed to get logs for container verify-uninstall: gone)\n",
+		formatLastRun(LastRun{
+			Job:            "myapp-ttl-1",
+			LastFailedTime: "2026-03-15T14:35:00Z",
+			Reason:         "DeadlineExceeded",
+			Message:        "Job was active longer than specified deadline",
+			Pod:            "myapp-ttl-1-abcde",
+			Containers: []ContainerLog{
+				{Name: "helm-uninstall", ExitCode: 1, Logs: "Error: uninstall: timed out\n"},
+				{Name: "verify-uninstall", ExitCode: 2, Error: "failed to get logs for container verify-uninstall: gone"},
+			},
+		}))
+}
@@ -0,0 +1,67 @@
+package ttl
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+// logger receives the debug output of the package: Kubernetes API calls,
+// built manifests and parsed durations. It discards everything until
+// SetLogger is called.
+var logger = slog.New(slog.DiscardHandler)
+
+// SetLogger directs the package's debug logging to l. A nil logger
+// discards it again. It is meant to be called once at startup, before
+// any other function of the package.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	}
+
+	logger = l
+}
+
+// logManifest logs obj as YAML, for checking what would be applied.
+func logManifest(msg string, obj any) {
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+
+	manifest, err := yaml.Marshal(obj)
+	if err != nil {
+		logger.Debug(msg, "error", err)
+		return
+	}
+
+	logger.Debug(msg, "manifest", string(manifest))
+}
+
+// logRequests wraps a REST config's transport so every Kubernetes API
+// call is logged with its status and latency.
+func logRequests(config *rest.Config) {
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return loggingRoundTripper{next: rt}
+	})
+}
+
+type loggingRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (l loggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := l.next.RoundTrip(req)
+	attrs := []any{"method", req.Method, "url", req.URL.String(), "duration", time.Since(started)}
+	if err != nil {
+		logger.Debug("kubernetes API request failed", append(attrs, "error", err)...)
+		return resp, err
+	}
+
+	logger.Debug("kubernetes API request", append(attrs, "status", resp.StatusCode)...)
+	return resp, nil
+}
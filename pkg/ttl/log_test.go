@@ -0,0 +1,125 @@
+package ttl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+// captureLogs sends the package's debug logging to a buffer for the
+// duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { SetLogger(nil) })
+
+	return &buf
+}
+
+type failingRoundTripper struct{}
+
+func (failingRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestSetLogger(t *testing.T) {
+	buf := captureLogs(t)
+	logger.Debug("visible")
+	assert.Contains(t, buf.String(), "msg=visible")
+
+	SetLogger(nil)
+	logger.Debug("hidden")
+	assert.NotContains(t, buf.String(), "hidden")
+}
+
+func TestLogManifest(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		logManifest("built CronJob", make(chan int))
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		buf := captureLogs(t)
+		logManifest("built CronJob", metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl"})
+		assert.Contains(t, buf.String(), `msg="built CronJob" manifest="name: myapp-4a0c226a-ttl\n"`)
+	})
+
+	t.Run("marshal error", func(t *testing.T) {
+		buf := captureLogs(t)
+		logManifest("built CronJob", make(chan int))
+		assert.Contains(t, buf.String(), `msg="built CronJob" error=`)
+	})
+}
+
+func TestLogRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	t.Run("logs method, URL and status", func(t *testing.T) {
+		buf := captureLogs(t)
+		config := &rest.Config{Host: server.URL}
+		logRequests(config)
+
+		rt, err := rest.TransportFor(config)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/namespaces/default/secrets", nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		assert.Contains(t, buf.String(), `msg="kubernetes API request" method=GET url=`+server.URL+`/api/v1/namespaces/default/secrets`)
+		assert.Contains(t, buf.String(), "status=404")
+	})
+
+	t.Run("logs transport errors", func(t *testing.T) {
+		buf := captureLogs(t)
+		req, err := http.NewRequest(http.MethodDelete, "https://127.0.0.1:6443/apis/batch/v1/namespaces/default/cronjobs/x", nil)
+		require.NoError(t, err)
+
+		_, err = loggingRoundTripper{next: failingRoundTripper{}}.RoundTrip(req)
+		assert.EqualError(t, err, "connection refused")
+		assert.Contains(t, buf.String(), `msg="kubernetes API request failed" method=DELETE`)
+		assert.Contains(t, buf.String(), `error="connection refused"`)
+	})
+
+	t.Run("ToRESTConfig wraps the transport", func(t *testing.T) {
+		getter := NewRESTClientGetter("default", KubeOptions{Kubeconfig: createTestKubeconfig(t)})
+		config, err := getter.ToRESTConfig()
+		require.NoError(t, err)
+		assert.NotNil(t, config.WrapTransport)
+	})
+}
+
+func TestSetTTL_DebugLogging(t *testing.T) {
+	buf := captureLogs(t)
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+
+	_, err := SetTTL(context.Background(), cfg, fake.NewClientset(), SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "2 days",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+		DateOrder:            "mdy",
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, buf.String(), `msg="parsed duration" release=myapp input="2 days" dateOrder=mdy target=`)
+	assert.Contains(t, buf.String(), " schedule=")
+	assert.Contains(t, buf.String(), `msg="built CronJob" manifest=`)
+}
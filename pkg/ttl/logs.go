@@ -0,0 +1,118 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// TTLLogsOptions selects the logs TTLLogs streams.
+type TTLLogsOptions struct {
+	ReleaseName      string
+	ReleaseNamespace string
+	CronjobNamespace string
+	// Container limits the logs to one container of the pod, such as
+	// helm-uninstall.
+	Container string
+}
+
+// NoTTLJobError is returned when no Job was run for the TTL of a release.
+type NoTTLJobError struct {
+	ReleaseName string
+}
+
+func (e *NoTTLJobError) Error() string {
+	return fmt.Sprintf("no uninstall Job found for release %q: the TTL has not fired, or its Jobs were deleted with the CronJob", e.ReleaseName)
+}
+
+// TTLLogs writes to w the logs of the newest pod of the newest Job run for
+// the TTL of a release, by its CronJob or by `helm ttl run`: one section per
+// container, in the order they ran. Containers that have not started yet
+// are skipped; the logs of a running container are followed until it
+// terminates.
+func TTLLogs(ctx context.Context, client kubernetes.Interface, w io.Writer, logFetcher LogFetcher, opts TTLLogsOptions) error {
+	jobs, err := client.BatchV1().Jobs(opts.CronjobNamespace).List(ctx, metav1.ListOptions{LabelSelector: ttlJobSelector(opts.ReleaseName, opts.ReleaseNamespace)})
+	if err != nil {
+		return fmt.Errorf("failed to list Jobs: %w", err)
+	}
+
+	var job *batchv1.Job
+	for i := range jobs.Items {
+		if job == nil || jobs.Items[i].CreationTimestamp.After(job.CreationTimestamp.Time) {
+			job = &jobs.Items[i]
+		}
+	}
+
+	if job == nil {
+		return &NoTTLJobError{ReleaseName: opts.ReleaseName}
+	}
+
+	pod, err := newestJobPod(ctx, client, opts.CronjobNamespace, job.Name)
+	if err != nil {
+		return err
+	}
+
+	if pod == nil {
+		return fmt.Errorf("job %s has no pods left", job.Name)
+	}
+
+	// Init containers ran first; build a new slice so the pod's own
+	// statuses are not appended to in place
+	statuses := make([]corev1.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	if opts.Container != "" {
+		i := slices.IndexFunc(statuses, func(s corev1.ContainerStatus) bool { return s.Name == opts.Container })
+		if i < 0 {
+			names := make([]string, 0, len(statuses))
+			for _, s := range statuses {
+				names = append(names, s.Name)
+			}
+
+			return fmt.Errorf("container %q not found in pod %s; its containers are %s", opts.Container, pod.Name, strings.Join(names, ", "))
+		}
+
+		statuses = statuses[i : i+1]
+	}
+
+	_, _ = fmt.Fprintf(w, "Job: %s\nPod: %s\n", job.Name, pod.Name)
+	for _, s := range statuses {
+		if s.State.Running == nil && s.State.Terminated == nil {
+			if opts.Container != "" {
+				return fmt.Errorf("container %q of pod %s has not started", s.Name, pod.Name)
+			}
+			continue
+		}
+
+		if err := streamContainerLogs(ctx, logFetcher, w, opts.CronjobNamespace, pod.Name, s.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newestJobPod returns the most recently created pod of a Job, or nil when
+// it has none.
+func newestJobPod(ctx context.Context, client kubernetes.Interface, namespace, jobName string) (*corev1.Pod, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + jobName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of Job %s: %w", jobName, err)
+	}
+
+	var pod *corev1.Pod
+	for i := range pods.Items {
+		if pod == nil || pods.Items[i].CreationTimestamp.After(pod.CreationTimestamp.Time) {
+			pod = &pods.Items[i]
+		}
+	}
+
+	return pod, nil
+}
@@ -0,0 +1,114 @@
+package ttl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// containerLogFetcher returns a LogFetcher printing the name of the
+// container whose logs are fetched.
+func containerLogFetcher(_ context.Context, _, _, container string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(container + " output\n")), nil
+}
+
+func TestTTLLogs(t *testing.T) {
+	ctx := context.Background()
+	started := time.Date(2026, 3, 15, 14, 30, 0, 0, time.UTC)
+	opts := TTLLogsOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", CronjobNamespace: "ops"}
+
+	job := func(name string, created time.Time) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "ops",
+			Labels:            releaseLabels("myapp", "staging"),
+			CreationTimestamp: metav1.NewTime(created),
+		}}
+	}
+
+	objects := func() []runtime.Object {
+		pod := jobPod("myapp-ttl-2-new", "myapp-ttl-2", started.Add(time.Minute), map[string]int32{"helm-uninstall": 1})
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "self-cleanup"}}
+
+		return []runtime.Object{
+			job("myapp-ttl-1", started.Add(-time.Hour)),
+			job("myapp-ttl-2", started),
+			jobPod("myapp-ttl-2-old", "myapp-ttl-2", started, map[string]int32{"helm-uninstall": 1}),
+			pod,
+		}
+	}
+
+	t.Run("containers that ran", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, TTLLogs(ctx, fake.NewClientset(objects()...), &buf, containerLogFetcher, opts))
+		assert.Equal(t, "Job: myapp-ttl-2\n"+
+			"Pod: myapp-ttl-2-new\n"+
+			"==> Container: helm-uninstall <==\n"+
+			"helm-uninstall output\n", buf.String())
+	})
+
+	t.Run("one container", func(t *testing.T) {
+		o := opts
+		o.Container = "helm-uninstall"
+
+		var buf bytes.Buffer
+		require.NoError(t, TTLLogs(ctx, fake.NewClientset(objects()...), &buf, containerLogFetcher, o))
+		assert.Contains(t, buf.String(), "==> Container: helm-uninstall <==\n")
+
+		o.Container = "verify-uninstall"
+		err := TTLLogs(ctx, fake.NewClientset(objects()...), io.Discard, containerLogFetcher, o)
+		assert.EqualError(t, err, `container "verify-uninstall" of pod myapp-ttl-2-new has not started`)
+
+		o.Container = "delete-namespace"
+		err = TTLLogs(ctx, fake.NewClientset(objects()...), io.Discard, containerLogFetcher, o)
+		assert.EqualError(t, err, `container "delete-namespace" not found in pod myapp-ttl-2-new; its containers are helm-uninstall, verify-uninstall, self-cleanup`)
+	})
+
+	t.Run("no Job", func(t *testing.T) {
+		err := TTLLogs(ctx, fake.NewClientset(), io.Discard, containerLogFetcher, opts)
+
+		var noJob *NoTTLJobError
+		require.True(t, errors.As(err, &noJob))
+		assert.EqualError(t, err, `no uninstall Job found for release "myapp": the TTL has not fired, or its Jobs were deleted with the CronJob`)
+	})
+
+	t.Run("no pods", func(t *testing.T) {
+		err := TTLLogs(ctx, fake.NewClientset(job("myapp-ttl-1", started)), io.Discard, containerLogFetcher, opts)
+		assert.EqualError(t, err, "job myapp-ttl-1 has no pods left")
+	})
+
+	t.Run("log error", func(t *testing.T) {
+		fetcher := func(context.Context, string, string, string) (io.ReadCloser, error) {
+			return nil, fmt.Errorf("unable to retrieve container logs")
+		}
+
+		err := TTLLogs(ctx, fake.NewClientset(objects()...), io.Discard, fetcher, opts)
+		assert.EqualError(t, err, "failed to get logs for container helm-uninstall: unable to retrieve container logs")
+	})
+
+	t.Run("list errors", func(t *testing.T) {
+		for _, resource := range []string{"jobs", "pods"} {
+			client := fake.NewClientset(objects()...)
+			client.PrependReactor("list", resource, func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, fmt.Errorf("forbidden")
+			})
+
+			err := TTLLogs(ctx, client, io.Discard, containerLogFetcher, opts)
+			assert.ErrorContains(t, err, "forbidden", resource)
+		}
+	})
+}
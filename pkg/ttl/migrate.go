@@ -0,0 +1,327 @@
+package ttl
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	k8syaml "sigs.k8s.io/yaml"
+
+	"github.com/josegonzalez/helm-ttl/pkg/api/v1alpha1"
+)
+
+// DumpKind is the kind of the file DumpTTLs returns.
+const DumpKind = "TTLDump"
+
+// Dump holds the TTLs of a cluster, to recreate them in another one with
+// ImportTTLs.
+type Dump struct {
+	APIVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	TTLs       []DumpedTTL `json:"ttls"`
+}
+
+// DumpedTTL is a release or namespace TTL in a Dump: its CronJob, which
+// holds all of its options, and the ServiceAccount and RBAC created for
+// it, if any. ExpiresAt is read back on import and wins over the
+// schedule of the CronJob, so it can be edited to move the expiry; the
+// other summary fields are only for reading.
+type DumpedTTL struct {
+	Release          string `json:"release,omitempty"`
+	ReleaseNamespace string `json:"releaseNamespace,omitempty"`
+	// Namespace is the namespace a namespace TTL deletes.
+	Namespace        string      `json:"namespace,omitempty"`
+	CronjobNamespace string      `json:"cronjobNamespace"`
+	ExpiresAt        metav1.Time `json:"expiresAt"`
+
+	CronJob             *batchv1.CronJob            `json:"cronJob"`
+	ServiceAccount      *corev1.ServiceAccount      `json:"serviceAccount,omitempty"`
+	Roles               []rbacv1.Role               `json:"roles,omitempty"`
+	RoleBindings        []rbacv1.RoleBinding        `json:"roleBindings,omitempty"`
+	ClusterRoles        []rbacv1.ClusterRole        `json:"clusterRoles,omitempty"`
+	ClusterRoleBindings []rbacv1.ClusterRoleBinding `json:"clusterRoleBindings,omitempty"`
+}
+
+// DumpTTLs returns every release and namespace TTL whose CronJob lives in
+// cronjobNamespace, or in any namespace when it is empty, with the
+// ServiceAccount and RBAC created for each. Nothing in the cluster
+// changes.
+func DumpTTLs(ctx context.Context, client kubernetes.Interface, cronjobNamespace string) (*Dump, error) {
+	list, err := client.BatchV1().CronJobs(cronjobNamespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{LabelManagedBy: LabelManagedByValue}.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list TTLs: %w", err)
+	}
+
+	items := list.Items
+	slices.SortFunc(items, func(a, b batchv1.CronJob) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Name, b.Name))
+	})
+
+	now := time.Now()
+	dump := &Dump{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: DumpKind, TTLs: []DumpedTTL{}}
+	for i := range items {
+		cj := &items[i]
+		expiresAt, _, err := resolveExpiry(cj, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the expiry of TTL %s/%s: %w", cj.Namespace, cj.Name, err)
+		}
+
+		d := DumpedTTL{
+			CronjobNamespace: cj.Namespace,
+			ExpiresAt:        metav1.NewTime(expiresAt.UTC()),
+			CronJob:          portableCronJob(cj),
+		}
+		releaseNs := TargetNamespace(cj)
+		if IsNamespaceTTL(cj) {
+			d.Namespace = releaseNs
+		} else {
+			d.Release = OriginalLabelValue(cj, LabelRelease)
+			d.ReleaseNamespace = OriginalLabelValue(cj, LabelReleaseNamespace)
+			releaseNs = d.ReleaseNamespace
+		}
+
+		if err := dumpRBAC(ctx, client, &d, releaseNs, cronJobExtraNamespaces(cj)); err != nil {
+			return nil, err
+		}
+
+		dump.TTLs = append(dump.TTLs, d)
+	}
+
+	return dump, nil
+}
+
+// dumpRBAC adds the ServiceAccount and RBAC created for the TTL of d to
+// it.
+func dumpRBAC(ctx context.Context, client kubernetes.Interface, d *DumpedTTL, releaseNamespace string, extraNamespaces []string) error {
+	name := d.CronJob.Name
+	resources, err := existingRBAC(ctx, client, name, releaseNamespace, d.CronjobNamespace, extraNamespaces...)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range resources {
+		var err error
+		switch r.Kind {
+		case "ServiceAccount":
+			var sa *corev1.ServiceAccount
+			if sa, err = client.CoreV1().ServiceAccounts(r.Namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+				d.ServiceAccount = &corev1.ServiceAccount{ObjectMeta: portableObjectMeta(sa.ObjectMeta), ImagePullSecrets: sa.ImagePullSecrets}
+			}
+		case "Role":
+			var role *rbacv1.Role
+			if role, err = client.RbacV1().Roles(r.Namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+				d.Roles = append(d.Roles, rbacv1.Role{ObjectMeta: portableObjectMeta(role.ObjectMeta), Rules: role.Rules})
+			}
+		case "RoleBinding":
+			var binding *rbacv1.RoleBinding
+			if binding, err = client.RbacV1().RoleBindings(r.Namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+				d.RoleBindings = append(d.RoleBindings, rbacv1.RoleBinding{ObjectMeta: portableObjectMeta(binding.ObjectMeta), Subjects: binding.Subjects, RoleRef: binding.RoleRef})
+			}
+		case "ClusterRole":
+			var role *rbacv1.ClusterRole
+			if role, err = client.RbacV1().ClusterRoles().Get(ctx, name, metav1.GetOptions{}); err == nil {
+				d.ClusterRoles = append(d.ClusterRoles, rbacv1.ClusterRole{ObjectMeta: portableObjectMeta(role.ObjectMeta), Rules: role.Rules})
+			}
+		case "ClusterRoleBinding":
+			var binding *rbacv1.ClusterRoleBinding
+			if binding, err = client.RbacV1().ClusterRoleBindings().Get(ctx, name, metav1.GetOptions{}); err == nil {
+				d.ClusterRoleBindings = append(d.ClusterRoleBindings, rbacv1.ClusterRoleBinding{ObjectMeta: portableObjectMeta(binding.ObjectMeta), Subjects: binding.Subjects, RoleRef: binding.RoleRef})
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get %s %s: %w", r.Kind, name, err)
+		}
+	}
+
+	return nil
+}
+
+// FormatDump renders a Dump as YAML.
+func FormatDump(dump *Dump) (string, error) {
+	out, err := k8syaml.Marshal(dump)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal TTLs: %w", err)
+	}
+
+	return string(out), nil
+}
+
+// ParseDump reads a Dump written by FormatDump.
+func ParseDump(data []byte) (*Dump, error) {
+	var dump Dump
+	if err := k8syaml.UnmarshalStrict(data, &dump); err != nil {
+		return nil, fmt.Errorf("failed to read TTLs: %w", err)
+	}
+
+	if dump.APIVersion != v1alpha1.SchemeGroupVersion.String() || dump.Kind != DumpKind {
+		return nil, fmt.Errorf("not a TTL dump: want apiVersion %s and kind %s, got %q and %q", v1alpha1.SchemeGroupVersion, DumpKind, dump.APIVersion, dump.Kind)
+	}
+
+	for i, d := range dump.TTLs {
+		if d.CronJob == nil || d.CronJob.Name == "" || d.CronjobNamespace == "" {
+			return nil, fmt.Errorf("TTL %d of the dump needs a cronJob with a name and a cronjobNamespace", i+1)
+		}
+	}
+
+	return &dump, nil
+}
+
+// ImportResult reports a TTL ImportTTLs recreated or skipped.
+type ImportResult struct {
+	ReleaseName      string `json:"release_name,omitempty" yaml:"release_name,omitempty"`
+	ReleaseNamespace string `json:"release_namespace,omitempty" yaml:"release_namespace,omitempty"`
+	// Namespace is the namespace a namespace TTL deletes.
+	Namespace        string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	CronjobNamespace string `json:"cronjob_namespace" yaml:"cronjob_namespace"`
+	Expiry           string `json:"expiry" yaml:"expiry"`
+	// Expired is set when the TTL was skipped because it expired already.
+	Expired bool `json:"expired,omitempty" yaml:"expired,omitempty"`
+	// Error is set when this TTL could not be recreated.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Warnings lists what may keep the recreated TTL from working, such
+	// as a release missing from the cluster.
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// ImportTTLs recreates the TTLs of dump with client, the same expiry and
+// options, and the ServiceAccount and RBAC they had. An existing TTL is
+// replaced. TTLs that already expired are skipped, and the releases are
+// not looked up beyond a warning, so migrate them first. A TTL that fails
+// is reported in its result and the others are still imported.
+func ImportTTLs(ctx context.Context, client kubernetes.Interface, dump *Dump) []ImportResult {
+	now := time.Now()
+	results := make([]ImportResult, 0, len(dump.TTLs))
+	for _, d := range dump.TTLs {
+		result := ImportResult{
+			ReleaseName:      d.Release,
+			ReleaseNamespace: d.ReleaseNamespace,
+			Namespace:        d.Namespace,
+			CronjobNamespace: d.CronjobNamespace,
+			Expiry:           FormatScheduledDate(d.ExpiresAt.Time),
+		}
+
+		expired, warnings, err := importTTL(ctx, client, d, now)
+		result.Expired = expired
+		result.Warnings = warnings
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// importTTL recreates the TTL of d, reporting whether it was skipped as
+// expired.
+func importTTL(ctx context.Context, client kubernetes.Interface, d DumpedTTL, now time.Time) (bool, []string, error) {
+	cj := portableCronJob(d.CronJob)
+	cj.Namespace = d.CronjobNamespace
+	expiresAt := d.ExpiresAt.Time
+	if expiresAt.IsZero() {
+		var err error
+		if expiresAt, _, err = resolveExpiry(cj, now); err != nil {
+			return false, nil, fmt.Errorf("failed to read the expiry: %w", err)
+		}
+	}
+	if !expiresAt.After(now) {
+		return true, nil, nil
+	}
+
+	expiresAt = expiresAt.In(now.Location())
+	cj.Spec.Schedule = TimeToCronSchedule(expiresAt)
+	setExpiry(cj, expiresAt)
+
+	backend := BackendOf(client)
+	if _, err := backend.Object(cj, now); err != nil {
+		return false, nil, err
+	}
+
+	releaseNs := cmp.Or(d.ReleaseNamespace, d.Namespace)
+	saName := cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName
+	createdSA := d.ServiceAccount != nil && d.ServiceAccount.Name == saName
+	if backend.RunsJobs() {
+		if !createdSA && saName != "" {
+			if _, err := client.CoreV1().ServiceAccounts(d.CronjobNamespace).Get(ctx, saName, metav1.GetOptions{}); errors.IsNotFound(err) {
+				return false, nil, &ServiceAccountNotFoundError{Name: saName, Namespace: d.CronjobNamespace}
+			} else if err != nil {
+				return false, nil, fmt.Errorf("failed to check service account: %w", err)
+			}
+		}
+
+		if err := createRBACObjects(ctx, client, d.rbacObjects(), releaseNs, d.CronjobNamespace); err != nil {
+			return false, nil, fmt.Errorf("failed to create service account and RBAC: %w", err)
+		}
+	}
+
+	existing, err := client.BatchV1().CronJobs(d.CronjobNamespace).Get(ctx, cj.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		existing = nil
+	} else if err != nil {
+		return false, nil, fmt.Errorf("failed to check existing CronJob: %w", err)
+	}
+
+	saved, replaced, err := saveCronJob(ctx, client, SetTTLOptions{ReleaseName: d.Release, CronjobNamespace: d.CronjobNamespace}, cj, existing)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if backend.RunsJobs() && createdSA && releaseNs == d.CronjobNamespace {
+		_ = setRBACOwner(ctx, client, saved, saName)
+	}
+
+	var warnings []string
+	if d.Release != "" {
+		if releaseGone(ctx, client, saved) {
+			warnings = append(warnings, fmt.Sprintf("release %q not found in namespace %q; the TTL fires without uninstalling anything unless it is installed", d.Release, d.ReleaseNamespace))
+		}
+
+		var oldExpiry string
+		if replaced != nil {
+			oldExpiry = cronJobExpiry(replaced.Spec.Schedule, scheduleSetTime(replaced))
+		}
+		_ = RecordHistory(ctx, client, d.Release, d.ReleaseNamespace, d.CronjobNamespace, HistoryEntry{
+			Operation: OperationImport,
+			OldExpiry: oldExpiry,
+			NewExpiry: FormatScheduledDate(expiresAt),
+		})
+		_ = annotateReleaseStorage(ctx, client, cronJobDriver(saved), d.Release, d.ReleaseNamespace, saved.Namespace+"/"+saved.Name, expiresAt)
+	}
+
+	return false, warnings, nil
+}
+
+// rbacObjects returns the ServiceAccount and RBAC of d in the order
+// createRBACObjects applies them.
+func (d DumpedTTL) rbacObjects() []runtime.Object {
+	var objs []runtime.Object
+	if d.ServiceAccount != nil {
+		objs = append(objs, d.ServiceAccount)
+	}
+	for i := range d.Roles {
+		objs = append(objs, &d.Roles[i])
+	}
+	for i := range d.RoleBindings {
+		objs = append(objs, &d.RoleBindings[i])
+	}
+	for i := range d.ClusterRoles {
+		objs = append(objs, &d.ClusterRoles[i])
+	}
+	for i := range d.ClusterRoleBindings {
+		objs = append(objs, &d.ClusterRoleBindings[i])
+	}
+
+	return objs
+}
@@ -0,0 +1,153 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDumpAndImportTTLs(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	source := fake.NewClientset(testNamespace("preview", nil))
+	_, err := SetTTL(ctx, cfg, source, SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "2d",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+		Uninstall:            UninstallOptions{Wait: true, Timeout: 10 * time.Minute},
+	})
+	require.NoError(t, err)
+	_, err = SetNamespaceTTL(ctx, source, SetNamespaceTTLOptions{
+		Namespace:            "preview",
+		CronjobNamespace:     "ops",
+		Duration:             "3d",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	})
+	require.NoError(t, err)
+
+	dump, err := DumpTTLs(ctx, source, "")
+	require.NoError(t, err)
+	require.Len(t, dump.TTLs, 2)
+	assert.Equal(t, "myapp", dump.TTLs[0].Release)
+	assert.Equal(t, "default", dump.TTLs[0].ReleaseNamespace)
+	assert.NotNil(t, dump.TTLs[0].ServiceAccount)
+	assert.NotEmpty(t, dump.TTLs[0].Roles)
+	assert.Empty(t, dump.TTLs[0].CronJob.ResourceVersion)
+	assert.Equal(t, "preview", dump.TTLs[1].Namespace)
+	assert.NotEmpty(t, dump.TTLs[1].ClusterRoles)
+
+	out, err := FormatDump(dump)
+	require.NoError(t, err)
+	assert.Contains(t, out, "kind: TTLDump")
+	parsed, err := ParseDump([]byte(out))
+	require.NoError(t, err)
+
+	t.Run("import recreates the TTLs", func(t *testing.T) {
+		target := fake.NewClientset()
+
+		results := ImportTTLs(ctx, target, parsed)
+		require.Len(t, results, 2)
+		for _, r := range results {
+			assert.Empty(t, r.Error)
+			assert.False(t, r.Expired)
+		}
+		// The release is not installed in the target cluster yet
+		assert.Len(t, results[0].Warnings, 1)
+
+		cj, err := target.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, dump.TTLs[0].CronJob.Spec.Schedule, cj.Spec.Schedule)
+		assert.Equal(t, dump.TTLs[0].CronJob.Annotations[AnnotationExpiresAt], cj.Annotations[AnnotationExpiresAt])
+		assert.Equal(t, UninstallOptions{Wait: true, Timeout: 10 * time.Minute}, cronJobUninstallOptions(cj))
+
+		sa, err := target.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Len(t, sa.OwnerReferences, 1)
+		assert.Equal(t, cj.UID, sa.OwnerReferences[0].UID)
+
+		_, err = target.BatchV1().CronJobs("ops").Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		_, err = target.RbacV1().ClusterRoles().Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+
+		history, err := GetHistory(ctx, target, "myapp", "default", "default")
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, OperationImport, history[0].Operation)
+	})
+
+	t.Run("expiry can be edited", func(t *testing.T) {
+		target := fake.NewClientset()
+		edited := *parsed
+		edited.TTLs = []DumpedTTL{parsed.TTLs[0]}
+		expiresAt := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Minute)
+		edited.TTLs[0].ExpiresAt = metav1.NewTime(expiresAt)
+
+		results := ImportTTLs(ctx, target, &edited)
+		require.Len(t, results, 1)
+		assert.Empty(t, results[0].Error)
+
+		cj, err := target.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, TimeToCronSchedule(expiresAt.Local()), cj.Spec.Schedule)
+		assert.Equal(t, FormatScheduledDate(expiresAt.UTC()), cj.Annotations[AnnotationExpiresAt])
+	})
+
+	t.Run("expired TTLs are skipped", func(t *testing.T) {
+		target := fake.NewClientset()
+		expired := *parsed
+		expired.TTLs = []DumpedTTL{parsed.TTLs[0]}
+		expired.TTLs[0].ExpiresAt = metav1.NewTime(time.Now().Add(-time.Hour))
+
+		results := ImportTTLs(ctx, target, &expired)
+		require.Len(t, results, 1)
+		assert.True(t, results[0].Expired)
+
+		list, err := target.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, list.Items)
+	})
+
+	t.Run("missing service account", func(t *testing.T) {
+		target := fake.NewClientset()
+		noSA := *parsed
+		noSA.TTLs = []DumpedTTL{parsed.TTLs[0]}
+		noSA.TTLs[0].ServiceAccount = nil
+
+		results := ImportTTLs(ctx, target, &noSA)
+		require.Len(t, results, 1)
+		assert.Equal(t, `service account "myapp-4a0c226a-ttl" not found in namespace "default"`, results[0].Error)
+	})
+
+	t.Run("existing service account", func(t *testing.T) {
+		target := fake.NewClientset(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default"}})
+		noSA := *parsed
+		noSA.TTLs = []DumpedTTL{parsed.TTLs[0]}
+		noSA.TTLs[0].ServiceAccount = nil
+
+		results := ImportTTLs(ctx, target, &noSA)
+		require.Len(t, results, 1)
+		assert.Empty(t, results[0].Error)
+	})
+}
+
+func TestParseDump(t *testing.T) {
+	_, err := ParseDump([]byte("apiVersion: v1\nkind: List\n"))
+	assert.EqualError(t, err, `not a TTL dump: want apiVersion helm-ttl.io/v1alpha1 and kind TTLDump, got "v1" and "List"`)
+
+	_, err = ParseDump([]byte("apiVersion: helm-ttl.io/v1alpha1\nkind: TTLDump\nttls:\n- release: myapp\n  cronjobNamespace: default\n"))
+	assert.EqualError(t, err, "TTL 1 of the dump needs a cronJob with a name and a cronjobNamespace")
+
+	_, err = ParseDump([]byte("apiVersion: helm-ttl.io/v1alpha1\nkind: TTLDump\nttl: []\n"))
+	assert.ErrorContains(t, err, "failed to read TTLs")
+}
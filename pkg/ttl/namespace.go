@@ -0,0 +1,531 @@
+package ttl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NamespaceTTLNotFoundError is returned when no TTL CronJob exists for a
+// namespace.
+type NamespaceTTLNotFoundError struct {
+	Namespace string
+}
+
+func (e *NamespaceTTLNotFoundError) Error() string {
+	return fmt.Sprintf("no TTL set for namespace %q", e.Namespace)
+}
+
+// NamespaceResourceName returns the resource name for a namespace TTL.
+// Format: <namespace>-<hash>-ns-ttl, where hash is taken from the SHA-256
+// of the namespace, which is truncated to keep the name within
+// maxResourceNameLen. Namespaces cannot contain "/", so the hash never
+// matches that of a release TTL.
+func NamespaceResourceName(namespace string) string {
+	sum := sha256.Sum256([]byte(namespace))
+	hash := hex.EncodeToString(sum[:])[:resourceNameHashLen]
+
+	prefix := namespace
+	if maxLen := maxResourceNameLen - resourceNameHashLen - len("--ns-ttl"); len(prefix) > maxLen {
+		prefix = strings.TrimRight(prefix[:maxLen], "-.")
+	}
+
+	return fmt.Sprintf("%s-%s-ns-ttl", prefix, hash)
+}
+
+// namespaceLabels returns the labels helm-ttl puts on the resources it
+// creates for a namespace TTL.
+func namespaceLabels(namespace string) map[string]string {
+	return map[string]string{
+		LabelManagedBy:     LabelManagedByValue,
+		LabelNamespace:     LabelValue(namespace),
+		LabelSchemaVersion: schemaVersionValue,
+	}
+}
+
+// namespaceAnnotations returns the original value of the namespace label.
+func namespaceAnnotations(namespace string) map[string]string {
+	return map[string]string{
+		LabelNamespace: namespace,
+	}
+}
+
+// IsNamespaceTTL reports whether a helm-ttl resource was created for a
+// namespace TTL rather than a release TTL.
+func IsNamespaceTTL(obj metav1.Object) bool {
+	_, ok := obj.GetLabels()[LabelNamespace]
+	return ok
+}
+
+// TargetNamespace returns the namespace a helm-ttl resource's TTL empties:
+// the release namespace of a release TTL, or the namespace of a namespace
+// TTL.
+func TargetNamespace(obj metav1.Object) string {
+	if IsNamespaceTTL(obj) {
+		return OriginalLabelValue(obj, LabelNamespace)
+	}
+
+	return OriginalLabelValue(obj, LabelReleaseNamespace)
+}
+
+// NamespaceCronJobOptions contains the parameters for building a namespace
+// TTL CronJob.
+type NamespaceCronJobOptions struct {
+	Namespace        string
+	CronjobNamespace string
+	Schedule         string
+	ServiceAccount   string
+	HelmImage        string
+	KubectlImage     string
+	// Uninstall holds the flags passed to helm uninstall for every
+	// release in the namespace.
+	Uninstall        UninstallOptions
+	Pod              PodOptions
+	ImagePullSecrets []string
+	RegistryPrefix   string
+	Security         SecurityOptions
+	CleanupImage     string
+	Driver           string
+	ExpiresAt        time.Time
+}
+
+// BuildNamespaceCronJob constructs a Kubernetes CronJob that uninstalls
+// every Helm release in a namespace, deletes the namespace, then cleans up
+// itself. It is the release CronJob of BuildCronJob with the uninstall of
+// one release replaced by that of all of them; the namespace deletion
+// takes the place of verifying the uninstall.
+func BuildNamespaceCronJob(opts NamespaceCronJobOptions) (*batchv1.CronJob, error) {
+	cj, err := BuildCronJob(CronJobOptions{
+		ReleaseNamespace: opts.Namespace,
+		CronjobNamespace: opts.CronjobNamespace,
+		Schedule:         opts.Schedule,
+		ServiceAccount:   opts.ServiceAccount,
+		HelmImage:        opts.HelmImage,
+		KubectlImage:     opts.KubectlImage,
+		DeleteNamespace:  true,
+		Uninstall:        opts.Uninstall,
+		Pod:              opts.Pod,
+		ImagePullSecrets: opts.ImagePullSecrets,
+		RegistryPrefix:   opts.RegistryPrefix,
+		Security:         opts.Security,
+		CleanupImage:     opts.CleanupImage,
+		Driver:           opts.Driver,
+		ExpiresAt:        opts.ExpiresAt,
+		Name:             NamespaceResourceName(opts.Namespace),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	labels := namespaceLabels(opts.Namespace)
+	labels[LabelCronjobNamespace] = LabelValue(opts.CronjobNamespace)
+	labels[LabelDeleteNamespace] = "true"
+	cj.Labels = labels
+	cj.Spec.JobTemplate.Labels = labels
+	cj.Spec.JobTemplate.Spec.Template.Labels = labels
+
+	delete(cj.Annotations, LabelRelease)
+	delete(cj.Annotations, LabelReleaseNamespace)
+	setAnnotations(&cj.ObjectMeta, namespaceAnnotations(opts.Namespace))
+
+	spec := &cj.Spec.JobTemplate.Spec.Template.Spec
+	initContainers := spec.InitContainers[:0]
+	for _, c := range spec.InitContainers {
+		switch c.Name {
+		case "helm-uninstall":
+			c.Command = uninstallAllCmd(opts.Namespace, opts.Uninstall)
+		case "verify-uninstall":
+			continue
+		}
+
+		initContainers = append(initContainers, c)
+	}
+	spec.InitContainers = initContainers
+
+	return cj, nil
+}
+
+// uninstallAllCmd returns a helm command that uninstalls every release in
+// a namespace, whatever its status, and fails if any uninstall failed.
+func uninstallAllCmd(namespace string, u UninstallOptions) []string {
+	script := fmt.Sprintf(`releases=$(helm list --namespace %s --all --short --max 0) || exit 1
+status=0
+for release in $releases; do
+  %s || status=1
+done
+exit $status`,
+		namespace, strings.Join(u.Args(`"$release"`, namespace), " "))
+
+	return []string{"sh", "-c", script}
+}
+
+// createNamespaceTTLRBAC creates the ServiceAccount and RBAC a namespace
+// TTL CronJob needs: those of a cross-namespace release TTL with
+// --delete-namespace, labeled for the namespace.
+func createNamespaceTTLRBAC(ctx context.Context, client kubernetes.Interface, name, namespace, cronjobNamespace, serviceAccountName, driver string) error {
+	if _, err := StorageResource(driver); err != nil {
+		return err
+	}
+
+	labels := namespaceLabels(namespace)
+	labels[LabelCronjobNamespace] = LabelValue(cronjobNamespace)
+	annotations := namespaceAnnotations(namespace)
+	annotations[LabelCronjobNamespace] = cronjobNamespace
+
+	spec := rbacSpec{
+		name:               name,
+		serviceAccountName: serviceAccountName,
+		releaseNamespace:   namespace,
+		cronjobNamespace:   cronjobNamespace,
+		deleteNamespace:    true,
+		driver:             driver,
+		labels:             labels,
+		annotations:        annotations,
+		cronjobRules:       BackendOf(client).Rules(),
+	}
+
+	return createRBACObjects(ctx, client, spec.objects(), namespace, cronjobNamespace)
+}
+
+// SetNamespaceTTLOptions contains the parameters for setting a TTL on a
+// namespace.
+type SetNamespaceTTLOptions struct {
+	Namespace string
+	// CronjobNamespace must differ from Namespace, since the CronJob
+	// would otherwise delete itself with it.
+	CronjobNamespace string
+	// Duration falls back to the default of the namespace's
+	// helm-ttl-config policy when empty.
+	Duration             string
+	ServiceAccount       string
+	CreateServiceAccount bool
+	HelmImage            string
+	KubectlImage         string
+	Uninstall            UninstallOptions
+	Pod                  PodOptions
+	// DateOrder controls how numeric dates in Duration are read. It
+	// falls back to HELM_TTL_DATE_ORDER and defaults to strict.
+	DateOrder string
+	// MinDuration is the shortest TTL accepted. It falls back to
+	// HELM_TTL_MIN_DURATION and defaults to DefaultMinDuration.
+	MinDuration time.Duration
+	// AllowShort accepts a TTL shorter than MinDuration.
+	AllowShort bool
+	// ImagePullSecrets fall back to HELM_TTL_IMAGE_PULL_SECRETS.
+	ImagePullSecrets []string
+	RegistryPrefix   string
+	Security         SecurityOptions
+	CleanupImage     string
+	// Force sets the TTL even when the namespace is marked with
+	// helm-ttl/protected.
+	Force bool
+	// Driver is the Helm storage driver of the releases in the namespace.
+	// It falls back to HELM_DRIVER and defaults to secrets.
+	Driver string
+}
+
+// NamespaceTTLInfo describes the TTL of a namespace.
+type NamespaceTTLInfo struct {
+	Namespace        string `json:"namespace" yaml:"namespace"`
+	CronjobNamespace string `json:"cronjob_namespace" yaml:"cronjob_namespace"`
+	CronJobName      string `json:"cronjob_name" yaml:"cronjob_name"`
+	ScheduledDate    string `json:"scheduled_date" yaml:"scheduled_date"`
+	CronSchedule     string `json:"cron_schedule" yaml:"cron_schedule"`
+	Generation       int64  `json:"generation" yaml:"generation"`
+	Remaining        string `json:"remaining" yaml:"remaining"`
+	// Expired reports that the scheduled date has passed.
+	Expired bool `json:"expired" yaml:"expired"`
+	// Missed reports that the scheduled date passed without the TTL firing.
+	Missed bool `json:"missed" yaml:"missed"`
+}
+
+// SetNamespaceTTL sets or updates the TTL of a namespace: when it expires,
+// every Helm release in the namespace is uninstalled and the namespace is
+// deleted.
+func SetNamespaceTTL(ctx context.Context, client kubernetes.Interface, opts SetNamespaceTTLOptions) (*NamespaceTTLInfo, error) {
+	if backend := BackendOf(client); !backend.RunsJobs() {
+		return nil, fmt.Errorf("the %s backend does not support namespace TTLs", backend.Name())
+	}
+
+	if opts.Namespace == opts.CronjobNamespace {
+		return nil, fmt.Errorf("cannot put the CronJob of a namespace TTL in the namespace it deletes (%s); use another CronJob namespace", opts.Namespace)
+	}
+
+	if _, err := client.CoreV1().Namespaces().Get(ctx, opts.Namespace, metav1.GetOptions{}); errors.IsNotFound(err) {
+		return nil, fmt.Errorf("namespace %q not found", opts.Namespace)
+	}
+
+	if !opts.Force {
+		if err := CheckProtected(ctx, client, nil, opts.Namespace); err != nil {
+			return nil, err
+		}
+	}
+
+	pol, err := policy.Load(ctx, client, opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Duration == "" {
+		if pol.DefaultDuration == "" {
+			return nil, fmt.Errorf("no duration given and namespace %q has no %s in its %s ConfigMap", opts.Namespace, policy.KeyDefaultDuration, policy.ConfigMapName)
+		}
+
+		opts.Duration = pol.DefaultDuration
+	}
+
+	if opts.Driver == "" {
+		opts.Driver = envDriver()
+	}
+
+	if _, err := StorageResource(opts.Driver); err != nil {
+		return nil, err
+	}
+
+	dateOrder := opts.DateOrder
+	if dateOrder == "" {
+		dateOrder = os.Getenv("HELM_TTL_DATE_ORDER")
+	}
+
+	order, err := ParseDateOrder(dateOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	pullSecrets := opts.ImagePullSecrets
+	if len(pullSecrets) == 0 {
+		pullSecrets = envImagePullSecrets()
+	}
+
+	now := time.Now()
+	targetTime, err := ParseTimeInputWithOrder(opts.Duration, now, order)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration: %w", err)
+	}
+
+	if !opts.AllowShort {
+		minimum, err := resolveMinDuration(opts.MinDuration)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkMinDuration(targetTime, now, minimum); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := pol.Check(targetTime, now); err != nil {
+		return nil, err
+	}
+
+	// Round up rather than let the schedule drop the seconds and fire early
+	targetTime = roundUpToMinute(targetTime)
+
+	schedule := TimeToCronSchedule(targetTime)
+	logger.Debug("parsed duration", "namespace", opts.Namespace, "input", opts.Duration, "dateOrder", string(order), "target", targetTime, "schedule", schedule)
+
+	resourceName := NamespaceResourceName(opts.Namespace)
+	saName := opts.ServiceAccount
+	if opts.CreateServiceAccount && (saName == "" || saName == "default") {
+		saName = resourceName
+	}
+
+	if opts.CreateServiceAccount {
+		if err := createNamespaceTTLRBAC(ctx, client, resourceName, opts.Namespace, opts.CronjobNamespace, saName, opts.Driver); err != nil {
+			return nil, fmt.Errorf("failed to create service account and RBAC: %w", err)
+		}
+	} else {
+		_, err := client.CoreV1().ServiceAccounts(opts.CronjobNamespace).Get(ctx, saName, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil, &ServiceAccountNotFoundError{Name: saName, Namespace: opts.CronjobNamespace}
+			}
+
+			return nil, fmt.Errorf("failed to check service account: %w", err)
+		}
+	}
+
+	cj, err := BuildNamespaceCronJob(NamespaceCronJobOptions{
+		Namespace:        opts.Namespace,
+		CronjobNamespace: opts.CronjobNamespace,
+		Schedule:         schedule,
+		ServiceAccount:   saName,
+		HelmImage:        opts.HelmImage,
+		KubectlImage:     opts.KubectlImage,
+		Uninstall:        opts.Uninstall,
+		Pod:              opts.Pod,
+		ImagePullSecrets: pullSecrets,
+		RegistryPrefix:   opts.RegistryPrefix,
+		Security:         opts.Security,
+		CleanupImage:     opts.CleanupImage,
+		Driver:           opts.Driver,
+		ExpiresAt:        targetTime,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build CronJob: %w", err)
+	}
+	logManifest("built CronJob", cj)
+
+	cronJobs := client.BatchV1().CronJobs(opts.CronjobNamespace)
+	var current int64
+	existing, err := cronJobs.Get(ctx, resourceName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to check existing CronJob: %w", err)
+	default:
+		current = cronJobGeneration(existing)
+	}
+
+	setGeneration(cj, current+1)
+	saved, err := apply[*batchv1.CronJob](ctx, cronJobs, cj, batchv1ac.CronJob(cj.Name, cj.Namespace))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save CronJob: %w", err)
+	}
+
+	// Record an event (best effort)
+	info, err := namespaceTTLInfo(saved, opts.Namespace, now)
+	if err != nil {
+		return nil, err
+	}
+	_ = recordEvent(ctx, client, saved, corev1.EventTypeNormal, EventReasonTTLSet,
+		fmt.Sprintf("TTL set for namespace %q: delete at %s", opts.Namespace, info.ScheduledDate))
+
+	return info, nil
+}
+
+// GetNamespaceTTL retrieves the TTL of a namespace.
+func GetNamespaceTTL(ctx context.Context, client kubernetes.Interface, namespace, cronjobNamespace string) (*NamespaceTTLInfo, error) {
+	cj, err := getNamespaceCronJob(ctx, client, namespace, cronjobNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return namespaceTTLInfo(cj, namespace, time.Now())
+}
+
+// getNamespaceCronJob reads the CronJob of a namespace TTL.
+func getNamespaceCronJob(ctx context.Context, client kubernetes.Interface, namespace, cronjobNamespace string) (*batchv1.CronJob, error) {
+	cj, err := client.BatchV1().CronJobs(cronjobNamespace).Get(ctx, NamespaceResourceName(namespace), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, &NamespaceTTLNotFoundError{Namespace: namespace}
+		}
+
+		return nil, fmt.Errorf("failed to get CronJob: %w", err)
+	}
+
+	return cj, nil
+}
+
+// namespaceTTLInfo describes the namespace TTL a CronJob implements.
+func namespaceTTLInfo(cj *batchv1.CronJob, namespace string, now time.Time) (*NamespaceTTLInfo, error) {
+	info, err := ttlInfo(cj, "", namespace, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NamespaceTTLInfo{
+		Namespace:        namespace,
+		CronjobNamespace: cj.Namespace,
+		CronJobName:      cj.Name,
+		ScheduledDate:    info.ScheduledDate,
+		CronSchedule:     info.CronSchedule,
+		Generation:       info.Generation,
+		Remaining:        info.Remaining,
+		Expired:          info.Expired,
+		Missed:           info.Missed,
+	}, nil
+}
+
+// UnsetNamespaceTTL removes the TTL of a namespace by deleting its CronJob
+// and RBAC. The namespace and its releases are left alone.
+func UnsetNamespaceTTL(ctx context.Context, client kubernetes.Interface, namespace, cronjobNamespace string) error {
+	cj, err := getNamespaceCronJob(ctx, client, namespace, cronjobNamespace)
+	if err != nil {
+		return err
+	}
+
+	err = client.BatchV1().CronJobs(cronjobNamespace).Delete(ctx, cj.Name, metav1.DeleteOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return &NamespaceTTLNotFoundError{Namespace: namespace}
+		}
+
+		return fmt.Errorf("failed to delete CronJob: %w", err)
+	}
+
+	// Clean up RBAC resources and record an event (best effort)
+	_ = cleanupRBAC(ctx, client, cj.Name, namespace, cronjobNamespace)
+	_ = recordEvent(ctx, client, cj, corev1.EventTypeNormal, EventReasonTTLUnset,
+		fmt.Sprintf("TTL removed for namespace %q", namespace))
+
+	return nil
+}
+
+// RunNamespaceTTLOptions contains the options for running a namespace TTL
+// immediately.
+type RunNamespaceTTLOptions struct {
+	Namespace        string
+	CronjobNamespace string
+	// DryRun only reports what the run would do.
+	DryRun bool
+	// Timeout bounds the wait for the Job's pod and containers. Zero waits
+	// until ctx is done.
+	Timeout time.Duration
+	// PollInterval is how often the pod is checked; it defaults to
+	// DefaultRunPollInterval.
+	PollInterval time.Duration
+	// SidecarContainers are the injected containers the run ignores; nil
+	// defaults to DefaultSidecarContainers.
+	SidecarContainers []string
+}
+
+// RunNamespaceTTL immediately executes the TTL of a namespace, as RunTTL
+// does for a release: every release in the namespace is uninstalled and
+// the namespace deleted. The result has no release name.
+func RunNamespaceTTL(ctx context.Context, client kubernetes.Interface, w io.Writer, logFetcher LogFetcher, opts RunNamespaceTTLOptions) (*RunTTLResult, error) {
+	runOpts := RunTTLOptions{
+		ReleaseNamespace: opts.Namespace,
+		CronjobNamespace: opts.CronjobNamespace,
+		DryRun:           opts.DryRun,
+		Timeout:          opts.Timeout,
+		PollInterval:     opts.PollInterval,
+
+		SidecarContainers: opts.SidecarContainers,
+	}
+	if err := runOpts.validate(); err != nil {
+		return nil, err
+	}
+
+	cj, err := getNamespaceCronJob(ctx, client, opts.Namespace, opts.CronjobNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return runCronJob(ctx, client, w, logFetcher, cj, runOpts)
+}
+
+// namespaceGone reports whether the namespace a namespace TTL CronJob
+// deletes no longer exists.
+func namespaceGone(ctx context.Context, client kubernetes.Interface, cj *batchv1.CronJob) bool {
+	if !IsNamespaceTTL(cj) {
+		return false
+	}
+
+	_, err := client.CoreV1().Namespaces().Get(ctx, OriginalLabelValue(cj, LabelNamespace), metav1.GetOptions{})
+	return errors.IsNotFound(err)
+}
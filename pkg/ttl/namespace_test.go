@@ -0,0 +1,632 @@
+package ttl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// buildTestNamespaceCronJob creates a namespace TTL CronJob for testing.
+func buildTestNamespaceCronJob(t *testing.T, namespace, cronjobNamespace string) *batchv1.CronJob {
+	t.Helper()
+	cj, err := BuildNamespaceCronJob(NamespaceCronJobOptions{
+		Namespace:        namespace,
+		CronjobNamespace: cronjobNamespace,
+		Schedule:         "30 14 15 3 *",
+		ServiceAccount:   "default",
+		HelmImage:        "alpine/helm:3.14",
+		KubectlImage:     "alpine/k8s:1.29",
+	})
+	require.NoError(t, err)
+	return cj
+}
+
+func testNamespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestNamespaceResourceName(t *testing.T) {
+	assert.Equal(t, "preview-5975cf1b-ns-ttl", NamespaceResourceName("preview"))
+	assert.NotEqual(t, ResourceName("", "preview"), NamespaceResourceName("preview"))
+
+	long := strings.Repeat("a", 63)
+	name := NamespaceResourceName(long)
+	assert.LessOrEqual(t, len(name), maxResourceNameLen)
+	assert.True(t, strings.HasSuffix(name, "-ns-ttl"))
+	assert.NotEqual(t, name, NamespaceResourceName(strings.Repeat("a", 62)))
+
+	t.Run("trims trailing separators", func(t *testing.T) {
+		name := NamespaceResourceName(strings.Repeat("a", 35) + "-b")
+		assert.True(t, strings.HasPrefix(name, strings.Repeat("a", 35)+"-"))
+		assert.NotContains(t, name, "--")
+	})
+}
+
+func TestIsNamespaceTTL(t *testing.T) {
+	nsCJ := buildTestNamespaceCronJob(t, "preview", "ops")
+	releaseCJ := buildTestCronJob(t, "myapp", "staging", "ops", true)
+
+	assert.True(t, IsNamespaceTTL(nsCJ))
+	assert.False(t, IsNamespaceTTL(releaseCJ))
+	assert.Equal(t, "preview", TargetNamespace(nsCJ))
+	assert.Equal(t, "staging", TargetNamespace(releaseCJ))
+}
+
+func TestBuildNamespaceCronJob(t *testing.T) {
+	cj := buildTestNamespaceCronJob(t, "preview", "ops")
+
+	assert.Equal(t, "preview-5975cf1b-ns-ttl", cj.Name)
+	assert.Equal(t, "ops", cj.Namespace)
+	want := map[string]string{
+		LabelManagedBy:        LabelManagedByValue,
+		LabelNamespace:        "preview",
+		LabelCronjobNamespace: "ops",
+		LabelDeleteNamespace:  "true",
+		LabelSchemaVersion:    "2",
+	}
+	assert.Equal(t, want, cj.Labels)
+	assert.Equal(t, want, cj.Spec.JobTemplate.Labels)
+	assert.Equal(t, want, cj.Spec.JobTemplate.Spec.Template.Labels)
+	assert.Equal(t, "preview", cj.Annotations[LabelNamespace])
+	assert.NotContains(t, cj.Annotations, LabelRelease)
+	assert.NotContains(t, cj.Annotations, LabelReleaseNamespace)
+
+	spec := cj.Spec.JobTemplate.Spec.Template.Spec
+	var names []string
+	for _, c := range spec.InitContainers {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"helm-uninstall", "delete-namespace"}, names)
+
+	uninstall := spec.InitContainers[0]
+	require.Len(t, uninstall.Command, 3)
+	assert.Equal(t, []string{"sh", "-c"}, uninstall.Command[:2])
+	assert.Contains(t, uninstall.Command[2], "helm list --namespace preview --all --short --max 0")
+	assert.Contains(t, uninstall.Command[2], `helm uninstall "$release" --namespace preview || status=1`)
+	assert.Contains(t, uninstall.Command[2], "exit $status")
+
+	t.Run("uninstall options apply to every release", func(t *testing.T) {
+		cj, err := BuildNamespaceCronJob(NamespaceCronJobOptions{
+			Namespace:        "preview",
+			CronjobNamespace: "ops",
+			Schedule:         "30 14 15 3 *",
+			ServiceAccount:   "default",
+			Uninstall:        UninstallOptions{Wait: true, NoHooks: true},
+		})
+		require.NoError(t, err)
+		script := cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[0].Command[2]
+		assert.Contains(t, script, `helm uninstall "$release" --namespace preview --wait --no-hooks || status=1`)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := BuildNamespaceCronJob(NamespaceCronJobOptions{
+			Namespace:        "preview",
+			CronjobNamespace: "ops",
+			Schedule:         "30 14 15 3 *",
+			ServiceAccount:   "default",
+			Uninstall:        UninstallOptions{Cascade: "sideways"},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestSetNamespaceTTL(t *testing.T) {
+	ctx := context.Background()
+	opts := func() SetNamespaceTTLOptions {
+		return SetNamespaceTTLOptions{
+			Namespace:            "preview",
+			CronjobNamespace:     "ops",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		}
+	}
+
+	t.Run("creates the CronJob and RBAC", func(t *testing.T) {
+		client := fake.NewClientset(testNamespace("preview", nil))
+
+		info, err := SetNamespaceTTL(ctx, client, opts())
+		require.NoError(t, err)
+		assert.Equal(t, "preview", info.Namespace)
+		assert.Equal(t, "ops", info.CronjobNamespace)
+		assert.Equal(t, "preview-5975cf1b-ns-ttl", info.CronJobName)
+		assert.Equal(t, int64(1), info.Generation)
+		assert.NotEmpty(t, info.ScheduledDate)
+		assert.NotEmpty(t, info.Remaining)
+		assert.False(t, info.Missed)
+
+		cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.True(t, IsNamespaceTTL(cj))
+		assert.Equal(t, "preview-5975cf1b-ns-ttl", cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
+
+		_, err = client.CoreV1().ServiceAccounts("ops").Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		for _, ns := range []string{"preview", "ops"} {
+			_, err = client.RbacV1().Roles(ns).Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+			require.NoError(t, err, ns)
+			_, err = client.RbacV1().RoleBindings(ns).Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+			require.NoError(t, err, ns)
+		}
+		cr, err := client.RbacV1().ClusterRoles().Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "preview", cr.Labels[LabelNamespace])
+		_, err = client.RbacV1().ClusterRoleBindings().Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+
+		ns, name := OwningCronJob(cr)
+		assert.Equal(t, "ops", ns)
+		assert.Equal(t, "preview-5975cf1b-ns-ttl", name)
+	})
+
+	t.Run("updates an existing TTL", func(t *testing.T) {
+		client := fake.NewClientset(testNamespace("preview", nil))
+
+		_, err := SetNamespaceTTL(ctx, client, opts())
+		require.NoError(t, err)
+		o := opts()
+		o.Duration = "5d"
+		info, err := SetNamespaceTTL(ctx, client, o)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), info.Generation)
+
+		cronJobs, err := client.BatchV1().CronJobs("ops").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Len(t, cronJobs.Items, 1)
+	})
+
+	t.Run("existing service account", func(t *testing.T) {
+		client := fake.NewClientset(testNamespace("preview", nil),
+			&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "cleaner", Namespace: "ops"}})
+		o := opts()
+		o.CreateServiceAccount = false
+		o.ServiceAccount = "cleaner"
+
+		_, err := SetNamespaceTTL(ctx, client, o)
+		require.NoError(t, err)
+		cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "cleaner", cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
+	})
+
+	t.Run("service account not found", func(t *testing.T) {
+		client := fake.NewClientset(testNamespace("preview", nil))
+		o := opts()
+		o.CreateServiceAccount = false
+
+		_, err := SetNamespaceTTL(ctx, client, o)
+		var saErr *ServiceAccountNotFoundError
+		require.ErrorAs(t, err, &saErr)
+		assert.Equal(t, "ops", saErr.Namespace)
+	})
+
+	t.Run("service account lookup error", func(t *testing.T) {
+		client := fake.NewClientset(testNamespace("preview", nil))
+		client.PrependReactor("get", "serviceaccounts", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+		o := opts()
+		o.CreateServiceAccount = false
+
+		_, err := SetNamespaceTTL(ctx, client, o)
+		assert.EqualError(t, err, "failed to check service account: forbidden")
+	})
+
+	t.Run("RBAC error", func(t *testing.T) {
+		client := fake.NewClientset(testNamespace("preview", nil))
+		client.PrependReactor("patch", "clusterroles", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := SetNamespaceTTL(ctx, client, opts())
+		assert.ErrorContains(t, err, "failed to create service account and RBAC")
+	})
+
+	t.Run("CronJob in the namespace it deletes", func(t *testing.T) {
+		o := opts()
+		o.CronjobNamespace = "preview"
+
+		_, err := SetNamespaceTTL(ctx, fake.NewClientset(testNamespace("preview", nil)), o)
+		assert.EqualError(t, err, "cannot put the CronJob of a namespace TTL in the namespace it deletes (preview); use another CronJob namespace")
+	})
+
+	t.Run("namespace not found", func(t *testing.T) {
+		_, err := SetNamespaceTTL(ctx, fake.NewClientset(), opts())
+		assert.EqualError(t, err, `namespace "preview" not found`)
+	})
+
+	t.Run("protected namespace", func(t *testing.T) {
+		client := fake.NewClientset(testNamespace("preview", map[string]string{LabelProtected: "true"}))
+
+		_, err := SetNamespaceTTL(ctx, client, opts())
+		var protected *ProtectedError
+		require.ErrorAs(t, err, &protected)
+
+		o := opts()
+		o.Force = true
+		_, err = SetNamespaceTTL(ctx, client, o)
+		assert.NoError(t, err)
+	})
+
+	t.Run("policy", func(t *testing.T) {
+		policyCM := func(data map[string]string) *corev1.ConfigMap {
+			return &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: policy.ConfigMapName, Namespace: "preview"},
+				Data:       data,
+			}
+		}
+
+		t.Run("default duration", func(t *testing.T) {
+			client := fake.NewClientset(testNamespace("preview", nil), policyCM(map[string]string{policy.KeyDefaultDuration: "2h"}))
+			o := opts()
+			o.Duration = ""
+
+			info, err := SetNamespaceTTL(ctx, client, o)
+			require.NoError(t, err)
+			assert.NotEmpty(t, info.ScheduledDate)
+		})
+
+		t.Run("no duration", func(t *testing.T) {
+			o := opts()
+			o.Duration = ""
+
+			_, err := SetNamespaceTTL(ctx, fake.NewClientset(testNamespace("preview", nil)), o)
+			assert.EqualError(t, err, `no duration given and namespace "preview" has no defaultDuration in its helm-ttl-config ConfigMap`)
+		})
+
+		t.Run("max duration", func(t *testing.T) {
+			client := fake.NewClientset(testNamespace("preview", nil), policyCM(map[string]string{policy.KeyMaxDuration: "1d"}))
+
+			_, err := SetNamespaceTTL(ctx, client, opts())
+			var exceeded *policy.MaxDurationExceededError
+			assert.ErrorAs(t, err, &exceeded)
+		})
+
+		t.Run("invalid policy", func(t *testing.T) {
+			client := fake.NewClientset(testNamespace("preview", nil), policyCM(map[string]string{policy.KeyMaxDuration: "soon"}))
+
+			_, err := SetNamespaceTTL(ctx, client, opts())
+			assert.ErrorContains(t, err, "invalid maxDuration")
+		})
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			mutate func(*SetNamespaceTTLOptions)
+			err    string
+		}{
+			"duration":   {func(o *SetNamespaceTTLOptions) { o.Duration = "soonish" }, "invalid duration"},
+			"driver":     {func(o *SetNamespaceTTLOptions) { o.Driver = "etcd" }, "etcd"},
+			"date order": {func(o *SetNamespaceTTLOptions) { o.DateOrder = "ymd" }, "ymd"},
+			"cascade":    {func(o *SetNamespaceTTLOptions) { o.Uninstall.Cascade = "sideways" }, "failed to build CronJob"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				o := opts()
+				tc.mutate(&o)
+
+				_, err := SetNamespaceTTL(ctx, fake.NewClientset(testNamespace("preview", nil)), o)
+				assert.ErrorContains(t, err, tc.err)
+			})
+		}
+	})
+
+	t.Run("CronJob errors", func(t *testing.T) {
+		for _, verb := range []string{"get", "patch"} {
+			t.Run(verb, func(t *testing.T) {
+				client := fake.NewClientset(testNamespace("preview", nil))
+				client.PrependReactor(verb, "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("boom")
+				})
+
+				_, err := SetNamespaceTTL(ctx, client, opts())
+				assert.ErrorContains(t, err, "boom")
+			})
+		}
+	})
+
+	t.Run("records an event", func(t *testing.T) {
+		client := fake.NewClientset(testNamespace("preview", nil))
+
+		_, err := SetNamespaceTTL(ctx, client, opts())
+		require.NoError(t, err)
+
+		events := listEvents(t, client, "ops")
+		require.Len(t, events, 1)
+		assert.Equal(t, EventReasonTTLSet, events[0].Reason)
+		assert.Contains(t, events[0].Message, `TTL set for namespace "preview": delete at `)
+		assert.Equal(t, "preview", events[0].Labels[LabelNamespace])
+		assert.NotContains(t, events[0].Labels, LabelRelease)
+	})
+}
+
+func TestGetNamespaceTTL(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("found", func(t *testing.T) {
+		client := fake.NewClientset(buildTestNamespaceCronJob(t, "preview", "ops"))
+
+		info, err := GetNamespaceTTL(ctx, client, "preview", "ops")
+		require.NoError(t, err)
+		assert.Equal(t, "preview", info.Namespace)
+		assert.Equal(t, "ops", info.CronjobNamespace)
+		assert.Equal(t, "preview-5975cf1b-ns-ttl", info.CronJobName)
+		assert.Equal(t, "30 14 15 3 *", info.CronSchedule)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := GetNamespaceTTL(ctx, fake.NewClientset(), "preview", "ops")
+		var notFound *NamespaceTTLNotFoundError
+		require.ErrorAs(t, err, &notFound)
+		assert.EqualError(t, err, `no TTL set for namespace "preview"`)
+	})
+
+	t.Run("get error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := GetNamespaceTTL(ctx, client, "preview", "ops")
+		assert.EqualError(t, err, "failed to get CronJob: forbidden")
+	})
+
+	t.Run("invalid schedule", func(t *testing.T) {
+		cj := buildTestNamespaceCronJob(t, "preview", "ops")
+		cj.Spec.Schedule = "whenever"
+
+		_, err := GetNamespaceTTL(ctx, fake.NewClientset(cj), "preview", "ops")
+		assert.Error(t, err)
+	})
+}
+
+func TestUnsetNamespaceTTL(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("deletes the CronJob and RBAC", func(t *testing.T) {
+		client := fake.NewClientset(testNamespace("preview", nil))
+		_, err := SetNamespaceTTL(ctx, client, SetNamespaceTTLOptions{
+			Namespace:            "preview",
+			CronjobNamespace:     "ops",
+			Duration:             "2d",
+			CreateServiceAccount: true,
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, UnsetNamespaceTTL(ctx, client, "preview", "ops"))
+
+		_, err = client.BatchV1().CronJobs("ops").Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		assert.Error(t, err)
+		_, err = client.RbacV1().ClusterRoles().Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		assert.Error(t, err)
+		_, err = client.RbacV1().Roles("preview").Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		assert.Error(t, err)
+		_, err = client.CoreV1().ServiceAccounts("ops").Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		assert.Error(t, err)
+		_, err = client.CoreV1().Namespaces().Get(ctx, "preview", metav1.GetOptions{})
+		assert.NoError(t, err)
+
+		var reasons []string
+		for _, ev := range listEvents(t, client, "ops") {
+			reasons = append(reasons, ev.Reason)
+			if ev.Reason == EventReasonTTLUnset {
+				assert.Equal(t, `TTL removed for namespace "preview"`, ev.Message)
+			}
+		}
+		assert.ElementsMatch(t, []string{EventReasonTTLSet, EventReasonTTLUnset}, reasons)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		err := UnsetNamespaceTTL(ctx, fake.NewClientset(), "preview", "ops")
+		var notFound *NamespaceTTLNotFoundError
+		assert.ErrorAs(t, err, &notFound)
+	})
+
+	t.Run("deleted concurrently", func(t *testing.T) {
+		client := fake.NewClientset(buildTestNamespaceCronJob(t, "preview", "ops"))
+		client.PrependReactor("delete", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewNotFound(batchv1.Resource("cronjobs"), "preview-5975cf1b-ns-ttl")
+		})
+
+		err := UnsetNamespaceTTL(ctx, client, "preview", "ops")
+		var notFound *NamespaceTTLNotFoundError
+		assert.ErrorAs(t, err, &notFound)
+	})
+
+	t.Run("delete error", func(t *testing.T) {
+		client := fake.NewClientset(buildTestNamespaceCronJob(t, "preview", "ops"))
+		client.PrependReactor("delete", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		err := UnsetNamespaceTTL(ctx, client, "preview", "ops")
+		assert.EqualError(t, err, "failed to delete CronJob: forbidden")
+	})
+}
+
+func TestRunNamespaceTTL(t *testing.T) {
+	ctx := context.Background()
+	runOpts := RunNamespaceTTLOptions{Namespace: "preview", CronjobNamespace: "ops"}
+
+	t.Run("uninstalls and deletes the namespace", func(t *testing.T) {
+		cj := buildTestNamespaceCronJob(t, "preview", "ops")
+		pod := buildCompletedPod("ops", "preview-5975cf1b-ns-ttl-run",
+			[]string{"helm-uninstall", "delete-namespace"}, []string{"self-cleanup"},
+			map[string]int32{"helm-uninstall": 0, "delete-namespace": 0, "self-cleanup": 0})
+		client := fake.NewClientset(cj, pod, testNamespace("preview", nil))
+		var buf bytes.Buffer
+
+		result, err := RunNamespaceTTL(ctx, client, &buf, testLogFetcher("ok\n"), runOpts)
+		require.NoError(t, err)
+		assert.True(t, result.NamespaceTTL)
+		assert.Empty(t, result.ReleaseName)
+		assert.Equal(t, "preview", result.ReleaseNamespace)
+		assert.True(t, result.DeletedNamespace)
+		assert.Len(t, result.ContainerResults, 3)
+
+		_, err = client.CoreV1().Namespaces().Get(ctx, "preview", metav1.GetOptions{})
+		assert.Error(t, err)
+
+		// No history is kept for namespace TTLs
+		cms, err := client.CoreV1().ConfigMaps("ops").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, cms.Items)
+
+		events := listEvents(t, client, "ops")
+		require.Len(t, events, 1)
+		assert.Equal(t, `helm ttl run uninstalled the releases of namespace "preview"`, events[0].Message)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		client := fake.NewClientset(buildTestNamespaceCronJob(t, "preview", "ops"), testNamespace("preview", nil))
+		o := runOpts
+		o.DryRun = true
+
+		result, err := RunNamespaceTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), o)
+		require.NoError(t, err)
+		assert.True(t, result.DryRun)
+		assert.True(t, result.NamespaceTTL)
+		assert.True(t, result.DeletedNamespace)
+		assert.Equal(t, "preview-5975cf1b-ns-ttl", result.ResourceName)
+		assert.Equal(t, "sh", result.UninstallCommand[0])
+		require.NotNil(t, result.Job)
+		assert.Equal(t, "preview-5975cf1b-ns-ttl-run", result.Job.Name)
+
+		_, err = client.CoreV1().Namespaces().Get(ctx, "preview", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := RunNamespaceTTL(ctx, fake.NewClientset(), &bytes.Buffer{}, testLogFetcher(""), runOpts)
+		var notFound *NamespaceTTLNotFoundError
+		assert.ErrorAs(t, err, &notFound)
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		o := runOpts
+		o.Timeout = -time.Second
+
+		_, err := RunNamespaceTTL(ctx, fake.NewClientset(), &bytes.Buffer{}, testLogFetcher(""), o)
+		assert.EqualError(t, err, "invalid timeout -1s: must not be negative")
+	})
+}
+
+func TestNamespaceTTL_ReleasePaths(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("list skips namespace TTLs", func(t *testing.T) {
+		client := fake.NewClientset(
+			buildTestNamespaceCronJob(t, "preview", "ops"),
+			buildTestCronJob(t, "myapp", "staging", "ops", false),
+		)
+
+		ttls, err := ListTTLs(ctx, client, "ops", "")
+		require.NoError(t, err)
+		require.Len(t, ttls, 1)
+		assert.Equal(t, "myapp", ttls[0].ReleaseName)
+	})
+
+	t.Run("cleanup keeps a namespace TTL whose namespace exists", func(t *testing.T) {
+		client := fake.NewClientset(buildTestNamespaceCronJob(t, "preview", "ops"), testNamespace("preview", nil))
+		require.NoError(t, createNamespaceTTLRBAC(ctx, client, "preview-5975cf1b-ns-ttl", "preview", "ops", "preview-5975cf1b-ns-ttl", ""))
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"ops", "preview"}, DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, orphaned)
+	})
+
+	t.Run("cleanup removes a namespace TTL whose namespace is gone", func(t *testing.T) {
+		client := fake.NewClientset(buildTestNamespaceCronJob(t, "preview", "ops"))
+		require.NoError(t, createNamespaceTTLRBAC(ctx, client, "preview-5975cf1b-ns-ttl", "preview", "ops", "preview-5975cf1b-ns-ttl", ""))
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"ops"}})
+		require.NoError(t, err)
+		assert.Contains(t, orphaned, OrphanedResource{Kind: "CronJob", Name: "preview-5975cf1b-ns-ttl", Namespace: "ops"})
+		assert.Contains(t, orphaned, OrphanedResource{Kind: "ClusterRole", Name: "preview-5975cf1b-ns-ttl"})
+		assert.Contains(t, orphaned, OrphanedResource{Kind: "ServiceAccount", Name: "preview-5975cf1b-ns-ttl", Namespace: "ops"})
+
+		_, err = client.BatchV1().CronJobs("ops").Get(ctx, "preview-5975cf1b-ns-ttl", metav1.GetOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("RBAC invalid driver", func(t *testing.T) {
+		err := createNamespaceTTLRBAC(ctx, fake.NewClientset(), "preview-5975cf1b-ns-ttl", "preview", "ops", "preview-5975cf1b-ns-ttl", "etcd")
+		assert.Error(t, err)
+	})
+
+	t.Run("RBAC service account error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("patch", "serviceaccounts", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		err := createNamespaceTTLRBAC(ctx, client, "preview-5975cf1b-ns-ttl", "preview", "ops", "preview-5975cf1b-ns-ttl", "")
+		assert.ErrorContains(t, err, "failed to create service account: forbidden")
+	})
+}
+
+func TestFormatNamespaceTTL(t *testing.T) {
+	info := NamespaceTTLInfo{
+		Namespace:        "preview",
+		CronjobNamespace: "ops",
+		CronJobName:      "preview-5975cf1b-ns-ttl",
+		ScheduledDate:    "2026-03-15T14:30:00Z",
+		CronSchedule:     "30 14 15 3 *",
+		Generation:       2,
+		Remaining:        "1d2h",
+	}
+
+	out, err := FormatNamespaceTTL(info, "text")
+	require.NoError(t, err)
+	assert.Equal(t, "Namespace:         preview\n"+
+		"CronJob Namespace: ops\n"+
+		"CronJob:           preview-5975cf1b-ns-ttl\n"+
+		"Scheduled Date:    2026-03-15T14:30:00Z\n"+
+		"Remaining:         1d2h\n"+
+		"Cron Schedule:     30 14 15 3 *\n"+
+		"Generation:        2\n", out)
+
+	info.Expired, info.Missed = true, true
+	out, err = FormatNamespaceTTL(info, "text")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Remaining:         missed (")
+
+	out, err = FormatNamespaceTTL(info, "json")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"namespace": "preview"`)
+	assert.Contains(t, out, `"expired": true`)
+	assert.Contains(t, out, `"missed": true`)
+
+	out, err = FormatNamespaceTTL(info, "jsonpath={.cronjob_name}")
+	require.NoError(t, err)
+	assert.Equal(t, "preview-5975cf1b-ns-ttl", strings.TrimSpace(out))
+}
+
+func TestFormatRunResult_NamespaceTTL(t *testing.T) {
+	result := &RunTTLResult{ReleaseNamespace: "preview", NamespaceTTL: true, DeletedNamespace: true}
+
+	out, err := FormatRunResult(result, "text")
+	require.NoError(t, err)
+	assert.Equal(t, "TTL executed for namespace \"preview\"\nNamespace \"preview\" deleted\n", out)
+
+	result.DryRun = true
+	result.ResourceName = "preview-5975cf1b-ns-ttl"
+	result.Job = &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "preview-5975cf1b-ns-ttl-run"}}
+	out, err = FormatRunResult(result, "text")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, "Namespace:         preview\nResource Name:     preview-5975cf1b-ns-ttl\n"))
+	assert.NotContains(t, out, "Release:")
+}
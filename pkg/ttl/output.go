@@ -1,11 +1,18 @@
 package ttl
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"gopkg.in/yaml.v3"
+	"k8s.io/client-go/util/jsonpath"
+	k8syaml "sigs.k8s.io/yaml"
 )
 
 // TTLInfo contains information about a TTL setting for output.
@@ -16,6 +23,36 @@ type TTLInfo struct {
 	ScheduledDate    string `json:"scheduled_date" yaml:"scheduled_date"`
 	CronSchedule     string `json:"cron_schedule" yaml:"cron_schedule"`
 	DeleteNamespace  bool   `json:"delete_namespace" yaml:"delete_namespace"`
+	Generation       int64  `json:"generation" yaml:"generation"`
+	Remaining        string `json:"remaining" yaml:"remaining"`
+	// RemainingDuration is Remaining as a Go duration rounded down to the
+	// minute, e.g. 36h12m, which ParseDuration reads back; 0s once missed.
+	RemainingDuration string `json:"remaining_duration" yaml:"remaining_duration"`
+	// OriginalDuration is the duration the TTL was set for, e.g. 168h;
+	// empty for TTLs set before it was recorded.
+	OriginalDuration string `json:"original_duration,omitempty" yaml:"original_duration,omitempty"`
+	// RequestedDate is the expiry the TTL was set to when ScheduledDate,
+	// the effective expiry, is it rounded up to the minute.
+	RequestedDate string `json:"requested_date,omitempty" yaml:"requested_date,omitempty"`
+	// ScaleDownDate is when the scale-down stage of the TTL scales the
+	// release to zero replicas; empty for a TTL without one.
+	ScaleDownDate string `json:"scale_down_date,omitempty" yaml:"scale_down_date,omitempty"`
+	// ReleaseExists reports whether the release is still installed; nil
+	// when not checked.
+	ReleaseExists *bool `json:"release_exists,omitempty" yaml:"release_exists,omitempty"`
+	// Expired reports that the scheduled date has passed. A TTL that
+	// fired is gone with its CronJob, so an expired TTL is also Missed.
+	Expired bool `json:"expired" yaml:"expired"`
+	// Missed reports that the scheduled date passed without the TTL firing.
+	Missed bool `json:"missed" yaml:"missed"`
+	// Status is the live CronJob status; nil when not requested.
+	Status *TTLStatus `json:"status,omitempty" yaml:"status,omitempty"`
+	// LastRun is the most recent failed Job with its logs; nil when not
+	// requested.
+	LastRun *LastRun `json:"last_run,omitempty" yaml:"last_run,omitempty"`
+	// Warnings lists missing ServiceAccount or RBAC resources that would
+	// make the uninstall fail when the TTL fires.
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
 }
 
 // FormatOutput formats a TTLInfo in the specified format.
@@ -27,22 +64,511 @@ func FormatOutput(info TTLInfo, format string) (string, error) {
 			deleteNs = "yes"
 		}
 
-		return fmt.Sprintf("Release:          %s\n"+
+		remaining := info.Remaining
+		if info.Missed {
+			remaining = "missed (the scheduled date has passed but the TTL did not fire)"
+		}
+
+		out := fmt.Sprintf("Release:          %s\n"+
 			"Release Namespace: %s\n"+
 			"CronJob Namespace: %s\n"+
 			"Scheduled Date:   %s\n"+
+			"Remaining:        %s\n"+
 			"Cron Schedule:    %s\n"+
-			"Delete Namespace: %s\n",
+			"Delete Namespace: %s\n"+
+			"Generation:       %d\n",
 			info.ReleaseName,
 			info.ReleaseNamespace,
 			info.CronjobNamespace,
 			info.ScheduledDate,
+			remaining,
 			info.CronSchedule,
 			deleteNs,
-		), nil
+			info.Generation,
+		)
+
+		if info.OriginalDuration != "" {
+			out += fmt.Sprintf("Set Duration:     %s\n", info.OriginalDuration)
+		}
+
+		if info.RequestedDate != "" {
+			out += fmt.Sprintf("Requested Date:   %s\n", info.RequestedDate)
+		}
+
+		if info.ScaleDownDate != "" {
+			out += fmt.Sprintf("Scale Down Date:  %s\n", info.ScaleDownDate)
+		}
+
+		if info.ReleaseExists != nil {
+			exists := "yes"
+			if !*info.ReleaseExists {
+				exists = "no (uninstalled without removing its TTL)"
+			}
+			out += fmt.Sprintf("Release Exists:   %s\n", exists)
+		}
+
+		if info.Status != nil {
+			out += formatStatus(*info.Status)
+		}
+
+		if info.LastRun != nil {
+			out += formatLastRun(*info.LastRun)
+		}
+
+		return out, nil
+
+	default:
+		return formatStructured(info, format)
+	}
+}
+
+// formatStatus formats the live status lines of the text output.
+func formatStatus(status TTLStatus) string {
+	suspended := "no"
+	if status.Suspended {
+		suspended = "yes"
+	}
+
+	lastSchedule := status.LastScheduleTime
+	if lastSchedule == "" {
+		lastSchedule = "never"
+	}
+
+	lastSuccess := status.LastSuccessfulTime
+	if lastSuccess == "" {
+		lastSuccess = "never"
+	}
+
+	out := fmt.Sprintf("Suspended:        %s\n"+
+		"Last Schedule:    %s\n"+
+		"Last Successful:  %s\n"+
+		"Active Jobs:      %d\n",
+		suspended, lastSchedule, lastSuccess, status.ActiveJobs)
+
+	if status.Failures != nil {
+		if len(status.Failures) == 0 {
+			out += "Failures:         none\n"
+		} else {
+			out += "Failures:\n"
+			for _, f := range status.Failures {
+				out += fmt.Sprintf("  %s  %s  %s: %s\n", f.Time, f.Job, f.Reason, f.Message)
+			}
+		}
+	}
+
+	return out
+}
+
+// FormatImages formats EffectiveImages in the specified format.
+func FormatImages(images EffectiveImages, format string) (string, error) {
+	if format == "text" {
+		out := fmt.Sprintf("helm:    %s\n", images.Helm)
+		if images.Kubectl != "" {
+			out += fmt.Sprintf("kubectl: %s\n", images.Kubectl)
+		}
+		if images.Cleanup != "" {
+			out += fmt.Sprintf("cleanup: %s\n", images.Cleanup)
+		}
+
+		return out, nil
+	}
+
+	return formatStructured(images, format)
+}
+
+// FormatTTLList formats a list of TTLs in the specified format. The text
+// format is a table with a WARNING column for TTLs that would fail.
+func FormatTTLList(ttls []TTLInfo, format string) (string, error) {
+	if format != "text" {
+		return formatStructured(ttls, format)
+	}
+
+	return FormatTTLTable(ttls, DefaultTTLColumns, false), nil
+}
+
+// FormatHistory formats TTL history entries in the specified format.
+func FormatHistory(entries []HistoryEntry, format string) (string, error) {
+	if format != "text" {
+		return formatStructured(entries, format)
+	}
+
+	return FormatHistoryTable(entries, false), nil
+}
+
+// FormatHistoryTable formats TTL history entries as a table. With
+// noHeaders, for scripts, the header row and the message for no entries
+// are left out.
+func FormatHistoryTable(entries []HistoryEntry, noHeaders bool) string {
+	if len(entries) == 0 {
+		if noHeaders {
+			return ""
+		}
+
+		return "No TTL history recorded.\n"
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	if !noHeaders {
+		_, _ = fmt.Fprintln(w, "TIME\tOPERATION\tUSER\tOLD EXPIRY\tNEW EXPIRY")
+	}
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Time, e.Operation, e.User, orNone(e.OldExpiry), orNone(e.NewExpiry))
+	}
+	_ = w.Flush()
+
+	return buf.String()
+}
+
+// FormatExtendResults formats the outcome of a batch extend in the
+// specified format. The text format is a table followed by a summary line.
+func FormatExtendResults(results []ExtendResult, format string) (string, error) {
+	if format != "text" {
+		return formatStructured(results, format)
+	}
+
+	if len(results) == 0 {
+		return "No matching TTLs found.\n", nil
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "RELEASE\tNAMESPACE\tOLD EXPIRY\tNEW EXPIRY\tSTATUS")
+
+	extended := 0
+	for _, r := range results {
+		status := "extended"
+		if r.Error != "" {
+			status = "failed: " + r.Error
+		} else {
+			extended++
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.ReleaseName, r.ReleaseNamespace, orNone(r.OldExpiry), orNone(r.NewExpiry), status)
+	}
+	_ = w.Flush()
+
+	_, _ = fmt.Fprintf(&buf, "\nExtended %d of %d TTLs\n", extended, len(results))
+
+	return buf.String(), nil
+}
+
+// FormatUnsetResults formats the outcome of a batch unset in the
+// specified format. The text format is a table followed by a summary line.
+func FormatUnsetResults(results []UnsetResult, format string) (string, error) {
+	if format != "text" {
+		return formatStructured(results, format)
+	}
+
+	if len(results) == 0 {
+		return "No matching TTLs found.\n", nil
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "RELEASE\tNAMESPACE\tEXPIRY\tSTATUS")
+
+	removed := 0
+	for _, r := range results {
+		status := "removed"
+		if r.Error != "" {
+			status = "failed: " + r.Error
+		} else {
+			removed++
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.ReleaseName, r.ReleaseNamespace, orNone(r.Expiry), status)
+	}
+	_ = w.Flush()
+
+	_, _ = fmt.Fprintf(&buf, "\nRemoved %d of %d TTLs\n", removed, len(results))
+
+	return buf.String(), nil
+}
+
+// FormatImportResults formats the outcome of ImportTTLs in the specified
+// format. The text format is a table with a summary line, followed by the
+// warnings.
+func FormatImportResults(results []ImportResult, format string) (string, error) {
+	if format != "text" {
+		return formatStructured(results, format)
+	}
+
+	if len(results) == 0 {
+		return "No TTLs to import.\n", nil
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "RELEASE\tNAMESPACE\tEXPIRY\tSTATUS")
+
+	imported := 0
+	var warnings []string
+	for _, r := range results {
+		status := "imported"
+		switch {
+		case r.Error != "":
+			status = "failed: " + r.Error
+		case r.Expired:
+			status = "skipped: expired"
+		default:
+			imported++
+		}
+
+		release, namespace := r.ReleaseName, r.ReleaseNamespace
+		if r.Namespace != "" {
+			release, namespace = "(namespace)", r.Namespace
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", release, namespace, orNone(r.Expiry), status)
+		warnings = append(warnings, r.Warnings...)
+	}
+	_ = w.Flush()
+
+	_, _ = fmt.Fprintf(&buf, "\nImported %d of %d TTLs\n", imported, len(results))
+	for _, warning := range warnings {
+		_, _ = fmt.Fprintf(&buf, "Warning: %s\n", warning)
+	}
+
+	return buf.String(), nil
+}
+
+// FormatSetResult formats the outcome of SetTTL in the specified format.
+// The text format is a one-line confirmation, or the expiry of the TTL
+// IfNotExists kept.
+func FormatSetResult(result *SetResult, format string) (string, error) {
+	if format != "text" {
+		return formatStructured(result, format)
+	}
+
+	if result.AlreadySet {
+		return fmt.Sprintf("TTL already set for release %q in namespace %q, expires at %s\n", result.ReleaseName, result.ReleaseNamespace, result.ExpiresAt), nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "TTL set for release %q in namespace %q, expires at %s\n", result.ReleaseName, result.ReleaseNamespace, result.ExpiresAt)
+	if result.ScaleDownAt != "" {
+		fmt.Fprintf(&b, "Scales down to zero replicas at %s\n", result.ScaleDownAt)
+	}
+	for _, w := range result.Warnings {
+		fmt.Fprintf(&b, "Warning: %s\n", w)
+	}
+
+	return b.String(), nil
+}
+
+// FormatNamespaceTTL formats a NamespaceTTLInfo in the specified format.
+func FormatNamespaceTTL(info NamespaceTTLInfo, format string) (string, error) {
+	if format != "text" {
+		return formatStructured(info, format)
+	}
+
+	remaining := info.Remaining
+	if info.Missed {
+		remaining = "missed (the scheduled date has passed but the TTL did not fire)"
+	}
+
+	return fmt.Sprintf("Namespace:         %s\n"+
+		"CronJob Namespace: %s\n"+
+		"CronJob:           %s\n"+
+		"Scheduled Date:    %s\n"+
+		"Remaining:         %s\n"+
+		"Cron Schedule:     %s\n"+
+		"Generation:        %d\n",
+		info.Namespace,
+		info.CronjobNamespace,
+		info.CronJobName,
+		info.ScheduledDate,
+		remaining,
+		info.CronSchedule,
+		info.Generation,
+	), nil
+}
+
+// FormatRunPreview formats the result of a dry run of RunTTL: what would
+// be uninstalled and cleaned up, followed by the Job manifest.
+func FormatRunPreview(result *RunTTLResult) (string, error) {
+	manifest, err := k8syaml.Marshal(result.Job)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal Job: %w", err)
+	}
+
+	deleteNs := "no"
+	if result.DeletedNamespace {
+		deleteNs = "yes"
+		if result.NamespaceDeleteDelay != "" {
+			deleteNs += ", " + result.NamespaceDeleteDelay + " after uninstall"
+		}
+	}
+
+	var buf bytes.Buffer
+	if result.NamespaceTTL {
+		_, _ = fmt.Fprintf(&buf, "Namespace:         %s\n", result.ReleaseNamespace)
+	} else {
+		_, _ = fmt.Fprintf(&buf, "Release:           %s\n"+
+			"Release Namespace: %s\n",
+			result.ReleaseName,
+			result.ReleaseNamespace,
+		)
+	}
+	_, _ = fmt.Fprintf(&buf, "Resource Name:     %s\n"+
+		"Uninstall Command: %s\n",
+		result.ResourceName,
+		strings.Join(result.UninstallCommand, " "),
+	)
+	if result.TwoPhaseGrace != "" {
+		_, _ = fmt.Fprintf(&buf, "Two-Phase Grace:   %s after publishing the manifest\n", result.TwoPhaseGrace)
+	}
+	_, _ = fmt.Fprintf(&buf, "Delete Namespace:  %s\n", deleteNs)
+
+	_, _ = fmt.Fprintln(&buf, "RBAC Cleanup:")
+	if len(result.RBAC) == 0 {
+		_, _ = fmt.Fprintln(&buf, "  (none)")
+	}
+	for _, r := range result.RBAC {
+		_, _ = fmt.Fprintf(&buf, "  %s\n", r)
+	}
 
+	_, _ = fmt.Fprintf(&buf, "\nJob manifest:\n---\n%s", manifest)
+
+	return buf.String(), nil
+}
+
+// FormatRunResult formats the result of RunTTL in the specified format.
+// The text format is the dry-run preview, or a summary of the run.
+func FormatRunResult(result *RunTTLResult, format string) (string, error) {
+	switch format {
+	case "text":
+		if result.DryRun {
+			return FormatRunPreview(result)
+		}
+
+		out := fmt.Sprintf("TTL executed for release %q in namespace %q\n", result.ReleaseName, result.ReleaseNamespace)
+		if result.NamespaceTTL {
+			out = fmt.Sprintf("TTL executed for namespace %q\n", result.ReleaseNamespace)
+		}
+		if result.DeletedNamespace {
+			out += fmt.Sprintf("Namespace %q deleted\n", result.ReleaseNamespace)
+		}
+
+		if len(result.ContainerResults) == 0 {
+			return out, nil
+		}
+
+		var buf bytes.Buffer
+		w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "\nCONTAINER\tEXIT CODE\tDURATION")
+		for _, c := range result.ContainerResults {
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%s\n", c.Name, c.ExitCode, formatSeconds(c.DurationSeconds))
+		}
+		_ = w.Flush()
+
+		return out + buf.String() + fmt.Sprintf("Total: %s\n", formatSeconds(result.DurationSeconds)), nil
+
+	case "yaml":
+		// The Job manifest only carries json tags, so marshal through them.
+		data, err := k8syaml.Marshal(result)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal YAML: %w", err)
+		}
+
+		return string(data), nil
+
+	default:
+		return formatStructured(result, format)
+	}
+}
+
+// FormatCleanupResults formats the resources found by CleanupOrphaned in
+// the specified format. The text format says whether each was deleted.
+func FormatCleanupResults(orphaned []OrphanedResource, dryRun bool, format string) (string, error) {
+	if format != "text" {
+		if orphaned == nil {
+			orphaned = []OrphanedResource{}
+		}
+
+		return formatStructured(orphaned, format)
+	}
+
+	if len(orphaned) == 0 {
+		return "No orphaned resources found\n", nil
+	}
+
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+
+	var buf bytes.Buffer
+	for _, o := range orphaned {
+		_, _ = fmt.Fprintf(&buf, "%s %s\n", verb, o)
+	}
+
+	return buf.String(), nil
+}
+
+// Output format prefixes for templates evaluated against the JSON form of
+// the output, as with kubectl -o go-template=... and -o jsonpath=....
+const (
+	GoTemplatePrefix = "go-template="
+	JSONPathPrefix   = "jsonpath="
+)
+
+// ValidateOutputFormat returns an error unless format is text, json, yaml
+// or a template that parses, for commands that must reject a bad format
+// before acting.
+func ValidateOutputFormat(format string) error {
+	switch format {
+	case "text", "json", "yaml":
+		return nil
+	default:
+		_, err := parseTemplate(format)
+		return err
+	}
+}
+
+// templatePrinter renders a value already decoded from JSON.
+type templatePrinter func(w io.Writer, data any) error
+
+// parseTemplate parses a go-template= or jsonpath= output format.
+func parseTemplate(format string) (templatePrinter, error) {
+	if text, ok := strings.CutPrefix(format, GoTemplatePrefix); ok {
+		tmpl, err := template.New("output").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid go-template: %w", err)
+		}
+
+		return func(w io.Writer, data any) error {
+			return tmpl.Execute(w, data)
+		}, nil
+	}
+
+	if expr, ok := strings.CutPrefix(format, JSONPathPrefix); ok {
+		jp := jsonpath.New("output").AllowMissingKeys(true)
+		if err := jp.Parse(expr); err != nil {
+			return nil, fmt.Errorf("invalid jsonpath: %w", err)
+		}
+
+		return jp.Execute, nil
+	}
+
+	return nil, fmt.Errorf("unsupported output format %q; valid formats: text, json, yaml, %sTEMPLATE, %sEXPRESSION", format, GoTemplatePrefix, JSONPathPrefix)
+}
+
+// orNone returns s, or "-" when it is empty.
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// formatStructured formats a value as JSON or YAML, or through a
+// template applied to its JSON form.
+func formatStructured(v any, format string) (string, error) {
+	switch format {
 	case "json":
-		data, err := json.MarshalIndent(info, "", "  ")
+		data, err := json.MarshalIndent(v, "", "  ")
 		if err != nil {
 			return "", fmt.Errorf("failed to marshal JSON: %w", err)
 		}
@@ -50,7 +576,7 @@ func FormatOutput(info TTLInfo, format string) (string, error) {
 		return string(data) + "\n", nil
 
 	case "yaml":
-		data, err := yaml.Marshal(info)
+		data, err := yaml.Marshal(v)
 		if err != nil {
 			return "", fmt.Errorf("failed to marshal YAML: %w", err)
 		}
@@ -58,8 +584,77 @@ func FormatOutput(info TTLInfo, format string) (string, error) {
 		return string(data), nil
 
 	default:
-		return "", fmt.Errorf("unsupported output format %q; valid formats: text, json, yaml", format)
+		printer, err := parseTemplate(format)
+		if err != nil {
+			return "", err
+		}
+
+		// Templates see the fields as -o json names them
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+
+		var data any
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return "", fmt.Errorf("failed to unmarshal JSON: %w", err)
+		}
+
+		var buf bytes.Buffer
+		if err := printer(&buf, data); err != nil {
+			return "", fmt.Errorf("failed to execute template: %w", err)
+		}
+
+		return buf.String(), nil
+	}
+}
+
+// FormatRemaining formats the time left until a TTL fires, e.g. 3d4h5m.
+func FormatRemaining(d time.Duration) string {
+	if d < time.Minute {
+		return "<1m"
+	}
+
+	d = d.Truncate(time.Minute)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	minutes := (d - hours*time.Hour) / time.Minute
+
+	if days > 0 {
+		return fmt.Sprintf("%dd%dh%dm", days, hours, minutes)
+	}
+
+	if hours > 0 {
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	}
+
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// FormatDuration formats d as a Go duration without the zero minutes and
+// seconds time.Duration adds, e.g. 36h12m rather than 36h12m0s, so that
+// ParseDuration reads it back.
+func FormatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
 	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+
+	return s
+}
+
+// formatSeconds formats a duration in seconds rounded to the second, or
+// "-" when it is unknown.
+func formatSeconds(seconds float64) string {
+	if seconds == 0 {
+		return "-"
+	}
+
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Second).String()
 }
 
 // FormatScheduledDate formats a time for display.
@@ -6,6 +6,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestFormatOutput(t *testing.T) {
@@ -16,6 +18,7 @@ func TestFormatOutput(t *testing.T) {
 		ScheduledDate:    "2025-06-15T14:30:00Z",
 		CronSchedule:     "30 14 15 6 *",
 		DeleteNamespace:  false,
+		Generation:       3,
 	}
 
 	t.Run("text format", func(t *testing.T) {
@@ -27,6 +30,7 @@ func TestFormatOutput(t *testing.T) {
 		assert.Contains(t, result, "Scheduled Date:   2025-06-15T14:30:00Z")
 		assert.Contains(t, result, "Cron Schedule:    30 14 15 6 *")
 		assert.Contains(t, result, "Delete Namespace: no")
+		assert.Contains(t, result, "Generation:       3")
 	})
 
 	t.Run("text format with delete namespace", func(t *testing.T) {
@@ -46,6 +50,7 @@ func TestFormatOutput(t *testing.T) {
 		assert.Contains(t, result, `"scheduled_date": "2025-06-15T14:30:00Z"`)
 		assert.Contains(t, result, `"cron_schedule": "30 14 15 6 *"`)
 		assert.Contains(t, result, `"delete_namespace": false`)
+		assert.Contains(t, result, `"generation": 3`)
 	})
 
 	t.Run("yaml format", func(t *testing.T) {
@@ -57,6 +62,35 @@ func TestFormatOutput(t *testing.T) {
 		assert.Contains(t, result, "scheduled_date: \"2025-06-15T14:30:00Z\"")
 		assert.Contains(t, result, "cron_schedule: 30 14 15 6 *")
 		assert.Contains(t, result, "delete_namespace: false")
+		assert.Contains(t, result, "generation: 3")
+	})
+
+	t.Run("go-template format", func(t *testing.T) {
+		result, err := FormatOutput(info, "go-template={{.scheduled_date}} {{.generation}}")
+		require.NoError(t, err)
+		assert.Equal(t, "2025-06-15T14:30:00Z 3", result)
+	})
+
+	t.Run("jsonpath format", func(t *testing.T) {
+		result, err := FormatOutput(info, "jsonpath={.release_namespace}/{.release_name}")
+		require.NoError(t, err)
+		assert.Equal(t, "staging/myapp", result)
+
+		// Fields omitted from the JSON output are empty, as in kubectl
+		result, err = FormatOutput(info, "jsonpath={.status.suspended}")
+		require.NoError(t, err)
+		assert.Empty(t, result)
+	})
+
+	t.Run("invalid templates", func(t *testing.T) {
+		_, err := FormatOutput(info, "go-template={{.release_name")
+		assert.ErrorContains(t, err, "invalid go-template")
+
+		_, err = FormatOutput(info, "go-template={{.release_name.nested}}")
+		assert.ErrorContains(t, err, "failed to execute template")
+
+		_, err = FormatOutput(info, "jsonpath={.release_name")
+		assert.ErrorContains(t, err, "invalid jsonpath")
 	})
 
 	t.Run("invalid format", func(t *testing.T) {
@@ -64,6 +98,11 @@ func TestFormatOutput(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "unsupported output format")
 	})
+
+	t.Run("unmarshalable value", func(t *testing.T) {
+		_, err := formatStructured(func() {}, "jsonpath={.x}")
+		assert.ErrorContains(t, err, "failed to marshal JSON")
+	})
 }
 
 func TestFormatScheduledDate(t *testing.T) {
@@ -71,3 +110,521 @@ func TestFormatScheduledDate(t *testing.T) {
 	result := FormatScheduledDate(ts)
 	assert.Equal(t, "2025-06-15T14:30:00Z", result)
 }
+
+func TestFormatImages(t *testing.T) {
+	images := EffectiveImages{Helm: "alpine/helm:latest", Kubectl: "alpine/k8s:latest"}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := FormatImages(images, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "helm:    alpine/helm:latest\nkubectl: alpine/k8s:latest\n", out)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		out, err := FormatImages(images, "yaml")
+		require.NoError(t, err)
+		assert.Equal(t, "helm: alpine/helm:latest\nkubectl: alpine/k8s:latest\n", out)
+	})
+
+	t.Run("text with cleanup image", func(t *testing.T) {
+		out, err := FormatImages(EffectiveImages{Helm: "alpine/helm:latest", Cleanup: "helm-ttl-cleanup:v1"}, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "helm:    alpine/helm:latest\ncleanup: helm-ttl-cleanup:v1\n", out)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := FormatImages(images, "xml")
+		assert.Error(t, err)
+	})
+}
+
+func TestFormatOutput_Status(t *testing.T) {
+	info := TTLInfo{
+		ReleaseName:  "myapp",
+		CronSchedule: "30 14 15 3 *",
+		Status: &TTLStatus{
+			Suspended:        true,
+			LastScheduleTime: "2025-03-15T14:30:00Z",
+			ActiveJobs:       1,
+		},
+	}
+
+	t.Run("without failures", func(t *testing.T) {
+		out, err := FormatOutput(info, "text")
+		require.NoError(t, err)
+		assert.Contains(t, out, "Suspended:        yes\n")
+		assert.Contains(t, out, "Last Schedule:    2025-03-15T14:30:00Z\n")
+		assert.Contains(t, out, "Last Successful:  never\n")
+		assert.Contains(t, out, "Active Jobs:      1\n")
+		assert.NotContains(t, out, "Failures")
+	})
+
+	t.Run("no failures", func(t *testing.T) {
+		status := *info.Status
+		status.Suspended = false
+		status.LastScheduleTime = ""
+		status.LastSuccessfulTime = "2025-03-15T14:31:00Z"
+		status.Failures = []JobFailure{}
+
+		out, err := FormatOutput(TTLInfo{Status: &status}, "text")
+		require.NoError(t, err)
+		assert.Contains(t, out, "Suspended:        no\n")
+		assert.Contains(t, out, "Last Schedule:    never\n")
+		assert.Contains(t, out, "Last Successful:  2025-03-15T14:31:00Z\n")
+		assert.Contains(t, out, "Failures:         none\n")
+	})
+
+	t.Run("with failures", func(t *testing.T) {
+		status := *info.Status
+		status.Failures = []JobFailure{{Job: "job-1", Time: "2025-03-15T14:31:00Z", Reason: "BackoffLimitExceeded", Message: "limit reached"}}
+
+		out, err := FormatOutput(TTLInfo{Status: &status}, "text")
+		require.NoError(t, err)
+		assert.Contains(t, out, "Failures:\n  2025-03-15T14:31:00Z  job-1  BackoffLimitExceeded: limit reached\n")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatOutput(info, "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"suspended": true`)
+		assert.Contains(t, out, `"active_jobs": 1`)
+	})
+}
+
+func TestFormatRemaining(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{30 * time.Second, "<1m"},
+		{-time.Hour, "<1m"},
+		{45*time.Minute + 30*time.Second, "45m"},
+		{2*time.Hour + 5*time.Minute, "2h5m"},
+		{3*24*time.Hour + 4*time.Hour + 5*time.Minute, "3d4h5m"},
+		{24 * time.Hour, "1d0h0m"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, tc.expected, FormatRemaining(tc.d))
+		})
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{0, "0s"},
+		{30 * time.Second, "30s"},
+		{10 * time.Minute, "10m"},
+		{2 * time.Hour, "2h"},
+		{36*time.Hour + 12*time.Minute, "36h12m"},
+		{time.Hour + 30*time.Second, "1h0m30s"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, tc.expected, FormatDuration(tc.d))
+
+			d, err := time.ParseDuration(FormatDuration(tc.d))
+			require.NoError(t, err)
+			assert.Equal(t, tc.d, d)
+		})
+	}
+}
+
+func TestFormatOutput_Remaining(t *testing.T) {
+	out, err := FormatOutput(TTLInfo{ScheduledDate: "2025-06-15T14:30:00Z", Remaining: "3d4h5m"}, "text")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Scheduled Date:   2025-06-15T14:30:00Z\nRemaining:        3d4h5m\n")
+	assert.NotContains(t, out, "Set Duration")
+
+	out, err = FormatOutput(TTLInfo{Remaining: "3d4h5m", OriginalDuration: "168h"}, "text")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Set Duration:     168h\n")
+
+	out, err = FormatOutput(TTLInfo{Remaining: "missed", Missed: true}, "text")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Remaining:        missed (the scheduled date has passed but the TTL did not fire)\n")
+}
+
+func TestFormatHistory(t *testing.T) {
+	entries := []HistoryEntry{
+		{Time: "2025-03-10T09:00:00Z", Operation: OperationSet, User: "alice", NewExpiry: "2025-03-11T09:00:00Z"},
+		{Time: "2025-03-10T12:00:00Z", Operation: OperationUnset, User: "bob", OldExpiry: "2025-03-11T09:00:00Z"},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := FormatHistory(entries, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "TIME                  OPERATION  USER   OLD EXPIRY            NEW EXPIRY\n"+
+			"2025-03-10T09:00:00Z  set        alice  -                     2025-03-11T09:00:00Z\n"+
+			"2025-03-10T12:00:00Z  unset      bob    2025-03-11T09:00:00Z  -\n", out)
+	})
+
+	t.Run("text without headers", func(t *testing.T) {
+		assert.Equal(t, "2025-03-10T09:00:00Z  set    alice  -                     2025-03-11T09:00:00Z\n"+
+			"2025-03-10T12:00:00Z  unset  bob    2025-03-11T09:00:00Z  -\n", FormatHistoryTable(entries, true))
+		assert.Empty(t, FormatHistoryTable(nil, true))
+	})
+
+	t.Run("text without history", func(t *testing.T) {
+		out, err := FormatHistory([]HistoryEntry{}, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "No TTL history recorded.\n", out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatHistory(entries, "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"operation": "unset"`)
+		assert.Contains(t, out, `"old_expiry": "2025-03-11T09:00:00Z"`)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := FormatHistory(entries, "xml")
+		assert.Error(t, err)
+	})
+}
+
+func TestFormatExtendResults(t *testing.T) {
+	results := []ExtendResult{
+		{ReleaseName: "cart", ReleaseNamespace: "default", OldExpiry: "2025-03-10T09:00:00Z", NewExpiry: "2025-03-17T09:00:00Z"},
+		{ReleaseName: "payments", ReleaseNamespace: "default", OldExpiry: "2025-03-10T09:00:00Z", Error: "forbidden"},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := FormatExtendResults(results, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "RELEASE   NAMESPACE  OLD EXPIRY            NEW EXPIRY            STATUS\n"+
+			"cart      default    2025-03-10T09:00:00Z  2025-03-17T09:00:00Z  extended\n"+
+			"payments  default    2025-03-10T09:00:00Z  -                     failed: forbidden\n"+
+			"\nExtended 1 of 2 TTLs\n", out)
+	})
+
+	t.Run("text without matches", func(t *testing.T) {
+		out, err := FormatExtendResults([]ExtendResult{}, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "No matching TTLs found.\n", out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatExtendResults(results, "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"error": "forbidden"`)
+	})
+}
+
+func TestFormatUnsetResults(t *testing.T) {
+	results := []UnsetResult{
+		{ReleaseName: "cart", ReleaseNamespace: "default", Expiry: "2025-03-10T09:00:00Z"},
+		{ReleaseName: "payments", ReleaseNamespace: "default", Expiry: "2025-03-10T09:00:00Z", Error: "forbidden"},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := FormatUnsetResults(results, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "RELEASE   NAMESPACE  EXPIRY                STATUS\n"+
+			"cart      default    2025-03-10T09:00:00Z  removed\n"+
+			"payments  default    2025-03-10T09:00:00Z  failed: forbidden\n"+
+			"\nRemoved 1 of 2 TTLs\n", out)
+	})
+
+	t.Run("text without matches", func(t *testing.T) {
+		out, err := FormatUnsetResults([]UnsetResult{}, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "No matching TTLs found.\n", out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatUnsetResults(results, "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"error": "forbidden"`)
+	})
+}
+
+func TestFormatImportResults(t *testing.T) {
+	results := []ImportResult{
+		{ReleaseName: "cart", ReleaseNamespace: "default", CronjobNamespace: "default", Expiry: "2025-03-10T09:00:00Z", Warnings: []string{`release "cart" not found`}},
+		{Namespace: "preview", CronjobNamespace: "ops", Expiry: "2025-03-11T09:00:00Z"},
+		{ReleaseName: "old", ReleaseNamespace: "default", CronjobNamespace: "default", Expiry: "2025-01-01T09:00:00Z", Expired: true},
+		{ReleaseName: "payments", ReleaseNamespace: "default", CronjobNamespace: "default", Expiry: "2025-03-10T09:00:00Z", Error: "forbidden"},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := FormatImportResults(results, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "RELEASE      NAMESPACE  EXPIRY                STATUS\n"+
+			"cart         default    2025-03-10T09:00:00Z  imported\n"+
+			"(namespace)  preview    2025-03-11T09:00:00Z  imported\n"+
+			"old          default    2025-01-01T09:00:00Z  skipped: expired\n"+
+			"payments     default    2025-03-10T09:00:00Z  failed: forbidden\n"+
+			"\nImported 2 of 4 TTLs\n"+
+			"Warning: release \"cart\" not found\n", out)
+	})
+
+	t.Run("text without TTLs", func(t *testing.T) {
+		out, err := FormatImportResults([]ImportResult{}, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "No TTLs to import.\n", out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatImportResults(results, "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"expired": true`)
+	})
+}
+
+func TestFormatSetResult(t *testing.T) {
+	result := &SetResult{
+		ReleaseName:      "cart",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		CronJobName:      "cart-589dfa7a-ttl",
+		ExpiresAt:        "2025-03-10T09:00:00Z",
+		CronSchedule:     "0 9 10 3 *",
+		Generation:       1,
+		ServiceAccount:   "cart-589dfa7a-ttl",
+		RBAC: []OrphanedResource{
+			{Kind: "ServiceAccount", Name: "cart-589dfa7a-ttl", Namespace: "default"},
+		},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := FormatSetResult(result, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "TTL set for release \"cart\" in namespace \"default\", expires at 2025-03-10T09:00:00Z\n", out)
+	})
+
+	t.Run("text already set", func(t *testing.T) {
+		kept := *result
+		kept.AlreadySet = true
+		out, err := FormatSetResult(&kept, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "TTL already set for release \"cart\" in namespace \"default\", expires at 2025-03-10T09:00:00Z\n", out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatSetResult(result, "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"cronjob_name": "cart-589dfa7a-ttl"`)
+		assert.Contains(t, out, `"expires_at": "2025-03-10T09:00:00Z"`)
+		assert.Contains(t, out, `"cron_schedule": "0 9 10 3 *"`)
+		assert.Contains(t, out, `"kind": "ServiceAccount"`)
+		assert.NotContains(t, out, "old_expiry")
+	})
+
+	t.Run("jsonpath", func(t *testing.T) {
+		out, err := FormatSetResult(result, "jsonpath={.expires_at}")
+		require.NoError(t, err)
+		assert.Equal(t, "2025-03-10T09:00:00Z", out)
+	})
+}
+
+func TestFormatTTLList(t *testing.T) {
+	ttls := []TTLInfo{
+		{ReleaseName: "cart", ReleaseNamespace: "default", CronjobNamespace: "default", ScheduledDate: "2025-03-10T09:00:00Z", Remaining: "2d"},
+		{ReleaseName: "search", ReleaseNamespace: "default", CronjobNamespace: "ops", ScheduledDate: "2025-03-11T09:00:00Z", Remaining: "3d",
+			Warnings: []string{"ServiceAccount search-81bd4a47-ttl not found in namespace ops", "ClusterRoleBinding search-81bd4a47-ttl not found"}},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := FormatTTLList(ttls, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "RELEASE  NAMESPACE  CRONJOB NAMESPACE  SCHEDULED DATE        REMAINING  WARNING\n"+
+			"cart     default    default            2025-03-10T09:00:00Z  2d         -\n"+
+			"search   default    ops                2025-03-11T09:00:00Z  3d         ServiceAccount search-81bd4a47-ttl not found in namespace ops; ClusterRoleBinding search-81bd4a47-ttl not found\n", out)
+	})
+
+	t.Run("text without TTLs", func(t *testing.T) {
+		out, err := FormatTTLList([]TTLInfo{}, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "No TTLs found.\n", out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatTTLList(ttls, "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"warnings": [`)
+	})
+}
+
+func TestFormatRunPreview(t *testing.T) {
+	result := &RunTTLResult{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "staging",
+		DeletedNamespace: true,
+		DryRun:           true,
+		ResourceName:     "myapp-80081014-ttl",
+		UninstallCommand: []string{"helm", "uninstall", "myapp", "--namespace", "staging"},
+		Job: &batchv1.Job{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl-run", Namespace: "ops"},
+		},
+		RBAC: []OrphanedResource{
+			{Kind: "ClusterRole", Name: "myapp-80081014-ttl"},
+			{Kind: "ServiceAccount", Name: "myapp-80081014-ttl", Namespace: "ops"},
+		},
+	}
+
+	t.Run("with RBAC", func(t *testing.T) {
+		out, err := FormatRunPreview(result)
+		require.NoError(t, err)
+		assert.Contains(t, out, "Resource Name:     myapp-80081014-ttl\n")
+		assert.Contains(t, out, "Uninstall Command: helm uninstall myapp --namespace staging\n")
+		assert.Contains(t, out, "Delete Namespace:  yes\n")
+		assert.Contains(t, out, "  ClusterRole myapp-80081014-ttl (cluster-scoped)\n")
+		assert.Contains(t, out, "  ServiceAccount myapp-80081014-ttl in namespace ops\n")
+		assert.Contains(t, out, "Job manifest:\n---\napiVersion: batch/v1\nkind: Job\n")
+	})
+
+	t.Run("without RBAC", func(t *testing.T) {
+		noRBAC := *result
+		noRBAC.RBAC = nil
+		noRBAC.DeletedNamespace = false
+
+		out, err := FormatRunPreview(&noRBAC)
+		require.NoError(t, err)
+		assert.Contains(t, out, "Delete Namespace:  no\n")
+		assert.Contains(t, out, "RBAC Cleanup:\n  (none)\n")
+	})
+
+	t.Run("with namespace delete delay", func(t *testing.T) {
+		delayed := *result
+		delayed.NamespaceDeleteDelay = "10m0s"
+
+		out, err := FormatRunPreview(&delayed)
+		require.NoError(t, err)
+		assert.Contains(t, out, "Delete Namespace:  yes, 10m0s after uninstall\n")
+		assert.NotContains(t, out, "Two-Phase Grace:")
+	})
+
+	t.Run("with two-phase grace", func(t *testing.T) {
+		twoPhase := *result
+		twoPhase.TwoPhaseGrace = "10m0s"
+
+		out, err := FormatRunPreview(&twoPhase)
+		require.NoError(t, err)
+		assert.Contains(t, out, "Uninstall Command: helm uninstall myapp --namespace staging\nTwo-Phase Grace:   10m0s after publishing the manifest\nDelete Namespace:  yes\n")
+	})
+}
+
+func TestFormatRunResult(t *testing.T) {
+	t.Run("text", func(t *testing.T) {
+		out, err := FormatRunResult(&RunTTLResult{ReleaseName: "myapp", ReleaseNamespace: "staging", DeletedNamespace: true}, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "TTL executed for release \"myapp\" in namespace \"staging\"\nNamespace \"staging\" deleted\n", out)
+	})
+
+	t.Run("text with containers", func(t *testing.T) {
+		out, err := FormatRunResult(&RunTTLResult{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "staging",
+			ContainerResults: []ContainerResult{
+				{Name: "helm-uninstall", ExitCode: 0, DurationSeconds: 12.4},
+				{Name: "self-cleanup", ExitCode: 1},
+			},
+			DurationSeconds: 62.7,
+		}, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "TTL executed for release \"myapp\" in namespace \"staging\"\n"+
+			"\n"+
+			"CONTAINER       EXIT CODE  DURATION\n"+
+			"helm-uninstall  0          12s\n"+
+			"self-cleanup    1          -\n"+
+			"Total: 1m3s\n", out)
+	})
+
+	t.Run("text dry run", func(t *testing.T) {
+		out, err := FormatRunResult(&RunTTLResult{ReleaseName: "myapp", DryRun: true, Job: &batchv1.Job{}}, "text")
+		require.NoError(t, err)
+		assert.Contains(t, out, "Job manifest:")
+	})
+
+	result := &RunTTLResult{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "staging",
+		JobFailed:        true,
+		ContainerResults: []ContainerResult{{Name: "helm-uninstall", ExitCode: 1}},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatRunResult(result, "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"job_failed": true`)
+		assert.Contains(t, out, `"exit_code": 1`)
+		assert.NotContains(t, out, `"job":`)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		withJob := *result
+		withJob.Job = &batchv1.Job{TypeMeta: metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"}}
+
+		out, err := FormatRunResult(&withJob, "yaml")
+		require.NoError(t, err)
+		assert.Contains(t, out, "job_failed: true\n")
+		assert.Contains(t, out, "  apiVersion: batch/v1\n")
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		_, err := FormatRunResult(result, "xml")
+		assert.ErrorContains(t, err, "unsupported output format")
+	})
+}
+
+func TestFormatCleanupResults(t *testing.T) {
+	orphaned := []OrphanedResource{
+		{Kind: "ClusterRole", Name: "myapp-80081014-ttl"},
+		{Kind: "ServiceAccount", Name: "myapp-80081014-ttl", Namespace: "ops"},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := FormatCleanupResults(orphaned, false, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "Deleted ClusterRole myapp-80081014-ttl (cluster-scoped)\n"+
+			"Deleted ServiceAccount myapp-80081014-ttl in namespace ops\n", out)
+	})
+
+	t.Run("text dry run", func(t *testing.T) {
+		out, err := FormatCleanupResults(orphaned[:1], true, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "Would delete ClusterRole myapp-80081014-ttl (cluster-scoped)\n", out)
+	})
+
+	t.Run("text without resources", func(t *testing.T) {
+		out, err := FormatCleanupResults(nil, false, "text")
+		require.NoError(t, err)
+		assert.Equal(t, "No orphaned resources found\n", out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatCleanupResults(orphaned, false, "json")
+		require.NoError(t, err)
+		assert.Contains(t, out, `"kind": "ClusterRole"`)
+		assert.NotContains(t, out, `"namespace": ""`)
+	})
+
+	t.Run("json without resources", func(t *testing.T) {
+		out, err := FormatCleanupResults(nil, false, "json")
+		require.NoError(t, err)
+		assert.Equal(t, "[]\n", out)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		out, err := FormatCleanupResults(orphaned[1:], false, "yaml")
+		require.NoError(t, err)
+		assert.Equal(t, "- kind: ServiceAccount\n  name: myapp-80081014-ttl\n  namespace: ops\n", out)
+	})
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	for _, format := range []string{"text", "json", "yaml", "go-template={{.remaining}}", "jsonpath={.remaining}"} {
+		assert.NoError(t, ValidateOutputFormat(format))
+	}
+
+	assert.ErrorContains(t, ValidateOutputFormat("xml"), `unsupported output format "xml"`)
+	assert.ErrorContains(t, ValidateOutputFormat("go-template={{"), "invalid go-template")
+}
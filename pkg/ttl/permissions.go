@@ -0,0 +1,85 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// permissionWarnings checks that the ServiceAccount a TTL CronJob runs as
+// still exists and, when helm-ttl created it, that its role bindings do
+// too. Each problem found is returned as a warning, since the uninstall
+// would otherwise fail with Forbidden when the TTL fires. Checks that
+// cannot be made, e.g. for lack of permission, are skipped.
+func permissionWarnings(ctx context.Context, client kubernetes.Interface, cj *batchv1.CronJob, releaseNamespace string) []string {
+	var warnings []string
+
+	resourceName := cj.Name
+	saName := cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName
+	if saName == "" {
+		saName = "default"
+	}
+
+	managed := saName == resourceName
+	sa, err := client.CoreV1().ServiceAccounts(cj.Namespace).Get(ctx, saName, metav1.GetOptions{})
+	switch {
+	case err == nil:
+		managed = managed || sa.Labels[LabelManagedBy] == LabelManagedByValue
+	case errors.IsNotFound(err):
+		warnings = append(warnings, fmt.Sprintf("ServiceAccount %s not found in namespace %s", saName, cj.Namespace))
+	}
+
+	// Bindings for a ServiceAccount supplied by the user are not ours to
+	// know about.
+	if !managed {
+		return warnings
+	}
+
+	// Releases kept in sql need no role in the release namespace unless
+	// the CronJob runs there.
+	var namespaces []string
+	if storage, _ := StorageResource(cronJobDriver(cj)); storage != "" || cj.Namespace == releaseNamespace {
+		namespaces = append(namespaces, releaseNamespace)
+	}
+	if cj.Namespace != releaseNamespace {
+		namespaces = append(namespaces, cj.Namespace)
+	}
+
+	for _, ns := range namespaces {
+		_, err := client.RbacV1().RoleBindings(ns).Get(ctx, resourceName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			warnings = append(warnings, fmt.Sprintf("RoleBinding %s not found in namespace %s", resourceName, ns))
+		}
+	}
+
+	if cj.Labels[LabelDeleteNamespace] == "true" {
+		_, err := client.RbacV1().ClusterRoleBindings().Get(ctx, resourceName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			warnings = append(warnings, fmt.Sprintf("ClusterRoleBinding %s not found", resourceName))
+		}
+	}
+
+	return warnings
+}
+
+// cronJobDriver returns the Helm storage driver a TTL CronJob uninstalls
+// with, from the HELM_DRIVER of its helm-uninstall container.
+func cronJobDriver(cj *batchv1.CronJob) string {
+	for _, c := range cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers {
+		if c.Name != "helm-uninstall" {
+			continue
+		}
+
+		for _, env := range c.Env {
+			if env.Name == "HELM_DRIVER" {
+				return env.Value
+			}
+		}
+	}
+
+	return "secrets"
+}
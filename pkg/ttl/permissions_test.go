@@ -0,0 +1,96 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestPermissionWarnings(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("created RBAC intact", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "staging", "ops", true)
+		cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName = "myapp-80081014-ttl"
+		client := fake.NewClientset()
+		require.NoError(t, CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true))
+
+		assert.Empty(t, permissionWarnings(ctx, client, cj, "staging"))
+	})
+
+	t.Run("sql driver needs no release namespace binding", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "staging",
+			CronjobNamespace: "ops",
+			Schedule:         "0 0 1 1 *",
+			ServiceAccount:   "myapp-80081014-ttl",
+			Driver:           "sql",
+		})
+		require.NoError(t, err)
+		client := fake.NewClientset()
+		require.NoError(t, CreateServiceAccountAndRBACForDriver(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", false, "sql"))
+
+		assert.Empty(t, permissionWarnings(ctx, client, cj, "staging"))
+	})
+
+	t.Run("created RBAC removed", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "staging", "ops", true)
+		cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName = "myapp-80081014-ttl"
+		client := fake.NewClientset()
+
+		assert.Equal(t, []string{
+			"ServiceAccount myapp-80081014-ttl not found in namespace ops",
+			"RoleBinding myapp-80081014-ttl not found in namespace staging",
+			"RoleBinding myapp-80081014-ttl not found in namespace ops",
+			"ClusterRoleBinding myapp-80081014-ttl not found",
+		}, permissionWarnings(ctx, client, cj, "staging"))
+	})
+
+	t.Run("custom-named created service account", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName = "ttl-runner"
+		client := fake.NewClientset(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name:      "ttl-runner",
+			Namespace: "default",
+			Labels:    map[string]string{LabelManagedBy: LabelManagedByValue},
+		}})
+
+		assert.Equal(t, []string{"RoleBinding myapp-4a0c226a-ttl not found in namespace default"},
+			permissionWarnings(ctx, client, cj, "default"))
+	})
+
+	t.Run("user service account", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		client := fake.NewClientset(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}})
+
+		assert.Empty(t, permissionWarnings(ctx, client, cj, "default"))
+	})
+
+	t.Run("user service account missing", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName = ""
+
+		assert.Equal(t, []string{"ServiceAccount default not found in namespace default"},
+			permissionWarnings(ctx, fake.NewClientset(), cj, "default"))
+	})
+
+	t.Run("checks that cannot be made are skipped", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName = "myapp-4a0c226a-ttl"
+		client := fake.NewClientset()
+		client.PrependReactor("get", "*", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("forbidden")
+		})
+
+		assert.Empty(t, permissionWarnings(ctx, client, cj, "default"))
+	})
+}
@@ -0,0 +1,135 @@
+package ttl
+
+import (
+	"fmt"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// PodOptions customizes the pod that runs the uninstall. Field names match
+// the Kubernetes PodSpec so a --pod-spec-file reads like a pod spec fragment.
+type PodOptions struct {
+	// Resources are applied to every container in the pod.
+	Resources         corev1.ResourceRequirements `json:"resources,omitempty"`
+	NodeSelector      map[string]string           `json:"nodeSelector,omitempty"`
+	Tolerations       []corev1.Toleration         `json:"tolerations,omitempty"`
+	Affinity          *corev1.Affinity            `json:"affinity,omitempty"`
+	PriorityClassName string                      `json:"priorityClassName,omitempty"`
+}
+
+// DefaultRunAsUser is the UID the uninstall containers run as: the
+// conventional "nobody" user, which exists in the alpine-based images.
+const DefaultRunAsUser int64 = 65534
+
+// SecurityOptions controls the security context of the uninstall pod. The
+// defaults satisfy the restricted Pod Security Standard.
+type SecurityOptions struct {
+	// Disabled omits the security contexts entirely, for images that must
+	// run as root.
+	Disabled bool
+	// RunAsUser and RunAsGroup default to DefaultRunAsUser.
+	RunAsUser  *int64
+	RunAsGroup *int64
+}
+
+// LoadPodOptions reads PodOptions from a YAML file.
+func LoadPodOptions(path string) (PodOptions, error) {
+	var opts PodOptions
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return opts, fmt.Errorf("failed to read pod spec file: %w", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, &opts); err != nil {
+		return opts, fmt.Errorf("failed to parse pod spec file %s: %w", path, err)
+	}
+
+	return opts, nil
+}
+
+// ParseResourceList converts a name=quantity map (e.g. from a
+// --requests cpu=100m,memory=64Mi flag) into a ResourceList.
+func ParseResourceList(values map[string]string) (corev1.ResourceList, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	list := make(corev1.ResourceList, len(values))
+	for name, value := range values {
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity %q for resource %s: %w", value, name, err)
+		}
+
+		list[corev1.ResourceName(name)] = q
+	}
+
+	return list, nil
+}
+
+// applyPodOptions applies pod customizations to a pod spec.
+func applyPodOptions(spec *corev1.PodSpec, opts PodOptions) {
+	spec.NodeSelector = opts.NodeSelector
+	spec.Tolerations = opts.Tolerations
+	spec.Affinity = opts.Affinity
+	spec.PriorityClassName = opts.PriorityClassName
+
+	for i := range spec.InitContainers {
+		spec.InitContainers[i].Resources = *opts.Resources.DeepCopy()
+	}
+	for i := range spec.Containers {
+		spec.Containers[i].Resources = *opts.Resources.DeepCopy()
+	}
+}
+
+// applySecurityContext sets pod and container security contexts that
+// satisfy the restricted Pod Security Standard. Since the containers no
+// longer run as root, HOME points to a writable directory for the helm and
+// kubectl caches.
+func applySecurityContext(spec *corev1.PodSpec, opts SecurityOptions) {
+	if opts.Disabled {
+		return
+	}
+
+	runAsUser := DefaultRunAsUser
+	if opts.RunAsUser != nil {
+		runAsUser = *opts.RunAsUser
+	}
+
+	runAsGroup := DefaultRunAsUser
+	if opts.RunAsGroup != nil {
+		runAsGroup = *opts.RunAsGroup
+	}
+
+	runAsNonRoot := true
+	spec.SecurityContext = &corev1.PodSecurityContext{
+		RunAsNonRoot: &runAsNonRoot,
+		RunAsUser:    &runAsUser,
+		RunAsGroup:   &runAsGroup,
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+
+	secure := func(c *corev1.Container) {
+		allowPrivilegeEscalation := false
+		c.SecurityContext = &corev1.SecurityContext{
+			AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+			Capabilities: &corev1.Capabilities{
+				Drop: []corev1.Capability{"ALL"},
+			},
+		}
+		c.Env = append(c.Env, corev1.EnvVar{Name: "HOME", Value: "/tmp"})
+	}
+
+	for i := range spec.InitContainers {
+		secure(&spec.InitContainers[i])
+	}
+	for i := range spec.Containers {
+		secure(&spec.Containers[i])
+	}
+}
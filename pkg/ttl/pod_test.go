@@ -0,0 +1,179 @@
+package ttl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func writePodSpecFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "pod.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestLoadPodOptions(t *testing.T) {
+	t.Run("valid file", func(t *testing.T) {
+		path := writePodSpecFile(t, `resources:
+  requests:
+    cpu: 100m
+    memory: 64Mi
+nodeSelector:
+  kubernetes.io/os: linux
+tolerations:
+  - key: dedicated
+    operator: Equal
+    value: ops
+    effect: NoSchedule
+affinity:
+  nodeAffinity:
+    requiredDuringSchedulingIgnoredDuringExecution:
+      nodeSelectorTerms:
+        - matchExpressions:
+            - key: pool
+              operator: In
+              values: [system]
+priorityClassName: low
+`)
+
+		opts, err := LoadPodOptions(path)
+		require.NoError(t, err)
+		assert.Equal(t, resource.MustParse("100m"), opts.Resources.Requests[corev1.ResourceCPU])
+		assert.Equal(t, resource.MustParse("64Mi"), opts.Resources.Requests[corev1.ResourceMemory])
+		assert.Equal(t, map[string]string{"kubernetes.io/os": "linux"}, opts.NodeSelector)
+		require.Len(t, opts.Tolerations, 1)
+		assert.Equal(t, "dedicated", opts.Tolerations[0].Key)
+		assert.Equal(t, corev1.TaintEffectNoSchedule, opts.Tolerations[0].Effect)
+		require.NotNil(t, opts.Affinity)
+		require.NotNil(t, opts.Affinity.NodeAffinity)
+		assert.Equal(t, "low", opts.PriorityClassName)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadPodOptions("/nonexistent/pod.yaml")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to read pod spec file")
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		path := writePodSpecFile(t, "containers: []\n")
+
+		_, err := LoadPodOptions(path)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to parse pod spec file")
+	})
+}
+
+func TestParseResourceList(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		list, err := ParseResourceList(nil)
+		require.NoError(t, err)
+		assert.Nil(t, list)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		list, err := ParseResourceList(map[string]string{"cpu": "100m", "memory": "64Mi"})
+		require.NoError(t, err)
+		assert.Equal(t, resource.MustParse("100m"), list[corev1.ResourceCPU])
+		assert.Equal(t, resource.MustParse("64Mi"), list[corev1.ResourceMemory])
+	})
+
+	t.Run("invalid quantity", func(t *testing.T) {
+		_, err := ParseResourceList(map[string]string{"cpu": "lots"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `invalid quantity "lots" for resource cpu`)
+	})
+}
+
+func TestBuildCronJob_PodOptions(t *testing.T) {
+	cj, err := BuildCronJob(CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		Pod: PodOptions{
+			Resources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+			},
+			NodeSelector:      map[string]string{"kubernetes.io/os": "linux"},
+			Tolerations:       []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+			Affinity:          &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{}},
+			PriorityClassName: "low",
+		},
+	})
+	require.NoError(t, err)
+
+	spec := cj.Spec.JobTemplate.Spec.Template.Spec
+	assert.Equal(t, map[string]string{"kubernetes.io/os": "linux"}, spec.NodeSelector)
+	assert.Len(t, spec.Tolerations, 1)
+	assert.NotNil(t, spec.Affinity)
+	assert.Equal(t, "low", spec.PriorityClassName)
+	for _, c := range append(spec.InitContainers, spec.Containers...) {
+		assert.Equal(t, resource.MustParse("128Mi"), c.Resources.Limits[corev1.ResourceMemory], c.Name)
+	}
+}
+
+func TestBuildCronJob_SecurityContext(t *testing.T) {
+	build := func(t *testing.T, security SecurityOptions) corev1.PodSpec {
+		t.Helper()
+
+		cj, err := BuildCronJob(CronJobOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "staging",
+			CronjobNamespace: "ops",
+			Schedule:         "0 12 1 1 *",
+			ServiceAccount:   "default",
+			DeleteNamespace:  true,
+			Security:         security,
+		})
+		require.NoError(t, err)
+
+		return cj.Spec.JobTemplate.Spec.Template.Spec
+	}
+
+	t.Run("restricted defaults", func(t *testing.T) {
+		spec := build(t, SecurityOptions{})
+
+		require.NotNil(t, spec.SecurityContext)
+		assert.True(t, *spec.SecurityContext.RunAsNonRoot)
+		assert.Equal(t, DefaultRunAsUser, *spec.SecurityContext.RunAsUser)
+		assert.Equal(t, DefaultRunAsUser, *spec.SecurityContext.RunAsGroup)
+		assert.Equal(t, corev1.SeccompProfileTypeRuntimeDefault, spec.SecurityContext.SeccompProfile.Type)
+
+		containers := append(spec.InitContainers, spec.Containers...)
+		require.Len(t, containers, 4)
+		for _, c := range containers {
+			require.NotNil(t, c.SecurityContext, c.Name)
+			assert.False(t, *c.SecurityContext.AllowPrivilegeEscalation, c.Name)
+			assert.Equal(t, []corev1.Capability{"ALL"}, c.SecurityContext.Capabilities.Drop, c.Name)
+			assert.Contains(t, c.Env, corev1.EnvVar{Name: "HOME", Value: "/tmp"}, c.Name)
+		}
+	})
+
+	t.Run("custom user and group", func(t *testing.T) {
+		uid, gid := int64(1000), int64(2000)
+		spec := build(t, SecurityOptions{RunAsUser: &uid, RunAsGroup: &gid})
+
+		assert.Equal(t, int64(1000), *spec.SecurityContext.RunAsUser)
+		assert.Equal(t, int64(2000), *spec.SecurityContext.RunAsGroup)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		spec := build(t, SecurityOptions{Disabled: true})
+
+		assert.Nil(t, spec.SecurityContext)
+		for _, c := range append(spec.InitContainers, spec.Containers...) {
+			assert.Nil(t, c.SecurityContext, c.Name)
+			assert.Empty(t, c.Env, c.Name)
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package ttl
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// PostDeleteOptions removes what helm uninstall leaves behind in the
+// release namespace. It runs as init containers after the uninstall is
+// verified and before the namespace is deleted.
+type PostDeleteOptions struct {
+	// DeletePVCs deletes the release's PersistentVolumeClaims, such as
+	// those of StatefulSet volumeClaimTemplates, which helm never deletes.
+	DeletePVCs bool
+	// PVCSelector selects the claims DeletePVCs deletes. It defaults to
+	// app.kubernetes.io/instance=<release>.
+	PVCSelector string
+	// Commands are shell commands run in order in the kubectl image, with
+	// RELEASE_NAME and RELEASE_NAMESPACE set.
+	Commands []string
+}
+
+// Validate checks the post-delete options for commands that cannot run.
+func (p PostDeleteOptions) Validate() error {
+	if p.PVCSelector != "" {
+		if !p.DeletePVCs {
+			return fmt.Errorf("--pvc-selector requires --delete-pvcs")
+		}
+
+		if _, err := labels.Parse(p.PVCSelector); err != nil {
+			return fmt.Errorf("invalid --pvc-selector %q: %w", p.PVCSelector, err)
+		}
+	}
+
+	for i, command := range p.Commands {
+		if strings.TrimSpace(command) == "" {
+			return fmt.Errorf("post-delete command %d is empty", i+1)
+		}
+	}
+
+	return nil
+}
+
+// pvcSelector returns the selector of the claims DeletePVCs deletes.
+func (p PostDeleteOptions) pvcSelector(releaseName string) string {
+	if p.PVCSelector != "" {
+		return p.PVCSelector
+	}
+
+	return "app.kubernetes.io/instance=" + releaseName
+}
+
+// containers returns the init containers running the post-delete options.
+// PVCs are deleted with the helm-ttl-cleanup binary when cleanupImage is
+// set; commands always need the shell of kubectlImage.
+func (p PostDeleteOptions) containers(releaseName, releaseNamespace, kubectlImage, cleanupImage string) []corev1.Container {
+	env := []corev1.EnvVar{
+		{Name: "RELEASE_NAME", Value: releaseName},
+		{Name: "RELEASE_NAMESPACE", Value: releaseNamespace},
+	}
+
+	var containers []corev1.Container
+	if p.DeletePVCs {
+		pvcs := corev1.Container{
+			Name:    "delete-pvcs",
+			Image:   kubectlImage,
+			Command: []string{"kubectl", "delete", "persistentvolumeclaims", "--namespace", releaseNamespace, "--selector", p.pvcSelector(releaseName), "--wait=false"},
+		}
+		if cleanupImage != "" {
+			pvcs.Image = cleanupImage
+			pvcs.Command = []string{cleanupBinary, "delete-pvcs", "--namespace", releaseNamespace, p.pvcSelector(releaseName)}
+		}
+		containers = append(containers, pvcs)
+	}
+
+	for i, command := range p.Commands {
+		containers = append(containers, corev1.Container{
+			Name:    fmt.Sprintf("post-delete-%d", i+1),
+			Image:   kubectlImage,
+			Command: []string{"sh", "-c", command},
+			Env:     env,
+		})
+	}
+
+	return containers
+}
+
+// Rules returns the RBAC rules the post-delete options need in the release
+// namespace: deleting PVCs, and deleting what each `kubectl delete TYPE`
+// command names. Other commands need their permissions granted by hand.
+func (p PostDeleteOptions) Rules() []rbacv1.PolicyRule {
+	var rules []rbacv1.PolicyRule
+	if p.DeletePVCs {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"persistentvolumeclaims"},
+			Verbs:     []string{"list", "delete"},
+		})
+	}
+
+	seen := make(map[apiResource]bool)
+	for _, command := range p.Commands {
+		for _, r := range kubectlDeleteResources(command) {
+			if seen[r] {
+				continue
+			}
+
+			seen[r] = true
+			rules = append(rules, rbacv1.PolicyRule{
+				APIGroups: []string{r.group},
+				Resources: []string{r.resource},
+				Verbs:     []string{"get", "list", "watch", "delete"},
+			})
+		}
+	}
+
+	return rules
+}
+
+// apiResource is a resource as RBAC rules name it.
+type apiResource struct {
+	group    string
+	resource string
+}
+
+// kubectlResourceAliases maps the names kubectl accepts for common
+// leftovers to the resources RBAC rules need.
+var kubectlResourceAliases = map[string]apiResource{
+	"pvc":                    {"", "persistentvolumeclaims"},
+	"persistentvolumeclaim":  {"", "persistentvolumeclaims"},
+	"persistentvolumeclaims": {"", "persistentvolumeclaims"},
+	"cm":                     {"", "configmaps"},
+	"configmap":              {"", "configmaps"},
+	"configmaps":             {"", "configmaps"},
+	"secret":                 {"", "secrets"},
+	"secrets":                {"", "secrets"},
+	"svc":                    {"", "services"},
+	"service":                {"", "services"},
+	"services":               {"", "services"},
+	"sa":                     {"", "serviceaccounts"},
+	"serviceaccount":         {"", "serviceaccounts"},
+	"serviceaccounts":        {"", "serviceaccounts"},
+	"po":                     {"", "pods"},
+	"pod":                    {"", "pods"},
+	"pods":                   {"", "pods"},
+	"job":                    {"batch", "jobs"},
+	"jobs":                   {"batch", "jobs"},
+	"cj":                     {"batch", "cronjobs"},
+	"cronjob":                {"batch", "cronjobs"},
+	"cronjobs":               {"batch", "cronjobs"},
+	"deploy":                 {"apps", "deployments"},
+	"deployment":             {"apps", "deployments"},
+	"deployments":            {"apps", "deployments"},
+	"sts":                    {"apps", "statefulsets"},
+	"statefulset":            {"apps", "statefulsets"},
+	"statefulsets":           {"apps", "statefulsets"},
+	"ing":                    {"networking.k8s.io", "ingresses"},
+	"ingress":                {"networking.k8s.io", "ingresses"},
+	"ingresses":              {"networking.k8s.io", "ingresses"},
+}
+
+// kubectlValueFlags are the kubectl delete flags that take their value as
+// the next argument.
+var kubectlValueFlags = map[string]bool{
+	"-n": true, "--namespace": true,
+	"-l": true, "--selector": true,
+	"--field-selector": true,
+	"--grace-period":   true,
+	"--timeout":        true,
+	"--cascade":        true,
+	"-o":               true, "--output": true,
+	"-f": true, "--filename": true,
+	"-k": true, "--kustomize": true,
+}
+
+// kubectlDeleteResources returns the resources the `kubectl delete
+// TYPE[,TYPE...] ...` calls of a command delete. Types may be aliases from
+// kubectlResourceAliases or plural resources qualified by their API group,
+// such as certificates.cert-manager.io; others are taken as plural core
+// resources.
+func kubectlDeleteResources(command string) []apiResource {
+	var resources []apiResource
+	fields := strings.Fields(command)
+	for i := 0; i+1 < len(fields); i++ {
+		if path.Base(fields[i]) != "kubectl" || fields[i+1] != "delete" {
+			continue
+		}
+
+		for j := i + 2; j < len(fields); j++ {
+			if kubectlValueFlags[fields[j]] {
+				j++
+				continue
+			}
+			if strings.HasPrefix(fields[j], "-") {
+				continue
+			}
+
+			resources = append(resources, parseKubectlTypes(fields[j])...)
+			break
+		}
+	}
+
+	return resources
+}
+
+// parseKubectlTypes parses the TYPE argument of kubectl delete, e.g.
+// pvc,configmap/cache or certificates.cert-manager.io.
+func parseKubectlTypes(arg string) []apiResource {
+	var resources []apiResource
+	for _, t := range strings.Split(strings.ToLower(arg), ",") {
+		t, _, _ = strings.Cut(t, "/")
+		if t == "" {
+			continue
+		}
+
+		if r, ok := kubectlResourceAliases[t]; ok {
+			resources = append(resources, r)
+			continue
+		}
+
+		resource, group, _ := strings.Cut(t, ".")
+		resources = append(resources, apiResource{group: group, resource: resource})
+	}
+
+	return resources
+}
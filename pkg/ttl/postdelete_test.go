@@ -0,0 +1,202 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPostDeleteOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		opts PostDeleteOptions
+		err  string
+	}{
+		{name: "empty", opts: PostDeleteOptions{}},
+		{name: "pvcs", opts: PostDeleteOptions{DeletePVCs: true, PVCSelector: "app=myapp,tier in (db)"}},
+		{name: "commands", opts: PostDeleteOptions{Commands: []string{"kubectl delete secret tls"}}},
+		{name: "selector without pvcs", opts: PostDeleteOptions{PVCSelector: "app=myapp"}, err: "--pvc-selector requires --delete-pvcs"},
+		{name: "invalid selector", opts: PostDeleteOptions{DeletePVCs: true, PVCSelector: "app in (db"}, err: `invalid --pvc-selector "app in (db"`},
+		{name: "blank command", opts: PostDeleteOptions{Commands: []string{"true", "  "}}, err: "post-delete command 2 is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestPostDeleteOptionsContainers(t *testing.T) {
+	opts := PostDeleteOptions{
+		DeletePVCs: true,
+		Commands:   []string{`kubectl delete secret -n "$RELEASE_NAMESPACE" -l app=myapp`, "echo done"},
+	}
+
+	containers := opts.containers("myapp", "staging", "kubectl:1", "")
+	require.Len(t, containers, 3)
+
+	assert.Equal(t, "delete-pvcs", containers[0].Name)
+	assert.Equal(t, "kubectl:1", containers[0].Image)
+	assert.Equal(t, []string{"kubectl", "delete", "persistentvolumeclaims", "--namespace", "staging", "--selector", "app.kubernetes.io/instance=myapp", "--wait=false"}, containers[0].Command)
+
+	assert.Equal(t, "post-delete-1", containers[1].Name)
+	assert.Equal(t, "kubectl:1", containers[1].Image)
+	assert.Equal(t, []string{"sh", "-c", `kubectl delete secret -n "$RELEASE_NAMESPACE" -l app=myapp`}, containers[1].Command)
+	assert.Equal(t, []corev1.EnvVar{{Name: "RELEASE_NAME", Value: "myapp"}, {Name: "RELEASE_NAMESPACE", Value: "staging"}}, containers[1].Env)
+	assert.Equal(t, "post-delete-2", containers[2].Name)
+
+	t.Run("cleanup image deletes PVCs, commands keep kubectl", func(t *testing.T) {
+		opts := PostDeleteOptions{DeletePVCs: true, PVCSelector: "app=myapp", Commands: []string{"echo done"}}
+
+		containers := opts.containers("myapp", "staging", "kubectl:1", "cleanup:1")
+		require.Len(t, containers, 2)
+		assert.Equal(t, "cleanup:1", containers[0].Image)
+		assert.Equal(t, []string{"/helm-ttl-cleanup", "delete-pvcs", "--namespace", "staging", "app=myapp"}, containers[0].Command)
+		assert.Equal(t, "kubectl:1", containers[1].Image)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		assert.Empty(t, PostDeleteOptions{}.containers("myapp", "staging", "kubectl:1", ""))
+	})
+}
+
+func TestPostDeleteOptionsRules(t *testing.T) {
+	opts := PostDeleteOptions{
+		DeletePVCs: true,
+		Commands: []string{
+			`kubectl delete --namespace "$RELEASE_NAMESPACE" secret,cm/cache -l app=myapp`,
+			"kubectl delete certificates.cert-manager.io myapp-tls && /usr/bin/kubectl delete -n staging secrets myapp-tls",
+			"echo done",
+		},
+	}
+
+	verbs := []string{"get", "list", "watch", "delete"}
+	assert.Equal(t, []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"persistentvolumeclaims"}, Verbs: []string{"list", "delete"}},
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: verbs},
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: verbs},
+		{APIGroups: []string{"cert-manager.io"}, Resources: []string{"certificates"}, Verbs: verbs},
+	}, opts.Rules())
+
+	assert.Empty(t, PostDeleteOptions{}.Rules())
+}
+
+func TestKubectlDeleteResources(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []apiResource
+	}{
+		{"kubectl delete pvc data-0", []apiResource{{"", "persistentvolumeclaims"}}},
+		{"kubectl delete deploy/web", []apiResource{{"apps", "deployments"}}},
+		{"kubectl delete -l app=myapp --grace-period 0 Jobs", []apiResource{{"batch", "jobs"}}},
+		{"kubectl delete --wait=false ing,sts,sa,svc,po,cj,secrets", []apiResource{
+			{"networking.k8s.io", "ingresses"}, {"apps", "statefulsets"}, {"", "serviceaccounts"},
+			{"", "services"}, {"", "pods"}, {"batch", "cronjobs"}, {"", "secrets"},
+		}},
+		{"kubectl delete widgets", []apiResource{{"", "widgets"}}},
+		{"kubectl delete -f leftovers.yaml", nil},
+		{"kubectl get pods", nil},
+		{"kubectl delete", nil},
+		{"helm uninstall other", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			assert.Equal(t, tt.want, kubectlDeleteResources(tt.command))
+		})
+	}
+}
+
+func TestBuildCronJob_PostDelete(t *testing.T) {
+	cj, err := BuildCronJob(CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "staging",
+		CronjobNamespace: "ops",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		DeleteNamespace:  true,
+		PostDelete:       PostDeleteOptions{DeletePVCs: true, Commands: []string{"echo done"}},
+	})
+	require.NoError(t, err)
+
+	var names []string
+	for _, c := range cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers {
+		names = append(names, c.Name)
+		assert.NotNil(t, c.SecurityContext, c.Name)
+	}
+	assert.Equal(t, []string{"helm-uninstall", "verify-uninstall", "delete-pvcs", "post-delete-1", "delete-namespace"}, names)
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := BuildCronJob(CronJobOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "staging",
+			CronjobNamespace: "staging",
+			Schedule:         "0 12 1 1 *",
+			PostDelete:       PostDeleteOptions{PVCSelector: "app=myapp"},
+		})
+		assert.EqualError(t, err, "--pvc-selector requires --delete-pvcs")
+	})
+}
+
+func TestSetTTLPostDeleteRBAC(t *testing.T) {
+	ctx := context.Background()
+	postDelete := PostDeleteOptions{DeletePVCs: true, Commands: []string{"kubectl delete secret myapp-tls -n staging"}}
+
+	t.Run("same namespace", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			PostDelete:           postDelete,
+		})
+		require.NoError(t, err)
+
+		role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, postDelete.Rules(), role.Rules[len(role.Rules)-2:])
+	})
+
+	t.Run("cross namespace with sql storage", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "staging")
+		client := fake.NewClientset()
+
+		result, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "staging",
+			CronjobNamespace:     "ops",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			Driver:               "sql",
+			PostDelete:           postDelete,
+		})
+		require.NoError(t, err)
+
+		role, err := client.RbacV1().Roles("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, postDelete.Rules(), role.Rules)
+		assert.Contains(t, result.RBAC, OrphanedResource{Kind: "Role", Name: "myapp-80081014-ttl", Namespace: "staging"})
+
+		_, err = client.RbacV1().RoleBindings("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+	})
+}
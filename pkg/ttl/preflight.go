@@ -0,0 +1,119 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PreflightError is returned when an existing service account lacks
+// permissions the uninstall needs, which would otherwise only show when
+// the TTL fires.
+type PreflightError struct {
+	Name      string
+	Namespace string
+	// Missing lists each missing permission, e.g. "delete secrets in
+	// namespace staging".
+	Missing []string
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("service account %q in namespace %q cannot run the uninstall; it is not allowed to:\n  - %s",
+		e.Name, e.Namespace, strings.Join(e.Missing, "\n  - "))
+}
+
+// checkServiceAccountPermissions runs a SubjectAccessReview for every
+// permission the RBAC of spec would grant, and returns a PreflightError
+// listing those the existing service account lacks. The check is skipped
+// when the caller may not create SubjectAccessReviews.
+func checkServiceAccountPermissions(ctx context.Context, client kubernetes.Interface, spec rbacSpec) error {
+	sa, ns := spec.serviceAccountName, spec.cronjobNamespace
+
+	var missing []string
+	for _, obj := range spec.objects() {
+		var (
+			namespace string
+			rules     []rbacv1.PolicyRule
+		)
+		switch o := obj.(type) {
+		case *rbacv1.Role:
+			namespace, rules = o.Namespace, o.Rules
+		case *rbacv1.ClusterRole:
+			rules = o.Rules
+		default:
+			continue
+		}
+
+		for _, attrs := range resourceAttributes(namespace, rules) {
+			review := &authorizationv1.SubjectAccessReview{
+				Spec: authorizationv1.SubjectAccessReviewSpec{
+					User:               "system:serviceaccount:" + ns + ":" + sa,
+					Groups:             []string{"system:serviceaccounts", "system:serviceaccounts:" + ns, "system:authenticated"},
+					ResourceAttributes: &attrs,
+				},
+			}
+
+			result, err := client.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+			if errors.IsForbidden(err) {
+				logger.Debug("cannot create SubjectAccessReviews, skipping the permission check", "serviceAccount", sa, "namespace", ns, "error", err)
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to check the permissions of service account %q: %w", sa, err)
+			}
+
+			if !result.Status.Allowed {
+				missing = append(missing, describeAttributes(attrs))
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return &PreflightError{Name: sa, Namespace: ns, Missing: slices.Compact(missing)}
+	}
+
+	return nil
+}
+
+// resourceAttributes expands rules into one set of attributes per verb,
+// group and resource, scoped to namespace (cluster-wide when empty).
+func resourceAttributes(namespace string, rules []rbacv1.PolicyRule) []authorizationv1.ResourceAttributes {
+	var attrs []authorizationv1.ResourceAttributes
+	for _, rule := range rules {
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				for _, verb := range rule.Verbs {
+					attrs = append(attrs, authorizationv1.ResourceAttributes{
+						Namespace: namespace,
+						Verb:      verb,
+						Group:     group,
+						Resource:  resource,
+					})
+				}
+			}
+		}
+	}
+
+	return attrs
+}
+
+// describeAttributes describes a permission for a PreflightError.
+func describeAttributes(attrs authorizationv1.ResourceAttributes) string {
+	resource := attrs.Resource
+	if attrs.Group != "" {
+		resource += "." + attrs.Group
+	}
+
+	if attrs.Namespace == "" {
+		return fmt.Sprintf("%s %s (cluster-scoped)", attrs.Verb, resource)
+	}
+
+	return fmt.Sprintf("%s %s in namespace %s", attrs.Verb, resource, attrs.Namespace)
+}
@@ -0,0 +1,151 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// allowAccessReviews makes client allow every SubjectAccessReview, which
+// the fake clientset cannot create otherwise.
+func allowAccessReviews(client *fake.Clientset) *fake.Clientset {
+	return reviewAccess(client, func(authorizationv1.ResourceAttributes) bool { return true })
+}
+
+// reviewAccess makes client answer SubjectAccessReviews with allowed.
+func reviewAccess(client *fake.Clientset, allowed func(authorizationv1.ResourceAttributes) bool) *fake.Clientset {
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = allowed(*review.Spec.ResourceAttributes)
+		return true, review, nil
+	})
+
+	return client
+}
+
+func TestCheckServiceAccountPermissions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("allowed", func(t *testing.T) {
+		client := allowAccessReviews(fake.NewClientset())
+		spec := releaseRBAC("myapp-80081014-ttl", "myapp", "staging", "ops", "cleaner", true, "secrets")
+
+		require.NoError(t, checkServiceAccountPermissions(ctx, client, spec))
+
+		var reviews []authorizationv1.SubjectAccessReviewSpec
+		for _, a := range client.Actions() {
+			reviews = append(reviews, a.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview).Spec)
+		}
+		require.Len(t, reviews, 7)
+		assert.Equal(t, "system:serviceaccount:ops:cleaner", reviews[0].User)
+		assert.Contains(t, reviews[0].Groups, "system:serviceaccounts:ops")
+		assert.Equal(t, authorizationv1.ResourceAttributes{Namespace: "staging", Verb: "get", Resource: "secrets"}, *reviews[0].ResourceAttributes)
+		assert.Equal(t, authorizationv1.ResourceAttributes{Verb: "delete", Resource: "namespaces"}, *reviews[6].ResourceAttributes)
+	})
+
+	t.Run("missing permissions", func(t *testing.T) {
+		client := reviewAccess(fake.NewClientset(), func(attrs authorizationv1.ResourceAttributes) bool {
+			return attrs.Verb != "delete"
+		})
+		spec := releaseRBAC("myapp-80081014-ttl", "myapp", "staging", "ops", "cleaner", true, "configmaps")
+
+		err := checkServiceAccountPermissions(ctx, client, spec)
+
+		var preflight *PreflightError
+		require.ErrorAs(t, err, &preflight)
+		assert.Equal(t, "cleaner", preflight.Name)
+		assert.Equal(t, "ops", preflight.Namespace)
+		assert.Equal(t, []string{
+			"delete configmaps in namespace staging",
+			"delete cronjobs.batch in namespace ops",
+			"delete namespaces (cluster-scoped)",
+		}, preflight.Missing)
+		assert.Equal(t, `service account "cleaner" in namespace "ops" cannot run the uninstall; it is not allowed to:
+  - delete configmaps in namespace staging
+  - delete cronjobs.batch in namespace ops
+  - delete namespaces (cluster-scoped)`, err.Error())
+	})
+
+	t.Run("skipped when reviews are forbidden", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("create", "subjectaccessreviews", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewForbidden(schema.GroupResource{Group: "authorization.k8s.io", Resource: "subjectaccessreviews"}, "", nil)
+		})
+
+		assert.NoError(t, checkServiceAccountPermissions(ctx, client, releaseRBAC("myapp-4a0c226a-ttl", "myapp", "default", "default", "cleaner", false, "secrets")))
+	})
+
+	t.Run("review error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("create", "subjectaccessreviews", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewServiceUnavailable("authorizer down")
+		})
+
+		err := checkServiceAccountPermissions(ctx, client, releaseRBAC("myapp-4a0c226a-ttl", "myapp", "default", "default", "cleaner", false, "secrets"))
+		assert.ErrorContains(t, err, `failed to check the permissions of service account "cleaner"`)
+	})
+}
+
+func TestSetTTLPreflight(t *testing.T) {
+	ctx := context.Background()
+	opts := SetTTLOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Duration:         "2d",
+		ServiceAccount:   "cleaner",
+		PostDelete:       PostDeleteOptions{DeletePVCs: true},
+	}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "cleaner", Namespace: "default"}}
+
+	t.Run("fails before creating the CronJob", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := reviewAccess(fake.NewClientset(sa), func(attrs authorizationv1.ResourceAttributes) bool {
+			return attrs.Resource != "persistentvolumeclaims"
+		})
+
+		_, err := SetTTL(ctx, cfg, client, opts)
+
+		var preflight *PreflightError
+		require.ErrorAs(t, err, &preflight)
+		assert.Equal(t, []string{
+			"list persistentvolumeclaims in namespace default",
+			"delete persistentvolumeclaims in namespace default",
+		}, preflight.Missing)
+
+		cronJobs, err := client.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, cronJobs.Items)
+	})
+
+	t.Run("skipped", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset(sa)
+
+		skipped := opts
+		skipped.SkipPreflight = true
+		_, err := SetTTL(ctx, cfg, client, skipped)
+		require.NoError(t, err)
+	})
+
+	t.Run("not run for a created service account", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		created := opts
+		created.ServiceAccount = "default"
+		created.CreateServiceAccount = true
+		_, err := SetTTL(ctx, cfg, client, created)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,67 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// LabelProtected marks a release or namespace whose TTL must not be set
+// or run unless forced. It is read from release labels (helm install
+// --labels), chart annotations, and namespace labels and annotations.
+const LabelProtected = "helm-ttl/protected"
+
+// ProtectedError is returned when a TTL operation targets a protected
+// release or namespace.
+type ProtectedError struct {
+	// Kind is "release" or "namespace".
+	Kind string
+	Name string
+}
+
+func (e *ProtectedError) Error() string {
+	return fmt.Sprintf("%s %q is protected by %s=true; pass --force to override", e.Kind, e.Name, LabelProtected)
+}
+
+// CheckProtected returns a ProtectedError when the release or its
+// namespace is marked protected. rel may be nil when the release is not
+// installed. A namespace the caller is not allowed to read is treated as
+// unprotected.
+func CheckProtected(ctx context.Context, client kubernetes.Interface, rel *release.Release, releaseNamespace string) error {
+	if rel != nil {
+		protected := rel.Labels[LabelProtected] == "true"
+		if rel.Chart != nil && rel.Chart.Metadata != nil {
+			protected = protected || rel.Chart.Metadata.Annotations[LabelProtected] == "true"
+		}
+
+		if protected {
+			return &ProtectedError{Kind: "release", Name: rel.Name}
+		}
+	}
+
+	ns, err := client.CoreV1().Namespaces().Get(ctx, releaseNamespace, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) || errors.IsForbidden(err) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to get namespace %s: %w", releaseNamespace, err)
+	}
+
+	if IsProtected(ns) {
+		return &ProtectedError{Kind: "namespace", Name: releaseNamespace}
+	}
+
+	return nil
+}
+
+// IsProtected reports whether an object carries helm-ttl/protected=true
+// as a label or annotation.
+func IsProtected(obj metav1.Object) bool {
+	return obj.GetLabels()[LabelProtected] == "true" || obj.GetAnnotations()[LabelProtected] == "true"
+}
@@ -0,0 +1,115 @@
+package ttl
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestCheckProtected(t *testing.T) {
+	ctx := context.Background()
+
+	namespace := func(labels, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod", Labels: labels, Annotations: annotations}}
+	}
+	protected := map[string]string{LabelProtected: "true"}
+
+	t.Run("unprotected", func(t *testing.T) {
+		rel := &release.Release{Name: "myapp", Labels: map[string]string{LabelProtected: "false"}}
+		assert.NoError(t, CheckProtected(ctx, fake.NewClientset(namespace(nil, nil)), rel, "prod"))
+	})
+
+	t.Run("release label", func(t *testing.T) {
+		rel := &release.Release{Name: "myapp", Labels: protected}
+
+		err := CheckProtected(ctx, fake.NewClientset(), rel, "prod")
+		var protectedErr *ProtectedError
+		require.True(t, errors.As(err, &protectedErr))
+		assert.Equal(t, "release", protectedErr.Kind)
+		assert.Equal(t, `release "myapp" is protected by helm-ttl/protected=true; pass --force to override`, err.Error())
+	})
+
+	t.Run("chart annotation", func(t *testing.T) {
+		rel := &release.Release{Name: "myapp", Chart: &chart.Chart{Metadata: &chart.Metadata{Annotations: protected}}}
+		assert.Error(t, CheckProtected(ctx, fake.NewClientset(), rel, "prod"))
+	})
+
+	t.Run("namespace label", func(t *testing.T) {
+		err := CheckProtected(ctx, fake.NewClientset(namespace(protected, nil)), nil, "prod")
+		assert.Equal(t, `namespace "prod" is protected by helm-ttl/protected=true; pass --force to override`, err.Error())
+	})
+
+	t.Run("namespace annotation", func(t *testing.T) {
+		rel := &release.Release{Name: "myapp", Chart: &chart.Chart{Metadata: &chart.Metadata{}}}
+		assert.Error(t, CheckProtected(ctx, fake.NewClientset(namespace(nil, protected)), rel, "prod"))
+	})
+
+	t.Run("namespace not readable", func(t *testing.T) {
+		client := fake.NewClientset(namespace(protected, nil))
+		client.PrependReactor("get", "namespaces", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "prod", errors.New("denied"))
+		})
+
+		assert.NoError(t, CheckProtected(ctx, client, nil, "prod"))
+	})
+
+	t.Run("namespace API error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "namespaces", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("connection refused")
+		})
+
+		err := CheckProtected(ctx, client, nil, "prod")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to get namespace prod")
+	})
+}
+
+func TestSetTTL_Protected(t *testing.T) {
+	ctx := context.Background()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{LabelProtected: "true"}}}
+
+	opts := SetTTLOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Duration:         "24h",
+		ServiceAccount:   "default",
+	}
+
+	t.Run("refused", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset(ns)
+
+		_, err := SetTTL(ctx, cfg, client, opts)
+		var protectedErr *ProtectedError
+		assert.True(t, errors.As(err, &protectedErr))
+
+		cronJobs, err := client.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, cronJobs.Items)
+	})
+
+	t.Run("forced", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := allowAccessReviews(fake.NewClientset(ns, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}}))
+
+		forced := opts
+		forced.Force = true
+		_, err := SetTTL(ctx, cfg, client, forced)
+		require.NoError(t, err)
+	})
+}
@@ -3,19 +3,28 @@ package ttl
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	rbacv1ac "k8s.io/client-go/applyconfigurations/rbac/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
 // OrphanedResource describes a resource that is orphaned and can be cleaned up.
 type OrphanedResource struct {
-	Kind      string
-	Name      string
-	Namespace string
+	Kind      string `json:"kind" yaml:"kind"`
+	Name      string `json:"name" yaml:"name"`
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
 }
 
 func (o OrphanedResource) String() string {
@@ -26,92 +35,211 @@ func (o OrphanedResource) String() string {
 	return fmt.Sprintf("%s %s (cluster-scoped)", o.Kind, o.Name)
 }
 
-func resourceLabels(releaseName, releaseNamespace string) map[string]string {
-	return map[string]string{
-		LabelManagedBy:        LabelManagedByValue,
-		LabelRelease:          releaseName,
-		LabelReleaseNamespace: releaseNamespace,
-	}
-}
-
 // CreateServiceAccountAndRBAC creates the ServiceAccount and RBAC resources needed
-// by the CronJob to uninstall a Helm release.
+// by the CronJob to uninstall a Helm release stored in Secrets.
 func CreateServiceAccountAndRBAC(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace, cronjobNamespace, serviceAccountName string, deleteNamespace bool) error {
-	if deleteNamespace && releaseNamespace == cronjobNamespace {
-		return fmt.Errorf("cannot use --delete-namespace when CronJob namespace equals release namespace")
+	return CreateServiceAccountAndRBACForDriver(ctx, client, releaseName, releaseNamespace, cronjobNamespace, serviceAccountName, deleteNamespace, "secrets")
+}
+
+// CreateServiceAccountAndRBACForDriver is CreateServiceAccountAndRBAC for a
+// release stored with the given Helm storage driver. The uninstall is
+// granted access to ConfigMaps for the configmaps driver, and to no
+// release storage at all for sql, which keeps releases in a database.
+func CreateServiceAccountAndRBACForDriver(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace, cronjobNamespace, serviceAccountName string, deleteNamespace bool, driver string) error {
+	spec := releaseRBAC(ResourceName(releaseName, releaseNamespace), releaseName, releaseNamespace, cronjobNamespace, serviceAccountName, deleteNamespace, driver)
+	return createServiceAccountAndRBAC(ctx, client, spec, nil)
+}
+
+// rbacSpec describes the ServiceAccount and RBAC resources of a TTL
+// CronJob, which are all named after it except the ServiceAccount.
+type rbacSpec struct {
+	name               string
+	serviceAccountName string
+	releaseNamespace   string
+	cronjobNamespace   string
+	deleteNamespace    bool
+	driver             string
+	// releaseRules are granted in the release namespace on top of the
+	// access to the release storage.
+	releaseRules []rbacv1.PolicyRule
+	// cronjobRules are granted in the CronJob namespace on top of the
+	// access to the CronJob itself.
+	cronjobRules []rbacv1.PolicyRule
+	// namespaceRules are granted in other namespaces, by namespace.
+	namespaceRules      map[string][]rbacv1.PolicyRule
+	labels, annotations map[string]string
+	// userAnnotations are added to the ServiceAccount only.
+	userAnnotations map[string]string
+}
+
+// releaseRBAC returns the rbacSpec of a release TTL's CronJob named name.
+func releaseRBAC(name, releaseName, releaseNamespace, cronjobNamespace, serviceAccountName string, deleteNamespace bool, driver string) rbacSpec {
+	return rbacSpec{
+		name:               name,
+		serviceAccountName: serviceAccountName,
+		releaseNamespace:   releaseNamespace,
+		cronjobNamespace:   cronjobNamespace,
+		deleteNamespace:    deleteNamespace,
+		driver:             driver,
+		labels:             releaseLabels(releaseName, releaseNamespace),
+		annotations:        releaseAnnotations(releaseName, releaseNamespace),
 	}
+}
 
-	name, err := ResourceName(releaseName, releaseNamespace)
-	if err != nil {
+// createServiceAccountAndRBAC creates or updates the resources of spec,
+// tracked by Argo CD when tracking is not nil.
+func createServiceAccountAndRBAC(ctx context.Context, client kubernetes.Interface, spec rbacSpec, tracking *argoCDTracking) error {
+	if _, err := StorageResource(spec.driver); err != nil {
 		return err
 	}
 
-	labels := resourceLabels(releaseName, releaseNamespace)
-
-	// Create ServiceAccount in the CronJob namespace
-	sa := &corev1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      serviceAccountName,
-			Namespace: cronjobNamespace,
-			Labels:    labels,
-		},
+	if spec.deleteNamespace && spec.releaseNamespace == spec.cronjobNamespace {
+		return fmt.Errorf("cannot use --delete-namespace when CronJob namespace equals release namespace")
 	}
 
-	if err := createOrUpdateServiceAccount(ctx, client, sa); err != nil {
-		return fmt.Errorf("failed to create service account: %w", err)
+	objs := spec.objects()
+	tracking.apply(objs...)
+
+	return createRBACObjects(ctx, client, objs, spec.releaseNamespace, spec.cronjobNamespace)
+}
+
+// objects returns the ServiceAccount and RBAC resources of spec, in the
+// order they are created.
+func (s rbacSpec) objects() []runtime.Object {
+	storage, _ := StorageResource(s.driver)
+	name, saName, labels, annotations := s.name, s.serviceAccountName, s.labels, s.annotations
+
+	objs := []runtime.Object{serviceAccount(saName, s.cronjobNamespace, labels, s.serviceAccountAnnotations())}
+	if s.releaseNamespace == s.cronjobNamespace {
+		role, binding := sameNamespaceRBAC(name, saName, s.releaseNamespace, storage, labels, annotations)
+		role.Rules = append(role.Rules, s.releaseRules...)
+		role.Rules = append(role.Rules, s.cronjobRules...)
+		objs = append(objs, role, binding)
+	} else {
+		if storage != "" || len(s.releaseRules) > 0 {
+			role, binding := releaseNamespaceRBAC(name, saName, s.releaseNamespace, s.cronjobNamespace, storage, labels, annotations)
+			role.Rules = append(role.Rules, s.releaseRules...)
+			objs = append(objs, role, binding)
+		}
+		role, binding := cronjobNamespaceRBAC(name, saName, s.cronjobNamespace, labels, annotations)
+		role.Rules = append(role.Rules, s.cronjobRules...)
+		objs = append(objs, role, binding)
 	}
 
-	if releaseNamespace == cronjobNamespace {
-		return createSameNamespaceRBAC(ctx, client, name, serviceAccountName, releaseNamespace, labels)
+	for _, ns := range slices.Sorted(maps.Keys(s.namespaceRules)) {
+		role, binding := extraNamespaceRBAC(name, saName, ns, s.cronjobNamespace, s.namespaceRules[ns], labels, annotations)
+		objs = append(objs, role, binding)
 	}
 
-	if err := createCrossNamespaceRBAC(ctx, client, name, serviceAccountName, releaseNamespace, cronjobNamespace, labels); err != nil {
-		return err
+	if s.deleteNamespace && s.releaseNamespace != s.cronjobNamespace {
+		clusterRole, clusterBinding := deleteNamespaceRBAC(name, saName, s.cronjobNamespace, labels, annotations)
+		objs = append(objs, clusterRole, clusterBinding)
 	}
 
-	if deleteNamespace {
-		return createDeleteNamespaceRBAC(ctx, client, name, serviceAccountName, cronjobNamespace, labels)
+	return objs
+}
+
+// createRBACObjects server-side applies the resources rbacSpec.objects
+// returns, in order.
+func createRBACObjects(ctx context.Context, client kubernetes.Interface, objs []runtime.Object, releaseNamespace, cronjobNamespace string) error {
+	for _, obj := range objs {
+		// Roles of cross-namespace TTLs are told apart by namespace
+		var where string
+		switch ns := obj.(metav1.Object).GetNamespace(); {
+		case ns != releaseNamespace && ns != cronjobNamespace:
+			where = " in namespace " + ns
+		case releaseNamespace == cronjobNamespace:
+		case ns == releaseNamespace:
+			where = " in release namespace"
+		default:
+			where = " in CronJob namespace"
+		}
+
+		switch o := obj.(type) {
+		case *corev1.ServiceAccount:
+			if _, err := apply[*corev1.ServiceAccount](ctx, client.CoreV1().ServiceAccounts(o.Namespace), o, corev1ac.ServiceAccount(o.Name, o.Namespace)); err != nil {
+				return fmt.Errorf("failed to create service account: %w", err)
+			}
+		case *rbacv1.Role:
+			if _, err := apply[*rbacv1.Role](ctx, client.RbacV1().Roles(o.Namespace), o, rbacv1ac.Role(o.Name, o.Namespace)); err != nil {
+				return fmt.Errorf("failed to create role%s: %w", where, err)
+			}
+		case *rbacv1.RoleBinding:
+			if _, err := apply[*rbacv1.RoleBinding](ctx, client.RbacV1().RoleBindings(o.Namespace), o, rbacv1ac.RoleBinding(o.Name, o.Namespace)); err != nil {
+				return fmt.Errorf("failed to create role binding%s: %w", where, err)
+			}
+		case *rbacv1.ClusterRole:
+			if _, err := apply[*rbacv1.ClusterRole](ctx, client.RbacV1().ClusterRoles(), o, rbacv1ac.ClusterRole(o.Name)); err != nil {
+				return fmt.Errorf("failed to create cluster role: %w", err)
+			}
+		case *rbacv1.ClusterRoleBinding:
+			if _, err := apply[*rbacv1.ClusterRoleBinding](ctx, client.RbacV1().ClusterRoleBindings(), o, rbacv1ac.ClusterRoleBinding(o.Name)); err != nil {
+				return fmt.Errorf("failed to create cluster role binding: %w", err)
+			}
+		}
 	}
 
 	return nil
 }
 
-func createSameNamespaceRBAC(ctx context.Context, client kubernetes.Interface, name, serviceAccountName, namespace string, labels map[string]string) error {
-	role := &rbacv1.Role{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
-			Labels:    labels,
-		},
-		Rules: []rbacv1.PolicyRule{
-			{
-				APIGroups: []string{""},
-				Resources: []string{"secrets"},
-				Verbs:     []string{"get", "list", "delete"},
-			},
-			{
-				APIGroups: []string{"batch"},
-				Resources: []string{"cronjobs"},
-				Verbs:     []string{"get", "delete"},
-			},
-		},
+// resources lists the ServiceAccount and RBAC resources of spec.
+func (s rbacSpec) resources() []OrphanedResource {
+	objs := s.objects()
+	resources := make([]OrphanedResource, 0, len(objs))
+	for _, obj := range objs {
+		meta := obj.(metav1.Object)
+		resources = append(resources, OrphanedResource{Kind: objectKind(obj), Name: meta.GetName(), Namespace: meta.GetNamespace()})
 	}
 
-	if err := createOrUpdateRole(ctx, client, role); err != nil {
-		return fmt.Errorf("failed to create role: %w", err)
+	return resources
+}
+
+// objectKind returns the kind of a resource helm-ttl creates.
+func objectKind(obj runtime.Object) string {
+	switch obj.(type) {
+	case *corev1.ServiceAccount:
+		return "ServiceAccount"
+	case *rbacv1.Role:
+		return "Role"
+	case *rbacv1.RoleBinding:
+		return "RoleBinding"
+	case *rbacv1.ClusterRole:
+		return "ClusterRole"
+	case *rbacv1.ClusterRoleBinding:
+		return "ClusterRoleBinding"
+	case *batchv1.CronJob:
+		return "CronJob"
+	default:
+		return ""
 	}
+}
 
-	binding := &rbacv1.RoleBinding{
+// serviceAccount returns the ServiceAccount a TTL CronJob runs as.
+func serviceAccount(name, namespace string, labels, annotations map[string]string) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
-			Labels:    labels,
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+	}
+}
+
+// roleBinding binds the Role name in namespace to a service account.
+func roleBinding(name, namespace, serviceAccountName, serviceAccountNamespace string, labels, annotations map[string]string) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: annotations,
 		},
 		Subjects: []rbacv1.Subject{
 			{
 				Kind:      "ServiceAccount",
 				Name:      serviceAccountName,
-				Namespace: namespace,
+				Namespace: serviceAccountNamespace,
 			},
 		},
 		RoleRef: rbacv1.RoleRef{
@@ -120,66 +248,113 @@ func createSameNamespaceRBAC(ctx context.Context, client kubernetes.Interface, n
 			Name:     name,
 		},
 	}
+}
 
-	if err := createOrUpdateRoleBinding(ctx, client, binding); err != nil {
-		return fmt.Errorf("failed to create role binding: %w", err)
+// storageRules returns the rules letting helm read and delete a release's
+// storage records, or none when they are kept outside the cluster.
+func storageRules(storage string) []rbacv1.PolicyRule {
+	if storage == "" {
+		return nil
 	}
 
-	return nil
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{storage},
+			Verbs:     []string{"get", "list", "delete"},
+		},
+	}
 }
 
-func createCrossNamespaceRBAC(ctx context.Context, client kubernetes.Interface, name, serviceAccountName, releaseNamespace, cronjobNamespace string, labels map[string]string) error {
-	// Role in release namespace for secrets access
-	releaseRole := &rbacv1.Role{
+// sameNamespaceRBAC returns the Role and RoleBinding of a TTL whose
+// CronJob lives in the release namespace.
+func sameNamespaceRBAC(name, serviceAccountName, namespace, storage string, labels, annotations map[string]string) (*rbacv1.Role, *rbacv1.RoleBinding) {
+	role := &rbacv1.Role{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: releaseNamespace,
-			Labels:    labels,
-		},
-		Rules: []rbacv1.PolicyRule{
-			{
-				APIGroups: []string{""},
-				Resources: []string{"secrets"},
-				Verbs:     []string{"get", "list", "delete"},
-			},
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: annotations,
 		},
+		Rules: append(storageRules(storage), rbacv1.PolicyRule{
+			APIGroups: []string{"batch"},
+			Resources: []string{"cronjobs"},
+			Verbs:     []string{"get", "delete"},
+		}),
 	}
 
-	if err := createOrUpdateRole(ctx, client, releaseRole); err != nil {
-		return fmt.Errorf("failed to create role in release namespace: %w", err)
+	return role, roleBinding(name, namespace, serviceAccountName, namespace, labels, annotations)
+}
+
+// setRBACOwner makes a same-namespace TTL CronJob the owner of the
+// ServiceAccount, Role and RoleBinding created for it, so Kubernetes
+// garbage-collects them once the CronJob is deleted. Owner references
+// cannot cross namespaces, so cross-namespace TTLs still rely on
+// CleanupRBAC and cleanup-rbac.
+func setRBACOwner(ctx context.Context, client kubernetes.Interface, cj *batchv1.CronJob, serviceAccountName string) error {
+	gvk := BackendOf(client).GroupVersionKind()
+	owner := metav1.OwnerReference{
+		APIVersion: gvk.GroupVersion().String(),
+		Kind:       gvk.Kind,
+		Name:       cj.Name,
+		UID:        cj.UID,
+	}
+
+	sa, err := client.CoreV1().ServiceAccounts(cj.Namespace).Get(ctx, serviceAccountName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get service account: %w", err)
+	}
+	setOwner(&sa.ObjectMeta, owner)
+	if _, err := client.CoreV1().ServiceAccounts(cj.Namespace).Update(ctx, sa, metav1.UpdateOptions{FieldManager: ownerFieldManager}); err != nil {
+		return fmt.Errorf("failed to set owner of service account: %w", err)
 	}
 
-	// RoleBinding in release namespace
-	releaseBinding := &rbacv1.RoleBinding{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: releaseNamespace,
-			Labels:    labels,
-		},
-		Subjects: []rbacv1.Subject{
-			{
-				Kind:      "ServiceAccount",
-				Name:      serviceAccountName,
-				Namespace: cronjobNamespace,
-			},
-		},
-		RoleRef: rbacv1.RoleRef{
-			APIGroup: "rbac.authorization.k8s.io",
-			Kind:     "Role",
-			Name:     name,
-		},
+	role, err := client.RbacV1().Roles(cj.Namespace).Get(ctx, cj.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get role: %w", err)
 	}
+	setOwner(&role.ObjectMeta, owner)
+	if _, err := client.RbacV1().Roles(cj.Namespace).Update(ctx, role, metav1.UpdateOptions{FieldManager: ownerFieldManager}); err != nil {
+		return fmt.Errorf("failed to set owner of role: %w", err)
+	}
+
+	binding, err := client.RbacV1().RoleBindings(cj.Namespace).Get(ctx, cj.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get role binding: %w", err)
+	}
+	setOwner(&binding.ObjectMeta, owner)
+	if _, err := client.RbacV1().RoleBindings(cj.Namespace).Update(ctx, binding, metav1.UpdateOptions{FieldManager: ownerFieldManager}); err != nil {
+		return fmt.Errorf("failed to set owner of role binding: %w", err)
+	}
+
+	return nil
+}
 
-	if err := createOrUpdateRoleBinding(ctx, client, releaseBinding); err != nil {
-		return fmt.Errorf("failed to create role binding in release namespace: %w", err)
+// ownerFieldManager writes the owner references setRBACOwner adds. It is
+// not FieldManager, whose applies would otherwise remove them again.
+const ownerFieldManager = "helm-ttl-owner"
+
+// setOwner adds owner to obj, replacing any reference to an earlier
+// CronJob of the same name.
+func setOwner(obj *metav1.ObjectMeta, owner metav1.OwnerReference) {
+	refs := []metav1.OwnerReference{owner}
+	for _, ref := range obj.OwnerReferences {
+		if ref.Kind != owner.Kind || ref.Name != owner.Name {
+			refs = append(refs, ref)
+		}
 	}
+	obj.OwnerReferences = refs
+}
 
-	// Role in CronJob namespace for self-cleanup
-	cronjobRole := &rbacv1.Role{
+// cronjobNamespaceRBAC returns the Role and RoleBinding letting a
+// cross-namespace TTL CronJob delete itself.
+func cronjobNamespaceRBAC(name, serviceAccountName, cronjobNamespace string, labels, annotations map[string]string) (*rbacv1.Role, *rbacv1.RoleBinding) {
+	role := &rbacv1.Role{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: cronjobNamespace,
-			Labels:    labels,
+			Name:        name,
+			Namespace:   cronjobNamespace,
+			Labels:      labels,
+			Annotations: annotations,
 		},
 		Rules: []rbacv1.PolicyRule{
 			{
@@ -190,43 +365,33 @@ func createCrossNamespaceRBAC(ctx context.Context, client kubernetes.Interface,
 		},
 	}
 
-	if err := createOrUpdateRole(ctx, client, cronjobRole); err != nil {
-		return fmt.Errorf("failed to create role in CronJob namespace: %w", err)
-	}
+	return role, roleBinding(name, cronjobNamespace, serviceAccountName, cronjobNamespace, labels, annotations)
+}
 
-	// RoleBinding in CronJob namespace
-	cronjobBinding := &rbacv1.RoleBinding{
+// releaseNamespaceRBAC returns the Role and RoleBinding giving a
+// cross-namespace TTL CronJob access to the release storage.
+func releaseNamespaceRBAC(name, serviceAccountName, releaseNamespace, cronjobNamespace, storage string, labels, annotations map[string]string) (*rbacv1.Role, *rbacv1.RoleBinding) {
+	role := &rbacv1.Role{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: cronjobNamespace,
-			Labels:    labels,
+			Name:        name,
+			Namespace:   releaseNamespace,
+			Labels:      labels,
+			Annotations: annotations,
 		},
-		Subjects: []rbacv1.Subject{
-			{
-				Kind:      "ServiceAccount",
-				Name:      serviceAccountName,
-				Namespace: cronjobNamespace,
-			},
-		},
-		RoleRef: rbacv1.RoleRef{
-			APIGroup: "rbac.authorization.k8s.io",
-			Kind:     "Role",
-			Name:     name,
-		},
-	}
-
-	if err := createOrUpdateRoleBinding(ctx, client, cronjobBinding); err != nil {
-		return fmt.Errorf("failed to create role binding in CronJob namespace: %w", err)
+		Rules: storageRules(storage),
 	}
 
-	return nil
+	return role, roleBinding(name, releaseNamespace, serviceAccountName, cronjobNamespace, labels, annotations)
 }
 
-func createDeleteNamespaceRBAC(ctx context.Context, client kubernetes.Interface, name, serviceAccountName, cronjobNamespace string, labels map[string]string) error {
+// deleteNamespaceRBAC returns the ClusterRole and ClusterRoleBinding
+// letting a TTL CronJob delete the namespace it empties.
+func deleteNamespaceRBAC(name, serviceAccountName, cronjobNamespace string, labels, annotations map[string]string) (*rbacv1.ClusterRole, *rbacv1.ClusterRoleBinding) {
 	clusterRole := &rbacv1.ClusterRole{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   name,
-			Labels: labels,
+			Name:        name,
+			Labels:      labels,
+			Annotations: annotations,
 		},
 		Rules: []rbacv1.PolicyRule{
 			{
@@ -237,14 +402,11 @@ func createDeleteNamespaceRBAC(ctx context.Context, client kubernetes.Interface,
 		},
 	}
 
-	if err := createOrUpdateClusterRole(ctx, client, clusterRole); err != nil {
-		return fmt.Errorf("failed to create cluster role: %w", err)
-	}
-
 	clusterBinding := &rbacv1.ClusterRoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   name,
-			Labels: labels,
+			Name:        name,
+			Labels:      labels,
+			Annotations: annotations,
 		},
 		Subjects: []rbacv1.Subject{
 			{
@@ -260,22 +422,19 @@ func createDeleteNamespaceRBAC(ctx context.Context, client kubernetes.Interface,
 		},
 	}
 
-	if err := createOrUpdateClusterRoleBinding(ctx, client, clusterBinding); err != nil {
-		return fmt.Errorf("failed to create cluster role binding: %w", err)
-	}
-
-	return nil
+	return clusterRole, clusterBinding
 }
 
 // CleanupRBAC deletes all RBAC resources created for a specific release TTL.
 func CleanupRBAC(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace, cronjobNamespace string) error {
-	name, err := ResourceName(releaseName, releaseNamespace)
-	if err != nil {
-		return err
-	}
+	return cleanupRBAC(ctx, client, ResourceName(releaseName, releaseNamespace), releaseNamespace, cronjobNamespace)
+}
 
+// cleanupRBAC deletes the RBAC resources named name, the name of a TTL's
+// CronJob, including those in the extra namespaces it was granted.
+func cleanupRBAC(ctx context.Context, client kubernetes.Interface, name, releaseNamespace, cronjobNamespace string, extraNamespaces ...string) error {
 	// Delete ClusterRoleBinding (may not exist)
-	err = client.RbacV1().ClusterRoleBindings().Delete(ctx, name, metav1.DeleteOptions{})
+	err := client.RbacV1().ClusterRoleBindings().Delete(ctx, name, metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
 		return fmt.Errorf("failed to delete cluster role binding: %w", err)
 	}
@@ -298,6 +457,12 @@ func CleanupRBAC(ctx context.Context, client kubernetes.Interface, releaseName,
 		}
 	}
 
+	for _, ns := range extraNamespaces {
+		if err := deleteNamespacedRBAC(ctx, client, name, ns); err != nil {
+			return err
+		}
+	}
+
 	// Delete ServiceAccount in CronJob namespace
 	err = client.CoreV1().ServiceAccounts(cronjobNamespace).Delete(ctx, name, metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
@@ -307,6 +472,59 @@ func CleanupRBAC(ctx context.Context, client kubernetes.Interface, releaseName,
 	return nil
 }
 
+// existingRBAC returns the RBAC resources CleanupRBAC would delete for a
+// release TTL, skipping those that do not exist.
+func existingRBAC(ctx context.Context, client kubernetes.Interface, name, releaseNamespace, cronjobNamespace string, extraNamespaces ...string) ([]OrphanedResource, error) {
+	var found []OrphanedResource
+	check := func(kind, namespace string, err error) error {
+		if err == nil {
+			found = append(found, OrphanedResource{Kind: kind, Name: name, Namespace: namespace})
+			return nil
+		}
+
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to get %s %s: %w", kind, name, err)
+	}
+
+	_, err := client.RbacV1().ClusterRoleBindings().Get(ctx, name, metav1.GetOptions{})
+	if err := check("ClusterRoleBinding", "", err); err != nil {
+		return nil, err
+	}
+
+	_, err = client.RbacV1().ClusterRoles().Get(ctx, name, metav1.GetOptions{})
+	if err := check("ClusterRole", "", err); err != nil {
+		return nil, err
+	}
+
+	namespaces := []string{releaseNamespace}
+	if cronjobNamespace != releaseNamespace {
+		namespaces = append(namespaces, cronjobNamespace)
+	}
+	namespaces = append(namespaces, extraNamespaces...)
+
+	for _, ns := range namespaces {
+		_, err = client.RbacV1().RoleBindings(ns).Get(ctx, name, metav1.GetOptions{})
+		if err := check("RoleBinding", ns, err); err != nil {
+			return nil, err
+		}
+
+		_, err = client.RbacV1().Roles(ns).Get(ctx, name, metav1.GetOptions{})
+		if err := check("Role", ns, err); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = client.CoreV1().ServiceAccounts(cronjobNamespace).Get(ctx, name, metav1.GetOptions{})
+	if err := check("ServiceAccount", cronjobNamespace, err); err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
 func deleteNamespacedRBAC(ctx context.Context, client kubernetes.Interface, name, namespace string) error {
 	err := client.RbacV1().RoleBindings(namespace).Delete(ctx, name, metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
@@ -321,218 +539,360 @@ func deleteNamespacedRBAC(ctx context.Context, client kubernetes.Interface, name
 	return nil
 }
 
+// DefaultCleanupConcurrency is how many namespaces CleanupOrphaned sweeps
+// at once.
+const DefaultCleanupConcurrency = 8
+
+// CleanupOrphanedOptions selects the resources CleanupOrphaned sweeps.
+type CleanupOrphanedOptions struct {
+	Namespaces    []string
+	AllNamespaces bool
+	DryRun        bool
+	// Selector is a label selector that further limits the sweep, e.g.
+	// helm-ttl/release=myapp. Empty matches every helm-ttl resource.
+	Selector string
+	// Concurrency is how many namespaces are swept at once; it defaults
+	// to DefaultCleanupConcurrency.
+	Concurrency int
+	// OlderThan, when positive, leaves alone resources created less than
+	// this long ago, which may belong to a TTL still being set up.
+	OlderThan time.Duration
+}
+
+// orphanSweep holds what the sweeps of GarbageCollect share.
+type orphanSweep struct {
+	client   kubernetes.Interface
+	selector string
+	// cutoff, when set, is the time resources must have been created
+	// before to be swept.
+	cutoff time.Time
+	// stale holds the keys of sweep.stale once the CronJobs are swept.
+	stale  map[string]bool
+	dryRun bool
+}
+
+// sweep is what GarbageCollect found in one namespace or among the
+// cluster-scoped resources. It stops at the first error.
+type sweep struct {
+	orphaned []OrphanedResource
+	// stale are the namespace/name keys of the CronJobs whose release or
+	// namespace is gone, as returned by OwningCronJob.
+	stale []string
+	err   error
+}
+
 // CleanupOrphaned finds and optionally deletes orphaned RBAC resources whose
-// CronJobs no longer exist.
-func CleanupOrphaned(ctx context.Context, client kubernetes.Interface, namespaces []string, allNamespaces bool, dryRun bool) ([]OrphanedResource, error) {
-	labelSelector := fmt.Sprintf("%s=%s", LabelManagedBy, LabelManagedByValue)
-	var orphaned []OrphanedResource
-
-	if allNamespaces {
-		nsList, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
-		if err != nil {
-			return nil, fmt.Errorf("failed to list namespaces: %w", err)
+// CronJobs no longer exist, and TTL CronJobs whose release or namespace is
+// already gone, e.g. after a manual helm uninstall, which would otherwise fire against
+// nothing and leave failed Jobs behind. The RBAC of such a CronJob counts
+// as orphaned too.
+//
+// Namespaces are swept opts.Concurrency at a time. A namespace that fails
+// does not stop the others: what was found is returned with the errors of
+// every failed namespace joined.
+func CleanupOrphaned(ctx context.Context, client kubernetes.Interface, opts CleanupOrphanedOptions) ([]OrphanedResource, error) {
+	result, err := GarbageCollect(ctx, client, GCOptions{
+		CleanupOrphanedOptions: opts,
+		Categories:             []string{GCStaleCronJobs, GCOrphanedRBAC},
+	})
+	if result == nil {
+		return nil, err
+	}
+
+	return result.Resources(), err
+}
+
+// sweepNamespaces calls fn for each namespace, concurrency at a time, and
+// returns the sweeps in the order of namespaces.
+func sweepNamespaces(namespaces []string, concurrency int, fn func(ns string) sweep) []sweep {
+	sweeps := make([]sweep, len(namespaces))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, ns := range namespaces {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			sweeps[i] = fn(ns)
+		})
+	}
+	wg.Wait()
+
+	return sweeps
+}
+
+// recent reports whether obj was created after the cutoff.
+func (o *orphanSweep) recent(obj metav1.Object) bool {
+	return !o.cutoff.IsZero() && obj.GetCreationTimestamp().After(o.cutoff)
+}
+
+// orphaned reports whether obj is old enough to sweep and its CronJob is
+// gone or stale.
+func (o *orphanSweep) orphaned(ctx context.Context, obj metav1.Object) bool {
+	return !o.recent(obj) && isOrphaned(ctx, o.client, obj, o.stale)
+}
+
+// cronJobs finds, and unless dryRun deletes, the TTL CronJobs in ns that
+// match and whose Job is not running. CronJobs already swept are skipped.
+func (o *orphanSweep) cronJobs(ctx context.Context, ns string, match func(cj *batchv1.CronJob) bool) (s sweep) {
+	client := o.client
+	cronJobs, err := client.BatchV1().CronJobs(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: o.selector,
+	})
+	if err != nil {
+		s.err = fmt.Errorf("failed to list CronJobs in %s: %w", ns, err)
+		return s
+	}
+
+	for _, cj := range cronJobs.Items {
+		ns, name := OwningCronJob(&cj)
+		if o.recent(&cj) || o.stale[ns+"/"+name] {
+			continue
 		}
 
-		namespaces = make([]string, 0, len(nsList.Items))
-		for _, ns := range nsList.Items {
-			namespaces = append(namespaces, ns.Name)
+		if match(&cj) && !ttlRunning(ctx, client, &cj) {
+			s.stale = append(s.stale, ns+"/"+name)
+			s.orphaned = append(s.orphaned, OrphanedResource{Kind: "CronJob", Name: cj.Name, Namespace: ns})
+			if !o.dryRun {
+				if err := client.BatchV1().CronJobs(ns).Delete(ctx, cj.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+					s.err = fmt.Errorf("failed to delete CronJob %s in %s: %w", cj.Name, ns, err)
+					return s
+				}
+			}
 		}
 	}
 
-	// Check cluster-scoped resources first
+	return s
+}
+
+// clusterRBAC finds, and unless dryRun deletes, the orphaned
+// ClusterRoleBindings and ClusterRoles.
+func (o *orphanSweep) clusterRBAC(ctx context.Context) (s sweep) {
+	client := o.client
 	clusterBindings, err := client.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector,
+		LabelSelector: o.selector,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list cluster role bindings: %w", err)
+		s.err = fmt.Errorf("failed to list cluster role bindings: %w", err)
+		return s
 	}
 
 	for _, crb := range clusterBindings.Items {
-		if isOrphaned(ctx, client, crb.Labels) {
-			orphaned = append(orphaned, OrphanedResource{Kind: "ClusterRoleBinding", Name: crb.Name})
-			if !dryRun {
+		if o.orphaned(ctx, &crb) {
+			s.orphaned = append(s.orphaned, OrphanedResource{Kind: "ClusterRoleBinding", Name: crb.Name})
+			if !o.dryRun {
 				if err := client.RbacV1().ClusterRoleBindings().Delete(ctx, crb.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
-					return orphaned, fmt.Errorf("failed to delete cluster role binding %s: %w", crb.Name, err)
+					s.err = fmt.Errorf("failed to delete cluster role binding %s: %w", crb.Name, err)
+					return s
 				}
 			}
 		}
 	}
 
 	clusterRoles, err := client.RbacV1().ClusterRoles().List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector,
+		LabelSelector: o.selector,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list cluster roles: %w", err)
+		s.err = fmt.Errorf("failed to list cluster roles: %w", err)
+		return s
 	}
 
 	for _, cr := range clusterRoles.Items {
-		if isOrphaned(ctx, client, cr.Labels) {
-			orphaned = append(orphaned, OrphanedResource{Kind: "ClusterRole", Name: cr.Name})
-			if !dryRun {
+		if o.orphaned(ctx, &cr) {
+			s.orphaned = append(s.orphaned, OrphanedResource{Kind: "ClusterRole", Name: cr.Name})
+			if !o.dryRun {
 				if err := client.RbacV1().ClusterRoles().Delete(ctx, cr.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
-					return orphaned, fmt.Errorf("failed to delete cluster role %s: %w", cr.Name, err)
+					s.err = fmt.Errorf("failed to delete cluster role %s: %w", cr.Name, err)
+					return s
 				}
 			}
 		}
 	}
 
-	// Check namespaced resources
-	for _, ns := range namespaces {
-		bindings, err := client.RbacV1().RoleBindings(ns).List(ctx, metav1.ListOptions{
-			LabelSelector: labelSelector,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to list role bindings in %s: %w", ns, err)
-		}
+	return s
+}
 
-		for _, rb := range bindings.Items {
-			if isOrphaned(ctx, client, rb.Labels) {
-				orphaned = append(orphaned, OrphanedResource{Kind: "RoleBinding", Name: rb.Name, Namespace: ns})
-				if !dryRun {
-					if err := client.RbacV1().RoleBindings(ns).Delete(ctx, rb.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
-						return orphaned, fmt.Errorf("failed to delete role binding %s in %s: %w", rb.Name, ns, err)
-					}
+// namespacedRBAC finds, and unless dryRun deletes, the orphaned
+// RoleBindings, Roles and ServiceAccounts in ns.
+func (o *orphanSweep) namespacedRBAC(ctx context.Context, ns string) (s sweep) {
+	client := o.client
+	bindings, err := client.RbacV1().RoleBindings(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: o.selector,
+	})
+	if err != nil {
+		s.err = fmt.Errorf("failed to list role bindings in %s: %w", ns, err)
+		return s
+	}
+
+	for _, rb := range bindings.Items {
+		if o.orphaned(ctx, &rb) {
+			s.orphaned = append(s.orphaned, OrphanedResource{Kind: "RoleBinding", Name: rb.Name, Namespace: ns})
+			if !o.dryRun {
+				if err := client.RbacV1().RoleBindings(ns).Delete(ctx, rb.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+					s.err = fmt.Errorf("failed to delete role binding %s in %s: %w", rb.Name, ns, err)
+					return s
 				}
 			}
 		}
+	}
 
-		roles, err := client.RbacV1().Roles(ns).List(ctx, metav1.ListOptions{
-			LabelSelector: labelSelector,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to list roles in %s: %w", ns, err)
-		}
+	roles, err := client.RbacV1().Roles(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: o.selector,
+	})
+	if err != nil {
+		s.err = fmt.Errorf("failed to list roles in %s: %w", ns, err)
+		return s
+	}
 
-		for _, role := range roles.Items {
-			if isOrphaned(ctx, client, role.Labels) {
-				orphaned = append(orphaned, OrphanedResource{Kind: "Role", Name: role.Name, Namespace: ns})
-				if !dryRun {
-					if err := client.RbacV1().Roles(ns).Delete(ctx, role.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
-						return orphaned, fmt.Errorf("failed to delete role %s in %s: %w", role.Name, ns, err)
-					}
+	for _, role := range roles.Items {
+		if o.orphaned(ctx, &role) {
+			s.orphaned = append(s.orphaned, OrphanedResource{Kind: "Role", Name: role.Name, Namespace: ns})
+			if !o.dryRun {
+				if err := client.RbacV1().Roles(ns).Delete(ctx, role.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+					s.err = fmt.Errorf("failed to delete role %s in %s: %w", role.Name, ns, err)
+					return s
 				}
 			}
 		}
+	}
 
-		sas, err := client.CoreV1().ServiceAccounts(ns).List(ctx, metav1.ListOptions{
-			LabelSelector: labelSelector,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to list service accounts in %s: %w", ns, err)
-		}
+	sas, err := client.CoreV1().ServiceAccounts(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: o.selector,
+	})
+	if err != nil {
+		s.err = fmt.Errorf("failed to list service accounts in %s: %w", ns, err)
+		return s
+	}
 
-		for _, sa := range sas.Items {
-			if isOrphaned(ctx, client, sa.Labels) {
-				orphaned = append(orphaned, OrphanedResource{Kind: "ServiceAccount", Name: sa.Name, Namespace: ns})
-				if !dryRun {
-					if err := client.CoreV1().ServiceAccounts(ns).Delete(ctx, sa.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
-						return orphaned, fmt.Errorf("failed to delete service account %s in %s: %w", sa.Name, ns, err)
-					}
+	for _, sa := range sas.Items {
+		if o.orphaned(ctx, &sa) {
+			s.orphaned = append(s.orphaned, OrphanedResource{Kind: "ServiceAccount", Name: sa.Name, Namespace: ns})
+			if !o.dryRun {
+				if err := client.CoreV1().ServiceAccounts(ns).Delete(ctx, sa.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+					s.err = fmt.Errorf("failed to delete service account %s in %s: %w", sa.Name, ns, err)
+					return s
 				}
 			}
 		}
 	}
 
-	return orphaned, nil
+	return s
 }
 
-// isOrphaned checks if the CronJob for a release still exists.
-func isOrphaned(ctx context.Context, client kubernetes.Interface, labels map[string]string) bool {
-	releaseName := labels[LabelRelease]
-	releaseNs := labels[LabelReleaseNamespace]
-	cronjobNs := labels[LabelCronjobNamespace]
-	if cronjobNs == "" {
-		cronjobNs = releaseNs
+// isOrphaned checks if the CronJob for a release still exists and is not
+// among the stale CronJobs being cleaned up. Resources of a TTL whose Job
+// is still running, e.g. after the CronJob fired, are not orphaned.
+func isOrphaned(ctx context.Context, client kubernetes.Interface, obj metav1.Object, stale map[string]bool) bool {
+	cronjobNs, name := OwningCronJob(obj)
+	if !stale[cronjobNs+"/"+name] {
+		var err error
+		if IsNamespaceTTL(obj) {
+			_, err = client.BatchV1().CronJobs(cronjobNs).Get(ctx, name, metav1.GetOptions{})
+		} else {
+			_, err = findCronJob(ctx, client, OriginalLabelValue(obj, LabelRelease), OriginalLabelValue(obj, LabelReleaseNamespace), cronjobNs)
+		}
+		if !errors.IsNotFound(err) {
+			return false
+		}
 	}
 
-	name, err := ResourceName(releaseName, releaseNs)
+	return !ttlRunning(ctx, client, obj)
+}
+
+// ttlRunning reports whether a Job or pod of the TTL of a helm-ttl
+// resource is still running in its CronJob namespace, such as one midway
+// through the uninstall, which still needs its RBAC. Jobs and pods that
+// cannot be listed count as running. The selector of sanitized label
+// values may also match the runs of another TTL, which only keeps the
+// resources until those finish.
+func ttlRunning(ctx context.Context, client kubernetes.Interface, obj metav1.Object) bool {
+	selector := ttlJobSelector(OriginalLabelValue(obj, LabelRelease), OriginalLabelValue(obj, LabelReleaseNamespace))
+	if IsNamespaceTTL(obj) {
+		selector = labels.SelectorFromSet(identityLabels(namespaceLabels(OriginalLabelValue(obj, LabelNamespace)))).String()
+	}
+	namespace := owningCronJobNamespace(obj)
+	opts := metav1.ListOptions{LabelSelector: selector}
+
+	jobs, err := client.BatchV1().Jobs(namespace).List(ctx, opts)
 	if err != nil {
-		return false
+		return true
 	}
 
-	_, err = client.BatchV1().CronJobs(cronjobNs).Get(ctx, name, metav1.GetOptions{})
-	return errors.IsNotFound(err)
-}
+	for _, job := range jobs.Items {
+		if !jobFinished(&job) {
+			return true
+		}
+	}
 
-// createOrUpdate helpers that are idempotent
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, opts)
+	if err != nil {
+		return true
+	}
 
-func createOrUpdateServiceAccount(ctx context.Context, client kubernetes.Interface, sa *corev1.ServiceAccount) error {
-	_, err := client.CoreV1().ServiceAccounts(sa.Namespace).Create(ctx, sa, metav1.CreateOptions{})
-	if errors.IsAlreadyExists(err) {
-		existing, getErr := client.CoreV1().ServiceAccounts(sa.Namespace).Get(ctx, sa.Name, metav1.GetOptions{})
-		if getErr != nil {
-			return getErr
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			return true
 		}
-
-		existing.Labels = sa.Labels
-		_, err = client.CoreV1().ServiceAccounts(sa.Namespace).Update(ctx, existing, metav1.UpdateOptions{})
 	}
 
-	return err
+	return false
 }
 
-func createOrUpdateRole(ctx context.Context, client kubernetes.Interface, role *rbacv1.Role) error {
-	_, err := client.RbacV1().Roles(role.Namespace).Create(ctx, role, metav1.CreateOptions{})
-	if errors.IsAlreadyExists(err) {
-		existing, getErr := client.RbacV1().Roles(role.Namespace).Get(ctx, role.Name, metav1.GetOptions{})
-		if getErr != nil {
-			return getErr
+// jobFinished reports whether job completed or failed.
+func jobFinished(job *batchv1.Job) bool {
+	for _, cond := range job.Status.Conditions {
+		if (cond.Type == batchv1.JobComplete || cond.Type == batchv1.JobFailed) && cond.Status == corev1.ConditionTrue {
+			return true
 		}
-
-		existing.Labels = role.Labels
-		existing.Rules = role.Rules
-		_, err = client.RbacV1().Roles(role.Namespace).Update(ctx, existing, metav1.UpdateOptions{})
 	}
 
-	return err
+	return false
 }
 
-func createOrUpdateRoleBinding(ctx context.Context, client kubernetes.Interface, binding *rbacv1.RoleBinding) error {
-	_, err := client.RbacV1().RoleBindings(binding.Namespace).Create(ctx, binding, metav1.CreateOptions{})
-	if errors.IsAlreadyExists(err) {
-		existing, getErr := client.RbacV1().RoleBindings(binding.Namespace).Get(ctx, binding.Name, metav1.GetOptions{})
-		if getErr != nil {
-			return getErr
-		}
+// releaseGone reports whether the release a TTL CronJob uninstalls has no
+// storage records left outside the uninstalled state. Releases kept in sql
+// and storage that cannot be listed are never reported gone.
+func releaseGone(ctx context.Context, client kubernetes.Interface, cj *batchv1.CronJob) bool {
+	storage, err := StorageResource(cronJobDriver(cj))
+	if err != nil || storage == "" {
+		return false
+	}
 
-		existing.Labels = binding.Labels
-		existing.Subjects = binding.Subjects
-		existing.RoleRef = binding.RoleRef
-		_, err = client.RbacV1().RoleBindings(binding.Namespace).Update(ctx, existing, metav1.UpdateOptions{})
+	release := OriginalLabelValue(cj, LabelRelease)
+	releaseNs := OriginalLabelValue(cj, LabelReleaseNamespace)
+	if release == "" || releaseNs == "" {
+		return false
 	}
 
-	return err
-}
+	opts := metav1.ListOptions{LabelSelector: ReleaseStorageSelector(release, true)}
+	if storage == "configmaps" {
+		cms, err := client.CoreV1().ConfigMaps(releaseNs).List(ctx, opts)
+		return err == nil && len(cms.Items) == 0
+	}
 
-func createOrUpdateClusterRole(ctx context.Context, client kubernetes.Interface, role *rbacv1.ClusterRole) error {
-	_, err := client.RbacV1().ClusterRoles().Create(ctx, role, metav1.CreateOptions{})
-	if errors.IsAlreadyExists(err) {
-		existing, getErr := client.RbacV1().ClusterRoles().Get(ctx, role.Name, metav1.GetOptions{})
-		if getErr != nil {
-			return getErr
-		}
+	secrets, err := client.CoreV1().Secrets(releaseNs).List(ctx, opts)
+	return err == nil && len(secrets.Items) == 0
+}
 
-		existing.Labels = role.Labels
-		existing.Rules = role.Rules
-		_, err = client.RbacV1().ClusterRoles().Update(ctx, existing, metav1.UpdateOptions{})
+// OwningCronJob returns the namespace and ResourceName (or
+// NamespaceResourceName) of the CronJob a helm-ttl resource was created
+// for, from its labels. A CronJob named before names were hashed has a
+// different name, but OwningCronJob of the CronJob itself still matches
+// that of its RBAC.
+func OwningCronJob(obj metav1.Object) (namespace, name string) {
+	if IsNamespaceTTL(obj) {
+		return owningCronJobNamespace(obj), NamespaceResourceName(OriginalLabelValue(obj, LabelNamespace))
 	}
 
-	return err
+	return owningCronJobNamespace(obj), ResourceName(OriginalLabelValue(obj, LabelRelease), OriginalLabelValue(obj, LabelReleaseNamespace))
 }
 
-func createOrUpdateClusterRoleBinding(ctx context.Context, client kubernetes.Interface, binding *rbacv1.ClusterRoleBinding) error {
-	_, err := client.RbacV1().ClusterRoleBindings().Create(ctx, binding, metav1.CreateOptions{})
-	if errors.IsAlreadyExists(err) {
-		existing, getErr := client.RbacV1().ClusterRoleBindings().Get(ctx, binding.Name, metav1.GetOptions{})
-		if getErr != nil {
-			return getErr
-		}
-
-		existing.Labels = binding.Labels
-		existing.Subjects = binding.Subjects
-		existing.RoleRef = binding.RoleRef
-		_, err = client.RbacV1().ClusterRoleBindings().Update(ctx, existing, metav1.UpdateOptions{})
+// owningCronJobNamespace returns the namespace of the CronJob a helm-ttl
+// resource was created for.
+func owningCronJobNamespace(obj metav1.Object) string {
+	if ns := OriginalLabelValue(obj, LabelCronjobNamespace); ns != "" {
+		return ns
 	}
 
-	return err
+	return OriginalLabelValue(obj, LabelReleaseNamespace)
 }
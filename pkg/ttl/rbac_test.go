@@ -3,13 +3,16 @@ package ttl
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
@@ -20,26 +23,26 @@ func TestCreateServiceAccountAndRBAC_SameNamespace(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false)
 	require.NoError(t, err)
 
 	// Verify SA created
-	sa, err := client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+	sa, err := client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 	assert.Equal(t, LabelManagedByValue, sa.Labels[LabelManagedBy])
 	assert.Equal(t, "myapp", sa.Labels[LabelRelease])
 
 	// Verify Role
-	role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+	role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 	assert.Len(t, role.Rules, 2)
 	assert.Equal(t, []string{"secrets"}, role.Rules[0].Resources)
 	assert.Equal(t, []string{"cronjobs"}, role.Rules[1].Resources)
 
 	// Verify RoleBinding
-	binding, err := client.RbacV1().RoleBindings("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+	binding, err := client.RbacV1().RoleBindings("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
-	assert.Equal(t, "myapp-default-ttl", binding.Subjects[0].Name)
+	assert.Equal(t, "myapp-4a0c226a-ttl", binding.Subjects[0].Name)
 	assert.Equal(t, "default", binding.Subjects[0].Namespace)
 }
 
@@ -47,38 +50,38 @@ func TestCreateServiceAccountAndRBAC_CrossNamespace(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", false)
 	require.NoError(t, err)
 
 	// SA in CronJob namespace
-	sa, err := client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	sa, err := client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 	assert.Equal(t, LabelManagedByValue, sa.Labels[LabelManagedBy])
 
 	// Role in release namespace (secrets)
-	releaseRole, err := client.RbacV1().Roles("staging").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	releaseRole, err := client.RbacV1().Roles("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 	assert.Len(t, releaseRole.Rules, 1)
 	assert.Equal(t, []string{"secrets"}, releaseRole.Rules[0].Resources)
 
 	// Role in CronJob namespace (cronjobs)
-	cronjobRole, err := client.RbacV1().Roles("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	cronjobRole, err := client.RbacV1().Roles("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 	assert.Len(t, cronjobRole.Rules, 1)
 	assert.Equal(t, []string{"cronjobs"}, cronjobRole.Rules[0].Resources)
 
 	// RoleBinding in release namespace
-	releaseBinding, err := client.RbacV1().RoleBindings("staging").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	releaseBinding, err := client.RbacV1().RoleBindings("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 	assert.Equal(t, "ops", releaseBinding.Subjects[0].Namespace)
 
 	// RoleBinding in CronJob namespace
-	cronjobBinding, err := client.RbacV1().RoleBindings("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	cronjobBinding, err := client.RbacV1().RoleBindings("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 	assert.Equal(t, "ops", cronjobBinding.Subjects[0].Namespace)
 
 	// No ClusterRole or ClusterRoleBinding
-	_, err = client.RbacV1().ClusterRoles().Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().ClusterRoles().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	assert.Error(t, err)
 }
 
@@ -86,36 +89,193 @@ func TestCreateServiceAccountAndRBAC_CrossNamespaceWithDeleteNamespace(t *testin
 	ctx := context.Background()
 	client := fake.NewClientset()
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", true)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true)
 	require.NoError(t, err)
 
 	// All cross-namespace resources
-	_, err = client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 
-	_, err = client.RbacV1().Roles("staging").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().Roles("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 
-	_, err = client.RbacV1().Roles("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().Roles("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 
 	// Plus ClusterRole and ClusterRoleBinding
-	cr, err := client.RbacV1().ClusterRoles().Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	cr, err := client.RbacV1().ClusterRoles().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 	assert.Equal(t, []string{"namespaces"}, cr.Rules[0].Resources)
 	assert.Equal(t, []string{"get", "delete"}, cr.Rules[0].Verbs)
 
-	crb, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	crb, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
-	assert.Equal(t, "myapp-staging-ttl", crb.Subjects[0].Name)
+	assert.Equal(t, "myapp-80081014-ttl", crb.Subjects[0].Name)
 	assert.Equal(t, "ops", crb.Subjects[0].Namespace)
 }
 
+func TestCreateServiceAccountAndRBACForDriver(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("configmaps same namespace", func(t *testing.T) {
+		client := fake.NewClientset()
+		require.NoError(t, CreateServiceAccountAndRBACForDriver(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false, "configmap"))
+
+		role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Len(t, role.Rules, 2)
+		assert.Equal(t, []string{"configmaps"}, role.Rules[0].Resources)
+		assert.Equal(t, []string{"cronjobs"}, role.Rules[1].Resources)
+	})
+
+	t.Run("configmaps cross namespace", func(t *testing.T) {
+		client := fake.NewClientset()
+		require.NoError(t, CreateServiceAccountAndRBACForDriver(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", false, "configmaps"))
+
+		role, err := client.RbacV1().Roles("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Len(t, role.Rules, 1)
+		assert.Equal(t, []string{"configmaps"}, role.Rules[0].Resources)
+	})
+
+	t.Run("sql same namespace", func(t *testing.T) {
+		client := fake.NewClientset()
+		require.NoError(t, CreateServiceAccountAndRBACForDriver(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false, "sql"))
+
+		role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Len(t, role.Rules, 1)
+		assert.Equal(t, []string{"cronjobs"}, role.Rules[0].Resources)
+	})
+
+	t.Run("sql cross namespace", func(t *testing.T) {
+		client := fake.NewClientset()
+		require.NoError(t, CreateServiceAccountAndRBACForDriver(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true, "sql"))
+
+		_, err := client.RbacV1().Roles("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+		_, err = client.RbacV1().RoleBindings("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+
+		_, err = client.RbacV1().Roles("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		_, err = client.RbacV1().ClusterRoleBindings().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+	})
+
+	t.Run("unsupported driver", func(t *testing.T) {
+		client := fake.NewClientset()
+		err := CreateServiceAccountAndRBACForDriver(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false, "memory")
+		assert.EqualError(t, err, `unsupported Helm storage driver "memory" for a TTL: use secrets, configmaps or sql`)
+		assert.Empty(t, client.Actions())
+	})
+}
+
+func TestRBACResources(t *testing.T) {
+	t.Run("same namespace", func(t *testing.T) {
+		assert.Equal(t, []OrphanedResource{
+			{Kind: "ServiceAccount", Name: "my-sa", Namespace: "default"},
+			{Kind: "Role", Name: "myapp-4a0c226a-ttl", Namespace: "default"},
+			{Kind: "RoleBinding", Name: "myapp-4a0c226a-ttl", Namespace: "default"},
+		}, releaseRBAC("myapp-4a0c226a-ttl", "myapp", "default", "default", "my-sa", false, "").resources())
+	})
+
+	t.Run("cross namespace with sql storage", func(t *testing.T) {
+		assert.Equal(t, []OrphanedResource{
+			{Kind: "ServiceAccount", Name: "myapp-80081014-ttl", Namespace: "ops"},
+			{Kind: "Role", Name: "myapp-80081014-ttl", Namespace: "ops"},
+			{Kind: "RoleBinding", Name: "myapp-80081014-ttl", Namespace: "ops"},
+		}, releaseRBAC("myapp-80081014-ttl", "myapp", "staging", "ops", "myapp-80081014-ttl", false, "sql").resources())
+	})
+
+	t.Run("matches what is created", func(t *testing.T) {
+		client := fake.NewClientset()
+		spec := releaseRBAC("myapp-80081014-ttl", "myapp", "staging", "ops", "myapp-80081014-ttl", true, "")
+		require.NoError(t, createServiceAccountAndRBAC(context.Background(), client, spec, nil))
+
+		ctx := context.Background()
+		for _, r := range spec.resources() {
+			var err error
+			switch r.Kind {
+			case "ServiceAccount":
+				_, err = client.CoreV1().ServiceAccounts(r.Namespace).Get(ctx, r.Name, metav1.GetOptions{})
+			case "Role":
+				_, err = client.RbacV1().Roles(r.Namespace).Get(ctx, r.Name, metav1.GetOptions{})
+			case "RoleBinding":
+				_, err = client.RbacV1().RoleBindings(r.Namespace).Get(ctx, r.Name, metav1.GetOptions{})
+			case "ClusterRole":
+				_, err = client.RbacV1().ClusterRoles().Get(ctx, r.Name, metav1.GetOptions{})
+			case "ClusterRoleBinding":
+				_, err = client.RbacV1().ClusterRoleBindings().Get(ctx, r.Name, metav1.GetOptions{})
+			}
+			assert.NoError(t, err, r.String())
+		}
+	})
+}
+
+func TestSetRBACOwner(t *testing.T) {
+	ctx := context.Background()
+	cj := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", UID: "uid-2"}}
+	want := metav1.OwnerReference{APIVersion: "batch/v1", Kind: "CronJob", Name: "myapp-4a0c226a-ttl", UID: "uid-2"}
+
+	t.Run("owns service account, role and binding", func(t *testing.T) {
+		client := fake.NewClientset()
+		require.NoError(t, CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false))
+
+		// A reference to an earlier CronJob of the same name is replaced
+		sa, err := client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		sa.OwnerReferences = []metav1.OwnerReference{
+			{APIVersion: "batch/v1", Kind: "CronJob", Name: "myapp-4a0c226a-ttl", UID: "uid-1"},
+			{APIVersion: "v1", Kind: "ConfigMap", Name: "keep", UID: "uid-3"},
+		}
+		_, err = client.CoreV1().ServiceAccounts("default").Update(ctx, sa, metav1.UpdateOptions{})
+		require.NoError(t, err)
+
+		require.NoError(t, setRBACOwner(ctx, client, cj, "myapp-4a0c226a-ttl"))
+
+		sa, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []metav1.OwnerReference{want, {APIVersion: "v1", Kind: "ConfigMap", Name: "keep", UID: "uid-3"}}, sa.OwnerReferences)
+
+		role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []metav1.OwnerReference{want}, role.OwnerReferences)
+
+		binding, err := client.RbacV1().RoleBindings("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []metav1.OwnerReference{want}, binding.OwnerReferences)
+	})
+
+	tests := map[string]struct {
+		verb, resource, want string
+	}{
+		"get service account":    {"get", "serviceaccounts", "failed to get service account"},
+		"update service account": {"update", "serviceaccounts", "failed to set owner of service account"},
+		"get role":               {"get", "roles", "failed to get role"},
+		"update role":            {"update", "roles", "failed to set owner of role"},
+		"get role binding":       {"get", "rolebindings", "failed to get role binding"},
+		"update role binding":    {"update", "rolebindings", "failed to set owner of role binding"},
+	}
+	for name, tt := range tests {
+		t.Run(name+" error", func(t *testing.T) {
+			client := fake.NewClientset()
+			require.NoError(t, CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false))
+			client.PrependReactor(tt.verb, tt.resource, func(_ k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, fmt.Errorf("forbidden")
+			})
+
+			err := setRBACOwner(ctx, client, cj, "myapp-4a0c226a-ttl")
+			assert.ErrorContains(t, err, tt.want+": forbidden")
+		})
+	}
+}
+
 func TestCreateServiceAccountAndRBAC_RejectsDeleteNamespaceSameNs(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", true)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", true)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "cannot use --delete-namespace")
 }
@@ -125,10 +285,10 @@ func TestCreateServiceAccountAndRBAC_Idempotent(t *testing.T) {
 	client := fake.NewClientset()
 
 	// Create twice, should not error
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false)
 	require.NoError(t, err)
 
-	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", false)
+	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false)
 	require.NoError(t, err)
 }
 
@@ -139,7 +299,7 @@ func TestCleanupRBAC(t *testing.T) {
 		client := fake.NewClientset()
 
 		// Create resources first
-		err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", false)
+		err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false)
 		require.NoError(t, err)
 
 		// Clean up
@@ -147,13 +307,13 @@ func TestCleanupRBAC(t *testing.T) {
 		require.NoError(t, err)
 
 		// Verify all gone
-		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 		assert.Error(t, err)
 
-		_, err = client.RbacV1().Roles("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		_, err = client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 		assert.Error(t, err)
 
-		_, err = client.RbacV1().RoleBindings("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		_, err = client.RbacV1().RoleBindings("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 		assert.Error(t, err)
 	})
 
@@ -161,7 +321,7 @@ func TestCleanupRBAC(t *testing.T) {
 		client := fake.NewClientset()
 
 		// Create all resources
-		err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", true)
+		err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true)
 		require.NoError(t, err)
 
 		// Clean up
@@ -169,13 +329,13 @@ func TestCleanupRBAC(t *testing.T) {
 		require.NoError(t, err)
 
 		// Verify all gone
-		_, err = client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+		_, err = client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 		assert.Error(t, err)
 
-		_, err = client.RbacV1().ClusterRoles().Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+		_, err = client.RbacV1().ClusterRoles().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 		assert.Error(t, err)
 
-		_, err = client.RbacV1().ClusterRoleBindings().Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+		_, err = client.RbacV1().ClusterRoleBindings().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 		assert.Error(t, err)
 	})
 
@@ -203,28 +363,28 @@ func TestCleanupOrphaned(t *testing.T) {
 		}
 
 		_, err := client.CoreV1().ServiceAccounts("default").Create(ctx, &corev1.ServiceAccount{
-			ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
 		}, metav1.CreateOptions{})
 		require.NoError(t, err)
 
 		_, err = client.RbacV1().Roles("default").Create(ctx, &rbacv1.Role{
-			ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
 		}, metav1.CreateOptions{})
 		require.NoError(t, err)
 
 		_, err = client.RbacV1().RoleBindings("default").Create(ctx, &rbacv1.RoleBinding{
-			ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
-			RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "myapp-default-ttl"},
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
+			RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "myapp-4a0c226a-ttl"},
 		}, metav1.CreateOptions{})
 		require.NoError(t, err)
 
 		// No CronJob exists, so all resources are orphaned
-		orphaned, err := CleanupOrphaned(ctx, client, []string{"default"}, false, true)
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true})
 		require.NoError(t, err)
 		assert.Len(t, orphaned, 3)
 
 		// Verify resources still exist (dry run)
-		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 		require.NoError(t, err)
 	})
 
@@ -239,22 +399,54 @@ func TestCleanupOrphaned(t *testing.T) {
 		}
 
 		_, err := client.CoreV1().ServiceAccounts("default").Create(ctx, &corev1.ServiceAccount{
-			ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
 		}, metav1.CreateOptions{})
 		require.NoError(t, err)
 
 		_, err = client.RbacV1().Roles("default").Create(ctx, &rbacv1.Role{
-			ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
 		}, metav1.CreateOptions{})
 		require.NoError(t, err)
 
-		orphaned, err := CleanupOrphaned(ctx, client, []string{"default"}, false, false)
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
 		require.NoError(t, err)
 		assert.NotEmpty(t, orphaned)
 
 		// Verify resources deleted
-		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("selector limits the sweep", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		for _, release := range []string{"myapp", "other"} {
+			_, err := client.CoreV1().ServiceAccounts("default").Create(ctx, &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: ResourceName(release, "default"), Namespace: "default", Labels: map[string]string{
+					LabelManagedBy:        LabelManagedByValue,
+					LabelRelease:          release,
+					LabelReleaseNamespace: "default",
+					LabelCronjobNamespace: "default",
+				}},
+			}, metav1.CreateOptions{})
+			require.NoError(t, err)
+		}
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{
+			Namespaces: []string{"default"},
+			Selector:   LabelRelease + "=myapp",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []OrphanedResource{{Kind: "ServiceAccount", Name: "myapp-4a0c226a-ttl", Namespace: "default"}}, orphaned)
+
+		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "other-aea32742-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		_, err := CleanupOrphaned(ctx, fake.NewClientset(), CleanupOrphanedOptions{Selector: "release in (("})
 		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid label selector")
 	})
 
 	t.Run("skips non-orphaned resources", func(t *testing.T) {
@@ -269,16 +461,19 @@ func TestCleanupOrphaned(t *testing.T) {
 
 		// Create both RBAC and CronJob (not orphaned)
 		_, err := client.CoreV1().ServiceAccounts("default").Create(ctx, &corev1.ServiceAccount{
-			ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
 		}, metav1.CreateOptions{})
 		require.NoError(t, err)
 
 		_, err = client.BatchV1().CronJobs("default").Create(ctx, &batchv1.CronJob{
-			ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
 		}, metav1.CreateOptions{})
 		require.NoError(t, err)
 
-		orphaned, err := CleanupOrphaned(ctx, client, []string{"default"}, false, true)
+		_, err = client.CoreV1().Secrets("default").Create(ctx, releaseRecord("myapp", "default", "deployed"), metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true})
 		require.NoError(t, err)
 		assert.Empty(t, orphaned)
 	})
@@ -294,17 +489,17 @@ func TestCleanupOrphaned(t *testing.T) {
 		}
 
 		_, err := client.RbacV1().ClusterRoles().Create(ctx, &rbacv1.ClusterRole{
-			ObjectMeta: metav1.ObjectMeta{Name: "myapp-staging-ttl", Labels: labels},
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Labels: labels},
 		}, metav1.CreateOptions{})
 		require.NoError(t, err)
 
 		_, err = client.RbacV1().ClusterRoleBindings().Create(ctx, &rbacv1.ClusterRoleBinding{
-			ObjectMeta: metav1.ObjectMeta{Name: "myapp-staging-ttl", Labels: labels},
-			RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "myapp-staging-ttl"},
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Labels: labels},
+			RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "myapp-80081014-ttl"},
 		}, metav1.CreateOptions{})
 		require.NoError(t, err)
 
-		orphaned, err := CleanupOrphaned(ctx, client, []string{}, false, true)
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{DryRun: true})
 		require.NoError(t, err)
 		assert.Len(t, orphaned, 2)
 
@@ -319,13 +514,13 @@ func TestCleanupOrphaned(t *testing.T) {
 
 func TestOrphanedResource_String(t *testing.T) {
 	t.Run("namespaced resource", func(t *testing.T) {
-		o := OrphanedResource{Kind: "ServiceAccount", Name: "myapp-staging-ttl", Namespace: "ops"}
-		assert.Equal(t, "ServiceAccount myapp-staging-ttl in namespace ops", o.String())
+		o := OrphanedResource{Kind: "ServiceAccount", Name: "myapp-80081014-ttl", Namespace: "ops"}
+		assert.Equal(t, "ServiceAccount myapp-80081014-ttl in namespace ops", o.String())
 	})
 
 	t.Run("cluster-scoped resource", func(t *testing.T) {
-		o := OrphanedResource{Kind: "ClusterRole", Name: "myapp-staging-ttl"}
-		assert.Equal(t, "ClusterRole myapp-staging-ttl (cluster-scoped)", o.String())
+		o := OrphanedResource{Kind: "ClusterRole", Name: "myapp-80081014-ttl"}
+		assert.Equal(t, "ClusterRole myapp-80081014-ttl (cluster-scoped)", o.String())
 	})
 }
 
@@ -334,20 +529,137 @@ func TestCreateServiceAccountAndRBAC_IdempotentCrossNamespace(t *testing.T) {
 	client := fake.NewClientset()
 
 	// Create cross-namespace with delete-namespace, twice
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", true)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true)
 	require.NoError(t, err)
 
-	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", true)
+	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true)
 	require.NoError(t, err)
 
 	// Verify resources still exist and are correct
-	cr, err := client.RbacV1().ClusterRoles().Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	cr, err := client.RbacV1().ClusterRoles().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 	assert.Equal(t, []string{"namespaces"}, cr.Rules[0].Resources)
 
-	crb, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	crb, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
-	assert.Equal(t, "myapp-staging-ttl", crb.Subjects[0].Name)
+	assert.Equal(t, "myapp-80081014-ttl", crb.Subjects[0].Name)
+}
+
+// releaseRecord returns a helm storage Secret for a release.
+func releaseRecord(release, namespace, status string) *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+		Name:      "sh.helm.release.v1." + release + ".v1",
+		Namespace: namespace,
+		Labels:    map[string]string{"owner": "helm", "name": release, "status": status},
+	}}
+}
+
+func TestCleanupOrphaned_ReleaseGone(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("dry run finds the CronJob and its RBAC", func(t *testing.T) {
+		client := fake.NewClientset(
+			buildTestCronJob(t, "myapp", "staging", "ops", false),
+			buildTestCronJob(t, "other", "staging", "ops", false),
+			releaseRecord("other", "staging", "deployed"),
+		)
+		require.NoError(t, CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", false))
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"ops", "staging"}, DryRun: true})
+		require.NoError(t, err)
+		assert.Equal(t, []OrphanedResource{
+			{Kind: "CronJob", Name: "myapp-80081014-ttl", Namespace: "ops"},
+			{Kind: "RoleBinding", Name: "myapp-80081014-ttl", Namespace: "ops"},
+			{Kind: "Role", Name: "myapp-80081014-ttl", Namespace: "ops"},
+			{Kind: "ServiceAccount", Name: "myapp-80081014-ttl", Namespace: "ops"},
+			{Kind: "RoleBinding", Name: "myapp-80081014-ttl", Namespace: "staging"},
+			{Kind: "Role", Name: "myapp-80081014-ttl", Namespace: "staging"},
+		}, orphaned)
+
+		_, err = client.BatchV1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+	})
+
+	t.Run("deletes the CronJob", func(t *testing.T) {
+		client := fake.NewClientset(
+			buildTestCronJob(t, "myapp", "default", "default", false),
+			releaseRecord("myapp", "default", "uninstalled"),
+		)
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
+		require.NoError(t, err)
+		assert.Equal(t, []OrphanedResource{{Kind: "CronJob", Name: "myapp-4a0c226a-ttl", Namespace: "default"}}, orphaned)
+
+		_, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+	})
+
+	t.Run("checks the storage of the CronJob's driver", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", Schedule: "30 14 15 3 *", Driver: "configmaps"})
+		require.NoError(t, err)
+		record := &corev1.ConfigMap{ObjectMeta: releaseRecord("myapp", "default", "deployed").ObjectMeta}
+
+		orphaned, err := CleanupOrphaned(ctx, fake.NewClientset(cj, record), CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, orphaned)
+
+		orphaned, err = CleanupOrphaned(ctx, fake.NewClientset(cj), CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true})
+		require.NoError(t, err)
+		assert.Len(t, orphaned, 1)
+	})
+
+	t.Run("sql releases are never reported gone", func(t *testing.T) {
+		cj, err := BuildCronJob(CronJobOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", Schedule: "30 14 15 3 *", Driver: "sql"})
+		require.NoError(t, err)
+
+		orphaned, err := CleanupOrphaned(ctx, fake.NewClientset(cj), CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, orphaned)
+	})
+
+	t.Run("CronJob without release labels is kept", func(t *testing.T) {
+		cj := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{
+			Name:      "manual-ttl",
+			Namespace: "default",
+			Labels:    map[string]string{LabelManagedBy: LabelManagedByValue},
+		}}
+
+		orphaned, err := CleanupOrphaned(ctx, fake.NewClientset(cj), CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, orphaned)
+	})
+
+	t.Run("storage list error keeps the CronJob", func(t *testing.T) {
+		client := fake.NewClientset(buildTestCronJob(t, "myapp", "default", "default", false))
+		client.PrependReactor("list", "secrets", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("forbidden")
+		})
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, orphaned)
+	})
+
+	t.Run("list CronJobs error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("list", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("simulated list error")
+		})
+
+		_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
+		assert.ErrorContains(t, err, "failed to list CronJobs in default")
+	})
+
+	t.Run("delete CronJob error", func(t *testing.T) {
+		client := fake.NewClientset(buildTestCronJob(t, "myapp", "default", "default", false))
+		client.PrependReactor("delete", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("simulated delete error")
+		})
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
+		assert.ErrorContains(t, err, "failed to delete CronJob myapp-4a0c226a-ttl in default")
+		assert.Len(t, orphaned, 1)
+	})
 }
 
 func TestCleanupOrphaned_AllNamespaces(t *testing.T) {
@@ -374,21 +686,211 @@ func TestCleanupOrphaned_AllNamespaces(t *testing.T) {
 
 	// Create orphaned SA in ops namespace
 	_, err = client.CoreV1().ServiceAccounts("ops").Create(ctx, &corev1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-staging-ttl", Namespace: "ops", Labels: labels},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Namespace: "ops", Labels: labels},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
 	// Create orphaned role in staging
 	_, err = client.RbacV1().Roles("staging").Create(ctx, &rbacv1.Role{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-staging-ttl", Namespace: "staging", Labels: labels},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Namespace: "staging", Labels: labels},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
-	orphaned, err := CleanupOrphaned(ctx, client, nil, true, true)
+	orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{AllNamespaces: true, DryRun: true})
 	require.NoError(t, err)
 	assert.NotEmpty(t, orphaned)
 }
 
+func TestCleanupOrphaned_Concurrency(t *testing.T) {
+	ctx := context.Background()
+
+	// An orphaned ServiceAccount in each of 20 namespaces
+	var objs []runtime.Object
+	var namespaces []string
+	for i := range 20 {
+		ns := fmt.Sprintf("ns-%02d", i)
+		namespaces = append(namespaces, ns)
+		objs = append(objs, &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-ttl",
+			Namespace: ns,
+			Labels: map[string]string{
+				LabelManagedBy:        LabelManagedByValue,
+				LabelRelease:          "myapp",
+				LabelReleaseNamespace: ns,
+			},
+		}})
+	}
+
+	t.Run("in namespace order", func(t *testing.T) {
+		orphaned, err := CleanupOrphaned(ctx, fake.NewClientset(objs...), CleanupOrphanedOptions{Namespaces: namespaces, DryRun: true, Concurrency: 4})
+		require.NoError(t, err)
+		require.Len(t, orphaned, 20)
+		for i, o := range orphaned {
+			assert.Equal(t, namespaces[i], o.Namespace)
+		}
+	})
+
+	t.Run("failed namespaces do not stop the others", func(t *testing.T) {
+		client := fake.NewClientset(objs...)
+		client.PrependReactor("list", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if ns := action.GetNamespace(); ns == "ns-03" || ns == "ns-07" {
+				return true, nil, fmt.Errorf("simulated list error")
+			}
+
+			return false, nil, nil
+		})
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: namespaces})
+		assert.ErrorContains(t, err, "failed to list service accounts in ns-03")
+		assert.ErrorContains(t, err, "failed to list service accounts in ns-07")
+		assert.Len(t, orphaned, 18)
+
+		sas, err := client.CoreV1().ServiceAccounts("").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Len(t, sas.Items, 2)
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		_, err := CleanupOrphaned(ctx, fake.NewClientset(), CleanupOrphanedOptions{Concurrency: -1})
+		assert.EqualError(t, err, "invalid concurrency -1: must not be negative")
+	})
+}
+
+func TestCleanupOrphaned_OlderThan(t *testing.T) {
+	ctx := context.Background()
+	sa := func(release string, age time.Duration) *corev1.ServiceAccount {
+		return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+			Name:      ResourceName(release, "default"),
+			Namespace: "default",
+			Labels: map[string]string{
+				LabelManagedBy:        LabelManagedByValue,
+				LabelRelease:          release,
+				LabelReleaseNamespace: "default",
+			},
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		}}
+	}
+
+	// A CronJob of a release not installed yet, set moments ago, and the
+	// ServiceAccounts of two TTLs whose CronJobs are gone
+	cj := buildTestCronJob(t, "myapp", "default", "default", false)
+	cj.CreationTimestamp = metav1.NewTime(time.Now())
+	client := fake.NewClientset(cj, sa("old", 48*time.Hour), sa("new", time.Minute))
+
+	orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true, OlderThan: 24 * time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, []OrphanedResource{{Kind: "ServiceAccount", Name: ResourceName("old", "default"), Namespace: "default"}}, orphaned)
+
+	orphaned, err = CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true})
+	require.NoError(t, err)
+	assert.Len(t, orphaned, 3)
+
+	_, err = CleanupOrphaned(ctx, client, CleanupOrphanedOptions{OlderThan: -time.Hour})
+	assert.EqualError(t, err, "invalid age -1h0m0s: must not be negative")
+}
+
+func TestSweepNamespaces(t *testing.T) {
+	namespaces := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	sweeps := sweepNamespaces(namespaces, 3, func(ns string) sweep {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		return sweep{stale: []string{ns}}
+	})
+
+	require.Len(t, sweeps, len(namespaces))
+	for i, s := range sweeps {
+		assert.Equal(t, []string{namespaces[i]}, s.stale)
+	}
+	assert.Equal(t, 3, maxInFlight)
+}
+
+func TestCleanupOrphaned_RunningTTL(t *testing.T) {
+	ctx := context.Background()
+	ttlLabels := map[string]string{
+		LabelManagedBy:        LabelManagedByValue,
+		LabelRelease:          "myapp",
+		LabelReleaseNamespace: "default",
+		LabelCronjobNamespace: "default",
+	}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: ttlLabels}}
+	job := func(conditions ...batchv1.JobCondition) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl-29000000", Namespace: "default", Labels: ttlLabels},
+			Status:     batchv1.JobStatus{Conditions: conditions},
+		}
+	}
+	pod := func(phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl-29000000-abcde", Namespace: "default", Labels: ttlLabels},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		objs     []runtime.Object
+		orphaned bool
+	}{
+		{name: "no runs", orphaned: true},
+		{name: "running Job", objs: []runtime.Object{job()}},
+		{name: "completed Job", objs: []runtime.Object{job(batchv1.JobCondition{Type: batchv1.JobComplete, Status: corev1.ConditionTrue})}, orphaned: true},
+		{name: "failed Job", objs: []runtime.Object{job(batchv1.JobCondition{Type: batchv1.JobFailed, Status: corev1.ConditionTrue})}, orphaned: true},
+		{name: "running pod of a deleted Job", objs: []runtime.Object{pod(corev1.PodRunning)}},
+		{name: "finished pod", objs: []runtime.Object{pod(corev1.PodSucceeded)}, orphaned: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset(append(tt.objs, sa)...)
+			orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
+			require.NoError(t, err)
+
+			_, getErr := client.CoreV1().ServiceAccounts("default").Get(ctx, sa.Name, metav1.GetOptions{})
+			if tt.orphaned {
+				assert.Len(t, orphaned, 1)
+				assert.True(t, errors.IsNotFound(getErr))
+			} else {
+				assert.Empty(t, orphaned)
+				assert.NoError(t, getErr)
+			}
+		})
+	}
+
+	t.Run("stale CronJob with a running Job", func(t *testing.T) {
+		// The uninstall is done, so the release is gone, but the Job is
+		// still deleting the namespace
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		client := fake.NewClientset(cj, sa, job())
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, orphaned)
+	})
+
+	t.Run("Jobs that cannot be listed count as running", func(t *testing.T) {
+		client := fake.NewClientset(sa)
+		client.PrependReactor("list", "jobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("simulated list error")
+		})
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}, DryRun: true})
+		require.NoError(t, err)
+		assert.Empty(t, orphaned)
+	})
+}
+
 func TestCleanupOrphaned_DeletesClusterScopedOrphans(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
@@ -401,26 +903,26 @@ func TestCleanupOrphaned_DeletesClusterScopedOrphans(t *testing.T) {
 	}
 
 	_, err := client.RbacV1().ClusterRoles().Create(ctx, &rbacv1.ClusterRole{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-staging-ttl", Labels: labels},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Labels: labels},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
 	_, err = client.RbacV1().ClusterRoleBindings().Create(ctx, &rbacv1.ClusterRoleBinding{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-staging-ttl", Labels: labels},
-		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "myapp-staging-ttl"},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Labels: labels},
+		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "myapp-80081014-ttl"},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
 	// Delete (not dry-run)
-	orphaned, err := CleanupOrphaned(ctx, client, []string{}, false, false)
+	orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{})
 	require.NoError(t, err)
 	assert.Len(t, orphaned, 2)
 
 	// Verify deleted
-	_, err = client.RbacV1().ClusterRoles().Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().ClusterRoles().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	assert.Error(t, err)
 
-	_, err = client.RbacV1().ClusterRoleBindings().Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().ClusterRoleBindings().Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	assert.Error(t, err)
 }
 
@@ -436,34 +938,34 @@ func TestCleanupOrphaned_DeletesNamespacedOrphans(t *testing.T) {
 	}
 
 	_, err := client.RbacV1().RoleBindings("default").Create(ctx, &rbacv1.RoleBinding{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
-		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "myapp-default-ttl"},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
+		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "myapp-4a0c226a-ttl"},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
 	_, err = client.RbacV1().Roles("default").Create(ctx, &rbacv1.Role{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
 	_, err = client.CoreV1().ServiceAccounts("default").Create(ctx, &corev1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
 	// Delete (not dry-run)
-	orphaned, err := CleanupOrphaned(ctx, client, []string{"default"}, false, false)
+	orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
 	require.NoError(t, err)
 	assert.Len(t, orphaned, 3)
 
 	// Verify all deleted
-	_, err = client.RbacV1().RoleBindings("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().RoleBindings("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 	assert.Error(t, err)
 
-	_, err = client.RbacV1().Roles("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 	assert.Error(t, err)
 
-	_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+	_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 	assert.Error(t, err)
 }
 
@@ -472,11 +974,11 @@ func TestCleanupOrphaned_DeletesNamespacedOrphans(t *testing.T) {
 func TestCreateServiceAccountAndRBAC_SACreateError(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
-	client.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+	client.PrependReactor("patch", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated SA create error")
 	})
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create service account")
 }
@@ -484,11 +986,11 @@ func TestCreateServiceAccountAndRBAC_SACreateError(t *testing.T) {
 func TestCreateServiceAccountAndRBAC_RoleCreateError(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
-	client.PrependReactor("create", "roles", func(action k8stesting.Action) (bool, runtime.Object, error) {
+	client.PrependReactor("patch", "roles", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated role create error")
 	})
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create role")
 }
@@ -496,11 +998,11 @@ func TestCreateServiceAccountAndRBAC_RoleCreateError(t *testing.T) {
 func TestCreateServiceAccountAndRBAC_RoleBindingCreateError(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
-	client.PrependReactor("create", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
+	client.PrependReactor("patch", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated rolebinding create error")
 	})
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create role binding")
 }
@@ -508,11 +1010,11 @@ func TestCreateServiceAccountAndRBAC_RoleBindingCreateError(t *testing.T) {
 func TestCreateServiceAccountAndRBAC_CrossNS_ReleaseRoleError(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
-	client.PrependReactor("create", "roles", func(action k8stesting.Action) (bool, runtime.Object, error) {
+	client.PrependReactor("patch", "roles", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated role error")
 	})
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create role in release namespace")
 }
@@ -520,11 +1022,11 @@ func TestCreateServiceAccountAndRBAC_CrossNS_ReleaseRoleError(t *testing.T) {
 func TestCreateServiceAccountAndRBAC_CrossNS_ReleaseBindingError(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
-	client.PrependReactor("create", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
+	client.PrependReactor("patch", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated binding error")
 	})
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create role binding in release namespace")
 }
@@ -533,7 +1035,7 @@ func TestCreateServiceAccountAndRBAC_CrossNS_CronjobRoleError(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
 	callCount := 0
-	client.PrependReactor("create", "roles", func(action k8stesting.Action) (bool, runtime.Object, error) {
+	client.PrependReactor("patch", "roles", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		callCount++
 		if callCount == 2 {
 			return true, nil, fmt.Errorf("simulated cronjob role error")
@@ -541,7 +1043,7 @@ func TestCreateServiceAccountAndRBAC_CrossNS_CronjobRoleError(t *testing.T) {
 		return false, nil, nil
 	})
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create role in CronJob namespace")
 }
@@ -550,7 +1052,7 @@ func TestCreateServiceAccountAndRBAC_CrossNS_CronjobBindingError(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
 	callCount := 0
-	client.PrependReactor("create", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
+	client.PrependReactor("patch", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		callCount++
 		if callCount == 2 {
 			return true, nil, fmt.Errorf("simulated cronjob binding error")
@@ -558,7 +1060,7 @@ func TestCreateServiceAccountAndRBAC_CrossNS_CronjobBindingError(t *testing.T) {
 		return false, nil, nil
 	})
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create role binding in CronJob namespace")
 }
@@ -566,11 +1068,11 @@ func TestCreateServiceAccountAndRBAC_CrossNS_CronjobBindingError(t *testing.T) {
 func TestCreateServiceAccountAndRBAC_DeleteNS_ClusterRoleError(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
-	client.PrependReactor("create", "clusterroles", func(action k8stesting.Action) (bool, runtime.Object, error) {
+	client.PrependReactor("patch", "clusterroles", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated cluster role error")
 	})
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", true)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create cluster role")
 }
@@ -578,11 +1080,11 @@ func TestCreateServiceAccountAndRBAC_DeleteNS_ClusterRoleError(t *testing.T) {
 func TestCreateServiceAccountAndRBAC_DeleteNS_ClusterRoleBindingError(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
-	client.PrependReactor("create", "clusterrolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
+	client.PrependReactor("patch", "clusterrolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated cluster role binding error")
 	})
 
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", true)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create cluster role binding")
 }
@@ -655,7 +1157,7 @@ func TestCleanupOrphaned_ListNamespacesError(t *testing.T) {
 		return true, nil, fmt.Errorf("simulated list error")
 	})
 
-	_, err := CleanupOrphaned(ctx, client, nil, true, false)
+	_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{AllNamespaces: true})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to list namespaces")
 }
@@ -667,7 +1169,7 @@ func TestCleanupOrphaned_ListClusterRoleBindingsError(t *testing.T) {
 		return true, nil, fmt.Errorf("simulated list error")
 	})
 
-	_, err := CleanupOrphaned(ctx, client, []string{"default"}, false, false)
+	_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to list cluster role bindings")
 }
@@ -679,7 +1181,7 @@ func TestCleanupOrphaned_ListClusterRolesError(t *testing.T) {
 		return true, nil, fmt.Errorf("simulated list error")
 	})
 
-	_, err := CleanupOrphaned(ctx, client, []string{"default"}, false, false)
+	_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to list cluster roles")
 }
@@ -691,7 +1193,7 @@ func TestCleanupOrphaned_ListRoleBindingsError(t *testing.T) {
 		return true, nil, fmt.Errorf("simulated list error")
 	})
 
-	_, err := CleanupOrphaned(ctx, client, []string{"default"}, false, false)
+	_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to list role bindings")
 }
@@ -703,7 +1205,7 @@ func TestCleanupOrphaned_ListRolesError(t *testing.T) {
 		return true, nil, fmt.Errorf("simulated list error")
 	})
 
-	_, err := CleanupOrphaned(ctx, client, []string{"default"}, false, false)
+	_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to list roles")
 }
@@ -715,7 +1217,7 @@ func TestCleanupOrphaned_ListServiceAccountsError(t *testing.T) {
 		return true, nil, fmt.Errorf("simulated list error")
 	})
 
-	_, err := CleanupOrphaned(ctx, client, []string{"default"}, false, false)
+	_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to list service accounts")
 }
@@ -729,14 +1231,14 @@ func TestCleanupOrphaned_DeleteClusterRoleBindingError(t *testing.T) {
 		LabelCronjobNamespace: "ops",
 	}
 	client := fake.NewClientset(&rbacv1.ClusterRoleBinding{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-staging-ttl", Labels: labels},
-		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "myapp-staging-ttl"},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Labels: labels},
+		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "myapp-80081014-ttl"},
 	})
 	client.PrependReactor("delete", "clusterrolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated delete error")
 	})
 
-	_, err := CleanupOrphaned(ctx, client, []string{}, false, false)
+	_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to delete cluster role binding")
 }
@@ -750,13 +1252,13 @@ func TestCleanupOrphaned_DeleteClusterRoleError(t *testing.T) {
 		LabelCronjobNamespace: "ops",
 	}
 	client := fake.NewClientset(&rbacv1.ClusterRole{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-staging-ttl", Labels: labels},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl", Labels: labels},
 	})
 	client.PrependReactor("delete", "clusterroles", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated delete error")
 	})
 
-	_, err := CleanupOrphaned(ctx, client, []string{}, false, false)
+	_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to delete cluster role")
 }
@@ -770,14 +1272,14 @@ func TestCleanupOrphaned_DeleteRoleBindingError(t *testing.T) {
 		LabelCronjobNamespace: "default",
 	}
 	client := fake.NewClientset(&rbacv1.RoleBinding{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
-		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "myapp-default-ttl"},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
+		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "myapp-4a0c226a-ttl"},
 	})
 	client.PrependReactor("delete", "rolebindings", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated delete error")
 	})
 
-	_, err := CleanupOrphaned(ctx, client, []string{"default"}, false, false)
+	_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to delete role binding")
 }
@@ -791,13 +1293,13 @@ func TestCleanupOrphaned_DeleteRoleError(t *testing.T) {
 		LabelCronjobNamespace: "default",
 	}
 	client := fake.NewClientset(&rbacv1.Role{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
 	})
 	client.PrependReactor("delete", "roles", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated delete error")
 	})
 
-	_, err := CleanupOrphaned(ctx, client, []string{"default"}, false, false)
+	_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to delete role")
 }
@@ -811,41 +1313,23 @@ func TestCleanupOrphaned_DeleteServiceAccountError(t *testing.T) {
 		LabelCronjobNamespace: "default",
 	}
 	client := fake.NewClientset(&corev1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: labels},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default", Labels: labels},
 	})
 	client.PrependReactor("delete", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
 		return true, nil, fmt.Errorf("simulated delete error")
 	})
 
-	_, err := CleanupOrphaned(ctx, client, []string{"default"}, false, false)
+	_, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to delete service account")
 }
 
-func TestCreateServiceAccountAndRBAC_ResourceNameTooLong(t *testing.T) {
-	ctx := context.Background()
-	client := fake.NewClientset()
-
-	err := CreateServiceAccountAndRBAC(ctx, client, "a-very-long-release-name-that-will-exceed", "a-long-namespace", "default", "sa", false)
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "exceeds maximum length")
-}
-
-func TestCleanupRBAC_ResourceNameTooLong(t *testing.T) {
-	ctx := context.Background()
-	client := fake.NewClientset()
-
-	err := CleanupRBAC(ctx, client, "a-very-long-release-name-that-will-exceed", "a-long-namespace", "default")
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "exceeds maximum length")
-}
-
 func TestCreateOrUpdateServiceAccount_GetError(t *testing.T) {
 	ctx := context.Background()
 	client := fake.NewClientset()
 	// Pre-create the SA so the create will get AlreadyExists
 	_, err := client.CoreV1().ServiceAccounts("default").Create(ctx, &corev1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default"},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default"},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
@@ -854,7 +1338,7 @@ func TestCreateOrUpdateServiceAccount_GetError(t *testing.T) {
 		return true, nil, fmt.Errorf("simulated get error")
 	})
 
-	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", false)
+	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create service account")
 }
@@ -864,7 +1348,7 @@ func TestCreateOrUpdateRole_GetError(t *testing.T) {
 	client := fake.NewClientset()
 	// Pre-create the role so create returns AlreadyExists
 	_, err := client.RbacV1().Roles("default").Create(ctx, &rbacv1.Role{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default"},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default"},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
@@ -873,7 +1357,7 @@ func TestCreateOrUpdateRole_GetError(t *testing.T) {
 		return true, nil, fmt.Errorf("simulated get error")
 	})
 
-	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", false)
+	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create role")
 }
@@ -883,8 +1367,8 @@ func TestCreateOrUpdateRoleBinding_GetError(t *testing.T) {
 	client := fake.NewClientset()
 	// Pre-create the rolebinding
 	_, err := client.RbacV1().RoleBindings("default").Create(ctx, &rbacv1.RoleBinding{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default"},
-		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "myapp-default-ttl"},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-4a0c226a-ttl", Namespace: "default"},
+		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "Role", Name: "myapp-4a0c226a-ttl"},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
@@ -892,7 +1376,7 @@ func TestCreateOrUpdateRoleBinding_GetError(t *testing.T) {
 		return true, nil, fmt.Errorf("simulated get error")
 	})
 
-	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", false)
+	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create role binding")
 }
@@ -902,7 +1386,7 @@ func TestCreateOrUpdateClusterRole_GetError(t *testing.T) {
 	client := fake.NewClientset()
 	// Pre-create the cluster role
 	_, err := client.RbacV1().ClusterRoles().Create(ctx, &rbacv1.ClusterRole{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-staging-ttl"},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl"},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
@@ -910,7 +1394,7 @@ func TestCreateOrUpdateClusterRole_GetError(t *testing.T) {
 		return true, nil, fmt.Errorf("simulated get error")
 	})
 
-	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", true)
+	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create cluster role")
 }
@@ -920,8 +1404,8 @@ func TestCreateOrUpdateClusterRoleBinding_GetError(t *testing.T) {
 	client := fake.NewClientset()
 	// Pre-create the cluster role binding
 	_, err := client.RbacV1().ClusterRoleBindings().Create(ctx, &rbacv1.ClusterRoleBinding{
-		ObjectMeta: metav1.ObjectMeta{Name: "myapp-staging-ttl"},
-		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "myapp-staging-ttl"},
+		ObjectMeta: metav1.ObjectMeta{Name: "myapp-80081014-ttl"},
+		RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: "myapp-80081014-ttl"},
 	}, metav1.CreateOptions{})
 	require.NoError(t, err)
 
@@ -929,7 +1413,7 @@ func TestCreateOrUpdateClusterRoleBinding_GetError(t *testing.T) {
 		return true, nil, fmt.Errorf("simulated get error")
 	})
 
-	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", true)
+	err = CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to create cluster role binding")
 }
@@ -939,7 +1423,7 @@ func TestCleanupRBAC_CrossNamespaceDeleteError(t *testing.T) {
 	client := fake.NewClientset()
 
 	// Create cross-namespace resources
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", false)
 	require.NoError(t, err)
 
 	// Make role deletion in the second namespace fail
@@ -968,7 +1452,7 @@ func TestIsOrphaned_EmptyCronjobNamespace(t *testing.T) {
 	}
 
 	// No CronJob exists, so should be orphaned
-	result := isOrphaned(ctx, client, labels)
+	result := isOrphaned(ctx, client, &metav1.ObjectMeta{Labels: labels}, nil)
 	assert.True(t, result)
 }
 
@@ -977,17 +1461,17 @@ func TestCleanupRBAC_CrossNamespace(t *testing.T) {
 	client := fake.NewClientset()
 
 	// Create cross-namespace resources
-	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-staging-ttl", false)
+	err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", false)
 	require.NoError(t, err)
 
 	// Verify they exist
-	_, err = client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 
-	_, err = client.RbacV1().Roles("staging").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().Roles("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 
-	_, err = client.RbacV1().Roles("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().Roles("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	require.NoError(t, err)
 
 	// Clean up
@@ -995,18 +1479,18 @@ func TestCleanupRBAC_CrossNamespace(t *testing.T) {
 	require.NoError(t, err)
 
 	// Verify all gone
-	_, err = client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	assert.Error(t, err)
 
-	_, err = client.RbacV1().Roles("staging").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().Roles("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	assert.Error(t, err)
 
-	_, err = client.RbacV1().Roles("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().Roles("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	assert.Error(t, err)
 
-	_, err = client.RbacV1().RoleBindings("staging").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().RoleBindings("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	assert.Error(t, err)
 
-	_, err = client.RbacV1().RoleBindings("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+	_, err = client.RbacV1().RoleBindings("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 	assert.Error(t, err)
 }
@@ -0,0 +1,181 @@
+package ttl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// AnnotationDuration is the annotation a chart uses to declare the TTL its
+// releases should get, e.g. `helm-ttl.io/duration: 72h`.
+const AnnotationDuration = "helm-ttl.io/duration"
+
+// DurationNotDeclaredError is returned when a release does not declare a TTL.
+type DurationNotDeclaredError struct {
+	Name string
+	// ValuesKey is the key of the release's values the TTL was looked up
+	// at, if it was looked up in the values.
+	ValuesKey string
+}
+
+func (e *DurationNotDeclaredError) Error() string {
+	if e.ValuesKey != "" {
+		return fmt.Sprintf("release %q does not set %s in its values", e.Name, e.ValuesKey)
+	}
+
+	return fmt.Sprintf("release %q does not declare a %s annotation", e.Name, AnnotationDuration)
+}
+
+// DurationFromRelease returns the TTL duration declared by an installed
+// release. It checks, in order:
+// 1. The release's labels (set with `helm install --labels`)
+// 2. The chart's Chart.yaml annotations
+// 3. The annotations of the objects in the rendered release manifest
+func DurationFromRelease(rel *release.Release) (string, error) {
+	if d := strings.TrimSpace(rel.Labels[AnnotationDuration]); d != "" {
+		return d, nil
+	}
+
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		if d := strings.TrimSpace(rel.Chart.Metadata.Annotations[AnnotationDuration]); d != "" {
+			return d, nil
+		}
+	}
+
+	d, err := durationFromManifest(rel.Manifest)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse manifest of release %q: %w", rel.Name, err)
+	}
+
+	if d != "" {
+		return d, nil
+	}
+
+	return "", &DurationNotDeclaredError{Name: rel.Name}
+}
+
+// DurationFromValues returns the TTL duration a release sets at a
+// dot-separated key of its values, such as ttl or global.ttl: the values
+// it was installed with, over the chart's defaults.
+func DurationFromValues(rel *release.Release, key string) (string, error) {
+	vals := chartutil.Values(rel.Config)
+	if rel.Chart != nil {
+		var err error
+		vals, err = chartutil.CoalesceValues(rel.Chart, rel.Config)
+		if err != nil {
+			return "", fmt.Errorf("failed to read values of release %q: %w", rel.Name, err)
+		}
+	}
+
+	v, err := vals.PathValue(key)
+	if err != nil || v == nil {
+		return "", &DurationNotDeclaredError{Name: rel.Name, ValuesKey: key}
+	}
+
+	d, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("value %s of release %q must be a duration such as 72h, got %v", key, rel.Name, v)
+	}
+
+	if d = strings.TrimSpace(d); d == "" {
+		return "", &DurationNotDeclaredError{Name: rel.Name, ValuesKey: key}
+	}
+
+	return d, nil
+}
+
+// durationFromManifest returns the first duration annotation found on an
+// object in a multi-document YAML manifest.
+func durationFromManifest(manifest string) (string, error) {
+	dec := yaml.NewDecoder(strings.NewReader(manifest))
+	for {
+		var obj struct {
+			Metadata struct {
+				Annotations map[string]string `yaml:"annotations"`
+			} `yaml:"metadata"`
+		}
+
+		err := dec.Decode(&obj)
+		if errors.Is(err, io.EOF) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if d := strings.TrimSpace(obj.Metadata.Annotations[AnnotationDuration]); d != "" {
+			return d, nil
+		}
+	}
+}
+
+// annotateReleaseStorage records a TTL on the Secrets or ConfigMaps helm
+// stores a release in, so tooling can find it without knowing helm-ttl's
+// naming: the expiry in helm-ttl/expires-at and the CronJob, as
+// namespace/name, in helm-ttl/cronjob. A zero expiresAt removes both
+// annotations. Releases stored with the sql driver have no records in the
+// cluster to annotate.
+func annotateReleaseStorage(ctx context.Context, client kubernetes.Interface, driver, releaseName, releaseNamespace, cronJob string, expiresAt time.Time) error {
+	storage, err := StorageResource(driver)
+	if err != nil || storage == "" {
+		return err
+	}
+
+	annotations := map[string]any{AnnotationExpiresAt: nil, AnnotationCronJob: nil}
+	if !expiresAt.IsZero() {
+		annotations[AnnotationExpiresAt] = FormatScheduledDate(expiresAt.UTC())
+		annotations[AnnotationCronJob] = cronJob
+	}
+
+	patch, err := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": annotations}})
+	if err != nil {
+		return err
+	}
+
+	opts := metav1.ListOptions{LabelSelector: ReleaseStorageSelector(releaseName, false)}
+	var names []string
+	if storage == "configmaps" {
+		cms, err := client.CoreV1().ConfigMaps(releaseNamespace).List(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list storage records of release %q: %w", releaseName, err)
+		}
+
+		for _, cm := range cms.Items {
+			names = append(names, cm.Name)
+		}
+	} else {
+		secrets, err := client.CoreV1().Secrets(releaseNamespace).List(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list storage records of release %q: %w", releaseName, err)
+		}
+
+		for _, s := range secrets.Items {
+			names = append(names, s.Name)
+		}
+	}
+
+	for _, name := range names {
+		if storage == "configmaps" {
+			_, err = client.CoreV1().ConfigMaps(releaseNamespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+		} else {
+			_, err = client.CoreV1().Secrets(releaseNamespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to annotate storage record %s of release %q: %w", name, releaseName, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,310 @@
+package ttl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestDurationFromRelease(t *testing.T) {
+	t.Run("chart annotation", func(t *testing.T) {
+		rel := &release.Release{
+			Name: "myapp",
+			Chart: &chart.Chart{
+				Metadata: &chart.Metadata{
+					Name:        "test-chart",
+					Annotations: map[string]string{AnnotationDuration: " 72h "},
+				},
+			},
+		}
+
+		d, err := DurationFromRelease(rel)
+		require.NoError(t, err)
+		assert.Equal(t, "72h", d)
+	})
+
+	t.Run("release label", func(t *testing.T) {
+		rel := &release.Release{
+			Name:   "myapp",
+			Labels: map[string]string{AnnotationDuration: "24h"},
+		}
+
+		d, err := DurationFromRelease(rel)
+		require.NoError(t, err)
+		assert.Equal(t, "24h", d)
+	})
+
+	t.Run("release label takes precedence over chart annotation", func(t *testing.T) {
+		rel := &release.Release{
+			Name:   "myapp",
+			Labels: map[string]string{AnnotationDuration: "24h"},
+			Chart: &chart.Chart{
+				Metadata: &chart.Metadata{
+					Annotations: map[string]string{AnnotationDuration: "72h"},
+				},
+			},
+		}
+
+		d, err := DurationFromRelease(rel)
+		require.NoError(t, err)
+		assert.Equal(t, "24h", d)
+	})
+
+	t.Run("chart annotation takes precedence over manifest", func(t *testing.T) {
+		rel := &release.Release{
+			Name: "myapp",
+			Chart: &chart.Chart{
+				Metadata: &chart.Metadata{
+					Annotations: map[string]string{AnnotationDuration: "72h"},
+				},
+			},
+			Manifest: "metadata:\n  annotations:\n    helm-ttl.io/duration: 1h\n",
+		}
+
+		d, err := DurationFromRelease(rel)
+		require.NoError(t, err)
+		assert.Equal(t, "72h", d)
+	})
+
+	t.Run("manifest annotation", func(t *testing.T) {
+		rel := &release.Release{
+			Name: "myapp",
+			Manifest: `---
+# Source: test-chart/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: myapp
+---
+# Source: test-chart/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+  annotations:
+    helm-ttl.io/duration: 3 days
+`,
+		}
+
+		d, err := DurationFromRelease(rel)
+		require.NoError(t, err)
+		assert.Equal(t, "3 days", d)
+	})
+
+	t.Run("not declared", func(t *testing.T) {
+		rel := &release.Release{
+			Name:     "myapp",
+			Chart:    &chart.Chart{Metadata: &chart.Metadata{Name: "test-chart"}},
+			Manifest: "apiVersion: v1\nkind: Service\nmetadata:\n  name: myapp\n",
+		}
+
+		_, err := DurationFromRelease(rel)
+		var notDeclared *DurationNotDeclaredError
+		require.True(t, errors.As(err, &notDeclared))
+		assert.Equal(t, "myapp", notDeclared.Name)
+	})
+
+	t.Run("invalid manifest", func(t *testing.T) {
+		rel := &release.Release{
+			Name:     "myapp",
+			Manifest: "metadata: [unterminated",
+		}
+
+		_, err := DurationFromRelease(rel)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to parse manifest")
+	})
+}
+
+func TestDurationFromValues(t *testing.T) {
+	withChart := func(defaults, config map[string]interface{}) *release.Release {
+		return &release.Release{
+			Name:   "myapp",
+			Chart:  &chart.Chart{Metadata: &chart.Metadata{Name: "test-chart"}, Values: defaults},
+			Config: config,
+		}
+	}
+
+	t.Run("user value", func(t *testing.T) {
+		d, err := DurationFromValues(withChart(map[string]interface{}{"ttl": "24h"}, map[string]interface{}{"ttl": " 72h "}), "ttl")
+		require.NoError(t, err)
+		assert.Equal(t, "72h", d)
+	})
+
+	t.Run("chart default", func(t *testing.T) {
+		d, err := DurationFromValues(withChart(map[string]interface{}{"ttl": "24h"}, nil), "ttl")
+		require.NoError(t, err)
+		assert.Equal(t, "24h", d)
+	})
+
+	t.Run("nested key", func(t *testing.T) {
+		d, err := DurationFromValues(withChart(nil, map[string]interface{}{
+			"global": map[string]interface{}{"ttl": "3d"},
+		}), "global.ttl")
+		require.NoError(t, err)
+		assert.Equal(t, "3d", d)
+	})
+
+	t.Run("without chart", func(t *testing.T) {
+		d, err := DurationFromValues(&release.Release{Name: "myapp", Config: map[string]interface{}{"ttl": "1h"}}, "ttl")
+		require.NoError(t, err)
+		assert.Equal(t, "1h", d)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		for _, rel := range []*release.Release{
+			withChart(nil, nil),
+			withChart(nil, map[string]interface{}{"ttl": ""}),
+			withChart(nil, map[string]interface{}{"ttl": nil}),
+		} {
+			_, err := DurationFromValues(rel, "ttl")
+			var notDeclared *DurationNotDeclaredError
+			require.True(t, errors.As(err, &notDeclared))
+			assert.Equal(t, "ttl", notDeclared.ValuesKey)
+			assert.Equal(t, `release "myapp" does not set ttl in its values`, err.Error())
+		}
+	})
+
+	t.Run("not a string", func(t *testing.T) {
+		_, err := DurationFromValues(withChart(nil, map[string]interface{}{"ttl": 72}), "ttl")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "must be a duration such as 72h, got 72")
+	})
+}
+
+func TestDurationNotDeclaredError(t *testing.T) {
+	err := &DurationNotDeclaredError{Name: "myapp"}
+	assert.Equal(t, `release "myapp" does not declare a helm-ttl.io/duration annotation`, err.Error())
+}
+
+func TestAnnotateReleaseStorage(t *testing.T) {
+	ctx := context.Background()
+	expiresAt := time.Date(2027, 1, 1, 12, 0, 0, 0, time.FixedZone("EST", -5*3600))
+
+	record := func(name string) *corev1.Secret {
+		s := releaseRecord("myapp", "staging", "superseded")
+		s.Name = name
+		return s
+	}
+
+	t.Run("annotates every secret of the release", func(t *testing.T) {
+		other := releaseRecord("other", "staging", "deployed")
+		client := fake.NewClientset(record("sh.helm.release.v1.myapp.v1"), record("sh.helm.release.v1.myapp.v2"), other)
+
+		require.NoError(t, annotateReleaseStorage(ctx, client, "secrets", "myapp", "staging", "ops/myapp-80081014-ttl", expiresAt))
+
+		for _, name := range []string{"sh.helm.release.v1.myapp.v1", "sh.helm.release.v1.myapp.v2"} {
+			s, err := client.CoreV1().Secrets("staging").Get(ctx, name, metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "2027-01-01T17:00:00Z", s.Annotations[AnnotationExpiresAt])
+			assert.Equal(t, "ops/myapp-80081014-ttl", s.Annotations[AnnotationCronJob])
+		}
+
+		s, err := client.CoreV1().Secrets("staging").Get(ctx, other.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, s.Annotations)
+	})
+
+	t.Run("removes the annotations", func(t *testing.T) {
+		s := record("sh.helm.release.v1.myapp.v1")
+		s.Annotations = map[string]string{AnnotationExpiresAt: "2027-01-01T17:00:00Z", AnnotationCronJob: "ops/myapp-80081014-ttl", "keep": "me"}
+		client := fake.NewClientset(s)
+
+		require.NoError(t, annotateReleaseStorage(ctx, client, "secrets", "myapp", "staging", "", time.Time{}))
+
+		s, err := client.CoreV1().Secrets("staging").Get(ctx, s.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"keep": "me"}, s.Annotations)
+	})
+
+	t.Run("configmaps driver", func(t *testing.T) {
+		client := fake.NewClientset(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:      "sh.helm.release.v1.myapp.v1",
+			Namespace: "staging",
+			Labels:    map[string]string{"owner": "helm", "name": "myapp", "status": "deployed"},
+		}})
+
+		require.NoError(t, annotateReleaseStorage(ctx, client, "configmap", "myapp", "staging", "staging/myapp-80081014-ttl", expiresAt))
+
+		cm, err := client.CoreV1().ConfigMaps("staging").Get(ctx, "sh.helm.release.v1.myapp.v1", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "staging/myapp-80081014-ttl", cm.Annotations[AnnotationCronJob])
+	})
+
+	t.Run("sql driver has nothing to annotate", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		require.NoError(t, annotateReleaseStorage(ctx, client, "sql", "myapp", "staging", "ops/myapp-80081014-ttl", expiresAt))
+		assert.Empty(t, client.Actions())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		err := annotateReleaseStorage(ctx, fake.NewClientset(), "memory", "myapp", "staging", "ops/myapp-80081014-ttl", expiresAt)
+		assert.ErrorContains(t, err, `unsupported Helm storage driver "memory"`)
+
+		for _, storage := range []string{"secrets", "configmaps"} {
+			client := fake.NewClientset()
+			client.PrependReactor("list", storage, func(_ k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.New("forbidden")
+			})
+
+			err = annotateReleaseStorage(ctx, client, storage, "myapp", "staging", "ops/myapp-80081014-ttl", expiresAt)
+			assert.EqualError(t, err, `failed to list storage records of release "myapp": forbidden`)
+		}
+
+		client := fake.NewClientset(record("sh.helm.release.v1.myapp.v1"))
+		client.PrependReactor("patch", "secrets", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		err = annotateReleaseStorage(ctx, client, "secrets", "myapp", "staging", "ops/myapp-80081014-ttl", expiresAt)
+		assert.EqualError(t, err, `failed to annotate storage record sh.helm.release.v1.myapp.v1 of release "myapp": forbidden`)
+	})
+}
+
+func TestReleaseStorageAnnotations_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset(releaseRecord("myapp", "default", "deployed"))
+	annotations := func() map[string]string {
+		s, err := client.CoreV1().Secrets("default").Get(ctx, "sh.helm.release.v1.myapp.v1", metav1.GetOptions{})
+		require.NoError(t, err)
+		return s.Annotations
+	}
+
+	_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "2d",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	})
+	require.NoError(t, err)
+	set, err := time.Parse(time.RFC3339, annotations()[AnnotationExpiresAt])
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(48*time.Hour), set, time.Minute)
+	assert.Equal(t, "default/myapp-4a0c226a-ttl", annotations()[AnnotationCronJob])
+
+	_, err = ExtendTTL(ctx, client, ExtendTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", By: 24 * time.Hour})
+	require.NoError(t, err)
+	extended, err := time.Parse(time.RFC3339, annotations()[AnnotationExpiresAt])
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, extended.Sub(set).Round(time.Minute))
+
+	require.NoError(t, UnsetTTL(ctx, client, "myapp", "default", "default"))
+	assert.NotContains(t, annotations(), AnnotationExpiresAt)
+	assert.NotContains(t, annotations(), AnnotationCronJob)
+}
@@ -0,0 +1,383 @@
+package ttl
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	typedbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+
+	"github.com/josegonzalez/helm-ttl/pkg/api/v1alpha1"
+)
+
+// releaseTTLBackend keeps each TTL as a ReleaseTTL custom resource, which
+// helm ttl controller expires like a TTL of the controller backend. It
+// reads and writes them with a dynamic client, so it is only usable from
+// WithReleaseTTLs.
+type releaseTTLBackend struct {
+	client dynamic.Interface
+}
+
+// WithReleaseTTLs returns a client whose BatchV1 CronJobs are the
+// ReleaseTTLs dyn reads and writes.
+func WithReleaseTTLs(client kubernetes.Interface, dyn dynamic.Interface) kubernetes.Interface {
+	return &backendClient{Interface: client, backend: releaseTTLBackend{client: dyn}}
+}
+
+func (releaseTTLBackend) Name() string { return BackendReleaseTTL }
+
+func (releaseTTLBackend) GroupVersionKind() schema.GroupVersionKind {
+	return v1alpha1.SchemeGroupVersion.WithKind(v1alpha1.Kind)
+}
+
+func (b releaseTTLBackend) CronJobs(_ kubernetes.Interface, namespace string) typedbatchv1.CronJobInterface {
+	return &releaseTTLCronJobs{client: b.client.Resource(v1alpha1.Resource).Namespace(namespace)}
+}
+
+func (releaseTTLBackend) Object(cj *batchv1.CronJob, _ time.Time) (runtime.Object, error) {
+	return ReleaseTTLOf(cj)
+}
+
+func (releaseTTLBackend) Rules() []rbacv1.PolicyRule { return nil }
+
+func (releaseTTLBackend) RunsJobs() bool { return false }
+
+// ReleaseTTLOf returns the ReleaseTTL keeping the TTL CronJob cj. Its
+// labels and annotations are kept, less those the spec of the ReleaseTTL
+// sets again. It fails for a TTL the controller cannot expire.
+func ReleaseTTLOf(cj *batchv1.CronJob) (*v1alpha1.ReleaseTTL, error) {
+	if err := checkControllerTTL(cj, BackendReleaseTTL); err != nil {
+		return nil, err
+	}
+
+	expiresAt, _ := time.Parse(time.RFC3339, cj.Annotations[AnnotationExpiresAt])
+	u := cronJobUninstallOptions(cj)
+	spec := v1alpha1.ReleaseTTLSpec{
+		Release:          OriginalLabelValue(cj, LabelRelease),
+		ReleaseNamespace: OriginalLabelValue(cj, LabelReleaseNamespace),
+		ExpiresAt:        metav1.NewTime(expiresAt),
+		DeleteNamespace:  cj.Labels[LabelDeleteNamespace] == "true",
+		Uninstall: v1alpha1.Uninstall{
+			Wait:        u.Wait,
+			KeepHistory: u.KeepHistory,
+			NoHooks:     u.NoHooks,
+			Cascade:     u.Cascade,
+		},
+	}
+	if driver := cronJobDriver(cj); driver != "secrets" {
+		spec.Driver = driver
+	}
+	if u.Timeout > 0 {
+		spec.Uninstall.Timeout = &metav1.Duration{Duration: u.Timeout}
+	}
+
+	rt := &v1alpha1.ReleaseTTL{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: v1alpha1.Kind},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            cj.Name,
+			Namespace:       cj.Namespace,
+			ResourceVersion: cj.ResourceVersion,
+			OwnerReferences: cj.OwnerReferences,
+		},
+		Spec: spec,
+	}
+
+	built, err := releaseTTLCronJob(rt)
+	if err != nil {
+		return nil, err
+	}
+	rt.Labels = withoutDerived(cj.Labels, built.Labels)
+	rt.Annotations = withoutDerived(cj.Annotations, built.Annotations)
+
+	return rt, nil
+}
+
+// withoutDerived returns the entries of m that derived does not hold.
+func withoutDerived(m, derived map[string]string) map[string]string {
+	out := maps.Clone(m)
+	maps.DeleteFunc(out, func(k, v string) bool {
+		d, ok := derived[k]
+		return ok && d == v
+	})
+	if len(out) == 0 {
+		return nil
+	}
+
+	return out
+}
+
+// releaseTTLCronJob returns the TTL CronJob a ReleaseTTL keeps, built from
+// its spec with the labels and annotations of the ReleaseTTL added.
+func releaseTTLCronJob(rt *v1alpha1.ReleaseTTL) (*batchv1.CronJob, error) {
+	expiresAt := rt.Spec.ExpiresAt.Time
+	opts := CronJobOptions{
+		ReleaseName:      rt.Spec.Release,
+		ReleaseNamespace: cmp.Or(rt.Spec.ReleaseNamespace, rt.Namespace),
+		CronjobNamespace: rt.Namespace,
+		Schedule:         TimeToCronSchedule(expiresAt.Local()),
+		ExpiresAt:        expiresAt,
+		DeleteNamespace:  rt.Spec.DeleteNamespace,
+		Driver:           rt.Spec.Driver,
+		Uninstall: UninstallOptions{
+			Wait:        rt.Spec.Uninstall.Wait,
+			KeepHistory: rt.Spec.Uninstall.KeepHistory,
+			NoHooks:     rt.Spec.Uninstall.NoHooks,
+			Cascade:     rt.Spec.Uninstall.Cascade,
+		},
+		Name: rt.Name,
+	}
+	if rt.Spec.Uninstall.Timeout != nil {
+		opts.Uninstall.Timeout = rt.Spec.Uninstall.Timeout.Duration
+	}
+
+	if opts.ReleaseName == "" || expiresAt.IsZero() {
+		return nil, fmt.Errorf("ReleaseTTL %s/%s needs spec.release and spec.expiresAt", rt.Namespace, rt.Name)
+	}
+
+	cj, err := BuildCronJob(opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ReleaseTTL %s/%s: %w", rt.Namespace, rt.Name, err)
+	}
+
+	meta := *rt.ObjectMeta.DeepCopy()
+	meta.ManagedFields = nil
+	meta.Labels = merged(meta.Labels, cj.Labels)
+	meta.Annotations = merged(meta.Annotations, cj.Annotations)
+	cj.ObjectMeta = meta
+
+	return cj, nil
+}
+
+// merged returns the entries of m and then of over.
+func merged(m, over map[string]string) map[string]string {
+	out := maps.Clone(m)
+	if out == nil {
+		out = make(map[string]string, len(over))
+	}
+	maps.Copy(out, over)
+
+	return out
+}
+
+// releaseTTLCronJobs serves the TTLs of a namespace from its ReleaseTTLs.
+// ReleaseTTLs written by hand may carry none of the labels of a TTL, so
+// label selectors are matched against the CronJobs they keep.
+type releaseTTLCronJobs struct {
+	client dynamic.ResourceInterface
+}
+
+var _ typedbatchv1.CronJobInterface = &releaseTTLCronJobs{}
+
+func (c *releaseTTLCronJobs) Create(ctx context.Context, cj *batchv1.CronJob, opts metav1.CreateOptions) (*batchv1.CronJob, error) {
+	obj, err := releaseTTLObject(cj)
+	if err != nil {
+		return nil, err
+	}
+	obj.SetResourceVersion("")
+
+	return fromReleaseTTL(c.client.Create(ctx, obj, opts))
+}
+
+// Update replaces a ReleaseTTL. Custom resources are only updated at a
+// resource version, so an update without one is made at the current one.
+func (c *releaseTTLCronJobs) Update(ctx context.Context, cj *batchv1.CronJob, opts metav1.UpdateOptions) (*batchv1.CronJob, error) {
+	obj, err := releaseTTLObject(cj)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj.GetResourceVersion() == "" {
+		current, err := c.client.Get(ctx, cj.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		obj.SetResourceVersion(current.GetResourceVersion())
+	}
+
+	return fromReleaseTTL(c.client.Update(ctx, obj, opts))
+}
+
+func (c *releaseTTLCronJobs) UpdateStatus(context.Context, *batchv1.CronJob, metav1.UpdateOptions) (*batchv1.CronJob, error) {
+	return nil, errors.NewMethodNotSupported(v1alpha1.Resource.GroupResource(), "update status of")
+}
+
+func (c *releaseTTLCronJobs) Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error {
+	return c.client.Delete(ctx, name, opts)
+}
+
+func (c *releaseTTLCronJobs) DeleteCollection(ctx context.Context, opts metav1.DeleteOptions, listOpts metav1.ListOptions) error {
+	list, err := c.List(ctx, listOpts)
+	if err != nil {
+		return err
+	}
+
+	for _, cj := range list.Items {
+		if err := c.client.Delete(ctx, cj.Name, opts); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *releaseTTLCronJobs) Get(ctx context.Context, name string, opts metav1.GetOptions) (*batchv1.CronJob, error) {
+	return fromReleaseTTL(c.client.Get(ctx, name, opts))
+}
+
+func (c *releaseTTLCronJobs) List(ctx context.Context, opts metav1.ListOptions) (*batchv1.CronJobList, error) {
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	opts.LabelSelector = ""
+
+	list, err := c.client.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &batchv1.CronJobList{}
+	out.ResourceVersion = list.GetResourceVersion()
+	out.Continue = list.GetContinue()
+	for i := range list.Items {
+		cj, err := fromReleaseTTL(&list.Items[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		if selector.Matches(labels.Set(cj.Labels)) {
+			out.Items = append(out.Items, *cj)
+		}
+	}
+
+	return out, nil
+}
+
+// Watch converts the ReleaseTTLs of each event, dropping those that fail
+// to or do not match the label selector.
+func (c *releaseTTLCronJobs) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	opts.LabelSelector = ""
+
+	w, err := c.client.Watch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return watch.Filter(w, func(e watch.Event) (watch.Event, bool) {
+		obj, ok := e.Object.(*unstructured.Unstructured)
+		if !ok {
+			return e, true
+		}
+
+		// Bookmarks only carry a resource version, and end the initial
+		// list of a watch-list
+		if e.Type == watch.Bookmark {
+			cj := &batchv1.CronJob{}
+			cj.ResourceVersion = obj.GetResourceVersion()
+			cj.Annotations = obj.GetAnnotations()
+			e.Object = cj
+			return e, true
+		}
+
+		cj, err := fromReleaseTTL(obj, nil)
+		if err != nil || !selector.Matches(labels.Set(cj.Labels)) {
+			return e, false
+		}
+		e.Object = cj
+
+		return e, true
+	}), nil
+}
+
+// Patch patches a ReleaseTTL, so only patches of the metadata, which
+// ReleaseTTLs and CronJobs share, are supported. Apply patches go through
+// Apply.
+func (c *releaseTTLCronJobs) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*batchv1.CronJob, error) {
+	if pt == types.ApplyPatchType {
+		return c.apply(ctx, data, opts.FieldManager, opts.DryRun)
+	}
+
+	return fromReleaseTTL(c.client.Patch(ctx, name, pt, data, opts, subresources...))
+}
+
+// Apply creates or updates a ReleaseTTL from a CronJob apply
+// configuration, which must hold the whole CronJob.
+func (c *releaseTTLCronJobs) Apply(ctx context.Context, cj *batchv1ac.CronJobApplyConfiguration, opts metav1.ApplyOptions) (*batchv1.CronJob, error) {
+	data, err := json.Marshal(cj)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.apply(ctx, data, opts.FieldManager, opts.DryRun)
+}
+
+func (c *releaseTTLCronJobs) ApplyStatus(context.Context, *batchv1ac.CronJobApplyConfiguration, metav1.ApplyOptions) (*batchv1.CronJob, error) {
+	return nil, errors.NewMethodNotSupported(v1alpha1.Resource.GroupResource(), "apply status of")
+}
+
+func (c *releaseTTLCronJobs) apply(ctx context.Context, data []byte, fieldManager string, dryRun []string) (*batchv1.CronJob, error) {
+	var cj batchv1.CronJob
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return nil, fmt.Errorf("failed to read CronJob: %w", err)
+	}
+	if cj.Name == "" {
+		return nil, fmt.Errorf("cronJob.Name must be provided to Apply")
+	}
+
+	if _, err := c.client.Get(ctx, cj.Name, metav1.GetOptions{}); errors.IsNotFound(err) {
+		return c.Create(ctx, &cj, metav1.CreateOptions{DryRun: dryRun, FieldManager: fieldManager})
+	} else if err != nil {
+		return nil, err
+	}
+
+	return c.Update(ctx, &cj, metav1.UpdateOptions{DryRun: dryRun, FieldManager: fieldManager})
+}
+
+// releaseTTLObject returns the ReleaseTTL keeping cj as an unstructured
+// object.
+func releaseTTLObject(cj *batchv1.CronJob) (*unstructured.Unstructured, error) {
+	rt, err := ReleaseTTLOf(cj)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(rt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert ReleaseTTL %s: %w", rt.Name, err)
+	}
+
+	return &unstructured.Unstructured{Object: obj}, nil
+}
+
+// fromReleaseTTL converts the result of a ReleaseTTL call.
+func fromReleaseTTL(obj *unstructured.Unstructured, err error) (*batchv1.CronJob, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	var rt v1alpha1.ReleaseTTL
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &rt); err != nil {
+		return nil, fmt.Errorf("failed to read ReleaseTTL %s: %w", obj.GetName(), err)
+	}
+
+	return releaseTTLCronJob(&rt)
+}
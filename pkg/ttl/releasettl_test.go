@@ -0,0 +1,205 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"helm.sh/helm/v3/pkg/action"
+
+	"github.com/josegonzalez/helm-ttl/pkg/api/v1alpha1"
+)
+
+func newReleaseTTLClient() *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		v1alpha1.Resource: "ReleaseTTLList",
+	})
+}
+
+func TestReleaseTTLOf(t *testing.T) {
+	opts := CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "staging",
+		CronjobNamespace: "ops",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		ExpiresAt:        time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		Driver:           "configmap",
+		Uninstall:        UninstallOptions{Wait: true, Timeout: 10 * time.Minute, Cascade: "foreground"},
+	}
+	cj, err := BuildCronJob(opts)
+	require.NoError(t, err)
+	cj.Labels["team"] = "payments"
+
+	rt, err := ReleaseTTLOf(cj)
+	require.NoError(t, err)
+	assert.Equal(t, "myapp-80081014-ttl", rt.Name)
+	assert.Equal(t, "ops", rt.Namespace)
+	assert.Equal(t, v1alpha1.Kind, rt.Kind)
+	assert.Equal(t, "myapp", rt.Spec.Release)
+	assert.Equal(t, "staging", rt.Spec.ReleaseNamespace)
+	assert.True(t, rt.Spec.ExpiresAt.Equal(&metav1.Time{Time: opts.ExpiresAt}))
+	assert.Equal(t, "configmap", rt.Spec.Driver)
+	assert.Equal(t, v1alpha1.Uninstall{Wait: true, Timeout: &metav1.Duration{Duration: 10 * time.Minute}, Cascade: "foreground"}, rt.Spec.Uninstall)
+	// Only the labels the spec does not set again are kept
+	assert.Equal(t, map[string]string{"team": "payments"}, rt.Labels)
+	assert.Empty(t, rt.Annotations)
+
+	got, err := releaseTTLCronJob(rt)
+	require.NoError(t, err)
+	assert.Equal(t, cj.Labels, got.Labels)
+	assert.Equal(t, cj.Annotations[AnnotationExpiresAt], got.Annotations[AnnotationExpiresAt])
+	assert.Equal(t, cronJobUninstallOptions(cj), cronJobUninstallOptions(got))
+	assert.Equal(t, "configmap", cronJobDriver(got))
+
+	t.Run("release namespace defaults to its namespace", func(t *testing.T) {
+		rt := &v1alpha1.ReleaseTTL{
+			ObjectMeta: metav1.ObjectMeta{Name: "preview", Namespace: "staging"},
+			Spec:       v1alpha1.ReleaseTTLSpec{Release: "myapp", ExpiresAt: metav1.NewTime(opts.ExpiresAt)},
+		}
+
+		cj, err := releaseTTLCronJob(rt)
+		require.NoError(t, err)
+		assert.Equal(t, "preview", cj.Name)
+		assert.Equal(t, "staging", cj.Labels[LabelReleaseNamespace])
+		assert.Equal(t, LabelManagedByValue, cj.Labels[LabelManagedBy])
+	})
+
+	t.Run("spec required", func(t *testing.T) {
+		_, err := releaseTTLCronJob(&v1alpha1.ReleaseTTL{ObjectMeta: metav1.ObjectMeta{Name: "preview", Namespace: "staging"}})
+		assert.EqualError(t, err, "ReleaseTTL staging/preview needs spec.release and spec.expiresAt")
+	})
+
+	t.Run("abort window unsupported", func(t *testing.T) {
+		opts := opts
+		opts.AbortWindow = time.Minute
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		_, err = ReleaseTTLOf(cj)
+		assert.ErrorContains(t, err, "need the cronjob or job-sleep backend")
+	})
+}
+
+func TestReleaseTTLBackend(t *testing.T) {
+	ctx := context.Background()
+	setOpts := SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "2d",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	}
+	get := func(t *testing.T, dyn *dynamicfake.FakeDynamicClient, name string) (*unstructured.Unstructured, error) {
+		t.Helper()
+		return dyn.Resource(v1alpha1.Resource).Namespace("default").Get(ctx, name, metav1.GetOptions{})
+	}
+	setup := func(t *testing.T) (*action.Configuration, *fake.Clientset, *dynamicfake.FakeDynamicClient, kubernetes.Interface) {
+		t.Helper()
+
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		dyn := newReleaseTTLClient()
+		wrapped := WithReleaseTTLs(client, dyn)
+
+		_, err := SetTTL(ctx, cfg, wrapped, setOpts)
+		require.NoError(t, err)
+
+		return cfg, client, dyn, wrapped
+	}
+
+	t.Run("set creates a release ttl", func(t *testing.T) {
+		_, client, dyn, _ := setup(t)
+
+		cronJobs, err := client.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, cronJobs.Items)
+
+		obj, err := get(t, dyn, "myapp-4a0c226a-ttl")
+		require.NoError(t, err)
+		release, _, _ := unstructured.NestedString(obj.Object, "spec", "release")
+		assert.Equal(t, "myapp", release)
+		expiresAt, _, _ := unstructured.NestedString(obj.Object, "spec", "expiresAt")
+		assert.NotEmpty(t, expiresAt)
+
+		// No Job runs, so no ServiceAccount or RBAC is created
+		sas, err := client.CoreV1().ServiceAccounts("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, sas.Items)
+		roles, err := client.RbacV1().Roles("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, roles.Items)
+	})
+
+	t.Run("get and list a hand-written release ttl", func(t *testing.T) {
+		_, _, dyn, wrapped := setup(t)
+		_, err := dyn.Resource(v1alpha1.Resource).Namespace("default").Create(ctx, &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": v1alpha1.SchemeGroupVersion.String(),
+			"kind":       v1alpha1.Kind,
+			"metadata":   map[string]any{"name": "preview", "namespace": "default"},
+			"spec":       map[string]any{"release": "preview", "expiresAt": "2030-01-01T00:00:00Z"},
+		}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		info, err := GetTTL(ctx, wrapped, "preview", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "preview", info.ReleaseName)
+
+		infos, err := ListTTLs(ctx, wrapped, "default", "")
+		require.NoError(t, err)
+		assert.Len(t, infos, 2)
+	})
+
+	t.Run("extend and unset", func(t *testing.T) {
+		_, _, dyn, wrapped := setup(t)
+		before, err := get(t, dyn, "myapp-4a0c226a-ttl")
+		require.NoError(t, err)
+
+		_, err = ExtendTTL(ctx, wrapped, ExtendTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", By: 24 * time.Hour})
+		require.NoError(t, err)
+
+		after, err := get(t, dyn, "myapp-4a0c226a-ttl")
+		require.NoError(t, err)
+		beforeExpiry, _, _ := unstructured.NestedString(before.Object, "spec", "expiresAt")
+		afterExpiry, _, _ := unstructured.NestedString(after.Object, "spec", "expiresAt")
+		assert.NotEqual(t, beforeExpiry, afterExpiry)
+
+		require.NoError(t, UnsetTTL(ctx, wrapped, "myapp", "default", "default"))
+		_, err = get(t, dyn, "myapp-4a0c226a-ttl")
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("expire uninstalls the release", func(t *testing.T) {
+		cfg, _, dyn, wrapped := setup(t)
+		cj, err := wrapped.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+
+		err = ExpireTTL(ctx, wrapped, cj, func(string, string) (*action.Configuration, error) {
+			return cfg, nil
+		})
+		require.NoError(t, err)
+
+		_, err = cfg.Releases.Deployed("myapp")
+		assert.Error(t, err)
+
+		_, err = get(t, dyn, "myapp-4a0c226a-ttl")
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("backend needs a dynamic client", func(t *testing.T) {
+		_, err := WithBackend(fake.NewClientset(), BackendReleaseTTL)
+		assert.EqualError(t, err, "the releasettl backend needs a dynamic client; use WithReleaseTTLs")
+	})
+}
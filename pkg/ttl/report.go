@@ -0,0 +1,215 @@
+package ttl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultCPUMonthlyRate and DefaultMemoryMonthlyRate are what a CPU
+	// core and a GiB of memory requested for a month cost, roughly at
+	// on-demand cloud prices, unless other rates are given.
+	DefaultCPUMonthlyRate    = 24.0
+	DefaultMemoryMonthlyRate = 3.0
+
+	// instanceLabel is the standard label Helm charts put the release
+	// name in, which the workloads of a release are found by.
+	instanceLabel = "app.kubernetes.io/instance"
+
+	// bytesPerGiB converts memory requests to GiB.
+	bytesPerGiB = 1 << 30
+)
+
+// ReportOptions selects the TTLs ReportCosts covers and the rates it
+// prices their requests at.
+type ReportOptions struct {
+	// CronjobNamespace and ReleaseNamespace are as for ListTTLs; empty
+	// means all namespaces.
+	CronjobNamespace string
+	ReleaseNamespace string
+	// CPURate is the monthly cost of a CPU core, and MemoryRate of a GiB
+	// of memory. They default to DefaultCPUMonthlyRate and
+	// DefaultMemoryMonthlyRate.
+	CPURate    float64
+	MemoryRate float64
+}
+
+// ReleaseCost is the estimated cost of the workloads of a release with a
+// TTL.
+type ReleaseCost struct {
+	ReleaseName      string `json:"release_name" yaml:"release_name"`
+	ReleaseNamespace string `json:"release_namespace" yaml:"release_namespace"`
+	ScheduledDate    string `json:"scheduled_date" yaml:"scheduled_date"`
+	Remaining        string `json:"remaining" yaml:"remaining"`
+	// Workloads counts the Deployments, StatefulSets and DaemonSets of
+	// the release.
+	Workloads int `json:"workloads" yaml:"workloads"`
+	// CPURequests and MemoryRequests are the requests of all their pods,
+	// as quantities such as 1500m and 3Gi.
+	CPURequests    string `json:"cpu_requests" yaml:"cpu_requests"`
+	MemoryRequests string `json:"memory_requests" yaml:"memory_requests"`
+	// MonthlyCost is what the requests cost a month at the report rates,
+	// and what removing the release saves.
+	MonthlyCost float64 `json:"monthly_cost" yaml:"monthly_cost"`
+}
+
+// CostReport is the estimated cost of the releases with a TTL.
+type CostReport struct {
+	CPURate    float64       `json:"cpu_rate" yaml:"cpu_rate"`
+	MemoryRate float64       `json:"memory_rate" yaml:"memory_rate"`
+	Releases   []ReleaseCost `json:"releases" yaml:"releases"`
+	// TotalMonthlyCost is the monthly cost of all the releases, saved
+	// every month once their TTLs fire.
+	TotalMonthlyCost float64 `json:"total_monthly_cost" yaml:"total_monthly_cost"`
+}
+
+// ReportCosts estimates the monthly cost of each release with a TTL from
+// the resource requests of its workloads: the Deployments, StatefulSets
+// and DaemonSets labeled app.kubernetes.io/instance=RELEASE in the release
+// namespace, times their replicas. A release scaled to zero costs nothing.
+func ReportCosts(ctx context.Context, client kubernetes.Interface, opts ReportOptions) (*CostReport, error) {
+	if opts.CPURate < 0 || opts.MemoryRate < 0 {
+		return nil, fmt.Errorf("invalid rates: must not be negative")
+	}
+
+	report := &CostReport{
+		CPURate:    opts.CPURate,
+		MemoryRate: opts.MemoryRate,
+		Releases:   []ReleaseCost{},
+	}
+	if report.CPURate == 0 {
+		report.CPURate = DefaultCPUMonthlyRate
+	}
+	if report.MemoryRate == 0 {
+		report.MemoryRate = DefaultMemoryMonthlyRate
+	}
+
+	ttls, err := listTTLs(ctx, client, opts.CronjobNamespace, opts.ReleaseNamespace, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range ttls {
+		workloads, cpu, memory, err := releaseRequests(ctx, client, info.ReleaseName, info.ReleaseNamespace)
+		if err != nil {
+			return nil, err
+		}
+
+		cost := float64(cpu)/1000*report.CPURate + float64(memory)/bytesPerGiB*report.MemoryRate
+		cost = math.Round(cost*100) / 100
+		report.Releases = append(report.Releases, ReleaseCost{
+			ReleaseName:      info.ReleaseName,
+			ReleaseNamespace: info.ReleaseNamespace,
+			ScheduledDate:    info.ScheduledDate,
+			Remaining:        info.Remaining,
+			Workloads:        workloads,
+			CPURequests:      resource.NewMilliQuantity(cpu, resource.DecimalSI).String(),
+			MemoryRequests:   resource.NewQuantity(memory, resource.BinarySI).String(),
+			MonthlyCost:      cost,
+		})
+		report.TotalMonthlyCost += cost
+	}
+	report.TotalMonthlyCost = math.Round(report.TotalMonthlyCost*100) / 100
+
+	return report, nil
+}
+
+// releaseRequests returns the number of workloads of a release and the
+// CPU, in millicores, and memory, in bytes, all their pods request.
+func releaseRequests(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace string) (workloads int, cpu, memory int64, err error) {
+	opts := metav1.ListOptions{LabelSelector: labels.Set{instanceLabel: releaseName}.String()}
+	add := func(spec corev1.PodSpec, replicas int64) {
+		workloads++
+		c, m := podRequests(spec)
+		cpu += c * replicas
+		memory += m * replicas
+	}
+
+	deployments, err := client.AppsV1().Deployments(releaseNamespace).List(ctx, opts)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to list Deployments of release %q: %w", releaseName, err)
+	}
+	for _, d := range deployments.Items {
+		add(d.Spec.Template.Spec, int64(replicas(d.Spec.Replicas)))
+	}
+
+	statefulSets, err := client.AppsV1().StatefulSets(releaseNamespace).List(ctx, opts)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to list StatefulSets of release %q: %w", releaseName, err)
+	}
+	for _, s := range statefulSets.Items {
+		add(s.Spec.Template.Spec, int64(replicas(s.Spec.Replicas)))
+	}
+
+	daemonSets, err := client.AppsV1().DaemonSets(releaseNamespace).List(ctx, opts)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to list DaemonSets of release %q: %w", releaseName, err)
+	}
+	for _, d := range daemonSets.Items {
+		add(d.Spec.Template.Spec, int64(d.Status.DesiredNumberScheduled))
+	}
+
+	return workloads, cpu, memory, nil
+}
+
+// replicas returns the replicas of a Deployment or StatefulSet, which
+// default to 1.
+func replicas(r *int32) int32 {
+	if r == nil {
+		return 1
+	}
+
+	return *r
+}
+
+// podRequests returns the CPU, in millicores, and memory, in bytes, a pod
+// requests: the sum of its containers, or its largest init container when
+// that is more, as the scheduler counts them.
+func podRequests(spec corev1.PodSpec) (cpu, memory int64) {
+	for _, c := range spec.Containers {
+		cpu += c.Resources.Requests.Cpu().MilliValue()
+		memory += c.Resources.Requests.Memory().Value()
+	}
+
+	for _, c := range spec.InitContainers {
+		cpu = max(cpu, c.Resources.Requests.Cpu().MilliValue())
+		memory = max(memory, c.Resources.Requests.Memory().Value())
+	}
+
+	return cpu, memory
+}
+
+// FormatCostReport formats a CostReport in the specified format. The text
+// table ends with the total.
+func FormatCostReport(report *CostReport, format string) (string, error) {
+	if format != "text" {
+		return formatStructured(report, format)
+	}
+
+	if len(report.Releases) == 0 {
+		return "No TTLs found.\n", nil
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "RELEASE\tNAMESPACE\tEXPIRES\tWORKLOADS\tCPU\tMEMORY\tMONTHLY COST")
+	for _, r := range report.Releases {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%.2f\n",
+			r.ReleaseName, r.ReleaseNamespace, r.ScheduledDate, r.Workloads, r.CPURequests, r.MemoryRequests, r.MonthlyCost)
+	}
+	_ = w.Flush()
+
+	_, _ = fmt.Fprintf(&buf, "\nTotal: %.2f a month, saved once these TTLs expire (at %.2f per CPU and %.2f per GiB of memory a month)\n",
+		report.TotalMonthlyCost, report.CPURate, report.MemoryRate)
+
+	return buf.String(), nil
+}
@@ -0,0 +1,129 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testPodSpec(cpu, memory string) corev1.PodSpec {
+	return corev1.PodSpec{Containers: []corev1.Container{{
+		Name: "app",
+		Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}},
+	}}}
+}
+
+func TestReportCosts(t *testing.T) {
+	ctx := context.Background()
+	instance := map[string]string{instanceLabel: "cart"}
+	two := int32(2)
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "cart", Namespace: "default", Labels: instance},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &two,
+			Template: corev1.PodTemplateSpec{Spec: testPodSpec("500m", "1Gi")},
+		},
+	}
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "cart-db", Namespace: "default", Labels: instance},
+		Spec:       appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: testPodSpec("1", "2Gi")}},
+	}
+	other := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "default", Labels: map[string]string{instanceLabel: "api"}},
+		Spec:       appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: testPodSpec("4", "8Gi")}},
+	}
+
+	t.Run("prices the requests of the release", func(t *testing.T) {
+		client := fake.NewClientset(buildTestCronJob(t, "cart", "default", "default", false), deployment, statefulSet, other)
+
+		report, err := ReportCosts(ctx, client, ReportOptions{CronjobNamespace: "default", ReleaseNamespace: "default"})
+		require.NoError(t, err)
+		assert.Equal(t, DefaultCPUMonthlyRate, report.CPURate)
+		require.Len(t, report.Releases, 1)
+
+		cost := report.Releases[0]
+		assert.Equal(t, "cart", cost.ReleaseName)
+		assert.Equal(t, 2, cost.Workloads)
+		assert.Equal(t, "2", cost.CPURequests)
+		assert.Equal(t, "4Gi", cost.MemoryRequests)
+		assert.InDelta(t, 2*24.0+4*3.0, cost.MonthlyCost, 0.001)
+		assert.InDelta(t, cost.MonthlyCost, report.TotalMonthlyCost, 0.001)
+	})
+
+	t.Run("custom rates", func(t *testing.T) {
+		client := fake.NewClientset(buildTestCronJob(t, "cart", "default", "default", false), deployment)
+
+		report, err := ReportCosts(ctx, client, ReportOptions{CPURate: 10, MemoryRate: 0.5})
+		require.NoError(t, err)
+		require.Len(t, report.Releases, 1)
+		assert.InDelta(t, 1*10.0+2*0.5, report.Releases[0].MonthlyCost, 0.001)
+	})
+
+	t.Run("release without workloads", func(t *testing.T) {
+		client := fake.NewClientset(buildTestCronJob(t, "cart", "default", "default", false))
+
+		report, err := ReportCosts(ctx, client, ReportOptions{})
+		require.NoError(t, err)
+		require.Len(t, report.Releases, 1)
+		assert.Equal(t, "0", report.Releases[0].CPURequests)
+		assert.Zero(t, report.TotalMonthlyCost)
+	})
+
+	t.Run("negative rate", func(t *testing.T) {
+		_, err := ReportCosts(ctx, fake.NewClientset(), ReportOptions{CPURate: -1})
+		assert.ErrorContains(t, err, "invalid rates")
+	})
+}
+
+func TestPodRequests(t *testing.T) {
+	spec := testPodSpec("250m", "256Mi")
+	spec.Containers = append(spec.Containers, testPodSpec("250m", "256Mi").Containers...)
+	spec.InitContainers = testPodSpec("1", "128Mi").Containers
+
+	cpu, memory := podRequests(spec)
+	assert.Equal(t, int64(1000), cpu)
+	assert.Equal(t, int64(512<<20), memory)
+}
+
+func TestFormatCostReport(t *testing.T) {
+	report := &CostReport{
+		CPURate:    24,
+		MemoryRate: 3,
+		Releases: []ReleaseCost{{
+			ReleaseName:      "cart",
+			ReleaseNamespace: "default",
+			ScheduledDate:    "2025-03-15T14:30:00Z",
+			Workloads:        2,
+			CPURequests:      "2",
+			MemoryRequests:   "4Gi",
+			MonthlyCost:      60,
+		}},
+		TotalMonthlyCost: 60,
+	}
+
+	out, err := FormatCostReport(report, "text")
+	require.NoError(t, err)
+	assert.Contains(t, out, "MONTHLY COST")
+	assert.Contains(t, out, "60.00")
+	assert.Contains(t, out, "Total: 60.00 a month")
+
+	out, err = FormatCostReport(report, "json")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"total_monthly_cost": 60`)
+	assert.Contains(t, out, `"memory_requests": "4Gi"`)
+
+	out, err = FormatCostReport(&CostReport{}, "text")
+	require.NoError(t, err)
+	assert.Equal(t, "No TTLs found.\n", out)
+}
@@ -0,0 +1,105 @@
+package ttl
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultBackoffLimit is how many times a failed uninstall Job is
+	// retried, so a transient API error at expiry does not strand the
+	// release.
+	DefaultBackoffLimit int32 = 3
+	// DefaultActiveDeadlineSeconds bounds how long the uninstall Job may
+	// run, retries included, on top of the uninstall timeout, the
+	// namespace delete delay and the two-phase grace period.
+	DefaultActiveDeadlineSeconds int64 = 3600
+	// DefaultStartingDeadlineSeconds is how late the uninstall Job may
+	// still start when the CronJob controller missed the schedule, e.g.
+	// during a control plane upgrade.
+	DefaultStartingDeadlineSeconds int64 = 86400
+	// DefaultFailedJobsHistoryLimit is how many failed uninstall Jobs the
+	// CronJob keeps, so a TTL that did not clean up can be debugged with
+	// get --show-last-run.
+	DefaultFailedJobsHistoryLimit int32 = 1
+	// minStartingDeadlineSeconds is the CronJob controller's resolution;
+	// shorter deadlines may never be met.
+	minStartingDeadlineSeconds int64 = 10
+)
+
+// JobOptions controls how the Job a TTL CronJob starts is retried, how
+// late and how long it may run, and how many failed Jobs are kept. Nil
+// fields take their defaults.
+type JobOptions struct {
+	BackoffLimit            *int32
+	ActiveDeadlineSeconds   *int64
+	StartingDeadlineSeconds *int64
+	FailedHistoryLimit      *int32
+}
+
+// Validate checks the Job options against the time the Job needs: the
+// active deadline must leave room for the uninstall timeout and waits, the
+// namespace delete delay plus the two-phase grace period.
+func (j JobOptions) Validate(uninstallTimeout, waits time.Duration) error {
+	if j.BackoffLimit != nil && *j.BackoffLimit < 0 {
+		return fmt.Errorf("invalid --backoff-limit %d: must not be negative", *j.BackoffLimit)
+	}
+
+	if j.ActiveDeadlineSeconds != nil {
+		needed := uninstallTimeout + waits
+		if *j.ActiveDeadlineSeconds <= 0 {
+			return fmt.Errorf("invalid --active-deadline-seconds %d: must be positive", *j.ActiveDeadlineSeconds)
+		}
+		if time.Duration(*j.ActiveDeadlineSeconds)*time.Second <= needed {
+			return fmt.Errorf("invalid --active-deadline-seconds %d: must exceed the uninstall timeout plus the namespace delete delay and two-phase grace (%s)", *j.ActiveDeadlineSeconds, needed)
+		}
+	}
+
+	if j.StartingDeadlineSeconds != nil && *j.StartingDeadlineSeconds < minStartingDeadlineSeconds {
+		return fmt.Errorf("invalid --starting-deadline-seconds %d: must be at least %d", *j.StartingDeadlineSeconds, minStartingDeadlineSeconds)
+	}
+
+	if j.FailedHistoryLimit != nil && *j.FailedHistoryLimit < 0 {
+		return fmt.Errorf("invalid --failed-history-limit %d: must not be negative", *j.FailedHistoryLimit)
+	}
+
+	return nil
+}
+
+// backoffLimit returns the retries of the Job.
+func (j JobOptions) backoffLimit() int32 {
+	if j.BackoffLimit != nil {
+		return *j.BackoffLimit
+	}
+
+	return DefaultBackoffLimit
+}
+
+// activeDeadlineSeconds returns how long the Job may run. The default
+// grows with the uninstall timeout and waits, the namespace delete delay
+// plus the two-phase grace period.
+func (j JobOptions) activeDeadlineSeconds(uninstallTimeout, waits time.Duration) int64 {
+	if j.ActiveDeadlineSeconds != nil {
+		return *j.ActiveDeadlineSeconds
+	}
+
+	return DefaultActiveDeadlineSeconds + int64((uninstallTimeout + waits).Seconds())
+}
+
+// startingDeadlineSeconds returns how late the Job may start.
+func (j JobOptions) startingDeadlineSeconds() int64 {
+	if j.StartingDeadlineSeconds != nil {
+		return *j.StartingDeadlineSeconds
+	}
+
+	return DefaultStartingDeadlineSeconds
+}
+
+// failedHistoryLimit returns how many failed Jobs the CronJob keeps.
+func (j JobOptions) failedHistoryLimit() int32 {
+	if j.FailedHistoryLimit != nil {
+		return *j.FailedHistoryLimit
+	}
+
+	return DefaultFailedJobsHistoryLimit
+}
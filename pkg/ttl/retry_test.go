@@ -0,0 +1,102 @@
+package ttl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func i32(v int32) *int32 { return &v }
+
+func i64(v int64) *int64 { return &v }
+
+func TestJobOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  JobOptions
+		delay time.Duration
+		err   string
+	}{
+		{name: "defaults"},
+		{name: "no retries", opts: JobOptions{BackoffLimit: i32(0)}},
+		{name: "all set", opts: JobOptions{BackoffLimit: i32(6), ActiveDeadlineSeconds: i64(1200), StartingDeadlineSeconds: i64(10)}},
+		{name: "negative backoff", opts: JobOptions{BackoffLimit: i32(-1)}, err: "invalid --backoff-limit -1: must not be negative"},
+		{name: "zero active deadline", opts: JobOptions{ActiveDeadlineSeconds: i64(0)}, err: "invalid --active-deadline-seconds 0: must be positive"},
+		{
+			name:  "active deadline shorter than the Job",
+			opts:  JobOptions{ActiveDeadlineSeconds: i64(900)},
+			delay: 10 * time.Minute,
+			err:   "invalid --active-deadline-seconds 900: must exceed the uninstall timeout plus the namespace delete delay and two-phase grace (15m0s)",
+		},
+		{name: "short starting deadline", opts: JobOptions{StartingDeadlineSeconds: i64(5)}, err: "invalid --starting-deadline-seconds 5: must be at least 10"},
+		{name: "no failed history", opts: JobOptions{FailedHistoryLimit: i32(0)}},
+		{name: "negative failed history", opts: JobOptions{FailedHistoryLimit: i32(-1)}, err: "invalid --failed-history-limit -1: must not be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate(5*time.Minute, tt.delay)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestBuildCronJob_JobOptions(t *testing.T) {
+	opts := CronJobOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "staging",
+		CronjobNamespace:     "ops",
+		Schedule:             "0 12 1 1 *",
+		ServiceAccount:       "default",
+		DeleteNamespace:      true,
+		Uninstall:            UninstallOptions{Timeout: 10 * time.Minute},
+		NamespaceDeleteDelay: 5 * time.Minute,
+	}
+
+	t.Run("default deadline covers the uninstall and delay", func(t *testing.T) {
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		assert.Equal(t, DefaultActiveDeadlineSeconds+900, *cj.Spec.JobTemplate.Spec.ActiveDeadlineSeconds)
+		assert.Equal(t, UninstallOptions{Timeout: 10 * time.Minute, IgnoreNotFound: true}.Command("myapp", "staging"), cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[0].Command)
+	})
+
+	t.Run("flags", func(t *testing.T) {
+		opts := opts
+		opts.Job = JobOptions{BackoffLimit: i32(5), ActiveDeadlineSeconds: i64(7200), StartingDeadlineSeconds: i64(600), FailedHistoryLimit: i32(3)}
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(5), *cj.Spec.JobTemplate.Spec.BackoffLimit)
+		assert.Equal(t, int64(7200), *cj.Spec.JobTemplate.Spec.ActiveDeadlineSeconds)
+		assert.Equal(t, int64(600), *cj.Spec.StartingDeadlineSeconds)
+		assert.Equal(t, int32(3), *cj.Spec.FailedJobsHistoryLimit)
+	})
+
+	t.Run("without retries helm keeps failing on a missing release", func(t *testing.T) {
+		opts := opts
+		opts.Job = JobOptions{BackoffLimit: i32(0)}
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(0), *cj.Spec.JobTemplate.Spec.BackoffLimit)
+		assert.Equal(t, UninstallOptions{Timeout: 10 * time.Minute}.Args("myapp", "staging"), cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[0].Command)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		opts := opts
+		opts.Job = JobOptions{ActiveDeadlineSeconds: i64(600)}
+
+		_, err := BuildCronJob(opts)
+		assert.ErrorContains(t, err, "invalid --active-deadline-seconds 600")
+	})
+}
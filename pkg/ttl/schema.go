@@ -0,0 +1,392 @@
+package ttl
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LabelSchemaVersion records the version of the labels and
+	// annotations helm-ttl wrote a resource with, so a later helm-ttl can
+	// tell which upgrades MigrateSchema still has to apply to it.
+	LabelSchemaVersion = "helm-ttl/schema-version"
+
+	// SchemaVersion is the version of the labels and annotations this
+	// helm-ttl writes. Resources without LabelSchemaVersion are version 1.
+	SchemaVersion = 2
+)
+
+// schemaVersionValue is the LabelSchemaVersion value of SchemaVersion.
+var schemaVersionValue = strconv.Itoa(SchemaVersion)
+
+// schemaMigrations[i] upgrades the labels and annotations of a resource
+// from schema version i+1 to i+2, returning the changes it made. A change
+// to the labels or naming of helm-ttl resources bumps SchemaVersion and
+// adds its upgrade here.
+var schemaMigrations = []func(obj metav1.Object, labels, annotations map[string]string, now time.Time) []string{
+	migrateSchemaV1,
+}
+
+// SchemaVersionOf returns the schema version a helm-ttl resource was
+// written with: 1 without LabelSchemaVersion, or 0 when the label is not
+// a version at all.
+func SchemaVersionOf(obj metav1.Object) int {
+	v, ok := obj.GetLabels()[LabelSchemaVersion]
+	if !ok {
+		return 1
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0
+	}
+
+	return n
+}
+
+// schemaWarnings warns that a resource was written by a newer helm-ttl,
+// whose labels this one may misread.
+func schemaWarnings(obj metav1.Object) []string {
+	if v := SchemaVersionOf(obj); v > SchemaVersion {
+		return []string{fmt.Sprintf("%s was written by a newer helm-ttl (schema version %d, this one reads up to %d) and may be misread: upgrade the plugin", obj.GetName(), v, SchemaVersion)}
+	}
+
+	return nil
+}
+
+// identityLabels returns labels without LabelSchemaVersion, for selecting
+// the resources of a TTL whatever version wrote them.
+func identityLabels(l map[string]string) labels.Set {
+	set := maps.Clone(l)
+	delete(set, LabelSchemaVersion)
+
+	return set
+}
+
+// migrateSchemaV1 upgrades a resource written before label values were
+// sanitized and their originals annotated, and before CronJobs recorded
+// their expiry: the original values move to annotations, the labels get
+// the sanitized values, and a CronJob gets helm-ttl/expires-at.
+func migrateSchemaV1(obj metav1.Object, labels, annotations map[string]string, now time.Time) []string {
+	var changes []string
+	for _, key := range []string{LabelRelease, LabelReleaseNamespace, LabelNamespace, LabelCronjobNamespace} {
+		value, ok := labels[key]
+		if !ok {
+			continue
+		}
+
+		original, annotated := annotations[key]
+		if !annotated {
+			original = value
+			annotations[key] = value
+			changes = append(changes, fmt.Sprintf("annotation %s=%s", key, value))
+		}
+
+		if sanitized := LabelValue(original); sanitized != value {
+			labels[key] = sanitized
+			changes = append(changes, fmt.Sprintf("label %s=%s", key, sanitized))
+		}
+	}
+
+	if cj, ok := obj.(*batchv1.CronJob); ok && annotations[AnnotationExpiresAt] == "" {
+		if expiresAt, _, err := resolveExpiry(cj, now); err == nil {
+			annotations[AnnotationExpiresAt] = FormatScheduledDate(expiresAt.UTC())
+			changes = append(changes, fmt.Sprintf("annotation %s=%s", AnnotationExpiresAt, annotations[AnnotationExpiresAt]))
+		}
+	}
+
+	return changes
+}
+
+// MigrateSchemaOptions selects the resources MigrateSchema upgrades.
+type MigrateSchemaOptions struct {
+	// Namespace is the namespace whose resources are upgraded; empty
+	// upgrades those of every namespace and the cluster-scoped RBAC.
+	Namespace string
+	// DryRun reports the upgrades without making them.
+	DryRun bool
+}
+
+// MigratedResource is a helm-ttl resource MigrateSchema upgraded, or found
+// too new to upgrade.
+type MigratedResource struct {
+	Kind        string   `json:"kind" yaml:"kind"`
+	Namespace   string   `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Name        string   `json:"name" yaml:"name"`
+	FromVersion int      `json:"from_version" yaml:"from_version"`
+	ToVersion   int      `json:"to_version" yaml:"to_version"`
+	Changes     []string `json:"changes" yaml:"changes"`
+	// Error is set when the resource could not be upgraded, including
+	// when a newer helm-ttl wrote it.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// MigrateResult is what MigrateSchema upgraded, or would with DryRun.
+type MigrateResult struct {
+	DryRun    bool               `json:"dry_run" yaml:"dry_run"`
+	Resources []MigratedResource `json:"resources" yaml:"resources"`
+}
+
+// schemaKind lists and patches the helm-ttl resources of one kind.
+type schemaKind struct {
+	kind          string
+	clusterScoped bool
+	list          func(ctx context.Context, client kubernetes.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error)
+	patch         func(ctx context.Context, client kubernetes.Interface, namespace, name string, data []byte) error
+}
+
+// listed returns pointers to items as metav1.Objects.
+func listed[T any, PT interface {
+	*T
+	metav1.Object
+}](items []T) []metav1.Object {
+	objs := make([]metav1.Object, len(items))
+	for i := range items {
+		objs[i] = PT(&items[i])
+	}
+
+	return objs
+}
+
+// schemaKinds are the kinds of the resources helm-ttl creates and labels,
+// in the order MigrateSchema upgrades them.
+var schemaKinds = []schemaKind{
+	{
+		kind: "CronJob",
+		list: func(ctx context.Context, client kubernetes.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := client.BatchV1().CronJobs(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return listed(list.Items), nil
+		},
+		patch: func(ctx context.Context, client kubernetes.Interface, namespace, name string, data []byte) error {
+			_, err := client.BatchV1().CronJobs(namespace).Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+			return err
+		},
+	},
+	{
+		kind: "ServiceAccount",
+		list: func(ctx context.Context, client kubernetes.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := client.CoreV1().ServiceAccounts(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return listed(list.Items), nil
+		},
+		patch: func(ctx context.Context, client kubernetes.Interface, namespace, name string, data []byte) error {
+			_, err := client.CoreV1().ServiceAccounts(namespace).Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+			return err
+		},
+	},
+	{
+		kind: "Role",
+		list: func(ctx context.Context, client kubernetes.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := client.RbacV1().Roles(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return listed(list.Items), nil
+		},
+		patch: func(ctx context.Context, client kubernetes.Interface, namespace, name string, data []byte) error {
+			_, err := client.RbacV1().Roles(namespace).Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+			return err
+		},
+	},
+	{
+		kind: "RoleBinding",
+		list: func(ctx context.Context, client kubernetes.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := client.RbacV1().RoleBindings(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return listed(list.Items), nil
+		},
+		patch: func(ctx context.Context, client kubernetes.Interface, namespace, name string, data []byte) error {
+			_, err := client.RbacV1().RoleBindings(namespace).Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+			return err
+		},
+	},
+	{
+		kind: "ConfigMap",
+		list: func(ctx context.Context, client kubernetes.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := client.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return listed(list.Items), nil
+		},
+		patch: func(ctx context.Context, client kubernetes.Interface, namespace, name string, data []byte) error {
+			_, err := client.CoreV1().ConfigMaps(namespace).Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+			return err
+		},
+	},
+	{
+		kind:          "ClusterRole",
+		clusterScoped: true,
+		list: func(ctx context.Context, client kubernetes.Interface, _ string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := client.RbacV1().ClusterRoles().List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return listed(list.Items), nil
+		},
+		patch: func(ctx context.Context, client kubernetes.Interface, _, name string, data []byte) error {
+			_, err := client.RbacV1().ClusterRoles().Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+			return err
+		},
+	},
+	{
+		kind:          "ClusterRoleBinding",
+		clusterScoped: true,
+		list: func(ctx context.Context, client kubernetes.Interface, _ string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := client.RbacV1().ClusterRoleBindings().List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return listed(list.Items), nil
+		},
+		patch: func(ctx context.Context, client kubernetes.Interface, _, name string, data []byte) error {
+			_, err := client.RbacV1().ClusterRoleBindings().Patch(ctx, name, types.MergePatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+			return err
+		},
+	},
+}
+
+// MigrateSchema upgrades the labels and annotations of the helm-ttl
+// resources written with an older schema version to SchemaVersion, so
+// lookups relying on the current schema find them. Only labels and
+// annotations change; names are kept, since the ServiceAccount a CronJob
+// runs as is named after it. A resource that fails, or that a newer
+// helm-ttl wrote, is reported in its result and the others are still
+// upgraded.
+func MigrateSchema(ctx context.Context, client kubernetes.Interface, opts MigrateSchemaOptions) (*MigrateResult, error) {
+	selector := labels.Set{LabelManagedBy: LabelManagedByValue}.String()
+	result := &MigrateResult{DryRun: opts.DryRun, Resources: []MigratedResource{}}
+	now := time.Now()
+
+	for _, k := range schemaKinds {
+		if k.clusterScoped && opts.Namespace != "" {
+			continue
+		}
+
+		objs, err := k.list(ctx, client, opts.Namespace, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %ss: %w", k.kind, err)
+		}
+		slices.SortFunc(objs, func(a, b metav1.Object) int {
+			if c := cmp.Compare(a.GetNamespace(), b.GetNamespace()); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.GetName(), b.GetName())
+		})
+
+		for _, obj := range objs {
+			from := SchemaVersionOf(obj)
+			if from == SchemaVersion {
+				continue
+			}
+
+			r := MigratedResource{Kind: k.kind, Namespace: obj.GetNamespace(), Name: obj.GetName(), FromVersion: from, ToVersion: SchemaVersion, Changes: []string{}}
+			if from > SchemaVersion || from == 0 {
+				r.ToVersion = from
+				r.Error = fmt.Sprintf("unknown schema version %q: written by a newer helm-ttl?", obj.GetLabels()[LabelSchemaVersion])
+				result.Resources = append(result.Resources, r)
+				continue
+			}
+
+			patch, changes, err := schemaPatch(obj, from, now)
+			r.Changes = changes
+			if err == nil && !opts.DryRun {
+				err = k.patch(ctx, client, obj.GetNamespace(), obj.GetName(), patch)
+			}
+			if err != nil {
+				r.Error = err.Error()
+			}
+			result.Resources = append(result.Resources, r)
+		}
+	}
+
+	return result, nil
+}
+
+// schemaPatch returns the merge patch upgrading the labels and annotations
+// of obj from schema version from to SchemaVersion, and the changes it
+// makes.
+func schemaPatch(obj metav1.Object, from int, now time.Time) ([]byte, []string, error) {
+	labels := maps.Clone(obj.GetLabels())
+	annotations := maps.Clone(obj.GetAnnotations())
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	var changes []string
+	for _, migrate := range schemaMigrations[from-1:] {
+		changes = append(changes, migrate(obj, labels, annotations, now)...)
+	}
+	labels[LabelSchemaVersion] = schemaVersionValue
+	changes = append(changes, fmt.Sprintf("label %s=%d", LabelSchemaVersion, SchemaVersion))
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"labels": labels, "annotations": annotations},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build patch: %w", err)
+	}
+
+	return patch, changes, nil
+}
+
+// FormatMigrateResult formats a MigrateResult in the specified format.
+func FormatMigrateResult(result *MigrateResult, format string) (string, error) {
+	if format != "text" {
+		return formatStructured(result, format)
+	}
+
+	if len(result.Resources) == 0 {
+		return fmt.Sprintf("All helm-ttl resources are at schema version %d.\n", SchemaVersion), nil
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tFROM\tTO\tSTATUS")
+
+	migrated := 0
+	for _, r := range result.Resources {
+		status := "migrated"
+		switch {
+		case r.Error != "":
+			status = "failed: " + r.Error
+		case result.DryRun:
+			status = "would migrate"
+			migrated++
+		default:
+			migrated++
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", r.Kind, cmp.Or(r.Namespace, "-"), r.Name, r.FromVersion, r.ToVersion, status)
+	}
+	_ = w.Flush()
+
+	verb := "Migrated"
+	if result.DryRun {
+		verb = "Would migrate"
+	}
+	_, _ = fmt.Fprintf(&buf, "\n%s %d of %d resources to schema version %d\n", verb, migrated, len(result.Resources), SchemaVersion)
+
+	return buf.String(), nil
+}
@@ -0,0 +1,171 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// v1Labels returns the labels helm-ttl wrote for a release TTL before
+// LabelSchemaVersion existed.
+func v1Labels(releaseName, releaseNamespace string) map[string]string {
+	return map[string]string{
+		LabelManagedBy:        LabelManagedByValue,
+		LabelRelease:          releaseName,
+		LabelReleaseNamespace: releaseNamespace,
+	}
+}
+
+func TestSchemaVersionOf(t *testing.T) {
+	meta := func(labels map[string]string) *metav1.ObjectMeta {
+		return &metav1.ObjectMeta{Labels: labels}
+	}
+
+	assert.Equal(t, 1, SchemaVersionOf(meta(v1Labels("myapp", "default"))))
+	assert.Equal(t, SchemaVersion, SchemaVersionOf(meta(releaseLabels("myapp", "default"))))
+	assert.Equal(t, 3, SchemaVersionOf(meta(map[string]string{LabelSchemaVersion: "3"})))
+	assert.Equal(t, 0, SchemaVersionOf(meta(map[string]string{LabelSchemaVersion: "next"})))
+}
+
+func TestMigrateSchema(t *testing.T) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+
+	newClient := func() *fake.Clientset {
+		newer := releaseLabels("other", "default")
+		newer[LabelSchemaVersion] = "3"
+
+		return fake.NewClientset(
+			&batchv1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: v1Labels("myapp", "default")},
+				Spec:       batchv1.CronJobSpec{Schedule: TimeToCronSchedule(expiresAt)},
+			},
+			&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: "myapp-default-ttl", Namespace: "default", Labels: v1Labels("myapp", "default")},
+			},
+			&rbacv1.Role{
+				ObjectMeta: metav1.ObjectMeta{Name: "current-ttl", Namespace: "default", Labels: releaseLabels("current", "default")},
+			},
+			&rbacv1.RoleBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "other-ttl", Namespace: "default", Labels: newer},
+			},
+			&rbacv1.ClusterRole{
+				ObjectMeta: metav1.ObjectMeta{Name: "helm-ttl-myapp-default", Labels: v1Labels("myapp", "default")},
+			},
+		)
+	}
+
+	t.Run("upgrades older resources", func(t *testing.T) {
+		client := newClient()
+
+		result, err := MigrateSchema(ctx, client, MigrateSchemaOptions{Namespace: "default"})
+		require.NoError(t, err)
+		require.Len(t, result.Resources, 3)
+
+		assert.Equal(t, "CronJob", result.Resources[0].Kind)
+		assert.Equal(t, 1, result.Resources[0].FromVersion)
+		assert.Equal(t, SchemaVersion, result.Resources[0].ToVersion)
+		assert.Empty(t, result.Resources[0].Error)
+		assert.Contains(t, result.Resources[0].Changes, "annotation helm-ttl/release=myapp")
+		assert.Equal(t, "ServiceAccount", result.Resources[1].Kind)
+
+		// Written by a newer helm-ttl: reported and left alone
+		assert.Equal(t, "RoleBinding", result.Resources[2].Kind)
+		assert.Equal(t, 3, result.Resources[2].FromVersion)
+		assert.Contains(t, result.Resources[2].Error, "written by a newer helm-ttl")
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "2", cj.Labels[LabelSchemaVersion])
+		assert.Equal(t, "myapp", cj.Annotations[LabelRelease])
+		assert.Equal(t, "default", cj.Annotations[LabelReleaseNamespace])
+		assert.Equal(t, FormatScheduledDate(expiresAt.UTC()), cj.Annotations[AnnotationExpiresAt])
+
+		sa, err := client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "2", sa.Labels[LabelSchemaVersion])
+
+		// The cluster-scoped RBAC is only migrated across all namespaces
+		cr, err := client.RbacV1().ClusterRoles().Get(ctx, "helm-ttl-myapp-default", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, cr.Labels, LabelSchemaVersion)
+
+		// Migrated resources are still found
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Empty(t, info.Warnings)
+
+		again, err := MigrateSchema(ctx, client, MigrateSchemaOptions{Namespace: "default"})
+		require.NoError(t, err)
+		assert.Len(t, again.Resources, 1)
+	})
+
+	t.Run("all namespaces", func(t *testing.T) {
+		client := newClient()
+
+		result, err := MigrateSchema(ctx, client, MigrateSchemaOptions{})
+		require.NoError(t, err)
+		require.Len(t, result.Resources, 4)
+		assert.Equal(t, "ClusterRole", result.Resources[3].Kind)
+
+		cr, err := client.RbacV1().ClusterRoles().Get(ctx, "helm-ttl-myapp-default", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "2", cr.Labels[LabelSchemaVersion])
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		client := newClient()
+
+		result, err := MigrateSchema(ctx, client, MigrateSchemaOptions{Namespace: "default", DryRun: true})
+		require.NoError(t, err)
+		assert.True(t, result.DryRun)
+		assert.Len(t, result.Resources, 3)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, cj.Labels, LabelSchemaVersion)
+		assert.Empty(t, cj.Annotations)
+	})
+}
+
+func TestTTLInfo_NewerSchema(t *testing.T) {
+	cj := buildTestCronJob(t, "myapp", "default", "default", false)
+	cj.Labels[LabelSchemaVersion] = "3"
+
+	info, err := CronJobInfo(cj, time.Now())
+	require.NoError(t, err)
+	require.Len(t, info.Warnings, 1)
+	assert.Contains(t, info.Warnings[0], "written by a newer helm-ttl (schema version 3, this one reads up to 2)")
+}
+
+func TestFormatMigrateResult(t *testing.T) {
+	result := &MigrateResult{
+		DryRun: true,
+		Resources: []MigratedResource{
+			{Kind: "CronJob", Namespace: "default", Name: "myapp-default-ttl", FromVersion: 1, ToVersion: 2},
+			{Kind: "ClusterRole", Name: "helm-ttl-myapp-default", FromVersion: 1, ToVersion: 2},
+		},
+	}
+
+	out, err := FormatMigrateResult(result, "text")
+	require.NoError(t, err)
+	assert.Contains(t, out, "KIND")
+	assert.Contains(t, out, "would migrate")
+	assert.Contains(t, out, "Would migrate 2 of 2 resources to schema version 2")
+
+	out, err = FormatMigrateResult(&MigrateResult{Resources: []MigratedResource{}}, "text")
+	require.NoError(t, err)
+	assert.Equal(t, "All helm-ttl resources are at schema version 2.\n", out)
+
+	out, err = FormatMigrateResult(result, "json")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"from_version": 1`)
+}
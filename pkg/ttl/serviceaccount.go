@@ -0,0 +1,30 @@
+package ttl
+
+import (
+	"maps"
+)
+
+// ParseServiceAccountAnnotations converts key=value pairs (e.g. from
+// repeated --service-account-annotation flags) into the annotations of the
+// ServiceAccount created for a TTL, such as eks.amazonaws.com/role-arn for
+// IRSA or iam.gke.io/gcp-service-account for GKE Workload Identity.
+// Values may contain = and commas; keys under helm-ttl/ are reserved.
+func ParseServiceAccountAnnotations(values []string) (map[string]string, error) {
+	return parseKeyValues("--service-account-annotation", "annotations", values, nil)
+}
+
+// serviceAccountAnnotations returns the annotations of the ServiceAccount
+// of spec: those shared by its RBAC plus the user's.
+func (s rbacSpec) serviceAccountAnnotations() map[string]string {
+	if len(s.userAnnotations) == 0 {
+		return s.annotations
+	}
+
+	annotations := maps.Clone(s.annotations)
+	if annotations == nil {
+		annotations = make(map[string]string, len(s.userAnnotations))
+	}
+	maps.Copy(annotations, s.userAnnotations)
+
+	return annotations
+}
@@ -0,0 +1,112 @@
+package ttl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseServiceAccountAnnotations(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   map[string]string
+		err    string
+	}{
+		{name: "none"},
+		{
+			name:   "irsa and workload identity",
+			values: []string{"eks.amazonaws.com/role-arn=arn:aws:iam::111122223333:role/helm-ttl", "iam.gke.io/gcp-service-account=ttl@project.iam.gserviceaccount.com"},
+			want: map[string]string{
+				"eks.amazonaws.com/role-arn":     "arn:aws:iam::111122223333:role/helm-ttl",
+				"iam.gke.io/gcp-service-account": "ttl@project.iam.gserviceaccount.com",
+			},
+		},
+		{name: "value with = and commas", values: []string{"policy=a=b,c", "empty="}, want: map[string]string{"policy": "a=b,c", "empty": ""}},
+		{name: "later value wins", values: []string{"team=a", "team=b"}, want: map[string]string{"team": "b"}},
+		{name: "missing value", values: []string{"team"}, err: `invalid --service-account-annotation "team": expected key=value`},
+		{name: "invalid key", values: []string{"bad key=x"}, err: `invalid --service-account-annotation key "bad key"`},
+		{name: "reserved key", values: []string{"helm-ttl/release=x"}, err: `invalid --service-account-annotation key "helm-ttl/release": helm-ttl/ annotations are reserved`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseServiceAccountAnnotations(tt.values)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSetTTLServiceAccountAnnotations(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset()
+
+	opts := SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "2d",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+
+		ServiceAccountAnnotations: map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::111122223333:role/a"},
+	}
+	_, err := SetTTL(ctx, cfg, client, opts)
+	require.NoError(t, err)
+
+	sa, err := client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:iam::111122223333:role/a", sa.Annotations["eks.amazonaws.com/role-arn"])
+	assert.Equal(t, "myapp", sa.Annotations[LabelRelease])
+
+	role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, role.Annotations, "eks.amazonaws.com/role-arn")
+
+	t.Run("updated on set", func(t *testing.T) {
+		opts := opts
+		opts.ServiceAccountAnnotations = map[string]string{"eks.amazonaws.com/role-arn": "arn:aws:iam::111122223333:role/b"}
+		_, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+
+		sa, err := client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "arn:aws:iam::111122223333:role/b", sa.Annotations["eks.amazonaws.com/role-arn"])
+	})
+
+	t.Run("exported", func(t *testing.T) {
+		objs, err := ExportTTL(ctx, cfg, fake.NewClientset(), opts)
+		require.NoError(t, err)
+
+		sa, ok := objs[0].(*corev1.ServiceAccount)
+		require.True(t, ok)
+		assert.Equal(t, "arn:aws:iam::111122223333:role/a", sa.Annotations["eks.amazonaws.com/role-arn"])
+	})
+
+	t.Run("requires create-service-account", func(t *testing.T) {
+		opts := opts
+		opts.CreateServiceAccount = false
+		_, err := SetTTL(ctx, cfg, client, opts)
+		assert.EqualError(t, err, "--service-account-annotation requires --create-service-account")
+	})
+}
+
+func TestRBACSpecServiceAccountAnnotations(t *testing.T) {
+	spec := rbacSpec{userAnnotations: map[string]string{"team": "a"}}
+	assert.Equal(t, map[string]string{"team": "a"}, spec.serviceAccountAnnotations())
+
+	spec = rbacSpec{annotations: map[string]string{LabelRelease: "myapp"}}
+	assert.Equal(t, map[string]string{LabelRelease: "myapp"}, spec.serviceAccountAnnotations())
+}
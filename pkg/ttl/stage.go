@@ -0,0 +1,213 @@
+package ttl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LabelStage marks the CronJob of an earlier stage of a TTL, such as
+	// its scale-down. Stage CronJobs lack the managed-by label, so they
+	// are never mistaken for a TTL of their own.
+	LabelStage = "helm-ttl/stage"
+	// LabelStageOf names the TTL CronJob a stage CronJob belongs to.
+	LabelStageOf = "helm-ttl/stage-of"
+	// StageScaleDown is the LabelStage of the CronJob scaling a release
+	// down before its TTL uninstalls it.
+	StageScaleDown = "scale-down"
+
+	// AnnotationScaleDownAt records on a TTL CronJob the RFC3339 time its
+	// scale-down stage scales the release to zero replicas.
+	AnnotationScaleDownAt = "helm-ttl/scale-down-at"
+
+	// scaleDownSuffix replaces the -ttl suffix of the TTL CronJob name in
+	// the name of its scale-down CronJob.
+	scaleDownSuffix = "-scale-down"
+
+	// scaleDownVolume is the volume the scale-down stage passes the
+	// release manifest to kubectl in.
+	scaleDownVolume    = "helm-ttl-scale-down"
+	scaleDownMountPath = "/helm-ttl-scale-down"
+	scaleDownManifest  = scaleDownMountPath + "/manifest.yaml"
+)
+
+// ScaleDownCronJobName returns the name of the scale-down CronJob of the
+// TTL CronJob named cronJobName. A name that would be too long is
+// shortened and suffixed with a hash of cronJobName.
+func ScaleDownCronJobName(cronJobName string) string {
+	base := strings.TrimSuffix(cronJobName, "-ttl")
+	if maxLen := maxResourceNameLen - len(scaleDownSuffix); len(base) > maxLen {
+		sum := sha256.Sum256([]byte(cronJobName))
+		base = strings.TrimRight(base[:maxLen-resourceNameHashLen-1], "-.") + "-" + hex.EncodeToString(sum[:])[:resourceNameHashLen]
+	}
+
+	return base + scaleDownSuffix
+}
+
+// scaleDownRules returns the rules the scale-down stage needs in the
+// release namespace to scale its Deployments and StatefulSets.
+func scaleDownRules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{"apps"},
+			Resources: []string{"deployments", "statefulsets"},
+			Verbs:     []string{"get"},
+		},
+		{
+			APIGroups: []string{"apps"},
+			Resources: []string{"deployments/scale", "statefulsets/scale"},
+			Verbs:     []string{"get", "patch", "update"},
+		},
+	}
+}
+
+// BuildScaleDownCronJob returns the CronJob of the first stage of the TTL
+// CronJob ttl, built from opts: at scaleDownAt it scales the Deployments
+// and StatefulSets of the release to zero replicas, leaving the release
+// installed until ttl uninstalls it, then deletes itself. It runs as the
+// service account of ttl, with its Job limits and pod options.
+func BuildScaleDownCronJob(ttl *batchv1.CronJob, opts CronJobOptions, scaleDownAt time.Time) *batchv1.CronJob {
+	images := GetEffectiveImages(ImageOptions{
+		HelmImage:      opts.HelmImage,
+		KubectlImage:   opts.KubectlImage,
+		RegistryPrefix: opts.RegistryPrefix,
+		CleanupImage:   opts.CleanupImage,
+	})
+	guardImage := images.Kubectl
+	if images.Cleanup != "" {
+		guardImage = images.Cleanup
+	}
+
+	name := ScaleDownCronJobName(ttl.Name)
+	labels := maps.Clone(ttl.Labels)
+	delete(labels, LabelManagedBy)
+	labels[LabelStage] = StageScaleDown
+	labels[LabelStageOf] = ttl.Name
+
+	annotations := releaseAnnotations(opts.ReleaseName, opts.ReleaseNamespace)
+	annotations[AnnotationExpiresAt] = FormatScheduledDate(scaleDownAt.UTC())
+
+	mount := []corev1.VolumeMount{{Name: scaleDownVolume, MountPath: scaleDownMountPath}}
+	getManifest := corev1.Container{
+		Name:         "get-manifest",
+		Image:        images.Helm,
+		Command:      getManifestCmd(opts.ReleaseName, opts.ReleaseNamespace),
+		VolumeMounts: mount,
+	}
+	if storage, _ := StorageResource(opts.Driver); storage != "secrets" {
+		getManifest.Env = []corev1.EnvVar{{Name: "HELM_DRIVER", Value: opts.Driver}}
+	}
+
+	podSpec := corev1.PodSpec{
+		ServiceAccountName: ttl.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName,
+		RestartPolicy:      corev1.RestartPolicyNever,
+		InitContainers: []corev1.Container{
+			{
+				Name:    expiryGuardContainer,
+				Image:   guardImage,
+				Command: expiryGuardCmd(scaleDownAt, images.Cleanup != ""),
+			},
+			getManifest,
+		},
+		Containers: []corev1.Container{{
+			Name:         "scale-down",
+			Image:        images.Kubectl,
+			Command:      scaleDownCmd(opts.ReleaseName, opts.ReleaseNamespace, name, ttl.Namespace),
+			VolumeMounts: mount,
+		}},
+		ImagePullSecrets: imagePullSecrets(opts.ImagePullSecrets),
+		Volumes: []corev1.Volume{{
+			Name:         scaleDownVolume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		}},
+	}
+	applyPodOptions(&podSpec, opts.Pod)
+	applySecurityContext(&podSpec, opts.Security)
+
+	template := ttl.Spec.JobTemplate.DeepCopy()
+	template.Labels = labels
+	template.Spec.PodFailurePolicy = nil
+	template.Spec.Template.Labels = labels
+	template.Spec.Template.Spec = podSpec
+
+	spec := *ttl.Spec.DeepCopy()
+	spec.Schedule = TimeToCronSchedule(scaleDownAt)
+	spec.JobTemplate = *template
+
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   ttl.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: spec,
+	}
+}
+
+// getManifestCmd returns a command saving the manifest of a release to
+// scaleDownManifest, saving nothing once the release is gone.
+func getManifestCmd(releaseName, releaseNamespace string) []string {
+	script := releaseGoneCheck(releaseName, releaseNamespace, "scale down") +
+		fmt.Sprintf("exec helm get manifest %s --namespace %s > %s", releaseName, releaseNamespace, scaleDownManifest)
+
+	return []string{"sh", "-c", script}
+}
+
+// scaleDownCmd returns a kubectl command scaling the Deployments and
+// StatefulSets in the manifest getManifestCmd saved to zero replicas, then
+// deleting the scale-down CronJob named name.
+func scaleDownCmd(releaseName, releaseNamespace, name, cronjobNamespace string) []string {
+	script := fmt.Sprintf(`if [ -f %[1]s ]; then
+  kubectl get --filename %[1]s --namespace %[2]s --output name --ignore-not-found 2>/dev/null | grep -E '^(deployment|statefulset)\.apps/' > %[3]s/scalable
+  if [ -s %[3]s/scalable ]; then
+    kubectl scale --namespace %[2]s --replicas=0 $(cat %[3]s/scalable) || exit 1
+  else
+    echo "release %[4]s has no Deployments or StatefulSets to scale down"
+  fi
+fi
+exec kubectl delete cronjob %[5]s --namespace %[6]s --ignore-not-found`,
+		scaleDownManifest, releaseNamespace, scaleDownMountPath, releaseName, name, cronjobNamespace)
+
+	return []string{"sh", "-c", script}
+}
+
+// saveScaleDownCronJob applies stage, the scale-down CronJob of the TTL
+// CronJob ttl, owned by ttl so Kubernetes deletes it along with the TTL.
+// A nil stage removes the scale-down CronJob an earlier set created.
+func saveScaleDownCronJob(ctx context.Context, client kubernetes.Interface, ttl, stage *batchv1.CronJob) error {
+	cronJobs := client.BatchV1().CronJobs(ttl.Namespace)
+	if stage == nil {
+		err := cronJobs.Delete(ctx, ScaleDownCronJobName(ttl.Name), metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete scale-down CronJob: %w", err)
+		}
+
+		return nil
+	}
+
+	setOwner(&stage.ObjectMeta, metav1.OwnerReference{
+		APIVersion: batchv1.SchemeGroupVersion.String(),
+		Kind:       "CronJob",
+		Name:       ttl.Name,
+		UID:        ttl.UID,
+	})
+	if _, err := apply[*batchv1.CronJob](ctx, cronJobs, stage, batchv1ac.CronJob(stage.Name, stage.Namespace)); err != nil {
+		return fmt.Errorf("failed to save scale-down CronJob: %w", err)
+	}
+
+	return nil
+}
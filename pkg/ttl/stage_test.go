@@ -0,0 +1,185 @@
+package ttl
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestScaleDownCronJobName(t *testing.T) {
+	assert.Equal(t, "myapp-4a0c226a-scale-down", ScaleDownCronJobName("myapp-4a0c226a-ttl"))
+
+	long := ResourceName(strings.Repeat("a", 60), "default")
+	name := ScaleDownCronJobName(long)
+	assert.LessOrEqual(t, len(name), maxResourceNameLen)
+	assert.True(t, strings.HasSuffix(name, scaleDownSuffix))
+	assert.NotEqual(t, name, ScaleDownCronJobName(ResourceName(strings.Repeat("a", 61), "default")))
+}
+
+func TestBuildScaleDownCronJob(t *testing.T) {
+	expiresAt := time.Date(2025, 6, 18, 9, 0, 0, 0, time.UTC)
+	scaleDownAt := time.Date(2025, 6, 16, 9, 0, 0, 0, time.UTC)
+	opts := CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Schedule:         TimeToCronSchedule(expiresAt),
+		ServiceAccount:   "myapp-4a0c226a-ttl",
+		ExpiresAt:        expiresAt,
+		ImagePullSecrets: []string{"regcred"},
+	}
+	ttlCJ, err := BuildCronJob(opts)
+	require.NoError(t, err)
+
+	cj := BuildScaleDownCronJob(ttlCJ, opts, scaleDownAt)
+	assert.Equal(t, "myapp-4a0c226a-scale-down", cj.Name)
+	assert.Equal(t, "default", cj.Namespace)
+	assert.Equal(t, "0 9 16 6 *", cj.Spec.Schedule)
+	assert.Equal(t, FormatScheduledDate(scaleDownAt), cj.Annotations[AnnotationExpiresAt])
+
+	// Labelled as a stage of the TTL, not as a TTL of its own
+	assert.NotContains(t, cj.Labels, LabelManagedBy)
+	assert.Equal(t, StageScaleDown, cj.Labels[LabelStage])
+	assert.Equal(t, ttlCJ.Name, cj.Labels[LabelStageOf])
+	assert.Equal(t, "myapp", cj.Labels[LabelRelease])
+	assert.Equal(t, cj.Labels, cj.Spec.JobTemplate.Spec.Template.Labels)
+
+	podSpec := cj.Spec.JobTemplate.Spec.Template.Spec
+	assert.Equal(t, "myapp-4a0c226a-ttl", podSpec.ServiceAccountName)
+	assert.Equal(t, "regcred", podSpec.ImagePullSecrets[0].Name)
+	require.Len(t, podSpec.InitContainers, 2)
+	assert.Equal(t, expiryGuardContainer, podSpec.InitContainers[0].Name)
+	assert.Equal(t, "get-manifest", podSpec.InitContainers[1].Name)
+	assert.Equal(t, DefaultHelmImage, podSpec.InitContainers[1].Image)
+	assert.Contains(t, podSpec.InitContainers[1].Command[2], "helm get manifest myapp --namespace default > "+scaleDownManifest)
+
+	require.Len(t, podSpec.Containers, 1)
+	assert.Equal(t, DefaultKubectlImage, podSpec.Containers[0].Image)
+	script := podSpec.Containers[0].Command[2]
+	assert.Contains(t, script, "kubectl scale --namespace default --replicas=0")
+	assert.Contains(t, script, "kubectl delete cronjob myapp-4a0c226a-scale-down --namespace default --ignore-not-found")
+
+	// The TTL CronJob is left as is
+	assert.Equal(t, TimeToCronSchedule(expiresAt), ttlCJ.Spec.Schedule)
+	assert.Equal(t, LabelManagedByValue, ttlCJ.Labels[LabelManagedBy])
+}
+
+func TestSetTTL_ScaleDown(t *testing.T) {
+	ctx := context.Background()
+	opts := SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "72h",
+		ScaleDownAfter:       "24h",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	}
+
+	t.Run("creates both stages", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		result, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+		scaleDownAt, err := time.Parse(time.RFC3339, result.ScaleDownAt)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), scaleDownAt, time.Minute)
+
+		ttlCJ, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, result.ScaleDownAt, ttlCJ.Annotations[AnnotationScaleDownAt])
+
+		stage, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-scale-down", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, TimeToCronSchedule(scaleDownAt), stage.Spec.Schedule)
+		require.Len(t, stage.OwnerReferences, 1)
+		assert.Equal(t, "CronJob", stage.OwnerReferences[0].Kind)
+		assert.Equal(t, ttlCJ.Name, stage.OwnerReferences[0].Name)
+
+		role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Contains(t, role.Rules, scaleDownRules()[1])
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, result.ScaleDownAt, info.ScaleDownDate)
+		assert.Equal(t, result.ExpiresAt, info.ScheduledDate)
+
+		// The stage is not a TTL of its own
+		ttls, err := ListTTLs(ctx, client, "default", "")
+		require.NoError(t, err)
+		assert.Len(t, ttls, 1)
+	})
+
+	t.Run("set without it removes the stage", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+
+		plain := opts
+		plain.ScaleDownAfter = ""
+		_, err = SetTTL(ctx, cfg, client, plain)
+		require.NoError(t, err)
+
+		_, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-scale-down", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Empty(t, info.ScaleDownDate)
+	})
+
+	t.Run("unset removes the stage", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+		require.NoError(t, UnsetTTL(ctx, client, "myapp", "default", "default"))
+
+		_, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-scale-down", metav1.GetOptions{})
+		assert.True(t, errors.IsNotFound(err))
+	})
+
+	t.Run("exports the stage", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		objs, err := ExportTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+		out, err := FormatManifests(objs)
+		require.NoError(t, err)
+		assert.Contains(t, out, "name: myapp-4a0c226a-scale-down")
+	})
+
+	t.Run("scale-down must come first", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		late := opts
+		late.ScaleDownAfter = "72h"
+		_, err := SetTTL(ctx, cfg, client, late)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid --scale-down-after: the scale-down at")
+		assert.Contains(t, err.Error(), "must come before the uninstall at")
+
+		invalid := opts
+		invalid.ScaleDownAfter = "soon"
+		_, err = SetTTL(ctx, cfg, client, invalid)
+		assert.ErrorContains(t, err, "invalid --scale-down-after")
+
+		list, err := client.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, list.Items)
+	})
+}
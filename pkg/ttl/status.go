@@ -0,0 +1,142 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// TTLStatus is the live state of a TTL CronJob and the Jobs it ran.
+type TTLStatus struct {
+	Suspended          bool         `json:"suspended" yaml:"suspended"`
+	LastScheduleTime   string       `json:"last_schedule_time,omitempty" yaml:"last_schedule_time,omitempty"`
+	LastSuccessfulTime string       `json:"last_successful_time,omitempty" yaml:"last_successful_time,omitempty"`
+	ActiveJobs         int          `json:"active_jobs" yaml:"active_jobs"`
+	Failures           []JobFailure `json:"failures,omitempty" yaml:"failures,omitempty"`
+}
+
+// JobFailure describes a failed TTL Job or a warning event recorded for one.
+type JobFailure struct {
+	Job     string `json:"job" yaml:"job"`
+	Time    string `json:"time,omitempty" yaml:"time,omitempty"`
+	Reason  string `json:"reason" yaml:"reason"`
+	Message string `json:"message" yaml:"message"`
+}
+
+// cronJobStatus returns the status recorded on the CronJob itself.
+func cronJobStatus(cj *batchv1.CronJob) *TTLStatus {
+	status := &TTLStatus{
+		Suspended:  cj.Spec.Suspend != nil && *cj.Spec.Suspend,
+		ActiveJobs: len(cj.Status.Active),
+	}
+
+	if t := cj.Status.LastScheduleTime; t != nil {
+		status.LastScheduleTime = FormatScheduledDate(t.Time)
+	}
+
+	if t := cj.Status.LastSuccessfulTime; t != nil {
+		status.LastSuccessfulTime = FormatScheduledDate(t.Time)
+	}
+
+	return status
+}
+
+// DescribeTTL returns the TTL for a release along with its live status,
+// including failures of the Jobs created by the CronJob or by `helm ttl
+// run`, to help debug a TTL that did not fire.
+func DescribeTTL(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace, cronjobNamespace string) (*TTLInfo, error) {
+	info, err := GetTTL(ctx, client, releaseName, releaseNamespace, cronjobNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Status.Failures, err = jobFailures(ctx, client, releaseName, releaseNamespace, cronjobNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// jobFailures collects the failed conditions and warning events of the
+// TTL Jobs for a release, oldest first.
+func jobFailures(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace, cronjobNamespace string) ([]JobFailure, error) {
+	jobs, err := client.BatchV1().Jobs(cronjobNamespace).List(ctx, metav1.ListOptions{LabelSelector: ttlJobSelector(releaseName, releaseNamespace)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Jobs: %w", err)
+	}
+
+	if len(jobs.Items) == 0 {
+		return []JobFailure{}, nil
+	}
+
+	var failures []failureAt
+	jobNames := make(map[string]bool, len(jobs.Items))
+	for _, job := range jobs.Items {
+		jobNames[job.Name] = true
+		for _, cond := range job.Status.Conditions {
+			if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+				failures = append(failures, failureAt{
+					at:      cond.LastTransitionTime.Time,
+					failure: JobFailure{Job: job.Name, Reason: cond.Reason, Message: cond.Message},
+				})
+			}
+		}
+	}
+
+	events, err := client.CoreV1().Events(cronjobNamespace).List(ctx, metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Job,type=" + corev1.EventTypeWarning,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	for _, ev := range events.Items {
+		if ev.Type != corev1.EventTypeWarning || ev.InvolvedObject.Kind != "Job" || !jobNames[ev.InvolvedObject.Name] {
+			continue
+		}
+
+		failures = append(failures, failureAt{
+			at:      eventTime(ev),
+			failure: JobFailure{Job: ev.InvolvedObject.Name, Reason: ev.Reason, Message: ev.Message},
+		})
+	}
+
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].at.Before(failures[j].at)
+	})
+
+	result := make([]JobFailure, 0, len(failures))
+	for _, f := range failures {
+		if !f.at.IsZero() {
+			f.failure.Time = FormatScheduledDate(f.at)
+		}
+		result = append(result, f.failure)
+	}
+
+	return result, nil
+}
+
+// failureAt pairs a failure with its time for sorting.
+type failureAt struct {
+	at      time.Time
+	failure JobFailure
+}
+
+// eventTime returns the most recent time an event was observed.
+func eventTime(ev corev1.Event) time.Time {
+	switch {
+	case !ev.LastTimestamp.IsZero():
+		return ev.LastTimestamp.Time
+	case !ev.EventTime.IsZero():
+		return ev.EventTime.Time
+	default:
+		return ev.FirstTimestamp.Time
+	}
+}
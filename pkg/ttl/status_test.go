@@ -0,0 +1,175 @@
+package ttl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func statusTestCronJob() *batchv1.CronJob {
+	suspend := true
+	lastSchedule := metav1.NewTime(time.Date(2025, 3, 15, 14, 30, 0, 0, time.UTC))
+
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-4a0c226a-ttl",
+			Namespace: "default",
+			Labels: map[string]string{
+				LabelManagedBy:        LabelManagedByValue,
+				LabelRelease:          "myapp",
+				LabelReleaseNamespace: "default",
+			},
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule: "30 14 15 3 *",
+			Suspend:  &suspend,
+		},
+		Status: batchv1.CronJobStatus{
+			LastScheduleTime: &lastSchedule,
+			Active:           []corev1.ObjectReference{{Name: "myapp-4a0c226a-ttl-1"}},
+		},
+	}
+}
+
+func statusTestJob(name string, conditions ...batchv1.JobCondition) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels: map[string]string{
+				LabelRelease:          "myapp",
+				LabelReleaseNamespace: "default",
+			},
+		},
+		Status: batchv1.JobStatus{Conditions: conditions},
+	}
+}
+
+func TestGetTTL_Status(t *testing.T) {
+	client := fake.NewClientset(statusTestCronJob())
+
+	info, err := GetTTL(context.Background(), client, "myapp", "default", "default")
+	require.NoError(t, err)
+	require.NotNil(t, info.Status)
+	assert.True(t, info.Status.Suspended)
+	assert.Equal(t, "2025-03-15T14:30:00Z", info.Status.LastScheduleTime)
+	assert.Empty(t, info.Status.LastSuccessfulTime)
+	assert.Equal(t, 1, info.Status.ActiveJobs)
+	assert.Nil(t, info.Status.Failures)
+}
+
+func TestDescribeTTL(t *testing.T) {
+	ctx := context.Background()
+	failedAt := metav1.NewTime(time.Date(2025, 3, 15, 14, 31, 0, 0, time.UTC))
+	warnedAt := metav1.NewTime(time.Date(2025, 3, 15, 14, 30, 30, 0, time.UTC))
+
+	t.Run("collects job failures and warning events", func(t *testing.T) {
+		client := fake.NewClientset(
+			statusTestCronJob(),
+			statusTestJob("myapp-4a0c226a-ttl-1", batchv1.JobCondition{
+				Type:               batchv1.JobFailed,
+				Status:             corev1.ConditionTrue,
+				Reason:             "BackoffLimitExceeded",
+				Message:            "Job has reached the specified backoff limit",
+				LastTransitionTime: failedAt,
+			}),
+			statusTestJob("myapp-4a0c226a-ttl-run", batchv1.JobCondition{
+				Type:   batchv1.JobComplete,
+				Status: corev1.ConditionTrue,
+			}),
+			&corev1.Event{
+				ObjectMeta:     metav1.ObjectMeta{Name: "ev1", Namespace: "default"},
+				InvolvedObject: corev1.ObjectReference{Kind: "Job", Name: "myapp-4a0c226a-ttl-1"},
+				Type:           corev1.EventTypeWarning,
+				Reason:         "FailedCreate",
+				Message:        "pods is forbidden: violates PodSecurity",
+				LastTimestamp:  warnedAt,
+			},
+			&corev1.Event{
+				ObjectMeta:     metav1.ObjectMeta{Name: "ev2", Namespace: "default"},
+				InvolvedObject: corev1.ObjectReference{Kind: "Job", Name: "other-job"},
+				Type:           corev1.EventTypeWarning,
+				Reason:         "FailedCreate",
+			},
+			&corev1.Event{
+				ObjectMeta:     metav1.ObjectMeta{Name: "ev3", Namespace: "default"},
+				InvolvedObject: corev1.ObjectReference{Kind: "Job", Name: "myapp-4a0c226a-ttl-1"},
+				Type:           corev1.EventTypeNormal,
+				Reason:         "SuccessfulCreate",
+			},
+		)
+
+		info, err := DescribeTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, []JobFailure{
+			{
+				Job:     "myapp-4a0c226a-ttl-1",
+				Time:    "2025-03-15T14:30:30Z",
+				Reason:  "FailedCreate",
+				Message: "pods is forbidden: violates PodSecurity",
+			},
+			{
+				Job:     "myapp-4a0c226a-ttl-1",
+				Time:    "2025-03-15T14:31:00Z",
+				Reason:  "BackoffLimitExceeded",
+				Message: "Job has reached the specified backoff limit",
+			},
+		}, info.Status.Failures)
+	})
+
+	t.Run("no jobs", func(t *testing.T) {
+		client := fake.NewClientset(statusTestCronJob())
+
+		info, err := DescribeTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.NotNil(t, info.Status.Failures)
+		assert.Empty(t, info.Status.Failures)
+	})
+
+	t.Run("TTL not found", func(t *testing.T) {
+		_, err := DescribeTTL(ctx, fake.NewClientset(), "myapp", "default", "default")
+		var notFound *TTLNotFoundError
+		assert.True(t, errors.As(err, &notFound))
+	})
+
+	t.Run("job list error", func(t *testing.T) {
+		client := fake.NewClientset(statusTestCronJob())
+		client.PrependReactor("list", "jobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := DescribeTTL(ctx, client, "myapp", "default", "default")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to list Jobs")
+	})
+
+	t.Run("event list error", func(t *testing.T) {
+		client := fake.NewClientset(statusTestCronJob(), statusTestJob("myapp-4a0c226a-ttl-1"))
+		client.PrependReactor("list", "events", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		_, err := DescribeTTL(ctx, client, "myapp", "default", "default")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to list events")
+	})
+}
+
+func TestEventTime(t *testing.T) {
+	first := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := first.Add(time.Hour)
+
+	assert.Equal(t, last, eventTime(corev1.Event{FirstTimestamp: metav1.NewTime(first), LastTimestamp: metav1.NewTime(last)}))
+	assert.Equal(t, last, eventTime(corev1.Event{EventTime: metav1.NewMicroTime(last)}))
+	assert.Equal(t, first, eventTime(corev1.Event{FirstTimestamp: metav1.NewTime(first)}))
+}
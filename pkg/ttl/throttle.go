@@ -0,0 +1,89 @@
+package ttl
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// throttleRetries is how many times a request the API server throttled
+	// is retried before giving up.
+	throttleRetries = 5
+	// throttleInitialDelay is the wait before the first retry; it doubles
+	// with each retry up to throttleMaxDelay.
+	throttleInitialDelay = time.Second
+	throttleMaxDelay     = 30 * time.Second
+)
+
+// throttleSleep waits d or until the request is canceled; tests replace
+// it.
+var throttleSleep = func(req *http.Request, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// retryThrottled retries the requests of config that the API server, or a
+// proxy in front of it, answers with 429 Too Many Requests, waiting with
+// exponential backoff, or as long as Retry-After asks when that is longer.
+// Bulk operations such as set on many releases, extend --all and
+// cleanup-rbac across namespaces then slow down on a busy API server
+// instead of failing midway.
+func retryThrottled(config *rest.Config) {
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return throttleRoundTripper{next: rt}
+	})
+}
+
+type throttleRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (t throttleRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	delay := throttleInitialDelay
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+
+		// A request whose body cannot be read again is not retried
+		if attempt == throttleRetries || (req.Body != nil && req.GetBody == nil) {
+			// client-go retries 429s with Retry-After itself; the
+			// backoff above already did, so it should not start over
+			resp.Header.Del("Retry-After")
+			return resp, nil
+		}
+
+		wait := delay
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && time.Duration(seconds)*time.Second > wait {
+			wait = time.Duration(seconds) * time.Second
+		}
+		_ = resp.Body.Close()
+
+		logger.Debug("kubernetes API request throttled, retrying", "method", req.Method, "url", req.URL.String(), "retry", attempt+1, "wait", wait)
+		if err := throttleSleep(req, wait); err != nil {
+			return nil, err
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		delay = min(delay*2, throttleMaxDelay)
+	}
+}
@@ -0,0 +1,113 @@
+package ttl
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestRetryThrottled(t *testing.T) {
+	var waits []time.Duration
+	orig := throttleSleep
+	throttleSleep = func(_ *http.Request, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() { throttleSleep = orig })
+
+	// throttledServer answers the first throttled requests with 429 and
+	// then creates the ConfigMap, recording the bodies it got.
+	throttledServer := func(t *testing.T, throttled int, retryAfter string) (*httptest.Server, *atomic.Int32, *[]string) {
+		t.Helper()
+		var requests atomic.Int32
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			w.Header().Set("Content-Type", "application/json")
+			if int(requests.Add(1)) <= throttled {
+				if retryAfter != "" {
+					w.Header().Set("Retry-After", retryAfter)
+				}
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"TooManyRequests","code":429}`))
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write(body)
+		}))
+		t.Cleanup(server.Close)
+
+		return server, &requests, &bodies
+	}
+
+	newClient := func(t *testing.T, host string) kubernetes.Interface {
+		t.Helper()
+		config := &rest.Config{Host: host, ContentConfig: rest.ContentConfig{ContentType: "application/json"}}
+		retryThrottled(config)
+		client, err := kubernetes.NewForConfig(config)
+		require.NoError(t, err)
+		return client
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "myapp-ttl-history"}}
+
+	t.Run("retries with exponential backoff", func(t *testing.T) {
+		waits = nil
+		server, requests, bodies := throttledServer(t, 3, "")
+
+		_, err := newClient(t, server.URL).CoreV1().ConfigMaps("default").Create(context.Background(), cm, metav1.CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, int32(4), requests.Load())
+		assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, waits)
+
+		// The body is sent again with each retry
+		for _, body := range *bodies {
+			assert.Contains(t, body, "myapp-ttl-history")
+		}
+	})
+
+	t.Run("waits as long as Retry-After asks", func(t *testing.T) {
+		waits = nil
+		server, _, _ := throttledServer(t, 1, "10")
+
+		_, err := newClient(t, server.URL).CoreV1().ConfigMaps("default").Create(context.Background(), cm, metav1.CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []time.Duration{10 * time.Second}, waits)
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		waits = nil
+		server, requests, _ := throttledServer(t, 100, "1")
+
+		_, err := newClient(t, server.URL).CoreV1().ConfigMaps("default").Create(context.Background(), cm, metav1.CreateOptions{})
+		require.Error(t, err)
+		assert.True(t, errors.IsTooManyRequests(err))
+		// client-go does not retry again on top of the backoff
+		assert.Equal(t, int32(throttleRetries+1), requests.Load())
+		assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second}, waits)
+	})
+
+	t.Run("stops when the request is canceled", func(t *testing.T) {
+		throttleSleep = orig
+		server, requests, _ := throttledServer(t, 100, "")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := newClient(t, server.URL).CoreV1().ConfigMaps("default").Create(ctx, cm, metav1.CreateOptions{})
+		require.Error(t, err)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+}
@@ -1,7 +1,9 @@
 package ttl
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -11,86 +13,148 @@ import (
 )
 
 var daysPattern = regexp.MustCompile(`^(\d+)d$`)
+var weeksPattern = regexp.MustCompile(`^(\d+)w$`)
 var humanDurationPattern = regexp.MustCompile(`^(\d+)\s+(seconds?|secs?|minutes?|mins?|hours?|hrs?|days?|weeks?)$`)
 
 // maxTTLDuration is the maximum TTL (~11 months) since cron has no year field.
 const maxTTLDuration = 11 * 30 * 24 * time.Hour
 
-// ParseTimeInput parses a time input string and returns an absolute time.
-// It tries these formats in order:
+// DefaultMinDuration is the shortest TTL set accepts unless told to allow
+// short ones.
+const DefaultMinDuration = 5 * time.Minute
+
+// errNotADuration is returned by ParseDuration for input that is not a
+// relative duration, such as a date.
+var errNotADuration = errors.New("not a duration")
+
+// ParseTimeInput parses a time input string and returns an absolute time,
+// refusing ambiguous numeric dates. See ParseTimeInputWithOrder.
+func ParseTimeInput(input string, now time.Time) (time.Time, error) {
+	return ParseTimeInputWithOrder(input, now, DateOrderStrict)
+}
+
+// ParseTimeInputWithOrder parses a time input string and returns an
+// absolute time. It tries these formats in order:
 // 1. Go durations: 30m, 2h, 2h30m, 24h, 168h
-// 2. Days shorthand: 7d, 30d
+// 2. Days and weeks shorthand: 7d, 30d, 2w
 // 3. Human-readable durations: 6 hours, 3 days, 2 weeks, 30 mins
-// 4. Natural language: tomorrow, next monday, in 2 hours
-func ParseTimeInput(input string, now time.Time) (time.Time, error) {
+// 4. Calendar dates: 2025-04-03, 04/03 5pm, April 3, 3rd of April 17:00
+// 5. Business-calendar phrases: eod, eow, friday 6pm, monday morning
+// 6. Natural language: tomorrow, next monday, in 2 hours
+//
+// Numeric dates are read according to order. Surrounding whitespace is
+// ignored, including the carriage return of a value read from a file with
+// Windows line endings.
+func ParseTimeInputWithOrder(input string, now time.Time, order DateOrder) (time.Time, error) {
+	input = strings.TrimSpace(input)
+	d, err := ParseDuration(input)
+	if err == nil {
+		if d > maxTTLDuration {
+			return time.Time{}, fmt.Errorf("TTL exceeds maximum of ~11 months")
+		}
+
+		return now.Add(d), nil
+	}
+	if !errors.Is(err, errNotADuration) {
+		return time.Time{}, err
+	}
+
+	// Try calendar dates, which natural language parsing misreads
+	target, err := parseExplicitDate(input, now, order)
+	if err != nil && !errors.Is(err, errNotAnExplicitDate) {
+		return time.Time{}, err
+	}
+
+	// Try business-calendar phrases, which natural language parsing
+	// misreads or takes for past days
+	if errors.Is(err, errNotAnExplicitDate) {
+		target, err = parseBusinessPhrase(input, now)
+		if err != nil && !errors.Is(err, errNotABusinessPhrase) {
+			return time.Time{}, err
+		}
+	}
+
+	// Try natural language
+	if err != nil {
+		target, err = naturaldate.Parse(input, now, naturaldate.WithDirection(naturaldate.Future))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("could not parse time input %q: %w", input, err)
+		}
+
+		if target.IsZero() {
+			return time.Time{}, fmt.Errorf("could not parse time input %q", input)
+		}
+	}
+
+	if !target.After(now) {
+		return time.Time{}, fmt.Errorf("parsed time %s is not in the future", target.Format(time.RFC3339))
+	}
+
+	if target.Sub(now) > maxTTLDuration {
+		return time.Time{}, fmt.Errorf("TTL exceeds maximum of ~11 months")
+	}
+
+	return target, nil
+}
+
+// ParseDuration parses a positive relative duration: a Go duration (2h30m),
+// days or weeks shorthand (7d, 2w) or a human-readable duration (3 days).
+// Surrounding whitespace, such as a trailing \r\n, is ignored.
+func ParseDuration(input string) (time.Duration, error) {
+	input = strings.TrimSpace(input)
+
 	// Try Go duration
 	if d, err := time.ParseDuration(input); err == nil {
 		if d <= 0 {
-			return time.Time{}, fmt.Errorf("duration must be positive, got %s", input)
-		}
-
-		target := now.Add(d)
-		if target.Sub(now) > maxTTLDuration {
-			return time.Time{}, fmt.Errorf("TTL exceeds maximum of ~11 months")
+			return 0, fmt.Errorf("duration must be positive, got %s", input)
 		}
 
-		return target, nil
+		return d, nil
 	}
 
 	// Try days shorthand (e.g., 7d, 30d)
 	if matches := daysPattern.FindStringSubmatch(input); matches != nil {
 		days, err := strconv.Atoi(matches[1])
 		if err != nil {
-			return time.Time{}, fmt.Errorf("invalid days value: %s", matches[1])
+			return 0, fmt.Errorf("invalid days value: %s", matches[1])
 		}
 
 		if days <= 0 {
-			return time.Time{}, fmt.Errorf("days must be positive, got %d", days)
+			return 0, fmt.Errorf("days must be positive, got %d", days)
 		}
 
-		target := now.Add(time.Duration(days) * 24 * time.Hour)
-		if target.Sub(now) > maxTTLDuration {
-			return time.Time{}, fmt.Errorf("TTL exceeds maximum of ~11 months")
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	// Try weeks shorthand (e.g., 1w, 2w)
+	if matches := weeksPattern.FindStringSubmatch(input); matches != nil {
+		weeks, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid weeks value: %s", matches[1])
+		}
+
+		if weeks <= 0 {
+			return 0, fmt.Errorf("weeks must be positive, got %d", weeks)
 		}
 
-		return target, nil
+		return time.Duration(weeks) * 7 * 24 * time.Hour, nil
 	}
 
 	// Try human-readable duration (e.g., "6 hours", "3 days", "2 weeks")
 	if matches := humanDurationPattern.FindStringSubmatch(input); matches != nil {
 		value, err := strconv.Atoi(matches[1])
 		if err != nil {
-			return time.Time{}, fmt.Errorf("invalid duration value: %s", matches[1])
+			return 0, fmt.Errorf("invalid duration value: %s", matches[1])
 		}
 
 		if value <= 0 {
-			return time.Time{}, fmt.Errorf("duration must be positive, got %d %s", value, matches[2])
-		}
-
-		unit := parseHumanDurationUnit(matches[2])
-		target := now.Add(time.Duration(value) * unit)
-		if target.Sub(now) > maxTTLDuration {
-			return time.Time{}, fmt.Errorf("TTL exceeds maximum of ~11 months")
+			return 0, fmt.Errorf("duration must be positive, got %d %s", value, matches[2])
 		}
 
-		return target, nil
-	}
-
-	// Try natural language
-	target, err := naturaldate.Parse(input, now)
-	if err != nil {
-		return time.Time{}, fmt.Errorf("could not parse time input %q: %w", input, err)
-	}
-
-	if !target.After(now) {
-		return time.Time{}, fmt.Errorf("parsed time %s is not in the future", target.Format(time.RFC3339))
+		return time.Duration(value) * parseHumanDurationUnit(matches[2]), nil
 	}
 
-	if target.Sub(now) > maxTTLDuration {
-		return time.Time{}, fmt.Errorf("TTL exceeds maximum of ~11 months")
-	}
-
-	return target, nil
+	return 0, errNotADuration
 }
 
 // parseHumanDurationUnit maps a human-readable unit word to a time.Duration.
@@ -117,25 +181,96 @@ func TimeToCronSchedule(t time.Time) string {
 	return fmt.Sprintf("%d %d %d %d *", t.Minute(), t.Hour(), t.Day(), t.Month())
 }
 
+// roundUpToMinute returns t rounded up to the next whole minute, the
+// precision of cron schedules, so a TTL never fires before the time it
+// was set for. A t on a whole minute is returned as is.
+func roundUpToMinute(t time.Time) time.Time {
+	truncated := t.Truncate(time.Minute)
+	if truncated.Equal(t) {
+		return t
+	}
+
+	return truncated.Add(time.Minute)
+}
+
+// precisionWarning returns a warning when rounding the requested expiry
+// up to effective drops seconds the duration asked for, as in 90s, and ""
+// otherwise. The seconds of now alone are not worth a warning.
+func precisionWarning(requested, effective, now time.Time) string {
+	if requested.Equal(effective) || requested.Sub(now)%time.Minute == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("requested expiry %s rounded up to %s: CronJob schedules have minute granularity",
+		FormatScheduledDate(requested), FormatScheduledDate(effective))
+}
+
 // ParseCronSchedule parses a cron schedule string back to a time.Time.
 // It assumes the schedule was generated by TimeToCronSchedule and uses
 // the current year (or next year if the date has passed).
 func ParseCronSchedule(schedule string) (time.Time, error) {
+	t, _, err := ResolveCronSchedule(schedule, time.Time{}, time.Now())
+	return t, err
+}
+
+// ResolveCronSchedule returns the absolute time a TTL schedule refers to.
+// Cron has no year field, so the year is inferred from setAt, the time the
+// schedule was written: SetTTL only writes future times less than a year
+// ahead, so the TTL fires at the first matching time after setAt. missed
+// reports that this time has already passed, i.e. the CronJob should have
+// fired and deleted itself but did not. A zero setAt falls back to
+// ParseCronSchedule relative to now, which never reports a miss.
+func ResolveCronSchedule(schedule string, setAt, now time.Time) (time.Time, bool, error) {
 	var minute, hour, day, month int
 	var dow string
 
 	n, err := fmt.Sscanf(schedule, "%d %d %d %d %s", &minute, &hour, &day, &month, &dow)
 	if err != nil || n != 5 {
-		return time.Time{}, fmt.Errorf("invalid cron schedule %q: expected format 'M H D Mon *'", schedule)
+		return time.Time{}, false, fmt.Errorf("invalid cron schedule %q: expected format 'M H D Mon *'", schedule)
+	}
+
+	if setAt.IsZero() {
+		setAt = now
+	}
+
+	setAt = setAt.In(now.Location())
+	t := time.Date(setAt.Year(), time.Month(month), day, hour, minute, 0, 0, now.Location())
+	if !t.After(setAt) {
+		t = time.Date(setAt.Year()+1, time.Month(month), day, hour, minute, 0, 0, now.Location())
 	}
 
-	now := time.Now()
-	t := time.Date(now.Year(), time.Month(month), day, hour, minute, 0, 0, now.Location())
+	return t, t.Before(now), nil
+}
+
+// resolveMinDuration returns minimum, falling back to HELM_TTL_MIN_DURATION
+// and then DefaultMinDuration.
+func resolveMinDuration(minimum time.Duration) (time.Duration, error) {
+	if minimum != 0 {
+		return minimum, nil
+	}
+
+	if env := os.Getenv("HELM_TTL_MIN_DURATION"); env != "" {
+		d, err := ParseDuration(env)
+		if err != nil {
+			return 0, fmt.Errorf("invalid HELM_TTL_MIN_DURATION %q: %w", env, err)
+		}
+
+		return d, nil
+	}
+
+	return DefaultMinDuration, nil
+}
 
-	// If the time is in the past, try next year
-	if t.Before(now) {
-		t = time.Date(now.Year()+1, time.Month(month), day, hour, minute, 0, 0, now.Location())
+// checkMinDuration rejects a TTL firing at target sooner than minimum
+// from now. Cron schedules have minute granularity, so a TTL of seconds
+// may fall in a minute that has already started and fire a year late, or
+// be refused by the expiry guard.
+func checkMinDuration(target, now time.Time, minimum time.Duration) error {
+	if requested := target.Sub(now); requested < minimum {
+		return fmt.Errorf("TTL of %s is shorter than the minimum of %s: CronJob schedules have minute granularity, "+
+			"so a TTL this short may fire late or not at all; use a longer duration, or --allow-short to set it anyway",
+			FormatDuration(requested.Round(time.Second)), FormatDuration(minimum))
 	}
 
-	return t, nil
+	return nil
 }
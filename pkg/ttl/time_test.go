@@ -77,6 +77,12 @@ func TestParseTimeInput(t *testing.T) {
 		assert.Equal(t, now.Add(6*time.Hour), result)
 	})
 
+	t.Run("Windows line ending", func(t *testing.T) {
+		result, err := ParseTimeInput("3 days\r\n", now)
+		require.NoError(t, err)
+		assert.Equal(t, now.Add(3*24*time.Hour), result)
+	})
+
 	t.Run("human duration - 30 minutes", func(t *testing.T) {
 		result, err := ParseTimeInput("30 minutes", now)
 		require.NoError(t, err)
@@ -241,6 +247,34 @@ func TestTimeToCronSchedule(t *testing.T) {
 	}
 }
 
+func TestRoundUpToMinute(t *testing.T) {
+	onMinute := time.Date(2025, 6, 15, 14, 30, 0, 0, time.UTC)
+	assert.Equal(t, onMinute, roundUpToMinute(onMinute))
+	assert.Equal(t, onMinute.Add(time.Minute), roundUpToMinute(onMinute.Add(time.Second)))
+	assert.Equal(t, onMinute.Add(time.Minute), roundUpToMinute(onMinute.Add(59*time.Second+time.Millisecond)))
+	assert.Equal(t, "31 14 15 6 *", TimeToCronSchedule(roundUpToMinute(onMinute.Add(30*time.Second))))
+}
+
+func TestPrecisionWarning(t *testing.T) {
+	now := time.Date(2025, 6, 15, 14, 30, 20, 0, time.UTC)
+
+	t.Run("seconds asked for", func(t *testing.T) {
+		requested := now.Add(90 * time.Second)
+		assert.Equal(t, "requested expiry 2025-06-15T14:31:50Z rounded up to 2025-06-15T14:32:00Z: CronJob schedules have minute granularity",
+			precisionWarning(requested, roundUpToMinute(requested), now))
+	})
+
+	t.Run("seconds of now", func(t *testing.T) {
+		requested := now.Add(24 * time.Hour)
+		assert.Empty(t, precisionWarning(requested, roundUpToMinute(requested), now))
+	})
+
+	t.Run("on a whole minute", func(t *testing.T) {
+		requested := time.Date(2025, 6, 16, 17, 0, 0, 0, time.UTC)
+		assert.Empty(t, precisionWarning(requested, roundUpToMinute(requested), now))
+	})
+}
+
 func TestParseCronSchedule(t *testing.T) {
 	t.Run("valid schedule - future date", func(t *testing.T) {
 		// Use a date far in the future to avoid year-roll issues
@@ -272,3 +306,104 @@ func TestParseCronSchedule(t *testing.T) {
 		assert.Equal(t, original.Minute(), result.Minute())
 	})
 }
+
+func TestResolveCronSchedule(t *testing.T) {
+	date := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		schedule string
+		setAt    time.Time
+		now      time.Time
+		expected time.Time
+		missed   bool
+	}{
+		{
+			name:     "same year, pending",
+			schedule: "0 12 15 3 *",
+			setAt:    date(2025, time.March, 1, 0),
+			now:      date(2025, time.March, 10, 0),
+			expected: date(2025, time.March, 15, 12),
+		},
+		{
+			name:     "same year, missed",
+			schedule: "0 12 15 3 *",
+			setAt:    date(2025, time.March, 1, 0),
+			now:      date(2025, time.March, 20, 0),
+			expected: date(2025, time.March, 15, 12),
+			missed:   true,
+		},
+		{
+			name:     "set in December for January, checked before New Year",
+			schedule: "0 12 5 1 *",
+			setAt:    date(2025, time.December, 20, 0),
+			now:      date(2025, time.December, 31, 0),
+			expected: date(2026, time.January, 5, 12),
+		},
+		{
+			name:     "set in December for January, checked after New Year",
+			schedule: "0 12 5 1 *",
+			setAt:    date(2025, time.December, 20, 0),
+			now:      date(2026, time.January, 2, 0),
+			expected: date(2026, time.January, 5, 12),
+		},
+		{
+			name:     "set in December for January, missed after New Year",
+			schedule: "0 12 5 1 *",
+			setAt:    date(2025, time.December, 20, 0),
+			now:      date(2026, time.January, 6, 0),
+			expected: date(2026, time.January, 5, 12),
+			missed:   true,
+		},
+		{
+			name:     "set in January for December, checked in December",
+			schedule: "0 12 28 12 *",
+			setAt:    date(2025, time.January, 2, 0),
+			now:      date(2025, time.December, 27, 0),
+			expected: date(2025, time.December, 28, 12),
+		},
+		{
+			name:     "set in January for December, missed after New Year",
+			schedule: "0 12 28 12 *",
+			setAt:    date(2025, time.January, 2, 0),
+			now:      date(2026, time.January, 3, 0),
+			expected: date(2025, time.December, 28, 12),
+			missed:   true,
+		},
+		{
+			name:     "date earlier in the year than setAt means next year",
+			schedule: "0 12 1 2 *",
+			setAt:    date(2025, time.June, 1, 0),
+			now:      date(2025, time.June, 2, 0),
+			expected: date(2026, time.February, 1, 12),
+		},
+		{
+			name:     "unknown setAt, date passed this year",
+			schedule: "0 12 1 2 *",
+			now:      date(2025, time.June, 2, 0),
+			expected: date(2026, time.February, 1, 12),
+		},
+		{
+			name:     "unknown setAt, date later this year",
+			schedule: "0 12 1 8 *",
+			now:      date(2025, time.June, 2, 0),
+			expected: date(2025, time.August, 1, 12),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, missed, err := ResolveCronSchedule(tc.schedule, tc.setAt, tc.now)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+			assert.Equal(t, tc.missed, missed)
+		})
+	}
+
+	t.Run("invalid schedule", func(t *testing.T) {
+		_, _, err := ResolveCronSchedule("bad", time.Time{}, time.Now())
+		assert.Error(t, err)
+	})
+}
@@ -2,15 +2,29 @@ package ttl
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
 
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
 )
 
 // ReleaseNotFoundError is returned when a Helm release does not exist.
@@ -41,43 +55,346 @@ func (e *ServiceAccountNotFoundError) Error() string {
 	return fmt.Sprintf("service account %q not found in namespace %q", e.Name, e.Namespace)
 }
 
+// ConflictError is returned when a TTL was changed by another actor since
+// the caller last observed it.
+type ConflictError struct {
+	Name     string
+	Expected int64
+	Actual   int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("TTL for release %q was modified concurrently (expected generation %d, found %d)", e.Name, e.Expected, e.Actual)
+}
+
 // SetTTLOptions contains the parameters for setting a TTL on a release.
 type SetTTLOptions struct {
-	ReleaseName          string
-	ReleaseNamespace     string
-	CronjobNamespace     string
+	ReleaseName      string
+	ReleaseNamespace string
+	CronjobNamespace string
+	// Duration falls back to the default of the release namespace's
+	// helm-ttl-config policy when empty.
 	Duration             string
 	ServiceAccount       string
 	CreateServiceAccount bool
 	HelmImage            string
 	KubectlImage         string
 	DeleteNamespace      bool
+	// FromReleaseAnnotation reads the duration from the release's
+	// helm-ttl.io/duration annotation when Duration is empty.
+	FromReleaseAnnotation bool
+	// ValuesKey, when set, reads the duration from this dot-separated key
+	// of the release's values, e.g. ttl, when Duration is empty. It takes
+	// precedence over FromReleaseAnnotation, which is used when the values
+	// do not set the key.
+	ValuesKey string
+	// ExpectedGeneration, when set, makes SetTTL fail with a ConflictError
+	// unless the existing TTL is at this generation (0 means no TTL exists).
+	ExpectedGeneration *int64
+	// IfNotExists makes SetTTL leave an existing TTL unchanged and return
+	// it with AlreadySet, so re-running set does not restart the countdown.
+	IfNotExists bool
+	// ExtendOnly makes SetTTL fail rather than move the expiry of an
+	// existing TTL earlier, and ShrinkOnly rather than move it later.
+	ExtendOnly bool
+	ShrinkOnly bool
+	Uninstall  UninstallOptions
+	Pod        PodOptions
+	// DateOrder controls how numeric dates in Duration are read. It
+	// falls back to HELM_TTL_DATE_ORDER and defaults to strict.
+	DateOrder string
+	// MinDuration is the shortest TTL accepted. It falls back to
+	// HELM_TTL_MIN_DURATION and defaults to DefaultMinDuration.
+	MinDuration time.Duration
+	// AllowShort accepts a TTL shorter than MinDuration.
+	AllowShort bool
+	// ImagePullSecrets are attached to the uninstall pod. They fall back
+	// to the comma-separated HELM_TTL_IMAGE_PULL_SECRETS.
+	ImagePullSecrets []string
+	// RegistryPrefix rewrites the default images to pull from a mirror.
+	RegistryPrefix string
+	Security       SecurityOptions
+	// CleanupImage replaces kubectl with the API-only helm-ttl-cleanup
+	// image for namespace deletion and self-cleanup.
+	CleanupImage string
+	// Force sets the TTL even when the release or its namespace is
+	// marked with helm-ttl/protected.
+	Force bool
+	// NamespaceDeleteDelay waits this long after the uninstall before
+	// deleting the namespace. Requires DeleteNamespace.
+	NamespaceDeleteDelay time.Duration
+	// Driver is the Helm storage driver the release is stored with. It
+	// falls back to HELM_DRIVER and defaults to secrets, and decides the
+	// RBAC rules and the HELM_DRIVER of the uninstall Job.
+	Driver string
+	// ArgoCD tracks the CronJob and RBAC as part of the Argo CD
+	// Application managing the release.
+	ArgoCD ArgoCDOptions
+	// PostDelete removes leftovers of the release after the uninstall;
+	// the RBAC created with CreateServiceAccount allows it.
+	PostDelete PostDeleteOptions
+	// ExtraNamespaces are namespaces other than the release namespace the
+	// release creates resources in. CreateServiceAccount grants the
+	// uninstall access to them, derived from the release manifest.
+	ExtraNamespaces []string
+	// ServiceAccountAnnotations are added to the ServiceAccount created
+	// with CreateServiceAccount, e.g. for IRSA or GKE Workload Identity.
+	ServiceAccountAnnotations map[string]string
+	// CronJobLabels and CronJobAnnotations are added to the CronJob, its
+	// Job template and pod template, e.g. for cost allocation or to keep
+	// Karpenter from disrupting the uninstall.
+	CronJobLabels      map[string]string
+	CronJobAnnotations map[string]string
+	// SidecarInjection lets Istio and Linkerd inject their proxy into the
+	// uninstall pod, which is annotated against it by default.
+	SidecarInjection bool
+	// Job controls retries and deadlines of the uninstall Job.
+	Job JobOptions
+	// OnFailureWebhook is an http or https URL each failing step of the
+	// uninstall Job reports to, with the tail of its logs.
+	OnFailureWebhook string
+	// OnFailureWebhookProxy and OnFailureWebhookCA are the proxy URL the
+	// failure reports go through and the PEM certificates they trust.
+	OnFailureWebhookProxy string
+	OnFailureWebhookCA    []byte
+	// TwoPhaseGrace, when positive, makes the uninstall Job publish the
+	// release manifest with a helm uninstall --dry-run and wait this long
+	// before uninstalling; the RBAC created with CreateServiceAccount
+	// allows the publishing.
+	TwoPhaseGrace time.Duration
+	// AbortWindow, when positive, makes the uninstall Job wait this long
+	// before uninstalling, and stop as soon as the CronJob is annotated
+	// helm-ttl/abort=true.
+	AbortWindow time.Duration
+	// SkipPreflight skips checking that an existing service account has
+	// the permissions the uninstall needs.
+	SkipPreflight bool
+	// ScaleDownAfter, when set, is a duration or date, in the forms
+	// Duration takes, at which a first stage scales the Deployments and
+	// StatefulSets of the release to zero replicas, ahead of the
+	// uninstall at Duration. It needs the cronjob backend.
+	ScaleDownAfter string
 }
 
-// SetTTL sets or updates the TTL for a Helm release.
-func SetTTL(ctx context.Context, cfg *action.Configuration, client kubernetes.Interface, opts SetTTLOptions) error {
+// SetResult reports the TTL SetTTL created or updated.
+type SetResult struct {
+	ReleaseName      string `json:"release_name" yaml:"release_name"`
+	ReleaseNamespace string `json:"release_namespace" yaml:"release_namespace"`
+	CronjobNamespace string `json:"cronjob_namespace" yaml:"cronjob_namespace"`
+	CronJobName      string `json:"cronjob_name" yaml:"cronjob_name"`
+	// ExpiresAt is when the release will be uninstalled, the requested
+	// expiry rounded up to the minute.
+	ExpiresAt string `json:"expires_at" yaml:"expires_at"`
+	// RequestedAt is the expiry the duration asked for when ExpiresAt
+	// differs from it.
+	RequestedAt string `json:"requested_at,omitempty" yaml:"requested_at,omitempty"`
+	// ScaleDownAt is when the release will be scaled down to zero
+	// replicas, with ScaleDownAfter.
+	ScaleDownAt  string `json:"scale_down_at,omitempty" yaml:"scale_down_at,omitempty"`
+	CronSchedule string `json:"cron_schedule" yaml:"cron_schedule"`
+	Generation   int64  `json:"generation" yaml:"generation"`
+	// OldExpiry is the expiry of the TTL that was replaced, if any.
+	OldExpiry      string `json:"old_expiry,omitempty" yaml:"old_expiry,omitempty"`
+	ServiceAccount string `json:"service_account" yaml:"service_account"`
+	// RBAC lists the ServiceAccount and RBAC resources created or updated
+	// for the uninstall with CreateServiceAccount.
+	RBAC []OrphanedResource `json:"rbac,omitempty" yaml:"rbac,omitempty"`
+	// Warnings lists what was skipped to set the TTL, such as a policy
+	// that could not be read.
+	Warnings []string `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+	// AlreadySet reports that IfNotExists found a TTL and left it as is.
+	AlreadySet bool `json:"already_set,omitempty" yaml:"already_set,omitempty"`
+}
+
+// setPlan is what SetTTL and ExportTTL work out before changing anything.
+type setPlan struct {
+	now        time.Time
+	targetTime time.Time
+	// requestedTime is the expiry asked for, before targetTime was
+	// rounded up to the minute.
+	requestedTime time.Time
+	schedule      string
+	resourceName  string
+	saName        string
+	// existing is the CronJob of the current TTL, or nil without one.
+	existing *batchv1.CronJob
+	cj       *batchv1.CronJob
+	// scaleDown is the CronJob of the scale-down stage, or nil without
+	// ScaleDownAfter.
+	scaleDown *batchv1.CronJob
+	// namespaceRules are the rules granted in ExtraNamespaces.
+	namespaceRules map[string][]rbacv1.PolicyRule
+	// tracking is nil unless the TTL joins an Argo CD Application.
+	tracking *argoCDTracking
+	// backendRules are the rules the backend of the TTL needs.
+	backendRules []rbacv1.PolicyRule
+	warnings     []string
+}
+
+// planSet validates opts, filling in their defaults, and builds the
+// CronJob of the TTL without creating anything.
+func planSet(ctx context.Context, cfg *action.Configuration, client kubernetes.Interface, opts *SetTTLOptions) (*setPlan, error) {
 	// Validate release exists using storage directly
-	_, err := cfg.Releases.Last(opts.ReleaseName)
+	rel, err := cfg.Releases.Last(opts.ReleaseName)
+	if err != nil {
+		return nil, &ReleaseNotFoundError{Name: opts.ReleaseName}
+	}
+
+	if !opts.Force {
+		if err := CheckProtected(ctx, client, rel, opts.ReleaseNamespace); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Duration == "" && opts.ValuesKey != "" {
+		opts.Duration, err = DurationFromValues(rel, opts.ValuesKey)
+		_, notDeclared := err.(*DurationNotDeclaredError)
+		if err != nil && !(opts.FromReleaseAnnotation && notDeclared) {
+			return nil, err
+		}
+	}
+
+	if opts.Duration == "" && opts.FromReleaseAnnotation {
+		opts.Duration, err = DurationFromRelease(rel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pol, policyWarning, err := loadPolicy(ctx, client, opts.ReleaseNamespace)
 	if err != nil {
-		return &ReleaseNotFoundError{Name: opts.ReleaseName}
+		return nil, err
+	}
+
+	if opts.Duration == "" {
+		if pol.DefaultDuration == "" {
+			return nil, fmt.Errorf("no duration given and namespace %q has no %s in its %s ConfigMap", opts.ReleaseNamespace, policy.KeyDefaultDuration, policy.ConfigMapName)
+		}
+
+		opts.Duration = pol.DefaultDuration
+	}
+
+	if err := opts.Uninstall.Validate(); err != nil {
+		return nil, err
 	}
 
 	// Validate namespace separation if delete-namespace
 	if opts.DeleteNamespace && opts.ReleaseNamespace == opts.CronjobNamespace {
-		return fmt.Errorf("cannot use --delete-namespace when CronJob namespace (%s) equals release namespace (%s)", opts.CronjobNamespace, opts.ReleaseNamespace)
+		return nil, fmt.Errorf("cannot use --delete-namespace when CronJob namespace (%s) equals release namespace (%s)", opts.CronjobNamespace, opts.ReleaseNamespace)
+	}
+
+	if err := validateNamespaceDeleteDelay(opts.NamespaceDeleteDelay, opts.DeleteNamespace); err != nil {
+		return nil, err
+	}
+
+	if err := validateTwoPhaseGrace(opts.TwoPhaseGrace); err != nil {
+		return nil, err
+	}
+
+	if err := validateAbortWindow(opts.AbortWindow); err != nil {
+		return nil, err
+	}
+
+	if opts.Driver == "" {
+		opts.Driver = envDriver()
+	}
+
+	if _, err := StorageResource(opts.Driver); err != nil {
+		return nil, err
+	}
+
+	if len(opts.ServiceAccountAnnotations) > 0 && !opts.CreateServiceAccount {
+		return nil, fmt.Errorf("--service-account-annotation requires --create-service-account")
+	}
+
+	opts.ExtraNamespaces, err = validateExtraNamespaces(opts.ExtraNamespaces, opts.CreateServiceAccount, opts.ReleaseNamespace, opts.CronjobNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaceRules, err := manifestNamespaceRules(rel.Manifest, opts.ExtraNamespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	dateOrder := opts.DateOrder
+	if dateOrder == "" {
+		dateOrder = os.Getenv("HELM_TTL_DATE_ORDER")
+	}
+
+	order, err := ParseDateOrder(dateOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	pullSecrets := opts.ImagePullSecrets
+	if len(pullSecrets) == 0 {
+		pullSecrets = envImagePullSecrets()
 	}
 
 	now := time.Now()
-	targetTime, err := ParseTimeInput(opts.Duration, now)
+	targetTime, err := ParseTimeInputWithOrder(opts.Duration, now, order)
 	if err != nil {
-		return fmt.Errorf("invalid duration: %w", err)
+		return nil, fmt.Errorf("invalid duration: %w", err)
+	}
+
+	if !opts.AllowShort {
+		minimum, err := resolveMinDuration(opts.MinDuration)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkMinDuration(targetTime, now, minimum); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := pol.Check(targetTime, now); err != nil {
+		return nil, err
+	}
+
+	// Cron schedules have minute granularity: round up rather than let
+	// the schedule drop the seconds and fire early
+	requestedTime := targetTime
+	targetTime = roundUpToMinute(requestedTime)
+
+	var scaleDownAt time.Time
+	if opts.ScaleDownAfter != "" {
+		if backend := BackendOf(client); backend.Name() != BackendCronJob {
+			return nil, fmt.Errorf("the %s backend does not support --scale-down-after", backend.Name())
+		}
+
+		t, err := ParseTimeInputWithOrder(opts.ScaleDownAfter, now, order)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --scale-down-after: %w", err)
+		}
+
+		scaleDownAt = roundUpToMinute(t)
+		if !scaleDownAt.Before(targetTime) {
+			return nil, fmt.Errorf("invalid --scale-down-after: the scale-down at %s must come before the uninstall at %s",
+				FormatScheduledDate(scaleDownAt), FormatScheduledDate(targetTime))
+		}
 	}
 
 	schedule := TimeToCronSchedule(targetTime)
+	logger.Debug("parsed duration", "release", opts.ReleaseName, "input", opts.Duration, "dateOrder", string(order), "target", targetTime, "schedule", schedule)
 
-	resourceName, err := ResourceName(opts.ReleaseName, opts.ReleaseNamespace)
-	if err != nil {
-		return err
+	// An existing TTL keeps its name, which may predate hashed names
+	resourceName := ResourceName(opts.ReleaseName, opts.ReleaseNamespace)
+	existing, existingErr := findCronJob(ctx, client, opts.ReleaseName, opts.ReleaseNamespace, opts.CronjobNamespace)
+	if existingErr != nil && !errors.IsNotFound(existingErr) {
+		return nil, fmt.Errorf("failed to check existing CronJob: %w", existingErr)
+	}
+	if existingErr == nil {
+		resourceName = existing.Name
+	} else {
+		existing = nil
+	}
+
+	if existing != nil && (opts.ExtendOnly || opts.ShrinkOnly) {
+		if err := checkExpiryDirection(existing, targetTime, now, *opts); err != nil {
+			return nil, err
+		}
 	}
 
 	// Determine service account name
@@ -86,71 +403,518 @@ func SetTTL(ctx context.Context, cfg *action.Configuration, client kubernetes.In
 		saName = resourceName
 	}
 
-	// Create SA + RBAC if requested
-	if opts.CreateServiceAccount {
-		if err := CreateServiceAccountAndRBAC(ctx, client, opts.ReleaseName, opts.ReleaseNamespace, opts.CronjobNamespace, saName, opts.DeleteNamespace); err != nil {
-			return fmt.Errorf("failed to create service account and RBAC: %w", err)
+	// Build CronJob
+	cjOpts := CronJobOptions{
+		ReleaseName:      opts.ReleaseName,
+		ReleaseNamespace: opts.ReleaseNamespace,
+		CronjobNamespace: opts.CronjobNamespace,
+		Schedule:         schedule,
+		ServiceAccount:   saName,
+		HelmImage:        opts.HelmImage,
+		KubectlImage:     opts.KubectlImage,
+		DeleteNamespace:  opts.DeleteNamespace,
+		Uninstall:        opts.Uninstall,
+		Pod:              opts.Pod,
+		ImagePullSecrets: pullSecrets,
+		RegistryPrefix:   opts.RegistryPrefix,
+		Security:         opts.Security,
+		CleanupImage:     opts.CleanupImage,
+		Driver:           opts.Driver,
+		PostDelete:       opts.PostDelete,
+		Job:              opts.Job,
+		OnFailureWebhook: opts.OnFailureWebhook,
+		ExpiresAt:        targetTime,
+		RequestedAt:      requestedTime,
+		Duration:         requestedTime.Sub(now),
+		Name:             resourceName,
+		TwoPhaseGrace:    opts.TwoPhaseGrace,
+		AbortWindow:      opts.AbortWindow,
+		Labels:           opts.CronJobLabels,
+		Annotations:      opts.CronJobAnnotations,
+		SidecarInjection: opts.SidecarInjection,
+
+		NamespaceDeleteDelay:  opts.NamespaceDeleteDelay,
+		OnFailureWebhookProxy: opts.OnFailureWebhookProxy,
+		OnFailureWebhookCA:    opts.OnFailureWebhookCA,
+	}
+	cj, err := BuildCronJob(cjOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build CronJob: %w", err)
+	}
+
+	var scaleDown *batchv1.CronJob
+	if !scaleDownAt.IsZero() {
+		cj.Annotations[AnnotationScaleDownAt] = FormatScheduledDate(scaleDownAt.UTC())
+		scaleDown = BuildScaleDownCronJob(cj, cjOpts, scaleDownAt)
+	}
+	if len(opts.ExtraNamespaces) > 0 {
+		cj.Annotations[AnnotationExtraNamespaces] = strings.Join(opts.ExtraNamespaces, ",")
+	}
+	tracking := resolveArgoCDTracking(ctx, client, opts.ArgoCD)
+	tracking.apply(cj)
+	logManifest("built CronJob", cj)
+	if scaleDown != nil {
+		tracking.apply(scaleDown)
+		logManifest("built scale-down CronJob", scaleDown)
+	}
+
+	backend := BackendOf(client)
+	if _, err := backend.Object(cj, now); err != nil {
+		return nil, err
+	}
+
+	return &setPlan{
+		now:           now,
+		targetTime:    targetTime,
+		requestedTime: requestedTime,
+		schedule:      schedule,
+		resourceName:  resourceName,
+		saName:        saName,
+		existing:      existing,
+		cj:            cj,
+		scaleDown:     scaleDown,
+		tracking:      tracking,
+		backendRules:  backend.Rules(),
+		warnings:      warnings(policyWarning, precisionWarning(requestedTime, targetTime, now)),
+
+		namespaceRules: namespaceRules,
+	}, nil
+}
+
+// rbac returns the rbacSpec of the ServiceAccount and RBAC
+// CreateServiceAccount creates for the plan.
+func (p *setPlan) rbac(opts SetTTLOptions) rbacSpec {
+	spec := releaseRBAC(p.resourceName, opts.ReleaseName, opts.ReleaseNamespace, opts.CronjobNamespace, p.saName, opts.DeleteNamespace, opts.Driver)
+	spec.releaseRules = opts.PostDelete.Rules()
+	if p.scaleDown != nil {
+		spec.releaseRules = append(spec.releaseRules, scaleDownRules()...)
+	}
+	if opts.TwoPhaseGrace > 0 {
+		spec.cronjobRules = twoPhaseRules()
+	}
+	spec.cronjobRules = append(spec.cronjobRules, p.backendRules...)
+	spec.namespaceRules = p.namespaceRules
+	spec.userAnnotations = opts.ServiceAccountAnnotations
+
+	return spec
+}
+
+// SetTTL sets or updates the TTL for a Helm release.
+func SetTTL(ctx context.Context, cfg *action.Configuration, client kubernetes.Interface, opts SetTTLOptions) (*SetResult, error) {
+	if opts.IfNotExists {
+		result, err := existingSetResult(ctx, client, opts)
+		if result != nil || err != nil {
+			return result, err
+		}
+	}
+
+	plan, err := planSet(ctx, cfg, client, &opts)
+	if err != nil {
+		return nil, err
+	}
+	cj, existing, resourceName, saName := plan.cj, plan.existing, plan.resourceName, plan.saName
+	now, targetTime, schedule := plan.now, plan.targetTime, plan.schedule
+
+	// Check the expected generation before any write, so a rejected set
+	// leaves the RBAC untouched
+	var current int64
+	if existing != nil {
+		current = cronJobGeneration(existing)
+	}
+	if err := checkGeneration(opts.ReleaseName, opts.ExpectedGeneration, current); err != nil {
+		return nil, err
+	}
+
+	// Create SA + RBAC if requested; a backend running no Job needs neither
+	runsJobs := BackendOf(client).RunsJobs()
+	if !runsJobs {
+		opts.CreateServiceAccount = false
+	} else if opts.CreateServiceAccount {
+		if err := createServiceAccountAndRBAC(ctx, client, plan.rbac(opts), plan.tracking); err != nil {
+			return nil, fmt.Errorf("failed to create service account and RBAC: %w", err)
 		}
 	} else {
 		// Validate the service account exists
 		_, err := client.CoreV1().ServiceAccounts(opts.CronjobNamespace).Get(ctx, saName, metav1.GetOptions{})
 		if err != nil {
 			if errors.IsNotFound(err) {
-				return &ServiceAccountNotFoundError{Name: saName, Namespace: opts.CronjobNamespace}
+				return nil, &ServiceAccountNotFoundError{Name: saName, Namespace: opts.CronjobNamespace}
 			}
 
-			return fmt.Errorf("failed to check service account: %w", err)
+			return nil, fmt.Errorf("failed to check service account: %w", err)
+		}
+
+		// Fail now rather than when the TTL fires
+		if !opts.SkipPreflight {
+			if err := checkServiceAccountPermissions(ctx, client, plan.rbac(opts)); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	// Build CronJob
-	cj, err := BuildCronJob(CronJobOptions{
+	// Create or update CronJob
+	saved, replaced, err := saveCronJob(ctx, client, opts, cj, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	// Save the scale-down stage, or remove the one the replaced TTL had
+	if plan.scaleDown != nil || (replaced != nil && replaced.Annotations[AnnotationScaleDownAt] != "") {
+		if err := saveScaleDownCronJob(ctx, client, saved, plan.scaleDown); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		oldExpiry string
+		// dropped are extra namespaces the replaced TTL had access to
+		dropped []string
+	)
+	if replaced != nil {
+		oldExpiry = cronJobExpiry(replaced.Spec.Schedule, scheduleSetTime(replaced))
+		dropped = slices.DeleteFunc(cronJobExtraNamespaces(replaced), func(ns string) bool {
+			return slices.Contains(opts.ExtraNamespaces, ns)
+		})
+	}
+
+	// Revoke access to namespaces no longer listed (best effort)
+	for _, ns := range dropped {
+		_ = deleteNamespacedRBAC(ctx, client, resourceName, ns)
+	}
+
+	// Let Kubernetes garbage-collect the RBAC with the CronJob (best
+	// effort; cleanup-rbac still finds it otherwise)
+	if opts.CreateServiceAccount && opts.ReleaseNamespace == opts.CronjobNamespace {
+		_ = setRBACOwner(ctx, client, saved, saName)
+	}
+
+	// Let tooling find the TTL from the release itself (best effort)
+	_ = annotateReleaseStorage(ctx, client, opts.Driver, opts.ReleaseName, opts.ReleaseNamespace, saved.Namespace+"/"+saved.Name, targetTime)
+
+	// Record history and an event (best effort)
+	newExpiry := cronJobExpiry(schedule, now)
+	_ = RecordHistory(ctx, client, opts.ReleaseName, opts.ReleaseNamespace, opts.CronjobNamespace, HistoryEntry{
+		Operation: OperationSet,
+		OldExpiry: oldExpiry,
+		NewExpiry: newExpiry,
+	})
+	_ = recordEvent(ctx, client, saved, corev1.EventTypeNormal, EventReasonTTLSet,
+		fmt.Sprintf("TTL set for release %q in namespace %q: uninstall at %s", opts.ReleaseName, opts.ReleaseNamespace, newExpiry))
+
+	result := &SetResult{
 		ReleaseName:      opts.ReleaseName,
 		ReleaseNamespace: opts.ReleaseNamespace,
-		CronjobNamespace: opts.CronjobNamespace,
-		Schedule:         schedule,
-		ServiceAccount:   saName,
-		HelmImage:        opts.HelmImage,
-		KubectlImage:     opts.KubectlImage,
-		DeleteNamespace:  opts.DeleteNamespace,
-	})
+		CronjobNamespace: saved.Namespace,
+		CronJobName:      saved.Name,
+		ExpiresAt:        FormatScheduledDate(targetTime),
+		CronSchedule:     schedule,
+		Generation:       cronJobGeneration(saved),
+		OldExpiry:        oldExpiry,
+		Warnings:         plan.warnings,
+	}
+	if !plan.requestedTime.Equal(targetTime) {
+		result.RequestedAt = FormatScheduledDate(plan.requestedTime)
+	}
+	if plan.scaleDown != nil {
+		result.ScaleDownAt = plan.cj.Annotations[AnnotationScaleDownAt]
+	}
+	if runsJobs {
+		result.ServiceAccount = saName
+	}
+	if opts.CreateServiceAccount {
+		result.RBAC = plan.rbac(opts).resources()
+	}
+
+	return result, nil
+}
+
+// checkExpiryDirection fails when moving the expiry of the existing TTL to
+// targetTime goes against ExtendOnly or ShrinkOnly.
+func checkExpiryDirection(existing *batchv1.CronJob, targetTime, now time.Time, opts SetTTLOptions) error {
+	current, _, err := resolveExpiry(existing, now)
 	if err != nil {
-		return fmt.Errorf("failed to build CronJob: %w", err)
+		return fmt.Errorf("failed to parse CronJob schedule: %w", err)
 	}
 
-	// Create or update CronJob
-	existing, err := client.BatchV1().CronJobs(opts.CronjobNamespace).Get(ctx, resourceName, metav1.GetOptions{})
+	if opts.ExtendOnly && targetTime.Before(current) {
+		return fmt.Errorf("refusing to move the expiry of release %q earlier, from %s to %s", opts.ReleaseName, FormatScheduledDate(current), FormatScheduledDate(targetTime))
+	}
+	if opts.ShrinkOnly && targetTime.After(current) {
+		return fmt.Errorf("refusing to move the expiry of release %q later, from %s to %s", opts.ReleaseName, FormatScheduledDate(current), FormatScheduledDate(targetTime))
+	}
+
+	return nil
+}
+
+// existingSetResult describes the TTL a release already has for
+// IfNotExists, or returns nil without one.
+func existingSetResult(ctx context.Context, client kubernetes.Interface, opts SetTTLOptions) (*SetResult, error) {
+	cj, err := findCronJob(ctx, client, opts.ReleaseName, opts.ReleaseNamespace, opts.CronjobNamespace)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
 	if err != nil {
-		if !errors.IsNotFound(err) {
-			return fmt.Errorf("failed to check existing CronJob: %w", err)
+		return nil, fmt.Errorf("failed to check existing CronJob: %w", err)
+	}
+
+	info, err := ttlInfo(cj, opts.ReleaseName, opts.ReleaseNamespace, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SetResult{
+		ReleaseName:      opts.ReleaseName,
+		ReleaseNamespace: opts.ReleaseNamespace,
+		CronjobNamespace: cj.Namespace,
+		CronJobName:      cj.Name,
+		ExpiresAt:        info.ScheduledDate,
+		CronSchedule:     cj.Spec.Schedule,
+		Generation:       info.Generation,
+		AlreadySet:       true,
+	}
+	if BackendOf(client).RunsJobs() {
+		result.ServiceAccount = cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName
+	}
+
+	return result, nil
+}
+
+// saveCronJob creates the CronJob of a TTL, or server-side applies it
+// over the existing one, returning the saved CronJob and the one it
+// replaced, if any. A write that lost a race with another writer is
+// retried on the latest CronJob, so overlapping sets all succeed and the
+// last one wins; with an ExpectedGeneration it fails with a ConflictError
+// instead.
+func saveCronJob(ctx context.Context, client kubernetes.Interface, opts SetTTLOptions, cj, existing *batchv1.CronJob) (saved, replaced *batchv1.CronJob, err error) {
+	cronJobs := client.BatchV1().CronJobs(opts.CronjobNamespace)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var err error
+		if existing == nil {
+			created := cj.DeepCopy()
+			setGeneration(created, 1)
+			saved, err = cronJobs.Create(ctx, created, metav1.CreateOptions{FieldManager: FieldManager})
+			if errors.IsAlreadyExists(err) {
+				if opts.ExpectedGeneration != nil {
+					return serverConflict(ctx, client, opts.ReleaseName, opts.CronjobNamespace, cj.Name, 0)
+				}
+
+				// Lost a race with another writer; retry over its CronJob
+				latest, getErr := cronJobs.Get(ctx, cj.Name, metav1.GetOptions{})
+				if getErr != nil {
+					return fmt.Errorf("failed to get CronJob: %w", getErr)
+				}
+				existing = latest
+
+				return errors.NewConflict(batchv1.Resource("cronjobs"), cj.Name, err)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to create CronJob: %w", err)
+			}
+
+			return nil
 		}
 
-		// Create new
-		_, err = client.BatchV1().CronJobs(opts.CronjobNamespace).Create(ctx, cj, metav1.CreateOptions{})
+		upgraded, err := upgradeManagedFields(ctx, cronJobs, existing)
 		if err != nil {
-			return fmt.Errorf("failed to create CronJob: %w", err)
+			return err
+		}
+
+		// The resource version makes the apply fail with a conflict if the
+		// CronJob changed since it was read, keeping the generation exact
+		current := cronJobGeneration(upgraded)
+		desired := cj.DeepCopy()
+		desired.Name = upgraded.Name
+		desired.ResourceVersion = upgraded.ResourceVersion
+		setGeneration(desired, current+1)
+		ac := batchv1ac.CronJob(desired.Name, desired.Namespace)
+		if err := toApplyConfiguration(desired, ac); err != nil {
+			return err
+		}
+
+		saved, err = cronJobs.Apply(ctx, ac, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+		if errors.IsConflict(err) {
+			if opts.ExpectedGeneration != nil {
+				return serverConflict(ctx, client, opts.ReleaseName, opts.CronjobNamespace, existing.Name, current)
+			}
+
+			latest, getErr := cronJobs.Get(ctx, existing.Name, metav1.GetOptions{})
+			switch {
+			case errors.IsNotFound(getErr):
+				// Removed meanwhile; retry as a create
+				existing = nil
+			case getErr != nil:
+				return fmt.Errorf("failed to get CronJob: %w", getErr)
+			default:
+				existing = latest
+			}
+
+			return err
 		}
-	} else {
-		// Update existing
-		existing.Spec = cj.Spec
-		existing.Labels = cj.Labels
-		_, err = client.BatchV1().CronJobs(opts.CronjobNamespace).Update(ctx, existing, metav1.UpdateOptions{})
 		if err != nil {
 			return fmt.Errorf("failed to update CronJob: %w", err)
 		}
+
+		replaced = existing
+		return nil
+	})
+	if errors.IsConflict(err) {
+		return nil, nil, fmt.Errorf("failed to save CronJob: still conflicting after %d attempts: %w", retry.DefaultRetry.Steps, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A new expiry is a new decision; an earlier abort does not cancel it
+	saved, err = clearAbort(ctx, cronJobs, saved)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return saved, replaced, nil
+}
+
+// loadPolicy reads the TTL policy of a namespace. Users who may not read
+// its policy ConfigMap get the zero policy and a warning instead of an
+// error, so set and extend need no more RBAC than before policies existed.
+func loadPolicy(ctx context.Context, client kubernetes.Interface, namespace string) (*policy.Policy, string, error) {
+	pol, err := policy.Load(ctx, client, namespace)
+	if err != nil {
+		if errors.IsForbidden(err) {
+			logger.Debug("policy ConfigMap not readable, applying no policy", "namespace", namespace, "error", err)
+			return &policy.Policy{Namespace: namespace}, fmt.Sprintf("no TTL policy applied: not allowed to read the %s ConfigMap in namespace %q", policy.ConfigMapName, namespace), nil
+		}
+
+		return nil, "", err
+	}
+
+	return pol, "", nil
+}
+
+// warnings returns the non-empty messages, or nil when there are none.
+func warnings(msgs ...string) []string {
+	var out []string
+	for _, m := range msgs {
+		if m != "" {
+			out = append(out, m)
+		}
+	}
+
+	return out
+}
+
+// checkGeneration returns a ConflictError when the caller expects a
+// different generation than the current one.
+func checkGeneration(releaseName string, expected *int64, current int64) error {
+	if expected != nil && *expected != current {
+		return &ConflictError{Name: releaseName, Expected: *expected, Actual: current}
 	}
 
 	return nil
 }
 
-// GetTTL retrieves the TTL information for a Helm release.
-func GetTTL(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace, cronjobNamespace string) (*TTLInfo, error) {
-	resourceName, err := ResourceName(releaseName, releaseNamespace)
+// serverConflict builds a ConflictError after the API server rejected a
+// write because the CronJob changed since it was read.
+func serverConflict(ctx context.Context, client kubernetes.Interface, releaseName, cronjobNamespace, resourceName string, observed int64) error {
+	actual := observed
+	latest, err := client.BatchV1().CronJobs(cronjobNamespace).Get(ctx, resourceName, metav1.GetOptions{})
+	if err == nil {
+		actual = cronJobGeneration(latest)
+	}
+
+	return &ConflictError{Name: releaseName, Expected: observed, Actual: actual}
+}
+
+// cronJobGeneration returns the TTL generation recorded on a CronJob.
+// CronJobs created before generations were tracked report 0.
+func cronJobGeneration(cj *batchv1.CronJob) int64 {
+	gen, err := strconv.ParseInt(cj.Annotations[AnnotationGeneration], 10, 64)
 	if err != nil {
-		return nil, err
+		return 0
+	}
+
+	return gen
+}
+
+// scheduleSetTime approximates when a CronJob's schedule was last written:
+// the latest non-status update recorded in its managed fields, or its
+// creation time. It is zero when neither is known.
+func scheduleSetTime(cj *batchv1.CronJob) time.Time {
+	var latest time.Time
+	for _, mf := range cj.ManagedFields {
+		if mf.Subresource == "" && mf.Time != nil && mf.Time.After(latest) {
+			latest = mf.Time.Time
+		}
 	}
 
-	cj, err := client.BatchV1().CronJobs(cronjobNamespace).Get(ctx, resourceName, metav1.GetOptions{})
+	if latest.IsZero() {
+		latest = cj.CreationTimestamp.Time
+	}
+
+	return latest
+}
+
+// resolveExpiry returns the time a TTL CronJob fires at and whether that
+// time was missed. The helm-ttl/expires-at annotation carries the year the
+// schedule lacks; without it, or when the schedule was edited since, the
+// year is inferred from when the schedule was written.
+func resolveExpiry(cj *batchv1.CronJob, now time.Time) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, cj.Annotations[AnnotationExpiresAt]); err == nil {
+		t = t.In(now.Location())
+		if TimeToCronSchedule(t) == cj.Spec.Schedule {
+			return t, t.Before(now), nil
+		}
+	}
+
+	return ResolveCronSchedule(cj.Spec.Schedule, scheduleSetTime(cj), now)
+}
+
+// setGeneration records the TTL generation on a CronJob.
+func setGeneration(cj *batchv1.CronJob, gen int64) {
+	if cj.Annotations == nil {
+		cj.Annotations = make(map[string]string)
+	}
+
+	cj.Annotations[AnnotationGeneration] = strconv.FormatInt(gen, 10)
+}
+
+// findCronJob returns the CronJob implementing a release TTL. It is
+// looked up by the helm-ttl/release and helm-ttl/release-namespace labels,
+// so the CronJob is found whatever it is named, e.g. by an older version
+// of helm-ttl. When the labels match nothing, or CronJobs cannot be
+// listed, it falls back to reading the CronJob named ResourceName. A
+// missing TTL returns the NotFound error of that read.
+func findCronJob(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace, cronjobNamespace string) (*batchv1.CronJob, error) {
+	cronJobs := client.BatchV1().CronJobs(cronjobNamespace)
+	name := ResourceName(releaseName, releaseNamespace)
+
+	list, err := cronJobs.List(ctx, metav1.ListOptions{LabelSelector: releaseSelector(releaseName, releaseNamespace)})
+	if err != nil {
+		logger.Debug("listing CronJobs failed, reading by name", "release", releaseName, "name", name, "error", err)
+	} else {
+		var found *batchv1.CronJob
+		for i := range list.Items {
+			cj := &list.Items[i]
+			if !ownedByRelease(cj, releaseName, releaseNamespace) {
+				continue
+			}
+
+			// Prefer the current name if an older CronJob lingers
+			if found == nil || cj.Name == name {
+				found = cj
+			}
+		}
+
+		if found != nil {
+			return found, nil
+		}
+	}
+
+	return cronJobs.Get(ctx, name, metav1.GetOptions{})
+}
+
+// GetTTL retrieves the TTL information for a Helm release.
+func GetTTL(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace, cronjobNamespace string) (*TTLInfo, error) {
+	cj, err := findCronJob(ctx, client, releaseName, releaseNamespace, cronjobNamespace)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			return nil, &TTLNotFoundError{Name: releaseName}
@@ -159,33 +923,120 @@ func GetTTL(ctx context.Context, client kubernetes.Interface, releaseName, relea
 		return nil, fmt.Errorf("failed to get CronJob: %w", err)
 	}
 
-	scheduledDate, err := ParseCronSchedule(cj.Spec.Schedule)
+	return ttlInfo(cj, releaseName, releaseNamespace, time.Now())
+}
+
+// ReleaseExists reports whether the release still has a record in the
+// storage of cfg. A TTL CronJob is left behind when its release is
+// uninstalled by hand, and get and unset would otherwise report on a TTL
+// that points at nothing.
+func ReleaseExists(cfg *action.Configuration, releaseName string) (bool, error) {
+	_, err := cfg.Releases.Last(releaseName)
+	if stderrors.Is(err, driver.ErrReleaseNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get release %q: %w", releaseName, err)
+	}
+
+	return true, nil
+}
+
+// CheckReleaseExists sets info.ReleaseExists from the storage of cfg,
+// adding a warning when the release is gone.
+func CheckReleaseExists(cfg *action.Configuration, info *TTLInfo) error {
+	exists, err := ReleaseExists(cfg, info.ReleaseName)
+	if err != nil {
+		return err
+	}
+
+	info.ReleaseExists = &exists
+	if !exists {
+		info.Warnings = append(info.Warnings, fmt.Sprintf("release %q not found in namespace %q: the TTL points at nothing and can be removed with helm ttl unset --orphans-ok", info.ReleaseName, info.ReleaseNamespace))
+	}
+
+	return nil
+}
+
+// CronJobInfo returns the TTLInfo of a helm-ttl CronJob, read from its
+// labels and schedule alone.
+func CronJobInfo(cj *batchv1.CronJob, now time.Time) (*TTLInfo, error) {
+	return ttlInfo(cj, OriginalLabelValue(cj, LabelRelease), OriginalLabelValue(cj, LabelReleaseNamespace), now)
+}
+
+// ttlInfo describes the TTL a CronJob implements.
+func ttlInfo(cj *batchv1.CronJob, releaseName, releaseNamespace string, now time.Time) (*TTLInfo, error) {
+	scheduledDate, missed, err := resolveExpiry(cj, now)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse CronJob schedule: %w", err)
 	}
 
+	remaining, remainingDuration := "missed", time.Duration(0)
+	if !missed {
+		remaining = FormatRemaining(scheduledDate.Sub(now))
+		remainingDuration = scheduledDate.Sub(now).Truncate(time.Minute)
+	}
+
 	deleteNs := cj.Labels[LabelDeleteNamespace] == "true"
 
 	return &TTLInfo{
 		ReleaseName:      releaseName,
 		ReleaseNamespace: releaseNamespace,
-		CronjobNamespace: cronjobNamespace,
+		CronjobNamespace: cj.Namespace,
 		ScheduledDate:    FormatScheduledDate(scheduledDate),
 		CronSchedule:     cj.Spec.Schedule,
 		DeleteNamespace:  deleteNs,
+		Generation:       cronJobGeneration(cj),
+		Remaining:        remaining,
+		Expired:          missed,
+		Missed:           missed,
+		Status:           cronJobStatus(cj),
+
+		RemainingDuration: FormatDuration(remainingDuration),
+		OriginalDuration:  cj.Annotations[AnnotationOriginalDuration],
+		RequestedDate:     requestedDate(cj, scheduledDate),
+		ScaleDownDate:     scaleDownDate(cj, now),
+		Warnings:          schemaWarnings(cj),
 	}, nil
 }
 
+// scaleDownDate returns when the scale-down stage of a TTL scales the
+// release down, or "" for a TTL without one.
+func scaleDownDate(cj *batchv1.CronJob, now time.Time) string {
+	t, err := time.Parse(time.RFC3339, cj.Annotations[AnnotationScaleDownAt])
+	if err != nil {
+		return ""
+	}
+
+	return FormatScheduledDate(t.In(now.Location()))
+}
+
+// requestedDate returns the expiry a TTL was set to before it was rounded
+// up to scheduledDate, or "" when it was not rounded or its schedule has
+// changed since.
+func requestedDate(cj *batchv1.CronJob, scheduledDate time.Time) string {
+	requested, err := time.Parse(time.RFC3339, cj.Annotations[AnnotationRequestedAt])
+	if err != nil || !roundUpToMinute(requested).Equal(scheduledDate) {
+		return ""
+	}
+
+	return FormatScheduledDate(requested.In(scheduledDate.Location()))
+}
+
 // UnsetTTL removes the TTL from a Helm release by deleting the CronJob
 // and cleaning up associated RBAC resources.
 func UnsetTTL(ctx context.Context, client kubernetes.Interface, releaseName, releaseNamespace, cronjobNamespace string) error {
-	resourceName, err := ResourceName(releaseName, releaseNamespace)
-	if err != nil {
-		return err
+	// Read the name and expiry before the CronJob is gone
+	resourceName := ResourceName(releaseName, releaseNamespace)
+	var oldExpiry string
+	cj, getErr := findCronJob(ctx, client, releaseName, releaseNamespace, cronjobNamespace)
+	if getErr == nil {
+		resourceName = cj.Name
+		oldExpiry = cronJobExpiry(cj.Spec.Schedule, scheduleSetTime(cj))
 	}
 
 	// Delete CronJob
-	err = client.BatchV1().CronJobs(cronjobNamespace).Delete(ctx, resourceName, metav1.DeleteOptions{})
+	err := client.BatchV1().CronJobs(cronjobNamespace).Delete(ctx, resourceName, metav1.DeleteOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
 			return &TTLNotFoundError{Name: releaseName}
@@ -194,73 +1045,309 @@ func UnsetTTL(ctx context.Context, client kubernetes.Interface, releaseName, rel
 		return fmt.Errorf("failed to delete CronJob: %w", err)
 	}
 
-	// Clean up RBAC resources (best effort)
-	_ = CleanupRBAC(ctx, client, releaseName, releaseNamespace, cronjobNamespace)
+	// Remove the scale-down stage, which Kubernetes also deletes with its
+	// owner (best effort)
+	if getErr == nil && cj.Annotations[AnnotationScaleDownAt] != "" {
+		_ = saveScaleDownCronJob(ctx, client, cj, nil)
+	}
+
+	// Clean up RBAC resources and release annotations (best effort)
+	_ = cleanupRBAC(ctx, client, resourceName, releaseNamespace, cronjobNamespace, cronJobExtraNamespaces(cj)...)
+	driver := envDriver()
+	if getErr == nil {
+		driver = cronJobDriver(cj)
+	}
+	_ = annotateReleaseStorage(ctx, client, driver, releaseName, releaseNamespace, "", time.Time{})
+
+	// Record history (best effort)
+	_ = RecordHistory(ctx, client, releaseName, releaseNamespace, cronjobNamespace, HistoryEntry{
+		Operation: OperationUnset,
+		OldExpiry: oldExpiry,
+	})
+
+	// Record an event (best effort)
+	if getErr == nil {
+		_ = recordEvent(ctx, client, cj, corev1.EventTypeNormal, EventReasonTTLUnset,
+			fmt.Sprintf("TTL removed for release %q in namespace %q", releaseName, releaseNamespace))
+	}
 
 	return nil
 }
 
+// UnsetResult reports the outcome of removing one TTL in a batch unset.
+type UnsetResult struct {
+	ReleaseName      string `json:"release_name" yaml:"release_name"`
+	ReleaseNamespace string `json:"release_namespace" yaml:"release_namespace"`
+	// Expiry is when the removed TTL would have fired.
+	Expiry string `json:"expiry,omitempty" yaml:"expiry,omitempty"`
+	// Error is set when this TTL could not be removed.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// DurationSeconds is how long removing this TTL took.
+	DurationSeconds float64 `json:"duration_seconds,omitempty" yaml:"duration_seconds,omitempty"`
+}
+
+// UnsetTTLsOptions selects the TTLs removed by UnsetTTLs.
+type UnsetTTLsOptions struct {
+	ReleaseNamespace string
+	CronjobNamespace string
+	// Selector is a label selector matched against the release labels
+	// (helm install --labels). Empty matches every release with a TTL.
+	Selector string
+}
+
+// UnsetTTLs removes every TTL in a namespace whose release matches the
+// selector. A failure on one release is reported in its result and does
+// not stop the others.
+func UnsetTTLs(ctx context.Context, cfg *action.Configuration, client kubernetes.Interface, opts UnsetTTLsOptions) ([]UnsetResult, error) {
+	selector, err := labels.Parse(opts.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", opts.Selector, err)
+	}
+
+	ttls, err := listTTLs(ctx, client, opts.CronjobNamespace, opts.ReleaseNamespace, false)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []UnsetResult{}
+	for _, info := range ttls {
+		if !selector.Empty() {
+			rel, err := cfg.Releases.Last(info.ReleaseName)
+			if err != nil || !selector.Matches(labels.Set(rel.Labels)) {
+				continue
+			}
+		}
+
+		started := time.Now()
+		result := UnsetResult{
+			ReleaseName:      info.ReleaseName,
+			ReleaseNamespace: info.ReleaseNamespace,
+			Expiry:           info.ScheduledDate,
+		}
+		if err := UnsetTTL(ctx, client, info.ReleaseName, info.ReleaseNamespace, opts.CronjobNamespace); err != nil {
+			result.Error = err.Error()
+		}
+
+		result.DurationSeconds = time.Since(started).Seconds()
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
 // ContainerResult holds the exit information for a single container.
 type ContainerResult struct {
-	Name     string
-	ExitCode int32
+	Name     string `json:"name"`
+	ExitCode int32  `json:"exit_code"`
+	// StartedAt and FinishedAt come from the container status; they are
+	// empty when the kubelet did not report them.
+	StartedAt       string  `json:"started_at,omitempty"`
+	FinishedAt      string  `json:"finished_at,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
 }
 
 // RunTTLResult contains the result of running a TTL action.
 type RunTTLResult struct {
+	ReleaseName      string `json:"release_name"`
+	ReleaseNamespace string `json:"release_namespace"`
+	// NamespaceTTL reports a run of a namespace TTL, which uninstalls every
+	// release in ReleaseNamespace; ReleaseName is then empty.
+	NamespaceTTL     bool `json:"namespace_ttl,omitempty"`
+	DeletedNamespace bool `json:"deleted_namespace"`
+	JobFailed        bool `json:"job_failed"`
+	// ExitCode is the first non-zero container exit code, or 0.
+	ExitCode         int32             `json:"exit_code"`
+	ContainerResults []ContainerResult `json:"container_results,omitempty"`
+	// StartedAt and FinishedAt bound the whole run, from creating the Job
+	// to deleting the namespace.
+	StartedAt       string  `json:"started_at,omitempty"`
+	FinishedAt      string  `json:"finished_at,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+
+	// DryRun reports that nothing was created. DeletedNamespace then
+	// reports whether the run would delete the release namespace, and the
+	// fields below describe the rest of what it would do.
+	DryRun               bool               `json:"dry_run"`
+	NamespaceDeleteDelay string             `json:"namespace_delete_delay,omitempty"`
+	TwoPhaseGrace        string             `json:"two_phase_grace,omitempty"`
+	ResourceName         string             `json:"resource_name,omitempty"`
+	UninstallCommand     []string           `json:"uninstall_command,omitempty"`
+	Job                  *batchv1.Job       `json:"job,omitempty"`
+	RBAC                 []OrphanedResource `json:"rbac,omitempty"`
+
+	// KeptCronJob and KeptRBAC report that a failed run left the CronJob
+	// and its RBAC resources in place, so the TTL can fire again.
+	KeptCronJob bool `json:"kept_cronjob,omitempty"`
+	KeptRBAC    bool `json:"kept_rbac,omitempty"`
+}
+
+// logDrainTimeout is how long RunTTL lets a container's log stream finish
+// after the container terminates.
+var logDrainTimeout = 10 * time.Second
+
+const (
+	// DefaultRunTimeout bounds how long RunTTL waits for the Job.
+	DefaultRunTimeout = 10 * time.Minute
+	// DefaultRunPollInterval is how often RunTTL checks on the Job's pod.
+	DefaultRunPollInterval = time.Second
+)
+
+// DefaultSidecarContainers are the proxies Istio and Linkerd inject, which
+// RunTTL ignores unless told otherwise.
+var DefaultSidecarContainers = []string{"istio-proxy", "linkerd-proxy"}
+
+// RunTTLOptions contains the options for running a TTL immediately.
+type RunTTLOptions struct {
 	ReleaseName      string
 	ReleaseNamespace string
-	DeletedNamespace bool
-	JobFailed        bool
-	ContainerResults []ContainerResult
+	CronjobNamespace string
+	// DryRun only reports what the run would do.
+	DryRun bool
+	// Timeout bounds the wait for the Job's pod and containers, including
+	// any two-phase grace and namespace delete delay, so it must be longer
+	// than both.
+	// Zero waits until ctx is done.
+	Timeout time.Duration
+	// PollInterval is how often the pod is checked; it defaults to
+	// DefaultRunPollInterval.
+	PollInterval time.Duration
+	// SidecarContainers are the names of containers a service mesh
+	// injects into the pod despite its annotations. They run until the
+	// pod is deleted, so they are neither waited for nor fail the run.
+	// Nil defaults to DefaultSidecarContainers.
+	SidecarContainers []string
+	// CleanupRBACOnFailure removes the RBAC resources even when the run
+	// fails, leaving the CronJob unable to run again. By default they are
+	// kept until a run succeeds.
+	CleanupRBACOnFailure bool
+	// CleanupCronJobOnFailure deletes the CronJob even when the run fails.
+	// By default it is kept so the TTL can fire again; a run that succeeds
+	// deletes it from its pod.
+	CleanupCronJobOnFailure bool
 }
 
 // RunTTL immediately executes the TTL action for a release by creating a
 // Kubernetes Job from the CronJob's template, streaming container logs,
-// and checking exit codes.
-func RunTTL(ctx context.Context, client kubernetes.Interface, w io.Writer, logFetcher LogFetcher, releaseName, releaseNamespace, cronjobNamespace string) (*RunTTLResult, error) {
-	resourceName, err := ResourceName(releaseName, releaseNamespace)
-	if err != nil {
+// and checking exit codes. With opts.DryRun, it only reports what the run
+// would do.
+func RunTTL(ctx context.Context, client kubernetes.Interface, w io.Writer, logFetcher LogFetcher, opts RunTTLOptions) (*RunTTLResult, error) {
+	if err := opts.validate(); err != nil {
 		return nil, err
 	}
 
+	if backend := BackendOf(client); !backend.RunsJobs() {
+		return nil, fmt.Errorf("the %s backend runs no uninstall Job; helm ttl controller uninstalls the release when its TTL expires", backend.Name())
+	}
+
 	// Look up the CronJob to verify TTL exists and get configuration
-	cj, err := client.BatchV1().CronJobs(cronjobNamespace).Get(ctx, resourceName, metav1.GetOptions{})
+	cj, err := findCronJob(ctx, client, opts.ReleaseName, opts.ReleaseNamespace, opts.CronjobNamespace)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			return nil, &TTLNotFoundError{Name: releaseName}
+			return nil, &TTLNotFoundError{Name: opts.ReleaseName}
 		}
 
 		return nil, fmt.Errorf("failed to get CronJob: %w", err)
 	}
 
+	return runCronJob(ctx, client, w, logFetcher, cj, opts)
+}
+
+// validate rejects negative timeouts and poll intervals.
+func (opts RunTTLOptions) validate() error {
+	if opts.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s: must not be negative", opts.Timeout)
+	}
+	if opts.PollInterval < 0 {
+		return fmt.Errorf("invalid poll interval %s: must not be negative", opts.PollInterval)
+	}
+
+	return nil
+}
+
+// runCronJob runs a TTL CronJob as a Job for RunTTL and RunNamespaceTTL.
+// The release name is empty for a namespace TTL, whose history is not
+// recorded.
+func runCronJob(ctx context.Context, client kubernetes.Interface, w io.Writer, logFetcher LogFetcher, cj *batchv1.CronJob, opts RunTTLOptions) (*RunTTLResult, error) {
+	releaseName, releaseNamespace, cronjobNamespace := opts.ReleaseName, opts.ReleaseNamespace, opts.CronjobNamespace
+	pollInterval := opts.PollInterval
+	if pollInterval == 0 {
+		pollInterval = DefaultRunPollInterval
+	}
+	sidecars := opts.SidecarContainers
+	if sidecars == nil {
+		sidecars = DefaultSidecarContainers
+	}
+
 	deleteNamespace := cj.Labels[LabelDeleteNamespace] == "true"
+	deleteDelay, _ := time.ParseDuration(cj.Annotations[AnnotationNamespaceDeleteDelay])
 
 	result := &RunTTLResult{
 		ReleaseName:      releaseName,
 		ReleaseNamespace: releaseNamespace,
+		NamespaceTTL:     IsNamespaceTTL(cj),
+	}
+	if deleteNamespace && deleteDelay > 0 {
+		result.NamespaceDeleteDelay = deleteDelay.String()
+		if !opts.DryRun && opts.Timeout > 0 && opts.Timeout <= deleteDelay {
+			return nil, fmt.Errorf("timeout %s must be longer than the namespace delete delay %s", opts.Timeout, deleteDelay)
+		}
+	}
+
+	// A two-phase Job waits its grace period before uninstalling
+	if grace, _ := time.ParseDuration(cj.Annotations[AnnotationTwoPhaseGrace]); grace > 0 {
+		result.TwoPhaseGrace = grace.String()
+		waits := grace
+		if deleteNamespace {
+			waits += deleteDelay
+		}
+		if !opts.DryRun && opts.Timeout > 0 && opts.Timeout <= waits {
+			return nil, fmt.Errorf("timeout %s must be longer than the two-phase grace %s plus any namespace delete delay", opts.Timeout, grace)
+		}
 	}
 
 	// Build and create the Job
+	resourceName := cj.Name
 	jobName := resourceName + "-run"
 	job := BuildJobFromCronJob(cj, jobName)
+	logManifest("built Job", job)
+
+	if opts.DryRun {
+		return previewRun(ctx, client, result, cj, job, resourceName, cronjobNamespace)
+	}
 
-	_, err = client.BatchV1().Jobs(cronjobNamespace).Create(ctx, job, metav1.CreateOptions{})
+	started := time.Now()
+	_, err := client.BatchV1().Jobs(cronjobNamespace).Create(ctx, job, metav1.CreateOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Job: %w", err)
 	}
 
+	// Record history (best effort)
+	if !result.NamespaceTTL {
+		_ = RecordHistory(ctx, client, releaseName, releaseNamespace, cronjobNamespace, HistoryEntry{
+			Operation: OperationRun,
+			OldExpiry: cronJobExpiry(cj.Spec.Schedule, scheduleSetTime(cj)),
+		})
+	}
+
 	// Watch pod and stream logs
+	waitCtx := ctx
+	if opts.Timeout > 0 {
+		var cancelWait context.CancelFunc
+		waitCtx, cancelWait = context.WithTimeout(ctx, opts.Timeout)
+		defer cancelWait()
+	}
+
 	var runErr error
 	func() {
-		pod, err := waitForPod(ctx, client, cronjobNamespace, jobName)
+		pod, err := waitForPod(waitCtx, client, cronjobNamespace, jobName, pollInterval)
 		if err != nil {
 			runErr = err
 			return
 		}
 
 		// Process init containers, then main containers from the actual pod
-		// so we capture any injected sidecars
+		// so we capture any injected containers, except the mesh proxies
+		// that never terminate
 		allContainers := make([]string, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
 		for _, c := range pod.Spec.InitContainers {
 			allContainers = append(allContainers, c.Name)
@@ -268,23 +1355,50 @@ func RunTTL(ctx context.Context, client kubernetes.Interface, w io.Writer, logFe
 		for _, c := range pod.Spec.Containers {
 			allContainers = append(allContainers, c.Name)
 		}
+		allContainers = slices.DeleteFunc(allContainers, func(name string) bool {
+			return slices.Contains(sidecars, name)
+		})
 
 		for _, containerName := range allContainers {
-			exitCode, err := waitForContainerTermination(ctx, client, cronjobNamespace, pod.Name, containerName)
-			if err != nil {
+			if err := waitForContainerStart(waitCtx, client, cronjobNamespace, pod.Name, containerName, pollInterval); err != nil {
 				runErr = err
 				return
 			}
 
-			_ = streamContainerLogs(ctx, logFetcher, w, cronjobNamespace, pod.Name, containerName)
+			// Follow the logs while the container runs, so a slow
+			// uninstall shows progress as it happens
+			streamCtx, cancelStream := context.WithCancel(waitCtx)
+			streamed := make(chan struct{})
+			go func() {
+				defer close(streamed)
+				_ = streamContainerLogs(streamCtx, logFetcher, w, cronjobNamespace, pod.Name, containerName)
+			}()
 
-			result.ContainerResults = append(result.ContainerResults, ContainerResult{
-				Name:     containerName,
-				ExitCode: exitCode,
-			})
+			terminated, err := waitForContainerTermination(waitCtx, client, cronjobNamespace, pod.Name, containerName, pollInterval)
+			if err == nil {
+				// A followed stream ends with the container; give it a
+				// moment to drain before cutting it off
+				select {
+				case <-streamed:
+				case <-time.After(logDrainTimeout):
+				}
+			}
+			cancelStream()
+			<-streamed
+
+			if err != nil {
+				runErr = err
+				return
+			}
+
+			result.ContainerResults = append(result.ContainerResults, containerResult(containerName, terminated))
 
-			if exitCode != 0 {
+			// The pod never restarts a failed container, so the ones after
+			// it may never start; stop at the first failure
+			if terminated.ExitCode != 0 {
 				result.JobFailed = true
+				result.ExitCode = terminated.ExitCode
+				return
 			}
 		}
 	}()
@@ -299,17 +1413,75 @@ func RunTTL(ctx context.Context, client kubernetes.Interface, w io.Writer, logFe
 		PropagationPolicy: &propagation,
 	})
 
-	// Clean up RBAC resources (best effort)
-	_ = CleanupRBAC(cleanupCtx, client, releaseName, releaseNamespace, cronjobNamespace)
+	// A failed run keeps the CronJob and RBAC unless told otherwise, so
+	// the TTL can fire again; a successful one deleted the CronJob from
+	// its pod
+	failed := runErr != nil || result.JobFailed
+	if failed && !opts.CleanupRBACOnFailure {
+		result.KeptRBAC = true
+	} else {
+		// Clean up RBAC resources (best effort)
+		_ = cleanupRBAC(cleanupCtx, client, resourceName, releaseNamespace, cronjobNamespace, cronJobExtraNamespaces(cj)...)
+	}
+	if failed && !containerSucceeded(result.ContainerResults, selfCleanupContainer) {
+		if opts.CleanupCronJobOnFailure {
+			// The kept RBAC is owned by the CronJob, so it must not be
+			// garbage collected with it
+			cronJobPropagation := metav1.DeletePropagationBackground
+			if result.KeptRBAC {
+				cronJobPropagation = metav1.DeletePropagationOrphan
+			}
+			_ = client.BatchV1().CronJobs(cronjobNamespace).Delete(cleanupCtx, resourceName, metav1.DeleteOptions{
+				PropagationPolicy: &cronJobPropagation,
+			})
+		} else {
+			result.KeptCronJob = true
+		}
+	}
 
-	// Handle namespace deletion
+	// Handle namespace deletion. The Job already waited out the delay when
+	// its delete-namespace container succeeded; otherwise wait it out here,
+	// within the run's timeout.
+	var nsErr error
 	if deleteNamespace {
-		err := client.CoreV1().Namespaces().Delete(cleanupCtx, releaseNamespace, metav1.DeleteOptions{})
-		if err != nil && !errors.IsNotFound(err) {
-			return nil, fmt.Errorf("failed to delete namespace: %w", err)
+		if deleteDelay > 0 && !containerSucceeded(result.ContainerResults, "delete-namespace") {
+			_, nsErr = waitNamespaceDeleteDelay(waitCtx, client, releaseNamespace, deleteDelay)
 		}
 
-		result.DeletedNamespace = true
+		if nsErr == nil {
+			deleteCtx, cancelDelete := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancelDelete()
+
+			err := client.CoreV1().Namespaces().Delete(deleteCtx, releaseNamespace, metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				nsErr = fmt.Errorf("failed to delete namespace: %w", err)
+			} else {
+				result.DeletedNamespace = true
+			}
+		}
+	}
+	if runErr == nil {
+		runErr = nsErr
+	}
+
+	finished := time.Now()
+	result.StartedAt = FormatScheduledDate(started)
+	result.FinishedAt = FormatScheduledDate(finished)
+	result.DurationSeconds = finished.Sub(started).Seconds()
+
+	// Record an event (best effort); the delay may have outlived cleanupCtx
+	eventCtx, cancelEvent := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelEvent()
+	subject := fmt.Sprintf("release %q in namespace %q", releaseName, releaseNamespace)
+	if result.NamespaceTTL {
+		subject = fmt.Sprintf("the releases of namespace %q", releaseNamespace)
+	}
+	if runErr != nil || result.JobFailed {
+		_ = recordEvent(eventCtx, client, cj, corev1.EventTypeWarning, EventReasonTTLExpiredUninstall,
+			"helm ttl run failed to uninstall "+subject)
+	} else {
+		_ = recordEvent(eventCtx, client, cj, corev1.EventTypeNormal, EventReasonTTLExpiredUninstall,
+			"helm ttl run uninstalled "+subject)
 	}
 
 	if runErr != nil {
@@ -323,3 +1495,37 @@ func RunTTL(ctx context.Context, client kubernetes.Interface, w io.Writer, logFe
 	return result, nil
 }
 
+// containerSucceeded reports whether the named container exited 0.
+func containerSucceeded(results []ContainerResult, name string) bool {
+	for _, r := range results {
+		if r.Name == name {
+			return r.ExitCode == 0
+		}
+	}
+
+	return false
+}
+
+// previewRun fills in a dry-run result for RunTTL without creating or
+// deleting anything.
+func previewRun(ctx context.Context, client kubernetes.Interface, result *RunTTLResult, cj *batchv1.CronJob, job *batchv1.Job, resourceName, cronjobNamespace string) (*RunTTLResult, error) {
+	rbac, err := existingRBAC(ctx, client, resourceName, result.ReleaseNamespace, cronjobNamespace, cronJobExtraNamespaces(cj)...)
+	if err != nil {
+		return nil, err
+	}
+
+	job.TypeMeta = metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"}
+	for _, c := range job.Spec.Template.Spec.InitContainers {
+		if c.Name == "helm-uninstall" {
+			result.UninstallCommand = uninstallArgs(unwrappedCommand(c))
+		}
+	}
+
+	result.DryRun = true
+	result.ResourceName = resourceName
+	result.DeletedNamespace = cj.Labels[LabelDeleteNamespace] == "true"
+	result.Job = job
+	result.RBAC = rbac
+
+	return result, nil
+}
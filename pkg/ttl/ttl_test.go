@@ -14,8 +14,11 @@ import (
 	"github.com/stretchr/testify/require"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/fake"
 	k8stesting "k8s.io/client-go/testing"
 
@@ -25,6 +28,8 @@ import (
 	"helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
 )
 
 func setupTestRelease(t *testing.T, name, namespace string) (*action.Configuration, *storage.Storage) {
@@ -65,7 +70,7 @@ func TestSetTTL(t *testing.T) {
 		cfg, _ := setupTestRelease(t, "myapp", "default")
 		client := fake.NewClientset()
 
-		err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
 			ReleaseName:          "myapp",
 			ReleaseNamespace:     "default",
 			CronjobNamespace:     "default",
@@ -76,22 +81,29 @@ func TestSetTTL(t *testing.T) {
 		require.NoError(t, err)
 
 		// Verify CronJob was created
-		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 		require.NoError(t, err)
-		assert.Equal(t, "myapp-default-ttl", cj.Name)
+		assert.Equal(t, "myapp-4a0c226a-ttl", cj.Name)
 		assert.Equal(t, LabelManagedByValue, cj.Labels[LabelManagedBy])
+
+		// Verify the expiry is recorded with its year and guarded
+		expiresAt, err := time.Parse(time.RFC3339, cj.Annotations[AnnotationExpiresAt])
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(24*time.Hour), expiresAt, time.Minute)
+		assert.Equal(t, "expiry-guard", cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[0].Name)
+		assert.Equal(t, "24h", cj.Annotations[AnnotationOriginalDuration])
 	})
 
 	t.Run("sets TTL with existing service account", func(t *testing.T) {
 		cfg, _ := setupTestRelease(t, "myapp", "default")
-		client := fake.NewClientset(&corev1.ServiceAccount{
+		client := allowAccessReviews(fake.NewClientset(&corev1.ServiceAccount{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      "my-sa",
 				Namespace: "default",
 			},
-		})
+		}))
 
-		err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
 			ReleaseName:      "myapp",
 			ReleaseNamespace: "default",
 			CronjobNamespace: "default",
@@ -100,18 +112,81 @@ func TestSetTTL(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 		require.NoError(t, err)
 		assert.Equal(t, "my-sa", cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
 	})
 
+	t.Run("returns what was set", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "staging")
+		client := fake.NewClientset()
+		opts := SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "staging",
+			CronjobNamespace:     "ops",
+			Duration:             "24h",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			DeleteNamespace:      true,
+		}
+
+		result, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "myapp", result.ReleaseName)
+		assert.Equal(t, "staging", result.ReleaseNamespace)
+		assert.Equal(t, "ops", result.CronjobNamespace)
+		assert.Equal(t, "myapp-80081014-ttl", result.CronJobName)
+		assert.Equal(t, cj.Annotations[AnnotationExpiresAt], result.ExpiresAt)
+		assert.Equal(t, cj.Spec.Schedule, result.CronSchedule)
+		assert.Equal(t, int64(1), result.Generation)
+		assert.Empty(t, result.OldExpiry)
+		assert.Equal(t, "myapp-80081014-ttl", result.ServiceAccount)
+		assert.Equal(t, []OrphanedResource{
+			{Kind: "ServiceAccount", Name: "myapp-80081014-ttl", Namespace: "ops"},
+			{Kind: "Role", Name: "myapp-80081014-ttl", Namespace: "staging"},
+			{Kind: "RoleBinding", Name: "myapp-80081014-ttl", Namespace: "staging"},
+			{Kind: "Role", Name: "myapp-80081014-ttl", Namespace: "ops"},
+			{Kind: "RoleBinding", Name: "myapp-80081014-ttl", Namespace: "ops"},
+			{Kind: "ClusterRole", Name: "myapp-80081014-ttl"},
+			{Kind: "ClusterRoleBinding", Name: "myapp-80081014-ttl"},
+		}, result.RBAC)
+
+		// Updating reports the replaced expiry and the next generation
+		opts.Duration = "48h"
+		updated, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+		assert.NotEmpty(t, updated.OldExpiry)
+		assert.Equal(t, int64(2), updated.Generation)
+	})
+
+	t.Run("returns no RBAC for an existing service account", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := allowAccessReviews(fake.NewClientset(&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-sa", Namespace: "default"},
+		}))
+
+		result, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Duration:         "2h",
+			ServiceAccount:   "my-sa",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "my-sa", result.ServiceAccount)
+		assert.Nil(t, result.RBAC)
+	})
+
 	t.Run("fails when release not found", func(t *testing.T) {
 		mem := driver.NewMemory()
 		store := storage.Init(mem)
 		cfg := &action.Configuration{Releases: store}
 		client := fake.NewClientset()
 
-		err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
 			ReleaseName:          "nonexistent",
 			ReleaseNamespace:     "default",
 			CronjobNamespace:     "default",
@@ -128,7 +203,7 @@ func TestSetTTL(t *testing.T) {
 		cfg, _ := setupTestRelease(t, "myapp", "default")
 		client := fake.NewClientset()
 
-		err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
 			ReleaseName:      "myapp",
 			ReleaseNamespace: "default",
 			CronjobNamespace: "default",
@@ -144,7 +219,7 @@ func TestSetTTL(t *testing.T) {
 		cfg, _ := setupTestRelease(t, "myapp", "default")
 		client := fake.NewClientset()
 
-		err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
 			ReleaseName:          "myapp",
 			ReleaseNamespace:     "default",
 			CronjobNamespace:     "default",
@@ -161,7 +236,7 @@ func TestSetTTL(t *testing.T) {
 		cfg, _ := setupTestRelease(t, "myapp", "staging")
 		client := fake.NewClientset()
 
-		err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
 			ReleaseName:          "myapp",
 			ReleaseNamespace:     "staging",
 			CronjobNamespace:     "ops",
@@ -172,13 +247,46 @@ func TestSetTTL(t *testing.T) {
 		})
 		require.NoError(t, err)
 
-		cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "myapp-staging-ttl", metav1.GetOptions{})
+		cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
 		require.NoError(t, err)
 		assert.Equal(t, "true", cj.Labels[LabelDeleteNamespace])
 
-		// Verify init containers include namespace deletion
+		// Verify init containers include namespace deletion after the
+		// expiry guard
 		spec := cj.Spec.JobTemplate.Spec.Template.Spec
-		assert.Len(t, spec.InitContainers, 2)
+		assert.Len(t, spec.InitContainers, 4)
+		assert.Equal(t, "expiry-guard", spec.InitContainers[0].Name)
+		assert.Equal(t, "delete-namespace", spec.InitContainers[3].Name)
+	})
+
+	t.Run("namespace delete delay", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "staging")
+		client := fake.NewClientset()
+		opts := SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "staging",
+			CronjobNamespace:     "ops",
+			Duration:             "7d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			DeleteNamespace:      true,
+			NamespaceDeleteDelay: 10 * time.Minute,
+		}
+		_, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "10m0s", cj.Annotations[AnnotationNamespaceDeleteDelay])
+
+		// Updating without a delay drops the annotation
+		opts.NamespaceDeleteDelay = 0
+		_, err = SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+
+		cj, err = client.BatchV1().CronJobs("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, cj.Annotations, AnnotationNamespaceDeleteDelay)
 	})
 
 	t.Run("updates existing CronJob", func(t *testing.T) {
@@ -186,7 +294,7 @@ func TestSetTTL(t *testing.T) {
 		client := fake.NewClientset()
 
 		// Create initial TTL
-		err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
 			ReleaseName:          "myapp",
 			ReleaseNamespace:     "default",
 			CronjobNamespace:     "default",
@@ -197,12 +305,12 @@ func TestSetTTL(t *testing.T) {
 		require.NoError(t, err)
 
 		// Get initial schedule
-		cj1, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		cj1, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 		require.NoError(t, err)
 		schedule1 := cj1.Spec.Schedule
 
 		// Update TTL
-		err = SetTTL(ctx, cfg, client, SetTTLOptions{
+		_, err = SetTTL(ctx, cfg, client, SetTTLOptions{
 			ReleaseName:          "myapp",
 			ReleaseNamespace:     "default",
 			CronjobNamespace:     "default",
@@ -213,7 +321,7 @@ func TestSetTTL(t *testing.T) {
 		require.NoError(t, err)
 
 		// Verify schedule changed
-		cj2, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		cj2, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
 		require.NoError(t, err)
 		assert.NotEqual(t, schedule1, cj2.Spec.Schedule)
 	})
@@ -222,7 +330,7 @@ func TestSetTTL(t *testing.T) {
 		cfg, _ := setupTestRelease(t, "myapp", "default")
 		client := fake.NewClientset()
 
-		err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
 			ReleaseName:          "myapp",
 			ReleaseNamespace:     "default",
 			CronjobNamespace:     "default",
@@ -233,554 +341,2349 @@ func TestSetTTL(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "invalid duration")
 	})
-}
 
-func TestGetTTL(t *testing.T) {
-	ctx := context.Background()
+	t.Run("refuses a TTL shorter than the minimum", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
 
-	t.Run("gets existing TTL", func(t *testing.T) {
-		client := fake.NewClientset(&batchv1.CronJob{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-default-ttl",
-				Namespace: "default",
-				Labels: map[string]string{
-					LabelManagedBy:        LabelManagedByValue,
-					LabelRelease:          "myapp",
-					LabelReleaseNamespace: "default",
-					LabelCronjobNamespace: "default",
-					LabelDeleteNamespace:  "false",
-				},
-			},
-			Spec: batchv1.CronJobSpec{
-				Schedule: "30 14 15 3 *",
-			},
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "10s",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
 		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "TTL of 10s is shorter than the minimum of 5m")
+		assert.Contains(t, err.Error(), "--allow-short")
 
-		info, err := GetTTL(ctx, client, "myapp", "default", "default")
-		require.NoError(t, err)
-		assert.Equal(t, "myapp", info.ReleaseName)
-		assert.Equal(t, "default", info.ReleaseNamespace)
-		assert.Equal(t, "default", info.CronjobNamespace)
-		assert.Equal(t, "30 14 15 3 *", info.CronSchedule)
-		assert.False(t, info.DeleteNamespace)
+		_, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
 	})
 
-	t.Run("TTL not found", func(t *testing.T) {
+	t.Run("allow short", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
 		client := fake.NewClientset()
 
-		_, err := GetTTL(ctx, client, "myapp", "default", "default")
-		var notFound *TTLNotFoundError
-		assert.True(t, errors.As(err, &notFound))
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "10s",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			AllowShort:           true,
+		})
+		require.NoError(t, err)
 	})
 
-	t.Run("cross-namespace TTL", func(t *testing.T) {
-		client := fake.NewClientset(&batchv1.CronJob{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-staging-ttl",
-				Namespace: "ops",
-				Labels: map[string]string{
-					LabelManagedBy:        LabelManagedByValue,
-					LabelRelease:          "myapp",
-					LabelReleaseNamespace: "staging",
-					LabelCronjobNamespace: "ops",
-					LabelDeleteNamespace:  "true",
-				},
-			},
-			Spec: batchv1.CronJobSpec{
-				Schedule: "0 12 1 1 *",
-			},
-		})
+	t.Run("minimum from HELM_TTL_MIN_DURATION", func(t *testing.T) {
+		t.Setenv("HELM_TTL_MIN_DURATION", "2h")
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		opts := SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "1h",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		}
 
-		info, err := GetTTL(ctx, client, "myapp", "staging", "ops")
+		_, err := SetTTL(ctx, cfg, client, opts)
+		assert.ErrorContains(t, err, "TTL of 1h is shorter than the minimum of 2h")
+
+		opts.MinDuration = 30 * time.Minute
+		_, err = SetTTL(ctx, cfg, client, opts)
 		require.NoError(t, err)
-		assert.Equal(t, "staging", info.ReleaseNamespace)
-		assert.Equal(t, "ops", info.CronjobNamespace)
-		assert.True(t, info.DeleteNamespace)
+
+		t.Setenv("HELM_TTL_MIN_DURATION", "soon")
+		_, err = SetTTL(ctx, cfg, client, SetTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", Duration: "1h"})
+		assert.ErrorContains(t, err, `invalid HELM_TTL_MIN_DURATION "soon"`)
 	})
 }
 
-func TestUnsetTTL(t *testing.T) {
+func TestSetTTL_FromReleaseAnnotation(t *testing.T) {
 	ctx := context.Background()
 
-	t.Run("unsets existing TTL", func(t *testing.T) {
-		client := fake.NewClientset(&batchv1.CronJob{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-default-ttl",
-				Namespace: "default",
-				Labels: map[string]string{
-					LabelManagedBy:        LabelManagedByValue,
-					LabelRelease:          "myapp",
-					LabelReleaseNamespace: "default",
-				},
-			},
-			Spec: batchv1.CronJobSpec{
-				Schedule: "30 14 15 6 *",
-			},
-		})
+	t.Run("uses the chart annotation", func(t *testing.T) {
+		cfg, store := setupTestRelease(t, "myapp", "default")
+		rel, err := store.Last("myapp")
+		require.NoError(t, err)
+		rel.Chart.Metadata.Annotations = map[string]string{AnnotationDuration: "72h"}
+		require.NoError(t, store.Update(rel))
 
-		err := UnsetTTL(ctx, client, "myapp", "default", "default")
+		client := fake.NewClientset()
+		before := time.Now().Add(72 * time.Hour)
+		_, err = SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:           "myapp",
+			ReleaseNamespace:      "default",
+			CronjobNamespace:      "default",
+			ServiceAccount:        "default",
+			CreateServiceAccount:  true,
+			FromReleaseAnnotation: true,
+		})
 		require.NoError(t, err)
 
-		// Verify CronJob is gone
-		_, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
-		assert.Error(t, err)
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		after := time.Now().Add(72 * time.Hour)
+		assert.Contains(t, []string{TimeToCronSchedule(roundUpToMinute(before)), TimeToCronSchedule(roundUpToMinute(after))}, cj.Spec.Schedule)
 	})
 
-	t.Run("TTL not found", func(t *testing.T) {
+	t.Run("fails when the release declares no duration", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
 		client := fake.NewClientset()
 
-		err := UnsetTTL(ctx, client, "myapp", "default", "default")
-		var notFound *TTLNotFoundError
-		assert.True(t, errors.As(err, &notFound))
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:           "myapp",
+			ReleaseNamespace:      "default",
+			CronjobNamespace:      "default",
+			ServiceAccount:        "default",
+			CreateServiceAccount:  true,
+			FromReleaseAnnotation: true,
+		})
+
+		var notDeclared *DurationNotDeclaredError
+		assert.True(t, errors.As(err, &notDeclared))
 	})
+}
 
-	t.Run("cleans up RBAC on unset", func(t *testing.T) {
-		client := fake.NewClientset()
+func TestSetTTL_ValuesKey(t *testing.T) {
+	ctx := context.Background()
 
-		// Create RBAC and CronJob
-		err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-default-ttl", false)
-		require.NoError(t, err)
+	opts := func(fromAnnotation bool) SetTTLOptions {
+		return SetTTLOptions{
+			ReleaseName:           "myapp",
+			ReleaseNamespace:      "default",
+			CronjobNamespace:      "default",
+			ServiceAccount:        "default",
+			CreateServiceAccount:  true,
+			ValuesKey:             "ttl",
+			FromReleaseAnnotation: fromAnnotation,
+		}
+	}
 
-		_, err = client.BatchV1().CronJobs("default").Create(ctx, &batchv1.CronJob{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "myapp-default-ttl",
-				Namespace: "default",
-			},
-			Spec: batchv1.CronJobSpec{
-				Schedule: "30 14 15 6 *",
-			},
-		}, metav1.CreateOptions{})
+	t.Run("uses the value", func(t *testing.T) {
+		cfg, store := setupTestRelease(t, "myapp", "default")
+		rel, err := store.Last("myapp")
 		require.NoError(t, err)
+		rel.Config = map[string]interface{}{"ttl": "72h"}
+		rel.Chart.Metadata.Annotations = map[string]string{AnnotationDuration: "1h"}
+		require.NoError(t, store.Update(rel))
 
-		// Unset
-		err = UnsetTTL(ctx, client, "myapp", "default", "default")
+		client := fake.NewClientset()
+		before := time.Now().Add(72 * time.Hour)
+		_, err = SetTTL(ctx, cfg, client, opts(true))
 		require.NoError(t, err)
 
-		// Verify RBAC cleaned up
-		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
-		assert.Error(t, err)
-
-		_, err = client.RbacV1().Roles("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
-		assert.Error(t, err)
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		after := time.Now().Add(72 * time.Hour)
+		assert.Contains(t, []string{TimeToCronSchedule(roundUpToMinute(before)), TimeToCronSchedule(roundUpToMinute(after))}, cj.Spec.Schedule)
 	})
-}
-
-func TestReleaseNotFoundError(t *testing.T) {
-	err := &ReleaseNotFoundError{Name: "myapp"}
-	assert.Equal(t, `release "myapp" not found`, err.Error())
-}
 
-func TestTTLNotFoundError(t *testing.T) {
-	err := &TTLNotFoundError{Name: "myapp"}
-	assert.Equal(t, `no TTL set for release "myapp"`, err.Error())
-}
+	t.Run("falls back to the annotation", func(t *testing.T) {
+		cfg, store := setupTestRelease(t, "myapp", "default")
+		rel, err := store.Last("myapp")
+		require.NoError(t, err)
+		rel.Chart.Metadata.Annotations = map[string]string{AnnotationDuration: "72h"}
+		require.NoError(t, store.Update(rel))
 
-func TestServiceAccountNotFoundError(t *testing.T) {
-	err := &ServiceAccountNotFoundError{Name: "my-sa", Namespace: "default"}
-	assert.Equal(t, `service account "my-sa" not found in namespace "default"`, err.Error())
-}
+		client := fake.NewClientset()
+		before := time.Now().Add(72 * time.Hour)
+		_, err = SetTTL(ctx, cfg, client, opts(true))
+		require.NoError(t, err)
 
-func TestGetTTL_InvalidSchedule(t *testing.T) {
-	ctx := context.Background()
-	client := fake.NewClientset(&batchv1.CronJob{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "myapp-default-ttl",
-			Namespace: "default",
-			Labels: map[string]string{
-				LabelManagedBy: LabelManagedByValue,
-			},
-		},
-		Spec: batchv1.CronJobSpec{
-			Schedule: "invalid-schedule",
-		},
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		after := time.Now().Add(72 * time.Hour)
+		assert.Contains(t, []string{TimeToCronSchedule(roundUpToMinute(before)), TimeToCronSchedule(roundUpToMinute(after))}, cj.Spec.Schedule)
 	})
 
-	_, err := GetTTL(ctx, client, "myapp", "default", "default")
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to parse CronJob schedule")
-}
+	t.Run("fails when the values do not set the key", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
 
-func TestGetTTL_ResourceNameTooLong(t *testing.T) {
-	ctx := context.Background()
-	client := fake.NewClientset()
+		_, err := SetTTL(ctx, cfg, fake.NewClientset(), opts(false))
 
-	_, err := GetTTL(ctx, client, "a-very-long-release-name-that-will-exceed", "a-long-namespace", "default")
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "exceeds maximum length")
+		var notDeclared *DurationNotDeclaredError
+		require.True(t, errors.As(err, &notDeclared))
+		assert.Equal(t, "ttl", notDeclared.ValuesKey)
+	})
 }
 
-func TestUnsetTTL_ResourceNameTooLong(t *testing.T) {
+func TestSetTTL_Generation(t *testing.T) {
 	ctx := context.Background()
-	client := fake.NewClientset()
+	gen := func(n int64) *int64 { return &n }
 
-	err := UnsetTTL(ctx, client, "a-very-long-release-name-that-will-exceed", "a-long-namespace", "default")
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "exceeds maximum length")
-}
+	setOpts := func(expected *int64) SetTTLOptions {
+		return SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "1h",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			ExpectedGeneration:   expected,
+		}
+	}
 
-func TestSetTTL_CustomServiceAccountName(t *testing.T) {
-	ctx := context.Background()
-	cfg, _ := setupTestRelease(t, "myapp", "default")
-	client := fake.NewClientset()
+	t.Run("increments generation on every set", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
 
-	err := SetTTL(ctx, cfg, client, SetTTLOptions{
-		ReleaseName:          "myapp",
-		ReleaseNamespace:     "default",
-		CronjobNamespace:     "default",
-		Duration:             "24h",
-		ServiceAccount:       "custom-sa",
-		CreateServiceAccount: true,
+		_, err := SetTTL(ctx, cfg, client, setOpts(gen(0)))
+		require.NoError(t, err)
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), info.Generation)
+
+		_, err = SetTTL(ctx, cfg, client, setOpts(gen(1)))
+		require.NoError(t, err)
+		_, err = SetTTL(ctx, cfg, client, setOpts(nil))
+		require.NoError(t, err)
+		info, err = GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), info.Generation)
 	})
-	require.NoError(t, err)
 
-	// Verify the custom SA name was used (not the default resource name)
-	cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
-	require.NoError(t, err)
-	assert.Equal(t, "custom-sa", cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
-}
+	t.Run("stale generation on update", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		_, err := SetTTL(ctx, cfg, client, setOpts(nil))
+		require.NoError(t, err)
+		_, err = SetTTL(ctx, cfg, client, setOpts(nil))
+		require.NoError(t, err)
 
-func TestSetTTL_ResourceNameTooLong(t *testing.T) {
-	ctx := context.Background()
-	cfg, _ := setupTestRelease(t, "a-very-long-release-name-that-will-exceed", "default")
-	client := fake.NewClientset()
+		_, err = SetTTL(ctx, cfg, client, setOpts(gen(1)))
+		var conflict *ConflictError
+		require.True(t, errors.As(err, &conflict))
+		assert.Equal(t, int64(1), conflict.Expected)
+		assert.Equal(t, int64(2), conflict.Actual)
+	})
 
-	err := SetTTL(ctx, cfg, client, SetTTLOptions{
-		ReleaseName:          "a-very-long-release-name-that-will-exceed",
-		ReleaseNamespace:     "a-long-namespace",
-		CronjobNamespace:     "default",
-		Duration:             "1h",
-		ServiceAccount:       "default",
-		CreateServiceAccount: true,
+	t.Run("stale generation leaves RBAC untouched", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, setOpts(gen(1)))
+		var conflict *ConflictError
+		require.True(t, errors.As(err, &conflict))
+
+		sas, err := client.CoreV1().ServiceAccounts("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, sas.Items)
+		roles, err := client.RbacV1().Roles("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, roles.Items)
+	})
+
+	t.Run("expected generation but no TTL exists", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, setOpts(gen(2)))
+		var conflict *ConflictError
+		require.True(t, errors.As(err, &conflict))
+		assert.Equal(t, int64(0), conflict.Actual)
+	})
+
+	t.Run("CronJob created concurrently", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		raced := false
+		client.PrependReactor("create", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if raced {
+				return false, nil, nil
+			}
+
+			raced = true
+			other := action.(k8stesting.CreateAction).GetObject().(*batchv1.CronJob).DeepCopy()
+			setGeneration(other, 1)
+			require.NoError(t, client.Tracker().Add(other))
+
+			return true, nil, apierrors.NewAlreadyExists(batchv1.Resource("cronjobs"), other.Name)
+		})
+
+		result, err := SetTTL(ctx, cfg, client, setOpts(nil))
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), result.Generation)
+		assert.NotEmpty(t, result.OldExpiry)
+	})
+
+	t.Run("CronJob created concurrently with expected generation", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		client.PrependReactor("create", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewAlreadyExists(batchv1.Resource("cronjobs"), "myapp-4a0c226a-ttl")
+		})
+
+		_, err := SetTTL(ctx, cfg, client, setOpts(gen(0)))
+		var conflict *ConflictError
+		assert.True(t, errors.As(err, &conflict))
+	})
+
+	// concurrentUpdate makes the first update of the CronJob lose a race
+	// with another writer that bumps its generation.
+	concurrentUpdate := func(t *testing.T, client *fake.Clientset) {
+		raced := false
+		client.PrependReactor("patch", "cronjobs", onApply(func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if raced {
+				return false, nil, nil
+			}
+
+			raced = true
+			obj, err := client.Tracker().Get(batchv1.SchemeGroupVersion.WithResource("cronjobs"), "default", "myapp-4a0c226a-ttl")
+			require.NoError(t, err)
+			other := obj.(*batchv1.CronJob).DeepCopy()
+			setGeneration(other, cronJobGeneration(other)+1)
+			require.NoError(t, client.Tracker().Update(batchv1.SchemeGroupVersion.WithResource("cronjobs"), other, "default"))
+
+			return true, nil, apierrors.NewConflict(batchv1.Resource("cronjobs"), other.Name, fmt.Errorf("object was modified"))
+		}))
+	}
+
+	t.Run("CronJob updated concurrently", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		_, err := SetTTL(ctx, cfg, client, setOpts(nil))
+		require.NoError(t, err)
+		concurrentUpdate(t, client)
+
+		result, err := SetTTL(ctx, cfg, client, setOpts(nil))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), result.Generation)
+	})
+
+	t.Run("CronJob updated concurrently with expected generation", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		_, err := SetTTL(ctx, cfg, client, setOpts(nil))
+		require.NoError(t, err)
+		concurrentUpdate(t, client)
+
+		_, err = SetTTL(ctx, cfg, client, setOpts(gen(1)))
+		var conflict *ConflictError
+		require.True(t, errors.As(err, &conflict))
+		assert.Equal(t, int64(1), conflict.Expected)
+		assert.Equal(t, int64(2), conflict.Actual)
+	})
+
+	t.Run("CronJob keeps conflicting", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		_, err := SetTTL(ctx, cfg, client, setOpts(nil))
+		require.NoError(t, err)
+		client.PrependReactor("patch", "cronjobs", onApply(func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewConflict(batchv1.Resource("cronjobs"), "myapp-4a0c226a-ttl", fmt.Errorf("object was modified"))
+		}))
+
+		_, err = SetTTL(ctx, cfg, client, setOpts(nil))
+		assert.ErrorContains(t, err, "failed to save CronJob: still conflicting after 5 attempts")
+	})
+
+	t.Run("writes as the helm-ttl field manager", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		var managers []string
+		client.PrependReactor("*", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			switch a := action.(type) {
+			case k8stesting.CreateActionImpl:
+				managers = append(managers, a.CreateOptions.FieldManager)
+			case k8stesting.PatchActionImpl:
+				if a.PatchType == types.ApplyPatchType {
+					managers = append(managers, a.PatchOptions.FieldManager)
+				}
+			}
+
+			return false, nil, nil
+		})
+
+		_, err := SetTTL(ctx, cfg, client, setOpts(nil))
+		require.NoError(t, err)
+		_, err = SetTTL(ctx, cfg, client, setOpts(nil))
+		require.NoError(t, err)
+		assert.Equal(t, []string{FieldManager, FieldManager}, managers)
 	})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "exceeds maximum length")
 }
 
-func TestSetTTL_CreateServiceAccountError(t *testing.T) {
+func TestSetTTL_IfNotExists(t *testing.T) {
 	ctx := context.Background()
 	cfg, _ := setupTestRelease(t, "myapp", "default")
 	client := fake.NewClientset()
-	client.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
-		return true, nil, fmt.Errorf("simulated SA error")
-	})
+	setOpts := func(duration string) SetTTLOptions {
+		return SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             duration,
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			IfNotExists:          true,
+		}
+	}
 
-	err := SetTTL(ctx, cfg, client, SetTTLOptions{
-		ReleaseName:          "myapp",
-		ReleaseNamespace:     "default",
-		CronjobNamespace:     "default",
-		Duration:             "1h",
-		ServiceAccount:       "default",
-		CreateServiceAccount: true,
-	})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to create service account and RBAC")
+	first, err := SetTTL(ctx, cfg, client, setOpts("2d"))
+	require.NoError(t, err)
+	assert.False(t, first.AlreadySet)
+
+	second, err := SetTTL(ctx, cfg, client, setOpts("1h"))
+	require.NoError(t, err)
+	assert.True(t, second.AlreadySet)
+	assert.Equal(t, first.ExpiresAt, second.ExpiresAt)
+	assert.Equal(t, first.CronJobName, second.CronJobName)
+	assert.Equal(t, first.ServiceAccount, second.ServiceAccount)
+	assert.Equal(t, int64(1), second.Generation)
+
+	info, err := GetTTL(ctx, client, "myapp", "default", "default")
+	require.NoError(t, err)
+	assert.Equal(t, first.CronSchedule, info.CronSchedule)
+	assert.Equal(t, int64(1), info.Generation)
+
+	history, err := GetHistory(ctx, client, "myapp", "default", "default")
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
 }
 
-func TestSetTTL_SACheckError(t *testing.T) {
+func TestSetTTL_ExtendOnlyShrinkOnly(t *testing.T) {
 	ctx := context.Background()
 	cfg, _ := setupTestRelease(t, "myapp", "default")
 	client := fake.NewClientset()
-	client.PrependReactor("get", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
-		return true, nil, fmt.Errorf("simulated API error")
+	setOpts := func(duration string) SetTTLOptions {
+		return SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             duration,
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		}
+	}
+
+	// Without a TTL either guard passes
+	opts := setOpts("3d")
+	opts.ShrinkOnly = true
+	_, err := SetTTL(ctx, cfg, client, opts)
+	require.NoError(t, err)
+
+	t.Run("extend-only refuses an earlier expiry", func(t *testing.T) {
+		opts := setOpts("1h")
+		opts.ExtendOnly = true
+		_, err := SetTTL(ctx, cfg, client, opts)
+		assert.ErrorContains(t, err, `refusing to move the expiry of release "myapp" earlier, from `)
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), info.Generation)
 	})
 
-	err := SetTTL(ctx, cfg, client, SetTTLOptions{
-		ReleaseName:      "myapp",
-		ReleaseNamespace: "default",
-		CronjobNamespace: "default",
-		Duration:         "1h",
-		ServiceAccount:   "my-sa",
+	t.Run("shrink-only refuses a later expiry", func(t *testing.T) {
+		opts := setOpts("7d")
+		opts.ShrinkOnly = true
+		_, err := SetTTL(ctx, cfg, client, opts)
+		assert.ErrorContains(t, err, `refusing to move the expiry of release "myapp" later, from `)
+	})
+
+	t.Run("extend-only allows a later expiry", func(t *testing.T) {
+		opts := setOpts("7d")
+		opts.ExtendOnly = true
+		_, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
+	})
+
+	t.Run("shrink-only allows an earlier expiry", func(t *testing.T) {
+		opts := setOpts("1d")
+		opts.ShrinkOnly = true
+		_, err := SetTTL(ctx, cfg, client, opts)
+		require.NoError(t, err)
 	})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to check service account")
 }
 
-func TestSetTTL_CreateCronJobError(t *testing.T) {
+func TestSetTTL_KeepsFieldsOfOtherManagers(t *testing.T) {
 	ctx := context.Background()
 	cfg, _ := setupTestRelease(t, "myapp", "default")
 	client := fake.NewClientset()
-	client.PrependReactor("create", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
-		return true, nil, fmt.Errorf("simulated CronJob create error")
-	})
-
-	err := SetTTL(ctx, cfg, client, SetTTLOptions{
+	opts := SetTTLOptions{
 		ReleaseName:          "myapp",
 		ReleaseNamespace:     "default",
 		CronjobNamespace:     "default",
 		Duration:             "1h",
 		ServiceAccount:       "default",
 		CreateServiceAccount: true,
-	})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to create CronJob")
+	}
+
+	_, err := SetTTL(ctx, cfg, client, opts)
+	require.NoError(t, err)
+
+	// A policy controller labels the CronJob and the ServiceAccount
+	cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+	require.NoError(t, err)
+	cj.Labels["cost-center"] = "preview"
+	_, err = client.BatchV1().CronJobs("default").Update(ctx, cj, metav1.UpdateOptions{FieldManager: "policy-controller"})
+	require.NoError(t, err)
+	sa, err := client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+	require.NoError(t, err)
+	sa.Labels["cost-center"] = "preview"
+	_, err = client.CoreV1().ServiceAccounts("default").Update(ctx, sa, metav1.UpdateOptions{FieldManager: "policy-controller"})
+	require.NoError(t, err)
+
+	opts.Duration = "2h"
+	result, err := SetTTL(ctx, cfg, client, opts)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.Generation)
+
+	cj, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "preview", cj.Labels["cost-center"])
+	assert.Equal(t, result.CronSchedule, cj.Spec.Schedule)
+	sa, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "preview", sa.Labels["cost-center"])
 }
 
-func TestSetTTL_GetCronJobError(t *testing.T) {
+func TestConflictError(t *testing.T) {
+	err := &ConflictError{Name: "myapp", Expected: 1, Actual: 2}
+	assert.Equal(t, `TTL for release "myapp" was modified concurrently (expected generation 1, found 2)`, err.Error())
+}
+
+func TestSetTTL_UninstallOptions(t *testing.T) {
 	ctx := context.Background()
-	cfg, _ := setupTestRelease(t, "myapp", "default")
-	client := fake.NewClientset()
-	client.PrependReactor("get", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
-		return true, nil, fmt.Errorf("simulated API error")
+
+	t.Run("propagates uninstall flags", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "1h",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			Uninstall:            UninstallOptions{KeepHistory: true, NoHooks: true},
+		})
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		cmd := uninstallArgs(cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[1].Command)
+		assert.Contains(t, cmd, "--keep-history")
+		assert.Contains(t, cmd, "--no-hooks")
 	})
 
-	err := SetTTL(ctx, cfg, client, SetTTLOptions{
-		ReleaseName:          "myapp",
-		ReleaseNamespace:     "default",
-		CronjobNamespace:     "default",
-		Duration:             "1h",
-		ServiceAccount:       "default",
-		CreateServiceAccount: true,
+	t.Run("rejects invalid uninstall flags before creating resources", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "1h",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			Uninstall:            UninstallOptions{Cascade: "sideways"},
+		})
+		assert.Error(t, err)
+
+		sas, err := client.CoreV1().ServiceAccounts("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, sas.Items)
 	})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to check existing CronJob")
 }
 
-func TestSetTTL_UpdateCronJobError(t *testing.T) {
+func TestGetTTL(t *testing.T) {
 	ctx := context.Background()
+
+	t.Run("gets existing TTL", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-4a0c226a-ttl",
+				Namespace: "default",
+				Labels: map[string]string{
+					LabelManagedBy:        LabelManagedByValue,
+					LabelRelease:          "myapp",
+					LabelReleaseNamespace: "default",
+					LabelCronjobNamespace: "default",
+					LabelDeleteNamespace:  "false",
+				},
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "30 14 15 3 *",
+			},
+		})
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "myapp", info.ReleaseName)
+		assert.Equal(t, "default", info.ReleaseNamespace)
+		assert.Equal(t, "default", info.CronjobNamespace)
+		assert.Equal(t, "30 14 15 3 *", info.CronSchedule)
+		assert.False(t, info.DeleteNamespace)
+	})
+
+	t.Run("TTL not found", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		_, err := GetTTL(ctx, client, "myapp", "default", "default")
+		var notFound *TTLNotFoundError
+		assert.True(t, errors.As(err, &notFound))
+	})
+
+	t.Run("cross-namespace TTL", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-80081014-ttl",
+				Namespace: "ops",
+				Labels: map[string]string{
+					LabelManagedBy:        LabelManagedByValue,
+					LabelRelease:          "myapp",
+					LabelReleaseNamespace: "staging",
+					LabelCronjobNamespace: "ops",
+					LabelDeleteNamespace:  "true",
+				},
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "0 12 1 1 *",
+			},
+		})
+
+		info, err := GetTTL(ctx, client, "myapp", "staging", "ops")
+		require.NoError(t, err)
+		assert.Equal(t, "staging", info.ReleaseNamespace)
+		assert.Equal(t, "ops", info.CronjobNamespace)
+		assert.True(t, info.DeleteNamespace)
+	})
+}
+
+func TestCheckReleaseExists(t *testing.T) {
 	cfg, _ := setupTestRelease(t, "myapp", "default")
-	client := fake.NewClientset(&batchv1.CronJob{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "myapp-default-ttl",
-			Namespace: "default",
-		},
-		Spec: batchv1.CronJobSpec{
-			Schedule: "0 0 1 1 *",
-		},
+
+	exists, err := ReleaseExists(cfg, "myapp")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	info := &TTLInfo{ReleaseName: "myapp", ReleaseNamespace: "default"}
+	require.NoError(t, CheckReleaseExists(cfg, info))
+	require.NotNil(t, info.ReleaseExists)
+	assert.True(t, *info.ReleaseExists)
+	assert.Empty(t, info.Warnings)
+
+	info = &TTLInfo{ReleaseName: "gone", ReleaseNamespace: "default"}
+	require.NoError(t, CheckReleaseExists(cfg, info))
+	require.NotNil(t, info.ReleaseExists)
+	assert.False(t, *info.ReleaseExists)
+	require.Len(t, info.Warnings, 1)
+	assert.Contains(t, info.Warnings[0], `release "gone" not found in namespace "default"`)
+}
+
+func TestUnsetTTL(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("unsets existing TTL", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-4a0c226a-ttl",
+				Namespace: "default",
+				Labels: map[string]string{
+					LabelManagedBy:        LabelManagedByValue,
+					LabelRelease:          "myapp",
+					LabelReleaseNamespace: "default",
+				},
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "30 14 15 6 *",
+			},
+		})
+
+		err := UnsetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+
+		// Verify CronJob is gone
+		_, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("TTL not found", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		err := UnsetTTL(ctx, client, "myapp", "default", "default")
+		var notFound *TTLNotFoundError
+		assert.True(t, errors.As(err, &notFound))
+	})
+
+	t.Run("cleans up RBAC on unset", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		// Create RBAC and CronJob
+		err := CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false)
+		require.NoError(t, err)
+
+		_, err = client.BatchV1().CronJobs("default").Create(ctx, &batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-4a0c226a-ttl",
+				Namespace: "default",
+			},
+			Spec: batchv1.CronJobSpec{
+				Schedule: "30 14 15 6 *",
+			},
+		}, metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		// Unset
+		err = UnsetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+
+		// Verify RBAC cleaned up
+		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.Error(t, err)
+
+		_, err = client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.Error(t, err)
+	})
+}
+
+func TestReleaseNotFoundError(t *testing.T) {
+	err := &ReleaseNotFoundError{Name: "myapp"}
+	assert.Equal(t, `release "myapp" not found`, err.Error())
+}
+
+func TestTTLNotFoundError(t *testing.T) {
+	err := &TTLNotFoundError{Name: "myapp"}
+	assert.Equal(t, `no TTL set for release "myapp"`, err.Error())
+}
+
+func TestServiceAccountNotFoundError(t *testing.T) {
+	err := &ServiceAccountNotFoundError{Name: "my-sa", Namespace: "default"}
+	assert.Equal(t, `service account "my-sa" not found in namespace "default"`, err.Error())
+}
+
+func TestGetTTL_InvalidSchedule(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset(&batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-4a0c226a-ttl",
+			Namespace: "default",
+			Labels: map[string]string{
+				LabelManagedBy: LabelManagedByValue,
+			},
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule: "invalid-schedule",
+		},
+	})
+
+	_, err := GetTTL(ctx, client, "myapp", "default", "default")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse CronJob schedule")
+}
+
+func TestSetTTL_Driver(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("configmaps from HELM_DRIVER", func(t *testing.T) {
+		t.Setenv("HELM_DRIVER", "configmaps")
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "1h",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		})
+		require.NoError(t, err)
+
+		role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"configmaps"}, role.Rules[0].Resources)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Contains(t, cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[1].Env, corev1.EnvVar{Name: "HELM_DRIVER", Value: "configmaps"})
+	})
+
+	t.Run("rejects unsupported driver before creating resources", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "1h",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			Driver:               "memory",
+		})
+		assert.ErrorContains(t, err, `unsupported Helm storage driver "memory"`)
+
+		sas, err := client.CoreV1().ServiceAccounts("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, sas.Items)
+	})
+}
+
+func TestSetTTL_RBACOwner(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("same namespace RBAC is owned by the CronJob", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "1h",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		})
+		require.NoError(t, err)
+
+		role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		require.Len(t, role.OwnerReferences, 1)
+		assert.Equal(t, "CronJob", role.OwnerReferences[0].Kind)
+		assert.Equal(t, "myapp-4a0c226a-ttl", role.OwnerReferences[0].Name)
+
+		sa, err := client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Len(t, sa.OwnerReferences, 1)
+	})
+
+	t.Run("cross namespace RBAC keeps label-based cleanup", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "staging")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "staging",
+			CronjobNamespace:     "ops",
+			Duration:             "1h",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		})
+		require.NoError(t, err)
+
+		role, err := client.RbacV1().Roles("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, role.OwnerReferences)
+	})
+
+	t.Run("user service account is left alone", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := allowAccessReviews(fake.NewClientset(&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "default"}}))
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Duration:         "1h",
+			ServiceAccount:   "default",
+		})
+		require.NoError(t, err)
+
+		sa, err := client.CoreV1().ServiceAccounts("default").Get(ctx, "default", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, sa.OwnerReferences)
+	})
+}
+
+func TestSetTTL_CustomServiceAccountName(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset()
+
+	_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "24h",
+		ServiceAccount:       "custom-sa",
+		CreateServiceAccount: true,
+	})
+	require.NoError(t, err)
+
+	// Verify the custom SA name was used (not the default resource name)
+	cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "custom-sa", cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
+}
+
+// legacyTTL stores a TTL for myapp in default as it was created before
+// resource names were hashed: CronJob, RBAC and history ConfigMap all
+// named myapp-default-ttl.
+func legacyTTL(t *testing.T, client *fake.Clientset) {
+	t.Helper()
+	ctx := context.Background()
+
+	cj, err := BuildCronJob(CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Schedule:         TimeToCronSchedule(time.Now().Add(48 * time.Hour)),
+		ServiceAccount:   "myapp-default-ttl",
+		Name:             "myapp-default-ttl",
+	})
+	require.NoError(t, err)
+	cj.CreationTimestamp = metav1.Now()
+	_, err = client.BatchV1().CronJobs("default").Create(ctx, cj, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, createServiceAccountAndRBAC(ctx, client, releaseRBAC("myapp-default-ttl", "myapp", "default", "default", "myapp-default-ttl", false, "secrets"), nil))
+
+	history := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+		Name:        "myapp-default-ttl-history",
+		Namespace:   "default",
+		Labels:      releaseLabels("myapp", "default"),
+		Annotations: releaseAnnotations("myapp", "default"),
+	}}
+	require.NoError(t, encodeHistory(history, []HistoryEntry{{Operation: OperationSet, User: "alice"}}))
+	_, err = client.CoreV1().ConfigMaps("default").Create(ctx, history, metav1.CreateOptions{})
+	require.NoError(t, err)
+}
+
+func TestLegacyResourceNames(t *testing.T) {
+	ctx := context.Background()
+	cronJobNames := func(t *testing.T, client *fake.Clientset) []string {
+		t.Helper()
+
+		list, err := client.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+
+		names := make([]string, 0, len(list.Items))
+		for _, cj := range list.Items {
+			names = append(names, cj.Name)
+		}
+
+		return names
+	}
+
+	t.Run("get, extend and history", func(t *testing.T) {
+		client := fake.NewClientset()
+		legacyTTL(t, client)
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "myapp", info.ReleaseName)
+
+		_, err = ExtendTTL(ctx, client, ExtendTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", By: time.Hour})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"myapp-default-ttl"}, cronJobNames(t, client))
+
+		history, err := GetHistory(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, "alice", history[0].User)
+		assert.Equal(t, OperationExtend, history[1].Operation)
+		_, err = client.CoreV1().ConfigMaps("default").Get(ctx, HistoryConfigMapName("myapp", "default"), metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("set updates the CronJob in place", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		legacyTTL(t, client)
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "3d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"myapp-default-ttl"}, cronJobNames(t, client))
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-default-ttl", cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
+		assert.Contains(t, cj.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Command, "myapp-default-ttl")
+
+		sas, err := client.CoreV1().ServiceAccounts("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, sas.Items, 1)
+		assert.Equal(t, "myapp-default-ttl", sas.Items[0].Name)
+	})
+
+	t.Run("cleanup-rbac keeps the RBAC", func(t *testing.T) {
+		client := fake.NewClientset(releaseRecord("myapp", "default", "deployed"))
+		legacyTTL(t, client)
+
+		orphaned, err := CleanupOrphaned(ctx, client, CleanupOrphanedOptions{Namespaces: []string{"default"}})
+		require.NoError(t, err)
+		assert.Empty(t, orphaned)
+	})
+
+	t.Run("run", func(t *testing.T) {
+		client := fake.NewClientset()
+		legacyTTL(t, client)
+
+		result, err := RunTTL(ctx, client, io.Discard, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", DryRun: true})
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-default-ttl", result.ResourceName)
+		assert.Equal(t, "myapp-default-ttl-run", result.Job.Name)
+		assert.Len(t, result.RBAC, 3)
+	})
+
+	t.Run("unset removes the CronJob and RBAC", func(t *testing.T) {
+		client := fake.NewClientset()
+		legacyTTL(t, client)
+
+		require.NoError(t, UnsetTTL(ctx, client, "myapp", "default", "default"))
+		assert.Empty(t, cronJobNames(t, client))
+		_, err := client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+		_, err = client.RbacV1().RoleBindings("default").Get(ctx, "myapp-default-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("labels of another release do not match", func(t *testing.T) {
+		cj := extendTestCronJob(t, "my app", "default", time.Now().Add(time.Hour))
+		cj.Name = "my app-default-ttl"
+		cj.Labels[LabelRelease] = LabelValue("myapp")
+		client := fake.NewClientset(cj)
+
+		_, err := GetTTL(ctx, client, "myapp", "default", "default")
+		var notFound *TTLNotFoundError
+		assert.True(t, errors.As(err, &notFound))
+	})
+
+}
+
+func TestFindCronJob(t *testing.T) {
+	ctx := context.Background()
+	labelled := func(name string) *batchv1.CronJob {
+		cj := extendTestCronJob(t, "myapp", "default", time.Now().Add(time.Hour))
+		cj.Name = name
+		return cj
+	}
+
+	t.Run("by labels, whatever the name", func(t *testing.T) {
+		client := fake.NewClientset(labelled("renamed-by-hand"))
+
+		cj, err := findCronJob(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "renamed-by-hand", cj.Name)
+		require.Len(t, client.Actions(), 1)
+		assert.Equal(t, "list", client.Actions()[0].GetVerb())
+	})
+
+	t.Run("prefers the current name", func(t *testing.T) {
+		client := fake.NewClientset(labelled("myapp-default-ttl"), labelled("myapp-4a0c226a-ttl"), labelled("zz-myapp"))
+
+		cj, err := findCronJob(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-4a0c226a-ttl", cj.Name)
+	})
+
+	t.Run("falls back to the name without labels", func(t *testing.T) {
+		cj := labelled("myapp-4a0c226a-ttl")
+		cj.Labels = nil
+		client := fake.NewClientset(cj)
+
+		found, err := findCronJob(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-4a0c226a-ttl", found.Name)
+	})
+
+	t.Run("falls back to the name when listing fails", func(t *testing.T) {
+		buf := captureLogs(t)
+		client := fake.NewClientset(labelled("myapp-4a0c226a-ttl"))
+		client.PrependReactor("list", "cronjobs", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		found, err := findCronJob(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "myapp-4a0c226a-ttl", found.Name)
+		assert.Contains(t, buf.String(), `msg="listing CronJobs failed, reading by name" release=myapp name=myapp-4a0c226a-ttl error=forbidden`)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := findCronJob(ctx, fake.NewClientset(labelled("myapp-default-ttl")), "myapp", "staging", "default")
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+}
+
+func TestSetTTL_LongNames(t *testing.T) {
+	ctx := context.Background()
+	release := "pr-4821-preview-checkout-service-feature-payments-api"
+	namespace := "preview-pr-4821-checkout-service-feature-payments-api"
+	cfg, _ := setupTestRelease(t, release, namespace)
+	client := fake.NewClientset()
+
+	_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		ReleaseName:          release,
+		ReleaseNamespace:     namespace,
+		CronjobNamespace:     "default",
+		Duration:             "1d",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	})
+	require.NoError(t, err)
+
+	name := ResourceName(release, namespace)
+	assert.LessOrEqual(t, len(name), maxResourceNameLen)
+	cj, err := client.BatchV1().CronJobs("default").Get(ctx, name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, name, cj.Spec.JobTemplate.Spec.Template.Spec.ServiceAccountName)
+	_, err = client.RbacV1().RoleBindings(namespace).Get(ctx, name, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	info, err := GetTTL(ctx, client, release, namespace, "default")
+	require.NoError(t, err)
+	assert.Equal(t, release, info.ReleaseName)
+
+	_, err = ExtendTTL(ctx, client, ExtendTTLOptions{ReleaseName: release, ReleaseNamespace: namespace, CronjobNamespace: "default", By: time.Hour})
+	require.NoError(t, err)
+
+	history, err := GetHistory(ctx, client, release, namespace, "default")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	require.NoError(t, UnsetTTL(ctx, client, release, namespace, "default"))
+	_, err = client.RbacV1().RoleBindings(namespace).Get(ctx, name, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestSetTTL_CreateServiceAccountError(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset()
+	client.PrependReactor("patch", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("simulated SA error")
+	})
+
+	_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "1h",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create service account and RBAC")
+}
+
+func TestSetTTL_SACheckError(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset()
+	client.PrependReactor("get", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("simulated API error")
+	})
+
+	_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "default",
+		CronjobNamespace: "default",
+		Duration:         "1h",
+		ServiceAccount:   "my-sa",
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to check service account")
+}
+
+func TestSetTTL_CreateCronJobError(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset()
+	client.PrependReactor("create", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("simulated CronJob create error")
+	})
+
+	_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "1h",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create CronJob")
+}
+
+func TestSetTTL_GetCronJobError(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset()
+	client.PrependReactor("get", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("simulated API error")
+	})
+
+	_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "1h",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to check existing CronJob")
+}
+
+func TestSetTTL_UpdateCronJobError(t *testing.T) {
+	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset(&batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-4a0c226a-ttl",
+			Namespace: "default",
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule: "0 0 1 1 *",
+		},
+	})
+	client.PrependReactor("patch", "cronjobs", onApply(func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("simulated update error")
+	}))
+
+	_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "1h",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to update CronJob")
+}
+
+func TestGetTTL_APIError(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+	client.PrependReactor("get", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("simulated API error")
+	})
+
+	_, err := GetTTL(ctx, client, "myapp", "default", "default")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to get CronJob")
+}
+
+func TestUnsetTTLs(t *testing.T) {
+	ctx := context.Background()
+	expiry := time.Now().Add(48 * time.Hour).Truncate(time.Minute)
+
+	cfg := setupLabeledReleases(t, "default", map[string]map[string]string{
+		"cart":     {"team": "checkout"},
+		"payments": {"team": "checkout"},
+		"search":   {"team": "discovery"},
+	})
+	newClient := func() *fake.Clientset {
+		return fake.NewClientset(
+			extendTestCronJob(t, "cart", "default", expiry),
+			extendTestCronJob(t, "payments", "default", expiry),
+			extendTestCronJob(t, "search", "default", expiry),
+		)
+	}
+
+	t.Run("removes matching releases", func(t *testing.T) {
+		client := newClient()
+
+		results, err := UnsetTTLs(ctx, cfg, client, UnsetTTLsOptions{
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Selector:         "team=checkout",
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.Equal(t, "cart", results[0].ReleaseName)
+		assert.Equal(t, "payments", results[1].ReleaseName)
+		for _, r := range results {
+			assert.Empty(t, r.Error)
+			assert.NotEmpty(t, r.Expiry)
+		}
+
+		cronJobs, err := client.BatchV1().CronJobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, cronJobs.Items, 1)
+		assert.Equal(t, "search-81bd4a47-ttl", cronJobs.Items[0].Name)
+	})
+
+	t.Run("empty selector removes everything", func(t *testing.T) {
+		results, err := UnsetTTLs(ctx, cfg, newClient(), UnsetTTLsOptions{
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+		})
+		require.NoError(t, err)
+		assert.Len(t, results, 3)
+	})
+
+	t.Run("continues past failures", func(t *testing.T) {
+		client := newClient()
+		client.PrependReactor("delete", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.(k8stesting.DeleteAction).GetName() == "cart-589dfa7a-ttl" {
+				return true, nil, fmt.Errorf("forbidden")
+			}
+
+			return false, nil, nil
+		})
+
+		results, err := UnsetTTLs(ctx, cfg, client, UnsetTTLsOptions{
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		assert.Contains(t, results[0].Error, "forbidden")
+		assert.Empty(t, results[1].Error)
+		assert.Empty(t, results[2].Error)
+	})
+
+	t.Run("invalid selector", func(t *testing.T) {
+		_, err := UnsetTTLs(ctx, cfg, newClient(), UnsetTTLsOptions{Selector: "team in ("})
+		assert.ErrorContains(t, err, "invalid label selector")
+	})
+}
+
+func TestUnsetTTL_APIError(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+	client.PrependReactor("delete", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("simulated API error")
+	})
+
+	err := UnsetTTL(ctx, client, "myapp", "default", "default")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to delete CronJob")
+}
+
+// testLogFetcher returns a LogFetcher that returns canned log output.
+func testLogFetcher(logs string) LogFetcher {
+	return func(_ context.Context, _, _, _ string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(logs)), nil
+	}
+}
+
+// buildTestCronJob creates a CronJob with a proper job template for testing RunTTL.
+func buildTestCronJob(t *testing.T, releaseName, releaseNamespace, cronjobNamespace string, deleteNamespace bool) *batchv1.CronJob {
+	t.Helper()
+	cj, err := BuildCronJob(CronJobOptions{
+		ReleaseName:      releaseName,
+		ReleaseNamespace: releaseNamespace,
+		CronjobNamespace: cronjobNamespace,
+		Schedule:         "30 14 15 3 *",
+		ServiceAccount:   "default",
+		HelmImage:        "alpine/helm:3.14",
+		KubectlImage:     "alpine/k8s:1.29",
+		DeleteNamespace:  deleteNamespace,
+	})
+	require.NoError(t, err)
+	return cj
+}
+
+// buildCompletedPod creates a Pod that looks like a completed Job pod.
+func buildCompletedPod(namespace, jobName string, initContainerNames []string, containerNames []string, exitCodes map[string]int32) *corev1.Pod {
+	var initContainers []corev1.Container
+	var initStatuses []corev1.ContainerStatus
+	for _, name := range initContainerNames {
+		code := exitCodes[name]
+		initContainers = append(initContainers, corev1.Container{Name: name})
+		initStatuses = append(initStatuses, corev1.ContainerStatus{
+			Name: name,
+			State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: code,
+				},
+			},
+		})
+	}
+
+	var containers []corev1.Container
+	var containerStatuses []corev1.ContainerStatus
+	for _, name := range containerNames {
+		code := exitCodes[name]
+		containers = append(containers, corev1.Container{Name: name})
+		containerStatuses = append(containerStatuses, corev1.ContainerStatus{
+			Name: name,
+			State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{
+					ExitCode: code,
+				},
+			},
+		})
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName + "-pod",
+			Namespace: namespace,
+			Labels:    map[string]string{"job-name": jobName},
+		},
+		Spec: corev1.PodSpec{
+			InitContainers: initContainers,
+			Containers:     containers,
+		},
+		Status: corev1.PodStatus{
+			InitContainerStatuses: initStatuses,
+			ContainerStatuses:     containerStatuses,
+		},
+	}
+}
+
+func TestRunTTL(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("happy path same namespace", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+			[]string{"helm-uninstall"}, []string{"self-cleanup"},
+			map[string]int32{"helm-uninstall": 0, "self-cleanup": 0})
+
+		client := fake.NewClientset(cj, pod)
+		var buf bytes.Buffer
+
+		result, err := RunTTL(ctx, client, &buf, testLogFetcher("ok\n"), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+		require.NoError(t, err)
+		assert.Equal(t, "myapp", result.ReleaseName)
+		assert.Equal(t, "default", result.ReleaseNamespace)
+		assert.False(t, result.DeletedNamespace)
+		assert.False(t, result.JobFailed)
+		assert.Len(t, result.ContainerResults, 2)
+		assert.Equal(t, int32(0), result.ContainerResults[0].ExitCode)
+		assert.Equal(t, int32(0), result.ContainerResults[1].ExitCode)
+
+		// Verify logs were streamed
+		assert.Contains(t, buf.String(), "==> Container: helm-uninstall <==")
+		assert.Contains(t, buf.String(), "==> Container: self-cleanup <==")
+	})
+
+	t.Run("streams logs while the container runs", func(t *testing.T) {
+		// The fake clientset's watches ignore resource versions, so
+		// a status update racing the watch is only seen on resync
+		watchResync = 10 * time.Millisecond
+		t.Cleanup(func() { watchResync = 30 * time.Second })
+
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+			[]string{"helm-uninstall"}, []string{"self-cleanup"}, nil)
+		running := pod.Status.InitContainerStatuses[0].State
+		pod.Status.InitContainerStatuses[0].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+		client := fake.NewClientset(cj, pod)
+
+		// The uninstall only finishes once its logs are being followed
+		fetcher := func(ctx context.Context, namespace, podName, containerName string) (io.ReadCloser, error) {
+			if containerName == "helm-uninstall" {
+				p, err := client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+				if err != nil {
+					return nil, err
+				}
+				p.Status.InitContainerStatuses[0].State = running
+				if _, err := client.CoreV1().Pods(namespace).UpdateStatus(ctx, p, metav1.UpdateOptions{}); err != nil {
+					return nil, err
+				}
+			}
+
+			return io.NopCloser(strings.NewReader("uninstalling " + containerName + "\n")), nil
+		}
+
+		var buf bytes.Buffer
+		result, err := RunTTL(ctx, client, &buf, fetcher, RunTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Timeout:          5 * time.Second,
+			PollInterval:     time.Millisecond,
+		})
+		require.NoError(t, err)
+		assert.Len(t, result.ContainerResults, 2)
+		assert.Contains(t, buf.String(), "==> Container: helm-uninstall <==\nuninstalling helm-uninstall\n")
+	})
+
+	t.Run("log stream that outlives its container is cut off", func(t *testing.T) {
+		logDrainTimeout = 10 * time.Millisecond
+		t.Cleanup(func() { logDrainTimeout = 10 * time.Second })
+
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+			[]string{"helm-uninstall"}, []string{"self-cleanup"}, nil)
+		client := fake.NewClientset(cj, pod)
+
+		// A stream that never ends by itself
+		fetcher := func(ctx context.Context, _, _, _ string) (io.ReadCloser, error) {
+			r, w := io.Pipe()
+			go func() {
+				<-ctx.Done()
+				_ = w.CloseWithError(ctx.Err())
+			}()
+
+			return r, nil
+		}
+
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, fetcher, RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+		require.NoError(t, err)
+		assert.Len(t, result.ContainerResults, 2)
+	})
+
+	t.Run("container failure", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+			[]string{"helm-uninstall"}, []string{"self-cleanup"},
+			map[string]int32{"helm-uninstall": 1, "self-cleanup": 0})
+
+		client := fake.NewClientset(cj, pod)
+		var buf bytes.Buffer
+
+		result, err := RunTTL(ctx, client, &buf, testLogFetcher("error\n"), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "job failed")
+		require.NotNil(t, result)
+		assert.True(t, result.JobFailed)
+		assert.Equal(t, int32(1), result.ContainerResults[0].ExitCode)
+		assert.Equal(t, int32(1), result.ExitCode)
+	})
+
+	t.Run("container failure does not wait for the containers after it", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+			[]string{"helm-uninstall", "delete-pvcs"}, []string{"self-cleanup"},
+			map[string]int32{"helm-uninstall": 1})
+		waiting := corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"}}
+		pod.Status.InitContainerStatuses[1].State = waiting
+		pod.Status.ContainerStatuses[0].State = waiting
+		client := fake.NewClientset(cj, pod)
+
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Timeout:          5 * time.Second,
+			PollInterval:     time.Millisecond,
+		})
+		assert.ErrorContains(t, err, "job failed")
+		require.NotNil(t, result)
+		assert.True(t, result.JobFailed)
+		assert.Equal(t, int32(1), result.ExitCode)
+		require.Len(t, result.ContainerResults, 1)
+		assert.Equal(t, "helm-uninstall", result.ContainerResults[0].Name)
+	})
+
+	t.Run("failed run keeps the CronJob and RBAC", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		// The main container never runs once an init container fails
+		pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+			[]string{"helm-uninstall"}, nil, map[string]int32{"helm-uninstall": 1})
+		client := fake.NewClientset(cj, pod)
+		require.NoError(t, CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false))
+
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+		assert.Error(t, err)
+		require.NotNil(t, result)
+		assert.True(t, result.KeptCronJob)
+		assert.True(t, result.KeptRBAC)
+
+		_, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+		_, err = client.BatchV1().Jobs("default").Get(ctx, "myapp-4a0c226a-ttl-run", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("failed run cleans up when told to", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+			[]string{"helm-uninstall"}, nil, map[string]int32{"helm-uninstall": 1})
+		client := fake.NewClientset(cj, pod)
+		require.NoError(t, CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false))
+
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{
+			ReleaseName:             "myapp",
+			ReleaseNamespace:        "default",
+			CronjobNamespace:        "default",
+			CleanupRBACOnFailure:    true,
+			CleanupCronJobOnFailure: true,
+		})
+		assert.Error(t, err)
+		require.NotNil(t, result)
+		assert.False(t, result.KeptCronJob)
+		assert.False(t, result.KeptRBAC)
+
+		_, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("successful run removes the RBAC", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+			[]string{"helm-uninstall"}, []string{"self-cleanup"},
+			map[string]int32{"helm-uninstall": 0, "self-cleanup": 0})
+		client := fake.NewClientset(cj, pod)
+		require.NoError(t, CreateServiceAccountAndRBAC(ctx, client, "myapp", "default", "default", "myapp-4a0c226a-ttl", false))
+
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+		require.NoError(t, err)
+		assert.False(t, result.KeptCronJob)
+		assert.False(t, result.KeptRBAC)
+
+		_, err = client.CoreV1().ServiceAccounts("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("injected sidecars are ignored", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+			[]string{"helm-uninstall"}, []string{"self-cleanup", "istio-proxy"},
+			map[string]int32{"helm-uninstall": 0, "self-cleanup": 0})
+		// The proxy never terminates
+		pod.Status.ContainerStatuses[1].State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}
+		client := fake.NewClientset(cj, pod)
+
+		var buf bytes.Buffer
+		result, err := RunTTL(ctx, client, &buf, testLogFetcher("ok\n"), RunTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Timeout:          5 * time.Second,
+		})
+		require.NoError(t, err)
+		assert.False(t, result.JobFailed)
+		assert.Len(t, result.ContainerResults, 2)
+		assert.NotContains(t, buf.String(), "istio-proxy")
+	})
+
+	t.Run("configured sidecars do not fail the run", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+			[]string{"helm-uninstall"}, []string{"self-cleanup", "envoy", "istio-proxy"},
+			map[string]int32{"helm-uninstall": 0, "self-cleanup": 0, "envoy": 137, "istio-proxy": 137})
+		client := fake.NewClientset(cj, pod)
+
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{
+			ReleaseName:       "myapp",
+			ReleaseNamespace:  "default",
+			CronjobNamespace:  "default",
+			SidecarContainers: []string{"envoy"},
+		})
+		assert.Error(t, err)
+		require.NotNil(t, result)
+		assert.True(t, result.JobFailed)
+		require.Len(t, result.ContainerResults, 3)
+		assert.Equal(t, "istio-proxy", result.ContainerResults[2].Name)
+	})
+
+	t.Run("records timing", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		pod := buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+			[]string{"helm-uninstall"}, []string{"self-cleanup"},
+			map[string]int32{"helm-uninstall": 0, "self-cleanup": 0})
+		started := time.Date(2025, time.March, 15, 14, 30, 0, 0, time.UTC)
+		pod.Status.InitContainerStatuses[0].State.Terminated.StartedAt = metav1.NewTime(started)
+		pod.Status.InitContainerStatuses[0].State.Terminated.FinishedAt = metav1.NewTime(started.Add(90 * time.Second))
+
+		client := fake.NewClientset(cj, pod)
+
+		before := time.Now().Truncate(time.Second)
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+		require.NoError(t, err)
+		assert.Equal(t, int32(0), result.ExitCode)
+
+		assert.Equal(t, ContainerResult{
+			Name:            "helm-uninstall",
+			StartedAt:       "2025-03-15T14:30:00Z",
+			FinishedAt:      "2025-03-15T14:31:30Z",
+			DurationSeconds: 90,
+		}, result.ContainerResults[0])
+		assert.Equal(t, ContainerResult{Name: "self-cleanup"}, result.ContainerResults[1])
+
+		runStart, err := time.Parse(time.RFC3339, result.StartedAt)
+		require.NoError(t, err)
+		runEnd, err := time.Parse(time.RFC3339, result.FinishedAt)
+		require.NoError(t, err)
+		assert.False(t, runStart.Before(before))
+		assert.False(t, runEnd.Before(runStart))
+		assert.Positive(t, result.DurationSeconds)
+	})
+
+	t.Run("TTL not found", func(t *testing.T) {
+		client := fake.NewClientset()
+		var buf bytes.Buffer
+
+		_, err := RunTTL(ctx, client, &buf, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+		var notFound *TTLNotFoundError
+		assert.True(t, errors.As(err, &notFound))
+	})
+
+	t.Run("Job creation failure", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		client := fake.NewClientset(cj)
+		client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("simulated Job create error")
+		})
+
+		var buf bytes.Buffer
+		_, err := RunTTL(ctx, client, &buf, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create Job")
+	})
+
+	t.Run("cross-namespace with delete-namespace", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "staging", "ops", true)
+		pod := buildCompletedPod("ops", "myapp-80081014-ttl-run",
+			[]string{"helm-uninstall", "delete-namespace"}, []string{"self-cleanup"},
+			map[string]int32{"helm-uninstall": 0, "delete-namespace": 0, "self-cleanup": 0})
+		ns := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "staging"},
+		}
+
+		client := fake.NewClientset(cj, pod, ns)
+		var buf bytes.Buffer
+
+		result, err := RunTTL(ctx, client, &buf, testLogFetcher("ok\n"), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", CronjobNamespace: "ops"})
+		require.NoError(t, err)
+		assert.True(t, result.DeletedNamespace)
+		assert.Len(t, result.ContainerResults, 3)
+
+		// Verify namespace is gone
+		_, err = client.CoreV1().Namespaces().Get(ctx, "staging", metav1.GetOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("namespace delete delay already waited by the Job", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "staging", "ops", true)
+		cj.Annotations = map[string]string{AnnotationNamespaceDeleteDelay: "1h0m0s"}
+		pod := buildCompletedPod("ops", "myapp-80081014-ttl-run",
+			[]string{"helm-uninstall", "delete-namespace"}, []string{"self-cleanup"},
+			map[string]int32{"helm-uninstall": 0, "delete-namespace": 0, "self-cleanup": 0})
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "staging"}}
+		client := fake.NewClientset(cj, pod, ns)
+
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher("ok\n"), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", CronjobNamespace: "ops"})
+		require.NoError(t, err)
+		assert.True(t, result.DeletedNamespace)
+		assert.Equal(t, "1h0m0s", result.NamespaceDeleteDelay)
+	})
+
+	t.Run("namespace delete delay after a failed Job", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "staging", "ops", true)
+		cj.Annotations = map[string]string{AnnotationNamespaceDeleteDelay: "1h0m0s"}
+		pod := buildCompletedPod("ops", "myapp-80081014-ttl-run",
+			[]string{"helm-uninstall", "delete-namespace"}, []string{"self-cleanup"},
+			map[string]int32{"helm-uninstall": 0, "delete-namespace": 1, "self-cleanup": 0})
+
+		t.Run("namespace already gone", func(t *testing.T) {
+			client := fake.NewClientset(cj.DeepCopy(), pod.DeepCopy())
+
+			result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", CronjobNamespace: "ops"})
+			assert.ErrorContains(t, err, "job failed")
+			assert.True(t, result.DeletedNamespace)
+		})
+
+		t.Run("namespace lookup error", func(t *testing.T) {
+			client := fake.NewClientset(cj.DeepCopy(), pod.DeepCopy())
+			client.PrependReactor("get", "namespaces", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, fmt.Errorf("simulated API error")
+			})
+
+			result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", CronjobNamespace: "ops"})
+			assert.EqualError(t, err, "failed to get namespace staging: simulated API error")
+			require.NotNil(t, result)
+			assert.False(t, result.DeletedNamespace)
+			assert.Len(t, result.ContainerResults, 2)
+			assert.NotEmpty(t, result.FinishedAt)
+		})
+
+		t.Run("bounded by the caller's context", func(t *testing.T) {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "staging"}}
+			client := fake.NewClientset(cj.DeepCopy(), pod.DeepCopy(), ns)
+			shortCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+			defer cancel()
+
+			result, err := RunTTL(shortCtx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", CronjobNamespace: "ops"})
+			assert.ErrorContains(t, err, "timed out waiting to delete namespace staging")
+			require.NotNil(t, result)
+			assert.False(t, result.DeletedNamespace)
+
+			_, err = client.CoreV1().Namespaces().Get(ctx, "staging", metav1.GetOptions{})
+			assert.NoError(t, err)
+		})
+
+		t.Run("timeout shorter than the delay", func(t *testing.T) {
+			client := fake.NewClientset(cj.DeepCopy(), pod.DeepCopy())
+
+			_, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", CronjobNamespace: "ops", Timeout: 10 * time.Minute})
+			assert.EqualError(t, err, "timeout 10m0s must be longer than the namespace delete delay 1h0m0s")
+
+			jobs, err := client.BatchV1().Jobs("ops").List(ctx, metav1.ListOptions{})
+			require.NoError(t, err)
+			assert.Empty(t, jobs.Items)
+		})
+	})
+
+	t.Run("CronJob get API error", func(t *testing.T) {
+		client := fake.NewClientset()
+		client.PrependReactor("get", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("simulated API error")
+		})
+
+		var buf bytes.Buffer
+		_, err := RunTTL(ctx, client, &buf, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to get CronJob")
+	})
+
+	t.Run("pod timeout", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		// No pod - will timeout
+		client := fake.NewClientset(cj)
+		var buf bytes.Buffer
+
+		shortCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		result, err := RunTTL(shortCtx, client, &buf, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "timed out waiting for pod")
+		require.NotNil(t, result)
+	})
+
+	t.Run("timeout option", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		client := fake.NewClientset(cj)
+
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Timeout:          50 * time.Millisecond,
+			PollInterval:     10 * time.Millisecond,
+		})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Contains(t, err.Error(), "timed out waiting for pod")
+		require.NotNil(t, result)
+
+		// The Job is still cleaned up
+		jobs, err := client.BatchV1().Jobs("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, jobs.Items)
+	})
+
+	t.Run("poll interval option", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		client := fake.NewClientset(cj)
+		client.PrependWatchReactor("pods", func(_ k8stesting.Action) (bool, watch.Interface, error) {
+			return true, nil, fmt.Errorf("forbidden")
+		})
+		go func() {
+			time.Sleep(30 * time.Millisecond)
+			_, _ = client.CoreV1().Pods("default").Create(ctx, buildCompletedPod("default", "myapp-4a0c226a-ttl-run",
+				[]string{"helm-uninstall"}, []string{"self-cleanup"}, nil), metav1.CreateOptions{})
+		}()
+
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Timeout:          900 * time.Millisecond,
+			PollInterval:     10 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		assert.Len(t, result.ContainerResults, 2)
+	})
+
+	t.Run("negative timeout and poll interval", func(t *testing.T) {
+		client := fake.NewClientset()
+
+		_, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", Timeout: -time.Second})
+		assert.EqualError(t, err, "invalid timeout -1s: must not be negative")
+
+		_, err = RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", PollInterval: -time.Second})
+		assert.EqualError(t, err, "invalid poll interval -1s: must not be negative")
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "staging", "ops", true)
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "staging"}}
+		client := fake.NewClientset(cj, ns)
+		require.NoError(t, CreateServiceAccountAndRBAC(ctx, client, "myapp", "staging", "ops", "myapp-80081014-ttl", true))
+		var buf bytes.Buffer
+
+		result, err := RunTTL(ctx, client, &buf, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", CronjobNamespace: "ops", DryRun: true})
+		require.NoError(t, err)
+		assert.True(t, result.DryRun)
+		assert.True(t, result.DeletedNamespace)
+		assert.Equal(t, "myapp-80081014-ttl", result.ResourceName)
+		assert.Equal(t, []string{"helm", "uninstall", "myapp", "--namespace", "staging"}, result.UninstallCommand[:5])
+		require.NotNil(t, result.Job)
+		assert.Equal(t, "Job", result.Job.Kind)
+		assert.Equal(t, "myapp-80081014-ttl-run", result.Job.Name)
+		assert.Len(t, result.RBAC, 7)
+		assert.Empty(t, buf.String())
+
+		// Nothing was created or deleted
+		jobs, err := client.BatchV1().Jobs("ops").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, jobs.Items)
+		_, err = client.CoreV1().Namespaces().Get(ctx, "staging", metav1.GetOptions{})
+		assert.NoError(t, err)
+		_, err = client.CoreV1().ServiceAccounts("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		assert.NoError(t, err)
+		entries, err := GetHistory(ctx, client, "myapp", "staging", "ops")
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("dry run without RBAC", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		client := fake.NewClientset(cj)
+
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", DryRun: true})
+		require.NoError(t, err)
+		assert.False(t, result.DeletedNamespace)
+		assert.Empty(t, result.RBAC)
+	})
+
+	t.Run("dry run RBAC lookup error", func(t *testing.T) {
+		cj := buildTestCronJob(t, "myapp", "default", "default", false)
+		client := fake.NewClientset(cj)
+		client.PrependReactor("get", "roles", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("simulated API error")
+		})
+
+		_, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "default", CronjobNamespace: "default", DryRun: true})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to get Role myapp-4a0c226a-ttl")
+	})
+}
+
+func TestSetTTL_DateOrder(t *testing.T) {
+	ctx := context.Background()
+	target := time.Now().Add(48 * time.Hour)
+
+	t.Run("refuses ambiguous dates by default", func(t *testing.T) {
+		t.Setenv("HELM_TTL_DATE_ORDER", "")
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+
+		_, err := SetTTL(ctx, cfg, fake.NewClientset(), SetTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Duration:         "01/02 5pm",
+			ServiceAccount:   "default",
+		})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "ambiguous date")
+	})
+
+	t.Run("explicit order", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             fmt.Sprintf("%02d/%02d 11:30", target.Month(), target.Day()),
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			DateOrder:            "mdy",
+		})
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("30 11 %d %d *", target.Day(), target.Month()), cj.Spec.Schedule)
+	})
+
+	t.Run("order from environment", func(t *testing.T) {
+		t.Setenv("HELM_TTL_DATE_ORDER", "dmy")
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             fmt.Sprintf("%02d/%02d 11:30", target.Day(), target.Month()),
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		})
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("30 11 %d %d *", target.Day(), target.Month()), cj.Spec.Schedule)
+	})
+
+	t.Run("invalid order", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+
+		_, err := SetTTL(ctx, cfg, fake.NewClientset(), SetTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Duration:         "1h",
+			ServiceAccount:   "default",
+			DateOrder:        "ymd",
+		})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid date order")
+	})
+}
+
+func TestSetTTL_ImagePullSecrets(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("from options", func(t *testing.T) {
+		t.Setenv("HELM_TTL_IMAGE_PULL_SECRETS", "ignored")
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "1h",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			ImagePullSecrets:     []string{"registry"},
+		})
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []corev1.LocalObjectReference{{Name: "registry"}}, cj.Spec.JobTemplate.Spec.Template.Spec.ImagePullSecrets)
+	})
+
+	t.Run("from environment", func(t *testing.T) {
+		t.Setenv("HELM_TTL_IMAGE_PULL_SECRETS", "registry-a, registry-b")
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "1h",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		})
+		require.NoError(t, err)
+
+		cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, []corev1.LocalObjectReference{{Name: "registry-a"}, {Name: "registry-b"}},
+			cj.Spec.JobTemplate.Spec.Template.Spec.ImagePullSecrets)
+	})
+}
+
+func TestGetTTL_Missed(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	setAt := now.Add(-48 * time.Hour)
+	scheduled := now.Add(-24 * time.Hour)
+
+	t.Run("from managed fields", func(t *testing.T) {
+		statusUpdate := metav1.NewTime(now)
+		specUpdate := metav1.NewTime(setAt)
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "myapp-4a0c226a-ttl",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(now.Add(-90 * 24 * time.Hour)),
+				ManagedFields: []metav1.ManagedFieldsEntry{
+					{Manager: "helm-ttl", Time: &specUpdate},
+					{Manager: "kube-controller-manager", Subresource: "status", Time: &statusUpdate},
+				},
+			},
+			Spec: batchv1.CronJobSpec{Schedule: TimeToCronSchedule(scheduled)},
+		})
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.True(t, info.Missed)
+		assert.True(t, info.Expired)
+		assert.Equal(t, "missed", info.Remaining)
 	})
-	client.PrependReactor("update", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
-		return true, nil, fmt.Errorf("simulated update error")
+
+	t.Run("from creation timestamp", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "myapp-4a0c226a-ttl",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(setAt),
+			},
+			Spec: batchv1.CronJobSpec{Schedule: TimeToCronSchedule(scheduled)},
+		})
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.True(t, info.Missed)
 	})
 
-	err := SetTTL(ctx, cfg, client, SetTTLOptions{
-		ReleaseName:          "myapp",
-		ReleaseNamespace:     "default",
-		CronjobNamespace:     "default",
-		Duration:             "1h",
-		ServiceAccount:       "default",
-		CreateServiceAccount: true,
+	t.Run("pending", func(t *testing.T) {
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "myapp-4a0c226a-ttl",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(setAt),
+			},
+			Spec: batchv1.CronJobSpec{Schedule: TimeToCronSchedule(now.Add(49 * time.Hour))},
+		})
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.False(t, info.Missed)
+		assert.False(t, info.Expired)
+		assert.Regexp(t, `^2d0h\d+m$`, info.Remaining)
 	})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to update CronJob")
 }
 
-func TestGetTTL_APIError(t *testing.T) {
+func TestGetTTL_ExpiresAt(t *testing.T) {
 	ctx := context.Background()
-	client := fake.NewClientset()
-	client.PrependReactor("get", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
-		return true, nil, fmt.Errorf("simulated API error")
-	})
+	now := time.Now()
 
-	_, err := GetTTL(ctx, client, "myapp", "default", "default")
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to get CronJob")
-}
+	cronJob := func(schedule, expiresAt string) *batchv1.CronJob {
+		return &batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "myapp-4a0c226a-ttl",
+				Namespace:         "default",
+				CreationTimestamp: metav1.NewTime(now),
+				Annotations:       map[string]string{AnnotationExpiresAt: expiresAt},
+			},
+			Spec: batchv1.CronJobSpec{Schedule: schedule},
+		}
+	}
 
-func TestUnsetTTL_APIError(t *testing.T) {
-	ctx := context.Background()
-	client := fake.NewClientset()
-	client.PrependReactor("delete", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
-		return true, nil, fmt.Errorf("simulated API error")
+	t.Run("annotation supplies the year", func(t *testing.T) {
+		// Created today for a date that has passed this year: without the
+		// annotation the TTL would be read as pending until next year.
+		expiresAt := now.Add(-24 * time.Hour).Truncate(time.Minute)
+		client := fake.NewClientset(cronJob(TimeToCronSchedule(expiresAt), FormatScheduledDate(expiresAt.UTC())))
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, FormatScheduledDate(expiresAt), info.ScheduledDate)
+		assert.True(t, info.Missed)
 	})
 
-	err := UnsetTTL(ctx, client, "myapp", "default", "default")
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to delete CronJob")
-}
+	t.Run("annotation not matching the schedule is ignored", func(t *testing.T) {
+		scheduled := now.Add(48 * time.Hour).Truncate(time.Minute)
+		client := fake.NewClientset(cronJob(TimeToCronSchedule(scheduled), FormatScheduledDate(scheduled.Add(-24*time.Hour))))
 
-// testLogFetcher returns a LogFetcher that returns canned log output.
-func testLogFetcher(logs string) LogFetcher {
-	return func(_ context.Context, _, _, _ string) (io.ReadCloser, error) {
-		return io.NopCloser(strings.NewReader(logs)), nil
-	}
-}
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, FormatScheduledDate(scheduled), info.ScheduledDate)
+		assert.False(t, info.Missed)
+	})
 
-// buildTestCronJob creates a CronJob with a proper job template for testing RunTTL.
-func buildTestCronJob(t *testing.T, releaseName, releaseNamespace, cronjobNamespace string, deleteNamespace bool) *batchv1.CronJob {
-	t.Helper()
-	cj, err := BuildCronJob(CronJobOptions{
-		ReleaseName:      releaseName,
-		ReleaseNamespace: releaseNamespace,
-		CronjobNamespace: cronjobNamespace,
-		Schedule:         "30 14 15 3 *",
-		ServiceAccount:   "default",
-		HelmImage:        "alpine/helm:3.14",
-		KubectlImage:     "alpine/k8s:1.29",
-		DeleteNamespace:  deleteNamespace,
+	t.Run("invalid annotation is ignored", func(t *testing.T) {
+		scheduled := now.Add(48 * time.Hour).Truncate(time.Minute)
+		client := fake.NewClientset(cronJob(TimeToCronSchedule(scheduled), "next year"))
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, FormatScheduledDate(scheduled), info.ScheduledDate)
 	})
-	require.NoError(t, err)
-	return cj
 }
 
-// buildCompletedPod creates a Pod that looks like a completed Job pod.
-func buildCompletedPod(namespace, jobName string, initContainerNames []string, containerNames []string, exitCodes map[string]int32) *corev1.Pod {
-	var initContainers []corev1.Container
-	var initStatuses []corev1.ContainerStatus
-	for _, name := range initContainerNames {
-		code := exitCodes[name]
-		initContainers = append(initContainers, corev1.Container{Name: name})
-		initStatuses = append(initStatuses, corev1.ContainerStatus{
-			Name: name,
-			State: corev1.ContainerState{
-				Terminated: &corev1.ContainerStateTerminated{
-					ExitCode: code,
+func TestGetTTL_Durations(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	t.Run("original and remaining durations", func(t *testing.T) {
+		expiresAt := now.Add(36*time.Hour + 12*time.Minute + 30*time.Second).Truncate(time.Minute)
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-4a0c226a-ttl",
+				Namespace: "default",
+				Annotations: map[string]string{
+					AnnotationExpiresAt:        FormatScheduledDate(expiresAt.UTC()),
+					AnnotationOriginalDuration: "168h",
 				},
 			},
+			Spec: batchv1.CronJobSpec{Schedule: TimeToCronSchedule(expiresAt)},
 		})
-	}
 
-	var containers []corev1.Container
-	var containerStatuses []corev1.ContainerStatus
-	for _, name := range containerNames {
-		code := exitCodes[name]
-		containers = append(containers, corev1.Container{Name: name})
-		containerStatuses = append(containerStatuses, corev1.ContainerStatus{
-			Name: name,
-			State: corev1.ContainerState{
-				Terminated: &corev1.ContainerStateTerminated{
-					ExitCode: code,
-				},
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "168h", info.OriginalDuration)
+		assert.Equal(t, FormatDuration(expiresAt.Sub(now).Truncate(time.Minute)), info.RemainingDuration)
+
+		d, err := ParseDuration(info.RemainingDuration)
+		require.NoError(t, err)
+		assert.InDelta(t, expiresAt.Sub(now), d, float64(time.Minute))
+	})
+
+	t.Run("missed", func(t *testing.T) {
+		expiresAt := now.Add(-time.Hour).Truncate(time.Minute)
+		client := fake.NewClientset(&batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "myapp-4a0c226a-ttl",
+				Namespace:   "default",
+				Annotations: map[string]string{AnnotationExpiresAt: FormatScheduledDate(expiresAt.UTC())},
 			},
+			Spec: batchv1.CronJobSpec{Schedule: TimeToCronSchedule(expiresAt)},
 		})
-	}
 
-	return &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      jobName + "-pod",
-			Namespace: namespace,
-			Labels:    map[string]string{"job-name": jobName},
-		},
-		Spec: corev1.PodSpec{
-			InitContainers: initContainers,
-			Containers:     containers,
-		},
-		Status: corev1.PodStatus{
-			InitContainerStatuses: initStatuses,
-			ContainerStatuses:     containerStatuses,
-		},
-	}
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Equal(t, "0s", info.RemainingDuration)
+		assert.Empty(t, info.OriginalDuration)
+	})
 }
 
-func TestRunTTL(t *testing.T) {
+func TestSetTTL_SubMinutePrecision(t *testing.T) {
 	ctx := context.Background()
+	cfg, _ := setupTestRelease(t, "myapp", "default")
+	client := fake.NewClientset()
 
-	t.Run("happy path same namespace", func(t *testing.T) {
-		cj := buildTestCronJob(t, "myapp", "default", "default", false)
-		pod := buildCompletedPod("default", "myapp-default-ttl-run",
-			[]string{"helm-uninstall"}, []string{"self-cleanup"},
-			map[string]int32{"helm-uninstall": 0, "self-cleanup": 0})
+	before := time.Now()
+	result, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+		ReleaseName:          "myapp",
+		ReleaseNamespace:     "default",
+		CronjobNamespace:     "default",
+		Duration:             "10m30s",
+		ServiceAccount:       "default",
+		CreateServiceAccount: true,
+	})
+	require.NoError(t, err)
 
-		client := fake.NewClientset(cj, pod)
-		var buf bytes.Buffer
+	// The schedule fires on the minute after the requested expiry, never
+	// before it
+	requested, err := time.Parse(time.RFC3339, result.RequestedAt)
+	require.NoError(t, err)
+	expiresAt, err := time.Parse(time.RFC3339, result.ExpiresAt)
+	require.NoError(t, err)
+	assert.WithinDuration(t, before.Add(10*time.Minute+30*time.Second), requested, 2*time.Second)
+	assert.Equal(t, roundUpToMinute(requested), expiresAt)
+	assert.Equal(t, TimeToCronSchedule(expiresAt), result.CronSchedule)
+	require.Len(t, result.Warnings, 1)
+	assert.Contains(t, result.Warnings[0], "rounded up to "+result.ExpiresAt)
+
+	cj, err := client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "10m30s", cj.Annotations[AnnotationOriginalDuration])
 
-		result, err := RunTTL(ctx, client, &buf, testLogFetcher("ok\n"), "myapp", "default", "default")
+	info, err := GetTTL(ctx, client, "myapp", "default", "default")
+	require.NoError(t, err)
+	assert.Equal(t, result.ExpiresAt, info.ScheduledDate)
+	assert.Equal(t, result.RequestedAt, info.RequestedDate)
+
+	t.Run("not reported once the schedule changes", func(t *testing.T) {
+		cj.Spec.Schedule = TimeToCronSchedule(expiresAt.Add(time.Hour))
+		cj.Annotations[AnnotationExpiresAt] = FormatScheduledDate(expiresAt.Add(time.Hour).UTC())
+		_, err := client.BatchV1().CronJobs("default").Update(ctx, cj, metav1.UpdateOptions{})
 		require.NoError(t, err)
-		assert.Equal(t, "myapp", result.ReleaseName)
-		assert.Equal(t, "default", result.ReleaseNamespace)
-		assert.False(t, result.DeletedNamespace)
-		assert.False(t, result.JobFailed)
-		assert.Len(t, result.ContainerResults, 2)
-		assert.Equal(t, int32(0), result.ContainerResults[0].ExitCode)
-		assert.Equal(t, int32(0), result.ContainerResults[1].ExitCode)
 
-		// Verify logs were streamed
-		assert.Contains(t, buf.String(), "==> Container: helm-uninstall <==")
-		assert.Contains(t, buf.String(), "==> Container: self-cleanup <==")
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		assert.Empty(t, info.RequestedDate)
 	})
+}
 
-	t.Run("container failure", func(t *testing.T) {
-		cj := buildTestCronJob(t, "myapp", "default", "default", false)
-		pod := buildCompletedPod("default", "myapp-default-ttl-run",
-			[]string{"helm-uninstall"}, []string{"self-cleanup"},
-			map[string]int32{"helm-uninstall": 1, "self-cleanup": 0})
+func TestSetTTL_NamespacePolicy(t *testing.T) {
+	ctx := context.Background()
+	setOpts := func(duration string) SetTTLOptions {
+		return SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             duration,
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+		}
+	}
+	policyCM := func(data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: policy.ConfigMapName, Namespace: "default"},
+			Data:       data,
+		}
+	}
 
-		client := fake.NewClientset(cj, pod)
-		var buf bytes.Buffer
+	t.Run("applies the default duration", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset(policyCM(map[string]string{policy.KeyDefaultDuration: "2h"}))
 
-		result, err := RunTTL(ctx, client, &buf, testLogFetcher("error\n"), "myapp", "default", "default")
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "job failed")
-		require.NotNil(t, result)
-		assert.True(t, result.JobFailed)
-		assert.Equal(t, int32(1), result.ContainerResults[0].ExitCode)
+		before := time.Now()
+		_, err := SetTTL(ctx, cfg, client, setOpts(""))
+		require.NoError(t, err)
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		scheduled, err := time.Parse(time.RFC3339, info.ScheduledDate)
+		require.NoError(t, err)
+		assert.WithinDuration(t, before.Add(2*time.Hour), scheduled, 2*time.Minute)
 	})
 
-	t.Run("TTL not found", func(t *testing.T) {
-		client := fake.NewClientset()
-		var buf bytes.Buffer
+	t.Run("explicit duration overrides the default", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset(policyCM(map[string]string{policy.KeyDefaultDuration: "2h"}))
 
-		_, err := RunTTL(ctx, client, &buf, testLogFetcher(""), "myapp", "default", "default")
-		var notFound *TTLNotFoundError
-		assert.True(t, errors.As(err, &notFound))
+		before := time.Now()
+		_, err := SetTTL(ctx, cfg, client, setOpts("5h"))
+		require.NoError(t, err)
+
+		info, err := GetTTL(ctx, client, "myapp", "default", "default")
+		require.NoError(t, err)
+		scheduled, err := time.Parse(time.RFC3339, info.ScheduledDate)
+		require.NoError(t, err)
+		assert.WithinDuration(t, before.Add(5*time.Hour), scheduled, 2*time.Minute)
 	})
 
-	t.Run("Job creation failure", func(t *testing.T) {
-		cj := buildTestCronJob(t, "myapp", "default", "default", false)
-		client := fake.NewClientset(cj)
-		client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
-			return true, nil, fmt.Errorf("simulated Job create error")
-		})
+	t.Run("no duration and no default", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
 
-		var buf bytes.Buffer
-		_, err := RunTTL(ctx, client, &buf, testLogFetcher(""), "myapp", "default", "default")
+		_, err := SetTTL(ctx, cfg, fake.NewClientset(), setOpts(""))
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "failed to create Job")
+		assert.Contains(t, err.Error(), `no duration given and namespace "default" has no defaultDuration`)
 	})
 
-	t.Run("cross-namespace with delete-namespace", func(t *testing.T) {
-		cj := buildTestCronJob(t, "myapp", "staging", "ops", true)
-		pod := buildCompletedPod("ops", "myapp-staging-ttl-run",
-			[]string{"helm-uninstall", "delete-namespace"}, []string{"self-cleanup"},
-			map[string]int32{"helm-uninstall": 0, "delete-namespace": 0, "self-cleanup": 0})
-		ns := &corev1.Namespace{
-			ObjectMeta: metav1.ObjectMeta{Name: "staging"},
-		}
-
-		client := fake.NewClientset(cj, pod, ns)
-		var buf bytes.Buffer
+	t.Run("rejects durations above the maximum", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset(policyCM(map[string]string{policy.KeyMaxDuration: "3d"}))
 
-		result, err := RunTTL(ctx, client, &buf, testLogFetcher("ok\n"), "myapp", "staging", "ops")
-		require.NoError(t, err)
-		assert.True(t, result.DeletedNamespace)
-		assert.Len(t, result.ContainerResults, 3)
+		_, err := SetTTL(ctx, cfg, client, setOpts("7d"))
+		var exceeded *policy.MaxDurationExceededError
+		require.True(t, errors.As(err, &exceeded))
 
-		// Verify namespace is gone
-		_, err = client.CoreV1().Namespaces().Get(ctx, "staging", metav1.GetOptions{})
-		assert.Error(t, err)
+		_, err = client.BatchV1().CronJobs("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
 	})
 
-	t.Run("resource name too long", func(t *testing.T) {
-		client := fake.NewClientset()
-		var buf bytes.Buffer
+	t.Run("invalid policy", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset(policyCM(map[string]string{policy.KeyMaxDuration: "soon"}))
 
-		_, err := RunTTL(ctx, client, &buf, testLogFetcher(""), "a-very-long-release-name-that-will-exceed", "a-long-namespace", "default")
+		_, err := SetTTL(ctx, cfg, client, setOpts("1h"))
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "exceeds maximum length")
+		assert.Contains(t, err.Error(), "invalid maxDuration")
 	})
 
-	t.Run("CronJob get API error", func(t *testing.T) {
+	t.Run("policy not readable", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
 		client := fake.NewClientset()
-		client.PrependReactor("get", "cronjobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
-			return true, nil, fmt.Errorf("simulated API error")
+		client.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(corev1.Resource("configmaps"), policy.ConfigMapName, fmt.Errorf("denied"))
 		})
 
-		var buf bytes.Buffer
-		_, err := RunTTL(ctx, client, &buf, testLogFetcher(""), "myapp", "default", "default")
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "failed to get CronJob")
+		result, err := SetTTL(ctx, cfg, client, setOpts("1h"))
+		require.NoError(t, err)
+		require.Len(t, result.Warnings, 1)
+		assert.Contains(t, result.Warnings[0], "not allowed to read the helm-ttl-config ConfigMap")
 	})
 
-	t.Run("pod timeout", func(t *testing.T) {
-		cj := buildTestCronJob(t, "myapp", "default", "default", false)
-		// No pod - will timeout
-		client := fake.NewClientset(cj)
-		var buf bytes.Buffer
-
-		shortCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
-		defer cancel()
+	t.Run("policy read error", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+		client.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("connection refused")
+		})
 
-		result, err := RunTTL(shortCtx, client, &buf, testLogFetcher(""), "myapp", "default", "default")
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "timed out waiting for pod")
-		require.NotNil(t, result)
+		_, err := SetTTL(ctx, cfg, client, setOpts("1h"))
+		assert.ErrorContains(t, err, "connection refused")
 	})
 }
@@ -0,0 +1,174 @@
+package ttl
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+const (
+	// DefaultTwoPhaseGrace is how long a two-phase uninstall waits after
+	// publishing the release manifest, unless told otherwise.
+	DefaultTwoPhaseGrace = 10 * time.Minute
+
+	// AnnotationTwoPhaseGrace records how long a two-phase uninstall Job
+	// waits between publishing the release manifest and uninstalling.
+	AnnotationTwoPhaseGrace = "helm-ttl/two-phase-grace"
+
+	// EventReasonUninstallPending is the reason of the Event a two-phase
+	// uninstall records before its grace period.
+	EventReasonUninstallPending = "UninstallPending"
+
+	// manifestConfigMapSuffix is appended to the CronJob name to name the
+	// ConfigMap a two-phase uninstall publishes the release manifest to.
+	manifestConfigMapSuffix = "-manifest"
+
+	// auditVolume is the volume the dry run passes the manifest to the
+	// publishing container in.
+	auditVolume    = "helm-ttl-audit"
+	auditMountPath = "/helm-ttl-audit"
+	auditManifest  = auditMountPath + "/manifest.yaml"
+)
+
+// ManifestConfigMapName returns the name of the ConfigMap a two-phase
+// uninstall of the TTL CronJob named cronJobName publishes to.
+func ManifestConfigMapName(cronJobName string) string {
+	return cronJobName + manifestConfigMapSuffix
+}
+
+// validateTwoPhaseGrace rejects negative grace periods.
+func validateTwoPhaseGrace(grace time.Duration) error {
+	if grace < 0 {
+		return fmt.Errorf("invalid --two-phase-grace %s: must not be negative", grace)
+	}
+
+	return nil
+}
+
+// twoPhaseRules returns the rules a two-phase uninstall needs in the
+// CronJob namespace to publish the manifest and record the Event.
+func twoPhaseRules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"get", "create", "patch"},
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"events"},
+			Verbs:     []string{"create"},
+		},
+	}
+}
+
+// twoPhaseContainers returns the init containers that run before the
+// uninstall of a two-phase TTL: a helm uninstall --dry-run that saves the
+// release manifest, and a container publishing it to a ConfigMap and an
+// Event before waiting grace. A release already gone, which only a retried
+// Job with IgnoreNotFound tolerates, publishes nothing.
+func twoPhaseContainers(opts CronJobOptions, name, helmImage, kubectlImage, cleanupImage string) []corev1.Container {
+	mount := []corev1.VolumeMount{{Name: auditVolume, MountPath: auditMountPath}}
+
+	dryRun := corev1.Container{
+		Name:         "uninstall-dry-run",
+		Image:        helmImage,
+		Command:      dryRunUninstallCmd(opts.Uninstall, opts.ReleaseName, opts.ReleaseNamespace),
+		VolumeMounts: mount,
+	}
+	if storage, _ := StorageResource(opts.Driver); storage != "secrets" {
+		dryRun.Env = []corev1.EnvVar{{Name: "HELM_DRIVER", Value: opts.Driver}}
+	}
+
+	publish := corev1.Container{
+		Name:         "publish-manifest",
+		Image:        kubectlImage,
+		Command:      publishManifestCmd(opts, name),
+		VolumeMounts: mount,
+	}
+	if cleanupImage != "" {
+		publish.Image = cleanupImage
+		publish.Command = []string{cleanupBinary, "publish-manifest", "--namespace", opts.CronjobNamespace,
+			"--manifest", auditManifest, "--delay", opts.TwoPhaseGrace.String(), name}
+	}
+
+	return []corev1.Container{dryRun, publish}
+}
+
+// dryRunUninstallCmd returns a command running helm uninstall --dry-run and
+// saving the manifest the uninstall would delete to auditManifest.
+func dryRunUninstallCmd(u UninstallOptions, releaseName, releaseNamespace string) []string {
+	var script string
+	if u.IgnoreNotFound {
+		script = releaseGoneCheck(releaseName, releaseNamespace, "preview")
+	}
+
+	script += fmt.Sprintf(`%s --dry-run || exit 1
+helm get manifest %s --namespace %s > %s`,
+		strings.Join(u.Args(releaseName, releaseNamespace), " "), releaseName, releaseNamespace, auditManifest)
+
+	return []string{"sh", "-c", script}
+}
+
+// publishManifestCmd returns a kubectl command publishing the manifest the
+// dry run saved to the ConfigMap of the CronJob named name, recording an
+// UninstallPending Event on the CronJob and waiting opts.TwoPhaseGrace.
+func publishManifestCmd(opts CronJobOptions, name string) []string {
+	cm := ManifestConfigMapName(name)
+	labels := releaseLabels(opts.ReleaseName, opts.ReleaseNamespace)
+	var labelArgs, eventLabels []string
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		labelArgs = append(labelArgs, k+"="+labels[k])
+		eventLabels = append(eventLabels, fmt.Sprintf("    %s: %q", k, labels[k]))
+	}
+
+	message := fmt.Sprintf("release %s in namespace %s will be uninstalled in %s; the manifest to delete is in ConfigMap %s/%s",
+		opts.ReleaseName, opts.ReleaseNamespace, opts.TwoPhaseGrace, opts.CronjobNamespace, cm)
+
+	script := fmt.Sprintf(`if [ ! -f %[1]s ]; then
+  echo "no manifest to publish"
+  exit 0
+fi
+kubectl create configmap %[2]s --namespace %[3]s --from-file=manifest.yaml=%[1]s --dry-run=client --output yaml > %[4]s/configmap.yaml || exit 1
+kubectl label --local --filename %[4]s/configmap.yaml --output yaml %[5]s > %[4]s/labeled.yaml || exit 1
+kubectl apply --server-side --force-conflicts --field-manager %[6]s --filename %[4]s/labeled.yaml || exit 1
+kubectl create --filename - <<EOF || exit 1
+apiVersion: v1
+kind: Event
+metadata:
+  generateName: %[7]s.
+  namespace: %[3]s
+  labels:
+%[14]s
+involvedObject:
+  apiVersion: batch/v1
+  kind: CronJob
+  name: %[7]s
+  namespace: %[3]s
+type: Normal
+reason: %[8]s
+message: %[9]q
+source:
+  component: %[10]s
+EOF
+echo "waiting %[11]s before uninstalling release %[12]s"
+sleep %[13]d`,
+		auditManifest, cm, opts.CronjobNamespace, auditMountPath, strings.Join(labelArgs, " "), FieldManager,
+		name, EventReasonUninstallPending, message, eventComponent, opts.TwoPhaseGrace, opts.ReleaseName, int64(opts.TwoPhaseGrace.Seconds()),
+		strings.Join(eventLabels, "\n"))
+
+	return []string{"sh", "-c", script}
+}
+
+// auditVolumeSource returns the volume the two-phase containers share.
+func auditVolumeSource() corev1.Volume {
+	return corev1.Volume{
+		Name:         auditVolume,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}
+}
@@ -0,0 +1,207 @@
+package ttl
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuildCronJob_TwoPhase(t *testing.T) {
+	opts := CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "staging",
+		CronjobNamespace: "ops",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		ExpiresAt:        time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+		TwoPhaseGrace:    10 * time.Minute,
+	}
+
+	cj, err := BuildCronJob(opts)
+	require.NoError(t, err)
+	spec := cj.Spec.JobTemplate.Spec.Template.Spec
+
+	var names []string
+	for _, c := range spec.InitContainers {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, []string{"expiry-guard", "uninstall-dry-run", "publish-manifest", "helm-uninstall", "verify-uninstall"}, names)
+	assert.Equal(t, "10m0s", cj.Annotations[AnnotationTwoPhaseGrace])
+	assert.Equal(t, DefaultActiveDeadlineSeconds+600, *cj.Spec.JobTemplate.Spec.ActiveDeadlineSeconds)
+	assert.Equal(t, []corev1.Volume{auditVolumeSource()}, spec.Volumes)
+
+	dryRun, publish := spec.InitContainers[1], spec.InitContainers[2]
+	assert.Equal(t, DefaultHelmImage, dryRun.Image)
+	assert.Equal(t, DefaultKubectlImage, publish.Image)
+	for _, c := range []corev1.Container{dryRun, publish} {
+		assert.Equal(t, []corev1.VolumeMount{{Name: auditVolume, MountPath: auditMountPath}}, c.VolumeMounts, c.Name)
+	}
+
+	// Retries are on by default, so a release already gone is skipped
+	assert.Contains(t, dryRun.Command[2], "nothing to preview")
+	assert.Contains(t, dryRun.Command[2], "helm uninstall myapp --namespace staging --dry-run || exit 1\nhelm get manifest myapp --namespace staging > /helm-ttl-audit/manifest.yaml")
+	assert.NotContains(t, dryRun.Env, corev1.EnvVar{Name: "HELM_DRIVER", Value: "secrets"})
+
+	script := publish.Command[2]
+	assert.Contains(t, script, "kubectl create configmap myapp-80081014-ttl-manifest --namespace ops --from-file=manifest.yaml=/helm-ttl-audit/manifest.yaml")
+	assert.Contains(t, script, "app.kubernetes.io/managed-by=helm-ttl helm-ttl/release=myapp helm-ttl/release-namespace=staging")
+	assert.Contains(t, script, "reason: UninstallPending")
+	assert.Contains(t, script, `message: "release myapp in namespace staging will be uninstalled in 10m0s; the manifest to delete is in ConfigMap ops/myapp-80081014-ttl-manifest"`)
+	assert.Contains(t, script, "sleep 600")
+
+	t.Run("without retries", func(t *testing.T) {
+		opts := opts
+		zero := int32(0)
+		opts.Job = JobOptions{BackoffLimit: &zero}
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+		assert.NotContains(t, cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[1].Command[2], "helm list")
+	})
+
+	t.Run("configmaps driver", func(t *testing.T) {
+		opts := opts
+		opts.Driver = "configmaps"
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+		assert.Contains(t, cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[1].Env, corev1.EnvVar{Name: "HELM_DRIVER", Value: "configmaps"})
+	})
+
+	t.Run("cleanup image", func(t *testing.T) {
+		opts := opts
+		opts.CleanupImage = "registry.example.com/helm-ttl-cleanup:v1"
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+		publish := cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers[2]
+		assert.Equal(t, "registry.example.com/helm-ttl-cleanup:v1", publish.Image)
+		assert.Equal(t, []string{cleanupBinary, "publish-manifest", "--namespace", "ops", "--manifest", "/helm-ttl-audit/manifest.yaml", "--delay", "10m0s", "myapp-80081014-ttl"}, publish.Command)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		opts := opts
+		opts.TwoPhaseGrace = 0
+
+		cj, err := BuildCronJob(opts)
+		require.NoError(t, err)
+		assert.NotContains(t, cj.Annotations, AnnotationTwoPhaseGrace)
+		assert.Empty(t, cj.Spec.JobTemplate.Spec.Template.Spec.Volumes)
+		assert.Len(t, cj.Spec.JobTemplate.Spec.Template.Spec.InitContainers, 3)
+	})
+
+	t.Run("negative grace rejected", func(t *testing.T) {
+		opts := opts
+		opts.TwoPhaseGrace = -time.Minute
+
+		_, err := BuildCronJob(opts)
+		assert.EqualError(t, err, "invalid --two-phase-grace -1m0s: must not be negative")
+	})
+
+	t.Run("active deadline must cover the grace", func(t *testing.T) {
+		opts := opts
+		deadline := int64(600)
+		opts.Job = JobOptions{ActiveDeadlineSeconds: &deadline}
+
+		_, err := BuildCronJob(opts)
+		assert.ErrorContains(t, err, "must exceed the uninstall timeout plus the namespace delete delay and two-phase grace (10m0s)")
+	})
+}
+
+func TestSetTTL_TwoPhaseRBAC(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("same namespace", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "default",
+			CronjobNamespace:     "default",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			TwoPhaseGrace:        time.Minute,
+		})
+		require.NoError(t, err)
+
+		role, err := client.RbacV1().Roles("default").Get(ctx, "myapp-4a0c226a-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, twoPhaseRules(), role.Rules[len(role.Rules)-2:])
+	})
+
+	t.Run("cross namespace", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "staging")
+		client := fake.NewClientset()
+
+		_, err := SetTTL(ctx, cfg, client, SetTTLOptions{
+			ReleaseName:          "myapp",
+			ReleaseNamespace:     "staging",
+			CronjobNamespace:     "ops",
+			Duration:             "2d",
+			ServiceAccount:       "default",
+			CreateServiceAccount: true,
+			TwoPhaseGrace:        time.Minute,
+		})
+		require.NoError(t, err)
+
+		role, err := client.RbacV1().Roles("ops").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, twoPhaseRules(), role.Rules[1:])
+
+		role, err = client.RbacV1().Roles("staging").Get(ctx, "myapp-80081014-ttl", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.NotContains(t, role.Rules, twoPhaseRules()[0])
+	})
+
+	t.Run("negative grace rejected", func(t *testing.T) {
+		cfg, _ := setupTestRelease(t, "myapp", "default")
+
+		_, err := SetTTL(ctx, cfg, fake.NewClientset(), SetTTLOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "default",
+			CronjobNamespace: "default",
+			Duration:         "2d",
+			ServiceAccount:   "default",
+			TwoPhaseGrace:    -time.Minute,
+		})
+		assert.EqualError(t, err, "invalid --two-phase-grace -1m0s: must not be negative")
+	})
+}
+
+func TestRunTTL_TwoPhase(t *testing.T) {
+	ctx := context.Background()
+	cj, err := BuildCronJob(CronJobOptions{
+		ReleaseName:      "myapp",
+		ReleaseNamespace: "staging",
+		CronjobNamespace: "ops",
+		Schedule:         "0 12 1 1 *",
+		ServiceAccount:   "default",
+		TwoPhaseGrace:    time.Hour,
+	})
+	require.NoError(t, err)
+
+	t.Run("timeout shorter than the grace", func(t *testing.T) {
+		client := fake.NewClientset(cj.DeepCopy())
+
+		_, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", CronjobNamespace: "ops", Timeout: 10 * time.Minute})
+		assert.EqualError(t, err, "timeout 10m0s must be longer than the two-phase grace 1h0m0s plus any namespace delete delay")
+	})
+
+	t.Run("dry run reports the grace", func(t *testing.T) {
+		client := fake.NewClientset(cj.DeepCopy())
+
+		result, err := RunTTL(ctx, client, &bytes.Buffer{}, testLogFetcher(""), RunTTLOptions{ReleaseName: "myapp", ReleaseNamespace: "staging", CronjobNamespace: "ops", Timeout: 10 * time.Minute, DryRun: true})
+		require.NoError(t, err)
+		assert.Equal(t, "1h0m0s", result.TwoPhaseGrace)
+		assert.Equal(t, []string{"helm", "uninstall", "myapp", "--namespace", "staging"}, result.UninstallCommand)
+	})
+}
@@ -0,0 +1,90 @@
+package ttl
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// helmModule is the module path of the Helm SDK helm-ttl is built with.
+const helmModule = "helm.sh/helm/v3"
+
+// ScheduleFeatures are the forms of DURATION that set and extend accept,
+// and the features of the schedules they write, so tooling can check for
+// one before relying on it.
+var ScheduleFeatures = []string{
+	"go-duration",       // 30m, 2h30m
+	"days-weeks",        // 7d, 2w
+	"human-duration",    // 6 hours, 3 days
+	"calendar-date",     // 2025-04-03, April 3 5pm
+	"business-calendar", // eod, eow, friday 6pm, monday morning
+	"natural-language",  // tomorrow, next monday
+	"date-order",        // --date-order mdy|dmy for numeric dates
+	"expires-at",        // the year of the expiry, kept in helm-ttl/expires-at
+}
+
+// VersionInfo describes a build of helm-ttl, so tooling can assert a
+// minimum version before relying on new flags.
+type VersionInfo struct {
+	Version          string          `json:"version" yaml:"version"`
+	HelmSDKVersion   string          `json:"helm_sdk_version" yaml:"helm_sdk_version"`
+	GoVersion        string          `json:"go_version" yaml:"go_version"`
+	Platform         string          `json:"platform" yaml:"platform"`
+	DefaultImages    EffectiveImages `json:"default_images" yaml:"default_images"`
+	ScheduleFeatures []string        `json:"schedule_features" yaml:"schedule_features"`
+}
+
+// GetVersionInfo returns the VersionInfo of the running build of helm-ttl
+// version. The Helm SDK version is read from the build info, and is
+// unknown when the binary has none.
+func GetVersionInfo(version string) VersionInfo {
+	return VersionInfo{
+		Version:          version,
+		HelmSDKVersion:   moduleVersion(helmModule),
+		GoVersion:        runtime.Version(),
+		Platform:         runtime.GOOS + "/" + runtime.GOARCH,
+		DefaultImages:    EffectiveImages{Helm: DefaultHelmImage, Kubectl: DefaultKubectlImage},
+		ScheduleFeatures: ScheduleFeatures,
+	}
+}
+
+// moduleVersion returns the version of the module path the binary was
+// built with, following replace directives.
+func moduleVersion(path string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path != path {
+			continue
+		}
+
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version
+		}
+
+		return dep.Version
+	}
+
+	return "unknown"
+}
+
+// FormatVersion formats VersionInfo in the specified format.
+func FormatVersion(info VersionInfo, format string) (string, error) {
+	if format == "text" {
+		return fmt.Sprintf(`helm-ttl:          %s
+helm SDK:          %s
+go:                %s
+platform:          %s
+helm image:        %s
+kubectl image:     %s
+schedule features: %s
+`, info.Version, info.HelmSDKVersion, info.GoVersion, info.Platform,
+			info.DefaultImages.Helm, info.DefaultImages.Kubectl, strings.Join(info.ScheduleFeatures, ", ")), nil
+	}
+
+	return formatStructured(info, format)
+}
@@ -0,0 +1,54 @@
+package ttl
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetVersionInfo(t *testing.T) {
+	info := GetVersionInfo("1.2.3")
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Regexp(t, `^v3\.`, info.HelmSDKVersion)
+	assert.Equal(t, runtime.GOOS+"/"+runtime.GOARCH, info.Platform)
+	assert.Equal(t, EffectiveImages{Helm: DefaultHelmImage, Kubectl: DefaultKubectlImage}, info.DefaultImages)
+	assert.Contains(t, info.ScheduleFeatures, "expires-at")
+}
+
+func TestFormatVersion(t *testing.T) {
+	info := VersionInfo{
+		Version:          "1.2.3",
+		HelmSDKVersion:   "v3.20.0",
+		GoVersion:        "go1.25.0",
+		Platform:         "windows/amd64",
+		DefaultImages:    EffectiveImages{Helm: "alpine/helm:3.20.0", Kubectl: "alpine/k8s:1.34.1"},
+		ScheduleFeatures: []string{"go-duration", "days-weeks"},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		out, err := FormatVersion(info, "text")
+		require.NoError(t, err)
+		assert.Equal(t, `helm-ttl:          1.2.3
+helm SDK:          v3.20.0
+go:                go1.25.0
+platform:          windows/amd64
+helm image:        alpine/helm:3.20.0
+kubectl image:     alpine/k8s:1.34.1
+schedule features: go-duration, days-weeks
+`, out)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, err := FormatVersion(info, "json")
+		require.NoError(t, err)
+
+		var decoded map[string]any
+		require.NoError(t, json.Unmarshal([]byte(out), &decoded))
+		assert.Equal(t, "1.2.3", decoded["version"])
+		assert.Equal(t, "v3.20.0", decoded["helm_sdk_version"])
+		assert.Equal(t, map[string]any{"helm": "alpine/helm:3.20.0", "kubectl": "alpine/k8s:1.34.1"}, decoded["default_images"])
+	})
+}
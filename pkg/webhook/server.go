@@ -0,0 +1,92 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// maxReviewBytes bounds the size of an AdmissionReview request body.
+const maxReviewBytes = 10 << 20
+
+// shutdownTimeout bounds how long Serve waits for in-flight reviews.
+const shutdownTimeout = 10 * time.Second
+
+// Handler returns an HTTP handler that answers AdmissionReview requests
+// with the Validator's decisions.
+func Handler(v *Validator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var review admissionv1.AdmissionReview
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReviewBytes)).Decode(&review); err != nil {
+			http.Error(w, fmt.Sprintf("invalid AdmissionReview: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if review.Request == nil {
+			http.Error(w, "invalid AdmissionReview: missing request", http.StatusBadRequest)
+			return
+		}
+
+		review.Response = v.Review(r.Context(), review.Request)
+		review.Request = nil
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(review)
+	})
+}
+
+// ServeOptions configures the webhook HTTPS server.
+type ServeOptions struct {
+	Addr     string
+	CertFile string
+	KeyFile  string
+}
+
+// Serve runs the webhook over HTTPS on /validate, plus a /healthz probe,
+// until ctx is cancelled.
+func Serve(ctx context.Context, v *Validator, opts ServeOptions) error {
+	mux := http.NewServeMux()
+	mux.Handle("/validate", Handler(v))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{
+		Addr:              opts.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServeTLS(opts.CertFile, opts.KeyFile)
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("webhook server failed: %w", err)
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("failed to shut down webhook server: %w", err)
+		}
+
+		if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("webhook server failed: %w", err)
+		}
+
+		return nil
+	}
+}
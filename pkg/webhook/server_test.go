@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
+)
+
+// writeSelfSignedCert writes a certificate and key for 127.0.0.1.
+func writeSelfSignedCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "helm-ttl-webhook"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func reviewBody(t *testing.T, req *admissionv1.AdmissionRequest) *bytes.Buffer {
+	t.Helper()
+
+	data, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request:  req,
+	})
+	require.NoError(t, err)
+
+	return bytes.NewBuffer(data)
+}
+
+func TestHandler(t *testing.T) {
+	client := fake.NewClientset(policyConfigMap("dev", map[string]string{policy.KeyRequireTTL: "true"}))
+	handler := Handler(&Validator{Client: client})
+
+	t.Run("answers a review", func(t *testing.T) {
+		body := reviewBody(t, admissionRequest(t, secretKind, admissionv1.Create, releaseSecret(t, "dev", nil, nil)))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/validate", body))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+		var review admissionv1.AdmissionReview
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&review))
+		assert.Equal(t, "AdmissionReview", review.Kind)
+		assert.Equal(t, "admission.k8s.io/v1", review.APIVersion)
+		assert.Nil(t, review.Request)
+		require.NotNil(t, review.Response)
+		assert.False(t, review.Response.Allowed)
+		assert.Equal(t, "req-1", string(review.Response.UID))
+	})
+
+	t.Run("allows other objects", func(t *testing.T) {
+		body := reviewBody(t, admissionRequest(t, metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, admissionv1.Create, &corev1.ConfigMap{}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/validate", body))
+
+		var review admissionv1.AdmissionReview
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&review))
+		assert.True(t, review.Response.Allowed)
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/validate", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+
+	t.Run("rejects invalid bodies", func(t *testing.T) {
+		for _, body := range []string{"not json", `{"kind":"AdmissionReview"}`} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewBufferString(body)))
+			assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+		}
+	})
+}
+
+func TestServe(t *testing.T) {
+	t.Run("serves until cancelled", func(t *testing.T) {
+		certFile, keyFile := writeSelfSignedCert(t)
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := listener.Addr().String()
+		require.NoError(t, listener.Close())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- Serve(ctx, &Validator{Client: fake.NewClientset()}, ServeOptions{Addr: addr, CertFile: certFile, KeyFile: keyFile})
+		}()
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}} //nolint:gosec // self-signed test certificate
+		require.Eventually(t, func() bool {
+			resp, err := client.Get("https://" + addr + "/healthz")
+			if err != nil {
+				return false
+			}
+			_ = resp.Body.Close()
+
+			return resp.StatusCode == http.StatusOK
+		}, 5*time.Second, 20*time.Millisecond)
+
+		cancel()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Serve did not return after cancel")
+		}
+	})
+
+	t.Run("missing certificate", func(t *testing.T) {
+		err := Serve(context.Background(), &Validator{}, ServeOptions{Addr: "127.0.0.1:0", CertFile: "missing.crt", KeyFile: "missing.key"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "webhook server failed")
+	})
+}
@@ -0,0 +1,189 @@
+// Package webhook implements a validating admission webhook that enforces
+// the namespace TTL policy at admission time: Helm releases created in a
+// namespace that requires a TTL must declare one, and no TTL, declared or
+// scheduled, may exceed the namespace maximum.
+package webhook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+)
+
+// Validator reviews admission requests against the namespace TTL policy.
+type Validator struct {
+	Client kubernetes.Interface
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+}
+
+// Review decides an admission request. Objects other than Helm release
+// Secrets and helm-ttl CronJobs are always allowed.
+func (v *Validator) Review(ctx context.Context, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	var err error
+	switch {
+	case req.Kind.Group == "" && req.Kind.Kind == "Secret" && req.Operation == admissionv1.Create:
+		err = v.reviewReleaseSecret(ctx, req.Object.Raw)
+	case req.Kind.Group == "batch" && req.Kind.Kind == "CronJob" &&
+		(req.Operation == admissionv1.Create || req.Operation == admissionv1.Update):
+		err = v.reviewCronJob(ctx, req.Object.Raw)
+	}
+
+	resp := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: err == nil}
+	if err != nil {
+		resp.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  metav1.StatusReasonForbidden,
+			Code:    403,
+		}
+	}
+
+	return resp
+}
+
+func (v *Validator) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+
+	return time.Now()
+}
+
+// reviewReleaseSecret checks the TTL declared by a Helm release stored in
+// a Secret.
+func (v *Validator) reviewReleaseSecret(ctx context.Context, raw []byte) error {
+	var secret corev1.Secret
+	if err := json.Unmarshal(raw, &secret); err != nil {
+		return fmt.Errorf("failed to decode Secret: %w", err)
+	}
+
+	if secret.Labels["owner"] != "helm" {
+		return nil
+	}
+
+	pol, err := policy.Load(ctx, v.Client, secret.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if !pol.RequireTTL && pol.MaxDuration == 0 {
+		return nil
+	}
+
+	rel, err := decodeRelease(&secret)
+	if err != nil {
+		if pol.RequireTTL {
+			return fmt.Errorf("failed to read Helm release from Secret %s: %w", secret.Name, err)
+		}
+
+		return nil
+	}
+
+	duration, err := ttl.DurationFromRelease(rel)
+	if err != nil {
+		if pol.RequireTTL {
+			return fmt.Errorf("namespace %q requires a TTL: declare %s as a release label (helm install --labels %s=72h) or chart annotation",
+				secret.Namespace, ttl.AnnotationDuration, ttl.AnnotationDuration)
+		}
+
+		return nil
+	}
+
+	now := v.now()
+	target, err := ttl.ParseTimeInput(duration, now)
+	if err != nil {
+		return fmt.Errorf("release %q declares an invalid TTL %q: %w", rel.Name, duration, err)
+	}
+
+	return pol.Check(target, now)
+}
+
+// reviewCronJob checks the schedule of a helm-ttl CronJob against the
+// policy of its release namespace, or of the namespace a namespace TTL
+// deletes.
+func (v *Validator) reviewCronJob(ctx context.Context, raw []byte) error {
+	var cj batchv1.CronJob
+	if err := json.Unmarshal(raw, &cj); err != nil {
+		return fmt.Errorf("failed to decode CronJob: %w", err)
+	}
+
+	if cj.Labels[ttl.LabelManagedBy] != ttl.LabelManagedByValue {
+		return nil
+	}
+
+	namespace := ttl.TargetNamespace(&cj)
+	if namespace == "" {
+		namespace = cj.Namespace
+	}
+
+	pol, err := policy.Load(ctx, v.Client, namespace)
+	if err != nil {
+		return err
+	}
+
+	// The schedule is being written now, so it fires at its first match
+	// from now on.
+	now := v.now()
+	target, _, err := ttl.ResolveCronSchedule(cj.Spec.Schedule, now, now)
+	if err != nil {
+		return err
+	}
+
+	return pol.Check(target, now)
+}
+
+// decodeRelease reads the Helm release stored in a Secret by the secrets
+// storage driver: base64-encoded, usually gzipped JSON, with the release
+// labels kept on the Secret.
+func decodeRelease(secret *corev1.Secret) (*release.Release, error) {
+	data, err := base64.StdEncoding.DecodeString(string(secret.Data["release"]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode release data: %w", err)
+	}
+
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b, 0x08}) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress release data: %w", err)
+		}
+		defer func() { _ = r.Close() }()
+
+		data, err = io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress release data: %w", err)
+		}
+	}
+
+	var rel release.Release
+	if err := json.Unmarshal(data, &rel); err != nil {
+		return nil, fmt.Errorf("failed to parse release data: %w", err)
+	}
+
+	rel.Labels = make(map[string]string)
+	for k, v := range secret.Labels {
+		rel.Labels[k] = v
+	}
+	for _, k := range driver.GetSystemLabels() {
+		delete(rel.Labels, k)
+	}
+
+	return &rel, nil
+}
@@ -0,0 +1,291 @@
+package webhook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+
+	"github.com/josegonzalez/helm-ttl/pkg/policy"
+	"github.com/josegonzalez/helm-ttl/pkg/ttl"
+)
+
+var testNow = time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func policyConfigMap(namespace string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: policy.ConfigMapName, Namespace: namespace},
+		Data:       data,
+	}
+}
+
+// releaseSecret encodes a release the way the helm secrets driver does.
+func releaseSecret(t *testing.T, namespace string, labels, chartAnnotations map[string]string) *corev1.Secret {
+	t.Helper()
+
+	rel := &release.Release{
+		Name:      "myapp",
+		Namespace: namespace,
+		Version:   1,
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "test-chart", Version: "1.0.0", Annotations: chartAnnotations}},
+	}
+	data, err := json.Marshal(rel)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	secretLabels := map[string]string{"owner": "helm", "name": "myapp", "status": "pending-install", "version": "1"}
+	for k, v := range labels {
+		secretLabels[k] = v
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "sh.helm.release.v1.myapp.v1", Namespace: namespace, Labels: secretLabels},
+		Data:       map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(buf.Bytes()))},
+	}
+}
+
+func admissionRequest(t *testing.T, kind metav1.GroupVersionKind, op admissionv1.Operation, obj any) *admissionv1.AdmissionRequest {
+	t.Helper()
+
+	raw, err := json.Marshal(obj)
+	require.NoError(t, err)
+
+	return &admissionv1.AdmissionRequest{
+		UID:       types.UID("req-1"),
+		Kind:      kind,
+		Operation: op,
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+}
+
+var (
+	secretKind  = metav1.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	cronJobKind = metav1.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"}
+)
+
+func TestReview_ReleaseSecret(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		policy    map[string]string
+		labels    map[string]string
+		chartAnno map[string]string
+		allowed   bool
+		message   string
+	}{
+		{name: "no policy", allowed: true},
+		{name: "required and missing", policy: map[string]string{policy.KeyRequireTTL: "true"}, allowed: false, message: `namespace "dev" requires a TTL`},
+		{name: "required and declared as label", policy: map[string]string{policy.KeyRequireTTL: "true"}, labels: map[string]string{ttl.AnnotationDuration: "72h"}, allowed: true},
+		{name: "required and declared in chart", policy: map[string]string{policy.KeyRequireTTL: "true"}, chartAnno: map[string]string{ttl.AnnotationDuration: "3 days"}, allowed: true},
+		{name: "declared above maximum", policy: map[string]string{policy.KeyMaxDuration: "7d"}, labels: map[string]string{ttl.AnnotationDuration: "14d"}, allowed: false, message: "exceeds the maximum"},
+		{name: "declared within maximum", policy: map[string]string{policy.KeyMaxDuration: "7d"}, labels: map[string]string{ttl.AnnotationDuration: "7d"}, allowed: true},
+		{name: "maximum without declaration", policy: map[string]string{policy.KeyMaxDuration: "7d"}, allowed: true},
+		{name: "invalid declaration", policy: map[string]string{policy.KeyMaxDuration: "7d"}, labels: map[string]string{ttl.AnnotationDuration: "someday"}, allowed: false, message: `declares an invalid TTL "someday"`},
+		{name: "invalid policy", policy: map[string]string{policy.KeyRequireTTL: "maybe"}, allowed: false, message: "invalid requireTTL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset()
+			if tt.policy != nil {
+				client = fake.NewClientset(policyConfigMap("dev", tt.policy))
+			}
+
+			v := &Validator{Client: client, Now: func() time.Time { return testNow }}
+			resp := v.Review(ctx, admissionRequest(t, secretKind, admissionv1.Create, releaseSecret(t, "dev", tt.labels, tt.chartAnno)))
+
+			assert.Equal(t, types.UID("req-1"), resp.UID)
+			assert.Equal(t, tt.allowed, resp.Allowed)
+			if !tt.allowed {
+				require.NotNil(t, resp.Result)
+				assert.Contains(t, resp.Result.Message, tt.message)
+				assert.Equal(t, int32(403), resp.Result.Code)
+			}
+		})
+	}
+
+	t.Run("non-helm Secret", func(t *testing.T) {
+		client := fake.NewClientset(policyConfigMap("dev", map[string]string{policy.KeyRequireTTL: "true"}))
+		v := &Validator{Client: client}
+
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "db-password", Namespace: "dev"}}
+		resp := v.Review(ctx, admissionRequest(t, secretKind, admissionv1.Create, secret))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("undecodable release", func(t *testing.T) {
+		secret := releaseSecret(t, "dev", nil, nil)
+		secret.Data["release"] = []byte("not base64!")
+
+		client := fake.NewClientset(policyConfigMap("dev", map[string]string{policy.KeyRequireTTL: "true"}))
+		resp := (&Validator{Client: client}).Review(ctx, admissionRequest(t, secretKind, admissionv1.Create, secret))
+		assert.False(t, resp.Allowed)
+		assert.Contains(t, resp.Result.Message, "failed to read Helm release")
+
+		client = fake.NewClientset(policyConfigMap("dev", map[string]string{policy.KeyMaxDuration: "7d"}))
+		resp = (&Validator{Client: client}).Review(ctx, admissionRequest(t, secretKind, admissionv1.Create, secret))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("invalid object", func(t *testing.T) {
+		req := &admissionv1.AdmissionRequest{Kind: secretKind, Operation: admissionv1.Create, Object: runtime.RawExtension{Raw: []byte("{")}}
+		resp := (&Validator{Client: fake.NewClientset()}).Review(ctx, req)
+		assert.False(t, resp.Allowed)
+		assert.Contains(t, resp.Result.Message, "failed to decode Secret")
+	})
+
+	t.Run("updates are not reviewed", func(t *testing.T) {
+		client := fake.NewClientset(policyConfigMap("dev", map[string]string{policy.KeyRequireTTL: "true"}))
+		resp := (&Validator{Client: client}).Review(ctx, admissionRequest(t, secretKind, admissionv1.Update, releaseSecret(t, "dev", nil, nil)))
+		assert.True(t, resp.Allowed)
+	})
+}
+
+func TestReview_CronJob(t *testing.T) {
+	ctx := context.Background()
+
+	cronJob := func(t *testing.T, target time.Time) *batchv1.CronJob {
+		t.Helper()
+
+		cj, err := ttl.BuildCronJob(ttl.CronJobOptions{
+			ReleaseName:      "myapp",
+			ReleaseNamespace: "dev",
+			CronjobNamespace: "ops",
+			Schedule:         ttl.TimeToCronSchedule(target),
+			ServiceAccount:   "default",
+		})
+		require.NoError(t, err)
+
+		return cj
+	}
+
+	client := fake.NewClientset(policyConfigMap("dev", map[string]string{policy.KeyMaxDuration: "7d"}))
+	v := &Validator{Client: client, Now: func() time.Time { return testNow }}
+
+	t.Run("within maximum", func(t *testing.T) {
+		resp := v.Review(ctx, admissionRequest(t, cronJobKind, admissionv1.Update, cronJob(t, testNow.Add(3*24*time.Hour))))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("above maximum", func(t *testing.T) {
+		resp := v.Review(ctx, admissionRequest(t, cronJobKind, admissionv1.Create, cronJob(t, testNow.Add(30*24*time.Hour))))
+		assert.False(t, resp.Allowed)
+		assert.Contains(t, resp.Result.Message, `allowed in namespace "dev"`)
+	})
+
+	t.Run("namespace TTL checked against the namespace it deletes", func(t *testing.T) {
+		cj, err := ttl.BuildNamespaceCronJob(ttl.NamespaceCronJobOptions{
+			Namespace:        "dev",
+			CronjobNamespace: "ops",
+			Schedule:         ttl.TimeToCronSchedule(testNow.Add(30 * 24 * time.Hour)),
+			ServiceAccount:   "default",
+		})
+		require.NoError(t, err)
+
+		resp := v.Review(ctx, admissionRequest(t, cronJobKind, admissionv1.Create, cj))
+		assert.False(t, resp.Allowed)
+		assert.Contains(t, resp.Result.Message, `allowed in namespace "dev"`)
+	})
+
+	t.Run("unmanaged CronJob", func(t *testing.T) {
+		cj := &batchv1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "dev"},
+			Spec:       batchv1.CronJobSpec{Schedule: "@daily"},
+		}
+		resp := v.Review(ctx, admissionRequest(t, cronJobKind, admissionv1.Create, cj))
+		assert.True(t, resp.Allowed)
+	})
+
+	t.Run("release namespace defaults to the CronJob namespace", func(t *testing.T) {
+		cj := cronJob(t, testNow.Add(30*24*time.Hour))
+		delete(cj.Labels, ttl.LabelReleaseNamespace)
+		cj.Namespace = "dev"
+
+		resp := v.Review(ctx, admissionRequest(t, cronJobKind, admissionv1.Update, cj))
+		assert.False(t, resp.Allowed)
+	})
+
+	t.Run("invalid schedule", func(t *testing.T) {
+		cj := cronJob(t, testNow)
+		cj.Spec.Schedule = "@daily"
+
+		resp := v.Review(ctx, admissionRequest(t, cronJobKind, admissionv1.Update, cj))
+		assert.False(t, resp.Allowed)
+		assert.Contains(t, resp.Result.Message, "invalid cron schedule")
+	})
+
+	t.Run("invalid object", func(t *testing.T) {
+		req := &admissionv1.AdmissionRequest{Kind: cronJobKind, Operation: admissionv1.Update, Object: runtime.RawExtension{Raw: []byte("{")}}
+		resp := v.Review(ctx, req)
+		assert.False(t, resp.Allowed)
+		assert.Contains(t, resp.Result.Message, "failed to decode CronJob")
+	})
+
+	t.Run("policy error", func(t *testing.T) {
+		failing := fake.NewClientset()
+		failing.PrependReactor("get", "configmaps", func(_ k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("forbidden")
+		})
+
+		resp := (&Validator{Client: failing}).Review(ctx, admissionRequest(t, cronJobKind, admissionv1.Update, cronJob(t, testNow)))
+		assert.False(t, resp.Allowed)
+		assert.Contains(t, resp.Result.Message, "forbidden")
+	})
+
+	t.Run("deletes are not reviewed", func(t *testing.T) {
+		resp := v.Review(ctx, &admissionv1.AdmissionRequest{Kind: cronJobKind, Operation: admissionv1.Delete})
+		assert.True(t, resp.Allowed)
+	})
+}
+
+func TestDecodeRelease(t *testing.T) {
+	t.Run("uncompressed", func(t *testing.T) {
+		data, err := json.Marshal(&release.Release{Name: "myapp"})
+		require.NoError(t, err)
+
+		rel, err := decodeRelease(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"owner": "helm", "team": "checkout"}},
+			Data:       map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(data))},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "myapp", rel.Name)
+		assert.Equal(t, map[string]string{"team": "checkout"}, rel.Labels)
+	})
+
+	t.Run("corrupt gzip", func(t *testing.T) {
+		data := []byte{0x1f, 0x8b, 0x08, 0x00}
+		_, err := decodeRelease(&corev1.Secret{Data: map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(data))}})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to decompress")
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		_, err := decodeRelease(&corev1.Secret{Data: map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString([]byte("{")))}})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to parse release data")
+	})
+}